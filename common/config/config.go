@@ -83,6 +83,46 @@ var (
 	// ExternalBillingMaxTimeoutSec caps user-supplied external billing hold durations (seconds).
 	ExternalBillingMaxTimeoutSec = env.Int("EXTERNAL_BILLING_MAX_TIMEOUT", 3600)
 
+	// BatchPreConsumeQuota is the quota held when a Batch API job is created; it is reconciled once the output file completes.
+	BatchPreConsumeQuota = int64(env.Int("BATCH_PRE_CONSUME_QUOTA", 50000))
+	// BatchHoldTimeoutSec bounds how long a batch hold stays pending (seconds) before it auto-confirms at the held amount.
+	BatchHoldTimeoutSec = env.Int("BATCH_HOLD_TIMEOUT", 72*3600)
+	// BatchSettlementInterval controls how often unsettled batch jobs are polled upstream (seconds); 0 disables polling.
+	BatchSettlementInterval = env.Int("BATCH_SETTLEMENT_INTERVAL", 300)
+	// BatchDiscountRatio scales batch usage cost relative to synchronous pricing (upstreams usually bill batches at 50%).
+	BatchDiscountRatio = env.Float64("BATCH_DISCOUNT_RATIO", 0.5)
+
+	// VideoHoldTimeoutSec bounds how long a video job may stay unfinished upstream (seconds) before it is
+	// treated as failed and its quota hold is refunded.
+	VideoHoldTimeoutSec = env.Int("VIDEO_HOLD_TIMEOUT", 24*3600)
+	// VideoSettlementInterval controls how often unsettled video jobs are polled upstream (seconds); 0 disables polling.
+	VideoSettlementInterval = env.Int("VIDEO_SETTLEMENT_INTERVAL", 30)
+
+	// ResponseCacheEnabled replays identical deterministic (temperature=0) chat, Claude Messages and
+	// Response API requests from a cache instead of calling upstream again.
+	ResponseCacheEnabled = env.Bool("RESPONSE_CACHE_ENABLED", false)
+	// ResponseCacheTTLSec bounds how long a cached response is replayed (seconds).
+	ResponseCacheTTLSec = env.Int("RESPONSE_CACHE_TTL", 3600)
+	// ResponseCacheQuotaRatio is the fraction of the regular price charged for a cache hit; 0 serves hits for free.
+	ResponseCacheQuotaRatio = env.Float64("RESPONSE_CACHE_QUOTA_RATIO", 0)
+	// ResponseCacheMaxBodyBytes skips caching responses larger than this many bytes.
+	ResponseCacheMaxBodyBytes = env.Int("RESPONSE_CACHE_MAX_BODY_BYTES", 1<<20)
+	// ResponseCacheMemoryMaxEntries caps the in-process response cache used when Redis is disabled.
+	ResponseCacheMemoryMaxEntries = env.Int("RESPONSE_CACHE_MEMORY_MAX_ENTRIES", 1000)
+
+	// PromptCacheAffinityEnabled routes requests sharing a session, user or cacheable prompt prefix
+	// back to the channel that served them last, so upstream prompt caches keep hitting.
+	PromptCacheAffinityEnabled = env.Bool("PROMPT_CACHE_AFFINITY_ENABLED", false)
+	// PromptCacheAffinityTTLSec is how long a binding survives without traffic (seconds); each
+	// successful request renews it. Upstream prompt caches usually expire after 5 minutes.
+	PromptCacheAffinityTTLSec = env.Int("PROMPT_CACHE_AFFINITY_TTL", 300)
+	// PromptCacheAffinityMemoryMaxEntries caps the in-process binding table used when Redis is disabled.
+	PromptCacheAffinityMemoryMaxEntries = env.Int("PROMPT_CACHE_AFFINITY_MEMORY_MAX_ENTRIES", 10000)
+
+	// MCPMaxToolRounds bounds the model round-trips of a Response API request whose MCP tools are
+	// executed by the gateway because the channel has no native Response API support.
+	MCPMaxToolRounds = env.Int("MCP_MAX_TOOL_ROUNDS", 8)
+
 	// ShutdownTimeoutSec specifies the graceful shutdown timeout (seconds) for the HTTP server and background workers.
 	ShutdownTimeoutSec = env.Int("SHUTDOWN_TIMEOUT", 360)
 
@@ -110,14 +150,18 @@ var (
 		return v
 	}()
 
-	// EnableMetric toggles the failure rate monitor that can disable unstable channels.
+	// EnableMetric toggles the per channel and model circuit breaker that stops routing a model to a channel failing it.
 	EnableMetric = env.Bool("ENABLE_METRIC", false)
 	// EnablePrometheusMetrics exposes the /metrics endpoint for Prometheus scrapers when true.
 	EnablePrometheusMetrics = env.Bool("ENABLE_PROMETHEUS_METRICS", true)
-	// MetricQueueSize configures the buffered queue that aggregates success/failure events before processing.
+	// MetricQueueSize is how many recent requests of a channel for a model the circuit breaker judges.
 	MetricQueueSize = env.Int("METRIC_QUEUE_SIZE", 10)
-	// MetricSuccessRateThreshold defines the minimum acceptable success ratio before a channel is flagged as unhealthy.
+	// MetricSuccessRateThreshold defines the minimum acceptable success ratio before a channel's circuit for a model opens.
 	MetricSuccessRateThreshold = env.Float64("METRIC_SUCCESS_RATE_THRESHOLD", 0.8)
+	// CircuitBreakerOpenSeconds is how long an open circuit skips the channel before trial probes are sent.
+	CircuitBreakerOpenSeconds = env.Int("CIRCUIT_BREAKER_OPEN_SECONDS", 60)
+	// CircuitBreakerProbes is how many trial probes in a row must succeed to close a half-open circuit.
+	CircuitBreakerProbes = env.Int("CIRCUIT_BREAKER_PROBES", 2)
 	// MetricSuccessChanSize sizes the buffered success event channel.
 	MetricSuccessChanSize = env.Int("METRIC_SUCCESS_CHAN_SIZE", 1024)
 	// MetricFailChanSize sizes the buffered failure event channel.
@@ -152,6 +196,31 @@ var (
 		return v
 	}()
 
+	// CreditGrantDrawOrder selects how usage draws credit grants of equal priority down: "expiring_first"
+	// (the default) uses the grants expiring soonest first, "fifo" the oldest grants first.
+	CreditGrantDrawOrder = strings.TrimSpace(env.String("CREDIT_GRANT_DRAW_ORDER", "expiring_first"))
+
+	// AuditLogRetentionDays controls how long admin audit log entries are kept before the retention worker removes them (0 keeps them forever).
+	AuditLogRetentionDays = func() int {
+		v := env.Int("AUDIT_LOG_RETENTION_DAYS", 0)
+		if v < 0 {
+			return 0
+		}
+		return v
+	}()
+
+	// LogShipperSinks is a JSON array of the sinks every consumption log is forwarded to, see
+	// logship.SinkConfig; empty disables shipping.
+	LogShipperSinks = env.String("LOG_SHIPPER_SINKS", "")
+	// LogShipperBatchSize caps how many logs are sent to a sink at once.
+	LogShipperBatchSize = env.Int("LOG_SHIPPER_BATCH_SIZE", 100)
+	// LogShipperFlushInterval is how many seconds a partial batch waits before it is sent.
+	LogShipperFlushInterval = env.Int("LOG_SHIPPER_FLUSH_INTERVAL", 5)
+	// LogShipperQueueSize caps the logs queued per sink; logs beyond it are dropped.
+	LogShipperQueueSize = env.Int("LOG_SHIPPER_QUEUE_SIZE", 10000)
+	// LogShipperMaxRetries is how often a failed batch is retried before it is dropped.
+	LogShipperMaxRetries = env.Int("LOG_SHIPPER_MAX_RETRIES", 5)
+
 	// LogPushAPI defines the webhook endpoint for escalated log alerts.
 	LogPushAPI = env.String("LOG_PUSH_API", "")
 	// LogPushType labels outbound log alerts so downstream processors can route them.
@@ -372,6 +441,23 @@ var (
 	GitHubClientSecret = ""
 )
 
+var (
+	// PaymentProvider selects the payment provider used for self-service top-up; empty disables it.
+	PaymentProvider = ""
+	// PaymentCurrency is the ISO currency code top-ups are charged in.
+	PaymentCurrency = "usd"
+	// PaymentQuotaPerUnit is the quota credited per unit of PaymentCurrency paid.
+	PaymentQuotaPerUnit = 500 * 1000.0
+	// PaymentMinTopUp is the smallest top-up accepted, in units of PaymentCurrency.
+	PaymentMinTopUp = 1.0
+	// StripeApiBase is the API base URL of the Stripe-compatible payment provider.
+	StripeApiBase = "https://api.stripe.com"
+	// StripeApiSecret stores the API secret key of the Stripe-compatible payment provider.
+	StripeApiSecret = ""
+	// StripeWebhookSecret stores the secret Stripe signs webhook events with.
+	StripeWebhookSecret = ""
+)
+
 var (
 	// LarkClientId stores the OAuth client ID for Lark login.
 	LarkClientId = ""
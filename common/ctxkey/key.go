@@ -54,19 +54,46 @@ const (
 	// Read widely for billing, logging, and meta.
 	ChannelId = "channel_id"
 
+	// ChannelKeyId is the id of the pooled key (model.ChannelKey) chosen for a multi-key channel.
+	// Set in: middleware/distributor.SetupContextForSelectedChannel when the channel has a KeyMode.
+	// Read in: controller/relay to suspend or disable only the failing key instead of the whole channel.
+	ChannelKeyId = "channel_key_id"
+
 	// SpecificChannelId indicates the caller explicitly requested a particular channel.
-	// Set in: middleware/auth.TokenAuth via token suffix or :channelid route param (admin-only).
+	// Set in: middleware/auth.TokenAuth via token suffix or :channelid route param (admin-only),
+	//         and middleware/batch.PinBatchResource to route file/batch ids back to their channel.
 	// Read in: middleware/distributor to bypass normal selection and use that specific channel.
 	SpecificChannelId = "specific_channel_id"
 
+	// SpecificChannelKeyId pins the pooled key of a multi-key SpecificChannelId.
+	// Set in: middleware/batch.PinBatchResource, because upstream files and batches may only be visible to the key that created them.
+	// Read in: middleware/distributor.selectChannelKey instead of selecting a key from the pool.
+	SpecificChannelKeyId = "specific_channel_key_id"
+
 	// RequestModel is the model name as requested by the client (e.g., "gpt-4o").
 	// Set in: middleware/auth.TokenAuth (parsed from body/query depending on endpoint) or early in adaptor handlers
 	//         when TokenAuth did not parse the body yet.
-	// Invariant: never mutate this value; it must always reflect the user's original input.
+	// Invariant: never mutate this value; it must always reflect the user's original input. The one exception is
+	// controller/relay switching to a fallback model under a retry policy, which keeps the original in FallbackFromModel.
 	// Mapping/rewriting to provider-specific names is handled via ModelMapping/Meta (ActualModelName), not by
 	// mutating RequestModel. Use RequestModel for logging, billing trace, retries, and response.model.
 	RequestModel = "request_model"
 
+	// HedgeAttempt holds the *hedge.Attempt of a hedged request attempt; each attempt runs on its own copy of the context.
+	// Set in: controller/relay when it hedges a request.
+	// Read in: relay/billing, which charges the user for the winning attempt only.
+	HedgeAttempt = "hedge_attempt"
+
+	// FallbackFromModel is the model the client requested once a retry policy switched the request to a fallback model.
+	// Set in: controller/relay before a fallback attempt.
+	// Read in: relay/meta.GetByContext, recorded in the consume log metadata.
+	FallbackFromModel = "fallback_from_model"
+
+	// PricingRule holds the *pricingrule.Rule matched for the request's group and model when its channel was selected, if any.
+	// Set in: middleware.SetupContextForSelectedChannel, which also applies the rule's group ratio to ChannelRatio.
+	// Read in: relay/controller pricing, and relay/billing which records the rule in the consume log metadata.
+	PricingRule = "pricing_rule"
+
 	// ConvertedRequest holds the provider-specific request body after conversion.
 	// Set in: controller/text during conversion, and in several adaptors (AWS/Gemini/OpenAI variants).
 	// Read in: adaptor DoRequest/DoResponse or signing steps that need the converted structure.
@@ -126,6 +153,55 @@ const (
 	// Read in: controllers to bypass quota checks when true.
 	TokenQuotaUnlimited = "token_quota_unlimited"
 
+	// TokenRateLimitRpm / TokenRateLimitTpm are the per-token request and token per-minute limits (0 = unlimited).
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: middleware/token-rate-limit.TokenRateLimit.
+	TokenRateLimitRpm = "token_rate_limit_rpm"
+	TokenRateLimitTpm = "token_rate_limit_tpm"
+
+	// TokenBudgetQuota, TokenBudgetPeriod and TokenBudgetUsedQuota describe the token's rolling spend budget
+	// and how much of the current window is already used.
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: middleware/token-rate-limit.TokenRateLimit to reject requests once the budget is spent.
+	TokenBudgetQuota     = "token_budget_quota"
+	TokenBudgetPeriod    = "token_budget_period"
+	TokenBudgetUsedQuota = "token_budget_used_quota"
+
+	// OrganizationId is the organization whose shared quota pool the API token draws from (0 = personal quota).
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay/meta.GetByContext and the relay pre-consume quota checks.
+	OrganizationId = "organization_id"
+
+	// TokenGuardrails holds the token's own guardrail rules as a JSON array (empty when none).
+	// Set in: middleware/auth.TokenAuth.
+	// Read in: relay/controller guardrails, combined with the group's GuardrailPolicy rules.
+	TokenGuardrails = "token_guardrails"
+
+	// GuardrailInputViolations holds the []guardrail.Violation found on the request body.
+	// Set in: relay/controller guardrails once the input stage has run; its presence also marks the
+	//         cached request body as already checked, so retries skip the input stage.
+	GuardrailInputViolations = "guardrail_input_violations"
+
+	// PromptCacheAffinityKey is the hashed key that binds this request to a channel.
+	// Set in: middleware/distributor when prompt-cache affinity applies to the request.
+	// Read in: controller/relay to bind the serving channel, relay/meta for the consume log.
+	PromptCacheAffinityKey = "prompt_cache_affinity_key"
+
+	// PromptCacheAffinitySource names what the affinity key was derived from (session, prompt_cache_key, prefix, user).
+	// Set in: middleware/distributor together with PromptCacheAffinityKey.
+	// Read in: relay/meta.GetByContext.
+	PromptCacheAffinitySource = "prompt_cache_affinity_source"
+
+	// PromptCacheAffinityChannelId is the channel the key was bound to when the request arrived, 0 when unbound.
+	// Set in: middleware/distributor after looking up the binding.
+	// Read in: controller/relay to drop a failing binding, relay/meta to tell sticky hits from misses.
+	PromptCacheAffinityChannelId = "prompt_cache_affinity_channel_id"
+
+	// PromptCacheAffinityKeyId is the pooled key of PromptCacheAffinityChannelId the binding names, 0 when none.
+	// Set in: middleware/distributor after looking up the binding.
+	// Read in: middleware/distributor.selectChannelKey, which prefers the key while it is available.
+	PromptCacheAffinityKeyId = "prompt_cache_affinity_key_id"
+
 	// UserQuota optionally carries the user’s quota for metrics/UI labeling.
 	// Not set by default middleware; controllers typically fetch from cache directly.
 	// Used in: controller/text metrics recording (if present). Treat as optional.
@@ -223,6 +299,12 @@ const (
 	// downstream converters can hydrate metadata when rewriting responses.
 	ResponseAPIRequestOriginal = "response_api_request_original"
 
+	// ResponseAPIInputItems keeps the input items sent with the current Response API request,
+	// before the history of a locally stored previous_response_id was prepended.
+	// Set in: relay/controller/response after expanding previous_response_id.
+	// Read in: relay/controller when persisting fallback-converted responses.
+	ResponseAPIInputItems = "response_api_input_items"
+
 	// ResponseStreamRewriteHandler stores a streaming rewrite adapter that can transform
 	// upstream chat completion SSE chunks into another streaming format (e.g., Response API)
 	// before flushing them to the client.
@@ -237,4 +319,10 @@ const (
 	// Set in: relay/controller/text when initializing a streaming request.
 	// Read in: streaming adaptors to record completion progress and enforce quota limits mid-stream.
 	StreamingQuotaTracker = "streaming_quota_tracker"
+
+	// GeminiRequestBody keeps the native Gemini API request body, since requests served by
+	// non-Gemini channels replace the cached request body with the converted chat request.
+	// Set in: relay/controller/gemini on the first attempt.
+	// Read in: relay/controller/gemini on retries to restore the native body.
+	GeminiRequestBody = "gemini_request_body"
 )
@@ -0,0 +1,141 @@
+// Package eventbus broadcasts cache invalidations between the nodes of a deployment through
+// Redis pub/sub. A node that changes channels, options or users publishes an event after
+// refreshing its own caches, and every other node refreshes the matching cache right away
+// instead of at its next SYNC_FREQUENCY poll.
+//
+// Without Redis nothing is broadcast and the nodes keep relying on polling; the periodic sync
+// also stays on with Redis to catch events missed while a node was disconnected.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// redisChannel is the pub/sub channel invalidations are sent on.
+const redisChannel = "one_api:invalidations"
+
+// Topics of the invalidation events.
+const (
+	// TopicChannels reloads the channel cache.
+	TopicChannels = "channels"
+	// TopicAbilitySuspended drops a suspended ability from the channel cache; the key is
+	// the JSON encoded suspension.
+	TopicAbilitySuspended = "ability_suspended"
+	// TopicChannelKeys drops the cached keys of the channel whose id is the key.
+	TopicChannelKeys = "channel_keys"
+	// TopicOptions reloads the option whose name is the key.
+	TopicOptions = "options"
+	// TopicUsers refreshes the in-memory state of the user whose id is the key.
+	TopicUsers = "users"
+)
+
+// Event is an invalidation sent between nodes.
+type Event struct {
+	Topic string `json:"topic"`
+	Key   string `json:"key,omitempty"`
+	// Node identifies the sender, which ignores its own events.
+	Node string `json:"node"`
+}
+
+// Handler refreshes the cache an event invalidates.
+type Handler func(key string)
+
+var (
+	nodeId = random.GetUUID()
+
+	handlersLock sync.RWMutex
+	handlers     = make(map[string][]Handler)
+)
+
+// Subscribe registers handler for the events of topic published by other nodes.
+func Subscribe(topic string, handler Handler) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	handlers[topic] = append(handlers[topic], handler)
+}
+
+// Publish tells the other nodes that the cache of topic is stale for key. It is a no-op
+// without Redis, and failures are only logged since polling eventually catches up.
+func Publish(ctx context.Context, topic, key string) {
+	if !common.IsRedisEnabled() || common.RDB == nil {
+		return
+	}
+	payload, err := json.Marshal(Event{Topic: topic, Key: key, Node: nodeId})
+	if err != nil {
+		logger.Logger.Error("failed to marshal invalidation event", zap.String("topic", topic), zap.Error(err))
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := common.RDB.Publish(ctx, redisChannel, payload).Err(); err != nil {
+		logger.Logger.Warn("failed to publish invalidation event, other nodes will catch up on their next sync",
+			zap.String("topic", topic),
+			zap.String("key", key),
+			zap.Error(errors.WithStack(err)))
+	}
+}
+
+// Start listens to the events of other nodes until ctx is done. It does nothing without Redis.
+func Start(ctx context.Context) error {
+	if !common.IsRedisEnabled() {
+		return nil
+	}
+	client, ok := common.RDB.(redis.UniversalClient)
+	if !ok {
+		return errors.Errorf("redis client %T does not support pub/sub", common.RDB)
+	}
+	pubsub := client.Subscribe(ctx, redisChannel)
+	// wait for the subscription so no event published after Start returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return errors.Wrap(err, "subscribe to invalidation events")
+	}
+	logger.Logger.Info("listening to invalidation events", zap.String("node", nodeId))
+
+	go func() {
+		defer pubsub.Close()
+		// the channel reconnects by itself and is closed with pubsub
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				dispatch(msg.Payload)
+			}
+		}
+	}()
+	return nil
+}
+
+// dispatch runs the handlers of an event received from another node.
+func dispatch(payload string) {
+	var event Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		logger.Logger.Warn("invalid invalidation event", zap.String("payload", payload), zap.Error(err))
+		return
+	}
+	if event.Node == nodeId {
+		return
+	}
+	handlersLock.RLock()
+	topicHandlers := handlers[event.Topic]
+	handlersLock.RUnlock()
+	for _, handler := range topicHandlers {
+		handler(event.Key)
+	}
+}
@@ -0,0 +1,30 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatch(t *testing.T) {
+	var keys []string
+	Subscribe("test_dispatch", func(key string) { keys = append(keys, key) })
+	Subscribe("test_dispatch", func(key string) { keys = append(keys, "again:"+key) })
+
+	send := func(event Event) {
+		payload, err := json.Marshal(event)
+		require.NoError(t, err)
+		dispatch(string(payload))
+	}
+
+	send(Event{Topic: "test_dispatch", Key: "1", Node: "other-node"})
+	require.Equal(t, []string{"1", "again:1"}, keys)
+
+	// a node does not act on its own events, it already refreshed its caches
+	send(Event{Topic: "test_dispatch", Key: "2", Node: nodeId})
+	// nor on topics nobody subscribed to
+	send(Event{Topic: "test_unknown", Key: "3", Node: "other-node"})
+	dispatch("not json")
+	require.Equal(t, []string{"1", "again:1"}, keys)
+}
@@ -0,0 +1,237 @@
+// Package logship forwards consumption logs to external sinks, such as a webhook, a Kafka
+// REST proxy, S3-compatible object storage or ClickHouse, so that usage reaches data
+// warehouses without querying the database.
+//
+// Records are queued in memory and sent to every sink in batches, with retries. Shipping
+// never blocks request handling: when a sink falls behind and its queue is full, records for
+// it are dropped and counted. The database stays the source of truth, and exports fill gaps.
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// sendTimeout bounds a single attempt to send a batch.
+const sendTimeout = 30 * time.Second
+
+// maxRetryBackoff caps the exponential backoff between attempts.
+const maxRetryBackoff = time.Minute
+
+// Sink receives batches of records, each a JSON object.
+type Sink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Send delivers a batch. Sinks must not retain records after returning.
+	Send(ctx context.Context, records []json.RawMessage) error
+}
+
+// Options tune how records are batched and retried.
+type Options struct {
+	// BatchSize is the most records sent at once.
+	BatchSize int
+	// FlushInterval sends a partial batch once it has waited this long.
+	FlushInterval time.Duration
+	// QueueSize is the most records queued per sink.
+	QueueSize int
+	// MaxRetries is how often a failed batch is retried before it is dropped.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry; it doubles with every retry.
+	RetryBackoff time.Duration
+}
+
+func (opts Options) withDefaults() Options {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	return opts
+}
+
+var (
+	shippersLock sync.RWMutex
+	shippers     []*shipper
+	stopped      bool
+)
+
+// shipper batches the records of one sink, so that a slow sink does not hold up the others.
+type shipper struct {
+	sink    Sink
+	opts    Options
+	queue   chan json.RawMessage
+	abort   chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// Start ships records to sinks until Stop is called. Calling it again replaces the sinks
+// after stopping the previous ones.
+func Start(sinks []Sink, opts Options) {
+	Stop(context.Background())
+
+	opts = opts.withDefaults()
+	started := make([]*shipper, 0, len(sinks))
+	for _, sink := range sinks {
+		s := &shipper{
+			sink:  sink,
+			opts:  opts,
+			queue: make(chan json.RawMessage, opts.QueueSize),
+			abort: make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+		go s.run()
+		started = append(started, s)
+		logger.Logger.Info("log shipper started", zap.String("sink", sink.Name()))
+	}
+
+	shippersLock.Lock()
+	shippers = started
+	stopped = false
+	shippersLock.Unlock()
+}
+
+// Enabled tells whether any sink is shipping records.
+func Enabled() bool {
+	shippersLock.RLock()
+	defer shippersLock.RUnlock()
+	return len(shippers) > 0
+}
+
+// Ship queues record, marshaled as JSON, for every sink. It never blocks.
+func Ship(record any) {
+	shippersLock.RLock()
+	defer shippersLock.RUnlock()
+	if stopped || len(shippers) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		logger.Logger.Error("failed to marshal shipped log", zap.Error(err))
+		return
+	}
+	for _, s := range shippers {
+		select {
+		case s.queue <- payload:
+		default:
+			// report the first drop and then every thousandth, not every record
+			if n := s.dropped.Add(1); n == 1 || n%1000 == 0 {
+				logger.Logger.Warn("log shipper queue is full, dropping records",
+					zap.String("sink", s.sink.Name()), zap.Int64("dropped", n))
+			}
+		}
+	}
+}
+
+// Stop stops accepting records and sends what is queued. Batches still failing when ctx
+// ends are dropped.
+func Stop(ctx context.Context) error {
+	shippersLock.Lock()
+	current := shippers
+	shippers = nil
+	stopped = true
+	for _, s := range current {
+		close(s.queue)
+	}
+	shippersLock.Unlock()
+
+	for _, s := range current {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			for _, s := range current {
+				select {
+				case <-s.abort:
+				default:
+					close(s.abort)
+				}
+			}
+			return errors.Wrap(ctx.Err(), "flush log shippers")
+		}
+	}
+	return nil
+}
+
+func (s *shipper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]json.RawMessage, 0, s.opts.BatchSize)
+	for {
+		select {
+		case record, ok := <-s.queue:
+			if !ok {
+				if len(batch) > 0 {
+					s.send(batch)
+				}
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= s.opts.BatchSize {
+				s.send(batch)
+				batch = make([]json.RawMessage, 0, s.opts.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.send(batch)
+				batch = make([]json.RawMessage, 0, s.opts.BatchSize)
+			}
+		}
+	}
+}
+
+// send delivers a batch, retrying with exponential backoff.
+func (s *shipper) send(batch []json.RawMessage) {
+	backoff := s.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := s.sink.Send(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt >= s.opts.MaxRetries {
+			s.dropBatch(batch, err)
+			return
+		}
+
+		logger.Logger.Warn("failed to ship logs, retrying",
+			zap.String("sink", s.sink.Name()), zap.Int("attempt", attempt+1), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-s.abort:
+			s.dropBatch(batch, err)
+			return
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+func (s *shipper) dropBatch(batch []json.RawMessage, err error) {
+	n := s.dropped.Add(int64(len(batch)))
+	logger.Logger.Error("failed to ship logs, dropping batch",
+		zap.String("sink", s.sink.Name()),
+		zap.Int("records", len(batch)),
+		zap.Int64("dropped", n),
+		zap.Error(err))
+}
@@ -0,0 +1,160 @@
+package logship
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu       sync.Mutex
+	failures int
+	batches  [][]string
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+
+func (s *recordingSink) Send(_ context.Context, records []json.RawMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	batch := make([]string, 0, len(records))
+	for _, record := range records {
+		batch = append(batch, string(record))
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *recordingSink) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]string(nil), s.batches...)
+}
+
+func TestShipBatchesAndRetries(t *testing.T) {
+	sink := &recordingSink{failures: 2}
+	Start([]Sink{sink}, Options{BatchSize: 2, FlushInterval: time.Hour, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	t.Cleanup(func() { _ = Stop(context.Background()) })
+	require.True(t, Enabled())
+
+	Ship(map[string]int{"id": 1})
+	Ship(map[string]int{"id": 2})
+	Ship(map[string]int{"id": 3})
+	require.Eventually(t, func() bool { return len(sink.received()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, [][]string{{`{"id":1}`, `{"id":2}`}}, sink.received(), "a full batch is sent after its retries")
+
+	// stopping sends the partial batch
+	require.NoError(t, Stop(context.Background()))
+	require.Equal(t, [][]string{{`{"id":1}`, `{"id":2}`}, {`{"id":3}`}}, sink.received())
+	require.False(t, Enabled())
+	Ship(map[string]int{"id": 4})
+}
+
+func TestShipFlushesOnInterval(t *testing.T) {
+	sink := &recordingSink{}
+	Start([]Sink{sink}, Options{BatchSize: 100, FlushInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { _ = Stop(context.Background()) })
+
+	Ship(map[string]int{"id": 1})
+	require.Eventually(t, func() bool { return len(sink.received()) == 1 }, time.Second, time.Millisecond)
+}
+
+func TestShipDropsBatchAfterRetries(t *testing.T) {
+	sink := &recordingSink{failures: 10}
+	Start([]Sink{sink}, Options{BatchSize: 1, FlushInterval: time.Hour, MaxRetries: 1, RetryBackoff: time.Millisecond})
+	t.Cleanup(func() { _ = Stop(context.Background()) })
+
+	Ship(map[string]int{"id": 1})
+	require.NoError(t, Stop(context.Background()))
+	require.Empty(t, sink.received())
+}
+
+func TestSinks(t *testing.T) {
+	type request struct {
+		method, path, query, contentType, body string
+		header                                 http.Header
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- request{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), string(body), r.Header}
+	}))
+	defer server.Close()
+	records := []json.RawMessage{json.RawMessage(`{"id":1}`), json.RawMessage(`{"id":2}`)}
+
+	sinks, err := ParseSinks(`[
+		{"type":"webhook","url":"` + server.URL + `/hook","headers":{"Authorization":"Bearer secret"}},
+		{"type":"kafka","url":"` + server.URL + `","topic":"usage"},
+		{"type":"s3","url":"` + server.URL + `","bucket":"logs","prefix":"one-api","access_key_id":"AKID","secret_access_key":"SECRET"},
+		{"type":"clickhouse","url":"` + server.URL + `","table":"usage_logs","username":"default","password":"pw"}
+	]`)
+	require.NoError(t, err)
+	require.Len(t, sinks, 4)
+	for _, sink := range sinks {
+		require.NoError(t, sink.Send(context.Background(), records), sink.Name())
+	}
+
+	webhook := <-requests
+	require.Equal(t, "/hook", webhook.path)
+	require.Equal(t, "application/x-ndjson", webhook.contentType)
+	require.Equal(t, "{\"id\":1}\n{\"id\":2}\n", webhook.body)
+	require.Equal(t, "Bearer secret", webhook.header.Get("Authorization"))
+
+	kafka := <-requests
+	require.Equal(t, "/topics/usage", kafka.path)
+	require.JSONEq(t, `{"records":[{"value":{"id":1}},{"value":{"id":2}}]}`, kafka.body)
+
+	s3 := <-requests
+	require.Equal(t, http.MethodPut, s3.method)
+	require.True(t, strings.HasPrefix(s3.path, "/logs/one-api/"), s3.path)
+	require.True(t, strings.HasSuffix(s3.path, ".ndjson"), s3.path)
+	require.Contains(t, s3.header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/")
+	require.NotEmpty(t, s3.header.Get("X-Amz-Content-Sha256"))
+
+	clickhouse := <-requests
+	require.Contains(t, clickhouse.query, "INSERT+INTO+usage_logs+FORMAT+JSONEachRow")
+	require.Equal(t, "default", clickhouse.header.Get("X-ClickHouse-User"))
+	require.Equal(t, "{\"id\":1}\n{\"id\":2}\n", clickhouse.body)
+}
+
+func TestParseSinksRejectsInvalidConfig(t *testing.T) {
+	sinks, err := ParseSinks("")
+	require.NoError(t, err)
+	require.Empty(t, sinks)
+
+	for _, raw := range []string{
+		`{"type":"webhook"}`,
+		`[{"type":"webhook"}]`,
+		`[{"type":"kafka","url":"http://proxy"}]`,
+		`[{"type":"s3","url":"http://minio","bucket":"logs"}]`,
+		`[{"type":"ftp","url":"ftp://host"}]`,
+	} {
+		_, err = ParseSinks(raw)
+		require.Error(t, err, raw)
+	}
+}
+
+func TestSinkReportsFailedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(SinkConfig{Type: SinkTypeWebhook, URL: server.URL})
+	require.NoError(t, err)
+	err = sink.Send(context.Background(), []json.RawMessage{json.RawMessage(`{}`)})
+	require.ErrorContains(t, err, "503")
+}
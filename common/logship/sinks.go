@@ -0,0 +1,257 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/random"
+)
+
+// Sink types accepted in SinkConfig.Type.
+const (
+	SinkTypeWebhook    = "webhook"
+	SinkTypeKafka      = "kafka"
+	SinkTypeS3         = "s3"
+	SinkTypeClickHouse = "clickhouse"
+)
+
+// SinkConfig configures a sink. Which fields apply depends on Type:
+//   - webhook: URL receives the batch as NDJSON in a POST, with Headers.
+//   - kafka: URL is a Kafka REST proxy (Confluent REST v2 or Redpanda HTTP proxy) that
+//     produces the records to Topic.
+//   - s3: every batch becomes an NDJSON object under Prefix in Bucket, at the S3-compatible
+//     URL with path-style addressing, signed with AccessKeyId and SecretAccessKey for Region.
+//   - clickhouse: URL is the ClickHouse HTTP interface; records are inserted into Table as
+//     JSONEachRow, as Username with Password.
+type SinkConfig struct {
+	Type            string            `json:"type"`
+	Name            string            `json:"name,omitempty"`
+	URL             string            `json:"url"`
+	Headers         map[string]string `json:"headers,omitempty"`
+	Topic           string            `json:"topic,omitempty"`
+	Bucket          string            `json:"bucket,omitempty"`
+	Region          string            `json:"region,omitempty"`
+	Prefix          string            `json:"prefix,omitempty"`
+	AccessKeyId     string            `json:"access_key_id,omitempty"`
+	SecretAccessKey string            `json:"secret_access_key,omitempty"`
+	Table           string            `json:"table,omitempty"`
+	Username        string            `json:"username,omitempty"`
+	Password        string            `json:"password,omitempty"`
+}
+
+// ParseSinks builds the sinks of a JSON array of SinkConfig. An empty string configures none.
+func ParseSinks(raw string) ([]Sink, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var configs []SinkConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, errors.Wrap(err, "unmarshal log shipper sinks")
+	}
+	sinks := make([]Sink, 0, len(configs))
+	for i, cfg := range configs {
+		sink, err := NewSink(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "log shipper sink %d", i)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// NewSink builds the sink cfg describes.
+func NewSink(cfg SinkConfig) (Sink, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("url is required")
+	}
+	if _, err := url.ParseRequestURI(cfg.URL); err != nil {
+		return nil, errors.Wrapf(err, "invalid url %q", cfg.URL)
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case SinkTypeWebhook:
+		return &WebhookSink{cfg: cfg}, nil
+	case SinkTypeKafka:
+		if cfg.Topic == "" {
+			return nil, errors.New("topic is required for kafka sinks")
+		}
+		return &KafkaSink{cfg: cfg}, nil
+	case SinkTypeS3:
+		if cfg.Bucket == "" || cfg.AccessKeyId == "" || cfg.SecretAccessKey == "" {
+			return nil, errors.New("bucket, access_key_id and secret_access_key are required for s3 sinks")
+		}
+		if cfg.Region == "" {
+			cfg.Region = "us-east-1"
+		}
+		if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+			cfg.Prefix += "/"
+		}
+		return &S3Sink{cfg: cfg}, nil
+	case SinkTypeClickHouse:
+		if cfg.Table == "" {
+			return nil, errors.New("table is required for clickhouse sinks")
+		}
+		return &ClickHouseSink{cfg: cfg}, nil
+	default:
+		return nil, errors.Errorf("unknown sink type %q", cfg.Type)
+	}
+}
+
+// ndjson joins records into newline-delimited JSON.
+func ndjson(records []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// do sends req and fails on non-2xx responses.
+func do(req *http.Request) error {
+	httpClient := client.ImpatientHTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s %s", req.Method, req.URL.Redacted())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("%s %s failed with status %d: %s", req.Method, req.URL.Redacted(), resp.StatusCode, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// WebhookSink posts batches as NDJSON.
+type WebhookSink struct{ cfg SinkConfig }
+
+func (s *WebhookSink) Name() string { return s.cfg.Name }
+
+func (s *WebhookSink) Send(ctx context.Context, records []json.RawMessage) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(ndjson(records)))
+	if err != nil {
+		return errors.Wrap(err, "build webhook request")
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	return do(req)
+}
+
+// KafkaSink produces batches to a topic through a Kafka REST proxy.
+type KafkaSink struct{ cfg SinkConfig }
+
+func (s *KafkaSink) Name() string { return s.cfg.Name }
+
+func (s *KafkaSink) Send(ctx context.Context, records []json.RawMessage) error {
+	type kafkaRecord struct {
+		Value json.RawMessage `json:"value"`
+	}
+	body := struct {
+		Records []kafkaRecord `json:"records"`
+	}{Records: make([]kafkaRecord, 0, len(records))}
+	for _, record := range records {
+		body.Records = append(body.Records, kafkaRecord{Value: record})
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "marshal kafka records")
+	}
+
+	endpoint := strings.TrimSuffix(s.cfg.URL, "/") + "/topics/" + url.PathEscape(s.cfg.Topic)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "build kafka request")
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	return do(req)
+}
+
+// S3Sink writes every batch as an NDJSON object, keyed by the day it was shipped.
+type S3Sink struct{ cfg SinkConfig }
+
+func (s *S3Sink) Name() string { return s.cfg.Name }
+
+func (s *S3Sink) Send(ctx context.Context, records []json.RawMessage) error {
+	now := time.Now().UTC()
+	// unique per batch, and sorted by time within a day
+	key := fmt.Sprintf("%s%s/%d-%s.ndjson",
+		s.cfg.Prefix, now.Format("2006/01/02"), now.UnixNano(), random.GetRandomString(8))
+	endpoint := strings.TrimSuffix(s.cfg.URL, "/") + "/" + url.PathEscape(s.cfg.Bucket) + "/" + key
+
+	payload := ndjson(records)
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return errors.Wrap(err, "build s3 request")
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signer := v4.NewSigner(func(options *v4.SignerOptions) {
+		// S3 signs the path as sent, without escaping it again
+		options.DisableURIPathEscaping = true
+	})
+	credentials := aws.Credentials{AccessKeyID: s.cfg.AccessKeyId, SecretAccessKey: s.cfg.SecretAccessKey}
+	if err = signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", s.cfg.Region, now); err != nil {
+		return errors.Wrap(err, "sign s3 request")
+	}
+	return do(req)
+}
+
+// ClickHouseSink inserts batches into a table through the ClickHouse HTTP interface.
+type ClickHouseSink struct{ cfg SinkConfig }
+
+func (s *ClickHouseSink) Name() string { return s.cfg.Name }
+
+func (s *ClickHouseSink) Send(ctx context.Context, records []json.RawMessage) error {
+	endpoint, err := url.Parse(s.cfg.URL)
+	if err != nil {
+		return errors.Wrap(err, "parse clickhouse url")
+	}
+	query := endpoint.Query()
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", s.cfg.Table))
+	// tolerate fields the table does not have, so that new log fields do not break inserts
+	query.Set("input_format_skip_unknown_fields", "1")
+	endpoint.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(ndjson(records)))
+	if err != nil {
+		return errors.Wrap(err, "build clickhouse request")
+	}
+	if s.cfg.Username != "" {
+		req.Header.Set("X-ClickHouse-User", s.cfg.Username)
+		req.Header.Set("X-ClickHouse-Key", s.cfg.Password)
+	}
+	for key, value := range s.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+	return do(req)
+}
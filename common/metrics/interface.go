@@ -16,6 +16,7 @@ type MetricsRecorder interface {
 	// Channel metrics
 	UpdateChannelMetrics(channelId int, channelName, channelType string, status int, balance float64, responseTimeMs int, successRate float64)
 	UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64)
+	GetChannelRequestsInFlight(channelId int, channelName, channelType string) float64
 
 	// User metrics
 	RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64)
@@ -42,6 +43,15 @@ type MetricsRecorder interface {
 	// Model metrics
 	RecordModelUsage(modelName, channelType string, latency time.Duration)
 
+	// Response cache metrics
+	RecordResponseCache(relayMode, result string)
+
+	// Prompt-cache affinity metrics
+	RecordPromptCacheAffinity(source, result string, promptTokens, cachedPromptTokens int)
+
+	// Circuit breaker metrics
+	RecordCircuitBreakerTransition(channelId int, model, from, to string)
+
 	// Billing metrics
 	RecordBillingOperation(startTime time.Time, operation string, success bool, userId int, channelId int, modelName string, quotaAmount float64)
 	RecordBillingTimeout(userId int, channelId int, modelName string, estimatedQuota float64, elapsedTime time.Duration)
@@ -66,6 +76,9 @@ func (n *NoOpRecorder) UpdateChannelMetrics(channelId int, channelName, channelT
 }
 func (n *NoOpRecorder) UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64) {
 }
+func (n *NoOpRecorder) GetChannelRequestsInFlight(channelId int, channelName, channelType string) float64 {
+	return 0
+}
 func (n *NoOpRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 }
 func (n *NoOpRecorder) RecordDBQuery(startTime time.Time, operation, table string, success bool) {}
@@ -78,6 +91,10 @@ func (n *NoOpRecorder) RecordTokenAuth(success bool)
 func (n *NoOpRecorder) UpdateActiveTokens(userId, tokenName string, count int)                   {}
 func (n *NoOpRecorder) RecordError(errorType, component string)                                  {}
 func (n *NoOpRecorder) RecordModelUsage(modelName, channelType string, latency time.Duration)    {}
+func (n *NoOpRecorder) RecordResponseCache(relayMode, result string)                             {}
+func (n *NoOpRecorder) RecordPromptCacheAffinity(source, result string, promptTokens, cachedPromptTokens int) {
+}
+func (n *NoOpRecorder) RecordCircuitBreakerTransition(channelId int, model, from, to string) {}
 func (n *NoOpRecorder) RecordBillingOperation(startTime time.Time, operation string, success bool, userId int, channelId int, modelName string, quotaAmount float64) {
 }
 func (n *NoOpRecorder) RecordBillingTimeout(userId int, channelId int, modelName string, estimatedQuota float64, elapsedTime time.Duration) {
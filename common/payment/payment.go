@@ -0,0 +1,112 @@
+// Package payment connects self-service top-up to payment providers.
+//
+// A provider creates hosted checkout sessions and turns the webhook events it sends back into
+// provider-independent events; crediting quota from those events is up to the caller, which
+// must do it idempotently since providers deliver events at least once.
+package payment
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// EventType is the kind of a payment event.
+type EventType string
+
+const (
+	// EventPaymentSucceeded reports that a checkout was paid.
+	EventPaymentSucceeded EventType = "payment_succeeded"
+	// EventPaymentRefunded reports that a paid checkout was refunded, fully or in part.
+	EventPaymentRefunded EventType = "payment_refunded"
+)
+
+// ErrIgnoredEvent is returned for authentic webhook events that do not concern top-ups.
+var ErrIgnoredEvent = errors.New("ignored payment event")
+
+// CheckoutRequest describes the checkout to create for a top-up order.
+type CheckoutRequest struct {
+	// OrderId is the top-up order the checkout pays for; events report it back.
+	OrderId     string
+	AmountCents int64
+	Currency    string
+	Description string
+	Email       string
+	SuccessURL  string
+	CancelURL   string
+}
+
+// Checkout is a created checkout session the user is sent to.
+type Checkout struct {
+	SessionId string
+	URL       string
+}
+
+// Event is a verified webhook event.
+//
+// Fields:
+//   - Id: provider event id.
+//   - OrderId: top-up order of the checkout, set on EventPaymentSucceeded.
+//   - PaymentId: provider payment id, set on both event types; refunds are matched by it.
+//   - AmountCents: amount paid, or for refunds the total refunded so far, which makes
+//     replayed refund events harmless.
+type Event struct {
+	Id          string
+	Type        EventType
+	OrderId     string
+	SessionId   string
+	PaymentId   string
+	AmountCents int64
+	Currency    string
+}
+
+// Provider is a payment provider.
+type Provider interface {
+	// Name identifies the provider in the PaymentProvider option and in webhook URLs.
+	Name() string
+	// CreateCheckout creates a hosted checkout session for an order.
+	CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error)
+	// ParseWebhook verifies the signature of a webhook request received at now and parses
+	// its event. Events that do not concern top-ups return ErrIgnoredEvent.
+	ParseWebhook(payload []byte, header http.Header, now time.Time) (*Event, error)
+}
+
+var (
+	providersLock sync.RWMutex
+	providers     = map[string]func() Provider{}
+)
+
+// Register makes a provider available under name. The factory is called for every use, so
+// that providers pick up configuration changes.
+func Register(name string, factory func() Provider) {
+	providersLock.Lock()
+	defer providersLock.Unlock()
+	providers[name] = factory
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, error) {
+	providersLock.RLock()
+	factory, ok := providers[name]
+	providersLock.RUnlock()
+	if !ok {
+		return nil, errors.Errorf("unknown payment provider %q", name)
+	}
+	return factory(), nil
+}
+
+// Names lists the registered providers.
+func Names() []string {
+	providersLock.RLock()
+	defer providersLock.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,252 @@
+package payment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// StripeName is the name the Stripe provider is registered under.
+const StripeName = "stripe"
+
+// stripeSignatureTolerance bounds the age of signed webhook events, against replays.
+const stripeSignatureTolerance = 5 * time.Minute
+
+func init() {
+	Register(StripeName, func() Provider {
+		return &Stripe{
+			APIBase:       config.StripeApiBase,
+			SecretKey:     config.StripeApiSecret,
+			WebhookSecret: config.StripeWebhookSecret,
+		}
+	})
+}
+
+// Stripe is a provider for the Stripe API and gateways compatible with it, which APIBase
+// points to.
+type Stripe struct {
+	APIBase       string
+	SecretKey     string
+	WebhookSecret string
+	// HTTPClient defaults to client.ImpatientHTTPClient.
+	HTTPClient *http.Client
+}
+
+type stripeCheckoutSession struct {
+	Id                string            `json:"id"`
+	URL               string            `json:"url"`
+	ClientReferenceId string            `json:"client_reference_id"`
+	PaymentStatus     string            `json:"payment_status"`
+	AmountTotal       int64             `json:"amount_total"`
+	Currency          string            `json:"currency"`
+	PaymentIntent     string            `json:"payment_intent"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripeCharge struct {
+	Id             string `json:"id"`
+	PaymentIntent  string `json:"payment_intent"`
+	AmountRefunded int64  `json:"amount_refunded"`
+	Currency       string `json:"currency"`
+}
+
+type stripeEvent struct {
+	Id   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeError struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *Stripe) Name() string { return StripeName }
+
+func (s *Stripe) CreateCheckout(ctx context.Context, req CheckoutRequest) (*Checkout, error) {
+	if s.SecretKey == "" {
+		return nil, errors.New("stripe api secret is not configured")
+	}
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", req.SuccessURL)
+	form.Set("cancel_url", req.CancelURL)
+	form.Set("client_reference_id", req.OrderId)
+	form.Set("metadata[order_id]", req.OrderId)
+	form.Set("payment_intent_data[metadata][order_id]", req.OrderId)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", req.Currency)
+	form.Set("line_items[0][price_data][unit_amount]", strconv.FormatInt(req.AmountCents, 10))
+	form.Set("line_items[0][price_data][product_data][name]", req.Description)
+	if req.Email != "" {
+		form.Set("customer_email", req.Email)
+	}
+
+	endpoint := strings.TrimSuffix(s.APIBase, "/") + "/v1/checkout/sessions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.Wrap(err, "build stripe checkout request")
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+s.SecretKey)
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// creating the session again for the same order must not create a second one
+	httpReq.Header.Set("Idempotency-Key", req.OrderId)
+
+	httpClient := s.HTTPClient
+	if httpClient == nil {
+		httpClient = client.ImpatientHTTPClient
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, errors.Wrap(err, "create stripe checkout session")
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read stripe checkout response")
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr stripeError
+		_ = json.Unmarshal(body, &apiErr)
+		return nil, errors.Errorf("stripe checkout failed with status %d: %s", resp.StatusCode, apiErr.Error.Message)
+	}
+
+	var session stripeCheckoutSession
+	if err = json.Unmarshal(body, &session); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stripe checkout session")
+	}
+	if session.Id == "" || session.URL == "" {
+		return nil, errors.New("stripe checkout session has no id or url")
+	}
+	return &Checkout{SessionId: session.Id, URL: session.URL}, nil
+}
+
+func (s *Stripe) ParseWebhook(payload []byte, header http.Header, now time.Time) (*Event, error) {
+	if s.WebhookSecret == "" {
+		return nil, errors.New("stripe webhook secret is not configured")
+	}
+	if err := verifyStripeSignature(s.WebhookSecret, payload, header.Get("Stripe-Signature"), now); err != nil {
+		return nil, err
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stripe event")
+	}
+
+	switch event.Type {
+	case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return nil, errors.Wrap(err, "unmarshal stripe checkout session")
+		}
+		// delayed payment methods complete the session before the payment succeeds
+		if session.PaymentStatus != "paid" {
+			return nil, ErrIgnoredEvent
+		}
+		orderId := session.Metadata["order_id"]
+		if orderId == "" {
+			orderId = session.ClientReferenceId
+		}
+		return &Event{
+			Id:          event.Id,
+			Type:        EventPaymentSucceeded,
+			OrderId:     orderId,
+			SessionId:   session.Id,
+			PaymentId:   session.PaymentIntent,
+			AmountCents: session.AmountTotal,
+			Currency:    session.Currency,
+		}, nil
+	case "charge.refunded":
+		var charge stripeCharge
+		if err := json.Unmarshal(event.Data.Object, &charge); err != nil {
+			return nil, errors.Wrap(err, "unmarshal stripe charge")
+		}
+		if charge.PaymentIntent == "" {
+			return nil, ErrIgnoredEvent
+		}
+		return &Event{
+			Id:          event.Id,
+			Type:        EventPaymentRefunded,
+			PaymentId:   charge.PaymentIntent,
+			AmountCents: charge.AmountRefunded,
+			Currency:    charge.Currency,
+		}, nil
+	default:
+		return nil, ErrIgnoredEvent
+	}
+}
+
+// SignStripeWebhook returns the Stripe-Signature header for payload sent at timestamp, the way
+// Stripe signs webhook events. It lets tests and local mock senders deliver events.
+func SignStripeWebhook(secret string, payload []byte, timestamp time.Time) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", unix, stripeSignature(secret, unix, payload))
+}
+
+func stripeSignature(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyStripeSignature checks a Stripe-Signature header: "t=<unix>,v1=<hex hmac>", with one
+// v1 entry per active secret.
+func verifyStripeSignature(secret string, payload []byte, header string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("missing stripe signature")
+	}
+
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Errorf("invalid stripe signature timestamp %q", timestamp)
+	}
+	if age := now.Sub(time.Unix(signedAt, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return errors.New("stripe signature timestamp is outside the tolerance")
+	}
+
+	expected := []byte(stripeSignature(secret, timestamp, payload))
+	for _, signature := range signatures {
+		if hmac.Equal(expected, []byte(signature)) {
+			return nil
+		}
+	}
+	return errors.New("stripe signature does not match")
+}
@@ -0,0 +1,100 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testWebhookSecret = "whsec_test"
+
+func signedHeader(payload []byte, at time.Time) http.Header {
+	header := http.Header{}
+	header.Set("Stripe-Signature", SignStripeWebhook(testWebhookSecret, payload, at))
+	return header
+}
+
+func TestStripeParseWebhook(t *testing.T) {
+	provider := &Stripe{WebhookSecret: testWebhookSecret}
+	now := time.Unix(1_700_000_000, 0)
+
+	paid := []byte(`{"id":"evt_1","type":"checkout.session.completed","data":{"object":{
+		"id":"cs_1","client_reference_id":"topup_1","payment_status":"paid","amount_total":1000,
+		"currency":"usd","payment_intent":"pi_1","metadata":{"order_id":"topup_1"}}}}`)
+	event, err := provider.ParseWebhook(paid, signedHeader(paid, now), now)
+	require.NoError(t, err)
+	require.Equal(t, &Event{
+		Id:          "evt_1",
+		Type:        EventPaymentSucceeded,
+		OrderId:     "topup_1",
+		SessionId:   "cs_1",
+		PaymentId:   "pi_1",
+		AmountCents: 1000,
+		Currency:    "usd",
+	}, event)
+
+	refunded := []byte(`{"id":"evt_2","type":"charge.refunded","data":{"object":{
+		"id":"ch_1","payment_intent":"pi_1","amount_refunded":400,"currency":"usd"}}}`)
+	event, err = provider.ParseWebhook(refunded, signedHeader(refunded, now), now)
+	require.NoError(t, err)
+	require.Equal(t, EventPaymentRefunded, event.Type)
+	require.Equal(t, "pi_1", event.PaymentId)
+	require.Equal(t, int64(400), event.AmountCents)
+
+	unpaid := []byte(`{"id":"evt_3","type":"checkout.session.completed","data":{"object":{"id":"cs_2","payment_status":"unpaid"}}}`)
+	_, err = provider.ParseWebhook(unpaid, signedHeader(unpaid, now), now)
+	require.ErrorIs(t, err, ErrIgnoredEvent)
+
+	other := []byte(`{"id":"evt_4","type":"customer.created","data":{"object":{}}}`)
+	_, err = provider.ParseWebhook(other, signedHeader(other, now), now)
+	require.ErrorIs(t, err, ErrIgnoredEvent)
+}
+
+func TestStripeWebhookSignature(t *testing.T) {
+	provider := &Stripe{WebhookSecret: testWebhookSecret}
+	now := time.Unix(1_700_000_000, 0)
+	payload := []byte(`{"id":"evt_1","type":"customer.created","data":{"object":{}}}`)
+
+	tampered := []byte(`{"id":"evt_2","type":"customer.created","data":{"object":{}}}`)
+	_, err := provider.ParseWebhook(tampered, signedHeader(payload, now), now)
+	require.ErrorContains(t, err, "does not match")
+
+	_, err = provider.ParseWebhook(payload, signedHeader(payload, now.Add(-10*time.Minute)), now)
+	require.ErrorContains(t, err, "tolerance")
+
+	_, err = provider.ParseWebhook(payload, http.Header{}, now)
+	require.ErrorContains(t, err, "missing")
+
+	other := &Stripe{WebhookSecret: "whsec_other"}
+	_, err = other.ParseWebhook(payload, signedHeader(payload, now), now)
+	require.ErrorContains(t, err, "does not match")
+}
+
+func TestStripeCreateCheckout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/checkout/sessions", r.URL.Path)
+		require.Equal(t, "Bearer sk_test", r.Header.Get("Authorization"))
+		require.Equal(t, "topup_1", r.Header.Get("Idempotency-Key"))
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "1000", r.PostForm.Get("line_items[0][price_data][unit_amount]"))
+		require.Equal(t, "usd", r.PostForm.Get("line_items[0][price_data][currency]"))
+		require.Equal(t, "topup_1", r.PostForm.Get("metadata[order_id]"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"cs_1","url":"https://checkout.example.com/cs_1"}`))
+	}))
+	defer server.Close()
+
+	provider := &Stripe{APIBase: server.URL, SecretKey: "sk_test", HTTPClient: server.Client()}
+	checkout, err := provider.CreateCheckout(context.Background(), CheckoutRequest{
+		OrderId:     "topup_1",
+		AmountCents: 1000,
+		Currency:    "usd",
+		Description: "top-up",
+	})
+	require.NoError(t, err)
+	require.Equal(t, &Checkout{SessionId: "cs_1", URL: "https://checkout.example.com/cs_1"}, checkout)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// recordAudit appends the management action performed by the current admin to the audit log.
+// before and after are the states of the target around the action.
+func recordAudit(c *gin.Context, action string, targetType string, targetId any, before, after any) {
+	model.RecordAuditLog(gmw.Ctx(c), &model.AuditLog{
+		ActorId:    c.GetInt(ctxkey.Id),
+		ActorName:  c.GetString(ctxkey.Username),
+		Ip:         c.ClientIP(),
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetId),
+	}, before, after)
+}
+
+// GetAuditLogs searches the admin audit log, newest entries first.
+func GetAuditLogs(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	pageSize, err := strconv.Atoi(c.Query("size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = config.DefaultItemsPerPage
+	}
+	if pageSize > config.MaxItemsPerPage {
+		pageSize = config.MaxItemsPerPage
+	}
+	actorId, _ := strconv.Atoi(c.Query("actor_id"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+
+	logs, total, err := model.SearchAuditLogs(model.AuditLogQuery{
+		ActorId:        actorId,
+		ActorName:      c.Query("actor_name"),
+		Action:         c.Query("action"),
+		TargetType:     c.Query("target_type"),
+		TargetId:       c.Query("target_id"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}, p*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+		"total":   total,
+	})
+}
@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	defaultBatchListLimit = 20
+	maxBatchListLimit     = 100
+	batchSettleBatchSize  = 50
+	// batchSettleMaxFailures is how many consecutive failures the poller tolerates before it
+	// stops picking a job up; retrieve requests still settle it inline.
+	batchSettleMaxFailures = 10
+	batchSettleMaxBackoff  = 6 * time.Hour
+)
+
+// relayBatchEndpoint wraps a Files/Batch relay helper with the metrics and error handling
+// shared by the non-model relay endpoints.
+func relayBatchEndpoint(helperFn func(c *gin.Context) *relaymodel.ErrorWithStatusCode) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		meta := metalib.GetByContext(c)
+		startTime := time.Now()
+
+		done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
+
+		if bizErr := helperFn(c); bizErr != nil {
+			done(bizErr.StatusCode)
+			PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
+			monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
+
+			requestId := c.GetString(helper.RequestIdKey)
+			bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+			c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+			return
+		}
+
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+		done(http.StatusOK)
+		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
+	}
+}
+
+var (
+	// RelayFileUpload handles POST /v1/files.
+	RelayFileUpload = relayBatchEndpoint(rcontroller.RelayFileUploadHelper)
+	// RelayFileRetrieve handles GET /v1/files/:id.
+	RelayFileRetrieve = relayBatchEndpoint(rcontroller.RelayFileRetrieveHelper)
+	// RelayFileContent handles GET /v1/files/:id/content.
+	RelayFileContent = relayBatchEndpoint(rcontroller.RelayFileContentHelper)
+	// RelayFileDelete handles DELETE /v1/files/:id.
+	RelayFileDelete = relayBatchEndpoint(rcontroller.RelayFileDeleteHelper)
+	// RelayBatchCreate handles POST /v1/batches.
+	RelayBatchCreate = relayBatchEndpoint(rcontroller.RelayBatchCreateHelper)
+	// RelayBatchRetrieve handles GET /v1/batches/:id.
+	RelayBatchRetrieve = relayBatchEndpoint(rcontroller.RelayBatchRetrieveHelper)
+	// RelayBatchCancel handles POST /v1/batches/:id/cancel.
+	RelayBatchCancel = relayBatchEndpoint(rcontroller.RelayBatchCancelHelper)
+)
+
+func batchListLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		return defaultBatchListLimit
+	}
+	return min(limit, maxBatchListLimit)
+}
+
+// ListFiles handles GET /v1/files. Files live on different channels, so the list is
+// served from the local pin records instead of a single upstream.
+func ListFiles(c *gin.Context) {
+	files, err := model.ListUpstreamFilesByUser(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.Query("purpose"), batchListLimit(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": relaymodel.Error{Message: err.Error(), Type: "one_api_error"}})
+		return
+	}
+
+	data := make([]gin.H, 0, len(files))
+	for _, f := range files {
+		data = append(data, gin.H{
+			"id":         f.FileId,
+			"object":     "file",
+			"bytes":      f.Bytes,
+			"created_at": f.CreatedAt,
+			"filename":   f.Filename,
+			"purpose":    f.Purpose,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
+
+// ListBatches handles GET /v1/batches from the local batch records.
+func ListBatches(c *gin.Context) {
+	limit := batchListLimit(c)
+	jobs, err := model.ListBatchJobsByUser(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.Query("after"), limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": relaymodel.Error{Message: err.Error(), Type: "one_api_error"}})
+		return
+	}
+
+	hasMore := len(jobs) > limit
+	if hasMore {
+		jobs = jobs[:limit]
+	}
+	data := make([]gin.H, 0, len(jobs))
+	for _, job := range jobs {
+		data = append(data, gin.H{
+			"id":             job.BatchId,
+			"object":         "batch",
+			"endpoint":       job.Endpoint,
+			"input_file_id":  job.InputFileId,
+			"output_file_id": job.OutputFileId,
+			"status":         job.Status,
+			"created_at":     job.CreatedAt,
+		})
+	}
+
+	resp := gin.H{"object": "list", "data": data, "has_more": hasMore}
+	if len(jobs) > 0 {
+		resp["first_id"] = jobs[0].BatchId
+		resp["last_id"] = jobs[len(jobs)-1].BatchId
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// StartBatchSettlement periodically polls unsettled batch jobs and reconciles their quota
+// holds once the upstream reports a terminal state.
+func StartBatchSettlement(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	lg := logger.Logger.Named("batch_settlement")
+	ctx = gmw.SetLogger(ctx, lg)
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				lg.Info("batch settlement stopped")
+				return
+			case <-ticker.C:
+				settlePendingBatchJobs(ctx, interval)
+			}
+		}
+	}()
+}
+
+func settlePendingBatchJobs(ctx context.Context, interval time.Duration) {
+	lg := gmw.GetLogger(ctx)
+	now := helper.GetTimestamp()
+	jobs, err := model.ListUnsettledBatchJobs(ctx, now, batchSettleMaxFailures, batchSettleBatchSize)
+	if err != nil {
+		lg.Error("failed to list unsettled batch jobs", zap.Error(err))
+		return
+	}
+
+	for _, job := range jobs {
+		if err = rcontroller.SettleBatchJob(ctx, job); err != nil {
+			backoff := batchSettleBackoff(interval, job.SettleFailures+1)
+			lg.Warn("failed to settle batch job",
+				zap.String("batch_id", job.BatchId),
+				zap.Int("channel_id", job.ChannelId),
+				zap.Int("failures", job.SettleFailures+1),
+				zap.Duration("retry_in", backoff),
+				zap.Error(err))
+			if err = model.RecordBatchJobSettleFailure(ctx, job.Id, now+int64(backoff/time.Second)); err != nil {
+				lg.Error("failed to record batch settlement failure", zap.String("batch_id", job.BatchId), zap.Error(err))
+			}
+			continue
+		}
+
+		if job.SettleFailures > 0 && !job.Settled {
+			if err = model.UpdateBatchJob(ctx, job.Id, map[string]any{"settle_failures": 0, "next_settle_at": int64(0)}); err != nil {
+				lg.Warn("failed to reset batch settlement failures", zap.String("batch_id", job.BatchId), zap.Error(err))
+			}
+		}
+	}
+}
+
+// batchSettleBackoff doubles the polling interval for every consecutive failure, capped at
+// batchSettleMaxBackoff.
+func batchSettleBackoff(interval time.Duration, failures int) time.Duration {
+	backoff := interval
+	for i := 1; i < failures && backoff < batchSettleMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, batchSettleMaxBackoff)
+}
@@ -146,6 +146,14 @@ func AddChannel(c *gin.Context) {
 		}
 	}
 
+	if !model.IsValidChannelKeyMode(channel.KeyMode) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid key mode: " + channel.KeyMode,
+		})
+		return
+	}
+
 	channel.CreatedTime = helper.GetTimestamp()
 	// Sanitize testing model at creation: only keep if present in models list
 	if channel.TestingModel != nil {
@@ -166,6 +174,10 @@ func AddChannel(c *gin.Context) {
 		}
 	}
 	keys := strings.Split(channel.Key, "\n")
+	if channel.IsMultiKey() {
+		// multi-key channels keep every key in one channel and rotate between them
+		keys = []string{strings.Join(model.SplitChannelKeys(channel.Key), "\n")}
+	}
 	channels := make([]model.Channel, 0, len(keys))
 	for _, key := range keys {
 		if key == "" {
@@ -194,6 +206,9 @@ func AddChannel(c *gin.Context) {
 		})
 		return
 	}
+	for i := range channels {
+		recordAudit(c, model.AuditActionChannelCreate, model.AuditTargetChannel, channels[i].Id, nil, &channels[i])
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -202,6 +217,7 @@ func AddChannel(c *gin.Context) {
 
 func DeleteChannel(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	before, _ := model.GetChannelById(id, true)
 	channel := model.Channel{Id: id}
 	err := channel.Delete()
 	if err != nil {
@@ -211,6 +227,7 @@ func DeleteChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionChannelDelete, model.AuditTargetChannel, id, before, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -226,6 +243,7 @@ func DeleteDisabledChannel(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionChannelDeleteDisabled, model.AuditTargetChannel, "", nil, gin.H{"deleted": rows})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -235,8 +253,13 @@ func DeleteDisabledChannel(c *gin.Context) {
 
 func UpdateChannel(c *gin.Context) {
 	statusOnly := c.Query("status_only")
-	channel := model.Channel{}
-	err := c.ShouldBindJSON(&channel)
+	// key_mode is read separately so that an edit without it keeps the stored mode;
+	// writing the zero value would turn a multi-key channel back into a single key
+	var request struct {
+		model.Channel
+		KeyMode *string `json:"key_mode"`
+	}
+	err := c.ShouldBindJSON(&request)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -244,6 +267,7 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	channel := request.Channel
 
 	// Validate inference profile ARN map if provided
 	if channel.InferenceProfileArnMap != nil && *channel.InferenceProfileArnMap != "" {
@@ -263,11 +287,28 @@ func UpdateChannel(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"success": false, "message": "Channel id is required"})
 			return
 		}
+		before, _ := model.GetChannelById(channel.Id, true)
 		model.UpdateChannelStatusById(channel.Id, channel.Status)
+		after, _ := model.GetChannelById(channel.Id, true)
+		recordAudit(c, model.AuditActionChannelUpdate, model.AuditTargetChannel, channel.Id, before, after)
 		c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
 		return
 	}
 
+	before, _ := model.GetChannelById(channel.Id, true)
+	if request.KeyMode != nil {
+		channel.KeyMode = *request.KeyMode
+	} else if before != nil {
+		channel.KeyMode = before.KeyMode
+	}
+	if !model.IsValidChannelKeyMode(channel.KeyMode) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid key mode: " + channel.KeyMode,
+		})
+		return
+	}
+
 	// Disallow empty name on full update
 	if strings.TrimSpace(channel.Name) == "" {
 		c.JSON(http.StatusOK, gin.H{
@@ -285,6 +326,8 @@ func UpdateChannel(c *gin.Context) {
 		})
 		return
 	}
+	after, _ := model.GetChannelById(channel.Id, true)
+	recordAudit(c, model.AuditActionChannelUpdate, model.AuditTargetChannel, channel.Id, before, after)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -428,6 +471,7 @@ func UpdateChannelPricing(c *gin.Context) {
 		}
 	}
 
+	before, _ := model.GetChannelById(channel.Id, true)
 	err = channel.Update()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -436,6 +480,8 @@ func UpdateChannelPricing(c *gin.Context) {
 		})
 		return
 	}
+	after, _ := model.GetChannelById(channel.Id, true)
+	recordAudit(c, model.AuditActionChannelUpdate, model.AuditTargetChannel, channel.Id, before, after)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
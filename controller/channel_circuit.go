@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/monitor"
+)
+
+// ProbeChannelModel sends a test request for the model to the channel; the circuit breaker
+// uses it as the trial probe of half-open circuits.
+func ProbeChannelModel(ctx context.Context, channelId int, modelName string) error {
+	channel, err := model.GetChannelById(channelId, true)
+	if err != nil {
+		return errors.Wrapf(err, "get channel %d", channelId)
+	}
+	if channel.Status != model.ChannelStatusEnabled {
+		return errors.Errorf("channel %d is not enabled", channelId)
+	}
+	_, err, openaiErr := testChannel(ctx, channel, buildTestRequest(modelName))
+	if err != nil {
+		return err
+	}
+	if openaiErr != nil {
+		return errors.New(openaiErr.Message)
+	}
+	return nil
+}
+
+// GetCircuitBreakers lists the circuit breaker states of channels per model, of a single
+// channel when channel_id is given.
+func GetCircuitBreakers(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Query("channel_id"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    monitor.ListCircuitBreakers(channelId),
+	})
+}
+
+// ResetCircuitBreakers closes the circuits of a channel, only the one of the model query
+// parameter when it is given, so the channel serves them again right away.
+func ResetCircuitBreakers(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	closed := monitor.ResetCircuitBreakers(channelId, c.Query("model"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    gin.H{"closed": closed},
+	})
+}
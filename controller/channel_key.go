@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+// channelKeyView is the admin representation of a pooled key; the secret is always masked.
+type channelKeyView struct {
+	Id             int    `json:"id"`
+	ChannelId      int    `json:"channel_id"`
+	Key            string `json:"key"`
+	Weight         uint   `json:"weight"`
+	Status         int    `json:"status"`
+	SuspendUntil   *int64 `json:"suspend_until,omitempty"`
+	DisabledReason string `json:"disabled_reason"`
+	Available      bool   `json:"available"`
+	UpdatedAt      int64  `json:"updated_at"`
+}
+
+// GetChannelKeys lists the pooled keys of a multi-key channel with their health state.
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	keys, err := model.GetChannelKeys(id)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	now := time.Now()
+	views := make([]channelKeyView, 0, len(keys))
+	for _, k := range keys {
+		view := channelKeyView{
+			Id:             k.Id,
+			ChannelId:      k.ChannelId,
+			Key:            k.MaskedKey(),
+			Weight:         k.Weight,
+			Status:         k.Status,
+			DisabledReason: k.DisabledReason,
+			Available:      k.IsAvailable(now),
+			UpdatedAt:      k.UpdatedAt,
+		}
+		if k.SuspendUntil != nil && k.SuspendUntil.After(now) {
+			ts := k.SuspendUntil.Unix()
+			view.SuspendUntil = &ts
+		}
+		views = append(views, view)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    views,
+	})
+}
+
+// UpdateChannelKey changes the status or weight of one pooled key.
+// Re-enabling a key also clears its cooldown.
+func UpdateChannelKey(c *gin.Context) {
+	channelId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var request struct {
+		KeyId  int   `json:"key_id"`
+		Status *int  `json:"status"`
+		Weight *uint `json:"weight"`
+	}
+	if err = c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	key, err := model.GetChannelKeyById(request.KeyId)
+	if err != nil || key.ChannelId != channelId {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Key not found in this channel",
+		})
+		return
+	}
+
+	if request.Status != nil {
+		switch *request.Status {
+		case model.ChannelKeyStatusEnabled, model.ChannelKeyStatusManuallyDisabled:
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "Invalid key status",
+			})
+			return
+		}
+		if err = model.UpdateChannelKeyStatus(key.Id, *request.Status, ""); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	if request.Weight != nil {
+		if err = model.UpdateChannelKeyWeight(key.Id, *request.Weight); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/monitor"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+)
+
+// RelayClaudeCountTokens handles POST /v1/messages/count_tokens. It never charges quota.
+func RelayClaudeCountTokens(c *gin.Context) {
+	meta := metalib.GetByContext(c)
+	startTime := time.Now()
+
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
+
+	if bizErr := rcontroller.RelayClaudeCountTokensHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
+		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
+
+		requestId := c.GetString(helper.RequestIdKey)
+		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		return
+	}
+
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
+	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetSelfCreditGrants lists the credit grants of the current user with their balances.
+func GetSelfCreditGrants(c *gin.Context) {
+	respondCreditGrants(c, c.GetInt(ctxkey.Id))
+}
+
+// GetUserCreditGrants lists the credit grants of a user for admins.
+func GetUserCreditGrants(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondCreditGrants(c, id)
+}
+
+func respondCreditGrants(c *gin.Context, userId int) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	pageSize, err := strconv.Atoi(c.Query("size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = config.DefaultItemsPerPage
+	}
+	if pageSize > config.MaxItemsPerPage {
+		pageSize = config.MaxItemsPerPage
+	}
+	activeOnly := c.Query("active") == "true"
+
+	grants, total, err := model.GetUserCreditGrants(userId, activeOnly, p*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    grants,
+		"total":   total,
+	})
+}
+
+// GetCreditGrantSummary reports, per credit source, how much credit was granted, how much is
+// still outstanding and how much expired, plus the outstanding promotional credit.
+func GetCreditGrantSummary(c *gin.Context) {
+	summaries, err := model.SummarizeCreditGrants()
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	var promotionalOutstanding int64
+	for _, summary := range summaries {
+		if summary.Promotional {
+			promotionalOutstanding += summary.Outstanding
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"sources":                 summaries,
+			"promotional_outstanding": promotionalOutstanding,
+		},
+	})
+}
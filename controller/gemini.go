@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayGemini dispatches POST /v1beta/models/{model}:{action} of the native Gemini API.
+func RelayGemini(c *gin.Context) {
+	_, action, _ := relaymode.ParseGeminiModelAction(c.Request.URL.Path)
+	switch action {
+	case relaymode.GeminiActionGenerateContent, relaymode.GeminiActionStreamGenerateContent:
+		Relay(c)
+	case relaymode.GeminiActionCountTokens:
+		RelayGeminiCountTokens(c)
+	default:
+		renderGeminiError(c, openai.ErrorWrapper(
+			errors.Errorf("unsupported model action %q", action), "invalid_request_error", http.StatusNotFound))
+	}
+}
+
+// RelayGeminiCountTokens handles POST /v1beta/models/{model}:countTokens. It never charges quota.
+func RelayGeminiCountTokens(c *gin.Context) {
+	meta := metalib.GetByContext(c)
+	startTime := time.Now()
+
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
+
+	if bizErr := rcontroller.RelayGeminiCountTokensHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
+		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
+		renderGeminiError(c, bizErr)
+		return
+	}
+
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
+	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
+}
+
+// renderGeminiError writes the error in the Google API error format Gemini clients parse.
+func renderGeminiError(c *gin.Context, bizErr *model.ErrorWithStatusCode) {
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": gemini.Error{
+			Code:    bizErr.StatusCode,
+			Message: helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey)),
+			Status:  gemini.ErrorStatus(bizErr.StatusCode),
+		},
+	})
+}
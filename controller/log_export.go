@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// logExportBatchSize is how many logs an export reads from the database at a time.
+const logExportBatchSize = 1000
+
+// ExportAllLogs streams the logs matching the filters of GetAllLogs for admins, without
+// pagination.
+//
+// Query parameters, besides the filters:
+//   - format: csv (default) or ndjson.
+//   - gzip: "true" compresses the file.
+func ExportAllLogs(c *gin.Context) {
+	filter := logExportFilter(c)
+	filter.Username = c.Query("username")
+	filter.Channel, _ = strconv.Atoi(c.Query("channel"))
+	streamLogExport(c, filter)
+}
+
+// ExportUserLogs streams the current user's logs, with the parameters of ExportAllLogs.
+func ExportUserLogs(c *gin.Context) {
+	filter := logExportFilter(c)
+	filter.UserId = c.GetInt(ctxkey.Id)
+	streamLogExport(c, filter)
+}
+
+func logExportFilter(c *gin.Context) model.LogExportFilter {
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	return model.LogExportFilter{
+		Type:           logType,
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+		ModelName:      c.Query("model_name"),
+		TokenName:      c.Query("token_name"),
+	}
+}
+
+// logEncoder writes exported logs in one format.
+type logEncoder interface {
+	Encode(logs []*model.Log) error
+	Flush() error
+}
+
+func streamLogExport(c *gin.Context, filter model.LogExportFilter) {
+	format := c.DefaultQuery("format", "csv")
+	contentType := ""
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("unsupported export format %q, expected csv or ndjson", format),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("logs-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	var out io.Writer = c.Writer
+	var gz *gzip.Writer
+	if c.Query("gzip") == "true" {
+		filename += ".gz"
+		contentType = "application/gzip"
+		gz = gzip.NewWriter(c.Writer)
+		out = gz
+	}
+
+	var encoder logEncoder
+	if format == "csv" {
+		encoder = newCSVLogEncoder(out)
+	} else {
+		encoder = &ndjsonLogEncoder{encoder: json.NewEncoder(out)}
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Status(http.StatusOK)
+
+	// the status is sent with the first batch, so failures after it can only cut the file
+	// short; the error is logged for the admin
+	err := model.StreamLogs(gmw.Ctx(c), filter, logExportBatchSize, func(logs []*model.Log) error {
+		if err := encoder.Encode(logs); err != nil {
+			return err
+		}
+		if err := encoder.Flush(); err != nil {
+			return err
+		}
+		if gz != nil {
+			if err := gz.Flush(); err != nil {
+				return errors.Wrap(err, "flush gzip")
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil {
+		err = encoder.Flush()
+	}
+	if err == nil && gz != nil {
+		err = errors.Wrap(gz.Close(), "close gzip")
+	}
+	if err != nil {
+		gmw.GetLogger(c).Error("log export failed", zap.Error(err))
+		return
+	}
+	c.Writer.Flush()
+}
+
+var logCSVHeader = []string{
+	"id", "created_at", "type", "user_id", "username", "token_name", "model_name", "channel_id",
+	"quota", "prompt_tokens", "completion_tokens", "cached_prompt_tokens", "cached_completion_tokens",
+	"elapsed_time", "is_stream", "request_id", "trace_id", "content", "metadata",
+}
+
+type csvLogEncoder struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func newCSVLogEncoder(w io.Writer) *csvLogEncoder {
+	return &csvLogEncoder{writer: csv.NewWriter(w)}
+}
+
+func (e *csvLogEncoder) Encode(logs []*model.Log) error {
+	if !e.headerWritten {
+		if err := e.writer.Write(logCSVHeader); err != nil {
+			return errors.Wrap(err, "write log csv header")
+		}
+		e.headerWritten = true
+	}
+	for _, log := range logs {
+		metadata := ""
+		if len(log.Metadata) > 0 {
+			payload, err := json.Marshal(log.Metadata)
+			if err != nil {
+				return errors.Wrapf(err, "marshal metadata of log %d", log.Id)
+			}
+			metadata = string(payload)
+		}
+		err := e.writer.Write([]string{
+			strconv.Itoa(log.Id),
+			strconv.FormatInt(log.CreatedAt, 10),
+			strconv.Itoa(log.Type),
+			strconv.Itoa(log.UserId),
+			log.Username,
+			log.TokenName,
+			log.ModelName,
+			strconv.Itoa(log.ChannelId),
+			strconv.Itoa(log.Quota),
+			strconv.Itoa(log.PromptTokens),
+			strconv.Itoa(log.CompletionTokens),
+			strconv.Itoa(log.CachedPromptTokens),
+			strconv.Itoa(log.CachedCompletionTokens),
+			strconv.FormatInt(log.ElapsedTime, 10),
+			strconv.FormatBool(log.IsStream),
+			log.RequestId,
+			log.TraceId,
+			log.Content,
+			metadata,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "write log %d as csv", log.Id)
+		}
+	}
+	return nil
+}
+
+func (e *csvLogEncoder) Flush() error {
+	// an export without logs still gets its header
+	if !e.headerWritten {
+		if err := e.Encode(nil); err != nil {
+			return err
+		}
+	}
+	e.writer.Flush()
+	return errors.Wrap(e.writer.Error(), "flush log csv")
+}
+
+type ndjsonLogEncoder struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonLogEncoder) Encode(logs []*model.Log) error {
+	for _, log := range logs {
+		if err := e.encoder.Encode(log); err != nil {
+			return errors.Wrapf(err, "write log %d as json", log.Id)
+		}
+	}
+	return nil
+}
+
+func (e *ndjsonLogEncoder) Flush() error { return nil }
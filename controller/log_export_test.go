@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+func setupLogExportTest(t *testing.T) *gin.Engine {
+	testDB, cleanup := setupTestEnvironment(t)
+	t.Cleanup(cleanup)
+
+	logs := []*model.Log{
+		{UserId: 1, Username: "testuser", Type: model.LogTypeConsume, CreatedAt: 100, ModelName: "gpt-4o", Quota: 10, Content: "a, \"quoted\" line"},
+		{UserId: 1, Username: "testuser", Type: model.LogTypeConsume, CreatedAt: 200, ModelName: "gpt-4o-mini", Quota: 20},
+		{UserId: 2, Username: "other", Type: model.LogTypeConsume, CreatedAt: 300, ModelName: "gpt-4o", Quota: 30},
+	}
+	require.NoError(t, testDB.Create(&logs).Error)
+
+	router := setupTestRouter()
+	router.GET("/api/log/export", ExportAllLogs)
+	router.GET("/api/log/self/export", func(c *gin.Context) {
+		c.Set(ctxkey.Id, 1)
+		ExportUserLogs(c)
+	})
+	return router
+}
+
+func TestExportLogsCSV(t *testing.T) {
+	router := setupLogExportTest(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/log/self/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3, "the header and the user's own two logs")
+	require.Equal(t, logCSVHeader, rows[0])
+	require.Equal(t, "gpt-4o", rows[1][6])
+	require.Equal(t, "a, \"quoted\" line", rows[1][17])
+	require.Equal(t, "gpt-4o-mini", rows[2][6])
+}
+
+func TestExportLogsNDJSONGzip(t *testing.T) {
+	router := setupLogExportTest(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/log/export?format=ndjson&gzip=true&model_name=gpt-4o", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+
+	reader, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	var users []int
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		var log model.Log
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &log))
+		require.Equal(t, "gpt-4o", log.ModelName)
+		users = append(users, log.UserId)
+	}
+	require.NoError(t, scanner.Err())
+	require.Equal(t, []int{1, 2}, users)
+}
+
+func TestExportLogsRejectsUnknownFormat(t *testing.T) {
+	router := setupLogExportTest(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/log/export?format=xlsx", nil))
+	var resp struct {
+		Success bool `json:"success"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.False(t, resp.Success)
+}
@@ -36,6 +36,9 @@ func GetStatus(c *gin.Context) {
 			"turnstile_check":             config.TurnstileCheckEnabled,
 			"turnstile_site_key":          config.TurnstileSiteKey,
 			"top_up_link":                 config.TopUpLink,
+			"payment_provider":            config.PaymentProvider,
+			"payment_currency":            config.PaymentCurrency,
+			"payment_min_top_up":          config.PaymentMinTopUp,
 			"chat_link":                   config.ChatLink,
 			"quota_per_unit":              config.QuotaPerUnit,
 			"display_in_currency":         config.DisplayInCurrencyEnabled,
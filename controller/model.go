@@ -176,11 +176,14 @@ type ChannelModelsDisplayInfo struct {
 
 // ModelDisplayInfo represents display information for a single model
 type ModelDisplayInfo struct {
-	InputPrice       float64 `json:"input_price"`           // Price per 1M input tokens in USD
-	CachedInputPrice float64 `json:"cached_input_price"`    // Price per 1M cached input tokens in USD (falls back to input price when unspecified)
-	OutputPrice      float64 `json:"output_price"`          // Price per 1M output tokens in USD
-	MaxTokens        int32   `json:"max_tokens"`            // Maximum tokens limit, 0 means unlimited
-	ImagePrice       float64 `json:"image_price,omitempty"` // USD per image (image models only)
+	InputPrice       float64 `json:"input_price"`                 // Price per 1M input tokens in USD
+	CachedInputPrice float64 `json:"cached_input_price"`          // Price per 1M cached input tokens in USD (falls back to input price when unspecified)
+	OutputPrice      float64 `json:"output_price"`                // Price per 1M output tokens in USD
+	MaxTokens        int32   `json:"max_tokens"`                  // Maximum tokens limit, 0 means unlimited
+	ImagePrice       float64 `json:"image_price,omitempty"`       // USD per image (image models only)
+	SearchUnitPrice  float64 `json:"search_unit_price,omitempty"` // USD per search unit (rerank models only)
+	DocumentPrice    float64 `json:"document_price,omitempty"`    // USD per ranked document (rerank models only)
+	VideoPrice       float64 `json:"video_price,omitempty"`       // USD per generated second (video models only)
 }
 
 // GetModelsDisplay returns models available to the current user grouped by channel/adaptor with pricing information
@@ -238,7 +241,7 @@ func GetModelsDisplay(c *gin.Context) {
 
 			var inputPrice, cachedInputPrice, outputPrice float64
 			var maxTokens int32
-			var imagePrice float64
+			var imagePrice, videoPrice float64
 
 			if cfg, ok := pricing[actual]; ok {
 				if cfg.ImagePriceUsd > 0 && cfg.Ratio == 0 {
@@ -250,6 +253,21 @@ func GetModelsDisplay(c *gin.Context) {
 					}
 					continue
 				}
+				if (cfg.SearchUnitPriceUsd > 0 || cfg.DocumentPriceUsd > 0) && cfg.Ratio == 0 {
+					result[modelName] = ModelDisplayInfo{
+						MaxTokens:       cfg.MaxTokens,
+						SearchUnitPrice: cfg.SearchUnitPriceUsd,
+						DocumentPrice:   cfg.DocumentPriceUsd,
+					}
+					continue
+				}
+				if cfg.VideoPriceUsdPerSecond > 0 && cfg.Ratio == 0 {
+					result[modelName] = ModelDisplayInfo{
+						MaxTokens:  cfg.MaxTokens,
+						VideoPrice: cfg.VideoPriceUsdPerSecond,
+					}
+					continue
+				}
 				inputPrice = convertRatioToPrice(cfg.Ratio)
 				cachedInputPrice = inputPrice
 				if cfg.CachedInputRatio != 0 {
@@ -258,6 +276,7 @@ func GetModelsDisplay(c *gin.Context) {
 				outputPrice = inputPrice * cfg.CompletionRatio
 				maxTokens = cfg.MaxTokens
 				imagePrice = cfg.ImagePriceUsd
+				videoPrice = cfg.VideoPriceUsdPerSecond
 			} else {
 				inRatio := adaptor.GetModelRatio(actual)
 				compRatio := adaptor.GetCompletionRatio(actual)
@@ -274,6 +293,7 @@ func GetModelsDisplay(c *gin.Context) {
 				OutputPrice:      outputPrice,
 				MaxTokens:        maxTokens,
 				ImagePrice:       imagePrice,
+				VideoPrice:       videoPrice,
 			}
 		}
 		return result
@@ -10,7 +10,12 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/i18n"
+	"github.com/songquanpeng/one-api/common/payment"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
+	"github.com/songquanpeng/one-api/relay/retrypolicy"
 )
 
 func GetOptions(c *gin.Context) {
@@ -84,7 +89,61 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "GuardrailPolicy":
+		// validate before saving so a broken policy never reaches the option table
+		if _, err := guardrail.ParsePolicy(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid guardrail policy: " + err.Error(),
+			})
+			return
+		}
+	case "RetryPolicy":
+		if _, err := retrypolicy.ParsePolicies(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid retry policy: " + err.Error(),
+			})
+			return
+		}
+	case "HedgePolicy":
+		if _, err := hedge.ParsePolicies(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid hedge policy: " + err.Error(),
+			})
+			return
+		}
+	case "GroupPricingRules":
+		if _, err := pricingrule.ParseRules(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid group pricing rules: " + err.Error(),
+			})
+			return
+		}
+	case "PaymentProvider":
+		if option.Value != "" {
+			if _, err := payment.Get(option.Value); err != nil {
+				c.JSON(http.StatusOK, gin.H{
+					"success": false,
+					"message": err.Error(),
+				})
+				return
+			}
+		}
+	case "ChannelSelectionStrategy":
+		if _, err := model.ParseChannelSelectionStrategies(option.Value); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid channel selection strategy: " + err.Error(),
+			})
+			return
+		}
 	}
+	config.OptionMapRWMutex.RLock()
+	previous, existed := config.OptionMap[option.Key]
+	config.OptionMapRWMutex.RUnlock()
 	err = model.UpdateOption(option.Key, option.Value)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -93,6 +152,11 @@ func UpdateOption(c *gin.Context) {
 		})
 		return
 	}
+	var before any
+	if existed {
+		before = gin.H{option.Key: previous}
+	}
+	recordAudit(c, model.AuditActionOptionUpdate, model.AuditTargetOption, option.Key, before, gin.H{option.Key: option.Value})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,504 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/utils"
+	"github.com/songquanpeng/one-api/model"
+)
+
+type addOrganizationRequest struct {
+	Name        string `json:"name"`
+	Quota       int64  `json:"quota"`
+	OwnerUserId int    `json:"owner_user_id"`
+}
+
+type organizationMemberRequest struct {
+	UserId   int    `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type organizationTransferRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+// GetAllOrganizations lists all organizations (admin only).
+func GetAllOrganizations(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	size, _ := strconv.Atoi(c.Query("size"))
+	if size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	if size > config.MaxItemsPerPage {
+		size = config.MaxItemsPerPage
+	}
+
+	organizations, err := model.GetAllOrganizations(p*size, size)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	totalCount, err := model.GetOrganizationCount()
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+		"total":   totalCount,
+	})
+}
+
+// AddOrganization creates an organization with its first owner (admin only).
+func AddOrganization(c *gin.Context) {
+	req := new(addOrganizationRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Organization name must be between 1 and 64 characters",
+		})
+		return
+	}
+	if req.Quota < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Quota cannot be negative",
+		})
+		return
+	}
+	if _, err := model.GetUserById(req.OwnerUserId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Owner user does not exist",
+		})
+		return
+	}
+
+	organization := &model.Organization{
+		Name:   req.Name,
+		Status: model.OrganizationStatusEnabled,
+		Quota:  req.Quota,
+	}
+	if err := model.CreateOrganization(organization, req.OwnerUserId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+}
+
+// UpdateOrganization changes name, status or quota of an organization (admin only).
+// Quota is only changed when present in the request, and is applied as the difference to
+// the balance read here so that usage charged meanwhile is not overwritten.
+func UpdateOrganization(c *gin.Context) {
+	var patch struct {
+		Id     int    `json:"id"`
+		Name   string `json:"name"`
+		Status *int   `json:"status"`
+		Quota  *int64 `json:"quota"`
+	}
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	organization, err := model.GetOrganizationById(patch.Id)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if patch.Quota != nil && *patch.Quota < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Quota cannot be negative",
+		})
+		return
+	}
+	if patch.Status != nil && *patch.Status != model.OrganizationStatusEnabled && *patch.Status != model.OrganizationStatusDisabled {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid organization status",
+		})
+		return
+	}
+	if name := strings.TrimSpace(patch.Name); name != "" {
+		organization.Name = name
+	}
+	if patch.Status != nil {
+		organization.Status = *patch.Status
+	}
+	if err = organization.Update(); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if patch.Quota != nil && *patch.Quota != organization.Quota {
+		if err = model.AdjustOrganizationQuota(organization.Id, *patch.Quota-organization.Quota); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+		if organization, err = model.GetOrganizationById(organization.Id); err != nil {
+			helper.RespondError(c, err)
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+}
+
+// DeleteOrganization removes an organization; its tokens fall back to personal quota (admin only).
+func DeleteOrganization(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := model.DeleteOrganizationById(gmw.Ctx(c), id); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetSelfOrganizations lists the organizations the current user belongs to.
+func GetSelfOrganizations(c *gin.Context) {
+	organizations, err := model.ListUserOrganizations(c.GetInt(ctxkey.Id))
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organizations,
+	})
+}
+
+// GetOrganization returns an organization the current user belongs to.
+func GetOrganization(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c)
+	if !ok {
+		return
+	}
+	organization, err := model.GetOrganizationById(organizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    organization,
+	})
+}
+
+// GetOrganizationMembers lists members of an organization the current user belongs to.
+func GetOrganizationMembers(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(organizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    members,
+	})
+}
+
+// AddOrganizationMember adds a user by id or username (owners only).
+func AddOrganizationMember(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c, model.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	req := new(organizationMemberRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+
+	userId := req.UserId
+	if userId == 0 && req.Username != "" {
+		user := &model.User{Username: req.Username}
+		if err := user.FillUserByUsername(); err != nil || user.Id == 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "User does not exist",
+			})
+			return
+		}
+		userId = user.Id
+	}
+	if _, err := model.GetUserById(userId, false); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "User does not exist",
+		})
+		return
+	}
+
+	member, err := model.AddOrganizationMember(organizationId, userId, req.Role)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    member,
+	})
+}
+
+// UpdateOrganizationMember changes the role of a member (owners only).
+func UpdateOrganizationMember(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c, model.OrganizationRoleOwner)
+	if !ok {
+		return
+	}
+	req := new(organizationMemberRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	if err := model.UpdateOrganizationMemberRole(organizationId, req.UserId, req.Role); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// RemoveOrganizationMember removes a member (owners only). Members may also leave on their own.
+func RemoveOrganizationMember(c *gin.Context) {
+	userId, _ := strconv.Atoi(c.Param("user_id"))
+	var organizationId int
+	var ok bool
+	if userId != 0 && userId == c.GetInt(ctxkey.Id) {
+		organizationId, ok = checkOrganizationRole(c)
+	} else {
+		organizationId, ok = checkOrganizationRole(c, model.OrganizationRoleOwner)
+	}
+	if !ok {
+		return
+	}
+	if err := model.RemoveOrganizationMember(gmw.Ctx(c), organizationId, userId); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// TransferOrganizationQuota moves quota from the caller's personal balance into the
+// organization pool (owners and billing managers).
+func TransferOrganizationQuota(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	req := new(organizationTransferRequest)
+	if err := c.ShouldBindJSON(req); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId := c.GetInt(ctxkey.Id)
+	if err := model.TransferUserQuotaToOrganization(gmw.Ctx(c), userId, organizationId, req.Quota); err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	model.RecordLog(gmw.Ctx(c), userId, model.LogTypeManage,
+		fmt.Sprintf("Transferred %s to organization %d", common.LogQuota(req.Quota), organizationId))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+	})
+}
+
+// GetOrganizationLogs lists the logs of the tokens charged to the organization pool, so
+// members' personal usage stays private (owners and billing managers).
+func GetOrganizationLogs(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	tokenName := c.Query("token_name")
+	modelName := c.Query("model_name")
+	sortBy := c.Query("sort_by")
+	sortOrder := c.DefaultQuery("sort_order", "desc")
+	size, err := strconv.Atoi(c.Query("size"))
+	if err != nil || size <= 0 {
+		size = config.DefaultItemsPerPage
+	}
+	if size > config.MaxItemsPerPage {
+		size = config.MaxItemsPerPage
+	}
+
+	tokenIds, err := model.GetOrganizationTokenIds(organizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	logs, err := model.GetTokensLogs(tokenIds, userId, logType, startTimestamp, endTimestamp, modelName, tokenName, p*size, size, sortBy, sortOrder)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	totalCount, err := model.GetTokensLogsCount(tokenIds, userId, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    logs,
+		"total":   totalCount,
+	})
+}
+
+// GetOrganizationDashboard returns per-member daily usage of the pool tokens and the pool balance
+// (owners and billing managers).
+func GetOrganizationDashboard(c *gin.Context) {
+	organizationId, ok := checkOrganizationRole(c, model.OrganizationRoleOwner, model.OrganizationRoleBilling)
+	if !ok {
+		return
+	}
+
+	var startTs, endTsExclusive int64
+	fromDateStr := c.Query("from_date")
+	toDateStr := c.Query("to_date")
+	if fromDateStr != "" && toDateStr != "" {
+		s, e, err := utils.NormalizeDateRange(fromDateStr, toDateStr, 31)
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error(), "data": nil})
+			return
+		}
+		startTs = s
+		endTsExclusive = e
+	} else {
+		// Default last 7 days including today: [today-6, today]
+		today := time.Now().UTC().Truncate(24 * time.Hour)
+		startTs = today.AddDate(0, 0, -6).Unix()
+		endTsExclusive = today.Add(24 * time.Hour).Unix()
+	}
+
+	organization, err := model.GetOrganizationById(organizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	tokenIds, err := model.GetOrganizationTokenIds(organizationId)
+	if err != nil {
+		helper.RespondError(c, err)
+		return
+	}
+	userId, _ := strconv.Atoi(c.Query("user_id"))
+	userStats, err := model.SearchLogsByDayAndUsers(tokenIds, userId, int(startTs), int(endTsExclusive))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Failed to get user usage data: " + err.Error(),
+			"data":    nil,
+		})
+		return
+	}
+
+	status := "Active"
+	if organization.Status != model.OrganizationStatusEnabled {
+		status = "Disabled"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"user_logs":   userStats,
+			"total_quota": organization.Quota,
+			"used_quota":  organization.UsedQuota,
+			"status":      status,
+		},
+	})
+}
+
+// checkOrganizationRole resolves the :id route parameter and verifies the current user is a
+// member holding one of roles (any role when empty). Admins pass unconditionally. On failure
+// the response is already written.
+func checkOrganizationRole(c *gin.Context, roles ...string) (int, bool) {
+	organizationId, err := strconv.Atoi(c.Param("id"))
+	if err != nil || organizationId <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "Invalid organization id",
+		})
+		return 0, false
+	}
+	if c.GetInt(ctxkey.Role) >= model.RoleAdminUser {
+		return organizationId, true
+	}
+
+	member, err := model.GetOrganizationMember(organizationId, c.GetInt(ctxkey.Id))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "You are not a member of this organization",
+		})
+		return 0, false
+	}
+	if len(roles) == 0 {
+		return organizationId, true
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return organizationId, true
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": "Your organization role does not allow this operation",
+	})
+	return 0, false
+}
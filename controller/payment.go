@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/payment"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// maxPaymentWebhookBytes bounds the webhook payloads read from payment providers.
+const maxPaymentWebhookBytes = 1 << 20
+
+type topUpCheckoutRequest struct {
+	// Amount is what the user pays, in units of config.PaymentCurrency.
+	Amount float64 `json:"amount"`
+}
+
+// CreateTopUpCheckout creates a top-up order for the current user and a checkout session to
+// pay it with the configured payment provider.
+func CreateTopUpCheckout(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	if config.PaymentProvider == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "online top-up is not enabled",
+		})
+		return
+	}
+	provider, err := payment.Get(config.PaymentProvider)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	req := topUpCheckoutRequest{}
+	if err = c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if math.IsNaN(req.Amount) || req.Amount < config.PaymentMinTopUp || req.Amount <= 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("the top-up amount must be at least %g", config.PaymentMinTopUp),
+		})
+		return
+	}
+
+	userId := c.GetInt(ctxkey.Id)
+	amountCents := int64(math.Round(req.Amount * 100))
+	order := &model.TopUpOrder{
+		TradeNo:     "topup_" + random.GetUUID(),
+		UserId:      userId,
+		Provider:    provider.Name(),
+		AmountCents: amountCents,
+		Currency:    config.PaymentCurrency,
+		Quota:       int64(float64(amountCents) / 100 * config.PaymentQuotaPerUnit),
+	}
+	if err = order.Insert(); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	email, _ := model.GetUserEmail(userId)
+	checkout, err := provider.CreateCheckout(ctx, payment.CheckoutRequest{
+		OrderId:     order.TradeNo,
+		AmountCents: order.AmountCents,
+		Currency:    order.Currency,
+		Description: fmt.Sprintf("%s top-up", config.SystemName),
+		Email:       email,
+		SuccessURL:  fmt.Sprintf("%s/topup?order=%s", config.ServerAddress, order.TradeNo),
+		CancelURL:   fmt.Sprintf("%s/topup", config.ServerAddress),
+	})
+	if err != nil {
+		gmw.GetLogger(c).Error("failed to create checkout session", zap.String("trade_no", order.TradeNo), zap.Error(err))
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "failed to create the checkout session, please try again later",
+		})
+		return
+	}
+	if err = model.SetTopUpOrderSession(order.TradeNo, checkout.SessionId); err != nil {
+		gmw.GetLogger(c).Warn("failed to record checkout session", zap.String("trade_no", order.TradeNo), zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"trade_no": order.TradeNo,
+			"url":      checkout.URL,
+			"quota":    order.Quota,
+		},
+	})
+}
+
+// GetSelfTopUpOrders lists the top-up orders of the current user.
+func GetSelfTopUpOrders(c *gin.Context) {
+	p, _ := strconv.Atoi(c.Query("p"))
+	if p < 0 {
+		p = 0
+	}
+	pageSize, err := strconv.Atoi(c.Query("size"))
+	if err != nil || pageSize <= 0 {
+		pageSize = config.DefaultItemsPerPage
+	}
+	if pageSize > config.MaxItemsPerPage {
+		pageSize = config.MaxItemsPerPage
+	}
+
+	orders, total, err := model.GetUserTopUpOrders(c.GetInt(ctxkey.Id), p*pageSize, pageSize)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    orders,
+		"total":   total,
+	})
+}
+
+// PaymentWebhook receives the events of a payment provider: paid checkouts credit their
+// order's quota and refunds take it back. Both are idempotent, since providers retry events
+// until they are acknowledged with a 2xx status.
+func PaymentWebhook(c *gin.Context) {
+	ctx := gmw.Ctx(c)
+	lg := gmw.GetLogger(c)
+	provider, err := payment.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "message": err.Error()})
+		return
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPaymentWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "failed to read the request body"})
+		return
+	}
+	event, err := provider.ParseWebhook(payload, c.Request.Header, time.Now())
+	if errors.Is(err, payment.ErrIgnoredEvent) {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "ignored"})
+		return
+	}
+	if err != nil {
+		lg.Warn("rejected payment webhook", zap.String("provider", provider.Name()), zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "message": "invalid webhook event"})
+		return
+	}
+
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		credited, err := model.CompleteTopUpOrder(ctx, event.OrderId, event.PaymentId, event.AmountCents, event.Currency)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// not a checkout one-api created, e.g. on a shared provider account
+			c.JSON(http.StatusOK, gin.H{"success": true, "message": "ignored"})
+			return
+		}
+		if errors.Is(err, model.ErrTopUpOrderMismatch) {
+			// the order is flagged for admins; retrying the event cannot fix it
+			lg.Error("payment does not match the top-up order",
+				zap.String("event_id", event.Id), zap.String("trade_no", event.OrderId), zap.Error(err))
+			c.JSON(http.StatusOK, gin.H{"success": true, "message": "order flagged as mismatched"})
+			return
+		}
+		if err != nil {
+			lg.Error("failed to complete top-up order",
+				zap.String("event_id", event.Id), zap.String("trade_no", event.OrderId), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to complete the order"})
+			return
+		}
+		lg.Info("payment received", zap.String("event_id", event.Id), zap.String("trade_no", event.OrderId), zap.Bool("credited", credited))
+	case payment.EventPaymentRefunded:
+		clawedBack, err := model.RefundTopUpOrder(ctx, event.PaymentId, event.AmountCents)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// not a payment for a top-up
+			c.JSON(http.StatusOK, gin.H{"success": true, "message": "ignored"})
+			return
+		}
+		if err != nil {
+			lg.Error("failed to refund top-up order",
+				zap.String("event_id", event.Id), zap.String("payment_id", event.PaymentId), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "message": "failed to refund the order"})
+			return
+		}
+		lg.Info("payment refunded", zap.String("event_id", event.Id), zap.String("payment_id", event.PaymentId), zap.Int64("clawed_back", clawedBack))
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": ""})
+}
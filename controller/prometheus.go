@@ -2,12 +2,14 @@ package controller
 
 import (
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
 	"github.com/songquanpeng/one-api/relay/meta"
 )
@@ -45,22 +47,25 @@ func (p *PrometheusRelayMonitor) RecordRelayRequest(c *gin.Context, meta *meta.M
 	}
 }
 
-// RecordChannelRequest tracks channel-specific request metrics
-func (p *PrometheusRelayMonitor) RecordChannelRequest(meta *meta.Meta, startTime time.Time) {
-	channelIdStr := strconv.Itoa(meta.ChannelId)
+// RecordChannelRequest tracks a request in flight on the channel and returns the function
+// that completes it with the relay status code. The in-flight gauge drives the least_inflight
+// channel selection, and completed requests feed its latency and error observations;
+// observeLatency should only be set for model relays, whose duration is comparable across channels.
+func (p *PrometheusRelayMonitor) RecordChannelRequest(meta *meta.Meta, startTime time.Time, observeLatency bool) func(statusCode int) {
+	channelId := meta.ChannelId
 	channelType := channeltype.IdToName(meta.ChannelType)
-	channelName := "channel_" + channelIdStr // We might want to get actual channel name from DB
+	channelName := model.ChannelMetricName(channelId)
 
 	// Track requests in flight
-	metrics.GlobalRecorder.UpdateChannelRequestsInFlight(meta.ChannelId, channelName, channelType, 1)
+	metrics.GlobalRecorder.UpdateChannelRequestsInFlight(channelId, channelName, channelType, 1)
 
-	// We'll update this when the request completes
-	go func() {
-		// Wait for request to complete (this is a simplified approach)
-		// In practice, you'd want to track this more precisely
-		time.Sleep(time.Until(startTime.Add(time.Minute))) // Max wait of 1 minute
-		metrics.GlobalRecorder.UpdateChannelRequestsInFlight(meta.ChannelId, channelName, channelType, -1)
-	}()
+	var once sync.Once
+	return func(statusCode int) {
+		once.Do(func() {
+			metrics.GlobalRecorder.UpdateChannelRequestsInFlight(channelId, channelName, channelType, -1)
+			model.ObserveChannelRequest(channelId, startTime, statusCode, observeLatency)
+		})
+	}
 }
 
 // RecordError records an error metric
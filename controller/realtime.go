@@ -1,34 +1,41 @@
 package controller
 
 import (
+	"net/http"
 	"time"
 
 	gmw "github.com/Laisky/gin-middlewares/v6"
 	"github.com/gin-gonic/gin"
 
-	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/monitor"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
 	"github.com/songquanpeng/one-api/relay/meta"
 )
 
 // RelayRealtime handles WebSocket Realtime proxying for OpenAI Realtime API.
-// It does not perform request conversion or pre-consume quota; billing is best-effort based on upstream usage if emitted.
+// Quota is pre-consumed before the upgrade and each response.done event is billed as it arrives;
+// the session is closed with an error event once the user's quota is exhausted.
 func RelayRealtime(c *gin.Context) {
-	ctx := gmw.Ctx(c)
-	_ = ctx // reserved for future use (timeouts, logging)
 	start := time.Now()
 	relayMeta := meta.GetByContext(c)
 
 	// Record channel requests in flight
-	PrometheusMonitor.RecordChannelRequest(relayMeta, start)
+	done := PrometheusMonitor.RecordChannelRequest(relayMeta, start, false)
 
-	if bizErr, _ := openai.RealtimeHandler(c, relayMeta); bizErr != nil {
+	if bizErr := rcontroller.RelayRealtimeHelper(c); bizErr != nil {
 		// On handshake/connection error, return JSON error (no WS established)
-		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		done(bizErr.StatusCode)
 		PrometheusMonitor.RecordRelayRequest(c, relayMeta, start, false, 0, 0, 0)
+		monitor.Emit(relayMeta.ChannelId, relayMeta.OriginModelName, false)
+		requestId := c.GetString(helper.RequestIdKey)
+		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
 		return
 	}
 
 	// If we reach here, the WS session completed normally (handler handled I/O).
 	gmw.GetLogger(c).Debug("realtime session closed")
+	done(http.StatusOK)
 	PrometheusMonitor.RecordRelayRequest(c, relayMeta, start, true, 0, 0, 0)
 }
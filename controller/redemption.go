@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/Laisky/errors/v2"
 	"github.com/gin-gonic/gin"
 
 	"github.com/songquanpeng/one-api/common/config"
@@ -114,6 +115,21 @@ func GetRedemption(c *gin.Context) {
 	})
 }
 
+// validateRedemptionCredit checks the credit a redemption code grants, defaulting its source.
+func validateRedemptionCredit(redemption *model.Redemption) error {
+	switch redemption.CreditSource {
+	case "":
+		redemption.CreditSource = model.CreditSourceRedemption
+	case model.CreditSourceRedemption, model.CreditSourcePromotion:
+	default:
+		return errors.Errorf("credit source must be %q or %q", model.CreditSourceRedemption, model.CreditSourcePromotion)
+	}
+	if redemption.CreditValidDays < 0 {
+		return errors.New("credit validity cannot be negative")
+	}
+	return nil
+}
+
 func AddRedemption(c *gin.Context) {
 	redemption := model.Redemption{}
 	err := c.ShouldBindJSON(&redemption)
@@ -135,6 +151,10 @@ func AddRedemption(c *gin.Context) {
 		})
 		return
 	}
+	if err := validateRedemptionCredit(&redemption); err != nil {
+		c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+		return
+	}
 	if redemption.Count <= 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -153,11 +173,14 @@ func AddRedemption(c *gin.Context) {
 	for i := 0; i < redemption.Count; i++ {
 		key := random.GetUUID()
 		cleanRedemption := model.Redemption{
-			UserId:      c.GetInt(ctxkey.Id),
-			Name:        redemption.Name,
-			Key:         key,
-			CreatedTime: helper.GetTimestamp(),
-			Quota:       redemption.Quota,
+			UserId:          c.GetInt(ctxkey.Id),
+			Name:            redemption.Name,
+			Key:             key,
+			CreatedTime:     helper.GetTimestamp(),
+			Quota:           redemption.Quota,
+			CreditSource:    redemption.CreditSource,
+			CreditValidDays: redemption.CreditValidDays,
+			CreditPriority:  redemption.CreditPriority,
 		}
 		err = cleanRedemption.Insert()
 		if err != nil {
@@ -168,6 +191,7 @@ func AddRedemption(c *gin.Context) {
 			})
 			return
 		}
+		recordAudit(c, model.AuditActionRedemptionCreate, model.AuditTargetRedemption, cleanRedemption.Id, nil, &cleanRedemption)
 		keys = append(keys, key)
 	}
 	c.JSON(http.StatusOK, gin.H{
@@ -179,6 +203,7 @@ func AddRedemption(c *gin.Context) {
 
 func DeleteRedemption(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	before, _ := model.GetRedemptionById(id)
 	err := model.DeleteRedemptionById(id)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -187,6 +212,7 @@ func DeleteRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionRedemptionDelete, model.AuditTargetRedemption, id, before, nil)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -212,6 +238,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	before := *cleanRedemption
 	if statusOnly != "" {
 		cleanRedemption.Status = redemption.Status
 	} else {
@@ -220,8 +247,15 @@ func UpdateRedemption(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{"success": false, "message": "Redemption name cannot be empty"})
 			return
 		}
+		if err := validateRedemptionCredit(&redemption); err != nil {
+			c.JSON(http.StatusOK, gin.H{"success": false, "message": err.Error()})
+			return
+		}
 		cleanRedemption.Name = redemption.Name
 		cleanRedemption.Quota = redemption.Quota
+		cleanRedemption.CreditSource = redemption.CreditSource
+		cleanRedemption.CreditValidDays = redemption.CreditValidDays
+		cleanRedemption.CreditPriority = redemption.CreditPriority
 	}
 	err = cleanRedemption.Update()
 	if err != nil {
@@ -231,6 +265,7 @@ func UpdateRedemption(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionRedemptionUpdate, model.AuditTargetRedemption, cleanRedemption.Id, &before, cleanRedemption)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
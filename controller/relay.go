@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,10 +23,13 @@ import (
 	"github.com/songquanpeng/one-api/middleware"
 	dbmodel "github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/monitor"
+	"github.com/songquanpeng/one-api/relay/affinity"
 	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/hedge"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/retrypolicy"
 )
 
 // https://platform.openai.com/docs/api-reference/chat
@@ -52,6 +56,10 @@ func relayHelper(c *gin.Context, relayMode int) *model.ErrorWithStatusCode {
 		err = rcontroller.RelayResponseAPIHelper(c)
 	case relaymode.ClaudeMessages:
 		err = rcontroller.RelayClaudeMessagesHelper(c)
+	case relaymode.GeminiGenerateContent:
+		err = rcontroller.RelayGeminiHelper(c)
+	case relaymode.Rerank:
+		err = rcontroller.RelayRerankHelper(c)
 	default:
 		err = rcontroller.RelayTextHelper(c)
 	}
@@ -87,12 +95,41 @@ func Relay(c *gin.Context) {
 	// Get metadata for monitoring
 	relayMeta := meta.GetByContext(c)
 
-	// Track channel request in flight
-	PrometheusMonitor.RecordChannelRequest(relayMeta, startTime)
+	// Replay identical deterministic requests from the response cache when enabled
+	responseCache, served, guardErr := rcontroller.LookupResponseCache(c, relayMode)
+	if guardErr != nil {
+		PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, false, 0, 0, 0)
+		renderRelayError(c, relayMode, guardErr, 0, shouldDebugLog)
+		return
+	}
+	if served {
+		PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, true, 0, 0, 0)
+		return
+	}
 
-	bizErr := relayHelper(c, relayMode)
+	// Track channel request in flight
+	setServedModelHeader(c)
+	done := PrometheusMonitor.RecordChannelRequest(relayMeta, startTime, true)
+	var bizErr *model.ErrorWithStatusCode
+	// channels of hedged attempts that failed besides the one reported in c
+	var hedgeFailedChannels []int
+	hedgePolicy := matchHedgePolicy(c, relayMode)
+	if hedgePolicy != nil {
+		bizErr, hedgeFailedChannels = relayHedged(c, hedgePolicy, relayMode)
+		// c now carries the channel of the attempt that won, or of the first one
+		channelId = c.GetInt(ctxkey.ChannelId)
+		relayMeta = meta.GetByContext(c)
+	} else {
+		bizErr = relayHelper(c, relayMode)
+	}
+	done(relayStatusCode(bizErr))
 	if bizErr == nil {
-		monitor.Emit(channelId, true)
+		if hedgePolicy != nil {
+			hedge.Observe(c.GetString(ctxkey.Group), c.GetString(ctxkey.RequestModel), time.Since(startTime))
+		}
+		responseCache.Store(c)
+		bindPromptCacheAffinity(c)
+		monitor.Emit(channelId, c.GetString(ctxkey.RequestModel), true)
 
 		// Record successful relay request metrics
 		PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, true, 0, 0, 0)
@@ -101,18 +138,33 @@ func Relay(c *gin.Context) {
 		}
 		return
 	}
+	releasePromptCacheAffinity(c, channelId, bizErr)
 	lastFailedChannelId := channelId
 	channelName := c.GetString(ctxkey.ChannelName)
 	group := c.GetString(ctxkey.Group)
 	originalModel := c.GetString(ctxkey.RequestModel)
+	channelKeyId := c.GetInt(ctxkey.ChannelKeyId)
 	// Ensure channel error processing is completed during graceful drain
 	graceful.GoCritical(ctx, "processChannelRelayError", func(ctx context.Context) {
-		processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+		processChannelRelayError(ctx, userId, channelId, channelKeyId, channelName, group, originalModel, *bizErr)
 	})
 
 	// Record failed relay request metrics
 	PrometheusMonitor.RecordRelayRequest(c, relayMeta, startTime, false, 0, 0, 0)
 
+	// Track failed channels to avoid retrying them, especially for 429 errors
+	failedChannels := make(map[int]bool)
+	failedChannels[lastFailedChannelId] = true
+	for _, id := range hedgeFailedChannels {
+		failedChannels[id] = true
+	}
+
+	// A matching retry policy replaces the RetryTimes based retries below
+	if policy := retrypolicy.Match(group, originalModel); policy != nil {
+		relayWithRetryPolicy(c, policy, relayMode, responseCache, bizErr, failedChannels, startTime, shouldDebugLog)
+		return
+	}
+
 	requestId := c.GetString(helper.RequestIdKey)
 	retryTimes := config.RetryTimes
 	if err := shouldRetry(c, bizErr.StatusCode, bizErr.RawError); err != nil {
@@ -159,10 +211,6 @@ func Relay(c *gin.Context) {
 		}
 	}
 
-	// Track failed channels to avoid retrying them, especially for 429 errors
-	failedChannels := make(map[int]bool)
-	failedChannels[lastFailedChannelId] = true
-
 	// Debug logging to track channel exclusions (only when debug is enabled)
 	if config.DebugEnabled {
 		if retryTimes > 0 {
@@ -180,6 +228,9 @@ func Relay(c *gin.Context) {
 		}
 	}
 
+	// The first failure decides how retries pick their channels, see selectRetryChannel
+	initialStatusCode := bizErr.StatusCode
+
 	// For 429 errors, we should try lower priority channels first
 	// since the highest priority channel is rate limited
 	shouldTryLowerPriorityFirst := bizErr.StatusCode == http.StatusTooManyRequests
@@ -190,6 +241,8 @@ func Relay(c *gin.Context) {
 	// For 5xx/server transient errors, avoid reusing the same ability first, probe within tier
 	isServerTransient := bizErr.StatusCode >= 500 && bizErr.StatusCode <= 599
 
+	// Keep retries of a user on the same channel under the consistent_hash strategy
+	affinityKey := strconv.Itoa(userId)
 	for i := retryTimes; i > 0; i-- {
 		var channel *dbmodel.Channel
 		var err error
@@ -204,31 +257,9 @@ func Relay(c *gin.Context) {
 				zap.Bool("server_transient", isServerTransient))
 		}
 
-		if shouldTryLargerMaxTokensFirst {
-			// For 413 errors, try larger max_tokens channels
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, false, failedChannels, true)
-		} else if shouldTryLowerPriorityFirst {
-			// For 429 errors, first try lower priority channels while excluding failed ones
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, true, failedChannels, false)
-			if err != nil {
-				// If no lower priority channels available, try highest priority channels (excluding failed ones)
-				lg.Info("No lower priority channels available, trying highest priority channels",
-					zap.Ints("excluded_channels", getChannelIds(failedChannels)),
-				)
-				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, false, failedChannels, false)
-			}
-		} else {
-			// For non-429 errors, try highest priority first, then lower priority (excluding failed ones)
-			channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, false, failedChannels, false)
-			if err != nil {
-				lg.Info("No highest priority channels available, trying lower priority channels",
-					zap.Ints("excluded_channels", getChannelIds(failedChannels)))
-				channel, err = dbmodel.CacheGetRandomSatisfiedChannelExcluding(group, originalModel, true, failedChannels, false)
-			}
-		}
-
+		channel, err = selectRetryChannel(c, group, originalModel, failedChannels, initialStatusCode, affinityKey)
 		if err != nil {
-			lg.Error("CacheGetRandomSatisfiedChannelExcluding failed",
+			lg.Error("CacheSelectChannelExcluding failed",
 				zap.Error(err),
 				zap.Ints("excluded_channels", getChannelIds(failedChannels)),
 				zap.String("model", originalModel),
@@ -244,7 +275,11 @@ func Relay(c *gin.Context) {
 			zap.Int("channel_id", channel.Id),
 			zap.Int("remaining_attempts", i),
 		)
-		middleware.SetupContextForSelectedChannel(c, channel, originalModel)
+		if err := middleware.SetupContextForSelectedChannel(c, channel, originalModel); err != nil {
+			lg.Warn("retry channel has no usable key, skipping it", zap.Int("channel_id", channel.Id), zap.Error(err))
+			failedChannels[channel.Id] = true
+			continue
+		}
 		requestBody, err := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
@@ -252,8 +287,13 @@ func Relay(c *gin.Context) {
 		retryStartTime := time.Now()
 		retryMeta := meta.GetByContext(c)
 
+		responseCache.Reset()
+		retryDone := PrometheusMonitor.RecordChannelRequest(retryMeta, retryStartTime, true)
 		bizErr = relayHelper(c, relayMode)
+		retryDone(relayStatusCode(bizErr))
 		if bizErr == nil {
+			responseCache.Store(c)
+			bindPromptCacheAffinity(c)
 			// Record successful retry
 			PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, true, 0, 0, 0)
 			return
@@ -263,6 +303,7 @@ func Relay(c *gin.Context) {
 		PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, false, 0, 0, 0)
 
 		channelId := c.GetInt(ctxkey.ChannelId)
+		releasePromptCacheAffinity(c, channelId, bizErr)
 		failedChannels[channelId] = true // Track this failed channel
 		lastFailedChannelId = channelId
 
@@ -277,34 +318,99 @@ func Relay(c *gin.Context) {
 		// Update group and originalModel potentially if changed by middleware, though unlikely for these.
 		group = c.GetString(ctxkey.Group)
 		originalModel = c.GetString(ctxkey.RequestModel)
+		channelKeyId := c.GetInt(ctxkey.ChannelKeyId)
 		graceful.GoCritical(ctx, "processChannelRelayError", func(ctx context.Context) {
-			processChannelRelayError(ctx, userId, channelId, channelName, group, originalModel, *bizErr)
+			processChannelRelayError(ctx, userId, channelId, channelKeyId, channelName, group, originalModel, *bizErr)
 		})
 	}
 
 	if bizErr != nil {
-		if bizErr.StatusCode == http.StatusTooManyRequests {
-			// Provide more specific messaging for 429 errors after exhausting retries
-			if len(failedChannels) > 1 {
-				bizErr.Error.Message = fmt.Sprintf("All available channels (%d) for this model are currently rate limited, please try again later", len(failedChannels)) // Message for client, not logger
-			} else {
-				bizErr.Error.Message = "The current group load is saturated, please try again later"
-			}
+		renderRelayError(c, relayMode, bizErr, len(failedChannels), shouldDebugLog)
+	}
+}
+
+// selectRetryChannel picks the channel for the next attempt at modelName, skipping the
+// channels that already failed. The status code of the last failure decides the order:
+// 413 prefers channels with a larger max_tokens, 429 tries lower priority channels first
+// since the highest priority ones are rate limited, anything else starts at the highest.
+func selectRetryChannel(c *gin.Context, group, modelName string, failedChannels map[int]bool, statusCode int, affinityKey string) (*dbmodel.Channel, error) {
+	lg := gmw.GetLogger(c)
+	var channel *dbmodel.Channel
+	var err error
+	if statusCode == http.StatusRequestEntityTooLarge {
+		// For 413 errors, try larger max_tokens channels
+		channel, err = dbmodel.CacheSelectChannelExcluding(group, modelName, false, failedChannels, true, affinityKey)
+	} else if statusCode == http.StatusTooManyRequests {
+		// For 429 errors, first try lower priority channels while excluding failed ones
+		channel, err = dbmodel.CacheSelectChannelExcluding(group, modelName, true, failedChannels, false, affinityKey)
+		if err != nil {
+			// If no lower priority channels available, try highest priority channels (excluding failed ones)
+			lg.Info("No lower priority channels available, trying highest priority channels",
+				zap.Ints("excluded_channels", getChannelIds(failedChannels)),
+			)
+			channel, err = dbmodel.CacheSelectChannelExcluding(group, modelName, false, failedChannels, false, affinityKey)
 		}
+	} else {
+		// For non-429 errors, try highest priority first, then lower priority (excluding failed ones)
+		channel, err = dbmodel.CacheSelectChannelExcluding(group, modelName, false, failedChannels, false, affinityKey)
+		if err != nil {
+			lg.Info("No highest priority channels available, trying lower priority channels",
+				zap.Ints("excluded_channels", getChannelIds(failedChannels)))
+			channel, err = dbmodel.CacheSelectChannelExcluding(group, modelName, true, failedChannels, false, affinityKey)
+		}
+	}
+	return channel, err
+}
 
-		// BUG: bizErr is in race condition
-		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
-		c.JSON(bizErr.StatusCode, gin.H{
-			"error": bizErr.Error,
-		})
-		if shouldDebugLog {
-			rcontroller.LogClientResponse(c, "client error response sent")
+// renderRelayError writes the error of the last attempt to the client once no retry is left.
+func renderRelayError(c *gin.Context, relayMode int, bizErr *model.ErrorWithStatusCode, triedChannels int, shouldDebugLog bool) {
+	if bizErr.StatusCode == http.StatusTooManyRequests {
+		// Provide more specific messaging for 429 errors after exhausting retries
+		if triedChannels > 1 {
+			bizErr.Error.Message = fmt.Sprintf("All available channels (%d) for this model are currently rate limited, please try again later", triedChannels) // Message for client, not logger
+		} else {
+			bizErr.Error.Message = "The current group load is saturated, please try again later"
 		}
 	}
+
+	if relayMode == relaymode.GeminiGenerateContent {
+		renderGeminiError(c, bizErr)
+		return
+	}
+
+	// BUG: bizErr is in race condition
+	bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, c.GetString(helper.RequestIdKey))
+	c.JSON(bizErr.StatusCode, gin.H{
+		"error": bizErr.Error,
+	})
+	if shouldDebugLog {
+		rcontroller.LogClientResponse(c, "client error response sent")
+	}
 }
 
 // shouldRetry returns nil if should retry, otherwise returns error
 func shouldRetry(c *gin.Context, statusCode int, rawErr error) error {
+	if err := retryUnavailable(c, rawErr); err != nil {
+		return err
+	}
+
+	// Do not retry on client-request errors except for rate limit (429), capacity (413), and auth (401/403)
+	// 404 should NOT retry, so it must not be excluded here.
+	if statusCode >= 400 &&
+		statusCode < 500 &&
+		statusCode != http.StatusTooManyRequests &&
+		statusCode != http.StatusRequestEntityTooLarge &&
+		statusCode != http.StatusUnauthorized &&
+		statusCode != http.StatusForbidden {
+		return errors.Errorf("client error %d, not retrying", statusCode)
+	}
+
+	return nil
+}
+
+// retryUnavailable returns an error when no retry may happen whatever the failure was,
+// including under a retry policy.
+func retryUnavailable(c *gin.Context, rawErr error) error {
 	if specificChannelId := c.GetInt(ctxkey.SpecificChannelId); specificChannelId != 0 {
 		return errors.Errorf(
 			"specific channel ID (%d) was provided, retry is unvailable",
@@ -319,18 +425,6 @@ func shouldRetry(c *gin.Context, statusCode int, rawErr error) error {
 			return errors.Wrap(rawErr, "do not retry: context cancelled or deadline exceeded")
 		}
 	}
-
-	// Do not retry on client-request errors except for rate limit (429), capacity (413), and auth (401/403)
-	// 404 should NOT retry, so it must not be excluded here.
-	if statusCode >= 400 &&
-		statusCode < 500 &&
-		statusCode != http.StatusTooManyRequests &&
-		statusCode != http.StatusRequestEntityTooLarge &&
-		statusCode != http.StatusUnauthorized &&
-		statusCode != http.StatusForbidden {
-		return errors.Errorf("client error %d, not retrying", statusCode)
-	}
-
 	return nil
 }
 
@@ -380,6 +474,46 @@ func classifyAuthLike(e *model.ErrorWithStatusCode) bool {
 	return false
 }
 
+// bindPromptCacheAffinity routes later requests with the same affinity key to the channel,
+// and the pooled key, that just served this one, renewing the binding.
+func bindPromptCacheAffinity(c *gin.Context) {
+	key := c.GetString(ctxkey.PromptCacheAffinityKey)
+	if key == "" {
+		return
+	}
+	if err := affinity.Bind(gmw.Ctx(c), key, c.GetInt(ctxkey.ChannelId), c.GetInt(ctxkey.ChannelKeyId)); err != nil {
+		gmw.GetLogger(c).Warn("bind prompt cache affinity failed", zap.Error(err))
+	}
+}
+
+// releasePromptCacheAffinity drops the binding to a channel that failed on its own account
+// (rate limit, upstream or credential errors), so the conversation falls back to regular
+// selection and rebinds to whichever channel serves it next.
+func releasePromptCacheAffinity(c *gin.Context, channelId int, bizErr *model.ErrorWithStatusCode) {
+	key := c.GetString(ctxkey.PromptCacheAffinityKey)
+	if key == "" {
+		return
+	}
+	switch {
+	case bizErr.StatusCode == http.StatusTooManyRequests,
+		bizErr.StatusCode >= http.StatusInternalServerError,
+		classifyAuthLike(bizErr):
+	default:
+		return
+	}
+	if err := affinity.Forget(gmw.Ctx(c), key, channelId); err != nil {
+		gmw.GetLogger(c).Warn("release prompt cache affinity failed", zap.Error(err))
+	}
+}
+
+// relayStatusCode returns the status code a relay attempt finished with.
+func relayStatusCode(bizErr *model.ErrorWithStatusCode) int {
+	if bizErr == nil {
+		return http.StatusOK
+	}
+	return bizErr.StatusCode
+}
+
 // Helper function to get channel IDs from failed channels map for debugging
 func getChannelIds(failedChannels map[int]bool) []int {
 	var ids []int
@@ -442,7 +576,7 @@ func logChannelSuspensionStatus(ctx context.Context, group, model string, failed
 	}
 }
 
-func processChannelRelayError(ctx context.Context, userId int, channelId int, channelName string, group string, originalModel string, err model.ErrorWithStatusCode) {
+func processChannelRelayError(ctx context.Context, userId int, channelId int, channelKeyId int, channelName string, group string, originalModel string, err model.ErrorWithStatusCode) {
 	// Always use a local logger variable
 	lg := gmw.GetLogger(ctx)
 
@@ -473,8 +607,13 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 			zap.Int("channel_id", channelId),
 			zap.String("channel_name", channelName),
 		)
-		// Still emit failure for monitoring purposes, but don't disable the channel
-		monitor.Emit(channelId, false)
+		// Nor feed the circuit breaker, which would stop routing the model to the channel
+		return
+	}
+
+	// Multi-key channels: rate limit and auth failures belong to the key, not the channel.
+	// Only fall through to channel-level handling once the whole pool is exhausted.
+	if channelKeyId != 0 && processChannelKeyRelayError(ctx, channelId, channelKeyId, channelName, err) {
 		return
 	}
 
@@ -495,20 +634,19 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 				zap.String("group", group),
 				zap.Error(errors.Wrap(suspendErr, "suspend ability failed")))
 		}
-		monitor.Emit(channelId, false)
+		monitor.Emit(channelId, originalModel, false)
 		return
 	}
 
 	// context cancel or deadline exceeded - likely user aborted or timeout.
-	// Detect via status or RawError classification; avoid suspending/disabling.
+	// Detect via status or RawError classification; avoid suspending/disabling or opening circuits.
 	if err.StatusCode == http.StatusRequestTimeout || (err.RawError != nil && (errors.Is(err.RawError, context.Canceled) || errors.Is(err.RawError, context.DeadlineExceeded))) {
-		monitor.Emit(channelId, false)
 		return
 	}
 
 	// 413 capacity issues: do not suspend; rely on retry selection to seek larger max_tokens
 	if err.StatusCode == http.StatusRequestEntityTooLarge {
-		monitor.Emit(channelId, false)
+		monitor.Emit(channelId, originalModel, false)
 		return
 	}
 
@@ -525,7 +663,7 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 			lg.Error("failed to suspend ability for 5xx", zap.Error(errors.Wrap(suspendErr, "suspend ability failed")))
 		}
 		// Do not immediately auto-disable; transient
-		monitor.Emit(channelId, false)
+		monitor.Emit(channelId, originalModel, false)
 		return
 	}
 
@@ -544,7 +682,7 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 		if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
 			monitor.DisableChannel(channelId, channelName, err.Message)
 		} else {
-			monitor.Emit(channelId, false)
+			monitor.Emit(channelId, originalModel, false)
 		}
 		return
 	}
@@ -553,8 +691,52 @@ func processChannelRelayError(ctx context.Context, userId int, channelId int, ch
 	if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
 		monitor.DisableChannel(channelId, channelName, err.Message)
 	} else {
-		monitor.Emit(channelId, false)
+		monitor.Emit(channelId, originalModel, false)
+	}
+}
+
+// processChannelKeyRelayError cools down or disables the pooled key that served the failed request.
+// It returns true when the error was fully handled at key level, i.e. the channel still has other
+// usable keys and its abilities should stay untouched.
+func processChannelKeyRelayError(ctx context.Context, channelId int, channelKeyId int, channelName string, err model.ErrorWithStatusCode) bool {
+	lg := gmw.GetLogger(ctx)
+
+	switch {
+	case err.StatusCode == http.StatusTooManyRequests:
+		lg.Info("suspending channel key due to rate limit",
+			zap.Int("channel_id", channelId),
+			zap.Int("channel_key_id", channelKeyId))
+		if suspendErr := dbmodel.SuspendChannelKey(ctx, channelKeyId, config.ChannelSuspendSecondsFor429); suspendErr != nil {
+			lg.Error("failed to suspend channel key", zap.Error(errors.Wrap(suspendErr, "suspend channel key failed")))
+		}
+	case err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusForbidden || classifyAuthLike(&err):
+		if monitor.ShouldDisableChannel(&err.Error, err.StatusCode) {
+			monitor.DisableChannelKey(channelId, channelName, channelKeyId, err.Message)
+		} else {
+			lg.Info("suspending channel key due to auth/permission issue",
+				zap.Int("channel_id", channelId),
+				zap.Int("channel_key_id", channelKeyId))
+			if suspendErr := dbmodel.SuspendChannelKey(ctx, channelKeyId, config.ChannelSuspendSecondsForAuth); suspendErr != nil {
+				lg.Error("failed to suspend channel key", zap.Error(errors.Wrap(suspendErr, "suspend channel key failed")))
+			}
+		}
+	default:
+		return false
+	}
+
+	available, countErr := dbmodel.CountAvailableChannelKeys(channelId)
+	if countErr != nil {
+		lg.Error("failed to count available channel keys", zap.Error(countErr))
+		return false
 	}
+	if available == 0 {
+		lg.Warn("all keys of channel are unavailable, falling back to channel-level handling",
+			zap.Int("channel_id", channelId))
+		return false
+	}
+
+	// the channel's other keys still serve it, so its circuits are left alone
+	return true
 }
 
 func RelayNotImplemented(c *gin.Context) {
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/retrypolicy"
+)
+
+// ServedModelHeader tells clients which model served the request, which differs from the
+// requested one once a retry policy fell back to another model.
+const ServedModelHeader = "X-Served-Model"
+
+// setServedModelHeader announces the model the next attempt is made with.
+func setServedModelHeader(c *gin.Context) {
+	if modelName := c.GetString(ctxkey.RequestModel); modelName != "" {
+		c.Header(ServedModelHeader, modelName)
+	}
+}
+
+// relayWithRetryPolicy retries a failed request as the matching retry policy describes and
+// writes the final error when every attempt failed. Attempts stay on the requested model
+// until its channels or its per-model budget are exhausted, then move down the fallback
+// chain; each retry waits for the policy's backoff, and none starts past its deadline.
+// excludedChannels are the channels that already failed the requested model.
+func relayWithRetryPolicy(c *gin.Context, policy *retrypolicy.Policy, relayMode int, responseCache *rcontroller.ResponseCache,
+	bizErr *model.ErrorWithStatusCode, excludedChannels map[int]bool, startTime time.Time, shouldDebugLog bool) {
+	ctx := gmw.Ctx(c)
+	lg := gmw.GetLogger(c)
+	userId := c.GetInt(ctxkey.Id)
+	group := c.GetString(ctxkey.Group)
+	requestedModel := c.GetString(ctxkey.RequestModel)
+	chain := fallbackChain(c, relayMode, requestedModel, policy.FallbackModels)
+	affinityKey := strconv.Itoa(userId)
+
+	var deadline time.Time
+	if policy.Deadline() > 0 {
+		deadline = startTime.Add(policy.Deadline())
+	}
+
+	// channels are excluded per model: a channel failing one model may still serve another
+	failedChannels := map[string]map[int]bool{requestedModel: excludedChannels}
+	triedChannels := len(excludedChannels)
+	current, modelAttempts := 0, 1
+
+	for attempt := 2; attempt <= policy.MaxAttempts; attempt++ {
+		if err := policyShouldRetry(c, policy, bizErr); err != nil {
+			lg.Info("retry policy won't retry", zap.Int("status_code", bizErr.StatusCode), zap.Error(err))
+			break
+		}
+		if policy.AttemptsPerModel > 0 && modelAttempts >= policy.AttemptsPerModel {
+			current, modelAttempts = current+1, 0
+		}
+
+		var channel *dbmodel.Channel
+		for ; current < len(chain); current, modelAttempts = current+1, 0 {
+			if failedChannels[chain[current]] == nil {
+				failedChannels[chain[current]] = make(map[int]bool)
+			}
+			var err error
+			if channel, err = selectRetryChannel(c, group, chain[current], failedChannels[chain[current]], bizErr.StatusCode, affinityKey); err == nil {
+				break
+			}
+			lg.Info("no channel left for model under retry policy",
+				zap.String("model", chain[current]),
+				zap.Ints("excluded_channels", getChannelIds(failedChannels[chain[current]])),
+				zap.Error(err))
+		}
+		if channel == nil {
+			break
+		}
+
+		delay := policy.Backoff.Delay(attempt - 1)
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			lg.Info("retry policy deadline reached, won't retry", zap.Int("attempt", attempt))
+			break
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+			}
+			if ctx.Err() != nil {
+				lg.Warn("relay aborted by client during retry backoff", zap.Error(ctx.Err()))
+				break
+			}
+		}
+
+		modelName := chain[current]
+		lg.Info("using channel to retry under retry policy",
+			zap.Int("channel_id", channel.Id),
+			zap.String("model", modelName),
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", policy.MaxAttempts))
+		if err := middleware.SetupContextForSelectedChannel(c, channel, modelName); err != nil {
+			lg.Warn("retry channel has no usable key, skipping it", zap.Int("channel_id", channel.Id), zap.Error(err))
+			failedChannels[modelName][channel.Id] = true
+			continue
+		}
+		if modelName != c.GetString(ctxkey.RequestModel) {
+			if err := switchRequestModel(c, requestedModel, modelName); err != nil {
+				lg.Warn("cannot fall back to model", zap.String("model", modelName), zap.Error(err))
+				break
+			}
+		}
+		setServedModelHeader(c)
+		requestBody, _ := common.GetRequestBody(c)
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
+		retryStartTime := time.Now()
+		retryMeta := meta.GetByContext(c)
+		responseCache.Reset()
+		retryDone := PrometheusMonitor.RecordChannelRequest(retryMeta, retryStartTime, true)
+		bizErr = relayHelper(c, relayMode)
+		retryDone(relayStatusCode(bizErr))
+		if bizErr == nil {
+			responseCache.Store(c)
+			bindPromptCacheAffinity(c)
+			PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, true, 0, 0, 0)
+			return
+		}
+		PrometheusMonitor.RecordRelayRequest(c, retryMeta, retryStartTime, false, 0, 0, 0)
+
+		channelId := c.GetInt(ctxkey.ChannelId)
+		releasePromptCacheAffinity(c, channelId, bizErr)
+		failedChannels[modelName][channelId] = true
+		triedChannels++
+		modelAttempts++
+		channelName := c.GetString(ctxkey.ChannelName)
+		channelKeyId := c.GetInt(ctxkey.ChannelKeyId)
+		failedErr := *bizErr
+		graceful.GoCritical(ctx, "processChannelRelayError", func(ctx context.Context) {
+			processChannelRelayError(ctx, userId, channelId, channelKeyId, channelName, group, modelName, failedErr)
+		})
+	}
+
+	renderRelayError(c, relayMode, bizErr, triedChannels, shouldDebugLog)
+}
+
+// policyShouldRetry returns nil if the policy retries the failure, otherwise returns error.
+// Policies without retry conditions keep the built-in classification of shouldRetry.
+func policyShouldRetry(c *gin.Context, policy *retrypolicy.Policy, bizErr *model.ErrorWithStatusCode) error {
+	if !policy.HasRetryConditions() {
+		return shouldRetry(c, bizErr.StatusCode, bizErr.RawError)
+	}
+	if err := retryUnavailable(c, bizErr.RawError); err != nil {
+		return err
+	}
+	if !policy.Retryable(bizErr.StatusCode, bizErr.Type, bizErr.Code) {
+		return errors.Errorf("status %d (%s) is not retried by the policy", bizErr.StatusCode, bizErr.Type)
+	}
+	return nil
+}
+
+// fallbackChain returns the models a policy may try, the requested one first. Fallback models
+// the token may not use are dropped, and so are all of them when the request cannot switch
+// model, i.e. it neither names the model in the path nor carries it in a JSON body.
+func fallbackChain(c *gin.Context, relayMode int, requestedModel string, fallbackModels []string) []string {
+	chain := []string{requestedModel}
+	if relayMode != relaymode.GeminiGenerateContent &&
+		!strings.HasPrefix(c.GetHeader("Content-Type"), "application/json") {
+		return chain
+	}
+	for _, modelName := range fallbackModels {
+		if slices.Contains(chain, modelName) || !middleware.TokenAllowsModel(c, modelName) {
+			continue
+		}
+		chain = append(chain, modelName)
+	}
+	return chain
+}
+
+// switchRequestModel points the request at a fallback model: the cached request body, the
+// request model and the relay meta all switch to it, and the meta remembers the requested
+// model for the consume log.
+func switchRequestModel(c *gin.Context, requestedModel, modelName string) error {
+	// the native Gemini API names the model in the path, which the relay reads from RequestModel
+	if relaymode.GetByPath(c.Request.URL.Path) != relaymode.GeminiGenerateContent {
+		requestBody, err := common.GetRequestBody(c)
+		if err != nil {
+			return errors.Wrap(err, "get request body")
+		}
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(requestBody, &fields); err != nil {
+			return errors.Wrap(err, "unmarshal request body")
+		}
+		if _, ok := fields["model"]; !ok {
+			return errors.New("request body does not name a model")
+		}
+		if fields["model"], err = json.Marshal(modelName); err != nil {
+			return errors.Wrap(err, "marshal model name")
+		}
+		if requestBody, err = json.Marshal(fields); err != nil {
+			return errors.Wrap(err, "marshal request body")
+		}
+		c.Set(ctxkey.KeyRequestBody, requestBody)
+	}
+
+	c.Set(ctxkey.RequestModel, modelName)
+	c.Set(ctxkey.FallbackFromModel, requestedModel)
+	relayMeta := meta.GetByContext(c)
+	relayMeta.OriginModelName = modelName
+	relayMeta.ActualModelName = meta.GetMappedModelName(modelName, relayMeta.ModelMapping)
+	relayMeta.FallbackFromModel = requestedModel
+	return nil
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/retrypolicy"
+)
+
+func newFallbackTestContext(t *testing.T, path, contentType, body string) *gin.Context {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestFallbackChain(t *testing.T) {
+	fallbacks := []string{"gpt-4.1", "claude-sonnet-4", "gemini-2.5-pro", "gpt-4.1"}
+
+	c := newFallbackTestContext(t, "/v1/chat/completions", "application/json", `{}`)
+	require.Equal(t, []string{"claude-sonnet-4", "gpt-4.1", "gemini-2.5-pro"},
+		fallbackChain(c, relaymode.ChatCompletions, "claude-sonnet-4", fallbacks))
+
+	// token model restrictions apply to fallback models too
+	c.Set(ctxkey.AvailableModels, "claude-sonnet-4,gemini-2.5-pro")
+	require.Equal(t, []string{"claude-sonnet-4", "gemini-2.5-pro"},
+		fallbackChain(c, relaymode.ChatCompletions, "claude-sonnet-4", fallbacks))
+
+	// multipart bodies cannot switch model
+	c = newFallbackTestContext(t, "/v1/audio/transcriptions", "multipart/form-data; boundary=x", "")
+	require.Equal(t, []string{"whisper-1"}, fallbackChain(c, relaymode.AudioTranscription, "whisper-1", fallbacks))
+}
+
+func TestSwitchRequestModel(t *testing.T) {
+	c := newFallbackTestContext(t, "/v1/chat/completions", "application/json",
+		`{"model":"claude-sonnet-4","messages":[{"role":"user","content":"hi"}]}`)
+	c.Set(ctxkey.RequestModel, "claude-sonnet-4")
+	c.Set(ctxkey.ModelMapping, map[string]string{"gpt-4.1": "gpt-4.1-2025-04-14"})
+	_ = meta.GetByContext(c)
+
+	require.NoError(t, switchRequestModel(c, "claude-sonnet-4", "gpt-4.1"))
+	body, err := common.GetRequestBody(c)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"model":"gpt-4.1","messages":[{"role":"user","content":"hi"}]}`, string(body))
+	require.Equal(t, "gpt-4.1", c.GetString(ctxkey.RequestModel))
+
+	relayMeta := meta.GetByContext(c)
+	require.Equal(t, "gpt-4.1", relayMeta.OriginModelName)
+	require.Equal(t, "gpt-4.1-2025-04-14", relayMeta.ActualModelName)
+	require.Equal(t, "claude-sonnet-4", relayMeta.FallbackFromModel)
+
+	c = newFallbackTestContext(t, "/v1/chat/completions", "application/json", `{"messages":[]}`)
+	require.Error(t, switchRequestModel(c, "claude-sonnet-4", "gpt-4.1"))
+}
+
+func TestPolicyShouldRetry(t *testing.T) {
+	c := newFallbackTestContext(t, "/v1/chat/completions", "application/json", `{}`)
+	conditional := &retrypolicy.Policy{MaxAttempts: 3, RetryOnStatus: []int{503}, RetryOnErrorTypes: []string{"overloaded_error"}}
+	builtin := &retrypolicy.Policy{MaxAttempts: 3}
+
+	unavailable := &model.ErrorWithStatusCode{StatusCode: http.StatusServiceUnavailable}
+	internal := &model.ErrorWithStatusCode{StatusCode: http.StatusInternalServerError}
+	overloaded := &model.ErrorWithStatusCode{StatusCode: http.StatusInternalServerError, Error: model.Error{Type: "overloaded_error"}}
+	notFound := &model.ErrorWithStatusCode{StatusCode: http.StatusNotFound}
+	canceled := &model.ErrorWithStatusCode{StatusCode: http.StatusServiceUnavailable, Error: model.Error{RawError: context.Canceled}}
+
+	require.NoError(t, policyShouldRetry(c, conditional, unavailable))
+	require.Error(t, policyShouldRetry(c, conditional, internal))
+	require.NoError(t, policyShouldRetry(c, conditional, overloaded))
+	require.Error(t, policyShouldRetry(c, conditional, canceled))
+
+	require.NoError(t, policyShouldRetry(c, builtin, internal))
+	require.Error(t, policyShouldRetry(c, builtin, notFound))
+
+	c.Set(ctxkey.SpecificChannelId, 7)
+	require.Error(t, policyShouldRetry(c, conditional, unavailable))
+}
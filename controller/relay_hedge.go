@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/middleware"
+	dbmodel "github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// hedgedRelayModes are the relay modes that can be hedged. Their helpers bill in the
+// background after returning, so billing can wait for the race to be decided.
+var hedgedRelayModes = map[int]bool{
+	relaymode.ChatCompletions: true,
+	relaymode.Completions:     true,
+	relaymode.Embeddings:      true,
+	relaymode.ResponseAPI:     true,
+	relaymode.ClaudeMessages:  true,
+}
+
+// matchHedgePolicy returns the hedge policy of the request, nil when it is not hedged. Only
+// non-streaming requests of the hedgeable modes that are not pinned to a channel are.
+func matchHedgePolicy(c *gin.Context, relayMode int) *hedge.Policy {
+	if !hedgedRelayModes[relayMode] || c.GetInt(ctxkey.SpecificChannelId) != 0 {
+		return nil
+	}
+	policy := hedge.Match(c.GetString(ctxkey.Group), c.GetString(ctxkey.RequestModel))
+	if policy == nil {
+		return nil
+	}
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	var streamRequest struct {
+		Stream bool `json:"stream"`
+	}
+	if json.Unmarshal(requestBody, &streamRequest) != nil || streamRequest.Stream {
+		return nil
+	}
+	return policy
+}
+
+// hedgeResult is the outcome of one attempt of a hedged request.
+type hedgeResult struct {
+	index  int
+	c      *gin.Context
+	writer *hedgeResponseWriter
+	bizErr *model.ErrorWithStatusCode
+}
+
+// relayHedged relays the request on its selected channel and, when that has not answered
+// within the policy's delay, on a second channel as well. Each attempt runs on its own copy
+// of the context and buffers its response. The first successful attempt is written to the
+// client and the other one cancelled; billing charges the user for the winner only.
+//
+// c ends up with the context of the attempt whose result is returned: the winner, or the
+// first channel when every attempt failed. The second return value lists the channels of
+// the other failed attempts, whose errors have already been processed.
+func relayHedged(c *gin.Context, policy *hedge.Policy, relayMode int) (*model.ErrorWithStatusCode, []int) {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+	group := c.GetString(ctxkey.Group)
+	modelName := c.GetString(ctxkey.RequestModel)
+	race := hedge.NewRace()
+	defer race.Decide(-1)
+
+	results := make(chan hedgeResult, 2)
+	var cancels []context.CancelFunc
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+	launch := func(index int, setup func(hc *gin.Context) error) error {
+		attemptCtx, cancel := context.WithCancel(c.Request.Context())
+		cancels = append(cancels, cancel)
+		hc := c.Copy()
+		// each attempt builds its own meta for the channel it runs on
+		delete(hc.Keys, ctxkey.Meta)
+		hc.Request = c.Request.Clone(attemptCtx)
+		writer := newHedgeResponseWriter()
+		hc.Writer = writer
+		if err := setup(hc); err != nil {
+			return err
+		}
+		attempt := race.Attempt(index)
+		hc.Set(ctxkey.HedgeAttempt, attempt)
+		requestBody, _ := common.GetRequestBody(hc)
+		hc.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+
+		graceful.GoCritical(ctx, "hedgedRelay", func(context.Context) {
+			bizErr := runHedgeAttempt(hc, relayMode)
+			results <- hedgeResult{index: index, c: hc, writer: writer, bizErr: bizErr}
+			if bizErr != nil && attempt.Lost(context.Background()) && attemptCtx.Err() != nil {
+				recordCancelledHedgeAttempt(hc, bizErr)
+			}
+		})
+		return nil
+	}
+
+	_ = launch(0, func(*gin.Context) error { return nil })
+	timer := time.NewTimer(hedge.Delay(policy, group, modelName))
+	defer timer.Stop()
+
+	var failures []hedgeResult
+	for running := 1; running > 0; {
+		select {
+		case <-timer.C:
+			excluded := map[int]bool{c.GetInt(ctxkey.ChannelId): true}
+			channel, err := selectRetryChannel(c, group, modelName, excluded, 0, strconv.Itoa(c.GetInt(ctxkey.Id)))
+			if err != nil {
+				lg.Info("no channel left to hedge on", zap.String("model", modelName), zap.Error(err))
+				continue
+			}
+			lg.Info("first channel is slow, hedging request",
+				zap.Int("channel_id", c.GetInt(ctxkey.ChannelId)),
+				zap.Int("hedge_channel_id", channel.Id),
+				zap.String("model", modelName))
+			err = launch(1, func(hc *gin.Context) error {
+				return middleware.SetupContextForSelectedChannel(hc, channel, modelName)
+			})
+			if err != nil {
+				lg.Info("hedge channel has no usable key", zap.Int("hedge_channel_id", channel.Id), zap.Error(err))
+				continue
+			}
+			running++
+		case result := <-results:
+			running--
+			if result.bizErr == nil {
+				race.Decide(result.index)
+				adoptHedgeResult(c, result)
+				return nil, processHedgeFailures(ctx, failures)
+			}
+			failures = append(failures, result)
+		}
+	}
+
+	// every attempt failed: report the first channel's error like an unhedged request
+	var first hedgeResult
+	var others []hedgeResult
+	for _, failure := range failures {
+		if failure.index == 0 {
+			first = failure
+		} else {
+			others = append(others, failure)
+		}
+	}
+	adoptHedgeResult(c, first)
+	return first.bizErr, processHedgeFailures(ctx, others)
+}
+
+// runHedgeAttempt runs the relay helper of one attempt. Attempts run outside the request's
+// handler chain, so a panic is turned into an error instead of escaping the recovery middleware.
+func runHedgeAttempt(hc *gin.Context, relayMode int) (bizErr *model.ErrorWithStatusCode) {
+	defer func() {
+		if r := recover(); r != nil {
+			bizErr = openai.ErrorWrapper(errors.Errorf("hedged relay panicked: %v", r), "hedged_relay_panic", http.StatusInternalServerError)
+		}
+	}()
+	return relayHelper(hc, relayMode)
+}
+
+// adoptHedgeResult moves the context of an attempt into c, and writes its response to the
+// client when it succeeded.
+func adoptHedgeResult(c *gin.Context, result hedgeResult) {
+	// the attempt's billing may still be running, copy its keys under their lock
+	for key, value := range result.c.Copy().Keys {
+		if key != ctxkey.HedgeAttempt {
+			c.Set(key, value)
+		}
+	}
+	if result.bizErr != nil {
+		return
+	}
+	header := c.Writer.Header()
+	for key, values := range result.writer.Header() {
+		header[key] = values
+	}
+	c.Writer.WriteHeader(result.writer.Status())
+	if _, err := c.Writer.Write(result.writer.body.Bytes()); err != nil {
+		gmw.GetLogger(c).Warn("write hedged response failed", zap.Error(err))
+	}
+}
+
+// processHedgeFailures handles the channel errors of failed attempts that are not reported
+// by the relay, and returns their channels.
+func processHedgeFailures(ctx context.Context, failures []hedgeResult) []int {
+	var channelIds []int
+	for _, failure := range failures {
+		hc, bizErr := failure.c, *failure.bizErr
+		channelId := hc.GetInt(ctxkey.ChannelId)
+		channelIds = append(channelIds, channelId)
+		userId := hc.GetInt(ctxkey.Id)
+		channelKeyId := hc.GetInt(ctxkey.ChannelKeyId)
+		channelName := hc.GetString(ctxkey.ChannelName)
+		group := hc.GetString(ctxkey.Group)
+		modelName := hc.GetString(ctxkey.RequestModel)
+		graceful.GoCritical(ctx, "processChannelRelayError", func(ctx context.Context) {
+			processChannelRelayError(ctx, userId, channelId, channelKeyId, channelName, group, modelName, bizErr)
+		})
+	}
+	return channelIds
+}
+
+// recordCancelledHedgeAttempt keeps a trace of an attempt cancelled because the other one won.
+// It never reached billing, so only its prompt tokens are known.
+func recordCancelledHedgeAttempt(hc *gin.Context, bizErr *model.ErrorWithStatusCode) {
+	relayMeta := meta.GetByContext(hc)
+	dbmodel.RecordHedgeLog(gmw.BackgroundCtx(hc), &dbmodel.Log{
+		UserId:       relayMeta.UserId,
+		ChannelId:    relayMeta.ChannelId,
+		ModelName:    relayMeta.OriginModelName,
+		TokenName:    relayMeta.TokenName,
+		PromptTokens: relayMeta.PromptTokens,
+		ElapsedTime:  helper.CalcElapsedTime(relayMeta.StartTime),
+		Content:      fmt.Sprintf("hedged attempt cancelled after the other channel answered: %s", bizErr.Message),
+		RequestId:    hc.GetString(ctxkey.RequestId),
+	}, "cancelled")
+}
+
+// hedgeResponseWriter buffers the response of a hedge attempt until the race is decided.
+type hedgeResponseWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+var _ gin.ResponseWriter = (*hedgeResponseWriter)(nil)
+
+func newHedgeResponseWriter() *hedgeResponseWriter {
+	return &hedgeResponseWriter{header: make(http.Header)}
+}
+
+func (w *hedgeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hedgeResponseWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.Write(data)
+}
+
+func (w *hedgeResponseWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	return w.body.WriteString(s)
+}
+
+func (w *hedgeResponseWriter) WriteHeader(code int) {
+	if code > 0 && w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeResponseWriter) WriteHeaderNow() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+}
+
+func (w *hedgeResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *hedgeResponseWriter) Size() int {
+	if w.status == 0 {
+		return -1
+	}
+	return w.body.Len()
+}
+
+func (w *hedgeResponseWriter) Written() bool {
+	return w.status != 0
+}
+
+func (w *hedgeResponseWriter) Flush() {}
+
+func (w *hedgeResponseWriter) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+func (w *hedgeResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hedged responses cannot be hijacked")
+}
+
+func (w *hedgeResponseWriter) Pusher() http.Pusher {
+	return nil
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestMatchHedgePolicy(t *testing.T) {
+	require.NoError(t, hedge.UpdatePoliciesByJSONString(`[{"groups":["fast"],"percentile":95,"max_delay_ms":1000}]`))
+	t.Cleanup(func() { require.NoError(t, hedge.UpdatePoliciesByJSONString("")) })
+
+	newContext := func(body string) *gin.Context {
+		c := newFallbackTestContext(t, "/v1/chat/completions", "application/json", body)
+		c.Set(ctxkey.Group, "fast")
+		c.Set(ctxkey.RequestModel, "gpt-4.1-mini")
+		return c
+	}
+
+	c := newContext(`{"model":"gpt-4.1-mini"}`)
+	require.NotNil(t, matchHedgePolicy(c, relaymode.ChatCompletions))
+	require.Nil(t, matchHedgePolicy(c, relaymode.ImagesGenerations), "only modes billed after the helper returns")
+
+	c = newContext(`{"model":"gpt-4.1-mini","stream":true}`)
+	require.Nil(t, matchHedgePolicy(c, relaymode.ChatCompletions), "streams are not hedged")
+
+	c = newContext(`{"model":"gpt-4.1-mini"}`)
+	c.Set(ctxkey.SpecificChannelId, 3)
+	require.Nil(t, matchHedgePolicy(c, relaymode.ChatCompletions))
+
+	c = newContext(`{"model":"gpt-4.1-mini"}`)
+	c.Set(ctxkey.Group, "default")
+	require.Nil(t, matchHedgePolicy(c, relaymode.ChatCompletions))
+}
+
+func TestAdoptHedgeResult(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	attempt := newFallbackTestContext(t, "/v1/chat/completions", "application/json", `{}`)
+	writer := newHedgeResponseWriter()
+	attempt.Writer = writer
+	attempt.Set(ctxkey.ChannelId, 7)
+	attempt.Set(ctxkey.HedgeAttempt, hedge.NewRace().Attempt(1))
+	attempt.Header("Content-Type", "application/json")
+	attempt.String(http.StatusCreated, `{"ok":true}`)
+	require.True(t, writer.Written())
+	require.Equal(t, http.StatusCreated, writer.Status())
+
+	adoptHedgeResult(c, hedgeResult{index: 1, c: attempt, writer: writer})
+	require.Equal(t, 7, c.GetInt(ctxkey.ChannelId))
+	_, hasAttempt := c.Get(ctxkey.HedgeAttempt)
+	require.False(t, hasAttempt)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, `{"ok":true}`, recorder.Body.String())
+	require.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,11 +16,12 @@ func RelayResponseGet(c *gin.Context) {
 	meta := metalib.GetByContext(c)
 	startTime := time.Now()
 
-	PrometheusMonitor.RecordChannelRequest(meta, startTime)
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
 
 	if bizErr := rcontroller.RelayResponseAPIGetHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
 		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
-		monitor.Emit(meta.ChannelId, false)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
 
 		requestId := c.GetString(helper.RequestIdKey)
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
@@ -27,7 +29,8 @@ func RelayResponseGet(c *gin.Context) {
 		return
 	}
 
-	monitor.Emit(meta.ChannelId, true)
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
 	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
 }
 
@@ -35,11 +38,12 @@ func RelayResponseDelete(c *gin.Context) {
 	meta := metalib.GetByContext(c)
 	startTime := time.Now()
 
-	PrometheusMonitor.RecordChannelRequest(meta, startTime)
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
 
 	if bizErr := rcontroller.RelayResponseAPIDeleteHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
 		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
-		monitor.Emit(meta.ChannelId, false)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
 
 		requestId := c.GetString(helper.RequestIdKey)
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
@@ -47,7 +51,30 @@ func RelayResponseDelete(c *gin.Context) {
 		return
 	}
 
-	monitor.Emit(meta.ChannelId, true)
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
+	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
+}
+
+func RelayResponseInputItems(c *gin.Context) {
+	meta := metalib.GetByContext(c)
+	startTime := time.Now()
+
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
+
+	if bizErr := rcontroller.RelayResponseAPIInputItemsHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
+		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
+
+		requestId := c.GetString(helper.RequestIdKey)
+		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
+		c.JSON(bizErr.StatusCode, gin.H{"error": bizErr.Error})
+		return
+	}
+
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
 	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
 }
 
@@ -55,11 +82,12 @@ func RelayResponseCancel(c *gin.Context) {
 	meta := metalib.GetByContext(c)
 	startTime := time.Now()
 
-	PrometheusMonitor.RecordChannelRequest(meta, startTime)
+	done := PrometheusMonitor.RecordChannelRequest(meta, startTime, false)
 
 	if bizErr := rcontroller.RelayResponseAPICancelHelper(c); bizErr != nil {
+		done(bizErr.StatusCode)
 		PrometheusMonitor.RecordRelayRequest(c, meta, startTime, false, 0, 0, 0)
-		monitor.Emit(meta.ChannelId, false)
+		monitor.Emit(meta.ChannelId, meta.OriginModelName, false)
 
 		requestId := c.GetString(helper.RequestIdKey)
 		bizErr.Error.Message = helper.MessageWithRequestId(bizErr.Error.Message, requestId)
@@ -67,6 +95,7 @@ func RelayResponseCancel(c *gin.Context) {
 		return
 	}
 
-	monitor.Emit(meta.ChannelId, true)
+	monitor.Emit(meta.ChannelId, meta.OriginModelName, true)
+	done(http.StatusOK)
 	PrometheusMonitor.RecordRelayRequest(c, meta, startTime, true, 0, 0, 0)
 }
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// GetSelfStatement returns the current user's usage statement for a month.
+//
+// Query parameters:
+//   - period: the month as YYYY-MM in UTC, default the current month.
+//   - token_id: restricts the statement to one token of the user.
+//   - format: json (default), csv or html.
+func GetSelfStatement(c *gin.Context) {
+	respondStatement(c, c.GetInt(ctxkey.Id))
+}
+
+// GetUserStatement returns a user's usage statement for admins, with the parameters of
+// GetSelfStatement.
+func GetUserStatement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	respondStatement(c, id)
+}
+
+func respondStatement(c *gin.Context, userId int) {
+	now := time.Now()
+	period := c.Query("period")
+	if period == "" {
+		period = now.UTC().Format(model.StatementPeriodLayout)
+	}
+
+	tokenId := 0
+	if raw := c.Query("token_id"); raw != "" {
+		var err error
+		if tokenId, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "invalid token_id",
+			})
+			return
+		}
+	}
+
+	statement, err := model.GetStatement(gmw.Ctx(c), userId, tokenId, period, now)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	switch format := c.DefaultQuery("format", "json"); format {
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "",
+			"data":    statement,
+		})
+		return
+	case "csv":
+		if err = writeStatementCSV(&buf, statement); err == nil {
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=statement-%d-%s.csv", userId, statement.Period))
+			c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+			return
+		}
+	case "html":
+		if err = writeStatementHTML(&buf, statement); err == nil {
+			c.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+			return
+		}
+	default:
+		err = errors.Errorf("unsupported statement format %q, expected json, csv or html", format)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+var statementCSVHeader = []string{
+	"model", "requests", "prompt_tokens", "completion_tokens", "cached_prompt_tokens",
+	"cached_completion_tokens", "price_per_million_tokens", "price_per_request", "quota", "amount",
+}
+
+// writeStatementCSV writes one row per line item and a final total row. Amounts are in the
+// statement's currency.
+func writeStatementCSV(w io.Writer, statement *model.Statement) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(statementCSVHeader); err != nil {
+		return errors.Wrap(err, "write statement csv header")
+	}
+	for _, item := range statement.Items {
+		err := writer.Write([]string{
+			item.ModelName,
+			strconv.FormatInt(item.RequestCount, 10),
+			strconv.FormatInt(item.PromptTokens, 10),
+			strconv.FormatInt(item.CompletionTokens, 10),
+			strconv.FormatInt(item.CachedPromptTokens, 10),
+			strconv.FormatInt(item.CachedCompletionTokens, 10),
+			formatStatementAmount(item.PricePerMillionTokens),
+			formatStatementAmount(item.PricePerRequest),
+			strconv.FormatInt(item.Quota, 10),
+			formatStatementAmount(item.Amount),
+		})
+		if err != nil {
+			return errors.Wrap(err, "write statement csv item")
+		}
+	}
+	err := writer.Write([]string{
+		"total",
+		strconv.FormatInt(statement.RequestCount, 10),
+		strconv.FormatInt(statement.PromptTokens, 10),
+		strconv.FormatInt(statement.CompletionTokens, 10),
+		strconv.FormatInt(statement.CachedPromptTokens, 10),
+		strconv.FormatInt(statement.CachedCompletionTokens, 10),
+		"",
+		"",
+		strconv.FormatInt(statement.Quota, 10),
+		formatStatementAmount(statement.Amount),
+	})
+	if err != nil {
+		return errors.Wrap(err, "write statement csv total")
+	}
+	writer.Flush()
+	return errors.Wrap(writer.Error(), "flush statement csv")
+}
+
+func formatStatementAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 6, 64)
+}
+
+// statementHTML renders a statement as a self-contained page, which browsers print to PDF.
+var statementHTML = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"amount": formatStatementAmount,
+	"date": func(ts int64) string {
+		return time.Unix(ts, 0).UTC().Format("2006-01-02")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.SystemName}} statement {{.Statement.Period}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+tfoot td { font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.SystemName}} usage statement</h1>
+<p>
+User: {{.Statement.Username}} (#{{.Statement.UserId}})<br>
+{{if .Statement.TokenName}}Token: {{.Statement.TokenName}}<br>{{end}}
+Period: {{date .Statement.PeriodStart}} to {{date .Statement.PeriodEnd}} (exclusive, UTC)<br>
+Status: {{if .Statement.Closed}}closed{{else}}open, figures may still change{{end}}
+</p>
+<table>
+<thead>
+<tr><th>Model</th><th>Requests</th><th>Prompt tokens</th><th>Completion tokens</th><th>Cached prompt tokens</th><th>Cached completion tokens</th><th>Price / 1M tokens</th><th>Price / request</th><th>Quota</th><th>Amount ({{.Statement.Currency}})</th></tr>
+</thead>
+<tbody>
+{{range .Statement.Items}}<tr><td>{{.ModelName}}</td><td>{{.RequestCount}}</td><td>{{.PromptTokens}}</td><td>{{.CompletionTokens}}</td><td>{{.CachedPromptTokens}}</td><td>{{.CachedCompletionTokens}}</td><td>{{amount .PricePerMillionTokens}}</td><td>{{amount .PricePerRequest}}</td><td>{{.Quota}}</td><td>{{amount .Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot>
+<tr><td>Total</td><td>{{.Statement.RequestCount}}</td><td>{{.Statement.PromptTokens}}</td><td>{{.Statement.CompletionTokens}}</td><td>{{.Statement.CachedPromptTokens}}</td><td>{{.Statement.CachedCompletionTokens}}</td><td></td><td></td><td>{{.Statement.Quota}}</td><td>{{amount .Statement.Amount}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
+
+func writeStatementHTML(w io.Writer, statement *model.Statement) error {
+	err := statementHTML.Execute(w, struct {
+		SystemName string
+		Statement  *model.Statement
+	}{config.SystemName, statement})
+	return errors.Wrap(err, "render statement html")
+}
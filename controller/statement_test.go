@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/model"
+)
+
+func testStatement() *model.Statement {
+	return &model.Statement{
+		UserId:       1,
+		Username:     "alice",
+		Period:       "2026-09",
+		Currency:     model.StatementCurrency,
+		RequestCount: 2,
+		PromptTokens: 1000,
+		Quota:        750_000,
+		Amount:       1.5,
+		Closed:       true,
+		Items: model.StatementItems{
+			{ModelName: "gpt-4o", RequestCount: 1, PromptTokens: 1000, Quota: 500_000, Amount: 1, PricePerMillionTokens: 1000, PricePerRequest: 1},
+			{ModelName: "<dall-e-3>", RequestCount: 1, Quota: 250_000, Amount: 0.5, PricePerRequest: 0.5},
+		},
+	}
+}
+
+func TestWriteStatementCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeStatementCSV(&buf, testStatement()))
+	require.Equal(t, "model,requests,prompt_tokens,completion_tokens,cached_prompt_tokens,cached_completion_tokens,price_per_million_tokens,price_per_request,quota,amount\n"+
+		"gpt-4o,1,1000,0,0,0,1000.000000,1.000000,500000,1.000000\n"+
+		"<dall-e-3>,1,0,0,0,0,0.000000,0.500000,250000,0.500000\n"+
+		"total,2,1000,0,0,0,,,750000,1.500000\n", buf.String())
+}
+
+func TestWriteStatementHTML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, writeStatementHTML(&buf, testStatement()))
+	page := buf.String()
+	require.Contains(t, page, "<td>gpt-4o</td>")
+	require.Contains(t, page, "&lt;dall-e-3&gt;", "model names must be escaped")
+	require.Contains(t, page, "<td>1.500000</td>")
+	require.Contains(t, page, "Status: closed")
+}
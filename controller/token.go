@@ -22,6 +22,7 @@ import (
 	"github.com/songquanpeng/one-api/common/network"
 	"github.com/songquanpeng/one-api/common/random"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/guardrail"
 )
 
 func GetRequestCost(c *gin.Context) {
@@ -160,7 +161,7 @@ func GetTokenStatus(c *gin.Context) {
 	})
 }
 
-func validateToken(_ *gin.Context, token *model.Token) error {
+func validateToken(c *gin.Context, token *model.Token) error {
 	if len(token.Name) > 30 {
 		return errors.Errorf("Token name is too long")
 	}
@@ -172,6 +173,36 @@ func validateToken(_ *gin.Context, token *model.Token) error {
 		}
 	}
 
+	if token.RateLimitRpm < 0 || token.RateLimitTpm < 0 {
+		return errors.New("rate limits cannot be negative")
+	}
+	if token.BudgetQuota < 0 {
+		return errors.New("budget cannot be negative")
+	}
+	if token.BudgetQuota > 0 {
+		if token.BudgetPeriod == "" {
+			token.BudgetPeriod = model.TokenBudgetPeriodDay
+		}
+		if !model.ValidTokenBudgetPeriod(token.BudgetPeriod) {
+			return errors.Errorf("invalid budget period %q, expected day, week or month", token.BudgetPeriod)
+		}
+	}
+
+	if token.OrganizationId < 0 {
+		return errors.New("invalid organization")
+	}
+	if token.OrganizationId > 0 {
+		if _, err := model.GetOrganizationMember(token.OrganizationId, c.GetInt(ctxkey.Id)); err != nil {
+			return errors.Errorf("you are not a member of organization %d", token.OrganizationId)
+		}
+	}
+
+	if token.Guardrails != nil {
+		if _, err := guardrail.ParseRules(*token.Guardrails); err != nil {
+			return errors.Wrap(err, "invalid guardrails")
+		}
+	}
+
 	return nil
 }
 
@@ -212,6 +243,12 @@ func AddToken(c *gin.Context) {
 		UnlimitedQuota: token.UnlimitedQuota,
 		Models:         token.Models,
 		Subnet:         token.Subnet,
+		RateLimitRpm:   token.RateLimitRpm,
+		RateLimitTpm:   token.RateLimitTpm,
+		BudgetQuota:    token.BudgetQuota,
+		BudgetPeriod:   token.BudgetPeriod,
+		OrganizationId: token.OrganizationId,
+		Guardrails:     token.Guardrails,
 	}
 	err = cleanToken.Insert(gmw.Ctx(c))
 	if err != nil {
@@ -393,6 +430,7 @@ func processPreConsume(ctx context.Context, _ *gin.Context, token *model.Token,
 	logEntry := &model.Log{
 		UserId:    userID,
 		ModelName: req.AddReason,
+		TokenId:   token.Id,
 		TokenName: token.Name,
 		Quota:     clampQuotaToInt(preQuota),
 		Content:   buildPreConsumeLogContent(req.AddReason, preQuota, transactionID, timeoutSeconds),
@@ -893,6 +931,12 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.UnlimitedQuota = token.UnlimitedQuota
 		cleanToken.Models = token.Models
 		cleanToken.Subnet = token.Subnet
+		cleanToken.RateLimitRpm = token.RateLimitRpm
+		cleanToken.RateLimitTpm = token.RateLimitTpm
+		cleanToken.BudgetQuota = token.BudgetQuota
+		cleanToken.BudgetPeriod = token.BudgetPeriod
+		cleanToken.OrganizationId = token.OrganizationId
+		cleanToken.Guardrails = token.Guardrails
 		cleanToken.RemainQuota = token.RemainQuota
 		cleanToken.Status = token.Status
 	}
@@ -695,7 +695,7 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"success": false, "message": "Display name cannot be empty"})
 		return
 	}
-	originUser, err := model.GetUserById(updatedUser.Id, false)
+	originUser, err := model.GetUserById(updatedUser.Id, true)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -732,6 +732,13 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(ctx, originUser.Id, model.LogTypeManage, fmt.Sprintf("Admin changed user quota from %s to %s", common.LogQuota(originUser.Quota), common.LogQuota(updatedUser.Quota)))
 	}
+	after, afterErr := model.GetUserById(updatedUser.Id, true)
+	if afterErr == nil && after.Quota != originUser.Quota {
+		if err := model.RecordQuotaAdjustment(ctx, originUser.Id, after.Quota-originUser.Quota); err != nil {
+			gmw.GetLogger(c).Error("failed to record quota adjustment on credit grants", zap.Error(err))
+		}
+	}
+	recordAudit(c, model.AuditActionUserUpdate, model.AuditTargetUser, updatedUser.Id, originUser, after)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -827,6 +834,7 @@ func DeleteUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionUserDelete, model.AuditTargetUser, id, originUser, nil)
 }
 
 func DeleteSelf(c *gin.Context) {
@@ -906,6 +914,7 @@ func CreateUser(c *gin.Context) {
 		})
 		return
 	}
+	recordAudit(c, model.AuditActionUserCreate, model.AuditTargetUser, cleanUser.Id, nil, &cleanUser)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -918,6 +927,15 @@ type ManageRequest struct {
 	Action   string `json:"action"`
 }
 
+// manageAuditActions maps the ManageUser actions to the audit log actions.
+var manageAuditActions = map[string]string{
+	"disable": model.AuditActionUserDisable,
+	"enable":  model.AuditActionUserEnable,
+	"delete":  model.AuditActionUserDelete,
+	"promote": model.AuditActionUserPromote,
+	"demote":  model.AuditActionUserDemote,
+}
+
 // ManageUser Only admin user can do this
 func ManageUser(c *gin.Context) {
 	var req ManageRequest
@@ -950,6 +968,7 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	before := user
 	switch req.Action {
 	case "disable":
 		user.Status = model.UserStatusDisabled
@@ -1018,6 +1037,11 @@ func ManageUser(c *gin.Context) {
 		})
 		return
 	}
+	auditAction, ok := manageAuditActions[req.Action]
+	if !ok {
+		auditAction = model.AuditActionUserUpdate
+	}
+	recordAudit(c, auditAction, model.AuditTargetUser, user.Id, &before, &user)
 	clearUser := model.User{
 		Role:   user.Role,
 		Status: user.Status,
@@ -1105,6 +1129,10 @@ type adminTopUpRequest struct {
 	UserId int    `json:"user_id"`
 	Quota  int    `json:"quota"`
 	Remark string `json:"remark"`
+	// Source, ExpiresAt and Priority describe the credit grant; the source defaults to "top_up".
+	Source    string `json:"source"`
+	ExpiresAt int64  `json:"expires_at"`
+	Priority  int    `json:"priority"`
 }
 
 func AdminTopUp(c *gin.Context) {
@@ -1118,7 +1146,24 @@ func AdminTopUp(c *gin.Context) {
 		})
 		return
 	}
-	err = model.IncreaseUserQuota(req.UserId, int64(req.Quota))
+	switch req.Source {
+	case "":
+		req.Source = model.CreditSourceTopUp
+	case model.CreditSourceTopUp, model.CreditSourcePromotion, model.CreditSourceAdmin:
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("unsupported credit source %q", req.Source),
+		})
+		return
+	}
+	err = model.GrantCredit(ctx, &model.CreditGrant{
+		UserId:    req.UserId,
+		Source:    req.Source,
+		Amount:    int64(req.Quota),
+		Priority:  req.Priority,
+		ExpiresAt: req.ExpiresAt,
+	})
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -1130,6 +1175,8 @@ func AdminTopUp(c *gin.Context) {
 		req.Remark = fmt.Sprintf("Recharged via API %s", common.LogQuota(int64(req.Quota)))
 	}
 	model.RecordTopupLog(ctx, req.UserId, req.Remark, req.Quota)
+	recordAudit(c, model.AuditActionUserTopUp, model.AuditTargetUser, req.UserId, nil,
+		gin.H{"quota": req.Quota, "remark": req.Remark, "source": req.Source, "expires_at": req.ExpiresAt, "priority": req.Priority})
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -1490,6 +1537,7 @@ func AdminDisableUserTotp(c *gin.Context) {
 	// Log the admin action
 	adminUserId := c.GetInt(ctxkey.Id)
 	model.RecordLog(ctx, user.Id, model.LogTypeManage, fmt.Sprintf("Admin (ID: %d) disabled TOTP for user %s", adminUserId, user.Username))
+	recordAudit(c, model.AuditActionUserTotpDisable, model.AuditTargetUser, user.Id, gin.H{"totp_secret": user.TotpSecret}, gin.H{"totp_secret": ""})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	rcontroller "github.com/songquanpeng/one-api/relay/controller"
+)
+
+const videoSettleBatchSize = 50
+
+var (
+	// RelayVideoCreate handles POST /v1/videos.
+	RelayVideoCreate = relayBatchEndpoint(rcontroller.RelayVideoCreateHelper)
+	// RelayVideoRetrieve handles GET /v1/videos/:id.
+	RelayVideoRetrieve = relayBatchEndpoint(rcontroller.RelayVideoRetrieveHelper)
+	// RelayVideoContent handles GET /v1/videos/:id/content.
+	RelayVideoContent = relayBatchEndpoint(rcontroller.RelayVideoContentHelper)
+)
+
+// StartVideoSettlement periodically polls unfinished video jobs, so their quota holds are
+// settled even when clients stop polling.
+func StartVideoSettlement(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	lg := logger.Logger.Named("video_settlement")
+	ctx = gmw.SetLogger(ctx, lg)
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				lg.Info("video settlement stopped")
+				return
+			case <-ticker.C:
+				settlePendingVideoJobs(ctx)
+			}
+		}
+	}()
+}
+
+func settlePendingVideoJobs(ctx context.Context) {
+	lg := gmw.GetLogger(ctx)
+	jobs, err := model.ListUnsettledVideoJobs(ctx, videoSettleBatchSize)
+	if err != nil {
+		lg.Error("failed to list unsettled video jobs", zap.Error(err))
+		return
+	}
+
+	for _, job := range jobs {
+		if err = rcontroller.SettleVideoJob(ctx, job); err != nil {
+			lg.Warn("failed to settle video job",
+				zap.String("video_id", job.VideoId),
+				zap.Int("channel_id", job.ChannelId),
+				zap.Error(err))
+		}
+	}
+}
@@ -25,9 +25,11 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/client"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/eventbus"
 	"github.com/songquanpeng/one-api/common/graceful"
 	"github.com/songquanpeng/one-api/common/i18n"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/logship"
 	"github.com/songquanpeng/one-api/controller"
 	"github.com/songquanpeng/one-api/middleware"
 	"github.com/songquanpeng/one-api/model"
@@ -67,6 +69,8 @@ func main() {
 	model.InitDB()
 	model.InitLogDB()
 	model.StartTraceRetentionCleaner(ctx, config.TraceRetentionDays)
+	model.StartAuditLogRetentionCleaner(ctx, config.AuditLogRetentionDays)
+	model.StartCreditGrantExpiry(ctx)
 
 	var err error
 	err = model.CreateRootAccountIfNeed()
@@ -100,15 +104,23 @@ func main() {
 		go model.SyncOptions(config.SyncFrequency)
 		go model.SyncChannelCache(config.SyncFrequency)
 	}
+	// changes made on other nodes are applied right away, the periodic syncs above catch
+	// whatever is missed
+	if err := eventbus.Start(ctx); err != nil {
+		logger.Logger.Error("failed to listen to invalidation events, relying on periodic sync", zap.Error(err))
+	}
 	if config.ChannelTestFrequency > 0 {
 		go controller.AutomaticallyTestChannels(config.ChannelTestFrequency)
 	}
+	controller.StartBatchSettlement(ctx, time.Duration(config.BatchSettlementInterval)*time.Second)
+	controller.StartVideoSettlement(ctx, time.Duration(config.VideoSettlementInterval)*time.Second)
 	if config.BatchUpdateEnabled {
 		logger.Logger.Info("batch update enabled with interval " + strconv.Itoa(config.BatchUpdateInterval) + "s")
 		model.InitBatchUpdater()
 	}
 	if config.EnableMetric {
-		logger.Logger.Info("metric enabled, will disable channel if too much request failed")
+		logger.Logger.Info("metric enabled, will stop routing a model to a channel if too much request failed")
+		monitor.StartCircuitBreaker(ctx, controller.ProbeChannelModel)
 	}
 
 	// Initialize Prometheus monitoring
@@ -133,6 +145,18 @@ func main() {
 	openai.InitTokenEncoders()
 	client.Init()
 
+	// forward consumption logs to external sinks; a broken configuration must not stop billing
+	if sinks, err := logship.ParseSinks(config.LogShipperSinks); err != nil {
+		logger.Logger.Error("invalid LOG_SHIPPER_SINKS, log shipping disabled", zap.Error(err))
+	} else if len(sinks) > 0 {
+		logship.Start(sinks, logship.Options{
+			BatchSize:     config.LogShipperBatchSize,
+			FlushInterval: time.Duration(config.LogShipperFlushInterval) * time.Second,
+			QueueSize:     config.LogShipperQueueSize,
+			MaxRetries:    config.LogShipperMaxRetries,
+		})
+	}
+
 	// Initialize global pricing manager
 	relay.InitializeGlobalPricing()
 
@@ -237,6 +261,11 @@ func main() {
 		logger.Logger.Error("graceful drain finished with timeout/error", zap.Error(err))
 	}
 
+	// Send the logs still queued for shipping
+	if err := logship.Stop(shutdownCtx); err != nil {
+		logger.Logger.Error("failed to flush log shippers", zap.Error(err))
+	}
+
 	// Close DB after all drains complete
 	if derr := model.CloseDB(); derr != nil {
 		logger.Logger.Error("failed to close database", zap.Error(derr))
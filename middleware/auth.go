@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v6"
@@ -169,6 +170,19 @@ func TokenAuth() func(c *gin.Context) {
 			return
 		}
 
+		// Tokens bound to an organization stop working while the organization is disabled
+		if token.OrganizationId > 0 {
+			orgEnabled, err := model.IsOrganizationEnabled(token.OrganizationId)
+			if err != nil {
+				AbortWithError(c, http.StatusInternalServerError, err)
+				return
+			}
+			if !orgEnabled {
+				AbortWithError(c, http.StatusForbidden, errors.New("The organization of this API key has been disabled"))
+				return
+			}
+		}
+
 		// Extract and validate the requested model (for AI/ML API endpoints)
 		requestModel, err := getRequestModel(c)
 		if err != nil && shouldCheckModel(c) {
@@ -192,6 +206,15 @@ func TokenAuth() func(c *gin.Context) {
 		c.Set(ctxkey.TokenName, token.Name)
 		c.Set(ctxkey.TokenQuota, token.RemainQuota)
 		c.Set(ctxkey.TokenQuotaUnlimited, token.UnlimitedQuota)
+		c.Set(ctxkey.TokenRateLimitRpm, token.RateLimitRpm)
+		c.Set(ctxkey.TokenRateLimitTpm, token.RateLimitTpm)
+		c.Set(ctxkey.TokenBudgetQuota, token.BudgetQuota)
+		c.Set(ctxkey.TokenBudgetPeriod, token.BudgetPeriod)
+		c.Set(ctxkey.TokenBudgetUsedQuota, token.BudgetSpent(time.Now()))
+		c.Set(ctxkey.OrganizationId, token.OrganizationId)
+		if token.Guardrails != nil {
+			c.Set(ctxkey.TokenGuardrails, *token.Guardrails)
+		}
 
 		// Handle channel-specific routing (admin feature)
 		// Format: token_key:channel_id allows admins to specify which channel to use
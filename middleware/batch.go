@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+// batchCreateRequest is the subset of a batch creation body needed for routing.
+// OpenAI/Azure batches reference an uploaded file, Anthropic batches carry their requests inline.
+type batchCreateRequest struct {
+	InputFileId string `json:"input_file_id"`
+	Requests    []struct {
+		Params struct {
+			Model string `json:"model"`
+		} `json:"params"`
+	} `json:"requests"`
+}
+
+// PinBatchResource routes Files and Batch API requests to the channel that owns the referenced
+// resource, because upstream file and batch ids are only valid on the provider that issued them.
+// It must run after TokenAuth and before Distribute.
+func PinBatchResource() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		ctx := gmw.Ctx(c)
+		userId := c.GetInt(ctxkey.Id)
+		path := c.Request.URL.Path
+
+		switch {
+		case strings.HasPrefix(path, "/v1/files/"):
+			file, err := model.GetUpstreamFileByUser(ctx, userId, c.Param("id"))
+			if err != nil {
+				AbortWithError(c, http.StatusNotFound, errors.Errorf("No such file: %s", c.Param("id")))
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, file.ChannelId)
+			c.Set(ctxkey.SpecificChannelKeyId, file.ChannelKeyId)
+		case strings.HasPrefix(path, "/v1/batches/"):
+			job, err := model.GetBatchJobByUser(ctx, userId, c.Param("id"))
+			if err != nil {
+				AbortWithError(c, http.StatusNotFound, errors.Errorf("No such batch: %s", c.Param("id")))
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, job.ChannelId)
+			c.Set(ctxkey.SpecificChannelKeyId, job.ChannelKeyId)
+		case path == "/v1/batches":
+			var req batchCreateRequest
+			if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+				AbortWithError(c, http.StatusBadRequest, errors.Wrap(err, "invalid batch request"))
+				return
+			}
+			switch {
+			case req.InputFileId != "":
+				file, err := model.GetUpstreamFileByUser(ctx, userId, req.InputFileId)
+				if err != nil {
+					AbortWithError(c, http.StatusNotFound, errors.Errorf("No such file: %s", req.InputFileId))
+					return
+				}
+				c.Set(ctxkey.SpecificChannelId, file.ChannelId)
+				c.Set(ctxkey.SpecificChannelKeyId, file.ChannelKeyId)
+			case len(req.Requests) > 0 && req.Requests[0].Params.Model != "":
+				requestModel := req.Requests[0].Params.Model
+				if models := c.GetString(ctxkey.AvailableModels); models != "" && !isModelInList(requestModel, models) {
+					AbortWithError(c, http.StatusForbidden, errors.Errorf("This API key does not have permission to use the model: %s", requestModel))
+					return
+				}
+				c.Set(ctxkey.RequestModel, requestModel)
+			default:
+				AbortWithError(c, http.StatusBadRequest, errors.New("batch request requires input_file_id or inline requests"))
+				return
+			}
+		case path == "/v1/files" && c.GetString(ctxkey.RequestModel) == "":
+			// uploads carry no model; pin them to any channel of the user's group able to run batches
+			group, err := model.CacheGetUserGroup(ctx, userId)
+			if err != nil {
+				AbortWithError(c, http.StatusInternalServerError, errors.Wrap(err, "get user group"))
+				return
+			}
+			channel, err := model.GetRandomChannelByGroupAndTypes(group, channeltype.BatchChannelTypes)
+			if err != nil {
+				AbortWithError(c, http.StatusServiceUnavailable, errors.Wrap(err, "no channel supports file uploads"))
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, channel.Id)
+		}
+
+		c.Next()
+	}
+}
@@ -7,7 +7,8 @@ import (
 )
 
 // RewriteClaudeMessagesPrefix returns a middleware that rewrites any request path
-// starting with the given prefix to the canonical Claude Messages endpoint: /v1/messages.
+// starting with the given prefix to the canonical Claude Messages endpoint: /v1/messages
+// (e.g. /v1/v1/messages/count_tokens becomes /v1/messages/count_tokens).
 // It then re-dispatches the request to the engine so the canonical route and its
 // middlewares handle it, and aborts the current handler chain.
 //
@@ -23,8 +24,9 @@ func RewriteClaudeMessagesPrefix(prefix string, engine *gin.Engine) gin.HandlerF
 		path := c.Request.URL.Path
 		// Only handle when the incoming path actually matches the prefix.
 		if strings.HasPrefix(path, normalized) {
-			// Rewrite the request path to the canonical endpoint.
-			c.Request.URL.Path = "/v1/messages"
+			// Rewrite the request path to the canonical endpoint, keeping sub-paths
+			// such as /count_tokens.
+			c.Request.URL.Path = "/v1/messages" + strings.TrimPrefix(path, normalized)
 			// Re-dispatch to let the canonical route handle the request.
 			engine.HandleContext(c)
 			// Stop further processing in the current chain.
@@ -14,6 +14,7 @@ func setupTestEngine() *gin.Engine {
 	// Canonical handler
 	v1 := r.Group("/v1")
 	v1.POST("/messages", func(c *gin.Context) { c.String(200, "ok") })
+	v1.POST("/messages/count_tokens", func(c *gin.Context) { c.String(200, "count") })
 	return r
 }
 
@@ -44,6 +45,21 @@ func TestRewriteClaudeMessagesPrefix(t *testing.T) {
 	}
 }
 
+func TestRewriteClaudeMessagesPrefixKeepsSubPath(t *testing.T) {
+	engine := setupTestEngine()
+	engine.Use(RewriteClaudeMessagesPrefix("/v1/v1/messages", engine))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/v1/messages/count_tokens", nil)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if body := w.Body.String(); body != "count" {
+		t.Fatalf("expected body 'count', got %q", body)
+	}
+}
+
 func TestRewriteNonMatchingPassThrough(t *testing.T) {
 	engine := setupTestEngine()
 	engine.Use(RewriteClaudeMessagesPrefix("/v1/v1/messages", engine))
@@ -3,7 +3,9 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Laisky/errors/v2"
 	gmw "github.com/Laisky/gin-middlewares/v6"
@@ -11,10 +13,15 @@ import (
 	"github.com/Laisky/zap"
 	"github.com/gin-gonic/gin"
 
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/affinity"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type ModelRequest struct {
@@ -48,11 +55,17 @@ func Distribute() func(c *gin.Context) {
 					errors.Errorf("Channel #%d does not support the requested model: %s", channelId, requestModel))
 				return
 			}
+			if err := SetupContextForSelectedChannel(c, channel, requestModel); err != nil {
+				AbortWithError(c, http.StatusServiceUnavailable, err)
+				return
+			}
 		} else {
 			requestModel = c.GetString(ctxkey.RequestModel)
+			// the user id pins each user to one channel under the consistent_hash strategy
+			affinityKey := strconv.Itoa(userId)
 			selectChannel := func(ignoreFirstPriority bool, exclude map[int]bool) (*model.Channel, error) {
 				for {
-					candidate, err := model.CacheGetRandomSatisfiedChannelExcluding(userGroup, requestModel, ignoreFirstPriority, exclude, false)
+					candidate, err := model.CacheSelectChannelExcluding(userGroup, requestModel, ignoreFirstPriority, exclude, false, affinityKey)
 					if err != nil {
 						return nil, errors.Wrap(err, "select channel from cache")
 					}
@@ -69,24 +82,45 @@ func Distribute() func(c *gin.Context) {
 
 			exclude := make(map[int]bool)
 			var err error
-			channel, err = selectChannel(false, exclude)
-			if err != nil {
-				lg.Info(fmt.Sprintf("No highest priority channels available for model %s in group %s, trying lower priority channels", requestModel, userGroup))
-				channel, err = selectChannel(true, exclude)
+			if channel = selectPromptCacheAffinityChannel(c, userId, userGroup, requestModel); channel == nil {
+				channel, err = selectChannel(false, exclude)
+			}
+			for {
 				if err != nil {
-					message := fmt.Sprintf("No available channels for Model %s under Group %s", requestModel, userGroup)
-					AbortWithError(c, http.StatusServiceUnavailable, errors.New(message))
-					return
+					lg.Info(fmt.Sprintf("No highest priority channels available for model %s in group %s, trying lower priority channels", requestModel, userGroup))
+					channel, err = selectChannel(true, exclude)
+					if err != nil {
+						message := fmt.Sprintf("No available channels for Model %s under Group %s", requestModel, userGroup)
+						AbortWithError(c, http.StatusServiceUnavailable, errors.New(message))
+						return
+					}
+				}
+				// a pooled channel whose keys are all disabled or cooling down cannot serve
+				setupErr := SetupContextForSelectedChannel(c, channel, requestModel)
+				if setupErr == nil {
+					break
 				}
+				lg.Warn("channel has no usable key, selecting another",
+					zap.Int("channel_id", channel.Id),
+					zap.Error(setupErr))
+				exclude[channel.Id] = true
+				channel, err = selectChannel(false, exclude)
 			}
 		}
 		lg.Debug(fmt.Sprintf("user id %d, user group: %s, request model: %s, using channel #%d", userId, userGroup, requestModel, channel.Id))
-		SetupContextForSelectedChannel(c, channel, requestModel)
 		c.Next()
 	}
 }
 
-func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) {
+// SetupContextForSelectedChannel stores the selected channel and its credential in the
+// context. It fails when the channel has no usable key, so callers can move on to another
+// channel.
+func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, modelName string) error {
+	key, err := selectChannelKey(c, channel)
+	if err != nil {
+		return err
+	}
+
 	lg := gmw.GetLogger(c)
 	// one channel could relates to multiple groups,
 	// and each groud has individual ratio,
@@ -98,6 +132,13 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 			minimalRatio = v
 		}
 	}
+	// a matching pricing rule takes over the group ratio; the rule is reset on every
+	// selection so that a retry with another model does not keep a stale one
+	rule := pricingrule.Match(c.GetString(ctxkey.Group), modelName, time.Now())
+	if rule != nil && rule.GroupRatio != nil {
+		minimalRatio = *rule.GroupRatio
+	}
+	c.Set(ctxkey.PricingRule, rule)
 	lg.Info(fmt.Sprintf("set channel %s ratio to %f", channel.Name, minimalRatio))
 	c.Set(ctxkey.ChannelRatio, minimalRatio)
 	c.Set(ctxkey.ChannelModel, channel)
@@ -115,7 +156,7 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		c.Set(ctxkey.SystemPrompt, *channel.SystemPrompt)
 	}
 	c.Set(ctxkey.ModelMapping, channel.GetModelMapping())
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 	c.Set(ctxkey.BaseURL, channel.GetBaseURL())
 	if channel.RateLimit != nil {
 		c.Set(ctxkey.RateLimit, *channel.RateLimit)
@@ -150,4 +191,69 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 		}
 	}
 	c.Set(ctxkey.Config, cfg)
+	return nil
+}
+
+// selectChannelKey returns the credential to use for this request.
+// For multi-key channels it picks one key from the pool, or the pinned SpecificChannelKeyId,
+// preferring the key of a prompt-cache affinity binding while it is available, and records
+// its id in the context, so relay error handling can cool down or disable that key alone.
+// It fails when every pooled key is disabled or cooling down, rather than sending a revoked key.
+func selectChannelKey(c *gin.Context, channel *model.Channel) (string, error) {
+	c.Set(ctxkey.ChannelKeyId, 0)
+	if !channel.IsMultiKey() {
+		return channel.Key, nil
+	}
+
+	if keyId := c.GetInt(ctxkey.SpecificChannelKeyId); keyId != 0 {
+		if key, err := model.GetChannelKeyById(keyId); err == nil && key.ChannelId == channel.Id {
+			c.Set(ctxkey.ChannelKeyId, key.Id)
+			return key.Key, nil
+		}
+	}
+
+	key, err := model.SelectPreferredChannelKey(channel, c.GetInt(ctxkey.PromptCacheAffinityKeyId))
+	if err != nil {
+		return "", errors.Wrapf(err, "no usable key for channel %d", channel.Id)
+	}
+
+	c.Set(ctxkey.ChannelKeyId, key.Id)
+	return key.Key, nil
+}
+
+// selectPromptCacheAffinityChannel returns the channel that last served the same session,
+// prompt_cache_key, cacheable prefix or end user, so the upstream prompt cache keeps hitting.
+// It returns nil when affinity does not apply, the key is unbound, or the bound channel no
+// longer serves the model, leaving the regular selection to pick a channel.
+func selectPromptCacheAffinityChannel(c *gin.Context, userId int, group string, requestModel string) *model.Channel {
+	if !config.PromptCacheAffinityEnabled || !affinity.Supports(relaymode.GetByPath(c.Request.URL.Path)) {
+		return nil
+	}
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil
+	}
+	key, source := affinity.Key(c.Request.Header, body, userId, group, requestModel)
+	if key == "" {
+		return nil
+	}
+	c.Set(ctxkey.PromptCacheAffinityKey, key)
+	c.Set(ctxkey.PromptCacheAffinitySource, source)
+
+	ctx := gmw.Ctx(c)
+	channelId, keyId := affinity.Lookup(ctx, key)
+	if channelId == 0 {
+		return nil
+	}
+	channel, err := model.CacheGetSatisfiedChannelById(group, requestModel, channelId)
+	if err != nil {
+		gmw.GetLogger(c).Debug("prompt cache affinity channel unavailable, reselecting",
+			zap.Int("channel_id", channelId),
+			zap.Error(err))
+		_ = affinity.Forget(ctx, key, channelId)
+		return nil
+	}
+	c.Set(ctxkey.PromptCacheAffinityChannelId, channelId)
+	c.Set(ctxkey.PromptCacheAffinityKeyId, keyId)
+	return channel
 }
@@ -156,7 +156,7 @@ func setupDistributorTestDB(t *testing.T) (*gorm.DB, func()) {
 	t.Helper()
 	testDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
-	require.NoError(t, testDB.AutoMigrate(&model.User{}, &model.Channel{}, &model.Ability{}))
+	require.NoError(t, testDB.AutoMigrate(&model.User{}, &model.Channel{}, &model.Ability{}, &model.ChannelKey{}))
 
 	originalDB := model.DB
 	originalUsingSQLite := common.UsingSQLite.Load()
@@ -327,3 +327,53 @@ func TestDistributeAutoSkipsUnsupportedChannel(t *testing.T) {
 	selectedChannelId := c.GetInt(ctxkey.ChannelId)
 	assert.Equal(t, goodChannel.Id, selectedChannelId, "should select the channel that still supports the model")
 }
+
+func TestDistributeRejectsChannelWithoutUsableKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, cleanup := setupDistributorTestDB(t)
+	defer cleanup()
+
+	user := &model.User{
+		Id:       50,
+		Username: "pool-user",
+		Password: "hashed",
+		Group:    "default",
+		Status:   model.UserStatusEnabled,
+	}
+	require.NoError(t, db.Create(user).Error)
+
+	channel := &model.Channel{
+		Id:      60,
+		Name:    "pool",
+		Type:    channeltype.OpenAI,
+		Key:     "sk-a\nsk-b",
+		KeyMode: model.ChannelKeyModeRoundRobin,
+		Models:  "gpt-4",
+		Group:   "default",
+		Status:  model.ChannelStatusEnabled,
+	}
+	require.NoError(t, db.Create(channel).Error)
+	require.NoError(t, channel.SyncKeys())
+	keys, err := model.GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	for _, key := range keys {
+		require.NoError(t, model.UpdateChannelKeyStatus(key.Id, model.ChannelKeyStatusAutoDisabled, "invalid key"))
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewBufferString(`{"model":"gpt-4"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+
+	c.Set(ctxkey.Id, user.Id)
+	c.Set(ctxkey.RequestModel, "gpt-4")
+	c.Set(ctxkey.SpecificChannelId, channel.Id)
+	gmw.SetLogger(c, logger.Logger)
+
+	Distribute()(c)
+
+	assert.True(t, c.IsAborted(), "a disabled key must not be sent upstream")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.NotContains(t, c.Request.Header.Get("Authorization"), "sk-a")
+}
@@ -37,6 +37,12 @@ func redisRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark st
 		}
 		hashedToken := sha256.Sum256([]byte(GetTokenKeyParts(c)[0]))
 		key = fmt.Sprintf("rateLimit:%s:%s:%d", mark, hex.EncodeToString(hashedToken[:8]), c.GetInt(ctxkey.ChannelId))
+	case "TR":
+		maxRequestNum = c.GetInt(ctxkey.TokenRateLimitRpm)
+		if maxRequestNum <= 0 {
+			return
+		}
+		key = fmt.Sprintf("rateLimit:%s:%d", mark, c.GetInt(ctxkey.TokenId))
 	}
 
 	rdb := common.RDB
@@ -96,6 +102,12 @@ func memoryRateLimiter(c *gin.Context, maxRequestNum int, duration int64, mark s
 		}
 		hashedToken := sha256.Sum256([]byte(GetTokenKeyParts(c)[0]))
 		key = fmt.Sprintf("rateLimit:%s:%s:%d", mark, hex.EncodeToString(hashedToken[:8]), c.GetInt(ctxkey.ChannelId))
+	case "TR":
+		maxRequestNum = c.GetInt(ctxkey.TokenRateLimitRpm)
+		if maxRequestNum <= 0 {
+			return
+		}
+		key = fmt.Sprintf("rateLimit:%s:%d", mark, c.GetInt(ctxkey.TokenId))
 	}
 
 	if !inMemoryRateLimiter.Request(key, maxRequestNum, duration) {
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// TokenRateLimit enforces the limits configured on the API key itself: the rolling spend
+// budget, requests per minute and tokens per minute. It must run after TokenAuth.
+//
+// Several team members usually share one user account with separate keys, so these limits
+// stop a single runaway key from draining the whole account.
+func TokenRateLimit() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if err := checkTokenBudget(c, time.Now()); err != nil {
+			AbortWithError(c, http.StatusTooManyRequests, err)
+			return
+		}
+		if config.DebugEnabled {
+			return
+		}
+
+		if common.IsRedisEnabled() {
+			redisRateLimiter(c, 0, 60, "TR")
+		} else {
+			inMemoryRateLimiter.Init(config.RateLimitKeyExpirationDuration)
+			memoryRateLimiter(c, 0, 60, "TR")
+		}
+		if c.IsAborted() {
+			return
+		}
+
+		if err := checkTokenTpm(c); err != nil {
+			AbortWithError(c, http.StatusTooManyRequests, err)
+			return
+		}
+	}
+}
+
+// checkTokenBudget rejects the request once the key has spent its budget for the current window.
+func checkTokenBudget(c *gin.Context, now time.Time) error {
+	budget := c.GetInt64(ctxkey.TokenBudgetQuota)
+	if budget <= 0 {
+		return nil
+	}
+	used := c.GetInt64(ctxkey.TokenBudgetUsedQuota)
+	if used < budget {
+		return nil
+	}
+
+	period := c.GetString(ctxkey.TokenBudgetPeriod)
+	_, resetAt := model.TokenBudgetWindow(period, now)
+	return errors.Errorf("API key %s has used its %s budget of %s (spent %s), the budget resets at %s",
+		c.GetString(ctxkey.TokenName), tokenBudgetPeriodName(period),
+		common.LogQuota(budget), common.LogQuota(used), resetAt.Format(time.RFC3339))
+}
+
+// checkTokenTpm rejects the request when the key already consumed its tokens for this minute.
+func checkTokenTpm(c *gin.Context) error {
+	limit := c.GetInt(ctxkey.TokenRateLimitTpm)
+	if limit <= 0 {
+		return nil
+	}
+	used, err := model.GetTokenMinuteUsage(gmw.Ctx(c), c.GetInt(ctxkey.TokenId))
+	if err != nil {
+		// fail open: a limiter outage must not take the relay down
+		gmw.GetLogger(c).Warn("token tpm check failed, allowing request", zap.Error(err))
+		return nil
+	}
+	if used >= int64(limit) {
+		return errors.Errorf("API key %s exceeded its limit of %d tokens per minute, please retry later",
+			c.GetString(ctxkey.TokenName), limit)
+	}
+	return nil
+}
+
+func tokenBudgetPeriodName(period string) string {
+	switch period {
+	case model.TokenBudgetPeriodWeek:
+		return "weekly"
+	case model.TokenBudgetPeriodMonth:
+		return "monthly"
+	default:
+		return "daily"
+	}
+}
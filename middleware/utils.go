@@ -11,7 +11,9 @@ import (
 
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 // AbortWithError aborts the request with an error message
@@ -54,6 +56,10 @@ func getRequestModel(c *gin.Context) (string, error) {
 		}
 		return m, nil
 	}
+	// native Gemini API carries the model in the path: /v1beta/models/{model}:{action}
+	if m, _, ok := relaymode.ParseGeminiModelAction(c.Request.URL.Path); ok {
+		return m, nil
+	}
 
 	var modelRequest ModelRequest
 	err := common.UnmarshalBodyReusable(c, &modelRequest)
@@ -90,6 +96,13 @@ func isModelInList(modelName string, models string) bool {
 	return slices.Contains(modelList, modelName)
 }
 
+// TokenAllowsModel reports whether the request's token may use modelName, which is always
+// the case for tokens without model restrictions.
+func TokenAllowsModel(c *gin.Context, modelName string) bool {
+	models := c.GetString(ctxkey.AvailableModels)
+	return models == "" || isModelInList(modelName, models)
+}
+
 // GetTokenKeyParts extracts the token key parts from the Authorization header
 //
 // key like `sk-{token}[-{channelid}]`
@@ -99,6 +112,13 @@ func GetTokenKeyParts(c *gin.Context) []string {
 		// compatible with Anthropic
 		key = c.Request.Header.Get("X-Api-Key")
 	}
+	if key == "" && strings.HasPrefix(c.Request.URL.Path, relaymode.GeminiModelsPathPrefix) {
+		// compatible with Google GenAI SDKs, which send the key in x-goog-api-key or ?key=
+		key = c.Request.Header.Get("X-Goog-Api-Key")
+		if key == "" {
+			key = c.Query("key")
+		}
+	}
 
 	key = strings.TrimPrefix(key, "Bearer ")
 	// Trim current configured prefix first
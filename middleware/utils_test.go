@@ -42,3 +42,24 @@ func TestGetTokenKeyParts_LegacyPrefix(t *testing.T) {
 		t.Fatalf("unexpected parts for legacy: %#v", parts)
 	}
 }
+
+func TestGetTokenKeyParts_GeminiKey(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1beta/models/gemini-2.5-pro:generateContent?key=sk-abc", nil)
+	if parts := GetTokenKeyParts(c); parts[0] != "abc" {
+		t.Fatalf("unexpected parts for query key: %#v", parts)
+	}
+
+	c.Request = httptest.NewRequest("POST", "/v1beta/models/gemini-2.5-pro:generateContent", nil)
+	c.Request.Header.Set("X-Goog-Api-Key", "sk-def")
+	if parts := GetTokenKeyParts(c); parts[0] != "def" {
+		t.Fatalf("unexpected parts for x-goog-api-key: %#v", parts)
+	}
+
+	// the query key is only honored on the Gemini surface
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions?key=sk-abc", nil)
+	if parts := GetTokenKeyParts(c); parts[0] != "" {
+		t.Fatalf("unexpected parts outside gemini routes: %#v", parts)
+	}
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+)
+
+// PinVideoJob routes requests on an existing video job to the channel that generates it,
+// because upstream job ids are only valid on the provider that issued them.
+// It must run after TokenAuth and before Distribute.
+func PinVideoJob() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/v1/videos/") {
+			job, err := model.GetVideoJobByUser(gmw.Ctx(c), c.GetInt(ctxkey.Id), c.Param("id"))
+			if err != nil {
+				AbortWithError(c, http.StatusNotFound, errors.Errorf("No such video: %s", c.Param("id")))
+				return
+			}
+			c.Set(ctxkey.SpecificChannelId, job.ChannelId)
+			c.Set(ctxkey.RequestModel, job.OriginModel)
+		}
+
+		c.Next()
+	}
+}
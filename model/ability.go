@@ -186,13 +186,25 @@ func SuspendAbility(ctx context.Context, group string, modelName string, channel
 		channelCol = `"channel_id"`
 	}
 
-	return DB.Model(&Ability{}).
+	err := DB.Model(&Ability{}).
 		Where(groupCol+" = ? AND "+modelCol+" = ? AND "+channelCol+" = ?",
 			group, modelName, channelId).
 		Update("suspend_until", suspendTime).Error
+	if err != nil {
+		return err
+	}
+	publishAbilitySuspension(ctx, group, modelName, channelId, suspendTime)
+	return nil
 }
 
 func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool) (*Channel, error) {
+	return GetSatisfiedChannelExcluding(group, model, ignoreFirstPriority, excludeChannelIds, "")
+}
+
+// GetSatisfiedChannelExcluding selects a channel from the database using the selection
+// strategy configured for the group and model. affinityKey identifies the caller for the
+// consistent_hash strategy.
+func GetSatisfiedChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool, affinityKey string) (*Channel, error) {
 	if DB == nil {
 		return nil, errors.New("database not initialized")
 	}
@@ -205,7 +217,10 @@ func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstP
 	}
 	now := time.Now()
 
-	var err error = nil
+	excludeChannelIds, err := excludeUnavailableChannels(group, model, excludeChannelIds)
+	if err != nil {
+		return nil, err
+	}
 	var channelQuery *gorm.DB
 
 	// Build base query with exclusions
@@ -282,6 +297,10 @@ func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstP
 		}
 	}
 
+	if strategy := GetChannelSelectionStrategy(group, model); strategy != ChannelSelectionRandom {
+		return pickSatisfiedChannelFromQuery(channelQuery, strategy, model, affinityKey)
+	}
+
 	if common.UsingSQLite.Load() || common.UsingPostgreSQL.Load() {
 		err = channelQuery.Order("RANDOM()").First(&ability).Error
 	} else {
@@ -302,3 +321,110 @@ func GetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstP
 	}
 	return &channel, nil
 }
+
+// excludeUnavailableChannels returns excludeChannelIds extended with the channels serving
+// group and model that fail the availability check, such as an open circuit breaker, so
+// that database selection skips them like the memory cache does. The caller's map is not
+// modified.
+func excludeUnavailableChannels(group string, model string, excludeChannelIds map[int]bool) (map[int]bool, error) {
+	if channelAvailable == nil || model == "" {
+		return excludeChannelIds, nil
+	}
+	groupCol := "`group`"
+	if common.UsingPostgreSQL.Load() {
+		groupCol = `"group"`
+	}
+	var channelIds []int
+	if err := DB.Model(&Ability{}).Where(groupCol+" = ? AND model = ?", group, model).
+		Distinct("channel_id").Pluck("channel_id", &channelIds).Error; err != nil {
+		return nil, errors.Wrap(err, "list channels for availability check")
+	}
+
+	var excluded map[int]bool
+	for _, channelId := range channelIds {
+		if excludeChannelIds[channelId] || isChannelAvailable(channelId, model) {
+			continue
+		}
+		if excluded == nil {
+			excluded = make(map[int]bool, len(excludeChannelIds)+1)
+			for id := range excludeChannelIds {
+				excluded[id] = true
+			}
+		}
+		excluded[channelId] = true
+	}
+	if excluded == nil {
+		return excludeChannelIds, nil
+	}
+	return excluded, nil
+}
+
+// GetSatisfiedChannelById returns the channel if its ability for the group and model is
+// enabled and not suspended, the channel passes the availability check, and it lists the model.
+func GetSatisfiedChannelById(group string, model string, channelId int) (*Channel, error) {
+	if DB == nil {
+		return nil, errors.New("database not initialized")
+	}
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL.Load() {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+
+	var count int64
+	err := DB.Model(&Ability{}).
+		Where(groupCol+" = ? AND model = ? AND channel_id = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)",
+			group, model, channelId, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "check channel ability")
+	}
+	if count == 0 {
+		return nil, errors.Errorf("channel #%d does not serve model %s in group %s", channelId, model, group)
+	}
+	if !isChannelAvailable(channelId, model) {
+		return nil, errors.Errorf("channel #%d is unavailable for model %s", channelId, model)
+	}
+
+	channel := Channel{}
+	if err = DB.First(&channel, "id = ?", channelId).Error; err != nil {
+		return nil, errors.Wrapf(err, "load channel %d", channelId)
+	}
+	if !channel.SupportsModel(model) {
+		return nil, errors.Errorf("channel #%d does not list support for model %s", channel.Id, model)
+	}
+	return &channel, nil
+}
+
+// pickSatisfiedChannelFromQuery loads every channel matched by the ability query and picks
+// one of them with the given strategy. Strategies other than random need the whole tier to
+// compare, so they cannot be pushed down into an ORDER BY.
+func pickSatisfiedChannelFromQuery(abilityQuery *gorm.DB, strategy string, model string, affinityKey string) (*Channel, error) {
+	var abilities []Ability
+	if err := abilityQuery.Find(&abilities).Error; err != nil {
+		return nil, errors.Wrap(err, "get satisfied abilities")
+	}
+	if len(abilities) == 0 {
+		return nil, errors.Errorf("no satisfied channel for model %s", model)
+	}
+	channelIds := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		channelIds = append(channelIds, ability.ChannelId)
+	}
+
+	var channels []*Channel
+	if err := DB.Where("id IN ?", channelIds).Order("id").Find(&channels).Error; err != nil {
+		return nil, errors.Wrap(err, "load satisfied channels")
+	}
+	candidates := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.SupportsModel(model) {
+			candidates = append(candidates, channel)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.Errorf("no satisfied channel lists support for model %s", model)
+	}
+	return pickChannel(strategy, candidates, affinityKey), nil
+}
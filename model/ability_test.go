@@ -194,3 +194,40 @@ func TestGetRandomSatisfiedChannelExcluding_SuspendedChannels(t *testing.T) {
 	assert.NotNil(t, channel)
 	assert.Equal(t, 1, channel.Id, "Should only return the non-suspended channel")
 }
+
+func TestGetSatisfiedChannelExcluding_SkipsUnavailableChannels(t *testing.T) {
+	testDB := setupTestDB(t)
+	originalDB := DB
+	DB = testDB
+	defer func() { DB = originalDB }()
+
+	originalUsingSQLite := common.UsingSQLite.Load()
+	common.UsingSQLite.Store(true)
+	defer func() { common.UsingSQLite.Store(originalUsingSQLite) }()
+
+	for _, channel := range []Channel{
+		{Id: 1, Name: "open-circuit", Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &[]int64{100}[0]},
+		{Id: 2, Name: "healthy", Status: ChannelStatusEnabled, Models: "gpt-4o", Group: "default", Priority: &[]int64{100}[0]},
+	} {
+		require.NoError(t, DB.Create(&channel).Error)
+		require.NoError(t, channel.AddAbilities())
+	}
+
+	originalCheck := channelAvailable
+	SetChannelAvailabilityCheck(func(channelId int, model string) bool { return channelId != 1 })
+	defer SetChannelAvailabilityCheck(originalCheck)
+
+	exclude := map[int]bool{}
+	for range 20 {
+		channel, err := GetSatisfiedChannelExcluding("default", "gpt-4o", false, exclude, "")
+		require.NoError(t, err)
+		assert.Equal(t, 2, channel.Id)
+	}
+	assert.Empty(t, exclude, "the caller's exclusions are not modified")
+
+	_, err := GetSatisfiedChannelById("default", "gpt-4o", 1)
+	require.Error(t, err)
+	channel, err := GetSatisfiedChannelById("default", "gpt-4o", 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, channel.Id)
+}
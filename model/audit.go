@@ -0,0 +1,300 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Audited management actions.
+const (
+	AuditActionChannelCreate         = "channel.create"
+	AuditActionChannelUpdate         = "channel.update"
+	AuditActionChannelDelete         = "channel.delete"
+	AuditActionChannelDeleteDisabled = "channel.delete_disabled"
+	AuditActionOptionUpdate          = "option.update"
+	AuditActionUserCreate            = "user.create"
+	AuditActionUserUpdate            = "user.update"
+	AuditActionUserDelete            = "user.delete"
+	AuditActionUserEnable            = "user.enable"
+	AuditActionUserDisable           = "user.disable"
+	AuditActionUserPromote           = "user.promote"
+	AuditActionUserDemote            = "user.demote"
+	AuditActionUserTopUp             = "user.top_up"
+	AuditActionUserTotpDisable       = "user.totp_disable"
+	AuditActionRedemptionCreate      = "redemption.create"
+	AuditActionRedemptionUpdate      = "redemption.update"
+	AuditActionRedemptionDelete      = "redemption.delete"
+)
+
+// Types of the targets of audited actions.
+const (
+	AuditTargetChannel    = "channel"
+	AuditTargetOption     = "option"
+	AuditTargetUser       = "user"
+	AuditTargetRedemption = "redemption"
+)
+
+const (
+	auditRedacted               = "[redacted]"
+	auditRetentionSweepInterval = 24 * time.Hour
+)
+
+// auditSensitiveFields are never written to the audit log, only whether they changed.
+var auditSensitiveFields = map[string]bool{
+	"key":               true,
+	"password":          true,
+	"access_token":      true,
+	"totp_secret":       true,
+	"verification_code": true,
+	// channel config holds cloud credentials
+	"config": true,
+}
+
+// auditIgnoredFields change on every write and only add noise to the diffs.
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditLog is an append-only record of a management action: who did what to which target,
+// from where, and the fields it changed.
+type AuditLog struct {
+	Id         int    `json:"id"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+	ActorId    int    `json:"actor_id" gorm:"index"`
+	ActorName  string `json:"actor_name" gorm:"type:varchar(64);default:''"`
+	Ip         string `json:"ip" gorm:"type:varchar(64);default:''"`
+	Action     string `json:"action" gorm:"type:varchar(64);index"`
+	TargetType string `json:"target_type" gorm:"type:varchar(32);index:idx_audit_target,priority:1"`
+	TargetId   string `json:"target_id" gorm:"type:varchar(64);index:idx_audit_target,priority:2;default:''"`
+	// Diff is a JSON object mapping each changed field to its before and after values.
+	Diff string `json:"diff" gorm:"type:text"`
+}
+
+// AuditChange is the change of a single field in AuditLog.Diff.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditLogQuery filters the audit log. Zero values match everything.
+type AuditLogQuery struct {
+	ActorId        int
+	ActorName      string
+	Action         string
+	TargetType     string
+	TargetId       string
+	StartTimestamp int64
+	EndTimestamp   int64
+}
+
+// RecordAuditLog appends entry to the audit log, filling its creation time and its diff from
+// the states of the target before and after the action; either may be nil when the action
+// created or deleted the target. The action has already happened, so failures are logged
+// rather than returned.
+func RecordAuditLog(ctx context.Context, entry *AuditLog, before, after any) {
+	lg := gmw.GetLogger(ctx)
+	diff, err := AuditDiff(before, after)
+	if err != nil {
+		lg.Error("failed to compute audit diff", zap.String("action", entry.Action), zap.Error(err))
+		diff = "{}"
+	}
+	entry.Id = 0
+	entry.CreatedAt = helper.GetTimestamp()
+	entry.Diff = diff
+	if err := DB.Create(entry).Error; err != nil {
+		lg.Error("failed to record audit log",
+			zap.String("action", entry.Action),
+			zap.String("target_type", entry.TargetType),
+			zap.String("target_id", entry.TargetId),
+			zap.Int("actor_id", entry.ActorId),
+			zap.Error(err))
+	}
+}
+
+// AuditDiff returns the JSON object of the fields that differ between before and after,
+// comparing their JSON encodings. Sensitive fields only reveal that they changed.
+func AuditDiff(before, after any) (string, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return "", errors.Wrap(err, "encode state before action")
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return "", errors.Wrap(err, "encode state after action")
+	}
+
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diff := make(map[string]AuditChange)
+	for _, name := range names {
+		if auditIgnoredFields[name] {
+			continue
+		}
+		beforeValue, afterValue := beforeFields[name], afterFields[name]
+		if reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+		if isAuditSensitiveField(name) {
+			beforeValue, afterValue = redactAuditValue(beforeValue), redactAuditValue(afterValue)
+		}
+		diff[name] = AuditChange{Before: beforeValue, After: afterValue}
+	}
+
+	encoded, err := json.Marshal(diff)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal audit diff")
+	}
+	return string(encoded), nil
+}
+
+// auditFields decodes the JSON encoding of state into its fields. States that do not encode
+// to a JSON object are reported as a single "value" field.
+func auditFields(state any) (map[string]any, error) {
+	if state == nil {
+		return nil, nil
+	}
+	if value := reflect.ValueOf(state); value.Kind() == reflect.Pointer && value.IsNil() {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err == nil {
+		return fields, nil
+	}
+	var value any
+	if err := json.Unmarshal(encoded, &value); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return map[string]any{"value": value}, nil
+}
+
+// isAuditSensitiveField reports whether a field holds a credential. Besides the known
+// fields, it matches the option keys GetOptions hides from the dashboard.
+func isAuditSensitiveField(name string) bool {
+	return auditSensitiveFields[strings.ToLower(name)] ||
+		strings.HasSuffix(name, "Token") || strings.HasSuffix(name, "Secret")
+}
+
+func redactAuditValue(value any) any {
+	if value == nil || value == "" {
+		return value
+	}
+	return auditRedacted
+}
+
+func auditLogScope(query AuditLogQuery) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if query.ActorId != 0 {
+			tx = tx.Where("actor_id = ?", query.ActorId)
+		}
+		if query.ActorName != "" {
+			tx = tx.Where("actor_name = ?", query.ActorName)
+		}
+		if query.Action != "" {
+			tx = tx.Where("action = ?", query.Action)
+		}
+		if query.TargetType != "" {
+			tx = tx.Where("target_type = ?", query.TargetType)
+		}
+		if query.TargetId != "" {
+			tx = tx.Where("target_id = ?", query.TargetId)
+		}
+		if query.StartTimestamp != 0 {
+			tx = tx.Where("created_at >= ?", query.StartTimestamp)
+		}
+		if query.EndTimestamp != 0 {
+			tx = tx.Where("created_at <= ?", query.EndTimestamp)
+		}
+		return tx
+	}
+}
+
+// SearchAuditLogs returns a page of the audit log entries matching query, newest first,
+// along with the total number of matching entries.
+func SearchAuditLogs(query AuditLogQuery, startIdx int, num int) (logs []*AuditLog, total int64, err error) {
+	tx := DB.Model(&AuditLog{}).Scopes(auditLogScope(query))
+	if err = tx.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrap(err, "count audit logs")
+	}
+	err = DB.Scopes(auditLogScope(query)).Order("id desc").Limit(num).Offset(startIdx).Find(&logs).Error
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "search audit logs")
+	}
+	return logs, total, nil
+}
+
+// StartAuditLogRetentionCleaner launches a background worker that removes audit log entries
+// older than the retention period.
+func StartAuditLogRetentionCleaner(ctx context.Context, retentionDays int) {
+	if retentionDays <= 0 {
+		logger.Logger.Debug("audit log retention disabled", zap.Int("audit_log_retention_days", retentionDays))
+		return
+	}
+
+	cleanup := func() {
+		deleted, err := CleanExpiredAuditLogs(retentionDays)
+		if err != nil {
+			logger.Logger.Warn("audit log retention cleanup failed", zap.Error(err))
+			return
+		}
+		if deleted > 0 {
+			logger.Logger.Info("deleted expired audit log entries", zap.Int64("deleted_rows", deleted), zap.Int("audit_log_retention_days", retentionDays))
+		}
+	}
+
+	cleanup()
+
+	ticker := time.NewTicker(auditRetentionSweepInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("audit log retention cleaner stopped")
+				return
+			case <-ticker.C:
+				cleanup()
+			}
+		}
+	}()
+
+	logger.Logger.Info("audit log retention cleaner started", zap.Int("audit_log_retention_days", retentionDays))
+}
+
+// CleanExpiredAuditLogs deletes the audit log entries older than retentionDays. It is the only
+// way entries leave the audit log.
+func CleanExpiredAuditLogs(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-time.Duration(retentionDays) * 24 * time.Hour).Unix()
+	tx := DB.Where("created_at < ?", cutoff).Delete(&AuditLog{})
+	if tx.Error != nil {
+		return 0, errors.Wrap(tx.Error, "delete expired audit logs")
+	}
+	return tx.RowsAffected, nil
+}
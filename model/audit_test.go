@@ -0,0 +1,86 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditDiff(t *testing.T) {
+	decode := func(t *testing.T, diff string) map[string]AuditChange {
+		t.Helper()
+		var changes map[string]AuditChange
+		require.NoError(t, json.Unmarshal([]byte(diff), &changes))
+		return changes
+	}
+
+	before := &Channel{Id: 1, Name: "openai", Key: "sk-old", Status: ChannelStatusEnabled, UpdatedAt: 1}
+	after := &Channel{Id: 1, Name: "openai-eu", Key: "sk-new", Status: ChannelStatusEnabled, UpdatedAt: 2}
+	diff, err := AuditDiff(before, after)
+	require.NoError(t, err)
+	changes := decode(t, diff)
+	require.Len(t, changes, 2)
+	require.Equal(t, AuditChange{Before: "openai", After: "openai-eu"}, changes["name"])
+	// credentials only reveal that they changed
+	require.Equal(t, AuditChange{Before: auditRedacted, After: auditRedacted}, changes["key"])
+	require.NotContains(t, diff, "sk-")
+
+	// creations and deletions list every field
+	var missing *Channel
+	diff, err = AuditDiff(missing, &Redemption{Id: 2, Name: "promo", Key: "secret-code", Quota: 100})
+	require.NoError(t, err)
+	changes = decode(t, diff)
+	require.Equal(t, AuditChange{Before: nil, After: "promo"}, changes["name"])
+	require.Equal(t, AuditChange{Before: nil, After: auditRedacted}, changes["key"])
+
+	// options are diffed by key, secrets included
+	diff, err = AuditDiff(map[string]string{"GitHubClientSecret": "old"}, map[string]string{"GitHubClientSecret": "new"})
+	require.NoError(t, err)
+	require.Equal(t, AuditChange{Before: auditRedacted, After: auditRedacted}, decode(t, diff)["GitHubClientSecret"])
+
+	diff, err = AuditDiff(before, before)
+	require.NoError(t, err)
+	require.Equal(t, "{}", diff)
+}
+
+func TestSearchAuditLogs(t *testing.T) {
+	setupTestDatabase(t)
+	require.NoError(t, DB.Exec("DELETE FROM audit_logs WHERE target_id LIKE 'test-audit-%'").Error)
+	t.Cleanup(func() {
+		DB.Exec("DELETE FROM audit_logs WHERE target_id LIKE 'test-audit-%'")
+	})
+
+	ctx := context.Background()
+	RecordAuditLog(ctx, &AuditLog{ActorId: 1, ActorName: "root", Action: AuditActionOptionUpdate,
+		TargetType: AuditTargetOption, TargetId: "test-audit-option"},
+		map[string]string{"Theme": "default"}, map[string]string{"Theme": "air"})
+	RecordAuditLog(ctx, &AuditLog{ActorId: 2, ActorName: "admin", Action: AuditActionUserDisable,
+		TargetType: AuditTargetUser, TargetId: "test-audit-user"},
+		&User{Status: UserStatusEnabled}, &User{Status: UserStatusDisabled})
+
+	logs, total, err := SearchAuditLogs(AuditLogQuery{TargetType: AuditTargetOption, TargetId: "test-audit-option"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	require.Equal(t, "root", logs[0].ActorName)
+	require.JSONEq(t, `{"Theme":{"before":"default","after":"air"}}`, logs[0].Diff)
+
+	logs, total, err = SearchAuditLogs(AuditLogQuery{ActorId: 2, Action: AuditActionUserDisable}, 0, 10)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, total, int64(1))
+	require.Equal(t, "test-audit-user", logs[0].TargetId)
+
+	// only the retention window removes entries
+	expired := time.Now().Add(-31 * 24 * time.Hour).Unix()
+	require.NoError(t, DB.Model(&AuditLog{}).Where("target_id = ?", "test-audit-option").Update("created_at", expired).Error)
+	_, err = CleanExpiredAuditLogs(30)
+	require.NoError(t, err)
+	_, total, err = SearchAuditLogs(AuditLogQuery{TargetId: "test-audit-option"}, 0, 10)
+	require.NoError(t, err)
+	require.Zero(t, total)
+	_, total, err = SearchAuditLogs(AuditLogQuery{TargetId: "test-audit-user"}, 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+}
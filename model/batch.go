@@ -0,0 +1,248 @@
+package model
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+// UpstreamFile pins a file uploaded through the Files API to the channel that stored it.
+// Upstream file ids are only meaningful to the provider that issued them, so every later
+// read, delete or batch referencing the file must be routed back to ChannelId, and on a
+// multi-key channel to the pooled key ChannelKeyId, since org-scoped keys do not share files.
+type UpstreamFile struct {
+	Id           int    `json:"id"`
+	FileId       string `json:"file_id" gorm:"type:varchar(128);index"`
+	UserId       int    `json:"user_id" gorm:"index"`
+	TokenId      int    `json:"token_id"`
+	ChannelId    int    `json:"channel_id" gorm:"index"`
+	ChannelKeyId int    `json:"channel_key_id"`
+	Purpose      string `json:"purpose" gorm:"type:varchar(32)"`
+	Filename     string `json:"filename"`
+	Bytes        int64  `json:"bytes"`
+	CreatedAt    int64  `json:"created_at" gorm:"bigint;autoCreateTime"`
+}
+
+// BatchJob tracks a Batch API job proxied to an upstream channel together with the
+// TokenTransaction that holds its quota until the output file is complete.
+//
+// Fields:
+//   - BatchId: upstream batch identifier returned to the client.
+//   - ChannelId/ChannelType: channel the batch lives on; all follow-up calls are pinned to it.
+//   - ChannelKeyId: pooled key that created the batch on a multi-key channel, 0 otherwise.
+//   - GroupRatio: channel ratio captured at creation, applied when the usage is priced.
+//   - Status: last upstream status observed (validating, in_progress, completed, ended, ...).
+//   - TransactionId: primary key of the pending TokenTransaction holding PreQuota.
+//   - LogId: consume log entry updated with the final quota on settlement.
+//   - Settled: true once the transaction was confirmed or canceled.
+//   - SettleFailures/NextSettleAt: consecutive poller failures and the earliest time the
+//     poller retries the job, so a broken job backs off instead of blocking the queue.
+type BatchJob struct {
+	Id             int     `json:"id"`
+	BatchId        string  `json:"batch_id" gorm:"type:varchar(128);index"`
+	UserId         int     `json:"user_id" gorm:"index"`
+	TokenId        int     `json:"token_id" gorm:"index"`
+	TokenName      string  `json:"token_name"`
+	Group          string  `json:"group" gorm:"type:varchar(32)"`
+	GroupRatio     float64 `json:"group_ratio"`
+	ChannelId      int     `json:"channel_id" gorm:"index"`
+	ChannelType    int     `json:"channel_type"`
+	ChannelKeyId   int     `json:"channel_key_id"`
+	Endpoint       string  `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId    string  `json:"input_file_id" gorm:"type:varchar(128)"`
+	OutputFileId   string  `json:"output_file_id" gorm:"type:varchar(128)"`
+	Status         string  `json:"status" gorm:"type:varchar(32);index"`
+	TransactionId  int     `json:"transaction_id"`
+	LogId          int     `json:"log_id"`
+	PreQuota       int64   `json:"pre_quota"`
+	FinalQuota     int64   `json:"final_quota"`
+	Settled        bool    `json:"settled" gorm:"default:false;index"`
+	SettleFailures int     `json:"settle_failures" gorm:"default:0"`
+	NextSettleAt   int64   `json:"next_settle_at" gorm:"bigint;default:0;index"`
+	RequestId      string  `json:"request_id" gorm:"type:varchar(64)"`
+	CreatedAt      int64   `json:"created_at" gorm:"bigint;autoCreateTime"`
+	UpdatedAt      int64   `json:"updated_at" gorm:"bigint;autoUpdateTime"`
+}
+
+// CreateUpstreamFile records which channel stores an uploaded file.
+func CreateUpstreamFile(ctx context.Context, file *UpstreamFile) error {
+	if err := DB.WithContext(ctx).Create(file).Error; err != nil {
+		return errors.Wrapf(err, "create upstream file %s", file.FileId)
+	}
+	return nil
+}
+
+// GetUpstreamFileByUser returns the pinned file owned by userId.
+func GetUpstreamFileByUser(ctx context.Context, userId int, fileId string) (*UpstreamFile, error) {
+	file := &UpstreamFile{}
+	if err := DB.WithContext(ctx).Where("user_id = ? AND file_id = ?", userId, fileId).First(file).Error; err != nil {
+		return nil, errors.Wrapf(err, "get upstream file %s for user %d", fileId, userId)
+	}
+	return file, nil
+}
+
+// ListUpstreamFilesByUser lists the files of userId, newest first, optionally filtered by purpose.
+func ListUpstreamFilesByUser(ctx context.Context, userId int, purpose string, limit int) ([]*UpstreamFile, error) {
+	var files []*UpstreamFile
+	tx := DB.WithContext(ctx).Where("user_id = ?", userId)
+	if purpose != "" {
+		tx = tx.Where("purpose = ?", purpose)
+	}
+	if err := tx.Order("id desc").Limit(limit).Find(&files).Error; err != nil {
+		return nil, errors.Wrapf(err, "list upstream files for user %d", userId)
+	}
+	return files, nil
+}
+
+// DeleteUpstreamFile removes the pin record of a file.
+func DeleteUpstreamFile(ctx context.Context, id int) error {
+	if err := DB.WithContext(ctx).Delete(&UpstreamFile{}, id).Error; err != nil {
+		return errors.Wrapf(err, "delete upstream file %d", id)
+	}
+	return nil
+}
+
+// CreateBatchJob inserts a new batch job record.
+func CreateBatchJob(ctx context.Context, job *BatchJob) error {
+	if err := DB.WithContext(ctx).Create(job).Error; err != nil {
+		return errors.Wrapf(err, "create batch job %s", job.BatchId)
+	}
+	return nil
+}
+
+// GetBatchJobByUser returns the batch job owned by userId.
+func GetBatchJobByUser(ctx context.Context, userId int, batchId string) (*BatchJob, error) {
+	job := &BatchJob{}
+	if err := DB.WithContext(ctx).Where("user_id = ? AND batch_id = ?", userId, batchId).First(job).Error; err != nil {
+		return nil, errors.Wrapf(err, "get batch job %s for user %d", batchId, userId)
+	}
+	return job, nil
+}
+
+// ListBatchJobsByUser lists the batch jobs of userId, newest first.
+// When afterBatchId is set, only jobs created before that batch are returned (cursor pagination).
+func ListBatchJobsByUser(ctx context.Context, userId int, afterBatchId string, limit int) ([]*BatchJob, error) {
+	tx := DB.WithContext(ctx).Where("user_id = ?", userId)
+	if afterBatchId != "" {
+		after, err := GetBatchJobByUser(ctx, userId, afterBatchId)
+		if err != nil {
+			return nil, errors.Wrap(err, "resolve batch cursor")
+		}
+		tx = tx.Where("id < ?", after.Id)
+	}
+
+	var jobs []*BatchJob
+	if err := tx.Order("id desc").Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, errors.Wrapf(err, "list batch jobs for user %d", userId)
+	}
+	return jobs, nil
+}
+
+// ListUnsettledBatchJobs returns batch jobs whose quota hold is still pending and that are due
+// for polling at now, least recently deferred first. Jobs that failed maxFailures times in a
+// row are skipped; they are still settled inline when the user retrieves them.
+func ListUnsettledBatchJobs(ctx context.Context, now int64, maxFailures int, limit int) ([]*BatchJob, error) {
+	var jobs []*BatchJob
+	if err := DB.WithContext(ctx).
+		Where("settled = ? AND next_settle_at <= ? AND settle_failures < ?", false, now, maxFailures).
+		Order("next_settle_at asc, id asc").Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, errors.Wrap(err, "list unsettled batch jobs")
+	}
+	return jobs, nil
+}
+
+// UpdateBatchJob applies a partial update to a batch job.
+func UpdateBatchJob(ctx context.Context, id int, updates map[string]any) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := DB.WithContext(ctx).Model(&BatchJob{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return errors.Wrapf(err, "update batch job %d", id)
+	}
+	return nil
+}
+
+// RecordBatchJobSettleFailure counts a failed settlement attempt and defers the next poll
+// of the job until nextSettleAt.
+func RecordBatchJobSettleFailure(ctx context.Context, id int, nextSettleAt int64) error {
+	if err := DB.WithContext(ctx).Model(&BatchJob{}).Where("id = ?", id).Updates(map[string]any{
+		"settle_failures": gorm.Expr("settle_failures + ?", 1),
+		"next_settle_at":  nextSettleAt,
+	}).Error; err != nil {
+		return errors.Wrapf(err, "record settlement failure of batch job %d", id)
+	}
+	return nil
+}
+
+// ClaimBatchJobSettlement marks an unsettled batch job as settled together with updates.
+// It returns false when another node's poller or a retrieve request settled the job first,
+// in which case the caller must not charge the quota again.
+func ClaimBatchJobSettlement(ctx context.Context, id int, updates map[string]any) (bool, error) {
+	values := map[string]any{"settled": true}
+	for k, v := range updates {
+		values[k] = v
+	}
+	result := DB.WithContext(ctx).Model(&BatchJob{}).Where("id = ? AND settled = ?", id, false).Updates(values)
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "claim settlement of batch job %d", id)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseBatchJobSettlement undoes ClaimBatchJobSettlement after the claimed charge failed,
+// so the poller or the next retrieve request settles the job again.
+func ReleaseBatchJobSettlement(ctx context.Context, id int) error {
+	if err := DB.WithContext(ctx).Model(&BatchJob{}).Where("id = ? AND settled = ?", id, true).
+		Updates(map[string]any{"settled": false, "final_quota": int64(0)}).Error; err != nil {
+		return errors.Wrapf(err, "release settlement of batch job %d", id)
+	}
+	return nil
+}
+
+// GetRandomChannelByGroupAndTypes picks an enabled channel of one of the given types that
+// serves at least one model for group, preferring the highest priority.
+// It is used for requests such as file uploads that carry no model to route by.
+func GetRandomChannelByGroupAndTypes(group string, types []int) (*Channel, error) {
+	groupCol := "`group`"
+	trueVal := "1"
+	if common.UsingPostgreSQL.Load() {
+		groupCol = `"group"`
+		trueVal = "true"
+	}
+
+	var channelIds []int
+	err := DB.Model(&Ability{}).Distinct("channel_id").
+		Where(groupCol+" = ? AND enabled = "+trueVal+" AND (suspend_until IS NULL OR suspend_until < ?)", group, time.Now()).
+		Pluck("channel_id", &channelIds).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list channels of group %s", group)
+	}
+	if len(channelIds) == 0 {
+		return nil, errors.Errorf("no channels available for group %s", group)
+	}
+
+	var channels []*Channel
+	err = DB.Where("id IN ? AND type IN ? AND status = ?", channelIds, types, ChannelStatusEnabled).Find(&channels).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list channels of group %s by type", group)
+	}
+	if len(channels) == 0 {
+		return nil, errors.Errorf("no channel of a supported type available for group %s", group)
+	}
+
+	var top []*Channel
+	for _, channel := range channels {
+		switch {
+		case len(top) == 0 || channel.GetPriority() > top[0].GetPriority():
+			top = []*Channel{channel}
+		case channel.GetPriority() == top[0].GetPriority():
+			top = append(top, channel)
+		}
+	}
+	return top[rand.Intn(len(top))], nil
+}
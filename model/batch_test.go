@@ -0,0 +1,96 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestClaimBatchJobSettlement(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&BatchJob{}))
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	ctx := context.Background()
+	job := &BatchJob{BatchId: "batch_1", UserId: 1, Status: "in_progress"}
+	require.NoError(t, CreateBatchJob(ctx, job))
+
+	claimed, err := ClaimBatchJobSettlement(ctx, job.Id, map[string]any{"status": "completed", "final_quota": int64(42)})
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	claimed, err = ClaimBatchJobSettlement(ctx, job.Id, map[string]any{"status": "completed", "final_quota": int64(99)})
+	require.NoError(t, err)
+	require.False(t, claimed, "a settled job must not be claimed twice")
+
+	stored, err := GetBatchJobByUser(ctx, 1, "batch_1")
+	require.NoError(t, err)
+	require.True(t, stored.Settled)
+	require.Equal(t, int64(42), stored.FinalQuota)
+}
+
+func TestReleaseBatchJobSettlement(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&BatchJob{}))
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	ctx := context.Background()
+	job := &BatchJob{BatchId: "batch_1", UserId: 1, Status: "in_progress"}
+	require.NoError(t, CreateBatchJob(ctx, job))
+
+	claimed, err := ClaimBatchJobSettlement(ctx, job.Id, map[string]any{"status": "completed", "final_quota": int64(42)})
+	require.NoError(t, err)
+	require.True(t, claimed)
+
+	require.NoError(t, ReleaseBatchJobSettlement(ctx, job.Id))
+
+	pending, err := ListUnsettledBatchJobs(ctx, 0, 10, 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "a released job must be polled again")
+
+	claimed, err = ClaimBatchJobSettlement(ctx, job.Id, map[string]any{"status": "completed", "final_quota": int64(42)})
+	require.NoError(t, err)
+	require.True(t, claimed, "a released job can be claimed again")
+}
+
+func TestListUnsettledBatchJobsSkipsFailingJobs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&BatchJob{}))
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	ctx := context.Background()
+	failing := &BatchJob{BatchId: "batch_failing", UserId: 1, Status: "in_progress"}
+	healthy := &BatchJob{BatchId: "batch_healthy", UserId: 1, Status: "in_progress"}
+	require.NoError(t, CreateBatchJob(ctx, failing))
+	require.NoError(t, CreateBatchJob(ctx, healthy))
+
+	require.NoError(t, RecordBatchJobSettleFailure(ctx, failing.Id, 100))
+	jobs, err := ListUnsettledBatchJobs(ctx, 50, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1, "a deferred job must not be polled before its backoff ends")
+	require.Equal(t, "batch_healthy", jobs[0].BatchId)
+
+	jobs, err = ListUnsettledBatchJobs(ctx, 100, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	require.Equal(t, "batch_healthy", jobs[0].BatchId, "jobs never deferred are polled first")
+
+	require.NoError(t, RecordBatchJobSettleFailure(ctx, failing.Id, 100))
+	require.NoError(t, RecordBatchJobSettleFailure(ctx, failing.Id, 100))
+	jobs, err = ListUnsettledBatchJobs(ctx, 100, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, jobs, 1, "a job that keeps failing is skipped")
+	require.Equal(t, "batch_healthy", jobs[0].BatchId)
+}
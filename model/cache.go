@@ -362,7 +362,7 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	// Make a copy to safely work with outside the lock for selection logic
 	candidateChannels := make([]*Channel, 0, len(channelsFromCache))
 	for _, ch := range channelsFromCache {
-		if model == "" || ch.SupportsModel(model) {
+		if (model == "" || ch.SupportsModel(model)) && isChannelAvailable(ch.Id, model) {
 			candidateChannels = append(candidateChannels, ch)
 		}
 	}
@@ -441,10 +441,33 @@ func CacheGetRandomSatisfiedChannel(group string, model string, ignoreFirstPrior
 	return channel, nil
 }
 
+// CacheGetSatisfiedChannelById returns the channel if it still serves the model for the group,
+// i.e. it is enabled, its ability is not suspended, it lists the model and it is available.
+func CacheGetSatisfiedChannelById(group string, model string, channelId int) (*Channel, error) {
+	if !config.MemoryCacheEnabled {
+		return GetSatisfiedChannelById(group, model, channelId)
+	}
+	channelSyncLock.RLock()
+	defer channelSyncLock.RUnlock()
+	for _, channel := range group2model2channels[group][model] {
+		if channel.Id == channelId && channel.SupportsModel(model) && isChannelAvailable(channelId, model) {
+			return channel, nil
+		}
+	}
+	return nil, errors.Errorf("channel #%d does not serve model %s in group %s", channelId, model, group)
+}
+
 // CacheGetRandomSatisfiedChannelExcluding gets a random satisfied channel while excluding specified channel IDs
 func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool, tryLargerMaxTokens bool) (*Channel, error) {
+	return CacheSelectChannelExcluding(group, model, ignoreFirstPriority, excludeChannelIds, tryLargerMaxTokens, "")
+}
+
+// CacheSelectChannelExcluding selects a satisfied channel while excluding specified channel IDs,
+// using the selection strategy configured for the group and model within the chosen priority
+// tier. affinityKey identifies the caller for the consistent_hash strategy.
+func CacheSelectChannelExcluding(group string, model string, ignoreFirstPriority bool, excludeChannelIds map[int]bool, tryLargerMaxTokens bool, affinityKey string) (*Channel, error) {
 	if !config.MemoryCacheEnabled {
-		return GetRandomSatisfiedChannelExcluding(group, model, ignoreFirstPriority, excludeChannelIds)
+		return GetSatisfiedChannelExcluding(group, model, ignoreFirstPriority, excludeChannelIds, affinityKey)
 	}
 	channelSyncLock.RLock()
 	channelsFromCache := group2model2channels[group][model]
@@ -492,7 +515,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 
 	filtered := make([]*Channel, 0, len(candidateChannels))
 	for _, ch := range candidateChannels {
-		if model == "" || ch.SupportsModel(model) {
+		if (model == "" || ch.SupportsModel(model)) && isChannelAvailable(ch.Id, model) {
 			filtered = append(filtered, ch)
 		}
 	}
@@ -519,8 +542,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 
 		// If there are lower priority channels available, select from them
 		if endIdx < len(candidateChannels) {
-			idx := random.RandRange(endIdx, len(candidateChannels))
-			channel := candidateChannels[idx]
+			channel := pickChannel(GetChannelSelectionStrategy(group, model), candidateChannels[endIdx:], affinityKey)
 			logger.Logger.Info("select channel in cache", zap.String("channel_name", channel.Name), zap.Int("channel_id", channel.Id))
 			return channel, nil
 		} else {
@@ -555,8 +577,7 @@ func CacheGetRandomSatisfiedChannelExcluding(group string, model string, ignoreF
 			return nil, errors.New("no channels with maximum priority available")
 		}
 
-		idx := rand.Intn(len(maxPriorityChannels))
-		channel := maxPriorityChannels[idx]
+		channel := pickChannel(GetChannelSelectionStrategy(group, model), maxPriorityChannels, affinityKey)
 		logger.Logger.Info("select channel in cache", zap.String("channel_name", channel.Name), zap.Int("channel_id", channel.Id))
 		return channel, nil
 	}
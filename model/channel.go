@@ -61,6 +61,9 @@ type Channel struct {
 	UpdatedAt       int64   `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
 	// AWS-specific configuration
 	InferenceProfileArnMap *string `json:"inference_profile_arn_map" gorm:"type:text"` // JSON string mapping model names to AWS Bedrock Inference Profile ARNs
+	// KeyMode enables the multi-key pool when non-empty, see ChannelKeyModeRoundRobin and ChannelKeyModeWeighted.
+	// Every newline separated entry in Key becomes one pooled ChannelKey with its own health state.
+	KeyMode string `json:"key_mode" gorm:"type:varchar(32);default:''"`
 }
 
 type ChannelConfig struct {
@@ -196,8 +199,13 @@ func BatchInsertChannels(channels []Channel) error {
 		if err != nil {
 			return errors.Wrapf(err, "failed to add abilities for channel %d (index %d) during batch insert", channel_.Id, i)
 		}
+		if channel_.IsMultiKey() {
+			if err = channel_.SyncKeys(); err != nil {
+				return errors.Wrapf(err, "failed to sync keys for channel %d (index %d) during batch insert", channel_.Id, i)
+			}
+		}
 	}
-	InitChannelCache()
+	refreshChannelCache()
 	return nil
 }
 
@@ -688,7 +696,12 @@ func (channel *Channel) Insert() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to add abilities for channel: id=%d, name=%s", channel.Id, channel.Name)
 	}
-	InitChannelCache()
+	if channel.IsMultiKey() {
+		if err = channel.SyncKeys(); err != nil {
+			return errors.Wrapf(err, "failed to sync keys for channel: id=%d, name=%s", channel.Id, channel.Name)
+		}
+	}
+	refreshChannelCache()
 	return nil
 }
 
@@ -734,6 +747,10 @@ func (channel *Channel) Update() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to update channel: id=%d, name=%s", channel.Id, channel.Name)
 	}
+	// Updates skips zero values, so switching back to single-key mode needs an explicit write
+	if err := DB.Model(channel).Where("id = ?", channel.Id).Update("key_mode", channel.KeyMode).Error; err != nil {
+		return errors.Wrapf(err, "failed to update key_mode for channel: id=%d", channel.Id)
+	}
 	DB.Model(channel).First(channel, "id = ?", channel.Id)
 	if clearTestingModel {
 		if err := DB.Model(channel).Where("id = ?", channel.Id).Update("testing_model", nil).Error; err != nil {
@@ -746,7 +763,10 @@ func (channel *Channel) Update() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to update abilities for channel: id=%d, name=%s", channel.Id, channel.Name)
 	}
-	InitChannelCache()
+	if err = channel.SyncKeys(); err != nil {
+		return errors.Wrapf(err, "failed to sync keys for channel: id=%d, name=%s", channel.Id, channel.Name)
+	}
+	refreshChannelCache()
 	return nil
 }
 
@@ -777,7 +797,10 @@ func (channel *Channel) Delete() error {
 	if err := channel.DeleteAbilities(); err != nil {
 		return errors.Wrapf(err, "delete abilities for channel %d", channel.Id)
 	}
-	InitChannelCache()
+	if err := channel.DeleteKeys(); err != nil {
+		return errors.Wrapf(err, "delete keys for channel %d", channel.Id)
+	}
+	refreshChannelCache()
 	return nil
 }
 
@@ -869,7 +892,7 @@ func UpdateChannelStatusById(id int, status int) {
 		logger.Logger.Error("failed to update channel status", zap.Error(err))
 	}
 	if err == nil {
-		InitChannelCache()
+		refreshChannelCache()
 	}
 }
 
@@ -895,7 +918,7 @@ func updateChannelUsedQuota(id int, quota int64) {
 func DeleteChannelByStatus(status int64) (int64, error) {
 	result := DB.Where("status = ?", status).Delete(&Channel{})
 	if result.Error == nil {
-		InitChannelCache()
+		refreshChannelCache()
 	}
 	return result.RowsAffected, result.Error
 }
@@ -903,7 +926,7 @@ func DeleteChannelByStatus(status int64) (int64, error) {
 func DeleteDisabledChannel() (int64, error) {
 	result := DB.Where("status = ? or status = ?", ChannelStatusAutoDisabled, ChannelStatusManuallyDisabled).Delete(&Channel{})
 	if result.Error == nil {
-		InitChannelCache()
+		refreshChannelCache()
 	}
 	return result.RowsAffected, result.Error
 }
@@ -0,0 +1,336 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gutils "github.com/Laisky/go-utils/v5"
+
+	"github.com/songquanpeng/one-api/common/eventbus"
+)
+
+const (
+	ChannelKeyStatusEnabled          = 1 // don't use 0, 0 is the default value!
+	ChannelKeyStatusManuallyDisabled = 2 // also don't use 0
+	ChannelKeyStatusAutoDisabled     = 3
+)
+
+const (
+	// ChannelKeyModeSingle keeps the legacy behaviour: Channel.Key is one credential.
+	ChannelKeyModeSingle = ""
+	// ChannelKeyModeRoundRobin rotates through the enabled keys of the pool in order.
+	ChannelKeyModeRoundRobin = "round_robin"
+	// ChannelKeyModeWeighted picks a random enabled key proportionally to ChannelKey.Weight.
+	ChannelKeyModeWeighted = "weighted"
+)
+
+// ChannelKey is one upstream credential in a multi-key channel pool.
+// Channel.Key still stores every key (newline separated) so that the rest of the
+// system keeps working; this table carries the per-key health state.
+type ChannelKey struct {
+	Id             int        `json:"id"`
+	ChannelId      int        `json:"channel_id" gorm:"index"`
+	Key            string     `json:"key" gorm:"type:text"`
+	KeyHash        string     `json:"-" gorm:"type:varchar(64);index"`
+	Weight         uint       `json:"weight" gorm:"default:1"`
+	Status         int        `json:"status" gorm:"default:1"`
+	SuspendUntil   *time.Time `json:"suspend_until,omitempty" gorm:"index"`
+	DisabledReason string     `json:"disabled_reason" gorm:"type:text"`
+	CreatedAt      int64      `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt      int64      `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+}
+
+// IsValidChannelKeyMode reports whether mode is a supported key selection mode.
+func IsValidChannelKeyMode(mode string) bool {
+	switch mode {
+	case ChannelKeyModeSingle, ChannelKeyModeRoundRobin, ChannelKeyModeWeighted:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsMultiKey reports whether the channel serves requests from a key pool.
+func (channel *Channel) IsMultiKey() bool {
+	return channel.KeyMode != ChannelKeyModeSingle
+}
+
+// SplitChannelKeys splits a newline separated key list, trimming blanks and duplicates.
+func SplitChannelKeys(raw string) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for line := range strings.SplitSeq(raw, "\n") {
+		key := strings.TrimSpace(line)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func hashChannelKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MaskedKey returns the key with its middle part hidden, suitable for admin listings.
+func (k *ChannelKey) MaskedKey() string {
+	if len(k.Key) <= 8 {
+		return strings.Repeat("*", len(k.Key))
+	}
+	return k.Key[:4] + strings.Repeat("*", 8) + k.Key[len(k.Key)-4:]
+}
+
+// IsAvailable reports whether the key is enabled and not currently suspended.
+func (k *ChannelKey) IsAvailable(now time.Time) bool {
+	if k.Status != ChannelKeyStatusEnabled {
+		return false
+	}
+	return k.SuspendUntil == nil || k.SuspendUntil.Before(now)
+}
+
+// SyncKeys reconciles the channel_keys rows with the keys stored in Channel.Key.
+// Existing keys keep their weight and health state, new keys are inserted enabled,
+// and keys no longer present are removed.
+func (channel *Channel) SyncKeys() error {
+	if !channel.IsMultiKey() {
+		return channel.DeleteKeys()
+	}
+
+	var existing []*ChannelKey
+	if err := DB.Where("channel_id = ?", channel.Id).Find(&existing).Error; err != nil {
+		return errors.Wrapf(err, "load keys for channel %d", channel.Id)
+	}
+	existingByHash := make(map[string]*ChannelKey, len(existing))
+	for _, k := range existing {
+		existingByHash[k.KeyHash] = k
+	}
+
+	wanted := make(map[string]bool)
+	for _, key := range SplitChannelKeys(channel.Key) {
+		hash := hashChannelKey(key)
+		wanted[hash] = true
+		if _, ok := existingByHash[hash]; ok {
+			continue
+		}
+		row := &ChannelKey{
+			ChannelId: channel.Id,
+			Key:       key,
+			KeyHash:   hash,
+			Weight:    1,
+			Status:    ChannelKeyStatusEnabled,
+		}
+		if err := DB.Create(row).Error; err != nil {
+			return errors.Wrapf(err, "insert key for channel %d", channel.Id)
+		}
+	}
+
+	for hash, k := range existingByHash {
+		if wanted[hash] {
+			continue
+		}
+		if err := DB.Delete(k).Error; err != nil {
+			return errors.Wrapf(err, "delete stale key %d for channel %d", k.Id, channel.Id)
+		}
+	}
+
+	invalidateChannelKeysCache(channel.Id)
+	return nil
+}
+
+// DeleteKeys removes every pooled key of this channel.
+func (channel *Channel) DeleteKeys() error {
+	if err := DB.Where("channel_id = ?", channel.Id).Delete(&ChannelKey{}).Error; err != nil {
+		return errors.Wrapf(err, "delete keys for channel %d", channel.Id)
+	}
+	invalidateChannelKeysCache(channel.Id)
+	return nil
+}
+
+// GetChannelKeys returns all pooled keys of a channel ordered by id.
+func GetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	if err := DB.Where("channel_id = ?", channelId).Order("id asc").Find(&keys).Error; err != nil {
+		return nil, errors.Wrapf(err, "get keys for channel %d", channelId)
+	}
+	return keys, nil
+}
+
+// GetChannelKeyById returns a pooled key by id.
+func GetChannelKeyById(id int) (*ChannelKey, error) {
+	var key ChannelKey
+	if err := DB.First(&key, "id = ?", id).Error; err != nil {
+		return nil, errors.Wrapf(err, "get channel key %d", id)
+	}
+	return &key, nil
+}
+
+// UpdateChannelKeyStatus sets the status of a pooled key. Enabling a key also
+// clears any pending suspension and disable reason.
+func UpdateChannelKeyStatus(id int, status int, reason string) error {
+	updates := map[string]any{
+		"status":          status,
+		"disabled_reason": reason,
+	}
+	if status == ChannelKeyStatusEnabled {
+		updates["suspend_until"] = nil
+		updates["disabled_reason"] = ""
+	}
+	key, err := GetChannelKeyById(id)
+	if err != nil {
+		return errors.Wrap(err, "update channel key status")
+	}
+	if err := DB.Model(&ChannelKey{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return errors.Wrapf(err, "update status of channel key %d", id)
+	}
+	invalidateChannelKeysCache(key.ChannelId)
+	return nil
+}
+
+// UpdateChannelKeyWeight sets the weighted-mode weight of a pooled key.
+func UpdateChannelKeyWeight(id int, weight uint) error {
+	key, err := GetChannelKeyById(id)
+	if err != nil {
+		return errors.Wrap(err, "update channel key weight")
+	}
+	if err := DB.Model(&ChannelKey{}).Where("id = ?", id).Update("weight", weight).Error; err != nil {
+		return errors.Wrapf(err, "update weight of channel key %d", id)
+	}
+	invalidateChannelKeysCache(key.ChannelId)
+	return nil
+}
+
+// SuspendChannelKey sets the SuspendUntil timestamp for a pooled key,
+// mirroring SuspendAbility for abilities.
+func SuspendChannelKey(ctx context.Context, id int, duration time.Duration) error {
+	if id == 0 {
+		return errors.New("channel key id must be specified for suspending key")
+	}
+	key, err := GetChannelKeyById(id)
+	if err != nil {
+		return errors.Wrap(err, "suspend channel key")
+	}
+	suspendTime := time.Now().Add(duration)
+	if err := DB.WithContext(ctx).Model(&ChannelKey{}).Where("id = ?", id).Update("suspend_until", suspendTime).Error; err != nil {
+		return errors.Wrapf(err, "suspend channel key %d", id)
+	}
+	invalidateChannelKeysCache(key.ChannelId)
+	return nil
+}
+
+// CountAvailableChannelKeys returns how many keys of the channel can currently serve requests.
+func CountAvailableChannelKeys(channelId int) (int, error) {
+	keys, err := cacheGetChannelKeys(channelId)
+	if err != nil {
+		return 0, errors.Wrap(err, "count available channel keys")
+	}
+	now := time.Now()
+	count := 0
+	for _, k := range keys {
+		if k.IsAvailable(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+var (
+	channelKeysCache   = gutils.NewExpCache[[]*ChannelKey](context.Background(), time.Second*10)
+	channelKeyCursors  sync.Map // channel id -> *atomic.Uint64
+	errNoAvailableKeys = errors.New("no available keys in channel key pool")
+)
+
+// invalidateChannelKeysCache drops the cached keys of a channel on every node.
+func invalidateChannelKeysCache(channelId int) {
+	dropChannelKeysCache(channelId)
+	eventbus.Publish(context.Background(), eventbus.TopicChannelKeys, strconv.Itoa(channelId))
+}
+
+func dropChannelKeysCache(channelId int) {
+	channelKeysCache.Delete(strconv.Itoa(channelId))
+}
+
+func cacheGetChannelKeys(channelId int) ([]*ChannelKey, error) {
+	cacheKey := strconv.Itoa(channelId)
+	if keys, ok := channelKeysCache.Load(cacheKey); ok {
+		return keys, nil
+	}
+	keys, err := GetChannelKeys(channelId)
+	if err != nil {
+		return nil, err
+	}
+	channelKeysCache.Store(cacheKey, keys)
+	return keys, nil
+}
+
+// SelectChannelKey picks one available key from the channel's pool according to
+// Channel.KeyMode. It returns an error if every key is disabled or suspended.
+func SelectChannelKey(channel *Channel) (*ChannelKey, error) {
+	keys, err := cacheGetChannelKeys(channel.Id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "select key for channel %d", channel.Id)
+	}
+
+	now := time.Now()
+	candidates := make([]*ChannelKey, 0, len(keys))
+	for _, k := range keys {
+		if k.IsAvailable(now) {
+			candidates = append(candidates, k)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, errors.Wrapf(errNoAvailableKeys, "channel %d", channel.Id)
+	}
+
+	switch channel.KeyMode {
+	case ChannelKeyModeWeighted:
+		return pickWeightedChannelKey(candidates), nil
+	default:
+		cursor, _ := channelKeyCursors.LoadOrStore(channel.Id, new(atomic.Uint64))
+		idx := cursor.(*atomic.Uint64).Add(1) - 1
+		return candidates[idx%uint64(len(candidates))], nil
+	}
+}
+
+// SelectPreferredChannelKey returns the key preferredId of the channel while it is
+// available, e.g. the key a prompt-cache affinity binding names, and otherwise selects a
+// key like SelectChannelKey.
+func SelectPreferredChannelKey(channel *Channel, preferredId int) (*ChannelKey, error) {
+	if preferredId != 0 {
+		if keys, err := cacheGetChannelKeys(channel.Id); err == nil {
+			now := time.Now()
+			for _, k := range keys {
+				if k.Id == preferredId && k.IsAvailable(now) {
+					return k, nil
+				}
+			}
+		}
+	}
+	return SelectChannelKey(channel)
+}
+
+func pickWeightedChannelKey(candidates []*ChannelKey) *ChannelKey {
+	var total uint
+	for _, k := range candidates {
+		total += max(k.Weight, 1)
+	}
+	n := uint(rand.Int63n(int64(total)))
+	for _, k := range candidates {
+		w := max(k.Weight, 1)
+		if n < w {
+			return k
+		}
+		n -= w
+	}
+	return candidates[len(candidates)-1]
+}
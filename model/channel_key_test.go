@@ -0,0 +1,147 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func setupChannelKeyTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Channel{}, &Ability{}, &ChannelKey{}))
+
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	originalUsingSQLite := common.UsingSQLite.Load()
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() { common.UsingSQLite.Store(originalUsingSQLite) })
+}
+
+func TestSplitChannelKeys(t *testing.T) {
+	keys := SplitChannelKeys("sk-a\n\n  sk-b  \nsk-a\r\nsk-c")
+	assert.Equal(t, []string{"sk-a", "sk-b", "sk-c"}, keys)
+	assert.Empty(t, SplitChannelKeys(" \n "))
+}
+
+func TestChannelSyncKeys_PreservesState(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	channel := &Channel{Id: 1, Name: "pool", Key: "sk-a\nsk-b", KeyMode: ChannelKeyModeRoundRobin}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.SyncKeys())
+
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	// disable sk-a, then replace sk-b with sk-c
+	require.NoError(t, UpdateChannelKeyStatus(keys[0].Id, ChannelKeyStatusAutoDisabled, "invalid key"))
+	channel.Key = "sk-a\nsk-c"
+	require.NoError(t, channel.SyncKeys())
+
+	keys, err = GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "sk-a", keys[0].Key)
+	assert.Equal(t, ChannelKeyStatusAutoDisabled, keys[0].Status)
+	assert.Equal(t, "invalid key", keys[0].DisabledReason)
+	assert.Equal(t, "sk-c", keys[1].Key)
+	assert.Equal(t, ChannelKeyStatusEnabled, keys[1].Status)
+
+	// switching back to single-key mode drops the pool
+	channel.KeyMode = ChannelKeyModeSingle
+	require.NoError(t, channel.SyncKeys())
+	keys, err = GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestSelectChannelKey_RoundRobinSkipsUnavailable(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	channel := &Channel{Id: 2, Name: "pool", Key: "sk-a\nsk-b\nsk-c", KeyMode: ChannelKeyModeRoundRobin}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.SyncKeys())
+
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	require.NoError(t, SuspendChannelKey(context.Background(), keys[1].Id, time.Minute))
+
+	seen := make(map[string]int)
+	for range 6 {
+		key, err := SelectChannelKey(channel)
+		require.NoError(t, err)
+		seen[key.Key]++
+	}
+	assert.Equal(t, 3, seen["sk-a"])
+	assert.Equal(t, 3, seen["sk-c"])
+	assert.Zero(t, seen["sk-b"])
+
+	available, err := CountAvailableChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 2, available)
+
+	// re-enabling clears the cooldown
+	require.NoError(t, UpdateChannelKeyStatus(keys[1].Id, ChannelKeyStatusEnabled, ""))
+	available, err = CountAvailableChannelKeys(channel.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 3, available)
+}
+
+func TestSelectChannelKey_AllUnavailable(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	channel := &Channel{Id: 3, Name: "pool", Key: "sk-a", KeyMode: ChannelKeyModeWeighted}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.SyncKeys())
+
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	require.NoError(t, UpdateChannelKeyStatus(keys[0].Id, ChannelKeyStatusManuallyDisabled, ""))
+
+	_, err = SelectChannelKey(channel)
+	assert.Error(t, err)
+}
+
+func TestSelectPreferredChannelKey(t *testing.T) {
+	setupChannelKeyTestDB(t)
+
+	channel := &Channel{Id: 4, Name: "pool", Key: "sk-a\nsk-b\nsk-c", KeyMode: ChannelKeyModeRoundRobin}
+	require.NoError(t, DB.Create(channel).Error)
+	require.NoError(t, channel.SyncKeys())
+
+	keys, err := GetChannelKeys(channel.Id)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	// the preferred key keeps serving instead of rotating
+	for range 3 {
+		key, err := SelectPreferredChannelKey(channel, keys[1].Id)
+		require.NoError(t, err)
+		assert.Equal(t, "sk-b", key.Key)
+	}
+
+	// a cooling down key is not preferred
+	require.NoError(t, SuspendChannelKey(context.Background(), keys[1].Id, time.Minute))
+	key, err := SelectPreferredChannelKey(channel, keys[1].Id)
+	require.NoError(t, err)
+	assert.NotEqual(t, "sk-b", key.Key)
+}
+
+func TestPickWeightedChannelKey_ZeroWeightStillEligible(t *testing.T) {
+	candidates := []*ChannelKey{{Id: 1, Weight: 0}}
+	assert.Equal(t, 1, pickWeightedChannelKey(candidates).Id)
+}
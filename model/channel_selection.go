@@ -0,0 +1,299 @@
+package model
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+const (
+	// ChannelSelectionRandom picks uniformly within the priority tier (default).
+	ChannelSelectionRandom = "random"
+	// ChannelSelectionWeighted picks randomly in proportion to Channel.Weight (0 counts as 1).
+	ChannelSelectionWeighted = "weighted"
+	// ChannelSelectionLeastLatency prefers the channel with the lowest observed relay latency,
+	// penalized by its recent error rate.
+	ChannelSelectionLeastLatency = "least_latency"
+	// ChannelSelectionLeastInFlight prefers the channel with the fewest requests in flight,
+	// as counted by the Prometheus channel gauge; it needs Prometheus metrics enabled.
+	ChannelSelectionLeastInFlight = "least_inflight"
+	// ChannelSelectionConsistentHash pins each user to one channel of the tier, so upstream
+	// prompt caches keep hitting. Only the users of a removed channel move elsewhere.
+	ChannelSelectionConsistentHash = "consistent_hash"
+)
+
+const (
+	// channelStatsAlpha is the EWMA smoothing factor for relay latency and error rate.
+	channelStatsAlpha = 0.2
+	// leastLatencyExploreRate is the share of least_latency picks made at random, so slow
+	// channels keep being measured and can win traffic back once they recover.
+	leastLatencyExploreRate = 0.05
+)
+
+var channelSelectionLock sync.RWMutex
+
+// channelAvailable reports whether a channel may serve a model right now, nil allowing all.
+var channelAvailable func(channelId int, model string) bool
+
+// SetChannelAvailabilityCheck installs the check the memory cache uses to skip channels that
+// are unhealthy for a model, such as the monitor's circuit breaker. It must be called before
+// requests are served.
+func SetChannelAvailabilityCheck(check func(channelId int, model string) bool) {
+	channelAvailable = check
+}
+
+// isChannelAvailable reports whether the channel passes the installed availability check.
+func isChannelAvailable(channelId int, model string) bool {
+	return channelAvailable == nil || model == "" || channelAvailable(channelId, model)
+}
+
+// ChannelSelectionStrategies maps a scope to a selection strategy. Scopes are, from most to
+// least specific, "group:model", "*:model", "group" and "*".
+var ChannelSelectionStrategies = map[string]string{}
+
+// ValidChannelSelectionStrategy reports whether s names a known strategy.
+func ValidChannelSelectionStrategy(s string) bool {
+	switch s {
+	case ChannelSelectionRandom, ChannelSelectionWeighted, ChannelSelectionLeastLatency,
+		ChannelSelectionLeastInFlight, ChannelSelectionConsistentHash:
+		return true
+	default:
+		return false
+	}
+}
+
+func ChannelSelectionStrategies2JSONString() string {
+	channelSelectionLock.RLock()
+	defer channelSelectionLock.RUnlock()
+	jsonBytes, err := json.Marshal(ChannelSelectionStrategies)
+	if err != nil {
+		logger.Logger.Error("error marshalling channel selection strategies", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// ParseChannelSelectionStrategies parses the strategy option and validates every strategy in it.
+func ParseChannelSelectionStrategies(jsonStr string) (map[string]string, error) {
+	strategies := map[string]string{}
+	if strings.TrimSpace(jsonStr) != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &strategies); err != nil {
+			return nil, errors.Wrap(err, "unmarshal channel selection strategies")
+		}
+	}
+	for scope, strategy := range strategies {
+		if !ValidChannelSelectionStrategy(strategy) {
+			return nil, errors.Errorf("unknown channel selection strategy %q for %q", strategy, scope)
+		}
+	}
+	return strategies, nil
+}
+
+func UpdateChannelSelectionStrategiesByJSONString(jsonStr string) error {
+	strategies, err := ParseChannelSelectionStrategies(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	channelSelectionLock.Lock()
+	defer channelSelectionLock.Unlock()
+	ChannelSelectionStrategies = strategies
+	return nil
+}
+
+// GetChannelSelectionStrategy returns the strategy configured for the group and model.
+func GetChannelSelectionStrategy(group string, model string) string {
+	channelSelectionLock.RLock()
+	defer channelSelectionLock.RUnlock()
+	for _, scope := range []string{group + ":" + model, "*:" + model, group, "*"} {
+		if strategy, ok := ChannelSelectionStrategies[scope]; ok {
+			return strategy
+		}
+	}
+	return ChannelSelectionRandom
+}
+
+// channelStats holds the in-process health observations of one channel.
+type channelStats struct {
+	mu        sync.Mutex
+	latencyMs float64 // EWMA of successful relay durations, 0 until the first sample
+	errorRate float64 // EWMA of failed (429/5xx) relays
+}
+
+var channelStatsById sync.Map // map[int]*channelStats
+
+func getChannelStats(channelId int) *channelStats {
+	stats, _ := channelStatsById.LoadOrStore(channelId, &channelStats{})
+	return stats.(*channelStats)
+}
+
+// ObserveChannelRequest records the outcome of a relay on the channel. Successful requests
+// feed the latency average when observeLatency is set, 429 and 5xx raise the error rate, and
+// other client errors are ignored.
+func ObserveChannelRequest(channelId int, startTime time.Time, statusCode int, observeLatency bool) {
+	if channelId <= 0 {
+		return
+	}
+	stats := getChannelStats(channelId)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+
+	failed := statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	if failed {
+		stats.errorRate += channelStatsAlpha * (1 - stats.errorRate)
+		return
+	}
+	if statusCode >= http.StatusBadRequest {
+		return
+	}
+	stats.errorRate -= channelStatsAlpha * stats.errorRate
+	if !observeLatency {
+		return
+	}
+	elapsed := float64(time.Since(startTime).Milliseconds())
+	if stats.latencyMs == 0 {
+		stats.latencyMs = elapsed
+	} else {
+		stats.latencyMs += channelStatsAlpha * (elapsed - stats.latencyMs)
+	}
+}
+
+// ChannelMetricName is the channel_name label of the per-channel request metrics.
+func ChannelMetricName(channelId int) string {
+	return "channel_" + strconv.Itoa(channelId) // We might want to get actual channel name from DB
+}
+
+// channelRequestsInFlight reads the in-flight gauge that the relay monitor keeps for the
+// channel. It is always 0 while Prometheus metrics are disabled, so least_inflight then
+// degrades to a random pick.
+func channelRequestsInFlight(ch *Channel) float64 {
+	return metrics.GlobalRecorder.GetChannelRequestsInFlight(ch.Id, ChannelMetricName(ch.Id), channeltype.IdToName(ch.Type))
+}
+
+// ChannelSelectionStats is a snapshot of the observations used by the selection strategies.
+type ChannelSelectionStats struct {
+	LatencyMs float64 `json:"latency_ms"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// GetChannelSelectionStats returns the current observations for a channel.
+func GetChannelSelectionStats(channelId int) ChannelSelectionStats {
+	stats := getChannelStats(channelId)
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	return ChannelSelectionStats{
+		LatencyMs: stats.latencyMs,
+		ErrorRate: stats.errorRate,
+	}
+}
+
+// pickChannel chooses one of the candidates, which all belong to the same priority tier.
+// affinityKey identifies the caller for the consistent_hash strategy.
+func pickChannel(strategy string, candidates []*Channel, affinityKey string) *Channel {
+	switch {
+	case len(candidates) == 0:
+		return nil
+	case len(candidates) == 1:
+		return candidates[0]
+	}
+
+	switch strategy {
+	case ChannelSelectionWeighted:
+		return pickWeightedChannel(candidates)
+	case ChannelSelectionLeastLatency:
+		if rand.Float64() < leastLatencyExploreRate {
+			return candidates[rand.Intn(len(candidates))]
+		}
+		return pickLowestScore(candidates, latencyScore)
+	case ChannelSelectionLeastInFlight:
+		return pickLowestScore(candidates, channelRequestsInFlight)
+	case ChannelSelectionConsistentHash:
+		if affinityKey != "" {
+			return pickRendezvousChannel(candidates, affinityKey)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+func pickWeightedChannel(candidates []*Channel) *Channel {
+	var total uint
+	for _, ch := range candidates {
+		total += channelWeight(ch)
+	}
+	n := uint(rand.Int63n(int64(total)))
+	for _, ch := range candidates {
+		w := channelWeight(ch)
+		if n < w {
+			return ch
+		}
+		n -= w
+	}
+	return candidates[len(candidates)-1]
+}
+
+func channelWeight(ch *Channel) uint {
+	if ch.Weight == nil {
+		return 1
+	}
+	return max(*ch.Weight, 1)
+}
+
+// latencyScore ranks a channel by its relay latency EWMA, falling back to the latency of the
+// last channel test. Channels without any measurement score 0 so they get explored first.
+// The score grows with the error rate, so a fast but failing channel loses its traffic.
+func latencyScore(ch *Channel) float64 {
+	stats := getChannelStats(ch.Id)
+	stats.mu.Lock()
+	latency, errorRate := stats.latencyMs, stats.errorRate
+	stats.mu.Unlock()
+	if latency == 0 {
+		latency = float64(ch.ResponseTime)
+	}
+	return latency / max(1-errorRate, 0.1)
+}
+
+// pickLowestScore returns the candidate with the lowest score, breaking ties randomly.
+func pickLowestScore(candidates []*Channel, score func(*Channel) float64) *Channel {
+	var best []*Channel
+	bestScore := 0.0
+	for _, ch := range candidates {
+		s := score(ch)
+		switch {
+		case len(best) == 0 || s < bestScore:
+			best = append(best[:0], ch)
+			bestScore = s
+		case s == bestScore:
+			best = append(best, ch)
+		}
+	}
+	return best[rand.Intn(len(best))]
+}
+
+// pickRendezvousChannel implements highest-random-weight hashing: every key ranks the
+// channels by hash(key, channel id) and takes the top one, so adding or removing a channel
+// only moves the keys that ranked it first.
+func pickRendezvousChannel(candidates []*Channel, affinityKey string) *Channel {
+	var best *Channel
+	var bestHash uint64
+	for _, ch := range candidates {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(affinityKey))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(strconv.Itoa(ch.Id)))
+		if sum := h.Sum64(); best == nil || sum > bestHash {
+			best, bestHash = ch, sum
+		}
+	}
+	return best
+}
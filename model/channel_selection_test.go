@@ -0,0 +1,153 @@
+package model
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/metrics"
+)
+
+func setChannelSelectionStrategies(t *testing.T, jsonStr string) {
+	original := ChannelSelectionStrategies2JSONString()
+	require.NoError(t, UpdateChannelSelectionStrategiesByJSONString(jsonStr))
+	t.Cleanup(func() { require.NoError(t, UpdateChannelSelectionStrategiesByJSONString(original)) })
+}
+
+// resetChannelStats forgets the observations of the candidates once the test is done.
+func resetChannelStats(t *testing.T, candidates []*Channel) {
+	t.Cleanup(func() {
+		for _, ch := range candidates {
+			channelStatsById.Delete(ch.Id)
+		}
+	})
+}
+
+func TestGetChannelSelectionStrategy(t *testing.T) {
+	setChannelSelectionStrategies(t, `{"vip:gpt-4o":"least_latency","*:claude-3-5-sonnet":"consistent_hash","vip":"weighted","*":"least_inflight"}`)
+
+	require.Equal(t, ChannelSelectionLeastLatency, GetChannelSelectionStrategy("vip", "gpt-4o"))
+	require.Equal(t, ChannelSelectionConsistentHash, GetChannelSelectionStrategy("vip", "claude-3-5-sonnet"))
+	require.Equal(t, ChannelSelectionWeighted, GetChannelSelectionStrategy("vip", "gpt-4o-mini"))
+	require.Equal(t, ChannelSelectionLeastInFlight, GetChannelSelectionStrategy("default", "gpt-4o"))
+
+	_, err := ParseChannelSelectionStrategies(`{"default":"fastest"}`)
+	require.Error(t, err)
+}
+
+func TestPickChannelWeighted(t *testing.T) {
+	heavy, light := uint(9), uint(0)
+	candidates := []*Channel{{Id: 9101, Weight: &heavy}, {Id: 9102, Weight: &light}}
+
+	counts := map[int]int{}
+	for range 2000 {
+		counts[pickChannel(ChannelSelectionWeighted, candidates, "").Id]++
+	}
+	// weight 0 counts as 1, so the split is about 9:1
+	require.Greater(t, counts[9101], 1600)
+	require.Greater(t, counts[9102], 100)
+}
+
+// inFlightRecorder serves fixed in-flight gauge values to channel selection.
+type inFlightRecorder struct {
+	metrics.NoOpRecorder
+	inFlight map[int]float64
+}
+
+func (r *inFlightRecorder) GetChannelRequestsInFlight(channelId int, channelName, channelType string) float64 {
+	return r.inFlight[channelId]
+}
+
+func TestPickChannelLeastInFlight(t *testing.T) {
+	originalRecorder := metrics.GlobalRecorder
+	metrics.GlobalRecorder = &inFlightRecorder{inFlight: map[int]float64{9201: 2, 9202: 1}}
+	t.Cleanup(func() { metrics.GlobalRecorder = originalRecorder })
+
+	candidates := []*Channel{{Id: 9201}, {Id: 9202}, {Id: 9203}}
+	for range 20 {
+		require.Equal(t, 9203, pickChannel(ChannelSelectionLeastInFlight, candidates, "").Id)
+	}
+	require.Equal(t, 9202, pickChannel(ChannelSelectionLeastInFlight, candidates[:2], "").Id)
+}
+
+func TestPickChannelLeastLatency(t *testing.T) {
+	candidates := []*Channel{{Id: 9301, ResponseTime: 100}, {Id: 9302, ResponseTime: 100}}
+	resetChannelStats(t, candidates)
+
+	ObserveChannelRequest(9301, time.Now().Add(-time.Second), http.StatusOK, true)
+	ObserveChannelRequest(9302, time.Now().Add(-200*time.Millisecond), http.StatusOK, true)
+
+	counts := map[int]int{}
+	for range 1000 {
+		counts[pickChannel(ChannelSelectionLeastLatency, candidates, "").Id]++
+	}
+	require.Greater(t, counts[9302], 900)
+
+	// a run of upstream failures makes the fast channel lose its traffic
+	for range 20 {
+		ObserveChannelRequest(9302, time.Now(), http.StatusServiceUnavailable, true)
+	}
+	require.Greater(t, GetChannelSelectionStats(9302).ErrorRate, 0.9)
+	require.Equal(t, 9301, pickLowestScore(candidates, latencyScore).Id)
+}
+
+func TestPickChannelConsistentHash(t *testing.T) {
+	candidates := []*Channel{{Id: 9401}, {Id: 9402}, {Id: 9403}, {Id: 9404}}
+
+	assigned := map[string]int{}
+	for user := range 200 {
+		key := strconv.Itoa(user)
+		assigned[key] = pickChannel(ChannelSelectionConsistentHash, candidates, key).Id
+		require.Equal(t, assigned[key], pickChannel(ChannelSelectionConsistentHash, candidates, key).Id)
+	}
+
+	// removing one channel only moves the users that were assigned to it
+	remaining := candidates[:3]
+	for key, channelId := range assigned {
+		if channelId == 9404 {
+			continue
+		}
+		require.Equal(t, channelId, pickChannel(ChannelSelectionConsistentHash, remaining, key).Id)
+	}
+}
+
+func TestCacheSelectChannelExcludingUsesStrategy(t *testing.T) {
+	originalMemoryCacheEnabled := config.MemoryCacheEnabled
+	config.MemoryCacheEnabled = true
+	t.Cleanup(func() { config.MemoryCacheEnabled = originalMemoryCacheEnabled })
+
+	testGroup, testModel := "selection-group", "selection-model"
+	channelSyncLock.Lock()
+	if group2model2channels == nil {
+		group2model2channels = make(map[string]map[string][]*Channel)
+	}
+	group2model2channels[testGroup] = map[string][]*Channel{testModel: {
+		{Id: 9501, Priority: &[]int64{10}[0]},
+		{Id: 9502, Priority: &[]int64{10}[0]},
+		{Id: 9503, Priority: &[]int64{0}[0]},
+	}}
+	channelSyncLock.Unlock()
+	t.Cleanup(func() {
+		channelSyncLock.Lock()
+		delete(group2model2channels, testGroup)
+		channelSyncLock.Unlock()
+	})
+	setChannelSelectionStrategies(t, `{"selection-group":"consistent_hash"}`)
+
+	first, err := CacheSelectChannelExcluding(testGroup, testModel, false, map[int]bool{}, false, "42")
+	require.NoError(t, err)
+	require.Contains(t, []int{9501, 9502}, first.Id)
+	for range 10 {
+		again, err := CacheSelectChannelExcluding(testGroup, testModel, false, map[int]bool{}, false, "42")
+		require.NoError(t, err)
+		require.Equal(t, first.Id, again.Id)
+	}
+
+	lower, err := CacheSelectChannelExcluding(testGroup, testModel, true, map[int]bool{}, false, "42")
+	require.NoError(t, err)
+	require.Equal(t, 9503, lower.Id)
+}
@@ -0,0 +1,313 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Sources of credit grants.
+const (
+	CreditSourceSignup     = "signup"
+	CreditSourceInvitation = "invitation"
+	CreditSourceRedemption = "redemption"
+	CreditSourcePromotion  = "promotion"
+	CreditSourceTopUp      = "top_up"
+	CreditSourceAdmin      = "admin"
+)
+
+// Orders in which usage draws credit grants down, see config.CreditGrantDrawOrder.
+const (
+	CreditDrawOrderExpiringFirst = "expiring_first"
+	CreditDrawOrderFIFO          = "fifo"
+)
+
+const (
+	creditGrantExpiryInterval  = time.Minute
+	creditGrantExpiryBatchSize = 500
+)
+
+// promotionalCreditSources are the sources of credit given away rather than paid for.
+var promotionalCreditSources = map[string]bool{
+	CreditSourceSignup:     true,
+	CreditSourceInvitation: true,
+	CreditSourcePromotion:  true,
+}
+
+// CreditGrant is one addition of credit to a user's quota, drawn down by the user's usage.
+//
+// The user's quota stays the balance that requests are checked against; grants attribute it
+// to where it came from. Balances from before grants were recorded, or set directly by an
+// admin, are not attributed to any grant: they never expire and are drawn last.
+type CreditGrant struct {
+	Id     int    `json:"id"`
+	UserId int    `json:"user_id" gorm:"index"`
+	Source string `json:"source" gorm:"type:varchar(32);index"`
+	// Reference identifies what the grant came from, e.g. the redemption code id.
+	Reference string `json:"reference" gorm:"type:varchar(64);default:''"`
+	Amount    int64  `json:"amount" gorm:"bigint"`
+	Remaining int64  `json:"remaining" gorm:"bigint"`
+	// Expired is what was left of the grant when it expired.
+	Expired int64 `json:"expired" gorm:"bigint;default:0"`
+	// Priority orders draw-down: grants with a higher priority are used first.
+	Priority int `json:"priority" gorm:"default:0"`
+	// ExpiresAt is when the remaining credit is forfeited, in unix seconds; 0 never expires.
+	ExpiresAt int64 `json:"expires_at" gorm:"bigint;default:0;index"`
+	CreatedAt int64 `json:"created_at" gorm:"bigint;autoCreateTime"`
+	UpdatedAt int64 `json:"updated_at" gorm:"bigint;autoUpdateTime"`
+}
+
+// CreditGrantSummary totals the grants of one source.
+type CreditGrantSummary struct {
+	Source      string `json:"source"`
+	Promotional bool   `json:"promotional"`
+	Granted     int64  `json:"granted"`
+	Outstanding int64  `json:"outstanding"`
+	Expired     int64  `json:"expired"`
+}
+
+// IsPromotionalCreditSource reports whether credit of source was given away rather than paid for.
+func IsPromotionalCreditSource(source string) bool {
+	return promotionalCreditSources[source]
+}
+
+// GrantCredit adds the grant's amount to the user's quota and records the grant.
+func GrantCredit(ctx context.Context, grant *CreditGrant) error {
+	err := runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			return grantCredit(tx, grant)
+		})
+	})
+	if err != nil {
+		return errors.Wrapf(err, "grant credit to user %d", grant.UserId)
+	}
+	invalidateUserCache(ctx, grant.UserId)
+	return nil
+}
+
+// grantCredit adds the grant's amount to the user's quota and records the grant within tx.
+func grantCredit(tx *gorm.DB, grant *CreditGrant) error {
+	if grant.Amount <= 0 {
+		return errors.New("credit amount must be positive")
+	}
+	result := tx.Model(&User{}).Where("id = ?", grant.UserId).Update("quota", gorm.Expr("quota + ?", grant.Amount))
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "increase quota for user %d", grant.UserId)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("user %d not found", grant.UserId)
+	}
+	return recordCreditGrant(tx, grant)
+}
+
+// recordCreditGrant records a grant for credit already added to the user's quota.
+func recordCreditGrant(tx *gorm.DB, grant *CreditGrant) error {
+	if grant.Amount <= 0 {
+		return errors.New("credit amount must be positive")
+	}
+	if grant.Source == "" {
+		grant.Source = CreditSourceAdmin
+	}
+	grant.Id = 0
+	grant.Remaining = grant.Amount
+	grant.Expired = 0
+	if err := tx.Create(grant).Error; err != nil {
+		return errors.Wrapf(err, "record credit grant for user %d", grant.UserId)
+	}
+	return nil
+}
+
+// creditGrantDrawOrder is the order grants are drawn down in.
+func creditGrantDrawOrder() string {
+	if config.CreditGrantDrawOrder == CreditDrawOrderFIFO {
+		return "priority desc, id asc"
+	}
+	return "priority desc, CASE WHEN expires_at = 0 THEN 1 ELSE 0 END, expires_at asc, id asc"
+}
+
+// applyCreditGrantDelta follows a change of the user's quota by usage on the user's grants:
+// charges (negative delta) draw the active grants down in draw order, and refunds (positive
+// delta) give back to the drawn grants in reverse order. What the grants cannot absorb is
+// taken from, or returned to, the unattributed balance.
+func applyCreditGrantDelta(tx *gorm.DB, userId int, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+
+	var grants []CreditGrant
+	query := tx.Where("user_id = ? AND (expires_at = 0 OR expires_at > ?)", userId, helper.GetTimestamp())
+	if delta < 0 {
+		query = query.Where("remaining > 0").Order(creditGrantDrawOrder())
+	} else {
+		query = query.Where("remaining < amount").Order(creditGrantDrawOrder())
+	}
+	if err := query.Find(&grants).Error; err != nil {
+		return errors.Wrapf(err, "list credit grants of user %d", userId)
+	}
+
+	if delta < 0 {
+		amount := -delta
+		for i := 0; i < len(grants) && amount > 0; i++ {
+			take := min(grants[i].Remaining, amount)
+			result := tx.Model(&CreditGrant{}).Where("id = ? AND remaining >= ?", grants[i].Id, take).
+				Update("remaining", gorm.Expr("remaining - ?", take))
+			if result.Error != nil {
+				return errors.Wrapf(result.Error, "draw credit grant %d", grants[i].Id)
+			}
+			if result.RowsAffected > 0 {
+				amount -= take
+			}
+		}
+		return nil
+	}
+
+	amount := delta
+	for i := len(grants) - 1; i >= 0 && amount > 0; i-- {
+		give := min(grants[i].Amount-grants[i].Remaining, amount)
+		result := tx.Model(&CreditGrant{}).Where("id = ? AND remaining + ? <= amount", grants[i].Id, give).
+			Update("remaining", gorm.Expr("remaining + ?", give))
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "refund credit grant %d", grants[i].Id)
+		}
+		if result.RowsAffected > 0 {
+			amount -= give
+		}
+	}
+	return nil
+}
+
+// RecordQuotaAdjustment accounts a direct change of the user's quota, such as an admin
+// editing it, on the user's grants: increases are recorded as admin grants and decreases
+// draw the grants down.
+func RecordQuotaAdjustment(ctx context.Context, userId int, delta int64) error {
+	err := runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			if delta > 0 {
+				return recordCreditGrant(tx, &CreditGrant{UserId: userId, Source: CreditSourceAdmin, Amount: delta})
+			}
+			return applyCreditGrantDelta(tx, userId, delta)
+		})
+	})
+	if err != nil {
+		return errors.Wrapf(err, "record quota adjustment of user %d", userId)
+	}
+	return nil
+}
+
+// GetUserCreditGrants lists the user's grants, newest first. With activeOnly, grants that
+// are used up or expired are left out.
+func GetUserCreditGrants(userId int, activeOnly bool, startIdx int, num int) (grants []*CreditGrant, total int64, err error) {
+	db := DB.Model(&CreditGrant{}).Where("user_id = ?", userId)
+	if activeOnly {
+		db = db.Where("remaining > 0 AND (expires_at = 0 OR expires_at > ?)", helper.GetTimestamp())
+	}
+	if err = db.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "count credit grants of user %d", userId)
+	}
+	if err = db.Order("id desc").Limit(num).Offset(startIdx).Find(&grants).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "list credit grants of user %d", userId)
+	}
+	return grants, total, nil
+}
+
+// SummarizeCreditGrants totals all grants by source: how much was granted, how much is still
+// outstanding and how much expired unused.
+func SummarizeCreditGrants() ([]CreditGrantSummary, error) {
+	var summaries []CreditGrantSummary
+	err := DB.Model(&CreditGrant{}).
+		Select("source, SUM(amount) AS granted, SUM(remaining) AS outstanding, SUM(expired) AS expired").
+		Group("source").Order("source").
+		Scan(&summaries).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "summarize credit grants")
+	}
+	for i := range summaries {
+		summaries[i].Promotional = IsPromotionalCreditSource(summaries[i].Source)
+	}
+	return summaries, nil
+}
+
+// ExpireCreditGrants forfeits what is left of the grants that expired by now and takes it off
+// their users' quota. It is safe to run on several nodes at once.
+func ExpireCreditGrants(ctx context.Context, now int64) (expired int, err error) {
+	var grants []CreditGrant
+	err = DB.Where("remaining > 0 AND expires_at > 0 AND expires_at <= ?", now).
+		Order("expires_at asc").Limit(creditGrantExpiryBatchSize).Find(&grants).Error
+	if err != nil {
+		return 0, errors.Wrap(err, "list expired credit grants")
+	}
+
+	for _, grant := range grants {
+		var forfeited int64
+		err := runWithSQLiteBusyRetry(ctx, func() error {
+			return DB.Transaction(func(tx *gorm.DB) error {
+				// another node may have expired or drawn the grant meanwhile
+				result := tx.Model(&CreditGrant{}).Where("id = ? AND remaining = ?", grant.Id, grant.Remaining).
+					Updates(map[string]any{"remaining": 0, "expired": gorm.Expr("expired + ?", grant.Remaining)})
+				if result.Error != nil {
+					return errors.Wrapf(result.Error, "expire credit grant %d", grant.Id)
+				}
+				if result.RowsAffected == 0 {
+					return nil
+				}
+				err := tx.Model(&User{}).Where("id = ?", grant.UserId).
+					Update("quota", gorm.Expr("CASE WHEN quota > ? THEN quota - ? ELSE 0 END", grant.Remaining, grant.Remaining)).Error
+				if err != nil {
+					return errors.Wrapf(err, "decrease quota for user %d", grant.UserId)
+				}
+				forfeited = grant.Remaining
+				return nil
+			})
+		})
+		if err != nil {
+			return expired, err
+		}
+		if forfeited == 0 {
+			continue
+		}
+
+		expired++
+		invalidateUserCache(ctx, grant.UserId)
+		RecordLog(ctx, grant.UserId, LogTypeSystem, fmt.Sprintf("%s of %s credit expired unused", common.LogQuota(forfeited), grant.Source))
+	}
+	return expired, nil
+}
+
+// StartCreditGrantExpiry launches a background worker that expires credit grants once their
+// expiry passes.
+func StartCreditGrantExpiry(ctx context.Context) {
+	expire := func() {
+		expired, err := ExpireCreditGrants(ctx, helper.GetTimestamp())
+		if err != nil {
+			logger.Logger.Warn("credit grant expiry failed", zap.Error(err))
+			return
+		}
+		if expired > 0 {
+			logger.Logger.Info("expired credit grants", zap.Int("grants", expired))
+		}
+	}
+
+	ticker := time.NewTicker(creditGrantExpiryInterval)
+	go func() {
+		defer ticker.Stop()
+		expire()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Logger.Info("credit grant expiry stopped")
+				return
+			case <-ticker.C:
+				expire()
+			}
+		}
+	}()
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+func setupCreditGrantTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&User{}, &CreditGrant{}, &Redemption{}, &Log{}))
+
+	originalDB, originalLogDB := DB, LOG_DB
+	DB, LOG_DB = db, db
+	t.Cleanup(func() { DB, LOG_DB = originalDB, originalLogDB })
+
+	originalUsingSQLite := common.UsingSQLite.Load()
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() { common.UsingSQLite.Store(originalUsingSQLite) })
+
+	originalBatchUpdate := config.BatchUpdateEnabled
+	config.BatchUpdateEnabled = false
+	t.Cleanup(func() { config.BatchUpdateEnabled = originalBatchUpdate })
+}
+
+func creditGrantRemaining(t *testing.T, userId int) map[string]int64 {
+	t.Helper()
+	var grants []CreditGrant
+	require.NoError(t, DB.Where("user_id = ?", userId).Find(&grants).Error)
+	remaining := make(map[string]int64)
+	for _, grant := range grants {
+		remaining[grant.Source] += grant.Remaining
+	}
+	return remaining
+}
+
+func TestCreditGrantDrawDown(t *testing.T) {
+	setupCreditGrantTestDB(t)
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice", Quota: 100}).Error)
+
+	require.NoError(t, GrantCredit(ctx, &CreditGrant{UserId: 1, Source: CreditSourceTopUp, Amount: 300}))
+	require.NoError(t, GrantCredit(ctx, &CreditGrant{UserId: 1, Source: CreditSourcePromotion, Amount: 200, ExpiresAt: now + 3600}))
+	quota, err := GetUserQuota(1)
+	require.NoError(t, err)
+	require.Equal(t, int64(600), quota)
+
+	// the expiring promotion is used before the top-up, the unattributed balance last
+	require.NoError(t, DecreaseUserQuota(1, 250))
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 250, CreditSourcePromotion: 0}, creditGrantRemaining(t, 1))
+
+	// refunds go back to the last grant drawn
+	require.NoError(t, IncreaseUserQuota(1, 30))
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 280, CreditSourcePromotion: 0}, creditGrantRemaining(t, 1))
+	require.NoError(t, IncreaseUserQuota(1, 20))
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 300, CreditSourcePromotion: 0}, creditGrantRemaining(t, 1))
+
+	require.NoError(t, DecreaseUserQuota(1, 350))
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 0, CreditSourcePromotion: 0}, creditGrantRemaining(t, 1))
+	quota, err = GetUserQuota(1)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), quota)
+
+	// higher priorities are drawn first, whatever the order
+	require.NoError(t, GrantCredit(ctx, &CreditGrant{UserId: 1, Source: CreditSourceAdmin, Amount: 50, ExpiresAt: now + 60}))
+	require.NoError(t, GrantCredit(ctx, &CreditGrant{UserId: 1, Source: CreditSourceTopUp, Amount: 50, Priority: 1}))
+	require.NoError(t, DecreaseUserQuota(1, 40))
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 10, CreditSourceAdmin: 50, CreditSourcePromotion: 0}, creditGrantRemaining(t, 1))
+}
+
+func TestExpireCreditGrants(t *testing.T) {
+	setupCreditGrantTestDB(t)
+	ctx := context.Background()
+	now := helper.GetTimestamp()
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice"}).Error)
+	require.NoError(t, DB.Create(&Redemption{Id: 7, Key: "promo-key", Name: "promo", Quota: 500,
+		CreditSource: CreditSourcePromotion, CreditValidDays: 1}).Error)
+
+	redeemed, err := Redeem(ctx, "promo-key", 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(500), redeemed)
+	require.NoError(t, GrantCredit(ctx, &CreditGrant{UserId: 1, Source: CreditSourceTopUp, Amount: 100}))
+	require.NoError(t, DecreaseUserQuota(1, 200))
+
+	expired, err := ExpireCreditGrants(ctx, now+2*24*3600)
+	require.NoError(t, err)
+	require.Equal(t, 1, expired)
+	quota, err := GetUserQuota(1)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), quota)
+
+	// expiring again is a no-op
+	expired, err = ExpireCreditGrants(ctx, now+2*24*3600)
+	require.NoError(t, err)
+	require.Zero(t, expired)
+
+	summaries, err := SummarizeCreditGrants()
+	require.NoError(t, err)
+	require.Equal(t, []CreditGrantSummary{
+		{Source: CreditSourcePromotion, Promotional: true, Granted: 500, Outstanding: 0, Expired: 300},
+		{Source: CreditSourceTopUp, Granted: 100, Outstanding: 100},
+	}, summaries)
+}
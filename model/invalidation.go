@@ -0,0 +1,151 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/blacklist"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/eventbus"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// channelCacheReloadDelay coalesces the channel cache reloads requested in a burst, e.g. by
+// a batch of channel edits on another node, into a single one.
+const channelCacheReloadDelay = time.Second
+
+var channelCacheReloadPending atomic.Bool
+
+// abilitySuspension is the payload of eventbus.TopicAbilitySuspended.
+type abilitySuspension struct {
+	Group     string `json:"group"`
+	Model     string `json:"model"`
+	ChannelId int    `json:"channel_id"`
+	Until     int64  `json:"until"`
+}
+
+func init() {
+	eventbus.Subscribe(eventbus.TopicChannels, func(string) {
+		if config.MemoryCacheEnabled {
+			requestChannelCacheReload()
+		}
+	})
+	eventbus.Subscribe(eventbus.TopicAbilitySuspended, func(key string) {
+		var suspension abilitySuspension
+		if err := json.Unmarshal([]byte(key), &suspension); err != nil {
+			logger.Logger.Warn("invalid ability suspension event", zap.String("key", key), zap.Error(err))
+			return
+		}
+		suspendCachedAbility(suspension)
+	})
+	eventbus.Subscribe(eventbus.TopicChannelKeys, func(key string) {
+		if channelId, err := strconv.Atoi(key); err == nil {
+			dropChannelKeysCache(channelId)
+		}
+	})
+	eventbus.Subscribe(eventbus.TopicOptions, reloadOption)
+	eventbus.Subscribe(eventbus.TopicUsers, func(key string) {
+		if userId, err := strconv.Atoi(key); err == nil {
+			refreshUserBan(userId)
+		}
+	})
+}
+
+// refreshChannelCache reloads the channel cache after a channel mutation and has the other
+// nodes reload theirs.
+func refreshChannelCache() {
+	InitChannelCache()
+	eventbus.Publish(context.Background(), eventbus.TopicChannels, "")
+}
+
+// requestChannelCacheReload reloads the channel cache shortly, once for all the requests
+// made meanwhile.
+func requestChannelCacheReload() {
+	if !channelCacheReloadPending.CompareAndSwap(false, true) {
+		return
+	}
+	time.AfterFunc(channelCacheReloadDelay, func() {
+		channelCacheReloadPending.Store(false)
+		InitChannelCache()
+	})
+}
+
+// suspendCachedAbility stops selecting the channel for the group and model until the
+// suspension is over, when the channel cache is reloaded to bring it back.
+func suspendCachedAbility(suspension abilitySuspension) {
+	if !config.MemoryCacheEnabled {
+		return
+	}
+	channelSyncLock.Lock()
+	channels := group2model2channels[suspension.Group][suspension.Model]
+	kept := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Id != suspension.ChannelId {
+			kept = append(kept, channel)
+		}
+	}
+	if len(kept) != len(channels) {
+		group2model2channels[suspension.Group][suspension.Model] = kept
+	}
+	channelSyncLock.Unlock()
+
+	time.AfterFunc(time.Until(time.Unix(suspension.Until, 0)), requestChannelCacheReload)
+}
+
+// publishAbilitySuspension applies a suspension to the channel cache of every node.
+func publishAbilitySuspension(ctx context.Context, group string, modelName string, channelId int, until time.Time) {
+	suspension := abilitySuspension{Group: group, Model: modelName, ChannelId: channelId, Until: until.Unix()}
+	suspendCachedAbility(suspension)
+	payload, err := json.Marshal(suspension)
+	if err != nil {
+		logger.Logger.Error("failed to marshal ability suspension", zap.Error(err))
+		return
+	}
+	eventbus.Publish(ctx, eventbus.TopicAbilitySuspended, string(payload))
+}
+
+// reloadOption applies the value of an option changed by another node.
+func reloadOption(key string) {
+	var option Option
+	if err := DB.Where(&Option{Key: key}).First(&option).Error; err != nil {
+		logger.Logger.Warn("failed to reload option", zap.String("key", key), zap.Error(err))
+		return
+	}
+	if err := updateOptionMap(option.Key, option.Value); err != nil {
+		logger.Logger.Error("failed to update option map", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// refreshUserBan aligns the in-memory ban of a user with the user's status.
+func refreshUserBan(userId int) {
+	enabled, err := IsUserEnabled(userId)
+	if err != nil {
+		logger.Logger.Warn("failed to refresh user status", zap.Int("user_id", userId), zap.Error(err))
+		return
+	}
+	if enabled {
+		blacklist.UnbanUser(userId)
+	} else {
+		blacklist.BanUser(userId)
+	}
+}
+
+// invalidateUserCache drops the cached state of a user after a mutation: the Redis entries
+// shared by all nodes, and the in-memory ban of the other nodes.
+func invalidateUserCache(ctx context.Context, userId int) {
+	if common.IsRedisEnabled() {
+		for _, key := range []string{"user_group:%d", "user_enabled:%d", "user_quota:%d"} {
+			if err := common.RedisDel(ctx, fmt.Sprintf(key, userId)); err != nil {
+				logger.Logger.Warn("failed to clear user cache, continuing", zap.Int("user_id", userId), zap.Error(err))
+			}
+		}
+	}
+	eventbus.Publish(ctx, eventbus.TopicUsers, strconv.Itoa(userId))
+}
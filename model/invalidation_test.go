@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func TestSuspendCachedAbility(t *testing.T) {
+	originalMemoryCacheEnabled := config.MemoryCacheEnabled
+	originalCache := group2model2channels
+	config.MemoryCacheEnabled = true
+	t.Cleanup(func() {
+		config.MemoryCacheEnabled = originalMemoryCacheEnabled
+		group2model2channels = originalCache
+	})
+
+	group2model2channels = map[string]map[string][]*Channel{
+		"default": {
+			"gpt-4o":      {{Id: 1}, {Id: 2}, {Id: 3}},
+			"gpt-4o-mini": {{Id: 1}, {Id: 2}},
+		},
+	}
+	// far enough in the future for the reload not to run during the test
+	until := time.Now().Add(time.Hour).Unix()
+
+	suspendCachedAbility(abilitySuspension{Group: "default", Model: "gpt-4o", ChannelId: 2, Until: until})
+	channels, err := GetChannelsFromCache("default", "gpt-4o")
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+	require.Equal(t, 1, channels[0].Id)
+	require.Equal(t, 3, channels[1].Id)
+
+	// the channel keeps serving the other models
+	channels, err = GetChannelsFromCache("default", "gpt-4o-mini")
+	require.NoError(t, err)
+	require.Len(t, channels, 2)
+
+	// unknown groups and models are ignored
+	suspendCachedAbility(abilitySuspension{Group: "vip", Model: "gpt-4o", ChannelId: 1, Until: until})
+	suspendCachedAbility(abilitySuspension{Group: "default", Model: "o3", ChannelId: 1, Until: until})
+}
@@ -15,7 +15,10 @@ import (
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/helper"
 	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/logship"
 	"github.com/songquanpeng/one-api/dto"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
 )
 
 type Log struct {
@@ -25,6 +28,7 @@ type Log struct {
 	Type              int    `json:"type" gorm:"index:idx_created_at_type"`
 	Content           string `json:"content"`
 	Username          string `json:"username" gorm:"index:index_username_model_name,priority:2;default:''"`
+	TokenId           int    `json:"token_id" gorm:"index;default:0"`
 	TokenName         string `json:"token_name" gorm:"index;default:''"`
 	ModelName         string `json:"model_name" gorm:"index;index:index_username_model_name,priority:1;default:''"`
 	Quota             int    `json:"quota" gorm:"default:0;index"`             // Added index for sorting
@@ -56,6 +60,26 @@ const (
 	LogMetadataKeyCacheWrite5m = "ephemeral_5m"
 	// LogMetadataKeyCacheWrite1h records the count of 1-hour window cache write tokens.
 	LogMetadataKeyCacheWrite1h = "ephemeral_1h"
+	// LogMetadataKeyModalityTokens groups raw token counts per modality (text/audio) for sessions
+	// such as Realtime where audio tokens are billed at a different rate than text tokens.
+	LogMetadataKeyModalityTokens = "modality_tokens"
+	// LogMetadataKeyCacheHit marks requests answered from the relay response cache instead of upstream.
+	LogMetadataKeyCacheHit = "cache_hit"
+	// LogMetadataKeyGuardrail lists the guardrail rules that matched the request or its response.
+	LogMetadataKeyGuardrail = "guardrail"
+	// LogMetadataKeyPromptCacheAffinity records how prompt-cache affinity routed the request, so
+	// cached prompt tokens can be compared between sticky hits and fresh selections.
+	LogMetadataKeyPromptCacheAffinity = "prompt_cache_affinity"
+	// LogMetadataKeyRerank records the documents and search units billed for a rerank request.
+	LogMetadataKeyRerank = "rerank"
+	// LogMetadataKeyHedge records how a hedged attempt ended and, on hedge logs, the user the
+	// attempt was made for.
+	LogMetadataKeyHedge = "hedge"
+	// LogMetadataKeyModelFallback records the model the client asked for when a retry policy
+	// served the request with a fallback model instead.
+	LogMetadataKeyModelFallback = "model_fallback"
+	// LogMetadataKeyPricingRule records the group pricing rule the request was billed under.
+	LogMetadataKeyPricingRule = "pricing_rule"
 )
 
 // Value converts LogMetadata to a driver-compatible JSON representation.
@@ -152,6 +176,137 @@ func AppendCacheWriteTokensMetadata(metadata LogMetadata, cacheWrite5m, cacheWri
 	return metadata
 }
 
+// AppendModalityTokensMetadata records the raw text/audio token split of a session.
+// PromptTokens/CompletionTokens on the log hold text-equivalent counts after audio ratios
+// are applied, so the split is kept here for transparency.
+func AppendModalityTokensMetadata(metadata LogMetadata, inputText, inputAudio, outputText, outputAudio int) LogMetadata {
+	if inputText == 0 && inputAudio == 0 && outputText == 0 && outputAudio == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyModalityTokens] = map[string]any{
+		"input_text":   inputText,
+		"input_audio":  inputAudio,
+		"output_text":  outputText,
+		"output_audio": outputAudio,
+	}
+	return metadata
+}
+
+// AppendCacheHitMetadata records that the reply was replayed from the response cache, how
+// old the cached reply was and which fraction of the regular price was charged.
+func AppendCacheHitMetadata(metadata LogMetadata, ageSeconds int64, quotaRatio float64) LogMetadata {
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyCacheHit] = map[string]any{
+		"age_seconds": ageSeconds,
+		"quota_ratio": quotaRatio,
+	}
+	return metadata
+}
+
+// AppendGuardrailMetadata records the guardrail violations of a request. Only rule names,
+// actions and match counts are kept; the matched content itself is never logged.
+func AppendGuardrailMetadata(metadata LogMetadata, violations []guardrail.Violation) LogMetadata {
+	if len(violations) == 0 {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyGuardrail] = violations
+	return metadata
+}
+
+// AppendPromptCacheAffinityMetadata records the affinity key source and whether the request
+// was served by the channel its key was already bound to.
+func AppendPromptCacheAffinityMetadata(metadata LogMetadata, source string, hit bool) LogMetadata {
+	if source == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyPromptCacheAffinity] = map[string]any{
+		"source": source,
+		"hit":    hit,
+	}
+	return metadata
+}
+
+// AppendRerankMetadata records how many documents a rerank request ranked and how many
+// search units it was billed for.
+func AppendRerankMetadata(metadata LogMetadata, documents, searchUnits int) LogMetadata {
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyRerank] = map[string]any{
+		"documents":    documents,
+		"search_units": searchUnits,
+	}
+	return metadata
+}
+
+// AppendHedgeMetadata records the outcome of a hedged attempt ("won", "lost" or "cancelled"),
+// plus the user it was made for when userId is set.
+func AppendHedgeMetadata(metadata LogMetadata, outcome string, userId int) LogMetadata {
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	hedge := map[string]any{"outcome": outcome}
+	if userId != 0 {
+		hedge["user_id"] = userId
+	}
+	metadata[LogMetadataKeyHedge] = hedge
+	return metadata
+}
+
+// AppendModelFallbackMetadata records the model the client requested when the request was
+// served by a fallback model; the log's model name is the one actually served.
+func AppendModelFallbackMetadata(metadata LogMetadata, requestedModel string) LogMetadata {
+	if requestedModel == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	metadata[LogMetadataKeyModelFallback] = map[string]any{
+		"requested_model": requestedModel,
+	}
+	return metadata
+}
+
+// AppendPricingRuleMetadata records the group pricing rule the request was billed under and
+// the group ratio it set, if any.
+func AppendPricingRuleMetadata(metadata LogMetadata, rule *pricingrule.Rule) LogMetadata {
+	if rule == nil {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = LogMetadata{}
+	}
+
+	applied := map[string]any{"name": rule.Name}
+	if rule.GroupRatio != nil {
+		applied["group_ratio"] = *rule.GroupRatio
+	}
+	if rule.Pricing != nil {
+		applied["model_pricing"] = true
+	}
+	metadata[LogMetadataKeyPricingRule] = applied
+	return metadata
+}
+
 const (
 	LogTypeUnknown = iota
 	LogTypeTopup
@@ -159,6 +314,9 @@ const (
 	LogTypeManage
 	LogTypeSystem
 	LogTypeTest
+	// LogTypeHedge records the upstream cost of hedged attempts that lost the race; it is
+	// owned by no user, so only admins see it.
+	LogTypeHedge
 )
 
 func GetLogOrderClause(sortBy string, sortOrder string) string {
@@ -212,6 +370,9 @@ func recordLogHelper(_ context.Context, log *Log) {
 
 		return
 	}
+	if log.Type == LogTypeConsume {
+		logship.Ship(log)
+	}
 
 	logger.Logger.Info("record log",
 		zap.Int("user_id", log.UserId),
@@ -294,6 +455,27 @@ func RecordConsumeLog(ctx context.Context, log *Log) {
 	recordLogHelper(ctx, log)
 }
 
+// RecordGuardrailLog records a request rejected by a guardrail. Blocked requests never
+// reach billing, so this system log is their only audit trail.
+func RecordGuardrailLog(ctx context.Context, log *Log) {
+	log.Username = GetUsernameById(log.UserId)
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeSystem
+	recordLogHelper(ctx, log)
+}
+
+// RecordHedgeLog records the upstream cost of a hedged attempt that lost the race. The user is
+// not charged for it, so the log moves from the user to the hedge metadata and the user's own
+// log views never show it.
+func RecordHedgeLog(ctx context.Context, log *Log, outcome string) {
+	log.Username = GetUsernameById(log.UserId)
+	log.CreatedAt = helper.GetTimestamp()
+	log.Type = LogTypeHedge
+	log.Metadata = AppendHedgeMetadata(log.Metadata, outcome, log.UserId)
+	log.UserId = 0
+	recordLogHelper(ctx, log)
+}
+
 // RecordConsumeLogWithTraceID removed: pass IDs directly and call RecordConsumeLog
 
 func RecordTestLog(ctx context.Context, log *Log) {
@@ -319,9 +501,12 @@ func RecordTestLogWithIDs(_ context.Context, log *Log, requestId string, traceId
 //
 // Returns an error if the update fails.
 var allowedConsumeLogUpdateFields = map[string]struct{}{
-	"quota":        {},
-	"content":      {},
-	"elapsed_time": {},
+	"quota":             {},
+	"content":           {},
+	"elapsed_time":      {},
+	"model_name":        {},
+	"prompt_tokens":     {},
+	"completion_tokens": {},
 }
 
 func UpdateConsumeLogByID(ctx context.Context, logID int, updates map[string]any) error {
@@ -415,11 +600,24 @@ func GetAllLogsCount(logType int, startTimestamp int64, endTimestamp int64, mode
 }
 
 func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
+	return GetUsersLogs([]int{userId}, logType, startTimestamp, endTimestamp, modelName, tokenName, startIdx, num, sortBy, sortOrder)
+}
+
+func GetUserLogsCount(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
+	return GetUsersLogsCount([]int{userId}, logType, startTimestamp, endTimestamp, modelName, tokenName)
+}
+
+// logsQuery builds the shared filter of the log listings, restricted to the logs whose
+// column (user_id or token_id) is one of ids.
+func logsQuery(column string, ids []int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) *gorm.DB {
 	var tx *gorm.DB
-	if logType == LogTypeUnknown {
-		tx = LOG_DB.Where("user_id = ?", userId)
+	if len(ids) == 1 {
+		tx = LOG_DB.Where(column+" = ?", ids[0])
 	} else {
-		tx = LOG_DB.Where("user_id = ? and type = ?", userId, logType)
+		tx = LOG_DB.Where(column+" IN ?", ids)
+	}
+	if logType != LogTypeUnknown {
+		tx = tx.Where("type = ?", logType)
 	}
 	if modelName != "" {
 		tx = tx.Where("model_name = ?", modelName)
@@ -433,7 +631,11 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	if endTimestamp != 0 {
 		tx = tx.Where("created_at <= ?", endTimestamp)
 	}
+	return tx
+}
 
+// findLogsPage returns one sorted page of the logs matched by tx.
+func findLogsPage(tx *gorm.DB, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
 	// Apply sorting with timeout for sorting queries
 	orderClause := GetLogOrderClause(sortBy, sortOrder)
 	if sortBy != "" {
@@ -446,26 +648,44 @@ func GetUserLogs(userId int, logType int, startTimestamp int64, endTimestamp int
 	return logs, err
 }
 
-func GetUserLogsCount(userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
-	var tx *gorm.DB
-	if logType == LogTypeUnknown {
-		tx = LOG_DB.Where("user_id = ?", userId)
-	} else {
-		tx = LOG_DB.Where("user_id = ? and type = ?", userId, logType)
+// GetUsersLogs lists the logs of several users.
+func GetUsersLogs(userIds []int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
+	if len(userIds) == 0 {
+		return []*Log{}, nil
 	}
-	if modelName != "" {
-		tx = tx.Where("model_name = ?", modelName)
-	}
-	if tokenName != "" {
-		tx = tx.Where("token_name = ?", tokenName)
+	return findLogsPage(logsQuery("user_id", userIds, logType, startTimestamp, endTimestamp, modelName, tokenName), startIdx, num, sortBy, sortOrder)
+}
+
+func GetUsersLogsCount(userIds []int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
+	if len(userIds) == 0 {
+		return 0, nil
 	}
-	if startTimestamp != 0 {
-		tx = tx.Where("created_at >= ?", startTimestamp)
+	tx := logsQuery("user_id", userIds, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	err = tx.Model(&Log{}).Count(&count).Error
+	return count, err
+}
+
+// GetTokensLogs lists the logs recorded for tokenIds, e.g. the tokens drawing from an
+// organization pool, narrowed to userId when it is not zero.
+func GetTokensLogs(tokenIds []int, userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string, startIdx int, num int, sortBy string, sortOrder string) (logs []*Log, err error) {
+	if len(tokenIds) == 0 {
+		return []*Log{}, nil
 	}
-	if endTimestamp != 0 {
-		tx = tx.Where("created_at <= ?", endTimestamp)
+	tx := logsQuery("token_id", tokenIds, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
 	}
+	return findLogsPage(tx, startIdx, num, sortBy, sortOrder)
+}
 
+func GetTokensLogsCount(tokenIds []int, userId int, logType int, startTimestamp int64, endTimestamp int64, modelName string, tokenName string) (count int64, err error) {
+	if len(tokenIds) == 0 {
+		return 0, nil
+	}
+	tx := logsQuery("token_id", tokenIds, logType, startTimestamp, endTimestamp, modelName, tokenName)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
 	err = tx.Model(&Log{}).Count(&count).Error
 	return count, err
 }
@@ -666,6 +886,42 @@ func SearchLogsByDayAndUser(userId, start, endExclusive int) ([]*dto.LogStatisti
 	return stats, err
 }
 
+// SearchLogsByDayAndUsers returns per-day, per-user aggregates of the logs recorded for
+// tokenIds, narrowed to userId when it is not zero, which backs the organization dashboard.
+func SearchLogsByDayAndUsers(tokenIds []int, userId int, start, endExclusive int) ([]*dto.LogStatisticByUser, error) {
+	if len(tokenIds) == 0 {
+		return []*dto.LogStatisticByUser{}, nil
+	}
+
+	userFilter := ""
+	args := []any{tokenIds}
+	if userId != 0 {
+		userFilter = "AND user_id = ?"
+		args = append(args, userId)
+	}
+	args = append(args, start, endExclusive)
+
+	query := `
+		SELECT ` + dayAggregationSelect() + `,
+		username, user_id,
+		count(1) as request_count,
+		sum(quota) as quota,
+		sum(prompt_tokens) as prompt_tokens,
+		sum(completion_tokens) as completion_tokens
+		FROM logs
+		WHERE type=2
+		AND token_id IN ?
+		` + userFilter + `
+		AND created_at >= ? AND created_at < ?
+		GROUP BY day, username, user_id
+		ORDER BY day, username
+	`
+
+	var stats []*dto.LogStatisticByUser
+	err := LOG_DB.Raw(query, args...).Scan(&stats).Error
+	return stats, err
+}
+
 // SearchLogsByDayAndToken returns per-day, per-token aggregates (scoped by
 // username to disambiguate tokens with identical names) for the half-open
 // range [start, endExclusive).
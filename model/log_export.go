@@ -0,0 +1,77 @@
+package model
+
+import (
+	"context"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+)
+
+// LogExportFilter selects the logs of an export. Zero values do not filter.
+type LogExportFilter struct {
+	// UserId restricts the export to one user's logs.
+	UserId         int
+	Type           int
+	StartTimestamp int64
+	EndTimestamp   int64
+	ModelName      string
+	Username       string
+	TokenName      string
+	Channel        int
+}
+
+func (filter LogExportFilter) query(ctx context.Context) *gorm.DB {
+	tx := LOG_DB.WithContext(ctx).Model(&Log{})
+	if filter.UserId != 0 {
+		tx = tx.Where("user_id = ?", filter.UserId)
+	}
+	if filter.Type != LogTypeUnknown {
+		tx = tx.Where("type = ?", filter.Type)
+	}
+	if filter.ModelName != "" {
+		tx = tx.Where("model_name = ?", filter.ModelName)
+	}
+	if filter.Username != "" {
+		tx = tx.Where("username = ?", filter.Username)
+	}
+	if filter.TokenName != "" {
+		tx = tx.Where("token_name = ?", filter.TokenName)
+	}
+	if filter.StartTimestamp != 0 {
+		tx = tx.Where("created_at >= ?", filter.StartTimestamp)
+	}
+	if filter.EndTimestamp != 0 {
+		tx = tx.Where("created_at <= ?", filter.EndTimestamp)
+	}
+	if filter.Channel != 0 {
+		tx = tx.Where("channel_id = ?", filter.Channel)
+	}
+	return tx
+}
+
+// StreamLogs calls fn with the logs matching filter in id order, batchSize logs at a time,
+// until the logs are exhausted or fn fails. Batches are read by id rather than by offset, so
+// long exports neither slow down page after page nor skip logs inserted meanwhile.
+func StreamLogs(ctx context.Context, filter LogExportFilter, batchSize int, fn func(logs []*Log) error) error {
+	if batchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+	lastId := 0
+	for {
+		var logs []*Log
+		err := filter.query(ctx).Where("id > ?", lastId).Order("id").Limit(batchSize).Find(&logs).Error
+		if err != nil {
+			return errors.Wrapf(err, "read logs after id %d", lastId)
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+		if err = fn(logs); err != nil {
+			return err
+		}
+		if len(logs) < batchSize {
+			return nil
+		}
+		lastId = logs[len(logs)-1].Id
+	}
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestStreamLogs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Log{}))
+	originalLogDB := LOG_DB
+	LOG_DB = db
+	t.Cleanup(func() { LOG_DB = originalLogDB })
+
+	for i := 1; i <= 7; i++ {
+		userId := 1
+		if i%2 == 0 {
+			userId = 2
+		}
+		require.NoError(t, db.Create(&Log{UserId: userId, Type: LogTypeConsume, CreatedAt: int64(i * 100), ModelName: "gpt-4o"}).Error)
+	}
+
+	var ids []int
+	var batches int
+	err = StreamLogs(context.Background(), LogExportFilter{UserId: 1, Type: LogTypeConsume}, 2, func(logs []*Log) error {
+		batches++
+		for _, log := range logs {
+			ids = append(ids, log.Id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{1, 3, 5, 7}, ids)
+	require.Equal(t, 2, batches)
+
+	ids = nil
+	err = StreamLogs(context.Background(), LogExportFilter{StartTimestamp: 200, EndTimestamp: 500}, 10, func(logs []*Log) error {
+		for _, log := range logs {
+			ids = append(ids, log.Id)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int{2, 3, 4, 5}, ids)
+
+	stop := errors.New("stop")
+	err = StreamLogs(context.Background(), LogExportFilter{}, 1, func([]*Log) error { return stop })
+	require.ErrorIs(t, err, stop)
+}
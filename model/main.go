@@ -215,18 +215,51 @@ func migrateDB() error {
 	if err = DB.AutoMigrate(&Ability{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate Ability")
 	}
+	if err = DB.AutoMigrate(&ChannelKey{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate ChannelKey")
+	}
 	if err = DB.AutoMigrate(&Log{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate Log")
 	}
 	if err = DB.AutoMigrate(&TokenTransaction{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate TokenTransaction")
 	}
+	if err = DB.AutoMigrate(&UpstreamFile{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate UpstreamFile")
+	}
+	if err = DB.AutoMigrate(&BatchJob{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate BatchJob")
+	}
+	if err = DB.AutoMigrate(&VideoJob{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate VideoJob")
+	}
+	if err = DB.AutoMigrate(&StoredResponse{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate StoredResponse")
+	}
 	if err = DB.AutoMigrate(&UserRequestCost{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate UserRequestCost")
 	}
 	if err = DB.AutoMigrate(&Trace{}); err != nil {
 		return errors.Wrapf(err, "failed to migrate Trace")
 	}
+	if err = DB.AutoMigrate(&AuditLog{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate AuditLog")
+	}
+	if err = DB.AutoMigrate(&CreditGrant{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate CreditGrant")
+	}
+	if err = DB.AutoMigrate(&TopUpOrder{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate TopUpOrder")
+	}
+	if err = DB.AutoMigrate(&Statement{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate Statement")
+	}
+	if err = DB.AutoMigrate(&Organization{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate Organization")
+	}
+	if err = DB.AutoMigrate(&OrganizationMember{}); err != nil {
+		return errors.Wrapf(err, "failed to migrate OrganizationMember")
+	}
 	return nil
 }
 
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"strconv"
 	"strings"
 	"time"
@@ -9,8 +10,13 @@ import (
 	"github.com/Laisky/zap"
 
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/eventbus"
 	"github.com/songquanpeng/one-api/common/logger"
 	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
+	"github.com/songquanpeng/one-api/relay/retrypolicy"
 )
 
 type Option struct {
@@ -83,10 +89,22 @@ func InitOptionMap() {
 	config.OptionMap["QuotaRemindThreshold"] = strconv.FormatInt(config.QuotaRemindThreshold, 10)
 	config.OptionMap["PreConsumedQuota"] = strconv.FormatInt(config.PreConsumedQuota, 10)
 	config.OptionMap["GroupRatio"] = billingratio.GroupRatio2JSONString()
+	config.OptionMap["GuardrailPolicy"] = guardrail.Policy2JSONString()
+	config.OptionMap["ChannelSelectionStrategy"] = ChannelSelectionStrategies2JSONString()
 	config.OptionMap["TopUpLink"] = config.TopUpLink
 	config.OptionMap["ChatLink"] = config.ChatLink
+	config.OptionMap["PaymentProvider"] = config.PaymentProvider
+	config.OptionMap["PaymentCurrency"] = config.PaymentCurrency
+	config.OptionMap["PaymentQuotaPerUnit"] = strconv.FormatFloat(config.PaymentQuotaPerUnit, 'f', -1, 64)
+	config.OptionMap["PaymentMinTopUp"] = strconv.FormatFloat(config.PaymentMinTopUp, 'f', -1, 64)
+	config.OptionMap["StripeApiBase"] = config.StripeApiBase
+	config.OptionMap["StripeApiSecret"] = ""
+	config.OptionMap["StripeWebhookSecret"] = ""
 	config.OptionMap["QuotaPerUnit"] = strconv.FormatFloat(config.QuotaPerUnit, 'f', -1, 64)
 	config.OptionMap["RetryTimes"] = strconv.Itoa(config.RetryTimes)
+	config.OptionMap["RetryPolicy"] = retrypolicy.Policies2JSONString()
+	config.OptionMap["HedgePolicy"] = hedge.Policies2JSONString()
+	config.OptionMap["GroupPricingRules"] = pricingrule.Rules2JSONString()
 	config.OptionMap["Theme"] = config.Theme
 	config.OptionMapRWMutex.Unlock()
 	loadOptionsFromDatabase()
@@ -127,7 +145,11 @@ func UpdateOption(key string, value string) error {
 	// otherwise it will execute Update (with all fields).
 	DB.Save(&option)
 	// Update OptionMap
-	return updateOptionMap(key, value)
+	if err := updateOptionMap(key, value); err != nil {
+		return err
+	}
+	eventbus.Publish(context.Background(), eventbus.TopicOptions, key)
+	return nil
 }
 
 func updateOptionMap(key string, value string) (err error) {
@@ -237,15 +259,49 @@ func updateOptionMap(key string, value string) (err error) {
 		config.PreConsumedQuota, _ = strconv.ParseInt(value, 10, 64)
 	case "RetryTimes":
 		config.RetryTimes, _ = strconv.Atoi(value)
+	case "RetryPolicy":
+		if err = retrypolicy.UpdatePoliciesByJSONString(value); err != nil {
+			return errors.Wrap(err, "update retry policy")
+		}
+	case "HedgePolicy":
+		if err = hedge.UpdatePoliciesByJSONString(value); err != nil {
+			return errors.Wrap(err, "update hedge policy")
+		}
 	case "ModelRatio", "CompletionRatio":
 		// Skip deprecated global pricing options - they are now handled by individual adapters
 		return nil
 	case "GroupRatio":
 		err = billingratio.UpdateGroupRatioByJSONString(value)
+	case "GroupPricingRules":
+		if err = pricingrule.UpdateRulesByJSONString(value); err != nil {
+			return errors.Wrap(err, "update group pricing rules")
+		}
+	case "GuardrailPolicy":
+		if err = guardrail.UpdatePolicyByJSONString(value); err != nil {
+			return errors.Wrap(err, "update guardrail policy")
+		}
+	case "ChannelSelectionStrategy":
+		if err = UpdateChannelSelectionStrategiesByJSONString(value); err != nil {
+			return errors.Wrap(err, "update channel selection strategy")
+		}
 	case "TopUpLink":
 		config.TopUpLink = value
 	case "ChatLink":
 		config.ChatLink = value
+	case "PaymentProvider":
+		config.PaymentProvider = value
+	case "PaymentCurrency":
+		config.PaymentCurrency = strings.ToLower(value)
+	case "PaymentQuotaPerUnit":
+		config.PaymentQuotaPerUnit, _ = strconv.ParseFloat(value, 64)
+	case "PaymentMinTopUp":
+		config.PaymentMinTopUp, _ = strconv.ParseFloat(value, 64)
+	case "StripeApiBase":
+		config.StripeApiBase = value
+	case "StripeApiSecret":
+		config.StripeApiSecret = value
+	case "StripeWebhookSecret":
+		config.StripeWebhookSecret = value
 	case "ChannelDisableThreshold":
 		config.ChannelDisableThreshold, _ = strconv.ParseFloat(value, 64)
 	case "QuotaPerUnit":
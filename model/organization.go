@@ -0,0 +1,454 @@
+package model
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+)
+
+const (
+	OrganizationStatusEnabled  = 1 // don't use 0, 0 is the default value!
+	OrganizationStatusDisabled = 2 // also don't use 0
+)
+
+const (
+	// OrganizationRoleOwner manages members, quota and settings of the organization.
+	OrganizationRoleOwner = "owner"
+	// OrganizationRoleBilling can move quota into the pool and view org-wide usage.
+	OrganizationRoleBilling = "billing"
+	// OrganizationRoleMember can only bind their own tokens to the organization pool.
+	OrganizationRoleMember = "member"
+)
+
+// Organization groups users that share one quota pool. Tokens bound to an organization
+// draw from Organization.Quota instead of their owner's personal quota, while logs keep
+// recording the individual user and token so usage stays auditable per person.
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);uniqueIndex"`
+	Status      int    `json:"status" gorm:"default:1"`
+	Quota       int64  `json:"quota" gorm:"bigint;default:0"`      // shared quota pool
+	UsedQuota   int64  `json:"used_quota" gorm:"bigint;default:0"` // quota consumed by member tokens
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+}
+
+// OrganizationMember binds a user to an organization with a role.
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member_user"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user;index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint"`
+	Username       string `json:"username" gorm:"-:all"` // only for api response
+}
+
+// UserOrganization is an organization as seen by one of its members.
+type UserOrganization struct {
+	Organization
+	Role string `json:"role"`
+}
+
+// ValidOrganizationRole reports whether role is a supported member role.
+func ValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleBilling, OrganizationRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+func GetAllOrganizations(startIdx int, num int) ([]*Organization, error) {
+	var organizations []*Organization
+	err := DB.Order("id desc").Limit(num).Offset(startIdx).Find(&organizations).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "list organizations")
+	}
+	return organizations, nil
+}
+
+func GetOrganizationCount() (count int64, err error) {
+	err = DB.Model(&Organization{}).Count(&count).Error
+	return count, err
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id is empty!")
+	}
+	organization := Organization{Id: id}
+	if err := DB.First(&organization, "id = ?", id).Error; err != nil {
+		return nil, errors.Wrapf(err, "get organization %d", id)
+	}
+	return &organization, nil
+}
+
+// CreateOrganization inserts the organization and makes ownerUserId its first owner.
+func CreateOrganization(organization *Organization, ownerUserId int) error {
+	if ownerUserId == 0 {
+		return errors.New("organization owner is required")
+	}
+	now := helper.GetTimestamp()
+	organization.CreatedTime = now
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return errors.Wrapf(err, "create organization %q", organization.Name)
+		}
+		member := &OrganizationMember{
+			OrganizationId: organization.Id,
+			UserId:         ownerUserId,
+			Role:           OrganizationRoleOwner,
+			CreatedTime:    now,
+		}
+		if err := tx.Create(member).Error; err != nil {
+			return errors.Wrapf(err, "add owner %d to organization %d", ownerUserId, organization.Id)
+		}
+		return nil
+	})
+}
+
+// Update persists name and status of the organization; see AdjustOrganizationQuota for the balance.
+func (organization *Organization) Update() error {
+	err := DB.Model(organization).Select("name", "status").Updates(organization).Error
+	if err != nil {
+		return errors.Wrapf(err, "update organization %d", organization.Id)
+	}
+	return nil
+}
+
+// AdjustOrganizationQuota adds delta (negative to deduct) to the pool balance in place,
+// so concurrent consumption is not lost.
+func AdjustOrganizationQuota(id int, delta int64) error {
+	result := DB.Model(&Organization{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", delta))
+	if result.Error != nil {
+		return errors.Wrapf(result.Error, "adjust quota of organization %d", id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("organization %d not found", id)
+	}
+	return nil
+}
+
+// DeleteOrganizationById removes the organization and its memberships. Tokens bound to it
+// fall back to their owners' personal quota.
+func DeleteOrganizationById(ctx context.Context, id int) error {
+	if id == 0 {
+		return errors.New("id is empty!")
+	}
+	var keys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Token{}).Where("organization_id = ?", id).Pluck("key", &keys).Error; err != nil {
+			return errors.Wrapf(err, "list tokens of organization %d", id)
+		}
+		if err := tx.Model(&Token{}).Where("organization_id = ?", id).Update("organization_id", 0).Error; err != nil {
+			return errors.Wrapf(err, "unbind tokens of organization %d", id)
+		}
+		if err := tx.Where("organization_id = ?", id).Delete(&OrganizationMember{}).Error; err != nil {
+			return errors.Wrapf(err, "delete members of organization %d", id)
+		}
+		if err := tx.Delete(&Organization{}, "id = ?", id).Error; err != nil {
+			return errors.Wrapf(err, "delete organization %d", id)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		clearTokenCache(ctx, key)
+	}
+	return nil
+}
+
+// IsOrganizationEnabled reports whether the organization exists and is enabled.
+func IsOrganizationEnabled(id int) (bool, error) {
+	var status int
+	err := DB.Model(&Organization{}).Where("id = ?", id).Select("status").Find(&status).Error
+	if err != nil {
+		return false, errors.Wrapf(err, "get status of organization %d", id)
+	}
+	return status == OrganizationStatusEnabled, nil
+}
+
+func GetOrganizationQuota(id int) (quota int64, err error) {
+	err = DB.Model(&Organization{}).Where("id = ?", id).Select("quota").Find(&quota).Error
+	if err != nil {
+		return 0, errors.Wrapf(err, "get quota for organization %d", id)
+	}
+	return quota, nil
+}
+
+// ListUserOrganizations returns the organizations userId belongs to, with the user's role.
+func ListUserOrganizations(userId int) ([]*UserOrganization, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("user_id = ?", userId).Find(&members).Error; err != nil {
+		return nil, errors.Wrapf(err, "list organization memberships of user %d", userId)
+	}
+	if len(members) == 0 {
+		return []*UserOrganization{}, nil
+	}
+
+	roles := make(map[int]string, len(members))
+	ids := make([]int, 0, len(members))
+	for _, member := range members {
+		roles[member.OrganizationId] = member.Role
+		ids = append(ids, member.OrganizationId)
+	}
+	var organizations []*Organization
+	if err := DB.Where("id IN ?", ids).Order("id desc").Find(&organizations).Error; err != nil {
+		return nil, errors.Wrapf(err, "list organizations of user %d", userId)
+	}
+
+	result := make([]*UserOrganization, 0, len(organizations))
+	for _, organization := range organizations {
+		result = append(result, &UserOrganization{Organization: *organization, Role: roles[organization.Id]})
+	}
+	return result, nil
+}
+
+// GetOrganizationMember returns the membership of userId in the organization.
+func GetOrganizationMember(organizationId int, userId int) (*OrganizationMember, error) {
+	member := &OrganizationMember{}
+	err := DB.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(member).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "get member %d of organization %d", userId, organizationId)
+	}
+	return member, nil
+}
+
+// GetOrganizationMembers lists the members of the organization with their usernames.
+func GetOrganizationMembers(organizationId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	if err := DB.Where("organization_id = ?", organizationId).Order("id asc").Find(&members).Error; err != nil {
+		return nil, errors.Wrapf(err, "list members of organization %d", organizationId)
+	}
+	if len(members) == 0 {
+		return members, nil
+	}
+
+	userIds := make([]int, 0, len(members))
+	for _, member := range members {
+		userIds = append(userIds, member.UserId)
+	}
+	var users []*User
+	if err := DB.Select("id", "username").Where("id IN ?", userIds).Find(&users).Error; err != nil {
+		return nil, errors.Wrapf(err, "get usernames of organization %d members", organizationId)
+	}
+	usernames := make(map[int]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	for _, member := range members {
+		member.Username = usernames[member.UserId]
+	}
+	return members, nil
+}
+
+// GetOrganizationMemberUserIds returns the user ids of all members of the organization.
+func GetOrganizationMemberUserIds(organizationId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&OrganizationMember{}).Where("organization_id = ?", organizationId).Pluck("user_id", &userIds).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list member ids of organization %d", organizationId)
+	}
+	return userIds, nil
+}
+
+// GetOrganizationTokenIds returns the ids of the tokens charged to the organization pool.
+func GetOrganizationTokenIds(organizationId int) ([]int, error) {
+	var tokenIds []int
+	err := DB.Model(&Token{}).Where("organization_id = ?", organizationId).Pluck("id", &tokenIds).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "list token ids of organization %d", organizationId)
+	}
+	return tokenIds, nil
+}
+
+// AddOrganizationMember adds userId to the organization with role.
+func AddOrganizationMember(organizationId int, userId int, role string) (*OrganizationMember, error) {
+	if !ValidOrganizationRole(role) {
+		return nil, errors.Errorf("invalid organization role: %s", role)
+	}
+	member := &OrganizationMember{
+		OrganizationId: organizationId,
+		UserId:         userId,
+		Role:           role,
+		CreatedTime:    helper.GetTimestamp(),
+	}
+	if err := DB.Create(member).Error; err != nil {
+		return nil, errors.Wrapf(err, "add member %d to organization %d", userId, organizationId)
+	}
+	return member, nil
+}
+
+// UpdateOrganizationMemberRole changes the role of userId. The last owner cannot be demoted.
+func UpdateOrganizationMemberRole(organizationId int, userId int, role string) error {
+	if !ValidOrganizationRole(role) {
+		return errors.Errorf("invalid organization role: %s", role)
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		member := &OrganizationMember{}
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(member).Error; err != nil {
+			return errors.Wrapf(err, "get member %d of organization %d", userId, organizationId)
+		}
+		if member.Role == OrganizationRoleOwner && role != OrganizationRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		if err := tx.Model(member).Update("role", role).Error; err != nil {
+			return errors.Wrapf(err, "update role of member %d in organization %d", userId, organizationId)
+		}
+		return nil
+	})
+}
+
+// RemoveOrganizationMember removes userId from the organization and moves the user's tokens
+// bound to it back to their personal quota. The last owner cannot be removed.
+func RemoveOrganizationMember(ctx context.Context, organizationId int, userId int) error {
+	var keys []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		member := &OrganizationMember{}
+		if err := tx.Where("organization_id = ? AND user_id = ?", organizationId, userId).First(member).Error; err != nil {
+			return errors.Wrapf(err, "get member %d of organization %d", userId, organizationId)
+		}
+		if member.Role == OrganizationRoleOwner {
+			if err := ensureAnotherOwner(tx, organizationId, userId); err != nil {
+				return err
+			}
+		}
+		tokens := tx.Model(&Token{}).Where("organization_id = ? AND user_id = ?", organizationId, userId)
+		if err := tokens.Pluck("key", &keys).Error; err != nil {
+			return errors.Wrapf(err, "list tokens of member %d", userId)
+		}
+		if err := tx.Model(&Token{}).Where("organization_id = ? AND user_id = ?", organizationId, userId).
+			Update("organization_id", 0).Error; err != nil {
+			return errors.Wrapf(err, "unbind tokens of member %d", userId)
+		}
+		if err := tx.Delete(member).Error; err != nil {
+			return errors.Wrapf(err, "remove member %d from organization %d", userId, organizationId)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		clearTokenCache(ctx, key)
+	}
+	return nil
+}
+
+func ensureAnotherOwner(tx *gorm.DB, organizationId int, userId int) error {
+	var owners int64
+	err := tx.Model(&OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", organizationId, OrganizationRoleOwner, userId).
+		Count(&owners).Error
+	if err != nil {
+		return errors.Wrapf(err, "count owners of organization %d", organizationId)
+	}
+	if owners == 0 {
+		return errors.New("an organization must keep at least one owner")
+	}
+	return nil
+}
+
+// TransferUserQuotaToOrganization moves quota from the user's personal balance into the
+// organization pool.
+func TransferUserQuotaToOrganization(ctx context.Context, userId int, organizationId int, quota int64) error {
+	if quota <= 0 {
+		return errors.New("quota must be positive")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "decrease quota for user %d", userId)
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("insufficient user quota for user %d", userId)
+		}
+		if err := applyCreditGrantDelta(tx, userId, -quota); err != nil {
+			return err
+		}
+		result = tx.Model(&Organization{}).Where("id = ?", organizationId).
+			Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return errors.Wrapf(result.Error, "increase quota for organization %d", organizationId)
+		}
+		if result.RowsAffected == 0 {
+			return errors.Errorf("organization %d not found", organizationId)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if common.IsRedisEnabled() {
+		// drop the cached balance so the next request sees the transfer
+		_ = common.RedisDel(ctx, fmt.Sprintf("user_quota:%d", userId))
+	}
+	return nil
+}
+
+// consumeOrganizationQuota charges quota (negative for refunds) to the organization pool
+// and accounts it as used. With requireBalance, charges fail when the pool cannot cover
+// them; post-consume settles requests that were already served and may overdraw the pool,
+// like the personal quota does.
+func consumeOrganizationQuota(id int, quota int64, requireBalance bool) error {
+	if quota == 0 {
+		return nil
+	}
+	var result *gorm.DB
+	err := runWithSQLiteBusyRetry(nil, func() error {
+		db := DB.Model(&Organization{}).Where("id = ?", id)
+		if requireBalance && quota > 0 {
+			db = db.Where("quota >= ?", quota)
+		}
+		result = db.Updates(map[string]any{
+			"quota":      gorm.Expr("quota - ?", quota),
+			"used_quota": gorm.Expr("used_quota + ?", quota),
+		})
+		return result.Error
+	})
+	if err != nil {
+		return errors.Wrapf(err, "consume quota for organization %d", id)
+	}
+	if result.RowsAffected == 0 {
+		return errors.Errorf("insufficient organization quota for organization %d", id)
+	}
+	return nil
+}
+
+// GetQuotaPool returns the balance requests of userId are charged against: the
+// organization pool when organizationId is set, the user's personal quota otherwise.
+func GetQuotaPool(userId int, organizationId int) (int64, error) {
+	if organizationId > 0 {
+		return GetOrganizationQuota(organizationId)
+	}
+	return GetUserQuota(userId)
+}
+
+// CacheGetQuotaPool is GetQuotaPool backed by the user quota cache. Organization pools are
+// shared by many users and always read from the database.
+func CacheGetQuotaPool(ctx context.Context, userId int, organizationId int) (int64, error) {
+	if organizationId > 0 {
+		return GetOrganizationQuota(organizationId)
+	}
+	return CacheGetUserQuota(ctx, userId)
+}
+
+// CacheDecreaseQuotaPool mirrors a charge in the quota cache of the pool.
+func CacheDecreaseQuotaPool(ctx context.Context, userId int, organizationId int, quota int64) error {
+	if organizationId > 0 {
+		return nil
+	}
+	return CacheDecreaseUserQuota(ctx, userId, quota)
+}
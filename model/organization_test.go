@@ -0,0 +1,158 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func setupOrganizationTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&User{}, &Token{}, &Organization{}, &OrganizationMember{}, &CreditGrant{}))
+
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	originalUsingSQLite := common.UsingSQLite.Load()
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() { common.UsingSQLite.Store(originalUsingSQLite) })
+}
+
+func TestOrganizationQuotaPool(t *testing.T) {
+	setupOrganizationTestDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice", Quota: 1000}).Error)
+	require.NoError(t, DB.Create(&User{Id: 2, Username: "bob", AccessToken: "bob", AffCode: "bob", Quota: 50}).Error)
+
+	org := &Organization{Name: "acme", Status: OrganizationStatusEnabled}
+	require.NoError(t, CreateOrganization(org, 1))
+	_, err := AddOrganizationMember(org.Id, 2, OrganizationRoleMember)
+	require.NoError(t, err)
+
+	require.NoError(t, TransferUserQuotaToOrganization(ctx, 1, org.Id, 600))
+	require.Error(t, TransferUserQuotaToOrganization(ctx, 1, org.Id, 600))
+
+	token := &Token{Id: 1, UserId: 2, Key: "org-key", UnlimitedQuota: true, OrganizationId: org.Id}
+	require.NoError(t, DB.Create(token).Error)
+
+	// bob only has 50 personal quota, but the token draws from the pool
+	require.NoError(t, PreConsumeTokenQuota(ctx, token.Id, 200))
+	require.NoError(t, PostConsumeTokenQuota(ctx, token.Id, -50))
+
+	pool, err := GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(450), pool.Quota)
+	require.Equal(t, int64(150), pool.UsedQuota)
+
+	bobQuota, err := GetUserQuota(2)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), bobQuota)
+
+	require.Error(t, PreConsumeTokenQuota(ctx, token.Id, 1000))
+
+	// overage of an already served request is still billed and may overdraw the pool
+	require.NoError(t, PostConsumeTokenQuota(ctx, token.Id, 500))
+	pool, err = GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(-50), pool.Quota)
+	require.Equal(t, int64(650), pool.UsedQuota)
+}
+
+func TestOrganizationMembership(t *testing.T) {
+	setupOrganizationTestDB(t)
+	ctx := context.Background()
+
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice"}).Error)
+	require.NoError(t, DB.Create(&User{Id: 2, Username: "bob", AccessToken: "bob", AffCode: "bob"}).Error)
+
+	org := &Organization{Name: "acme", Status: OrganizationStatusEnabled}
+	require.NoError(t, CreateOrganization(org, 1))
+	_, err := AddOrganizationMember(org.Id, 2, OrganizationRoleBilling)
+	require.NoError(t, err)
+
+	// the last owner can be neither demoted nor removed
+	require.Error(t, UpdateOrganizationMemberRole(org.Id, 1, OrganizationRoleMember))
+	require.Error(t, RemoveOrganizationMember(ctx, org.Id, 1))
+
+	members, err := GetOrganizationMembers(org.Id)
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	require.Equal(t, "alice", members[0].Username)
+
+	orgs, err := ListUserOrganizations(2)
+	require.NoError(t, err)
+	require.Len(t, orgs, 1)
+	require.Equal(t, OrganizationRoleBilling, orgs[0].Role)
+
+	// removing a member moves their tokens back to personal quota
+	require.NoError(t, DB.Create(&Token{Id: 7, UserId: 2, Key: "bob-key", OrganizationId: org.Id}).Error)
+	require.NoError(t, RemoveOrganizationMember(ctx, org.Id, 2))
+	token, err := GetTokenById(7)
+	require.NoError(t, err)
+	require.Zero(t, token.OrganizationId)
+
+	userIds, err := GetOrganizationMemberUserIds(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, userIds)
+}
+
+func TestOrganizationLogsFollowTokens(t *testing.T) {
+	setupOrganizationTestDB(t)
+	require.NoError(t, DB.AutoMigrate(&Log{}))
+	originalLogDB := LOG_DB
+	LOG_DB = DB
+	t.Cleanup(func() { LOG_DB = originalLogDB })
+
+	org := &Organization{Name: "acme", Status: OrganizationStatusEnabled}
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice"}).Error)
+	require.NoError(t, CreateOrganization(org, 1))
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: "org-key", OrganizationId: org.Id}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 2, UserId: 1, Key: "own-key"}).Error)
+	require.NoError(t, DB.Create(&Log{UserId: 1, TokenId: 1, Type: LogTypeConsume, CreatedAt: 100, Quota: 10}).Error)
+	require.NoError(t, DB.Create(&Log{UserId: 1, TokenId: 2, Type: LogTypeConsume, CreatedAt: 100, Quota: 20}).Error)
+
+	tokenIds, err := GetOrganizationTokenIds(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, tokenIds)
+
+	// the member's personal usage stays out of the organization view
+	logs, err := GetTokensLogs(tokenIds, 0, LogTypeUnknown, 0, 0, "", "", 0, 10, "", "")
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	require.Equal(t, 10, logs[0].Quota)
+
+	count, err := GetTokensLogsCount(tokenIds, 2, LogTypeUnknown, 0, 0, "", "")
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestAdjustOrganizationQuota(t *testing.T) {
+	setupOrganizationTestDB(t)
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice"}).Error)
+	org := &Organization{Name: "acme", Status: OrganizationStatusEnabled, Quota: 100}
+	require.NoError(t, CreateOrganization(org, 1))
+
+	// usage charged after the admin read the balance is kept
+	require.NoError(t, consumeOrganizationQuota(org.Id, 30, true))
+	require.NoError(t, AdjustOrganizationQuota(org.Id, 400))
+	pool, err := GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(470), pool.Quota)
+
+	org.Name = "acme inc"
+	require.NoError(t, org.Update())
+	pool, err = GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	require.Equal(t, "acme inc", pool.Name)
+	require.Equal(t, int64(470), pool.Quota, "Update leaves the balance alone")
+
+	require.Error(t, AdjustOrganizationQuota(org.Id+1, 10))
+}
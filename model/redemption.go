@@ -26,9 +26,15 @@ type Redemption struct {
 	Quota        int64  `json:"quota" gorm:"bigint;default:100"`
 	CreatedTime  int64  `json:"created_time" gorm:"bigint"`
 	RedeemedTime int64  `json:"redeemed_time" gorm:"bigint"`
-	Count        int    `json:"count" gorm:"-:all"` // only for api request
-	CreatedAt    int64  `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
-	UpdatedAt    int64  `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+	// CreditSource is the source of the credit granted on redemption, "redemption" or "promotion".
+	CreditSource string `json:"credit_source" gorm:"type:varchar(32);default:'redemption'"`
+	// CreditValidDays is how long the granted credit stays usable; 0 never expires.
+	CreditValidDays int `json:"credit_valid_days" gorm:"default:0"`
+	// CreditPriority is the draw-down priority of the granted credit.
+	CreditPriority int   `json:"credit_priority" gorm:"default:0"`
+	Count          int   `json:"count" gorm:"-:all"` // only for api request
+	CreatedAt      int64 `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt      int64 `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
 }
 
 func GetAllRedemptions(startIdx int, num int) ([]*Redemption, error) {
@@ -95,11 +101,10 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 		if redemption.Status != RedemptionCodeStatusEnabled {
 			return errors.New("The redemption code has been used")
 		}
-		err = tx.Model(&User{}).Where("id = ?", userId).Update("quota", gorm.Expr("quota + ?", redemption.Quota)).Error
-		if err != nil {
+		redemption.RedeemedTime = helper.GetTimestamp()
+		if err = grantCredit(tx, redemption.creditGrant(userId)); err != nil {
 			return errors.Wrapf(err, "increase user %d quota with redemption", userId)
 		}
-		redemption.RedeemedTime = helper.GetTimestamp()
 		redemption.Status = RedemptionCodeStatusUsed
 		if err = tx.Save(redemption).Error; err != nil {
 			return errors.Wrap(err, "update redemption status")
@@ -113,6 +118,24 @@ func Redeem(ctx context.Context, key string, userId int) (quota int64, err error
 	return redemption.Quota, nil
 }
 
+// creditGrant is the grant the redemption gives to userId when redeemed.
+func (redemption *Redemption) creditGrant(userId int) *CreditGrant {
+	grant := &CreditGrant{
+		UserId:    userId,
+		Source:    CreditSourceRedemption,
+		Reference: fmt.Sprint(redemption.Id),
+		Amount:    redemption.Quota,
+		Priority:  redemption.CreditPriority,
+	}
+	if redemption.CreditSource == CreditSourcePromotion {
+		grant.Source = CreditSourcePromotion
+	}
+	if redemption.CreditValidDays > 0 {
+		grant.ExpiresAt = redemption.RedeemedTime + int64(redemption.CreditValidDays)*24*3600
+	}
+	return grant
+}
+
 func (redemption *Redemption) Insert() error {
 	if err := DB.Create(redemption).Error; err != nil {
 		return errors.Wrap(err, "insert redemption")
@@ -127,7 +150,8 @@ func (redemption *Redemption) SelectUpdate() error {
 
 // Update Make sure your token's fields is completed, because this will update non-zero values
 func (redemption *Redemption) Update() error {
-	if err := DB.Model(redemption).Select("name", "status", "quota", "redeemed_time").Updates(redemption).Error; err != nil {
+	if err := DB.Model(redemption).Select("name", "status", "quota", "redeemed_time",
+		"credit_source", "credit_valid_days", "credit_priority").Updates(redemption).Error; err != nil {
 		return errors.Wrapf(err, "update redemption %d", redemption.Id)
 	}
 	return nil
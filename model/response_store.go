@@ -0,0 +1,57 @@
+package model
+
+import (
+	"context"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// StoredResponse persists a Response API response that was served through the
+// ChatCompletion fallback, so previous_response_id, retrieval and input_items keep
+// working on channels without native Response API support.
+//
+// Fields:
+//   - ResponseId: public response identifier returned to the client.
+//   - TokenId: token that created the response; only that token may read or delete it.
+//   - PreviousResponseId: response this one continued, used to rebuild the conversation.
+//   - InputItems: JSON array of the input items sent with this request only.
+//   - Response: JSON encoding of the full Response API response object.
+type StoredResponse struct {
+	Id                 int    `json:"id"`
+	ResponseId         string `json:"response_id" gorm:"type:varchar(64);uniqueIndex"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	TokenId            int    `json:"token_id" gorm:"index"`
+	ChannelId          int    `json:"channel_id"`
+	Model              string `json:"model" gorm:"type:varchar(128)"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(64)"`
+	InputItems         string `json:"input_items" gorm:"type:text"`
+	Response           string `json:"response" gorm:"type:text"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;autoCreateTime"`
+}
+
+// CreateStoredResponse inserts a stored response record.
+func CreateStoredResponse(ctx context.Context, response *StoredResponse) error {
+	if err := DB.WithContext(ctx).Create(response).Error; err != nil {
+		return errors.Wrapf(err, "create stored response %s", response.ResponseId)
+	}
+	return nil
+}
+
+// GetStoredResponseByToken returns the stored response created by tokenId.
+func GetStoredResponseByToken(ctx context.Context, tokenId int, responseId string) (*StoredResponse, error) {
+	response := &StoredResponse{}
+	if err := DB.WithContext(ctx).Where("token_id = ? AND response_id = ?", tokenId, responseId).First(response).Error; err != nil {
+		return nil, errors.Wrapf(err, "get stored response %s for token %d", responseId, tokenId)
+	}
+	return response, nil
+}
+
+// DeleteStoredResponseByToken deletes the stored response created by tokenId.
+// It returns false when no such response exists.
+func DeleteStoredResponseByToken(ctx context.Context, tokenId int, responseId string) (bool, error) {
+	result := DB.WithContext(ctx).Where("token_id = ? AND response_id = ?", tokenId, responseId).Delete(&StoredResponse{})
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "delete stored response %s for token %d", responseId, tokenId)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// StatementPeriodLayout is the layout of statement periods, one calendar month in UTC.
+const StatementPeriodLayout = "2006-01"
+
+// StatementCurrency is the currency statement amounts are given in; QuotaPerUnit converts
+// quota to it.
+const StatementCurrency = "USD"
+
+// statementCloseGrace delays closing a month, so that requests still running when it ended
+// are logged before the statement is frozen.
+const statementCloseGrace = time.Hour
+
+// Statement is the usage statement of a user, or of one of the user's tokens, for a month.
+// Once the month closes the statement is stored and never recomputed, so later changes to
+// logs or prices do not alter it.
+type Statement struct {
+	Id     int `json:"id"`
+	UserId int `json:"user_id" gorm:"uniqueIndex:idx_statement_period,priority:1"`
+	// TokenId restricts the statement to one token; zero covers all of the user's tokens.
+	TokenId int `json:"token_id" gorm:"uniqueIndex:idx_statement_period,priority:2;default:0"`
+	// TokenName is the name of the token when the statement was built, for display.
+	TokenName string `json:"token_name"`
+	Period    string `json:"period" gorm:"type:varchar(7);uniqueIndex:idx_statement_period,priority:3"`
+	Username  string `json:"username"`
+	// PeriodStart and PeriodEnd bound the month as the half-open range [start, end).
+	PeriodStart  int64   `json:"period_start" gorm:"bigint"`
+	PeriodEnd    int64   `json:"period_end" gorm:"bigint"`
+	Currency     string  `json:"currency" gorm:"type:varchar(8)"`
+	QuotaPerUnit float64 `json:"quota_per_unit"`
+
+	RequestCount           int64   `json:"request_count" gorm:"bigint"`
+	PromptTokens           int64   `json:"prompt_tokens" gorm:"bigint"`
+	CompletionTokens       int64   `json:"completion_tokens" gorm:"bigint"`
+	CachedPromptTokens     int64   `json:"cached_prompt_tokens" gorm:"bigint"`
+	CachedCompletionTokens int64   `json:"cached_completion_tokens" gorm:"bigint"`
+	Quota                  int64   `json:"quota" gorm:"bigint"`
+	Amount                 float64 `json:"amount"`
+
+	Items StatementItems `json:"items" gorm:"type:text"`
+	// Closed tells whether the month has closed; statements of open months are live.
+	Closed    bool  `json:"closed" gorm:"-"`
+	CreatedAt int64 `json:"created_at" gorm:"bigint;autoCreateTime"`
+}
+
+// StatementItem is the usage of one model in a statement.
+type StatementItem struct {
+	ModelName              string  `json:"model_name"`
+	RequestCount           int64   `json:"request_count"`
+	PromptTokens           int64   `json:"prompt_tokens"`
+	CompletionTokens       int64   `json:"completion_tokens"`
+	CachedPromptTokens     int64   `json:"cached_prompt_tokens"`
+	CachedCompletionTokens int64   `json:"cached_completion_tokens"`
+	Quota                  int64   `json:"quota"`
+	Amount                 float64 `json:"amount"`
+	// PricePerMillionTokens and PricePerRequest are the effective unit prices over the month.
+	// Prices can change within a month, so they are averages of what was billed.
+	PricePerMillionTokens float64 `json:"price_per_million_tokens"`
+	PricePerRequest       float64 `json:"price_per_request"`
+}
+
+// StatementItems stores the line items of a statement as JSON.
+type StatementItems []StatementItem
+
+// Value converts StatementItems to a driver-compatible JSON representation.
+func (items StatementItems) Value() (driver.Value, error) {
+	payload, err := json.Marshal([]StatementItem(items))
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal statement items")
+	}
+	return string(payload), nil
+}
+
+// Scan populates StatementItems from a database value.
+func (items *StatementItems) Scan(value any) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*items = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.Errorf("statement items scan: unsupported type %T", value)
+	}
+	if err := json.Unmarshal(data, (*[]StatementItem)(items)); err != nil {
+		return errors.Wrap(err, "unmarshal statement items")
+	}
+	return nil
+}
+
+// ParseStatementPeriod returns the bounds of a "YYYY-MM" period.
+func ParseStatementPeriod(period string) (start time.Time, end time.Time, err error) {
+	start, err = time.ParseInLocation(StatementPeriodLayout, period, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.Errorf("invalid statement period %q, expected YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
+
+// GetStatement returns the statement of the user, or of the user's token when tokenId is
+// set, for period as of now. The token must belong to the user, and the period must not
+// have ended before the user was created. The first request after a month closes stores
+// its statement; later requests return that snapshot.
+func GetStatement(ctx context.Context, userId int, tokenId int, period string, now time.Time) (*Statement, error) {
+	start, end, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+	if !now.After(start) {
+		return nil, errors.Errorf("statement period %s has not started", period)
+	}
+	user, err := GetUserById(userId, false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get user %d", userId)
+	}
+	// users created before CreatedAt was recorded have none
+	if user.CreatedAt > 0 && end.UnixMilli() <= user.CreatedAt {
+		return nil, errors.Errorf("statement period %s ended before the user was created", period)
+	}
+	tokenName := ""
+	if tokenId != 0 {
+		token, err := GetTokenByIds(tokenId, userId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get token %d of user %d", tokenId, userId)
+		}
+		tokenName = token.Name
+	}
+	if now.Before(end.Add(statementCloseGrace)) {
+		return buildStatement(ctx, user, tokenId, tokenName, period, start, end)
+	}
+
+	statement, err := findStatement(ctx, userId, tokenId, period)
+	if err == nil {
+		return statement, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	statement, err = buildStatement(ctx, user, tokenId, tokenName, period, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if err = DB.WithContext(ctx).Create(statement).Error; err != nil {
+		// another request may have stored the snapshot first, which then wins
+		if stored, findErr := findStatement(ctx, userId, tokenId, period); findErr == nil {
+			return stored, nil
+		}
+		return nil, errors.Wrapf(err, "store statement of user %d for %s", userId, period)
+	}
+	statement.Closed = true
+	return statement, nil
+}
+
+func findStatement(ctx context.Context, userId int, tokenId int, period string) (*Statement, error) {
+	statement := &Statement{}
+	err := DB.WithContext(ctx).
+		Where("user_id = ? AND token_id = ? AND period = ?", userId, tokenId, period).
+		First(statement).Error
+	if err != nil {
+		return nil, errors.Wrapf(err, "find statement of user %d for %s", userId, period)
+	}
+	statement.Closed = true
+	return statement, nil
+}
+
+// buildStatement aggregates the consumption logs of the period into a statement.
+func buildStatement(ctx context.Context, user *User, tokenId int, tokenName string, period string, start, end time.Time) (*Statement, error) {
+	userId := user.Id
+	query := LOG_DB.WithContext(ctx).Model(&Log{}).
+		Select(`model_name, count(1) as request_count,
+			sum(prompt_tokens) as prompt_tokens,
+			sum(completion_tokens) as completion_tokens,
+			sum(cached_prompt_tokens) as cached_prompt_tokens,
+			sum(cached_completion_tokens) as cached_completion_tokens,
+			sum(quota) as quota`).
+		Where("type = ? AND user_id = ? AND created_at >= ? AND created_at < ?",
+			LogTypeConsume, userId, start.Unix(), end.Unix())
+	if tokenId != 0 {
+		query = query.Where("token_id = ?", tokenId)
+	}
+
+	var items []StatementItem
+	if err := query.Group("model_name").Order("model_name").Scan(&items).Error; err != nil {
+		return nil, errors.Wrapf(err, "aggregate logs of user %d for %s", userId, period)
+	}
+
+	statement := &Statement{
+		UserId:       userId,
+		TokenId:      tokenId,
+		TokenName:    tokenName,
+		Period:       period,
+		Username:     user.Username,
+		PeriodStart:  start.Unix(),
+		PeriodEnd:    end.Unix(),
+		Currency:     StatementCurrency,
+		QuotaPerUnit: config.QuotaPerUnit,
+		Items:        items,
+	}
+	if statement.Items == nil {
+		statement.Items = StatementItems{}
+	}
+	for i := range statement.Items {
+		item := &statement.Items[i]
+		item.Amount = statement.quotaAmount(item.Quota)
+		if tokens := item.PromptTokens + item.CompletionTokens; tokens > 0 {
+			item.PricePerMillionTokens = item.Amount / float64(tokens) * 1_000_000
+		}
+		if item.RequestCount > 0 {
+			item.PricePerRequest = item.Amount / float64(item.RequestCount)
+		}
+
+		statement.RequestCount += item.RequestCount
+		statement.PromptTokens += item.PromptTokens
+		statement.CompletionTokens += item.CompletionTokens
+		statement.CachedPromptTokens += item.CachedPromptTokens
+		statement.CachedCompletionTokens += item.CachedCompletionTokens
+		statement.Quota += item.Quota
+	}
+	statement.Amount = statement.quotaAmount(statement.Quota)
+	return statement, nil
+}
+
+func (statement *Statement) quotaAmount(quota int64) float64 {
+	if statement.QuotaPerUnit <= 0 {
+		return 0
+	}
+	return float64(quota) / statement.QuotaPerUnit
+}
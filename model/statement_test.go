@@ -0,0 +1,91 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetStatement(t *testing.T) {
+	setupCreditGrantTestDB(t)
+	require.NoError(t, DB.AutoMigrate(&Statement{}, &Token{}))
+	createdAt := time.Date(2026, 8, 15, 0, 0, 0, 0, time.UTC).UnixMilli()
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice", CreatedAt: createdAt}).Error)
+	require.NoError(t, DB.Create(&User{Id: 2, Username: "bob", AccessToken: "bob", AffCode: "bob", CreatedAt: createdAt}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 1, UserId: 1, Key: "ci-key", Name: "ci"}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 2, UserId: 1, Key: "dev-key", Name: "dev"}).Error)
+	require.NoError(t, DB.Create(&Token{Id: 3, UserId: 2, Key: "bob-key", Name: "dev"}).Error)
+
+	ctx := context.Background()
+	september := time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC).Unix()
+	logs := []*Log{
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: september, TokenId: 1, TokenName: "ci", ModelName: "gpt-4o", Quota: 500_000, PromptTokens: 1000, CompletionTokens: 500, CachedPromptTokens: 200},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: september, TokenId: 2, TokenName: "dev", ModelName: "gpt-4o", Quota: 250_000, PromptTokens: 400, CompletionTokens: 100},
+		// the token was renamed within the month
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: september, TokenId: 2, TokenName: "dev-old", ModelName: "dall-e-3", Quota: 100_000},
+		// not usage, other users and other months stay out of the statement
+		{UserId: 1, Type: LogTypeTopup, CreatedAt: september, Quota: 1_000_000},
+		{UserId: 2, Type: LogTypeConsume, CreatedAt: september, TokenId: 3, TokenName: "dev", ModelName: "gpt-4o", Quota: 1},
+		{UserId: 1, Type: LogTypeConsume, CreatedAt: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC).Unix(), ModelName: "gpt-4o", Quota: 1},
+	}
+	require.NoError(t, LOG_DB.Create(&logs).Error)
+
+	// while the month is open the statement is live and not stored
+	open, err := GetStatement(ctx, 1, 0, "2026-09", time.Date(2026, 9, 20, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, open.Closed)
+	var stored int64
+	require.NoError(t, DB.Model(&Statement{}).Count(&stored).Error)
+	require.Zero(t, stored)
+
+	closedAt := time.Date(2026, 10, 2, 0, 0, 0, 0, time.UTC)
+	statement, err := GetStatement(ctx, 1, 0, "2026-09", closedAt)
+	require.NoError(t, err)
+	require.True(t, statement.Closed)
+	require.Equal(t, "alice", statement.Username)
+	require.Equal(t, int64(3), statement.RequestCount)
+	require.Equal(t, int64(850_000), statement.Quota)
+	require.InDelta(t, 1.7, statement.Amount, 1e-9)
+	require.Len(t, statement.Items, 2)
+	require.Equal(t, "dall-e-3", statement.Items[0].ModelName)
+	require.InDelta(t, 0.2, statement.Items[0].PricePerRequest, 1e-9)
+	gpt := statement.Items[1]
+	require.Equal(t, int64(1400), gpt.PromptTokens)
+	require.Equal(t, int64(600), gpt.CompletionTokens)
+	require.Equal(t, int64(200), gpt.CachedPromptTokens)
+	require.InDelta(t, 1.5, gpt.Amount, 1e-9)
+	require.InDelta(t, 750, gpt.PricePerMillionTokens, 1e-9)
+
+	// a closed month is a snapshot: logs arriving later do not change it
+	require.NoError(t, LOG_DB.Create(&Log{UserId: 1, Type: LogTypeConsume, CreatedAt: september, ModelName: "gpt-4o", Quota: 500_000}).Error)
+	again, err := GetStatement(ctx, 1, 0, "2026-09", closedAt.Add(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, statement.Id, again.Id)
+	require.Equal(t, int64(850_000), again.Quota)
+	require.Equal(t, statement.Items, again.Items)
+
+	byToken, err := GetStatement(ctx, 1, 2, "2026-09", closedAt)
+	require.NoError(t, err)
+	require.Equal(t, int64(350_000), byToken.Quota)
+	require.Equal(t, "dev", byToken.TokenName)
+	require.NotEqual(t, statement.Id, byToken.Id)
+
+	// other users' tokens, unknown tokens and months before the user existed store nothing
+	_, err = GetStatement(ctx, 1, 3, "2026-09", closedAt)
+	require.Error(t, err)
+	_, err = GetStatement(ctx, 1, 99, "2026-09", closedAt)
+	require.Error(t, err)
+	_, err = GetStatement(ctx, 1, 0, "2026-07", closedAt)
+	require.Error(t, err)
+	_, err = GetStatement(ctx, 1, 0, "1970-01", closedAt)
+	require.Error(t, err)
+	require.NoError(t, DB.Model(&Statement{}).Count(&stored).Error)
+	require.Equal(t, int64(2), stored)
+
+	_, err = GetStatement(ctx, 1, 0, "2026-11", closedAt)
+	require.Error(t, err)
+	_, err = GetStatement(ctx, 1, 0, "September", closedAt)
+	require.Error(t, err)
+}
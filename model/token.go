@@ -25,21 +25,29 @@ const (
 )
 
 type Token struct {
-	Id             int     `json:"id"`
-	UserId         int     `json:"user_id"`
-	Key            string  `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status         int     `json:"status" gorm:"default:1"`
-	Name           string  `json:"name" gorm:"index" `
-	CreatedTime    int64   `json:"created_time" gorm:"bigint"`
-	AccessedTime   int64   `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime    int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota    int64   `json:"remain_quota" gorm:"bigint;default:0"`
-	UnlimitedQuota bool    `json:"unlimited_quota" gorm:"default:false"`
-	UsedQuota      int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
-	CreatedAt      int64   `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
-	UpdatedAt      int64   `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
-	Models         *string `json:"models" gorm:"type:text"`  // allowed models
-	Subnet         *string `json:"subnet" gorm:"default:''"` // allowed subnet
+	Id                int     `json:"id"`
+	UserId            int     `json:"user_id"`
+	Key               string  `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Status            int     `json:"status" gorm:"default:1"`
+	Name              string  `json:"name" gorm:"index" `
+	CreatedTime       int64   `json:"created_time" gorm:"bigint"`
+	AccessedTime      int64   `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime       int64   `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota       int64   `json:"remain_quota" gorm:"bigint;default:0"`
+	UnlimitedQuota    bool    `json:"unlimited_quota" gorm:"default:false"`
+	UsedQuota         int64   `json:"used_quota" gorm:"bigint;default:0"` // used quota
+	CreatedAt         int64   `json:"created_at" gorm:"bigint;autoCreateTime:milli"`
+	UpdatedAt         int64   `json:"updated_at" gorm:"bigint;autoUpdateTime:milli"`
+	Models            *string `json:"models" gorm:"type:text"`                          // allowed models
+	Subnet            *string `json:"subnet" gorm:"default:''"`                         // allowed subnet
+	RateLimitRpm      int     `json:"rate_limit_rpm" gorm:"default:0"`                  // requests per minute, 0 means unlimited
+	RateLimitTpm      int     `json:"rate_limit_tpm" gorm:"default:0"`                  // prompt+completion tokens per minute, 0 means unlimited
+	BudgetQuota       int64   `json:"budget_quota" gorm:"bigint;default:0"`             // quota allowed per budget period, 0 means no budget
+	BudgetPeriod      string  `json:"budget_period" gorm:"type:varchar(16);default:''"` // day, week or month; windows start at UTC midnight
+	BudgetUsedQuota   int64   `json:"budget_used_quota" gorm:"bigint;default:0"`        // quota spent in the window starting at BudgetWindowStart
+	BudgetWindowStart int64   `json:"budget_window_start" gorm:"bigint;default:0"`      // unix timestamp of the current budget window
+	OrganizationId    int     `json:"organization_id" gorm:"index;default:0"`           // organization whose quota pool is charged, 0 means the user's own quota
+	Guardrails        *string `json:"guardrails" gorm:"type:text"`                      // extra guardrail rules (JSON array), appended to the group policy
 }
 
 // MarshalJSON ensures that any token serialized to JSON will include the configured key prefix.
@@ -55,38 +63,54 @@ func (t Token) MarshalJSON() ([]byte, error) {
 	}
 
 	type tokenDTO struct {
-		Id             int     `json:"id"`
-		UserId         int     `json:"user_id"`
-		Key            string  `json:"key"`
-		Status         int     `json:"status"`
-		Name           string  `json:"name"`
-		CreatedTime    int64   `json:"created_time"`
-		AccessedTime   int64   `json:"accessed_time"`
-		ExpiredTime    int64   `json:"expired_time"`
-		RemainQuota    int64   `json:"remain_quota"`
-		UnlimitedQuota bool    `json:"unlimited_quota"`
-		UsedQuota      int64   `json:"used_quota"`
-		CreatedAt      int64   `json:"created_at"`
-		UpdatedAt      int64   `json:"updated_at"`
-		Models         *string `json:"models"`
-		Subnet         *string `json:"subnet"`
+		Id                int     `json:"id"`
+		UserId            int     `json:"user_id"`
+		Key               string  `json:"key"`
+		Status            int     `json:"status"`
+		Name              string  `json:"name"`
+		CreatedTime       int64   `json:"created_time"`
+		AccessedTime      int64   `json:"accessed_time"`
+		ExpiredTime       int64   `json:"expired_time"`
+		RemainQuota       int64   `json:"remain_quota"`
+		UnlimitedQuota    bool    `json:"unlimited_quota"`
+		UsedQuota         int64   `json:"used_quota"`
+		CreatedAt         int64   `json:"created_at"`
+		UpdatedAt         int64   `json:"updated_at"`
+		Models            *string `json:"models"`
+		Subnet            *string `json:"subnet"`
+		RateLimitRpm      int     `json:"rate_limit_rpm"`
+		RateLimitTpm      int     `json:"rate_limit_tpm"`
+		BudgetQuota       int64   `json:"budget_quota"`
+		BudgetPeriod      string  `json:"budget_period"`
+		BudgetUsedQuota   int64   `json:"budget_used_quota"`
+		BudgetWindowStart int64   `json:"budget_window_start"`
+		OrganizationId    int     `json:"organization_id"`
+		Guardrails        *string `json:"guardrails"`
 	}
 	dto := tokenDTO{
-		Id:             t.Id,
-		UserId:         t.UserId,
-		Key:            prefix + raw,
-		Status:         t.Status,
-		Name:           t.Name,
-		CreatedTime:    t.CreatedTime,
-		AccessedTime:   t.AccessedTime,
-		ExpiredTime:    t.ExpiredTime,
-		RemainQuota:    t.RemainQuota,
-		UnlimitedQuota: t.UnlimitedQuota,
-		UsedQuota:      t.UsedQuota,
-		CreatedAt:      t.CreatedAt,
-		UpdatedAt:      t.UpdatedAt,
-		Models:         t.Models,
-		Subnet:         t.Subnet,
+		Id:                t.Id,
+		UserId:            t.UserId,
+		Key:               prefix + raw,
+		Status:            t.Status,
+		Name:              t.Name,
+		CreatedTime:       t.CreatedTime,
+		AccessedTime:      t.AccessedTime,
+		ExpiredTime:       t.ExpiredTime,
+		RemainQuota:       t.RemainQuota,
+		UnlimitedQuota:    t.UnlimitedQuota,
+		UsedQuota:         t.UsedQuota,
+		CreatedAt:         t.CreatedAt,
+		UpdatedAt:         t.UpdatedAt,
+		Models:            t.Models,
+		Subnet:            t.Subnet,
+		RateLimitRpm:      t.RateLimitRpm,
+		RateLimitTpm:      t.RateLimitTpm,
+		BudgetQuota:       t.BudgetQuota,
+		BudgetPeriod:      t.BudgetPeriod,
+		BudgetUsedQuota:   t.BudgetUsedQuota,
+		BudgetWindowStart: t.BudgetWindowStart,
+		OrganizationId:    t.OrganizationId,
+		Guardrails:        t.Guardrails,
 	}
 	return json.Marshal(dto)
 }
@@ -260,7 +284,8 @@ func (t *Token) Update(ctx context.Context) error {
 		ctx = context.Background()
 	}
 	var err error
-	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet").Updates(t).Error
+	err = DB.Model(t).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota", "models", "subnet",
+		"rate_limit_rpm", "rate_limit_tpm", "budget_quota", "budget_period", "organization_id", "guardrails").Updates(t).Error
 	if err == nil {
 		clearTokenCache(ctx, t.Key)
 		return nil
@@ -418,6 +443,9 @@ func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err er
 	if !token.UnlimitedQuota && token.RemainQuota < quota {
 		return errors.Errorf("insufficient token quota: required=%d, available=%d, tokenId=%d", quota, token.RemainQuota, tokenId)
 	}
+	if token.OrganizationId > 0 {
+		return preConsumeOrganizationQuota(ctx, token, quota)
+	}
 	userQuota, err := GetUserQuota(token.UserId)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get user quota for pre-consume: userId=%d, tokenId=%d", token.UserId, tokenId)
@@ -472,6 +500,28 @@ func PreConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err er
 	if err = DecreaseUserQuota(token.UserId, quota); err != nil {
 		return errors.Wrapf(err, "decrease quota for user %d in pre-consume", token.UserId)
 	}
+	recordTokenBudgetSpend(ctx, token, quota)
+	return nil
+}
+
+// preConsumeOrganizationQuota charges a token bound to an organization against the shared pool.
+func preConsumeOrganizationQuota(ctx context.Context, token *Token, quota int64) error {
+	orgQuota, err := GetOrganizationQuota(token.OrganizationId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get organization quota for pre-consume: organizationId=%d, tokenId=%d", token.OrganizationId, token.Id)
+	}
+	if orgQuota < quota {
+		return errors.Errorf("insufficient organization quota: required=%d, available=%d, organizationId=%d, tokenId=%d", quota, orgQuota, token.OrganizationId, token.Id)
+	}
+	if !token.UnlimitedQuota {
+		if err = DecreaseTokenQuota(ctx, token.Id, quota); err != nil {
+			return errors.Wrapf(err, "decrease quota for token %d", token.Id)
+		}
+	}
+	if err = consumeOrganizationQuota(token.OrganizationId, quota, true); err != nil {
+		return errors.Wrapf(err, "decrease quota for organization %d in pre-consume", token.OrganizationId)
+	}
+	recordTokenBudgetSpend(ctx, token, quota)
 	return nil
 }
 
@@ -483,7 +533,11 @@ func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err e
 	if err != nil {
 		return errors.Wrapf(err, "get token %d for post-consume", tokenId)
 	}
-	if quota > 0 {
+	if token.OrganizationId > 0 {
+		if err = consumeOrganizationQuota(token.OrganizationId, quota, false); err != nil {
+			return errors.Wrapf(err, "adjust organization quota for token %d in post-consume", tokenId)
+		}
+	} else if quota > 0 {
 		err = DecreaseUserQuota(token.UserId, quota)
 	} else {
 		err = IncreaseUserQuota(token.UserId, -quota)
@@ -498,5 +552,6 @@ func PostConsumeTokenQuota(ctx context.Context, tokenId int, quota int64) (err e
 			return errors.Wrapf(err, "adjust token %d quota in post-consume", tokenId)
 		}
 	}
+	recordTokenBudgetSpend(ctx, token, quota)
 	return nil
 }
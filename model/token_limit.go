@@ -0,0 +1,175 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+const (
+	TokenBudgetPeriodDay   = "day"
+	TokenBudgetPeriodWeek  = "week"
+	TokenBudgetPeriodMonth = "month"
+)
+
+// ValidTokenBudgetPeriod reports whether period is a supported budget period.
+func ValidTokenBudgetPeriod(period string) bool {
+	switch period {
+	case TokenBudgetPeriodDay, TokenBudgetPeriodWeek, TokenBudgetPeriodMonth:
+		return true
+	default:
+		return false
+	}
+}
+
+// TokenBudgetWindow returns the UTC [start, end) window of period that contains now.
+// Weeks start on Monday. Unknown periods fall back to daily windows.
+func TokenBudgetWindow(period string, now time.Time) (start, end time.Time) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case TokenBudgetPeriodWeek:
+		offset := (int(day.Weekday()) + 6) % 7
+		start = day.AddDate(0, 0, -offset)
+		return start, start.AddDate(0, 0, 7)
+	case TokenBudgetPeriodMonth:
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return day, day.AddDate(0, 0, 1)
+	}
+}
+
+// BudgetSpent returns the quota the token has spent in the budget window containing now.
+func (t *Token) BudgetSpent(now time.Time) int64 {
+	if t.BudgetQuota <= 0 {
+		return 0
+	}
+	start, _ := TokenBudgetWindow(t.BudgetPeriod, now)
+	if t.BudgetWindowStart != start.Unix() {
+		return 0
+	}
+	return t.BudgetUsedQuota
+}
+
+// recordTokenBudgetSpend adds quota (negative for refunds) to the token's rolling budget.
+// The counter restarts whenever the stored window is not the current one. Failures are
+// logged only, since the spend itself has already been applied to the token and user.
+func recordTokenBudgetSpend(ctx context.Context, token *Token, quota int64) {
+	if token == nil || token.BudgetQuota <= 0 || quota == 0 {
+		return
+	}
+
+	start, _ := TokenBudgetWindow(token.BudgetPeriod, time.Now())
+	windowStart := start.Unix()
+	err := runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Model(&Token{}).Where("id = ?", token.Id).Updates(map[string]any{
+			"budget_used_quota": gorm.Expr(
+				"CASE WHEN budget_window_start = ? THEN budget_used_quota + ? ELSE ? END",
+				windowStart, quota, max(quota, 0)),
+			"budget_window_start": windowStart,
+		}).Error
+	})
+	if err != nil {
+		logger.Logger.Error("failed to record token budget spend",
+			zap.Int("token_id", token.Id),
+			zap.Int64("quota", quota),
+			zap.Error(err))
+		return
+	}
+	clearTokenCache(ctx, token.Key)
+}
+
+// tokenMinuteCounter sums consumed tokens per token in fixed one-minute windows when
+// Redis is not available.
+type tokenMinuteCounter struct {
+	mu      sync.Mutex
+	buckets map[int]tokenMinuteBucket
+}
+
+type tokenMinuteBucket struct {
+	minute int64
+	tokens int64
+}
+
+var localTokenMinuteCounter = &tokenMinuteCounter{buckets: map[int]tokenMinuteBucket{}}
+
+func (c *tokenMinuteCounter) add(tokenId int, minute, tokens int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	bucket := c.buckets[tokenId]
+	if bucket.minute != minute {
+		bucket = tokenMinuteBucket{minute: minute}
+	}
+	bucket.tokens += tokens
+	c.buckets[tokenId] = bucket
+
+	// drop stale buckets opportunistically so idle tokens do not accumulate
+	if len(c.buckets) > 1024 {
+		for id, b := range c.buckets {
+			if b.minute < minute {
+				delete(c.buckets, id)
+			}
+		}
+	}
+}
+
+func (c *tokenMinuteCounter) get(tokenId int, minute int64) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if bucket, ok := c.buckets[tokenId]; ok && bucket.minute == minute {
+		return bucket.tokens
+	}
+	return 0
+}
+
+func tokenMinuteUsageKey(tokenId int, minute int64) string {
+	return fmt.Sprintf("rateLimit:TPM:%d:%d", tokenId, minute)
+}
+
+// RecordTokenMinuteUsage adds consumed prompt+completion tokens to the token's TPM window.
+func RecordTokenMinuteUsage(ctx context.Context, tokenId int, tokens int64) error {
+	if tokenId <= 0 || tokens <= 0 {
+		return nil
+	}
+	minute := time.Now().Unix() / 60
+	if !common.IsRedisEnabled() {
+		localTokenMinuteCounter.add(tokenId, minute, tokens)
+		return nil
+	}
+
+	key := tokenMinuteUsageKey(tokenId, minute)
+	if err := common.RDB.IncrBy(ctx, key, tokens).Err(); err != nil {
+		return errors.Wrapf(err, "incr token %d minute usage", tokenId)
+	}
+	if err := common.RDB.Expire(ctx, key, 2*time.Minute).Err(); err != nil {
+		return errors.Wrapf(err, "expire token %d minute usage", tokenId)
+	}
+	return nil
+}
+
+// GetTokenMinuteUsage returns the tokens consumed by the token in the current minute.
+func GetTokenMinuteUsage(ctx context.Context, tokenId int) (int64, error) {
+	minute := time.Now().Unix() / 60
+	if !common.IsRedisEnabled() {
+		return localTokenMinuteCounter.get(tokenId, minute), nil
+	}
+
+	used, err := common.RDB.Get(ctx, tokenMinuteUsageKey(tokenId, minute)).Int64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, errors.Wrapf(err, "get token %d minute usage", tokenId)
+	}
+	return used, nil
+}
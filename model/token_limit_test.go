@@ -0,0 +1,85 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+func setupTokenLimitTestDB(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Token{}))
+
+	originalDB := DB
+	DB = db
+	t.Cleanup(func() { DB = originalDB })
+
+	originalUsingSQLite := common.UsingSQLite.Load()
+	common.UsingSQLite.Store(true)
+	t.Cleanup(func() { common.UsingSQLite.Store(originalUsingSQLite) })
+}
+
+func TestTokenBudgetWindow(t *testing.T) {
+	t.Parallel()
+
+	// Wednesday afternoon in UTC+8 is still Wednesday morning in UTC
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.FixedZone("UTC+8", 8*3600))
+
+	start, end := TokenBudgetWindow(TokenBudgetPeriodDay, now)
+	require.Equal(t, time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = TokenBudgetWindow(TokenBudgetPeriodWeek, now)
+	require.Equal(t, time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC), end)
+
+	start, end = TokenBudgetWindow(TokenBudgetPeriodMonth, now)
+	require.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), end)
+}
+
+func TestRecordTokenBudgetSpend(t *testing.T) {
+	setupTokenLimitTestDB(t)
+
+	token := &Token{Id: 1, Key: "budget-key", BudgetQuota: 1000, BudgetPeriod: TokenBudgetPeriodDay}
+	require.NoError(t, DB.Create(token).Error)
+
+	ctx := context.Background()
+	recordTokenBudgetSpend(ctx, token, 300)
+	recordTokenBudgetSpend(ctx, token, 200)
+	recordTokenBudgetSpend(ctx, token, -100)
+
+	reloaded, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(400), reloaded.BudgetSpent(time.Now()))
+
+	// spend from a previous window is discarded on the next write
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).
+		Update("budget_window_start", reloaded.BudgetWindowStart-86400).Error)
+	reloaded, err = GetTokenById(token.Id)
+	require.NoError(t, err)
+	require.Zero(t, reloaded.BudgetSpent(time.Now()))
+
+	recordTokenBudgetSpend(ctx, reloaded, 50)
+	reloaded, err = GetTokenById(token.Id)
+	require.NoError(t, err)
+	require.Equal(t, int64(50), reloaded.BudgetSpent(time.Now()))
+}
+
+func TestTokenMinuteUsageInMemory(t *testing.T) {
+	ctx := context.Background()
+	require.NoError(t, RecordTokenMinuteUsage(ctx, 4242, 120))
+	require.NoError(t, RecordTokenMinuteUsage(ctx, 4242, 30))
+
+	used, err := GetTokenMinuteUsage(ctx, 4242)
+	require.NoError(t, err)
+	// a minute boundary between the two calls would reset the counter
+	require.Contains(t, []int64{30, 150}, used)
+}
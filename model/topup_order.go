@@ -0,0 +1,245 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Statuses of top-up orders.
+const (
+	TopUpOrderStatusPending  = "pending"
+	TopUpOrderStatusPaid     = "paid"
+	TopUpOrderStatusRefunded = "refunded"
+	// TopUpOrderStatusMismatched marks an order paid with another amount or currency than it
+	// was created with. It is not credited and is left to admins.
+	TopUpOrderStatusMismatched = "mismatched"
+)
+
+// ErrTopUpOrderMismatch is returned when a payment does not match the amount or currency of
+// its order.
+var ErrTopUpOrderMismatch = errors.New("payment does not match the top-up order")
+
+// TopUpOrder is a self-service top-up paid through a payment provider.
+type TopUpOrder struct {
+	Id int `json:"id"`
+	// TradeNo identifies the order with the payment provider.
+	TradeNo   string `json:"trade_no" gorm:"type:varchar(64);uniqueIndex"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	Provider  string `json:"provider" gorm:"type:varchar(32)"`
+	SessionId string `json:"session_id" gorm:"type:varchar(255);index"`
+	// PaymentId is the provider's payment, known once the order is paid.
+	PaymentId     string `json:"payment_id" gorm:"type:varchar(255);index"`
+	AmountCents   int64  `json:"amount_cents" gorm:"bigint"`
+	Currency      string `json:"currency" gorm:"type:varchar(8)"`
+	Quota         int64  `json:"quota" gorm:"bigint"`
+	RefundedCents int64  `json:"refunded_cents" gorm:"bigint;default:0"`
+	// RefundedQuota is the refunded share of Quota, whether or not it could be taken back
+	// from the user.
+	RefundedQuota int64  `json:"refunded_quota" gorm:"bigint;default:0"`
+	Status        string `json:"status" gorm:"type:varchar(16);index"`
+	PaidAt        int64  `json:"paid_at" gorm:"bigint;default:0"`
+	CreatedAt     int64  `json:"created_at" gorm:"bigint;autoCreateTime"`
+	UpdatedAt     int64  `json:"updated_at" gorm:"bigint;autoUpdateTime"`
+}
+
+// Insert records a new pending order.
+func (order *TopUpOrder) Insert() error {
+	order.Status = TopUpOrderStatusPending
+	if err := DB.Create(order).Error; err != nil {
+		return errors.Wrapf(err, "insert top-up order %s", order.TradeNo)
+	}
+	return nil
+}
+
+// SetTopUpOrderSession records the checkout session created for the order.
+func SetTopUpOrderSession(tradeNo string, sessionId string) error {
+	err := DB.Model(&TopUpOrder{}).Where("trade_no = ?", tradeNo).Update("session_id", sessionId).Error
+	if err != nil {
+		return errors.Wrapf(err, "set session of top-up order %s", tradeNo)
+	}
+	return nil
+}
+
+// GetUserTopUpOrders lists the user's top-up orders, newest first.
+func GetUserTopUpOrders(userId int, startIdx int, num int) (orders []*TopUpOrder, total int64, err error) {
+	db := DB.Model(&TopUpOrder{}).Where("user_id = ?", userId)
+	if err = db.Count(&total).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "count top-up orders of user %d", userId)
+	}
+	if err = db.Order("id desc").Limit(num).Offset(startIdx).Find(&orders).Error; err != nil {
+		return nil, 0, errors.Wrapf(err, "list top-up orders of user %d", userId)
+	}
+	return orders, total, nil
+}
+
+// CompleteTopUpOrder credits the user of a paid order. Providers deliver events at least once,
+// so only the first call for an order credits anything; it returns whether it did.
+//
+// A payment that does not match the order flags it as mismatched, without crediting it, and
+// returns ErrTopUpOrderMismatch.
+func CompleteTopUpOrder(ctx context.Context, tradeNo string, paymentId string, amountCents int64, currency string) (credited bool, err error) {
+	order := &TopUpOrder{}
+	var mismatch error
+	err = runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			credited, mismatch = false, nil
+			if err := tx.Where("trade_no = ?", tradeNo).First(order).Error; err != nil {
+				return errors.Wrapf(err, "find top-up order %s", tradeNo)
+			}
+			if order.Status != TopUpOrderStatusPending {
+				return nil
+			}
+			if amountCents != order.AmountCents || !strings.EqualFold(currency, order.Currency) {
+				result := tx.Model(&TopUpOrder{}).Where("id = ? AND status = ?", order.Id, TopUpOrderStatusPending).
+					Updates(map[string]any{"status": TopUpOrderStatusMismatched, "payment_id": paymentId})
+				if result.Error != nil {
+					return errors.Wrapf(result.Error, "flag top-up order %s mismatched", tradeNo)
+				}
+				mismatch = errors.Wrapf(ErrTopUpOrderMismatch, "top-up order %s was paid %d %s, expected %d %s",
+					tradeNo, amountCents, currency, order.AmountCents, order.Currency)
+				return nil
+			}
+
+			now := helper.GetTimestamp()
+			result := tx.Model(&TopUpOrder{}).Where("id = ? AND status = ?", order.Id, TopUpOrderStatusPending).
+				Updates(map[string]any{"status": TopUpOrderStatusPaid, "payment_id": paymentId, "paid_at": now})
+			if result.Error != nil {
+				return errors.Wrapf(result.Error, "mark top-up order %s paid", tradeNo)
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			credited = true
+			return grantCredit(tx, &CreditGrant{
+				UserId:    order.UserId,
+				Source:    CreditSourceTopUp,
+				Reference: order.TradeNo,
+				Amount:    order.Quota,
+			})
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	if mismatch != nil {
+		return false, mismatch
+	}
+	if !credited {
+		return false, nil
+	}
+
+	invalidateUserCache(ctx, order.UserId)
+	RecordTopupLog(ctx, order.UserId, fmt.Sprintf("Topped up %s via %s, order %s", common.LogQuota(order.Quota), order.Provider, order.TradeNo), int(order.Quota))
+	return true, nil
+}
+
+// RefundTopUpOrder takes back the quota of the refunded share of the order paid with
+// paymentId. refundedCents is the total refunded so far, so replayed refund events take
+// nothing back twice. Quota the user already spent cannot be taken back; it is left to
+// admins, and the top-up log tells how much it was.
+func RefundTopUpOrder(ctx context.Context, paymentId string, refundedCents int64) (clawedBack int64, err error) {
+	if paymentId == "" {
+		return 0, errors.New("payment id is empty")
+	}
+
+	order := &TopUpOrder{}
+	var due int64
+	err = runWithSQLiteBusyRetry(ctx, func() error {
+		return DB.Transaction(func(tx *gorm.DB) error {
+			clawedBack, due = 0, 0
+			if err := tx.Where("payment_id = ?", paymentId).First(order).Error; err != nil {
+				return errors.Wrapf(err, "find top-up order paid with %s", paymentId)
+			}
+			refunded := min(refundedCents, order.AmountCents)
+			if refunded <= order.RefundedCents || order.AmountCents <= 0 {
+				return nil
+			}
+
+			// the quota due back is the refunded share of the order, less what earlier
+			// refunds already accounted for
+			refundedQuota := int64(math.Round(float64(order.Quota) * float64(refunded) / float64(order.AmountCents)))
+			due = max(refundedQuota-order.RefundedQuota, 0)
+
+			var userQuota int64
+			if err := tx.Model(&User{}).Where("id = ?", order.UserId).Select("quota").Scan(&userQuota).Error; err != nil {
+				return errors.Wrapf(err, "get quota of user %d", order.UserId)
+			}
+			clawedBack = min(due, max(userQuota, 0))
+			if clawedBack > 0 {
+				result := tx.Model(&User{}).Where("id = ? AND quota >= ?", order.UserId, clawedBack).
+					Update("quota", gorm.Expr("quota - ?", clawedBack))
+				if result.Error != nil {
+					return errors.Wrapf(result.Error, "decrease quota for user %d", order.UserId)
+				}
+				if result.RowsAffected == 0 {
+					return errors.Errorf("quota of user %d changed during refund", order.UserId)
+				}
+				if err := clawBackCreditGrant(tx, order, clawedBack); err != nil {
+					return err
+				}
+			}
+
+			status := TopUpOrderStatusPaid
+			if refunded >= order.AmountCents {
+				status = TopUpOrderStatusRefunded
+			}
+			// the whole refunded share counts as accounted for, spent or not, so that later
+			// partial refunds only take back their own share
+			return tx.Model(&TopUpOrder{}).Where("id = ?", order.Id).Updates(map[string]any{
+				"refunded_cents": refunded,
+				"refunded_quota": order.RefundedQuota + due,
+				"status":         status,
+			}).Error
+		})
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "refund top-up paid with %s", paymentId)
+	}
+	if due == 0 {
+		return 0, nil
+	}
+
+	invalidateUserCache(ctx, order.UserId)
+	content := fmt.Sprintf("Refund of top-up order %s took back %s", order.TradeNo, common.LogQuota(clawedBack))
+	if clawedBack < due {
+		content += fmt.Sprintf(", %s was already spent", common.LogQuota(due-clawedBack))
+		logger.Logger.Warn("refunded top-up quota was already spent",
+			zap.Int("user_id", order.UserId),
+			zap.String("trade_no", order.TradeNo),
+			zap.Int64("due", due),
+			zap.Int64("clawed_back", clawedBack))
+	}
+	RecordTopupLog(ctx, order.UserId, content, -int(clawedBack))
+	return clawedBack, nil
+}
+
+// clawBackCreditGrant takes quota taken back by a refund out of the order's credit grant
+// first, then out of the user's other grants.
+func clawBackCreditGrant(tx *gorm.DB, order *TopUpOrder, quota int64) error {
+	var grant CreditGrant
+	err := tx.Where("user_id = ? AND source = ? AND reference = ?", order.UserId, CreditSourceTopUp, order.TradeNo).
+		Limit(1).Find(&grant).Error
+	if err != nil {
+		return errors.Wrapf(err, "find credit grant of top-up order %s", order.TradeNo)
+	}
+	fromGrant := int64(0)
+	if grant.Id != 0 && grant.Remaining > 0 {
+		fromGrant = min(grant.Remaining, quota)
+		err = tx.Model(&CreditGrant{}).Where("id = ?", grant.Id).
+			Update("remaining", gorm.Expr("remaining - ?", fromGrant)).Error
+		if err != nil {
+			return errors.Wrapf(err, "claw back credit grant %d", grant.Id)
+		}
+	}
+	return applyCreditGrantDelta(tx, order.UserId, -(quota - fromGrant))
+}
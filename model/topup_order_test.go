@@ -0,0 +1,105 @@
+package model
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func setupTopUpOrderTest(t *testing.T) *TopUpOrder {
+	t.Helper()
+	setupCreditGrantTestDB(t)
+	require.NoError(t, DB.AutoMigrate(&TopUpOrder{}))
+	require.NoError(t, DB.Create(&User{Id: 1, Username: "alice", AccessToken: "alice", AffCode: "alice"}).Error)
+
+	order := &TopUpOrder{TradeNo: "topup_1", UserId: 1, Provider: "stripe", AmountCents: 1000, Currency: "usd", Quota: 1000}
+	require.NoError(t, order.Insert())
+	return order
+}
+
+func TestCompleteTopUpOrderIsIdempotent(t *testing.T) {
+	setupTopUpOrderTest(t)
+	ctx := context.Background()
+
+	_, err := CompleteTopUpOrder(ctx, "topup_unknown", "pi_0", 1000, "usd")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	credited, err := CompleteTopUpOrder(ctx, "topup_1", "pi_1", 1000, "USD")
+	require.NoError(t, err)
+	require.True(t, credited)
+	credited, err = CompleteTopUpOrder(ctx, "topup_1", "pi_1", 1000, "usd")
+	require.NoError(t, err)
+	require.False(t, credited, "a replayed event must not credit the order again")
+
+	quota, err := GetUserQuota(1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), quota)
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 1000}, creditGrantRemaining(t, 1))
+
+	var order TopUpOrder
+	require.NoError(t, DB.Where("trade_no = ?", "topup_1").First(&order).Error)
+	require.Equal(t, TopUpOrderStatusPaid, order.Status)
+	require.Equal(t, "pi_1", order.PaymentId)
+
+	var logs int64
+	require.NoError(t, LOG_DB.Model(&Log{}).Where("user_id = ? AND type = ?", 1, LogTypeTopup).Count(&logs).Error)
+	require.Equal(t, int64(1), logs)
+}
+
+func TestCompleteTopUpOrderFlagsMismatch(t *testing.T) {
+	setupTopUpOrderTest(t)
+	ctx := context.Background()
+
+	credited, err := CompleteTopUpOrder(ctx, "topup_1", "pi_1", 999, "usd")
+	require.ErrorIs(t, err, ErrTopUpOrderMismatch)
+	require.False(t, credited, "an amount that does not match the order must not credit it")
+
+	// the flagged order is settled, so a replay neither credits nor fails
+	credited, err = CompleteTopUpOrder(ctx, "topup_1", "pi_1", 1000, "usd")
+	require.NoError(t, err)
+	require.False(t, credited)
+
+	var order TopUpOrder
+	require.NoError(t, DB.Where("trade_no = ?", "topup_1").First(&order).Error)
+	require.Equal(t, TopUpOrderStatusMismatched, order.Status)
+	require.Equal(t, "pi_1", order.PaymentId)
+	quota, err := GetUserQuota(1)
+	require.NoError(t, err)
+	require.Zero(t, quota)
+}
+
+func TestRefundTopUpOrder(t *testing.T) {
+	setupTopUpOrderTest(t)
+	ctx := context.Background()
+	_, err := CompleteTopUpOrder(ctx, "topup_1", "pi_1", 1000, "usd")
+	require.NoError(t, err)
+
+	// a partial refund takes back its share, and replaying it takes nothing more
+	clawedBack, err := RefundTopUpOrder(ctx, "pi_1", 300)
+	require.NoError(t, err)
+	require.Equal(t, int64(300), clawedBack)
+	clawedBack, err = RefundTopUpOrder(ctx, "pi_1", 300)
+	require.NoError(t, err)
+	require.Zero(t, clawedBack)
+	require.Equal(t, map[string]int64{CreditSourceTopUp: 700}, creditGrantRemaining(t, 1))
+
+	// quota already spent cannot be taken back
+	require.NoError(t, DecreaseUserQuota(1, 500))
+	clawedBack, err = RefundTopUpOrder(ctx, "pi_1", 1000)
+	require.NoError(t, err)
+	require.Equal(t, int64(200), clawedBack)
+
+	quota, err := GetUserQuota(1)
+	require.NoError(t, err)
+	require.Zero(t, quota)
+	var order TopUpOrder
+	require.NoError(t, DB.Where("trade_no = ?", "topup_1").First(&order).Error)
+	require.Equal(t, TopUpOrderStatusRefunded, order.Status)
+	require.Equal(t, int64(1000), order.RefundedCents)
+	require.Equal(t, int64(1000), order.RefundedQuota)
+
+	_, err = RefundTopUpOrder(ctx, "pi_unknown", 100)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
@@ -164,15 +164,18 @@ func (user *User) Insert(ctx context.Context, inviterId int) error {
 		return errors.Wrapf(result.Error, "failed to create user: username=%s, inviterId=%d", user.Username, inviterId)
 	}
 	if config.QuotaForNewUser > 0 {
+		if err = recordCreditGrant(DB, &CreditGrant{UserId: user.Id, Source: CreditSourceSignup, Amount: config.QuotaForNewUser}); err != nil {
+			logger.Logger.Error("failed to record signup credit grant", zap.Int("user_id", user.Id), zap.Error(err))
+		}
 		RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("New user registration gift %s", common.LogQuota(config.QuotaForNewUser)))
 	}
 	if inviterId != 0 {
 		if config.QuotaForInvitee > 0 {
-			_ = IncreaseUserQuota(user.Id, config.QuotaForInvitee)
+			_ = GrantCredit(ctx, &CreditGrant{UserId: user.Id, Source: CreditSourceInvitation, Amount: config.QuotaForInvitee})
 			RecordLog(ctx, user.Id, LogTypeSystem, fmt.Sprintf("Gifted %s for using invitation code", common.LogQuota(config.QuotaForInvitee)))
 		}
 		if config.QuotaForInviter > 0 {
-			_ = IncreaseUserQuota(inviterId, config.QuotaForInviter)
+			_ = GrantCredit(ctx, &CreditGrant{UserId: inviterId, Source: CreditSourceInvitation, Reference: fmt.Sprint(user.Id), Amount: config.QuotaForInviter})
 			RecordLog(ctx, inviterId, LogTypeSystem, fmt.Sprintf("Gifted %s for inviting user", common.LogQuota(config.QuotaForInviter)))
 		}
 	}
@@ -214,6 +217,7 @@ func (user *User) Update(updatePassword bool) error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to update user: id=%d, username=%s", user.Id, user.Username)
 	}
+	invalidateUserCache(context.Background(), user.Id)
 	return nil
 }
 
@@ -239,6 +243,7 @@ func (user *User) Delete() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to delete user: id=%d", user.Id)
 	}
+	invalidateUserCache(context.Background(), user.Id)
 	return nil
 }
 
@@ -446,9 +451,16 @@ func IncreaseUserQuota(id int, quota int64) (err error) {
 	return increaseUserQuota(id, quota)
 }
 
+// increaseUserQuota changes the user's quota by quota, which is negative for batched charges,
+// and follows the change on the user's credit grants.
 func increaseUserQuota(id int, quota int64) (err error) {
 	err = runWithSQLiteBusyRetry(nil, func() error {
-		return DB.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error
+		return DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&User{}).Where("id = ?", id).Update("quota", gorm.Expr("quota + ?", quota)).Error; err != nil {
+				return err
+			}
+			return applyCreditGrantDelta(tx, id, quota)
+		})
 	})
 	if err != nil {
 		return errors.Wrapf(err, "increase quota for user %d", id)
@@ -470,10 +482,15 @@ func DecreaseUserQuota(id int, quota int64) (err error) {
 func decreaseUserQuota(id int, quota int64) (err error) {
 	var result *gorm.DB
 	err = runWithSQLiteBusyRetry(nil, func() error {
-		result = DB.Model(&User{}).
-			Where("id = ? AND quota >= ?", id, quota).
-			Update("quota", gorm.Expr("quota - ?", quota))
-		return result.Error
+		return DB.Transaction(func(tx *gorm.DB) error {
+			result = tx.Model(&User{}).
+				Where("id = ? AND quota >= ?", id, quota).
+				Update("quota", gorm.Expr("quota - ?", quota))
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return applyCreditGrantDelta(tx, id, -quota)
+		})
 	})
 	if err != nil {
 		return errors.Wrapf(err, "decrease quota for user %d", id)
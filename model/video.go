@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// VideoJob tracks an asynchronous /v1/videos generation job together with the
+// TokenTransaction that holds its quota until the upstream job finishes.
+//
+// Fields:
+//   - VideoId: public video identifier returned to the client.
+//   - UpstreamId: upstream job identifier, e.g. an OpenAI video id, a Veo operation name
+//     or a Replicate prediction id.
+//   - ChannelId/ChannelKeyId: channel and key the job was created with; all polls are pinned to them.
+//   - ModelName: actual upstream model, used to price the job on completion.
+//   - Seconds: requested clip length, zero for the upstream default.
+//   - QuotaPerSecond: quota charged per generated second, priced with the group ratio at creation.
+//   - BilledSeconds: generated seconds charged on completion.
+//   - TransactionId: primary key of the pending TokenTransaction holding PreQuota.
+//   - LogId: consume log entry updated with the final quota on settlement.
+//   - Settled: true once the transaction was confirmed or canceled.
+type VideoJob struct {
+	Id             int     `json:"id"`
+	VideoId        string  `json:"video_id" gorm:"type:varchar(64);uniqueIndex"`
+	UpstreamId     string  `json:"upstream_id" gorm:"type:varchar(512)"`
+	UserId         int     `json:"user_id" gorm:"index"`
+	TokenId        int     `json:"token_id" gorm:"index"`
+	TokenName      string  `json:"token_name"`
+	Group          string  `json:"group" gorm:"type:varchar(32)"`
+	GroupRatio     float64 `json:"group_ratio"`
+	ChannelId      int     `json:"channel_id" gorm:"index"`
+	ChannelType    int     `json:"channel_type"`
+	ChannelKeyId   int     `json:"channel_key_id"`
+	OriginModel    string  `json:"origin_model" gorm:"type:varchar(128)"`
+	ModelName      string  `json:"model_name" gorm:"type:varchar(128)"`
+	Size           string  `json:"size" gorm:"type:varchar(32)"`
+	Seconds        int     `json:"seconds"`
+	QuotaPerSecond float64 `json:"quota_per_second"`
+	BilledSeconds  int     `json:"billed_seconds"`
+	Status         string  `json:"status" gorm:"type:varchar(32);index"`
+	Progress       int     `json:"progress"`
+	Error          string  `json:"error" gorm:"type:text"`
+	TransactionId  int     `json:"transaction_id"`
+	LogId          int     `json:"log_id"`
+	PreQuota       int64   `json:"pre_quota"`
+	FinalQuota     int64   `json:"final_quota"`
+	Settled        bool    `json:"settled" gorm:"default:false;index"`
+	RequestId      string  `json:"request_id" gorm:"type:varchar(64)"`
+	CreatedAt      int64   `json:"created_at" gorm:"bigint;autoCreateTime"`
+	UpdatedAt      int64   `json:"updated_at" gorm:"bigint;autoUpdateTime"`
+	CompletedAt    int64   `json:"completed_at" gorm:"bigint"`
+}
+
+// CreateVideoJob inserts a new video job record.
+func CreateVideoJob(ctx context.Context, job *VideoJob) error {
+	if err := DB.WithContext(ctx).Create(job).Error; err != nil {
+		return errors.Wrapf(err, "create video job %s", job.VideoId)
+	}
+	return nil
+}
+
+// GetVideoJobByUser returns the video job owned by userId.
+func GetVideoJobByUser(ctx context.Context, userId int, videoId string) (*VideoJob, error) {
+	job := &VideoJob{}
+	if err := DB.WithContext(ctx).Where("user_id = ? AND video_id = ?", userId, videoId).First(job).Error; err != nil {
+		return nil, errors.Wrapf(err, "get video job %s for user %d", videoId, userId)
+	}
+	return job, nil
+}
+
+// ListUnsettledVideoJobs returns video jobs whose quota hold is still pending, oldest first.
+func ListUnsettledVideoJobs(ctx context.Context, limit int) ([]*VideoJob, error) {
+	var jobs []*VideoJob
+	if err := DB.WithContext(ctx).Where("settled = ?", false).Order("id asc").Limit(limit).Find(&jobs).Error; err != nil {
+		return nil, errors.Wrap(err, "list unsettled video jobs")
+	}
+	return jobs, nil
+}
+
+// UpdateVideoJob applies a partial update to a video job.
+func UpdateVideoJob(ctx context.Context, id int, updates map[string]any) error {
+	if len(updates) == 0 {
+		return nil
+	}
+	if err := DB.WithContext(ctx).Model(&VideoJob{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return errors.Wrapf(err, "update video job %d", id)
+	}
+	return nil
+}
+
+// ClaimVideoJobSettlement marks an unsettled video job as settled together with updates.
+// It returns false when another request or the background poller settled the job first,
+// in which case the caller must not touch the quota hold.
+func ClaimVideoJobSettlement(ctx context.Context, id int, updates map[string]any) (bool, error) {
+	values := map[string]any{"settled": true}
+	for k, v := range updates {
+		values[k] = v
+	}
+	result := DB.WithContext(ctx).Model(&VideoJob{}).Where("id = ? AND settled = ?", id, false).Updates(values)
+	if result.Error != nil {
+		return false, errors.Wrapf(result.Error, "claim settlement of video job %d", id)
+	}
+	return result.RowsAffected == 1, nil
+}
@@ -46,18 +46,22 @@ func DisableChannel(channelId int, channelName string, reason string) {
 	notifyRootUser(subject, content)
 }
 
-func MetricDisableChannel(channelId int, successRate float64) {
-	model.UpdateChannelStatusById(channelId, model.ChannelStatusAutoDisabled)
-	logger.Logger.Info("channel has been disabled due to low success rate", zap.Int("id", channelId), zap.Float64("success_rate", successRate*100))
-	subject := fmt.Sprintf("Channel Status Change Reminder")
+// DisableChannelKey disables a single pooled key of a multi-key channel & notify
+func DisableChannelKey(channelId int, channelName string, keyId int, reason string) {
+	if err := model.UpdateChannelKeyStatus(keyId, model.ChannelKeyStatusAutoDisabled, reason); err != nil {
+		logger.Logger.Error("failed to disable channel key", zap.Int("channel_id", channelId), zap.Int("key_id", keyId), zap.Error(err))
+		return
+	}
+	logger.Logger.Info("channel key has been disabled", zap.Int("channel_id", channelId), zap.Int("key_id", keyId), zap.String("reason", reason))
+	subject := fmt.Sprintf("Channel Key Status Change Reminder")
 	content := message.EmailTemplate(
 		subject,
 		fmt.Sprintf(`
             <p>Hello!</p>
-            <p>Channel #%d has been automatically disabled by the system.</p>
+            <p>Key #%d of channel “<strong>%s</strong>” (#%d) has been disabled.</p>
             <p>Reason for disabling:</p>
-            <p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">In the last %d calls, the success rate of this channel was <strong>%.2f%%</strong>, which is below the system threshold of <strong>%.2f%%</strong>.</p>
-        `, channelId, config.MetricQueueSize, successRate*100, config.MetricSuccessRateThreshold*100),
+            <p style="background-color: #f8f8f8; padding: 10px; border-radius: 4px;">%s</p>
+        `, keyId, channelName, channelId, reason),
 	)
 	notifyRootUser(subject, content)
 }
@@ -1,60 +1,183 @@
 package monitor
 
 import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
 )
 
-var store = make(map[int][]bool)
-var metricSuccessChan = make(chan int, config.MetricSuccessChanSize)
-var metricFailChan = make(chan int, config.MetricFailChanSize)
+// Circuit breaker states. A channel serves a model while its circuit is closed. The circuit
+// opens once the success rate of the last MetricQueueSize requests drops below
+// MetricSuccessRateThreshold, and channel selection skips the channel for that model only.
+// After CircuitBreakerOpenSeconds the circuit turns half-open and trial probes are sent to the
+// channel; CircuitBreakerProbes successes in a row close it again, a failure reopens it.
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
 
-func consumeSuccess(channelId int) {
-	if len(store[channelId]) > config.MetricQueueSize {
-		store[channelId] = store[channelId][1:]
-	}
-	store[channelId] = append(store[channelId], true)
+// CircuitBreaker is the state of the circuit of a channel for a model.
+type CircuitBreaker struct {
+	ChannelId   int     `json:"channel_id"`
+	Model       string  `json:"model"`
+	State       string  `json:"state"`
+	SuccessRate float64 `json:"success_rate"`
+	Samples     int     `json:"samples"`
+	ChangedAt   int64   `json:"changed_at"`
+	RetryAt     int64   `json:"retry_at,omitempty"`
+}
+
+// Prober sends a trial request for the model to the channel, nil meaning it succeeded.
+type Prober func(ctx context.Context, channelId int, modelName string) error
+
+type circuitKey struct {
+	channelId int
+	model     string
+}
+
+type circuit struct {
+	state string
+	// outcomes of the latest requests while closed, oldest first
+	outcomes  []bool
+	changedAt time.Time
+	// when an open circuit turns half-open
+	retryAt time.Time
 }
 
-func consumeFail(channelId int) (bool, float64) {
-	if len(store[channelId]) > config.MetricQueueSize {
-		store[channelId] = store[channelId][1:]
+type outcome struct {
+	key     circuitKey
+	success bool
+}
+
+var (
+	circuitLock sync.RWMutex
+	circuits    = make(map[circuitKey]*circuit)
+	prober      Prober
+
+	metricSuccessChan = make(chan outcome, config.MetricSuccessChanSize)
+	metricFailChan    = make(chan outcome, config.MetricFailChanSize)
+)
+
+func (c *circuit) successRate() float64 {
+	if len(c.outcomes) == 0 {
+		return 1
 	}
-	store[channelId] = append(store[channelId], false)
 	successCount := 0
-	for _, success := range store[channelId] {
+	for _, success := range c.outcomes {
 		if success {
 			successCount++
 		}
 	}
-	successRate := float64(successCount) / float64(len(store[channelId]))
-	if len(store[channelId]) < config.MetricQueueSize {
-		return false, successRate
+	return float64(successCount) / float64(len(c.outcomes))
+}
+
+func (c *circuit) snapshot(key circuitKey) CircuitBreaker {
+	breaker := CircuitBreaker{
+		ChannelId:   key.channelId,
+		Model:       key.model,
+		State:       c.state,
+		SuccessRate: c.successRate(),
+		Samples:     len(c.outcomes),
+		ChangedAt:   c.changedAt.Unix(),
 	}
-	if successRate < config.MetricSuccessRateThreshold {
-		store[channelId] = make([]bool, 0)
-		return true, successRate
+	if c.state == CircuitOpen {
+		breaker.RetryAt = c.retryAt.Unix()
 	}
-	return false, successRate
+	return breaker
+}
+
+// setState moves the circuit to state, the caller holding circuitLock.
+func setState(key circuitKey, c *circuit, state string, now time.Time) {
+	from := c.state
+	c.state = state
+	c.changedAt = now
+	c.outcomes = nil
+	if state == CircuitOpen {
+		c.retryAt = now.Add(time.Duration(config.CircuitBreakerOpenSeconds) * time.Second)
+	}
+	metrics.GlobalRecorder.RecordCircuitBreakerTransition(key.channelId, key.model, from, state)
+	logger.Logger.Info("channel circuit breaker state changed",
+		zap.Int("channel_id", key.channelId),
+		zap.String("model", key.model),
+		zap.String("from", from),
+		zap.String("to", state))
+}
+
+// transition moves the circuit of key to state and shares it with the other nodes.
+func transition(key circuitKey, state string, now time.Time) {
+	circuitLock.Lock()
+	c := circuits[key]
+	if c == nil {
+		c = &circuit{state: CircuitClosed}
+		circuits[key] = c
+	}
+	if c.state == state {
+		circuitLock.Unlock()
+		return
+	}
+	setState(key, c, state, now)
+	breaker := c.snapshot(key)
+	circuitLock.Unlock()
+	if common.IsRedisEnabled() {
+		go publishCircuit(breaker)
+	}
+}
+
+// consumeOutcome records the outcome of a request and reports whether it opened the circuit.
+// Outcomes of open or half-open circuits come from requests started before the circuit
+// opened and are ignored; only probes move them.
+func consumeOutcome(key circuitKey, success bool, now time.Time) bool {
+	circuitLock.Lock()
+	c := circuits[key]
+	if c == nil {
+		c = &circuit{state: CircuitClosed, changedAt: now}
+		circuits[key] = c
+	}
+	if c.state != CircuitClosed {
+		circuitLock.Unlock()
+		return false
+	}
+	c.outcomes = append(c.outcomes, success)
+	if len(c.outcomes) > config.MetricQueueSize {
+		c.outcomes = c.outcomes[len(c.outcomes)-config.MetricQueueSize:]
+	}
+	if success || len(c.outcomes) < config.MetricQueueSize || c.successRate() >= config.MetricSuccessRateThreshold {
+		circuitLock.Unlock()
+		return false
+	}
+	logger.Logger.Warn("opening channel circuit breaker due to low success rate",
+		zap.Int("channel_id", key.channelId),
+		zap.String("model", key.model),
+		zap.Float64("success_rate", c.successRate()*100),
+		zap.Int("window", config.MetricQueueSize))
+	setState(key, c, CircuitOpen, now)
+	breaker := c.snapshot(key)
+	circuitLock.Unlock()
+	if common.IsRedisEnabled() {
+		go publishCircuit(breaker)
+	}
+	return true
 }
 
 func metricSuccessConsumer() {
-	for {
-		select {
-		case channelId := <-metricSuccessChan:
-			consumeSuccess(channelId)
-		}
+	for event := range metricSuccessChan {
+		consumeOutcome(event.key, true, time.Now())
 	}
 }
 
 func metricFailConsumer() {
-	for {
-		select {
-		case channelId := <-metricFailChan:
-			disable, successRate := consumeFail(channelId)
-			if disable {
-				go MetricDisableChannel(channelId, successRate)
-			}
-		}
+	for event := range metricFailChan {
+		consumeOutcome(event.key, false, time.Now())
 	}
 }
 
@@ -65,15 +188,126 @@ func init() {
 	}
 }
 
-func Emit(channelId int, success bool) {
-	if !config.EnableMetric {
+// Emit records the outcome of a request relayed to the channel for the model. Outcomes
+// without a model are not tied to any circuit and are ignored.
+func Emit(channelId int, modelName string, success bool) {
+	if !config.EnableMetric || modelName == "" {
 		return
 	}
+	event := outcome{key: circuitKey{channelId: channelId, model: modelName}, success: success}
 	go func() {
 		if success {
-			metricSuccessChan <- channelId
+			metricSuccessChan <- event
 		} else {
-			metricFailChan <- channelId
+			metricFailChan <- event
+		}
+	}()
+}
+
+// CircuitAvailable reports whether the circuit of the channel for the model lets requests
+// through, i.e. it is closed.
+func CircuitAvailable(channelId int, modelName string) bool {
+	circuitLock.RLock()
+	defer circuitLock.RUnlock()
+	c := circuits[circuitKey{channelId: channelId, model: modelName}]
+	return c == nil || c.state == CircuitClosed
+}
+
+// ListCircuitBreakers returns the circuits that saw traffic, by channel and model. A
+// channelId of 0 lists all channels.
+func ListCircuitBreakers(channelId int) []CircuitBreaker {
+	circuitLock.RLock()
+	breakers := make([]CircuitBreaker, 0, len(circuits))
+	for key, c := range circuits {
+		if channelId == 0 || key.channelId == channelId {
+			breakers = append(breakers, c.snapshot(key))
+		}
+	}
+	circuitLock.RUnlock()
+	sort.Slice(breakers, func(i, j int) bool {
+		if breakers[i].ChannelId != breakers[j].ChannelId {
+			return breakers[i].ChannelId < breakers[j].ChannelId
+		}
+		return breakers[i].Model < breakers[j].Model
+	})
+	return breakers
+}
+
+// ResetCircuitBreakers closes the circuits of the channel, for modelName only when it is set,
+// and returns how many were not closed.
+func ResetCircuitBreakers(channelId int, modelName string) int {
+	var keys []circuitKey
+	circuitLock.RLock()
+	for key, c := range circuits {
+		if key.channelId == channelId && (modelName == "" || key.model == modelName) && c.state != CircuitClosed {
+			keys = append(keys, key)
+		}
+	}
+	circuitLock.RUnlock()
+	now := time.Now()
+	for _, key := range keys {
+		transition(key, CircuitClosed, now)
+	}
+	return len(keys)
+}
+
+// dueCircuits returns the open circuits whose cooldown is over.
+func dueCircuits(now time.Time) []circuitKey {
+	circuitLock.RLock()
+	defer circuitLock.RUnlock()
+	var keys []circuitKey
+	for key, c := range circuits {
+		if c.state == CircuitOpen && !now.Before(c.retryAt) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// probeCircuit sends the trial probes of a circuit whose cooldown is over and closes or
+// reopens it. Without a prober the circuit closes once its cooldown is over.
+func probeCircuit(ctx context.Context, key circuitKey) {
+	lg := logger.Logger.With(zap.Int("channel_id", key.channelId), zap.String("model", key.model))
+	if prober == nil {
+		transition(key, CircuitClosed, time.Now())
+		return
+	}
+	if !claimProbe(ctx, key) {
+		return
+	}
+	defer releaseProbe(key)
+	transition(key, CircuitHalfOpen, time.Now())
+	for i := 0; i < max(config.CircuitBreakerProbes, 1); i++ {
+		probeCtx, cancel := context.WithTimeout(ctx, circuitProbeTimeout)
+		err := prober(probeCtx, key.channelId, key.model)
+		cancel()
+		if err != nil {
+			lg.Info("circuit breaker probe failed, reopening", zap.Int("probe", i+1), zap.Error(err))
+			transition(key, CircuitOpen, time.Now())
+			return
+		}
+	}
+	transition(key, CircuitClosed, time.Now())
+}
+
+// StartCircuitBreaker makes channel selection skip open circuits, and probes and syncs the
+// circuits until ctx is done. probe sends the trial requests of half-open circuits.
+func StartCircuitBreaker(ctx context.Context, probe Prober) {
+	prober = probe
+	model.SetChannelAvailabilityCheck(CircuitAvailable)
+	go func() {
+		ticker := time.NewTicker(circuitTickInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			syncCircuits(ctx)
+			for _, key := range dueCircuits(time.Now()) {
+				go probeCircuit(ctx, key)
+			}
 		}
 	}()
 }
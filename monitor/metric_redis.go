@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// With Redis the circuits that are not closed are shared across nodes through a hash, so a
+// channel that one node opened for a model is skipped by all of them, and a single node
+// probes it. Success rates stay local to each node.
+const (
+	circuitRedisKey       = "circuit_breakers"
+	circuitProbeKeyPrefix = "circuit_breaker_probe:"
+
+	circuitTickInterval = 5 * time.Second
+	circuitProbeTimeout = 30 * time.Second
+)
+
+func circuitField(key circuitKey) string {
+	return fmt.Sprintf("%d:%s", key.channelId, key.model)
+}
+
+// probeDeadline is how long the probes of a half-open circuit may take before another node
+// takes over.
+func probeDeadline() time.Duration {
+	return time.Duration(max(config.CircuitBreakerProbes, 1))*circuitProbeTimeout + circuitTickInterval
+}
+
+// publishCircuit shares the state of a circuit with the other nodes through Redis.
+func publishCircuit(breaker CircuitBreaker) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	field := circuitField(circuitKey{channelId: breaker.ChannelId, model: breaker.Model})
+	var err error
+	if breaker.State == CircuitClosed {
+		err = common.RDB.HDel(ctx, circuitRedisKey, field).Err()
+	} else {
+		var value []byte
+		if value, err = json.Marshal(breaker); err == nil {
+			err = common.RDB.HSet(ctx, circuitRedisKey, field, value).Err()
+		}
+	}
+	if err != nil {
+		logger.Logger.Warn("failed to publish circuit breaker state",
+			zap.String("circuit", field), zap.Error(errors.WithStack(err)))
+	}
+}
+
+// syncCircuits adopts the circuit states published by the other nodes.
+func syncCircuits(ctx context.Context) {
+	if !common.IsRedisEnabled() {
+		return
+	}
+	fields, err := common.RDB.HGetAll(ctx, circuitRedisKey).Result()
+	if err != nil {
+		logger.Logger.Warn("failed to sync circuit breaker states", zap.Error(errors.WithStack(err)))
+		return
+	}
+	remote := make(map[circuitKey]CircuitBreaker, len(fields))
+	for field, value := range fields {
+		var breaker CircuitBreaker
+		if err := json.Unmarshal([]byte(value), &breaker); err != nil {
+			logger.Logger.Warn("invalid circuit breaker state in redis", zap.String("circuit", field), zap.Error(err))
+			continue
+		}
+		remote[circuitKey{channelId: breaker.ChannelId, model: breaker.Model}] = breaker
+	}
+	applyRemoteCircuits(remote, time.Now())
+}
+
+// applyRemoteCircuits merges the shared circuit states into the local ones. A circuit missing
+// from the shared states has been closed by another node, unless it changed so recently here
+// that its own state may not be published yet.
+func applyRemoteCircuits(remote map[circuitKey]CircuitBreaker, now time.Time) {
+	circuitLock.Lock()
+	defer circuitLock.Unlock()
+	for key, breaker := range remote {
+		c := circuits[key]
+		if c == nil {
+			c = &circuit{state: CircuitClosed}
+			circuits[key] = c
+		}
+		changedAt := time.Unix(breaker.ChangedAt, 0)
+		state := breaker.State
+		// the node probing this circuit went away: probe it again
+		if state == CircuitHalfOpen && now.Sub(changedAt) > probeDeadline() {
+			state = CircuitOpen
+		}
+		if state == c.state || changedAt.Before(c.changedAt.Truncate(time.Second)) {
+			continue
+		}
+		setState(key, c, state, changedAt)
+		if state == CircuitOpen {
+			c.retryAt = time.Unix(breaker.RetryAt, 0)
+			if breaker.State == CircuitHalfOpen {
+				c.retryAt = now
+			}
+		}
+	}
+	for key, c := range circuits {
+		if _, shared := remote[key]; !shared && c.state != CircuitClosed && now.Sub(c.changedAt) > circuitTickInterval {
+			setState(key, c, CircuitClosed, now)
+		}
+	}
+}
+
+// claimProbe makes sure a single node probes a circuit.
+func claimProbe(ctx context.Context, key circuitKey) bool {
+	if !common.IsRedisEnabled() {
+		return true
+	}
+	claimed, err := common.RDB.SetNX(ctx, circuitProbeKeyPrefix+circuitField(key), 1, probeDeadline()).Result()
+	if err != nil {
+		logger.Logger.Warn("failed to claim circuit breaker probe",
+			zap.String("circuit", circuitField(key)), zap.Error(errors.WithStack(err)))
+		return false
+	}
+	return claimed
+}
+
+// releaseProbe lets the next cooldown of the circuit be probed by any node.
+func releaseProbe(key circuitKey) {
+	if !common.IsRedisEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := common.RDB.Del(ctx, circuitProbeKeyPrefix+circuitField(key)).Err(); err != nil {
+		logger.Logger.Warn("failed to release circuit breaker probe",
+			zap.String("circuit", circuitField(key)), zap.Error(errors.WithStack(err)))
+	}
+}
@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+func resetCircuits(t *testing.T) {
+	t.Helper()
+	redisEnabled := common.IsRedisEnabled()
+	queueSize, threshold, probes := config.MetricQueueSize, config.MetricSuccessRateThreshold, config.CircuitBreakerProbes
+	common.SetRedisEnabled(false)
+	config.MetricQueueSize, config.MetricSuccessRateThreshold, config.CircuitBreakerProbes = 4, 0.5, 2
+	circuits = make(map[circuitKey]*circuit)
+	t.Cleanup(func() {
+		common.SetRedisEnabled(redisEnabled)
+		config.MetricQueueSize, config.MetricSuccessRateThreshold, config.CircuitBreakerProbes = queueSize, threshold, probes
+		circuits = make(map[circuitKey]*circuit)
+		prober = nil
+	})
+}
+
+func TestCircuitOpensPerModel(t *testing.T) {
+	resetCircuits(t)
+	now := time.Now()
+	broken := circuitKey{channelId: 1, model: "gpt-4o"}
+	healthy := circuitKey{channelId: 1, model: "gpt-4o-mini"}
+
+	// the window is not full yet
+	for range 3 {
+		require.False(t, consumeOutcome(broken, false, now))
+	}
+	require.True(t, CircuitAvailable(1, "gpt-4o"))
+	require.True(t, consumeOutcome(broken, false, now))
+	require.False(t, CircuitAvailable(1, "gpt-4o"))
+
+	// the channel keeps serving its other models
+	for range 4 {
+		require.False(t, consumeOutcome(healthy, true, now))
+	}
+	require.True(t, CircuitAvailable(1, "gpt-4o-mini"))
+
+	// late outcomes of requests started before the circuit opened do not move it
+	require.False(t, consumeOutcome(broken, true, now))
+	require.False(t, CircuitAvailable(1, "gpt-4o"))
+
+	breakers := ListCircuitBreakers(1)
+	require.Len(t, breakers, 2)
+	require.Equal(t, CircuitOpen, breakers[0].State)
+	require.Equal(t, CircuitClosed, breakers[1].State)
+}
+
+func TestProbeCircuit(t *testing.T) {
+	resetCircuits(t)
+	key := circuitKey{channelId: 2, model: "claude-sonnet-4"}
+	for range 4 {
+		consumeOutcome(key, false, time.Now().Add(-time.Hour))
+	}
+	require.Empty(t, dueCircuits(time.Now().Add(-time.Hour)))
+	require.Equal(t, []circuitKey{key}, dueCircuits(time.Now()))
+
+	var probes int
+	prober = func(ctx context.Context, channelId int, modelName string) error {
+		probes++
+		require.Equal(t, CircuitHalfOpen, circuits[key].state)
+		if probes == 2 {
+			return errors.New("upstream still failing")
+		}
+		return nil
+	}
+	probeCircuit(context.Background(), key)
+	require.Equal(t, 2, probes)
+	require.False(t, CircuitAvailable(2, "claude-sonnet-4"), "a failed probe reopens the circuit")
+	require.Empty(t, dueCircuits(time.Now()))
+
+	prober = func(ctx context.Context, channelId int, modelName string) error { return nil }
+	probeCircuit(context.Background(), key)
+	require.True(t, CircuitAvailable(2, "claude-sonnet-4"))
+}
+
+func TestResetCircuitBreakers(t *testing.T) {
+	resetCircuits(t)
+	for _, model := range []string{"a", "b"} {
+		for range 4 {
+			consumeOutcome(circuitKey{channelId: 3, model: model}, false, time.Now())
+		}
+	}
+	require.Equal(t, 1, ResetCircuitBreakers(3, "a"))
+	require.True(t, CircuitAvailable(3, "a"))
+	require.False(t, CircuitAvailable(3, "b"))
+	require.Equal(t, 1, ResetCircuitBreakers(3, ""))
+	require.True(t, CircuitAvailable(3, "b"))
+}
+
+func TestApplyRemoteCircuits(t *testing.T) {
+	resetCircuits(t)
+	now := time.Now()
+	key := circuitKey{channelId: 4, model: "gemini-2.5-pro"}
+
+	// opened by another node
+	applyRemoteCircuits(map[circuitKey]CircuitBreaker{key: {
+		ChannelId: 4, Model: "gemini-2.5-pro", State: CircuitOpen,
+		ChangedAt: now.Unix(), RetryAt: now.Add(time.Minute).Unix(),
+	}}, now)
+	require.False(t, CircuitAvailable(4, "gemini-2.5-pro"))
+	require.Empty(t, dueCircuits(now))
+
+	// the node probing it went away
+	stale := now.Add(-2 * probeDeadline())
+	circuits[key].state, circuits[key].changedAt = CircuitHalfOpen, stale
+	applyRemoteCircuits(map[circuitKey]CircuitBreaker{key: {
+		ChannelId: 4, Model: "gemini-2.5-pro", State: CircuitHalfOpen, ChangedAt: stale.Unix(),
+	}}, now)
+	require.Equal(t, []circuitKey{key}, dueCircuits(now))
+
+	// closed by another node
+	applyRemoteCircuits(nil, now.Add(time.Minute))
+	require.True(t, CircuitAvailable(4, "gemini-2.5-pro"))
+}
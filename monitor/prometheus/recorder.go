@@ -6,6 +6,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
 
 	"github.com/songquanpeng/one-api/common/metrics"
 )
@@ -191,6 +192,39 @@ var (
 		Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
 	}, []string{"model_name", "channel_type"})
 
+	// Response cache metrics
+	responseCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_response_cache_requests_total",
+		Help: "Total number of cacheable relay requests by lookup result (hit, miss, store)",
+	}, []string{"relay_mode", "result"})
+
+	// Prompt-cache affinity metrics
+	promptCacheAffinityRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_prompt_cache_affinity_requests_total",
+		Help: "Total number of billed requests with a prompt-cache affinity key by routing result (hit, miss)",
+	}, []string{"source", "result"})
+
+	promptCacheAffinityPromptTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_prompt_cache_affinity_prompt_tokens_total",
+		Help: "Prompt tokens of requests with a prompt-cache affinity key by routing result",
+	}, []string{"source", "result"})
+
+	promptCacheAffinityCachedTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_prompt_cache_affinity_cached_prompt_tokens_total",
+		Help: "Cached prompt tokens of requests with a prompt-cache affinity key by routing result",
+	}, []string{"source", "result"})
+
+	// Circuit breaker metrics
+	circuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "one_api_circuit_breaker_state",
+		Help: "Circuit breaker state of a channel for a model (0=closed, 1=half_open, 2=open)",
+	}, []string{"channel_id", "model"})
+
+	circuitBreakerTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "one_api_circuit_breaker_transitions_total",
+		Help: "Total number of circuit breaker state transitions of a channel for a model",
+	}, []string{"channel_id", "model", "from", "to"})
+
 	// Billing metrics
 	billingOperationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "one_api_billing_operation_duration_seconds",
@@ -281,6 +315,20 @@ func (p *PrometheusRecorder) UpdateChannelRequestsInFlight(channelId int, channe
 	channelRequestsInFlight.WithLabelValues(channelIdStr, channelName, channelType).Add(delta)
 }
 
+// GetChannelRequestsInFlight returns the number of requests currently being processed
+func (p *PrometheusRecorder) GetChannelRequestsInFlight(channelId int, channelName, channelType string) float64 {
+	channelIdStr := strconv.Itoa(channelId)
+	gauge, err := channelRequestsInFlight.GetMetricWithLabelValues(channelIdStr, channelName, channelType)
+	if err != nil {
+		return 0
+	}
+	metric := &dto.Metric{}
+	if err = gauge.Write(metric); err != nil {
+		return 0
+	}
+	return metric.GetGauge().GetValue()
+}
+
 // RecordUserMetrics records user-related metrics
 func (p *PrometheusRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 	userRequestsTotal.WithLabelValues(userId, username, group).Inc()
@@ -357,6 +405,33 @@ func (p *PrometheusRecorder) RecordModelUsage(modelName, channelType string, lat
 	modelLatency.WithLabelValues(modelName, channelType).Observe(latency.Seconds())
 }
 
+// RecordResponseCache records a response cache lookup or store
+func (p *PrometheusRecorder) RecordResponseCache(relayMode, result string) {
+	responseCacheRequests.WithLabelValues(relayMode, result).Inc()
+}
+
+// RecordPromptCacheAffinity records how a request with an affinity key was routed along with
+// its prompt and cached prompt tokens, so cache hit rates can be compared per routing result
+func (p *PrometheusRecorder) RecordPromptCacheAffinity(source, result string, promptTokens, cachedPromptTokens int) {
+	promptCacheAffinityRequests.WithLabelValues(source, result).Inc()
+	promptCacheAffinityPromptTokens.WithLabelValues(source, result).Add(float64(promptTokens))
+	promptCacheAffinityCachedTokens.WithLabelValues(source, result).Add(float64(cachedPromptTokens))
+}
+
+// RecordCircuitBreakerTransition records a circuit breaker state change of a channel for a model
+func (p *PrometheusRecorder) RecordCircuitBreakerTransition(channelId int, model, from, to string) {
+	channelIdStr := strconv.Itoa(channelId)
+	var stateValue float64
+	switch to {
+	case "half_open":
+		stateValue = 1
+	case "open":
+		stateValue = 2
+	}
+	circuitBreakerState.WithLabelValues(channelIdStr, model).Set(stateValue)
+	circuitBreakerTransitions.WithLabelValues(channelIdStr, model, from, to).Inc()
+}
+
 // RecordBillingOperation records billing operation metrics
 func (p *PrometheusRecorder) RecordBillingOperation(startTime time.Time, operation string, success bool, userId int, channelId int, modelName string, quotaAmount float64) {
 	duration := time.Since(startTime).Seconds()
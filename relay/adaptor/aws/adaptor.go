@@ -19,6 +19,7 @@ import (
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
 	anthropicAdaptor "github.com/songquanpeng/one-api/relay/adaptor/anthropic"
+	cohere "github.com/songquanpeng/one-api/relay/adaptor/aws/cohere"
 	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -27,12 +28,15 @@ import (
 )
 
 var _ adaptor.Adaptor = new(Adaptor)
+var _ adaptor.RerankAdaptor = new(Adaptor)
 
 type Adaptor struct {
 	awsAdapter utils.AwsAdapter
 	Config     aws.Config
 	Meta       *meta.Meta
 	AwsClient  *bedrockruntime.Client
+
+	rerankRequest *model.RerankRequest
 }
 
 func (a *Adaptor) Init(meta *meta.Meta) {
@@ -171,11 +175,32 @@ func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequ
 	return request, nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor. Bedrock serves Cohere rerank
+// models through InvokeModel, which DoRerankResponse calls.
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if !cohere.IsRerankModel(request.Model) {
+		return nil, errors.Errorf("model '%s' does not support rerank", request.Model)
+	}
+	a.rerankRequest = request
+	return request, nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor.
+func (a *Adaptor) DoRerankResponse(c *gin.Context, _ *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	if a.rerankRequest == nil {
+		return nil, utils.WrapErr(errors.New("rerank request not converted"))
+	}
+	return cohere.Rerank(c, a.AwsClient, a.rerankRequest)
+}
+
 func (a *Adaptor) DoRequest(c *gin.Context, meta *meta.Meta, requestBody io.Reader) (*http.Response, error) {
 	// AWS Bedrock doesn't use HTTP requests - it uses the AWS SDK directly
 	// For Claude Messages API, we should return nil to indicate DoResponse should handle everything
 	// But we need to ensure the controller doesn't try to access a nil response
-	if a.awsAdapter == nil {
+	if a.awsAdapter == nil && a.rerankRequest == nil {
 		return nil, errors.New("AWS sub-adapter not initialized")
 	}
 
@@ -259,6 +284,7 @@ func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
 		// Cohere Models (Supported) - Note: These are per 1K tokens, converted to 1M tokens using ratio.MilliTokensUsd
 		"command-r":      {Ratio: 0.5 * ratio.MilliTokensUsd, CompletionRatio: 3}, // $0.5/$2 per 1M tokens
 		"command-r-plus": {Ratio: 3 * ratio.MilliTokensUsd, CompletionRatio: 5},   // $3/$5 per 1M tokens
+		"rerank-v3.5":    {SearchUnitPriceUsd: 0.002},                             // $2 per 1K queries
 
 		// Qwen Models (Supported) - Note: These are per 1K tokens, converted to 1M tokens using MilliTokensUsd
 		"qwen3-235b":       {Ratio: 0.22 * ratio.MilliTokensUsd, CompletionRatio: 4},    // $0.00022/$0.00088 per 1K tokens = $0.22/$0.88 per 1M tokens
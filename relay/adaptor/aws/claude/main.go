@@ -303,3 +303,47 @@ func StreamHandler(c *gin.Context, awsCli *bedrockruntime.Client) (*relaymodel.E
 
 	return nil, &usage
 }
+
+// CountTokens counts the input tokens of a Claude Messages payload with Bedrock's native
+// CountTokens API. body is the client's count_tokens request; it is rewritten into the
+// InvokeModel shape Bedrock expects for Claude models.
+func CountTokens(c *gin.Context, awsCli *bedrockruntime.Client, modelName string, body []byte) (int, error) {
+	if awsCli == nil {
+		return 0, errors.New("aws client is not initialized")
+	}
+
+	awsModelID, err := AwsModelID(modelName)
+	if err != nil {
+		return 0, errors.Wrap(err, "AwsModelID")
+	}
+
+	var payload map[string]any
+	if err = json.Unmarshal(body, &payload); err != nil {
+		return 0, errors.Wrap(err, "unmarshal count tokens request")
+	}
+	delete(payload, "model")
+	delete(payload, "stream")
+	payload["anthropic_version"] = "bedrock-2023-05-31"
+	if _, ok := payload["max_tokens"]; !ok {
+		payload["max_tokens"] = config.DefaultMaxToken
+	}
+	invokeBody, err := json.Marshal(payload)
+	if err != nil {
+		return 0, errors.Wrap(err, "marshal count tokens request")
+	}
+
+	result, err := awsCli.CountTokens(gmw.Ctx(c), &bedrockruntime.CountTokensInput{
+		ModelId: aws.String(awsModelID),
+		Input: &types.CountTokensInputMemberInvokeModel{
+			Value: types.InvokeModelTokensRequest{Body: invokeBody},
+		},
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "CountTokens")
+	}
+	if result.InputTokens == nil {
+		return 0, errors.New("CountTokens returned nil input tokens")
+	}
+
+	return int(*result.InputTokens), nil
+}
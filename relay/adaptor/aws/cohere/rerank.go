@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/aws/utils"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankModelIDMap maps Cohere rerank models to their AWS Bedrock model ids.
+//
+//   - https://docs.aws.amazon.com/bedrock/latest/userguide/model-parameters-cohere-rerank.html
+var RerankModelIDMap = map[string]string{
+	"rerank-v3.5": "cohere.rerank-v3-5:0",
+}
+
+// IsRerankModel reports whether the model is a Cohere rerank model served by Bedrock.
+func IsRerankModel(model string) bool {
+	_, ok := RerankModelIDMap[model]
+	return ok
+}
+
+// RerankRequest is the InvokeModel body of Cohere rerank models on Bedrock.
+type RerankRequest struct {
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            *int     `json:"top_n,omitempty"`
+	MaxTokensPerDoc *int     `json:"max_tokens_per_doc,omitempty"`
+	APIVersion      int      `json:"api_version"`
+}
+
+// Rerank ranks the documents of request with InvokeModel and returns the normalized response.
+func Rerank(c *gin.Context, awsCli *bedrockruntime.Client, request *relaymodel.RerankRequest) (*relaymodel.RerankResponse, *relaymodel.ErrorWithStatusCode) {
+	awsModelID, ok := RerankModelIDMap[request.Model]
+	if !ok {
+		return nil, utils.WrapErr(errors.Errorf("model %s not found", request.Model))
+	}
+
+	body, err := json.Marshal(RerankRequest{
+		Query:           request.Query,
+		Documents:       request.DocumentTexts(),
+		TopN:            request.TopN,
+		MaxTokensPerDoc: request.MaxTokensPerDoc,
+		APIVersion:      2,
+	})
+	if err != nil {
+		return nil, utils.WrapErr(errors.Wrap(err, "marshal request"))
+	}
+
+	startTime := time.Now()
+	awsResp, err := awsCli.InvokeModel(gmw.Ctx(c), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(awsModelID),
+		ContentType: aws.String("application/json"),
+		Accept:      aws.String("application/json"),
+		Body:        body,
+	})
+	utils.UpdateRegionHealthMetrics(awsCli.Options().Region, err == nil, time.Since(startTime), err)
+	if err != nil {
+		return nil, utils.WrapErr(errors.Wrap(err, "InvokeModel"))
+	}
+
+	response, err := openai_compatible.ParseRerankResponse(awsResp.Body)
+	if err != nil {
+		return nil, utils.WrapErr(err)
+	}
+	return response, nil
+}
@@ -52,6 +52,9 @@ func init() {
 	for model := range cohere.AwsModelIDMap {
 		adaptors[model] = AwsCohere
 	}
+	for model := range cohere.RerankModelIDMap {
+		adaptors[model] = AwsCohere
+	}
 	for model := range openai.AwsModelIDMap {
 		adaptors[model] = AwsOpenAI
 	}
@@ -12,8 +12,10 @@ import (
 
 	"github.com/songquanpeng/one-api/common/ctxkey"
 	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
 	"github.com/songquanpeng/one-api/relay/meta"
 	"github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type Adaptor struct {
@@ -31,6 +33,9 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
+	if meta.Mode == relaymode.Rerank {
+		return fmt.Sprintf("%s/v2/rerank", meta.BaseURL), nil
+	}
 	return fmt.Sprintf("%s/v1/chat", meta.BaseURL), nil
 }
 
@@ -47,6 +52,19 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return ConvertRequest(*request), nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor.
+func (a *Adaptor) ConvertRerankRequest(_ *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return ConvertRerankRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor.
+func (a *Adaptor) DoRerankResponse(_ *gin.Context, resp *http.Response, _ *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	return openai_compatible.RerankHandler(resp)
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
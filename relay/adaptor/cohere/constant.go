@@ -27,4 +27,9 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"command-light-nightly-internet": {Ratio: 0.3 * ratio.MilliTokensUsd, CompletionRatio: 2}, // $0.3/$0.6 per 1M tokens
 	"command-r-internet":             {Ratio: 0.5 * ratio.MilliTokensUsd, CompletionRatio: 3}, // $0.5/$1.5 per 1M tokens
 	"command-r-plus-internet":        {Ratio: 3 * ratio.MilliTokensUsd, CompletionRatio: 5},   // $3/$15 per 1M tokens
+
+	// Rerank Models - billed per search unit (one query over up to 100 documents)
+	"rerank-v3.5":              {SearchUnitPriceUsd: 0.002}, // $2 per 1K searches
+	"rerank-english-v3.0":      {SearchUnitPriceUsd: 0.002}, // $2 per 1K searches
+	"rerank-multilingual-v3.0": {SearchUnitPriceUsd: 0.002}, // $2 per 1K searches
 }
@@ -0,0 +1,28 @@
+package cohere
+
+import (
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the Cohere v2 rerank payload.
+//
+//   - https://docs.cohere.com/reference/rerank
+type RerankRequest struct {
+	Model           string   `json:"model"`
+	Query           string   `json:"query"`
+	Documents       []string `json:"documents"`
+	TopN            *int     `json:"top_n,omitempty"`
+	MaxTokensPerDoc *int     `json:"max_tokens_per_doc,omitempty"`
+}
+
+// ConvertRerankRequest converts a normalized rerank request. Cohere v2 only accepts plain
+// text documents and never echoes them back.
+func ConvertRerankRequest(request *model.RerankRequest) *RerankRequest {
+	return &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.DocumentTexts(),
+		TopN:            request.TopN,
+		MaxTokensPerDoc: request.MaxTokensPerDoc,
+	}
+}
@@ -35,14 +35,7 @@ func (a *Adaptor) Init(meta *meta.Meta) {
 }
 
 func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
-	defaultVersion := config.GeminiVersion
-	if strings.Contains(meta.ActualModelName, "gemini-2") ||
-		strings.Contains(meta.ActualModelName, "gemini-1.5") ||
-		strings.Contains(meta.ActualModelName, "gemma-3") {
-		defaultVersion = "v1beta"
-	}
-
-	version := helper.AssignOrDefault(meta.Config.APIVersion, defaultVersion)
+	version := apiVersion(meta)
 	action := ""
 	switch meta.Mode {
 	case relaymode.Embeddings:
@@ -58,6 +51,22 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	return fmt.Sprintf("%s/%s/models/%s:%s", meta.BaseURL, version, meta.ActualModelName, action), nil
 }
 
+// GetCountTokensURL returns the countTokens endpoint of the requested model.
+func (a *Adaptor) GetCountTokensURL(meta *meta.Meta) string {
+	return fmt.Sprintf("%s/%s/models/%s:countTokens", meta.BaseURL, apiVersion(meta), meta.ActualModelName)
+}
+
+func apiVersion(meta *meta.Meta) string {
+	defaultVersion := config.GeminiVersion
+	if strings.Contains(meta.ActualModelName, "gemini-2") ||
+		strings.Contains(meta.ActualModelName, "gemini-1.5") ||
+		strings.Contains(meta.ActualModelName, "gemma-3") {
+		defaultVersion = "v1beta"
+	}
+
+	return helper.AssignOrDefault(meta.Config.APIVersion, defaultVersion)
+}
+
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Request, meta *meta.Meta) error {
 	channelhelper.SetupCommonRequestHeader(c, req, meta)
 	req.Header.Set("x-goog-api-key", meta.APIKey)
@@ -0,0 +1,441 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// GenerateContentRequest is the body of a native generateContent / streamGenerateContent
+// request received from Gemini API clients.
+//
+//   - https://ai.google.dev/api/generate-content#request-body
+type GenerateContentRequest struct {
+	Contents          []ChatContent         `json:"contents"`
+	SystemInstruction *ChatContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *ChatGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GenerateContentTool `json:"tools,omitempty"`
+	ToolConfig        *ToolConfig           `json:"toolConfig,omitempty"`
+	SafetySettings    []ChatSafetySettings  `json:"safetySettings,omitempty"`
+	CachedContent     string                `json:"cachedContent,omitempty"`
+}
+
+// GenerateContentTool is a tool declared in a native request. Only function declarations
+// can be translated for non-Gemini channels; built-in tools such as googleSearch are
+// honored by Gemini channels only.
+type GenerateContentTool struct {
+	FunctionDeclarations []FunctionDeclaration `json:"functionDeclarations,omitempty"`
+}
+
+type FunctionDeclaration struct {
+	Name                 string `json:"name"`
+	Description          string `json:"description,omitempty"`
+	Parameters           any    `json:"parameters,omitempty"`
+	ParametersJsonSchema any    `json:"parametersJsonSchema,omitempty"`
+}
+
+// CountTokensRequest is the body of a native countTokens request. Clients send either the
+// contents alone or a complete generateContent request.
+//
+//   - https://ai.google.dev/api/tokens#request-body
+type CountTokensRequest struct {
+	Contents               []ChatContent           `json:"contents,omitempty"`
+	GenerateContentRequest *GenerateContentRequest `json:"generateContentRequest,omitempty"`
+}
+
+// CountTokensResponse is the body returned by countTokens.
+type CountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
+// snakeCaseFields maps the snake_case spellings of request fields, which the Gemini REST API
+// accepts as well, to the camelCase names used by the request structs.
+var snakeCaseFields = map[string]string{
+	"system_instruction":       "systemInstruction",
+	"generation_config":        "generationConfig",
+	"safety_settings":          "safetySettings",
+	"tool_config":              "toolConfig",
+	"cached_content":           "cachedContent",
+	"function_calling_config":  "functionCallingConfig",
+	"allowed_function_names":   "allowedFunctionNames",
+	"function_declarations":    "functionDeclarations",
+	"parameters_json_schema":   "parametersJsonSchema",
+	"inline_data":              "inlineData",
+	"file_data":                "fileData",
+	"mime_type":                "mimeType",
+	"file_uri":                 "fileUri",
+	"function_call":            "functionCall",
+	"function_response":        "functionResponse",
+	"max_output_tokens":        "maxOutputTokens",
+	"top_p":                    "topP",
+	"top_k":                    "topK",
+	"candidate_count":          "candidateCount",
+	"stop_sequences":           "stopSequences",
+	"response_mime_type":       "responseMimeType",
+	"response_schema":          "responseSchema",
+	"response_modalities":      "responseModalities",
+	"presence_penalty":         "presencePenalty",
+	"frequency_penalty":        "frequencyPenalty",
+	"thinking_config":          "thinkingConfig",
+	"include_thoughts":         "includeThoughts",
+	"thinking_budget":          "thinkingBudget",
+	"generate_content_request": "generateContentRequest",
+}
+
+// opaqueFields hold user data (schemas, function arguments and results) whose keys must
+// be kept verbatim.
+var opaqueFields = map[string]bool{
+	"parameters":           true,
+	"parametersJsonSchema": true,
+	"responseSchema":       true,
+	"args":                 true,
+	"response":             true,
+}
+
+// ParseGenerateContentRequest decodes a native request, accepting both camelCase and
+// snake_case field names.
+func ParseGenerateContentRequest(body []byte) (*GenerateContentRequest, error) {
+	request := &GenerateContentRequest{}
+	if err := unmarshalNormalized(body, request); err != nil {
+		return nil, errors.Wrap(err, "unmarshal generateContent request")
+	}
+	if len(request.Contents) == 0 {
+		return nil, errors.New("contents is required")
+	}
+	return request, nil
+}
+
+// ParseCountTokensRequest decodes a native countTokens request into the generateContent
+// request it counts.
+func ParseCountTokensRequest(body []byte) (*GenerateContentRequest, error) {
+	request := &CountTokensRequest{}
+	if err := unmarshalNormalized(body, request); err != nil {
+		return nil, errors.Wrap(err, "unmarshal countTokens request")
+	}
+	if request.GenerateContentRequest != nil {
+		return request.GenerateContentRequest, nil
+	}
+	if len(request.Contents) == 0 {
+		return nil, errors.New("contents or generateContentRequest is required")
+	}
+	return &GenerateContentRequest{Contents: request.Contents}, nil
+}
+
+func unmarshalNormalized(body []byte, v any) error {
+	var doc any
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+	normalized, err := json.Marshal(normalizeFieldNames(doc))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(normalized, v)
+}
+
+func normalizeFieldNames(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			if camel, ok := snakeCaseFields[key]; ok {
+				key = camel
+			}
+			if !opaqueFields[key] {
+				value = normalizeFieldNames(value)
+			}
+			out[key] = value
+		}
+		return out
+	case []any:
+		for i := range v {
+			v[i] = normalizeFieldNames(v[i])
+		}
+		return v
+	default:
+		return node
+	}
+}
+
+// ConvertGenerateContentRequest converts a native request into an OpenAI chat completion
+// request, so it can be served by channels that do not speak the Gemini API.
+func ConvertGenerateContentRequest(request *GenerateContentRequest, modelName string, stream bool) (*model.GeneralOpenAIRequest, error) {
+	openaiRequest := &model.GeneralOpenAIRequest{
+		Model:  modelName,
+		Stream: stream,
+	}
+	if stream {
+		openaiRequest.StreamOptions = &model.StreamOptions{IncludeUsage: true}
+	}
+
+	if request.SystemInstruction != nil {
+		if text := partsText(request.SystemInstruction.Parts); text != "" {
+			openaiRequest.Messages = append(openaiRequest.Messages, model.Message{Role: "system", Content: text})
+		}
+	}
+
+	// Gemini pairs function calls and responses by name and position; OpenAI needs ids
+	calls := newToolCallIds()
+	for i, content := range request.Contents {
+		messages, err := convertContent(content, calls)
+		if err != nil {
+			return nil, errors.Wrapf(err, "contents[%d]", i)
+		}
+		openaiRequest.Messages = append(openaiRequest.Messages, messages...)
+	}
+
+	if cfg := request.GenerationConfig; cfg != nil {
+		openaiRequest.Temperature = cfg.Temperature
+		openaiRequest.TopP = cfg.TopP
+		if cfg.TopK > 0 {
+			topK := int(cfg.TopK)
+			openaiRequest.TopK = &topK
+		}
+		openaiRequest.MaxTokens = cfg.MaxOutputTokens
+		if cfg.CandidateCount > 1 {
+			n := cfg.CandidateCount
+			openaiRequest.N = &n
+		}
+		if len(cfg.StopSequences) > 0 {
+			openaiRequest.Stop = cfg.StopSequences
+		}
+		if cfg.Seed != nil {
+			openaiRequest.Seed = float64(*cfg.Seed)
+		}
+		openaiRequest.PresencePenalty = cfg.PresencePenalty
+		openaiRequest.FrequencyPenalty = cfg.FrequencyPenalty
+		openaiRequest.ResponseFormat = convertResponseFormat(cfg)
+		if cfg.ThinkingConfig != nil && cfg.ThinkingConfig.ThinkingBudget != nil && *cfg.ThinkingConfig.ThinkingBudget > 0 {
+			effort := thinkingBudgetToEffort(*cfg.ThinkingConfig.ThinkingBudget)
+			openaiRequest.ReasoningEffort = &effort
+		}
+	}
+
+	for _, tool := range request.Tools {
+		for _, declaration := range tool.FunctionDeclarations {
+			parameters := declaration.ParametersJsonSchema
+			if parameters == nil {
+				parameters = lowercaseSchemaTypes(declaration.Parameters)
+			}
+			openaiRequest.Tools = append(openaiRequest.Tools, model.Tool{
+				Type: "function",
+				Function: &model.Function{
+					Name:        declaration.Name,
+					Description: declaration.Description,
+					Parameters:  parameters,
+				},
+			})
+		}
+	}
+	if request.ToolConfig != nil && len(openaiRequest.Tools) > 0 {
+		openaiRequest.ToolChoice = convertToolChoice(request.ToolConfig.FunctionCallingConfig)
+	}
+
+	return openaiRequest, nil
+}
+
+// toolCallIds hands out ids to function calls and matches function responses to the
+// oldest unanswered call of the same name.
+type toolCallIds struct {
+	next    int
+	pending map[string][]string
+}
+
+func newToolCallIds() *toolCallIds {
+	return &toolCallIds{pending: map[string][]string{}}
+}
+
+func (t *toolCallIds) call(name string) string {
+	t.next++
+	id := fmt.Sprintf("call_%d", t.next)
+	t.pending[name] = append(t.pending[name], id)
+	return id
+}
+
+func (t *toolCallIds) response(name string) string {
+	if ids := t.pending[name]; len(ids) > 0 {
+		t.pending[name] = ids[1:]
+		return ids[0]
+	}
+	return t.call(name)
+}
+
+func convertContent(content ChatContent, calls *toolCallIds) ([]model.Message, error) {
+	role := "user"
+	if content.Role == "model" {
+		role = "assistant"
+	}
+
+	var messages []model.Message
+	var items []model.MessageContent
+	var toolCalls []model.Tool
+	for _, part := range content.Parts {
+		switch {
+		case part.Thought:
+			// thought summaries are not replayed to other providers
+		case part.FunctionCall != nil:
+			args, err := json.Marshal(part.FunctionCall.Arguments)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshal function call args")
+			}
+			toolCalls = append(toolCalls, model.Tool{
+				Id:   calls.call(part.FunctionCall.FunctionName),
+				Type: "function",
+				Function: &model.Function{
+					Name:      part.FunctionCall.FunctionName,
+					Arguments: string(args),
+				},
+			})
+		case part.FunctionResponse != nil:
+			result, err := json.Marshal(part.FunctionResponse.Response)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshal function response")
+			}
+			messages = append(messages, model.Message{
+				Role:       "tool",
+				Content:    string(result),
+				ToolCallId: calls.response(part.FunctionResponse.Name),
+			})
+		case part.InlineData != nil:
+			item, err := convertMediaPart(part.InlineData.MimeType,
+				fmt.Sprintf("data:%s;base64,%s", part.InlineData.MimeType, part.InlineData.Data), part.InlineData.Data)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		case part.FileData != nil:
+			item, err := convertMediaPart(part.FileData.MimeType, part.FileData.FileUri, "")
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		case part.Text != "":
+			text := part.Text
+			items = append(items, model.MessageContent{Type: model.ContentTypeText, Text: &text})
+		}
+	}
+
+	if len(items) == 0 && len(toolCalls) == 0 {
+		return messages, nil
+	}
+	message := model.Message{Role: role, ToolCalls: toolCalls}
+	if allText(items) {
+		var builder strings.Builder
+		for _, item := range items {
+			builder.WriteString(*item.Text)
+		}
+		message.Content = builder.String()
+	} else {
+		message.Content = items
+	}
+	return append(messages, message), nil
+}
+
+// convertMediaPart maps inline or file data to an OpenAI content part. Only images and
+// base64 audio have an OpenAI chat equivalent.
+func convertMediaPart(mimeType string, url string, base64Data string) (model.MessageContent, error) {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return model.MessageContent{Type: model.ContentTypeImageURL, ImageURL: &model.ImageURL{Url: url}}, nil
+	case strings.HasPrefix(mimeType, "audio/") && base64Data != "":
+		return model.MessageContent{
+			Type:       model.ContentTypeInputAudio,
+			InputAudio: &model.InputAudio{Data: base64Data, Format: strings.TrimPrefix(mimeType, "audio/")},
+		}, nil
+	default:
+		return model.MessageContent{}, errors.Errorf("media type %q is only supported by Gemini channels", mimeType)
+	}
+}
+
+func allText(items []model.MessageContent) bool {
+	for _, item := range items {
+		if item.Type != model.ContentTypeText {
+			return false
+		}
+	}
+	return true
+}
+
+func partsText(parts []Part) string {
+	var builder strings.Builder
+	for _, part := range parts {
+		if part.Thought {
+			continue
+		}
+		builder.WriteString(part.Text)
+	}
+	return builder.String()
+}
+
+func convertResponseFormat(cfg *ChatGenerationConfig) *model.ResponseFormat {
+	if cfg.ResponseMimeType != "application/json" {
+		return nil
+	}
+	if schema, ok := lowercaseSchemaTypes(cfg.ResponseSchema).(map[string]any); ok {
+		return &model.ResponseFormat{
+			Type:       "json_schema",
+			JsonSchema: &model.JSONSchema{Name: "response", Schema: schema},
+		}
+	}
+	return &model.ResponseFormat{Type: "json_object"}
+}
+
+func convertToolChoice(cfg FunctionCallingConfig) any {
+	switch strings.ToUpper(cfg.Mode) {
+	case "NONE":
+		return "none"
+	case "ANY":
+		if len(cfg.AllowedFunctionNames) == 1 {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": cfg.AllowedFunctionNames[0]},
+			}
+		}
+		return "required"
+	default:
+		return "auto"
+	}
+}
+
+// thinkingBudgetToEffort buckets a Gemini thinking budget into an OpenAI reasoning effort.
+func thinkingBudgetToEffort(budget int) string {
+	switch {
+	case budget <= 1024:
+		return "low"
+	case budget <= 8192:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// lowercaseSchemaTypes converts the upper-case OpenAPI type names Gemini accepts
+// (OBJECT, STRING, ...) into the JSON Schema spelling other providers require.
+func lowercaseSchemaTypes(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if s, ok := value.(string); ok {
+					out[key] = strings.ToLower(s)
+					continue
+				}
+			}
+			out[key] = lowercaseSchemaTypes(value)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i := range v {
+			out[i] = lowercaseSchemaTypes(v[i])
+		}
+		return out
+	default:
+		return schema
+	}
+}
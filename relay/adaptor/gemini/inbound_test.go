@@ -0,0 +1,212 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestParseGenerateContentRequest_SnakeCase(t *testing.T) {
+	body := []byte(`{
+		"system_instruction": {"parts": [{"text": "be brief"}]},
+		"contents": [{"role": "user", "parts": [{"text": "hi"}]}],
+		"generation_config": {"max_output_tokens": 64, "top_p": 0.5, "stop_sequences": ["END"]},
+		"tools": [{"function_declarations": [{
+			"name": "lookup",
+			"parameters": {"type": "OBJECT", "properties": {"user_id": {"type": "STRING"}}}
+		}]}]
+	}`)
+
+	request, err := ParseGenerateContentRequest(body)
+	require.NoError(t, err)
+	require.NotNil(t, request.SystemInstruction)
+	require.Equal(t, "be brief", request.SystemInstruction.Parts[0].Text)
+	require.Equal(t, 64, request.GenerationConfig.MaxOutputTokens)
+	require.Equal(t, []string{"END"}, request.GenerationConfig.StopSequences)
+	require.Len(t, request.Tools, 1)
+
+	// schema property names are user data and must not be renamed
+	properties := request.Tools[0].FunctionDeclarations[0].Parameters.(map[string]any)["properties"].(map[string]any)
+	require.Contains(t, properties, "user_id")
+}
+
+func TestParseGenerateContentRequest_RequiresContents(t *testing.T) {
+	_, err := ParseGenerateContentRequest([]byte(`{"contents": []}`))
+	require.Error(t, err)
+}
+
+func TestParseCountTokensRequest_Wrapped(t *testing.T) {
+	request, err := ParseCountTokensRequest([]byte(`{"generate_content_request": {
+		"contents": [{"role": "user", "parts": [{"text": "count me"}]}]
+	}}`))
+	require.NoError(t, err)
+	require.Len(t, request.Contents, 1)
+	require.Equal(t, "count me", request.Contents[0].Parts[0].Text)
+}
+
+func TestConvertGenerateContentRequest(t *testing.T) {
+	budget := 4096
+	temperature := 0.2
+	request := &GenerateContentRequest{
+		SystemInstruction: &ChatContent{Parts: []Part{{Text: "system prompt"}}},
+		Contents: []ChatContent{
+			{Role: "user", Parts: []Part{{Text: "weather in "}, {Text: "Paris?"}}},
+			{Role: "model", Parts: []Part{
+				{Text: "thinking...", Thought: true},
+				{FunctionCall: &FunctionCall{FunctionName: "get_weather", Arguments: map[string]any{"city": "Paris"}}},
+			}},
+			{Role: "user", Parts: []Part{
+				{FunctionResponse: &FunctionResponse{Name: "get_weather", Response: map[string]any{"temp": 21}}},
+			}},
+		},
+		GenerationConfig: &ChatGenerationConfig{
+			Temperature:     &temperature,
+			MaxOutputTokens: 128,
+			ThinkingConfig:  &ThinkingConfig{ThinkingBudget: &budget},
+		},
+		Tools: []GenerateContentTool{{FunctionDeclarations: []FunctionDeclaration{{
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "OBJECT", "properties": map[string]any{"city": map[string]any{"type": "STRING"}}},
+		}}}},
+		ToolConfig: &ToolConfig{FunctionCallingConfig: FunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"get_weather"}}},
+	}
+
+	converted, err := ConvertGenerateContentRequest(request, "gpt-4o", true)
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o", converted.Model)
+	require.True(t, converted.Stream)
+	require.NotNil(t, converted.StreamOptions)
+	require.True(t, converted.StreamOptions.IncludeUsage)
+	require.Equal(t, 128, converted.MaxTokens)
+	require.Equal(t, "medium", *converted.ReasoningEffort)
+
+	require.Len(t, converted.Messages, 4)
+	require.Equal(t, "system", converted.Messages[0].Role)
+	require.Equal(t, "weather in Paris?", converted.Messages[1].Content)
+
+	assistant := converted.Messages[2]
+	require.Equal(t, "assistant", assistant.Role)
+	require.Len(t, assistant.ToolCalls, 1)
+	require.Equal(t, "call_1", assistant.ToolCalls[0].Id)
+	require.JSONEq(t, `{"city":"Paris"}`, assistant.ToolCalls[0].Function.Arguments.(string))
+
+	tool := converted.Messages[3]
+	require.Equal(t, "tool", tool.Role)
+	require.Equal(t, "call_1", tool.ToolCallId)
+
+	require.Len(t, converted.Tools, 1)
+	parameters := converted.Tools[0].Function.Parameters.(map[string]any)
+	require.Equal(t, "object", parameters["type"])
+	require.Equal(t, "string", parameters["properties"].(map[string]any)["city"].(map[string]any)["type"])
+
+	choice := converted.ToolChoice.(map[string]any)
+	require.Equal(t, "get_weather", choice["function"].(map[string]any)["name"])
+}
+
+func TestConvertGenerateContentRequest_UnsupportedMedia(t *testing.T) {
+	request := &GenerateContentRequest{Contents: []ChatContent{{
+		Role:  "user",
+		Parts: []Part{{FileData: &FileData{MimeType: "video/mp4", FileUri: "gs://bucket/clip.mp4"}}},
+	}}}
+	_, err := ConvertGenerateContentRequest(request, "gpt-4o", false)
+	require.Error(t, err)
+}
+
+func TestResponseFromOpenAI(t *testing.T) {
+	reasoning := "step by step"
+	response := &openai.TextResponse{
+		Id: "chatcmpl-1",
+		Choices: []openai.TextResponseChoice{{
+			Message: model.Message{
+				Role:             "assistant",
+				Content:          "done",
+				ReasoningContent: &reasoning,
+				ToolCalls: []model.Tool{{
+					Id:       "call_1",
+					Type:     "function",
+					Function: &model.Function{Name: "lookup", Arguments: `{"q":"x"}`},
+				}},
+			},
+			FinishReason: "length",
+		}},
+		Usage: model.Usage{
+			PromptTokens:            10,
+			CompletionTokens:        30,
+			TotalTokens:             40,
+			CompletionTokensDetails: &model.UsageCompletionTokensDetails{ReasoningTokens: 12},
+		},
+	}
+
+	out := ResponseFromOpenAI(response, "gpt-4o")
+	require.Len(t, out.Candidates, 1)
+	candidate := out.Candidates[0]
+	require.Equal(t, "MAX_TOKENS", candidate.FinishReason)
+	require.Len(t, candidate.Content.Parts, 3)
+	require.True(t, candidate.Content.Parts[0].Thought)
+	require.Equal(t, "done", candidate.Content.Parts[1].Text)
+	require.Equal(t, "lookup", candidate.Content.Parts[2].FunctionCall.FunctionName)
+
+	require.Equal(t, 12, out.UsageMetadata.ThoughtsTokenCount)
+	require.Equal(t, 18, out.UsageMetadata.CandidatesTokenCount)
+
+	usage := UsageFromMetadata(out.UsageMetadata)
+	require.Equal(t, 10, usage.PromptTokens)
+	require.Equal(t, 30, usage.CompletionTokens)
+}
+
+func TestStreamConverter_ToolCalls(t *testing.T) {
+	index := 0
+	finish := "tool_calls"
+	converter := NewStreamConverter("gpt-4o")
+
+	first := converter.Convert(&openai.ChatCompletionsStreamResponse{
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{Delta: model.Message{ToolCalls: []model.Tool{{
+			Index: &index, Id: "call_1", Function: &model.Function{Name: "lookup", Arguments: `{"q":`},
+		}}}}},
+	})
+	require.Nil(t, first, "incomplete tool calls must not be emitted")
+
+	last := converter.Convert(&openai.ChatCompletionsStreamResponse{
+		Choices: []openai.ChatCompletionsStreamResponseChoice{{
+			Delta: model.Message{ToolCalls: []model.Tool{{
+				Index: &index, Function: &model.Function{Arguments: `"x"}`},
+			}}},
+			FinishReason: &finish,
+		}},
+	})
+	require.NotNil(t, last)
+	require.Len(t, last.Candidates, 1)
+	require.Equal(t, "STOP", last.Candidates[0].FinishReason)
+	call := last.Candidates[0].Content.Parts[0].FunctionCall
+	require.Equal(t, "lookup", call.FunctionName)
+	require.Equal(t, map[string]any{"q": "x"}, call.Arguments)
+	require.Nil(t, converter.Flush())
+}
+
+func TestStreamEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewStreamEncoder(&buf, false)
+	require.NoError(t, encoder.Write([]byte(`{"a":1}`)))
+	require.NoError(t, encoder.Write([]byte(`{"a":2}`)))
+	require.NoError(t, encoder.Close())
+
+	var chunks []map[string]int
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &chunks))
+	require.Len(t, chunks, 2)
+
+	buf.Reset()
+	require.NoError(t, NewStreamEncoder(&buf, false).Close())
+	require.Equal(t, "[]", buf.String())
+
+	buf.Reset()
+	sse := NewStreamEncoder(&buf, true)
+	require.Equal(t, "text/event-stream", sse.ContentType())
+	require.NoError(t, sse.Write([]byte(`{"a":1}`)))
+	require.NoError(t, sse.Close())
+	require.Equal(t, "data: {\"a\":1}\r\n\r\n", buf.String())
+}
@@ -455,11 +455,11 @@ func ConvertEmbeddingRequest(request model.GeneralOpenAIRequest) *BatchEmbedding
 }
 
 type ChatResponse struct {
-	Candidates     []ChatCandidate    `json:"candidates"`
-	PromptFeedback ChatPromptFeedback `json:"promptFeedback"`
-	UsageMetadata  *UsageMetadata     `json:"usageMetadata,omitempty"`
-	ModelVersion   string             `json:"modelVersion,omitempty"`
-	ResponseId     string             `json:"responseId,omitempty"`
+	Candidates     []ChatCandidate     `json:"candidates"`
+	PromptFeedback *ChatPromptFeedback `json:"promptFeedback,omitempty"`
+	UsageMetadata  *UsageMetadata      `json:"usageMetadata,omitempty"`
+	ModelVersion   string              `json:"modelVersion,omitempty"`
+	ResponseId     string              `json:"responseId,omitempty"`
 }
 
 func (g *ChatResponse) GetResponseText() string {
@@ -474,9 +474,9 @@ func (g *ChatResponse) GetResponseText() string {
 
 type ChatCandidate struct {
 	Content       ChatContent        `json:"content"`
-	FinishReason  string             `json:"finishReason"`
+	FinishReason  string             `json:"finishReason,omitempty"`
 	Index         int64              `json:"index"`
-	SafetyRatings []ChatSafetyRating `json:"safetyRatings"`
+	SafetyRatings []ChatSafetyRating `json:"safetyRatings,omitempty"`
 }
 
 type ChatSafetyRating struct {
@@ -0,0 +1,151 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// StreamEncoder writes streamGenerateContent chunks in the framing the client asked for:
+// server-sent events with alt=sse, otherwise a JSON array streamed element by element.
+type StreamEncoder struct {
+	w       io.Writer
+	sse     bool
+	started bool
+}
+
+// NewStreamEncoder returns an encoder writing to w.
+func NewStreamEncoder(w io.Writer, sse bool) *StreamEncoder {
+	return &StreamEncoder{w: w, sse: sse}
+}
+
+// ContentType is the Content-Type of the encoded stream.
+func (e *StreamEncoder) ContentType() string {
+	if e.sse {
+		return "text/event-stream"
+	}
+	return "application/json"
+}
+
+// Write writes one chunk.
+func (e *StreamEncoder) Write(payload []byte) error {
+	var buf bytes.Buffer
+	switch {
+	case e.sse:
+		buf.WriteString("data: ")
+		buf.Write(payload)
+		buf.WriteString("\r\n\r\n")
+	case !e.started:
+		buf.WriteByte('[')
+		buf.Write(payload)
+	default:
+		buf.WriteString(",\r\n")
+		buf.Write(payload)
+	}
+	e.started = true
+	_, err := e.w.Write(buf.Bytes())
+	return err
+}
+
+// Close terminates the JSON array framing. It is a no-op for server-sent events.
+func (e *StreamEncoder) Close() error {
+	if e.sse {
+		return nil
+	}
+	closing := "]"
+	if !e.started {
+		closing = "[]"
+	}
+	e.started = true
+	_, err := io.WriteString(e.w, closing)
+	return err
+}
+
+// NativeHandler forwards a generateContent response to the client verbatim and returns the
+// usage it reports, or nil when it reports none, along with the generated text.
+func NativeHandler(c *gin.Context, resp *http.Response) (*model.ErrorWithStatusCode, *model.Usage, string) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError), nil, ""
+	}
+	_ = resp.Body.Close()
+
+	c.Data(resp.StatusCode, "application/json", body)
+
+	var response ChatResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		gmw.GetLogger(c).Warn("unmarshal gemini response for usage failed", zap.Error(err))
+		return nil, nil, ""
+	}
+	return nil, UsageFromMetadata(response.UsageMetadata), candidatesText(&response)
+}
+
+// NativeStreamHandler forwards a streamGenerateContent SSE response to the client chunk by
+// chunk and returns the usage of the last chunk that reported one, along with the
+// generated text.
+func NativeStreamHandler(c *gin.Context, resp *http.Response, sse bool) (*model.ErrorWithStatusCode, *model.Usage, string) {
+	defer resp.Body.Close()
+
+	encoder := NewStreamEncoder(c.Writer, sse)
+	c.Writer.Header().Set("Content-Type", encoder.ContentType())
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+
+	scanner := bufio.NewScanner(resp.Body)
+	buffer := make([]byte, 10*1024*1024) // 10MB buffer
+	scanner.Buffer(buffer, len(buffer))
+
+	var usage *model.Usage
+	var text bytes.Buffer
+	for scanner.Scan() {
+		payload, ok := bytes.CutPrefix(bytes.TrimSpace(scanner.Bytes()), []byte("data:"))
+		if !ok {
+			continue
+		}
+		payload = bytes.TrimSpace(payload)
+		if len(payload) == 0 {
+			continue
+		}
+
+		var chunk ChatResponse
+		if err := json.Unmarshal(payload, &chunk); err == nil {
+			if chunkUsage := UsageFromMetadata(chunk.UsageMetadata); chunkUsage != nil {
+				usage = chunkUsage
+			}
+			text.WriteString(candidatesText(&chunk))
+		}
+
+		if err := encoder.Write(payload); err != nil {
+			return openai.ErrorWrapper(errors.Wrap(err, "write stream chunk"), "write_response_failed", http.StatusInternalServerError), usage, text.String()
+		}
+		c.Writer.Flush()
+	}
+	if err := scanner.Err(); err != nil {
+		return openai.ErrorWrapper(errors.Wrap(err, "read upstream stream"), "read_response_body_failed", http.StatusInternalServerError), usage, text.String()
+	}
+	if err := encoder.Close(); err != nil {
+		return openai.ErrorWrapper(errors.Wrap(err, "close stream"), "write_response_failed", http.StatusInternalServerError), usage, text.String()
+	}
+	c.Writer.Flush()
+	return nil, usage, text.String()
+}
+
+func candidatesText(response *ChatResponse) string {
+	var text bytes.Buffer
+	for _, candidate := range response.Candidates {
+		for _, part := range candidate.Content.Parts {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String()
+}
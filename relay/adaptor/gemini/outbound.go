@@ -0,0 +1,297 @@
+package gemini
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ResponseFromOpenAI converts an OpenAI chat completion into a native generateContent
+// response for clients of the Gemini API surface.
+func ResponseFromOpenAI(response *openai.TextResponse, modelName string) *ChatResponse {
+	out := &ChatResponse{
+		Candidates:    make([]ChatCandidate, 0, len(response.Choices)),
+		UsageMetadata: UsageMetadataFromOpenAI(&response.Usage),
+		ModelVersion:  modelName,
+		ResponseId:    response.Id,
+	}
+	for _, choice := range response.Choices {
+		parts := messageParts(&choice.Message)
+		for _, tool := range choice.Message.ToolCalls {
+			parts = append(parts, functionCallPart(tool))
+		}
+		out.Candidates = append(out.Candidates, ChatCandidate{
+			Content:      ChatContent{Role: "model", Parts: nonNilParts(parts)},
+			FinishReason: FinishReasonFromOpenAI(choice.FinishReason),
+			Index:        int64(choice.Index),
+		})
+	}
+	return out
+}
+
+// UsageMetadataFromOpenAI maps OpenAI usage to Gemini usage metadata. Gemini reports
+// reasoning tokens apart from the candidate tokens.
+func UsageMetadataFromOpenAI(usage *model.Usage) *UsageMetadata {
+	if usage == nil || (usage.PromptTokens == 0 && usage.CompletionTokens == 0) {
+		return nil
+	}
+	metadata := &UsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.PromptTokens + usage.CompletionTokens,
+	}
+	if usage.PromptTokensDetails != nil {
+		metadata.CachedContentTokenCount = usage.PromptTokensDetails.CachedTokens
+	}
+	if usage.CompletionTokensDetails != nil && usage.CompletionTokensDetails.ReasoningTokens > 0 {
+		metadata.ThoughtsTokenCount = usage.CompletionTokensDetails.ReasoningTokens
+		metadata.CandidatesTokenCount = max(usage.CompletionTokens-metadata.ThoughtsTokenCount, 0)
+	}
+	return metadata
+}
+
+// UsageFromMetadata maps Gemini usage metadata to the usage billed for the request.
+func UsageFromMetadata(metadata *UsageMetadata) *model.Usage {
+	if metadata == nil || metadata.TotalTokenCount == 0 {
+		return nil
+	}
+	usage := &model.Usage{
+		PromptTokens:     metadata.PromptTokenCount,
+		CompletionTokens: metadata.CandidatesTokenCount + metadata.ThoughtsTokenCount,
+		TotalTokens:      metadata.TotalTokenCount,
+	}
+	if metadata.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &model.UsagePromptTokensDetails{CachedTokens: metadata.CachedContentTokenCount}
+	}
+	return usage
+}
+
+// FinishReasonFromOpenAI maps an OpenAI finish reason to its Gemini equivalent.
+func FinishReasonFromOpenAI(reason string) string {
+	switch reason {
+	case "":
+		return ""
+	case "length":
+		return "MAX_TOKENS"
+	case "content_filter":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// ErrorStatus returns the canonical Google API status name of an HTTP status code.
+func ErrorStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "INVALID_ARGUMENT"
+	case http.StatusUnauthorized:
+		return "UNAUTHENTICATED"
+	case http.StatusForbidden:
+		return "PERMISSION_DENIED"
+	case http.StatusNotFound:
+		return "NOT_FOUND"
+	case http.StatusTooManyRequests:
+		return "RESOURCE_EXHAUSTED"
+	case http.StatusServiceUnavailable:
+		return "UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "DEADLINE_EXCEEDED"
+	default:
+		if statusCode >= 500 {
+			return "INTERNAL"
+		}
+		return "FAILED_PRECONDITION"
+	}
+}
+
+// StreamConverter converts OpenAI chat completion chunks into streamGenerateContent chunks.
+// Tool call arguments arrive in fragments, so function calls are emitted once complete,
+// together with the finish reason.
+type StreamConverter struct {
+	modelName string
+	toolCalls map[int]*model.Tool
+}
+
+// NewStreamConverter returns a converter for one streamed response.
+func NewStreamConverter(modelName string) *StreamConverter {
+	return &StreamConverter{modelName: modelName, toolCalls: map[int]*model.Tool{}}
+}
+
+// Convert returns the native chunk for an OpenAI chunk, or nil when the chunk carries
+// nothing to forward yet.
+func (s *StreamConverter) Convert(chunk *openai.ChatCompletionsStreamResponse) *ChatResponse {
+	out := &ChatResponse{
+		Candidates:    []ChatCandidate{},
+		UsageMetadata: UsageMetadataFromOpenAI(chunk.Usage),
+		ModelVersion:  s.modelName,
+		ResponseId:    chunk.Id,
+	}
+	for _, choice := range chunk.Choices {
+		parts := messageParts(&choice.Delta)
+		for i, tool := range choice.Delta.ToolCalls {
+			s.appendToolCall(i, tool)
+		}
+
+		finishReason := ""
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			finishReason = FinishReasonFromOpenAI(*choice.FinishReason)
+			parts = append(parts, s.flushToolCalls()...)
+		}
+		if len(parts) == 0 && finishReason == "" {
+			continue
+		}
+		out.Candidates = append(out.Candidates, ChatCandidate{
+			Content:      ChatContent{Role: "model", Parts: nonNilParts(parts)},
+			FinishReason: finishReason,
+			Index:        int64(choice.Index),
+		})
+	}
+	if len(out.Candidates) == 0 && out.UsageMetadata == nil {
+		return nil
+	}
+	return out
+}
+
+// Flush returns the function calls still pending when the stream ended without a
+// finish reason, or nil.
+func (s *StreamConverter) Flush() *ChatResponse {
+	parts := s.flushToolCalls()
+	if len(parts) == 0 {
+		return nil
+	}
+	return &ChatResponse{
+		Candidates:   []ChatCandidate{{Content: ChatContent{Role: "model", Parts: parts}, FinishReason: "STOP"}},
+		ModelVersion: s.modelName,
+	}
+}
+
+func (s *StreamConverter) appendToolCall(position int, delta model.Tool) {
+	index := position
+	if delta.Index != nil {
+		index = *delta.Index
+	}
+	tool, ok := s.toolCalls[index]
+	if !ok {
+		tool = &model.Tool{Type: "function", Function: &model.Function{}}
+		s.toolCalls[index] = tool
+	}
+	if delta.Id != "" {
+		tool.Id = delta.Id
+	}
+	if delta.Function == nil {
+		return
+	}
+	if delta.Function.Name != "" {
+		tool.Function.Name = delta.Function.Name
+	}
+	if args, ok := delta.Function.Arguments.(string); ok {
+		existing, _ := tool.Function.Arguments.(string)
+		tool.Function.Arguments = existing + args
+	}
+}
+
+func (s *StreamConverter) flushToolCalls() []Part {
+	if len(s.toolCalls) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(s.toolCalls))
+	for index := range s.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	parts := make([]Part, 0, len(indexes))
+	for _, index := range indexes {
+		parts = append(parts, functionCallPart(*s.toolCalls[index]))
+	}
+	s.toolCalls = map[int]*model.Tool{}
+	return parts
+}
+
+// messageParts returns the reasoning and content of an OpenAI message as native parts.
+func messageParts(message *model.Message) []Part {
+	var parts []Part
+	reasoning := ""
+	switch {
+	case message.ReasoningContent != nil:
+		reasoning = *message.ReasoningContent
+	case message.Reasoning != nil:
+		reasoning = *message.Reasoning
+	}
+	if reasoning != "" {
+		parts = append(parts, Part{Text: reasoning, Thought: true})
+	}
+
+	switch content := message.Content.(type) {
+	case string:
+		if content != "" {
+			parts = append(parts, Part{Text: content})
+		}
+	default:
+		for _, item := range message.ParseContent() {
+			switch item.Type {
+			case model.ContentTypeText:
+				if item.Text != nil && *item.Text != "" {
+					parts = append(parts, Part{Text: *item.Text})
+				}
+			case model.ContentTypeImageURL:
+				if item.ImageURL == nil {
+					continue
+				}
+				if mimeType, data, ok := parseDataURL(item.ImageURL.Url); ok {
+					parts = append(parts, Part{InlineData: &InlineData{MimeType: mimeType, Data: data}})
+				}
+			}
+		}
+	}
+	return parts
+}
+
+func functionCallPart(tool model.Tool) Part {
+	call := &FunctionCall{Arguments: map[string]any{}}
+	if tool.Function != nil {
+		call.FunctionName = tool.Function.Name
+		switch args := tool.Function.Arguments.(type) {
+		case string:
+			if strings.TrimSpace(args) != "" {
+				var parsed any
+				if err := json.Unmarshal([]byte(args), &parsed); err == nil {
+					call.Arguments = parsed
+				}
+			}
+		case nil:
+		default:
+			call.Arguments = args
+		}
+	}
+	return Part{FunctionCall: call}
+}
+
+// parseDataURL splits a base64 data URL into its media type and payload.
+func parseDataURL(url string) (mimeType string, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mimeType, found = strings.CutSuffix(header, ";base64")
+	if !found {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// nonNilParts keeps "parts" an array in the JSON output, as Gemini clients expect.
+func nonNilParts(parts []Part) []Part {
+	if parts == nil {
+		return []Part{}
+	}
+	return parts
+}
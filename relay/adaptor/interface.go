@@ -1,6 +1,7 @@
 package adaptor
 
 import (
+	"context"
 	"io"
 	"net/http"
 
@@ -24,6 +25,15 @@ type ModelConfig struct {
 	// ImagePriceUsd is the USD cost per generated image for image models.
 	// Text models should leave this as zero.
 	ImagePriceUsd float64 `json:"image_price_usd,omitempty"`
+	// SearchUnitPriceUsd is the USD cost per rerank search unit, i.e. one query over up
+	// to 100 documents. Rerank models billed this way should leave Ratio as zero.
+	SearchUnitPriceUsd float64 `json:"search_unit_price_usd,omitempty"`
+	// DocumentPriceUsd is the USD cost per document scored by a rerank model.
+	// Rerank models billed this way should leave Ratio as zero.
+	DocumentPriceUsd float64 `json:"document_price_usd,omitempty"`
+	// VideoPriceUsdPerSecond is the USD cost per generated second for video models served
+	// through /v1/videos. Video models billed this way should leave Ratio as zero.
+	VideoPriceUsdPerSecond float64 `json:"video_price_usd_per_second,omitempty"`
 	// CachedInputRatio specifies price per cached input token.
 	// If non-zero, it overrides Ratio for cached input tokens. Negative means free.
 	CachedInputRatio float64 `json:"cached_input_ratio,omitempty"`
@@ -81,6 +91,26 @@ type Adaptor interface {
 	GetCompletionRatio(modelName string) float64
 }
 
+// RerankAdaptor is implemented by adaptors that serve /v1/rerank. The relay sends the
+// converted request with DoRequest and hands the upstream response to DoRerankResponse,
+// which returns it in the normalized schema without writing to the client.
+type RerankAdaptor interface {
+	ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error)
+	DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode)
+}
+
+// VideoAdaptor is implemented by adaptors that serve the /v1/videos job API. Video jobs
+// outlive the request that created them and are polled in the background, so the methods
+// take a context and a meta rebuilt from the channel instead of a gin context.
+type VideoAdaptor interface {
+	// CreateVideo submits a generation job and returns its initial upstream state.
+	CreateVideo(ctx context.Context, meta *meta.Meta, request *model.VideoRequest) (*model.VideoJobStatus, *model.ErrorWithStatusCode)
+	// GetVideo returns the current state of the job identified by upstreamId.
+	GetVideo(ctx context.Context, meta *meta.Meta, upstreamId string) (*model.VideoJobStatus, *model.ErrorWithStatusCode)
+	// GetVideoContent opens the generated clip of a completed job and returns its content type.
+	GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamId string) (io.ReadCloser, string, *model.ErrorWithStatusCode)
+}
+
 // DefaultPricingMethods provides default implementations for adapters without specific pricing
 type DefaultPricingMethods struct{}
 
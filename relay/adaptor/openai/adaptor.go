@@ -640,6 +640,20 @@ func (a *Adaptor) ConvertImageRequest(_ *gin.Context, request *model.ImageReques
 	return request, nil
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor for OpenAI-compatible rerank
+// providers such as Jina, Voyage, SiliconFlow and Baidu.
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	return openai_compatible.ConvertRerankRequest(request, meta.GetByContext(c).BaseURL), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor.
+func (a *Adaptor) DoRerankResponse(_ *gin.Context, resp *http.Response, _ *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	return openai_compatible.RerankHandler(resp)
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -48,8 +48,14 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"gpt-4o-audio-preview-2025-06-03":      {Ratio: 2.5 * ratio.MilliTokensUsd, CompletionRatio: 4.0},
 
 	// Realtime Models
+	"gpt-realtime":                            {Ratio: 4.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.4 * ratio.MilliTokensUsd},
+	"gpt-realtime-2025-08-28":                 {Ratio: 4.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.4 * ratio.MilliTokensUsd},
+	"gpt-realtime-mini":                       {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.06 * ratio.MilliTokensUsd},
+	"gpt-realtime-mini-2025-10-06":            {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.06 * ratio.MilliTokensUsd},
 	"gpt-4o-realtime-preview":                 {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 2.5 * ratio.MilliTokensUsd},
 	"gpt-4o-realtime-preview-2025-06-03":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 2.5 * ratio.MilliTokensUsd},
+	"gpt-4o-realtime-preview-2024-12-17":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 2.5 * ratio.MilliTokensUsd},
+	"gpt-4o-realtime-preview-2024-10-01":      {Ratio: 5.0 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 2.5 * ratio.MilliTokensUsd},
 	"gpt-4o-mini-realtime-preview":            {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.3 * ratio.MilliTokensUsd},
 	"gpt-4o-mini-realtime-preview-2024-12-17": {Ratio: 0.6 * ratio.MilliTokensUsd, CompletionRatio: 4.0, CachedInputRatio: 0.3 * ratio.MilliTokensUsd},
 
@@ -158,6 +164,11 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"dall-e-3": {Ratio: 0, CompletionRatio: 1.0, ImagePriceUsd: 0.04},
 	// Base price for gpt-image-1 at 1024x1024 with low fidelity is $0.011; tier tables in ratio.ImageTierTables scale this.
 	"gpt-image-1": {Ratio: 0, CompletionRatio: 1.0, ImagePriceUsd: 0.011},
+
+	// Video Generation Models
+	// Policy: Video models are billed per generated second, so set Ratio=0 and use VideoPriceUsdPerSecond.
+	"sora-2":     {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.10},
+	"sora-2-pro": {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.30},
 }
 
 // ModelList derived from ModelRatios for backward compatibility
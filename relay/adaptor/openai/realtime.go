@@ -1,8 +1,8 @@
 package openai
 
 import (
-	"context"
 	"encoding/json"
+	"math"
 	"net/http"
 	"net/url"
 	"strings"
@@ -14,18 +14,17 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 
-	"github.com/songquanpeng/one-api/common/ctxkey"
-	"github.com/songquanpeng/one-api/common/helper"
-	"github.com/songquanpeng/one-api/common/tracing"
-	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	rmeta "github.com/songquanpeng/one-api/relay/meta"
 	rmodel "github.com/songquanpeng/one-api/relay/model"
 	"github.com/songquanpeng/one-api/relay/relaymode"
+	"github.com/songquanpeng/one-api/relay/streaming"
 )
 
 // RealtimeHandler proxies a WebSocket session to the upstream OpenAI Realtime endpoint.
 // It preserves text/binary frames and mirrors the `Sec-WebSocket-Protocol` when present.
-func RealtimeHandler(c *gin.Context, meta *rmeta.Meta) (*rmodel.ErrorWithStatusCode, *rmodel.Usage) {
+// completionRatio is the resolved text completion ratio used to convert audio output tokens.
+func RealtimeHandler(c *gin.Context, meta *rmeta.Meta, completionRatio float64) (*rmodel.ErrorWithStatusCode, *rmodel.Usage) {
 	lg := gmw.GetLogger(c)
 	if meta.Mode != relaymode.Realtime {
 		return &rmodel.ErrorWithStatusCode{
@@ -99,55 +98,30 @@ func RealtimeHandler(c *gin.Context, meta *rmeta.Meta) (*rmodel.ErrorWithStatusC
 	}
 	defer func() { _ = upstreamConn.Close() }()
 
-	// Bi-directional pump
+	// Bi-directional pump. Every response.done event is billed as it arrives; when the
+	// tracker refuses a charge the upstream pump closes the client socket with an error event.
 	errc := make(chan error, 2)
 	usage := &rmodel.Usage{}
-	go func() { errc <- copyWSUpstreamToClient(upstreamConn, clientConn, usage) }()
+	tracker := streaming.FromContext(c)
+	onUsage := func(turn *RealtimeUsage) error {
+		converted := turn.ToUsage(meta.ActualModelName, completionRatio)
+		streaming.MergeUsage(usage, converted)
+		if tracker == nil {
+			return nil
+		}
+		return tracker.AddUsage(converted)
+	}
+	go func() { errc <- copyWSUpstreamToClient(upstreamConn, clientConn, onUsage) }()
 	go func() { errc <- copyWS(clientConn, upstreamConn) }()
 
-	// Wait for either direction to error/close
+	// Wait for either direction to error/close, then tear down both sockets so the
+	// other pump unblocks before usage is read.
 	if e := <-errc; e != nil {
 		lg.Debug("realtime ws closed", zap.String("error", e.Error()))
 	}
-
-	// Compute total tokens if we have parts
-	if usage != nil && usage.TotalTokens == 0 {
-		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
-	}
-
-	// Record a zero-quota realtime session log for observability.
-	// Realtime currently does not perform quota billing, but we still want latency & usage visibility.
-	go func() {
-		ctx, cancel := context.WithTimeout(gmw.BackgroundCtx(c), time.Minute)
-		defer cancel()
-
-		requestId := c.GetString(ctxkey.RequestId)
-		traceId := tracing.GetTraceID(c)
-		model.RecordConsumeLog(ctx, &model.Log{
-			UserId:    meta.UserId,
-			ChannelId: meta.ChannelId,
-			PromptTokens: func() int {
-				if usage != nil {
-					return usage.PromptTokens
-				}
-				return 0
-			}(),
-			CompletionTokens: func() int {
-				if usage != nil {
-					return usage.CompletionTokens
-				}
-				return 0
-			}(),
-			ModelName:   meta.ActualModelName,
-			TokenName:   meta.TokenName,
-			Quota:       0,
-			Content:     "realtime session, no quota consumption",
-			IsStream:    true,
-			ElapsedTime: helper.CalcElapsedTime(meta.StartTime),
-			RequestId:   requestId,
-			TraceId:     traceId,
-		})
-	}()
+	_ = clientConn.Close()
+	_ = upstreamConn.Close()
+	<-errc
 
 	return nil, usage
 }
@@ -165,51 +139,151 @@ func copyWS(src, dst *websocket.Conn) error {
 	}
 }
 
-// copyWSUpstreamToClient forwards frames and tries best-effort to parse usage from upstream JSON text messages.
-func copyWSUpstreamToClient(src, dst *websocket.Conn, usage *rmodel.Usage) error {
+// copyWSUpstreamToClient forwards frames and reports the usage of every response.done event.
+// If onUsage fails, the client receives an error event and a policy-violation close frame.
+func copyWSUpstreamToClient(src, dst *websocket.Conn, onUsage func(*RealtimeUsage) error) error {
 	for {
 		mt, msg, err := src.ReadMessage()
 		if err != nil {
 			return errors.WithStack(err)
 		}
+
+		// Record usage before forwarding so a client that disconnects right after
+		// response.done is still billed for that turn.
+		var billErr error
 		if mt == websocket.TextMessage {
-			maybeParseRealtimeUsage(msg, usage)
+			if turn := parseRealtimeUsage(msg); turn != nil {
+				billErr = onUsage(turn)
+			}
 		}
 		if werr := dst.WriteMessage(mt, msg); werr != nil {
 			return errors.WithStack(werr)
 		}
+		if billErr != nil {
+			closeRealtimeWithError(dst, billErr)
+			return errors.Wrap(billErr, "bill realtime response")
+		}
 	}
 }
 
-// maybeParseRealtimeUsage attempts to extract token usage from response.done-like events.
-func maybeParseRealtimeUsage(msg []byte, u *rmodel.Usage) {
-	// Avoid heavy processing if no accumulator
-	if u == nil || len(msg) == 0 {
-		return
+// closeRealtimeWithError sends a Realtime error event followed by a close frame.
+func closeRealtimeWithError(conn *websocket.Conn, cause error) {
+	errType, code, message := "server_error", "streaming_billing_failed", "failed to bill realtime session"
+	if errors.Is(cause, streaming.ErrQuotaExceeded) {
+		errType, code, message = "insufficient_quota", "insufficient_user_quota", "user quota exhausted during realtime session"
+	}
+
+	event, _ := json.Marshal(map[string]any{
+		"type": "error",
+		"error": map[string]any{
+			"type":    errType,
+			"code":    code,
+			"message": message,
+		},
+	})
+	_ = conn.WriteMessage(websocket.TextMessage, event)
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.ClosePolicyViolation, code),
+		time.Now().Add(time.Second))
+}
+
+// RealtimeUsage is the usage block of a Realtime response.done event.
+type RealtimeUsage struct {
+	TotalTokens        int                         `json:"total_tokens"`
+	InputTokens        int                         `json:"input_tokens"`
+	OutputTokens       int                         `json:"output_tokens"`
+	InputTokenDetails  *RealtimeInputTokenDetails  `json:"input_token_details,omitempty"`
+	OutputTokenDetails *RealtimeOutputTokenDetails `json:"output_token_details,omitempty"`
+}
+
+// RealtimeInputTokenDetails splits Realtime input tokens by modality.
+type RealtimeInputTokenDetails struct {
+	CachedTokens        int                          `json:"cached_tokens"`
+	TextTokens          int                          `json:"text_tokens"`
+	AudioTokens         int                          `json:"audio_tokens"`
+	ImageTokens         int                          `json:"image_tokens"`
+	CachedTokensDetails *RealtimeCachedTokensDetails `json:"cached_tokens_details,omitempty"`
+}
+
+// RealtimeCachedTokensDetails splits cached Realtime input tokens by modality.
+type RealtimeCachedTokensDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+	ImageTokens int `json:"image_tokens"`
+}
+
+// RealtimeOutputTokenDetails splits Realtime output tokens by modality.
+type RealtimeOutputTokenDetails struct {
+	TextTokens  int `json:"text_tokens"`
+	AudioTokens int `json:"audio_tokens"`
+}
+
+// ToUsage converts Realtime usage into text-equivalent tokens so the regular text pricing
+// applies. Audio input is scaled by the audio prompt ratio and audio output by the ratio of
+// the audio output price to the text output price. Cached audio costs the same as cached
+// text, so it is counted 1:1. The raw per-modality counts are kept in the detail fields.
+//
+// completionRatio is the text completion ratio the session is billed with, after channel
+// overrides and pricing rules, so audio output keeps its price relative to the billed text.
+func (u *RealtimeUsage) ToUsage(modelName string, completionRatio float64) *rmodel.Usage {
+	promptTokens, completionTokens := u.InputTokens, u.OutputTokens
+	promptDetails := &rmodel.UsagePromptTokensDetails{TextTokens: u.InputTokens}
+	completionDetails := &rmodel.UsageCompletionTokensDetails{TextTokens: u.OutputTokens}
+
+	audioPromptRatio := ratio.GetAudioPromptRatio(modelName)
+	if d := u.InputTokenDetails; d != nil {
+		textTokens := d.TextTokens + d.ImageTokens
+		cachedAudio := 0
+		if d.CachedTokensDetails != nil {
+			cachedAudio = min(d.CachedTokensDetails.AudioTokens, d.AudioTokens)
+		}
+		promptTokens = textTokens + cachedAudio +
+			int(math.Ceil(float64(d.AudioTokens-cachedAudio)*audioPromptRatio))
+		promptDetails = &rmodel.UsagePromptTokensDetails{
+			CachedTokens: d.CachedTokens,
+			TextTokens:   d.TextTokens,
+			AudioTokens:  d.AudioTokens,
+			ImageTokens:  d.ImageTokens,
+		}
 	}
-	// Very permissive JSON parsing into generic map
-	var m map[string]any
-	if err := json.Unmarshal(msg, &m); err != nil {
-		return
+
+	if d := u.OutputTokenDetails; d != nil {
+		if completionRatio <= 0 {
+			completionRatio = 1
+		}
+		audioCompletionRatio := audioPromptRatio * ratio.GetAudioCompletionRatio(modelName) / completionRatio
+		completionTokens = d.TextTokens + int(math.Ceil(float64(d.AudioTokens)*audioCompletionRatio))
+		completionDetails = &rmodel.UsageCompletionTokensDetails{
+			TextTokens:  d.TextTokens,
+			AudioTokens: d.AudioTokens,
+		}
 	}
-	// Expect events with type and nested response.usage
-	resp, _ := m["response"].(map[string]any)
-	if resp == nil {
-		return
+
+	return &rmodel.Usage{
+		PromptTokens:            promptTokens,
+		CompletionTokens:        completionTokens,
+		TotalTokens:             promptTokens + completionTokens,
+		PromptTokensDetails:     promptDetails,
+		CompletionTokensDetails: completionDetails,
 	}
-	usageObj, _ := resp["usage"].(map[string]any)
-	if usageObj == nil {
-		return
+}
+
+// parseRealtimeUsage extracts the usage of a response.done event, or nil for any other event.
+func parseRealtimeUsage(msg []byte) *RealtimeUsage {
+	if len(msg) == 0 {
+		return nil
 	}
-	// input_tokens / output_tokens are preferred
-	if v, ok := usageObj["input_tokens"].(float64); ok {
-		u.PromptTokens += int(v)
+	var event struct {
+		Type     string `json:"type"`
+		Response *struct {
+			Usage *RealtimeUsage `json:"usage"`
+		} `json:"response"`
 	}
-	if v, ok := usageObj["output_tokens"].(float64); ok {
-		u.CompletionTokens += int(v)
+	if err := json.Unmarshal(msg, &event); err != nil {
+		return nil
 	}
-	if v, ok := usageObj["total_tokens"].(float64); ok {
-		// If total provided, prefer exact
-		u.TotalTokens += int(v)
+	if event.Type != "response.done" || event.Response == nil || event.Response.Usage == nil {
+		return nil
 	}
+	return event.Response.Usage
 }
@@ -0,0 +1,67 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRealtimeUsage(t *testing.T) {
+	t.Parallel()
+
+	require.Nil(t, parseRealtimeUsage([]byte(`{"type":"response.audio.delta","delta":"AAAA"}`)))
+	require.Nil(t, parseRealtimeUsage([]byte(`{"type":"response.done","response":{"status":"cancelled"}}`)))
+	require.Nil(t, parseRealtimeUsage([]byte(`not json`)))
+
+	usage := parseRealtimeUsage([]byte(`{"type":"response.done","response":{"usage":{
+		"total_tokens":195,"input_tokens":140,"output_tokens":55,
+		"input_token_details":{"cached_tokens":30,"text_tokens":40,"audio_tokens":100,
+			"cached_tokens_details":{"text_tokens":0,"audio_tokens":30}},
+		"output_token_details":{"text_tokens":5,"audio_tokens":50}}}}`))
+	require.NotNil(t, usage)
+	require.Equal(t, 140, usage.InputTokens)
+	require.Equal(t, 100, usage.InputTokenDetails.AudioTokens)
+	require.Equal(t, 30, usage.InputTokenDetails.CachedTokensDetails.AudioTokens)
+	require.Equal(t, 50, usage.OutputTokenDetails.AudioTokens)
+}
+
+func TestRealtimeUsageToUsage(t *testing.T) {
+	t.Parallel()
+
+	realtime := &RealtimeUsage{
+		InputTokens:  140,
+		OutputTokens: 55,
+		InputTokenDetails: &RealtimeInputTokenDetails{
+			CachedTokens:        30,
+			TextTokens:          40,
+			AudioTokens:         100,
+			CachedTokensDetails: &RealtimeCachedTokensDetails{AudioTokens: 30},
+		},
+		OutputTokenDetails: &RealtimeOutputTokenDetails{TextTokens: 5, AudioTokens: 50},
+	}
+
+	// gpt-realtime: audio input is 8x text input, audio output is 4x text output.
+	usage := realtime.ToUsage("gpt-realtime", 4)
+	require.Equal(t, 40+30+70*8, usage.PromptTokens)
+	require.Equal(t, 5+50*4, usage.CompletionTokens)
+	require.Equal(t, usage.PromptTokens+usage.CompletionTokens, usage.TotalTokens)
+	require.Equal(t, 30, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 40, usage.PromptTokensDetails.TextTokens)
+	require.Equal(t, 100, usage.PromptTokensDetails.AudioTokens)
+	require.Equal(t, 5, usage.CompletionTokensDetails.TextTokens)
+	require.Equal(t, 50, usage.CompletionTokensDetails.AudioTokens)
+
+	// A channel override that doubles the text completion ratio halves the audio factor,
+	// so audio output keeps its configured price.
+	overridden := realtime.ToUsage("gpt-realtime", 8)
+	require.Equal(t, 5+50*2, overridden.CompletionTokens)
+}
+
+func TestRealtimeUsageToUsageWithoutDetails(t *testing.T) {
+	t.Parallel()
+
+	usage := (&RealtimeUsage{InputTokens: 12, OutputTokens: 7}).ToUsage("gpt-realtime", 4)
+	require.Equal(t, 12, usage.PromptTokens)
+	require.Equal(t, 7, usage.CompletionTokens)
+	require.Equal(t, 19, usage.TotalTokens)
+}
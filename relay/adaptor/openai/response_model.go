@@ -1166,11 +1166,27 @@ func ConvertResponseAPIToChatCompletionRequest(request *ResponseAPIRequest) (*mo
 		case string:
 			chatReq.Messages = append(chatReq.Messages, model.Message{Role: "user", Content: v})
 		case map[string]any:
-			msg, err := responseContentItemToMessage(v)
-			if err != nil {
-				return nil, errors.Wrap(err, "convert response api content to chat message")
+			switch itemType, _ := v["type"].(string); itemType {
+			case "function_call":
+				call := responseFunctionCallToTool(v)
+				// calls of one assistant turn share a single chat message
+				if n := len(chatReq.Messages); n > 0 && chatReq.Messages[n-1].Role == "assistant" {
+					chatReq.Messages[n-1].ToolCalls = append(chatReq.Messages[n-1].ToolCalls, call)
+					continue
+				}
+				chatReq.Messages = append(chatReq.Messages, model.Message{Role: "assistant", ToolCalls: []model.Tool{call}})
+			case "function_call_output":
+				chatReq.Messages = append(chatReq.Messages, responseFunctionCallOutputToMessage(v))
+			case "mcp_list_tools", "mcp_call", "mcp_approval_request", "mcp_approval_response":
+				// MCP items are resolved by the gateway before conversion and carry no chat message
+				continue
+			default:
+				msg, err := responseContentItemToMessage(v)
+				if err != nil {
+					return nil, errors.Wrap(err, "convert response api content to chat message")
+				}
+				chatReq.Messages = append(chatReq.Messages, *msg)
 			}
-			chatReq.Messages = append(chatReq.Messages, *msg)
 		default:
 			return nil, errors.Errorf("unsupported input item of type %T", item)
 		}
@@ -1179,6 +1195,38 @@ func ConvertResponseAPIToChatCompletionRequest(request *ResponseAPIRequest) (*mo
 	return chatReq, nil
 }
 
+// responseFunctionCallToTool converts a function_call input item into a chat tool call.
+func responseFunctionCallToTool(item map[string]any) model.Tool {
+	callId, _ := item["call_id"].(string)
+	name, _ := item["name"].(string)
+	arguments, _ := item["arguments"].(string)
+	return model.Tool{
+		Id:       callId,
+		Type:     "function",
+		Function: &model.Function{Name: name, Arguments: arguments},
+	}
+}
+
+// responseFunctionCallOutputToMessage converts a function_call_output input item into a tool message.
+func responseFunctionCallOutputToMessage(item map[string]any) model.Message {
+	callId, _ := item["call_id"].(string)
+	message := model.Message{Role: "tool", ToolCallId: callId}
+	switch output := item["output"].(type) {
+	case string:
+		message.Content = output
+	case nil:
+		message.Content = ""
+	default:
+		encoded, err := json.Marshal(output)
+		if err != nil {
+			message.Content = fmt.Sprint(output)
+		} else {
+			message.Content = string(encoded)
+		}
+	}
+	return message
+}
+
 func responseContentItemToMessage(item map[string]any) (*model.Message, error) {
 	role := "user"
 	if r, ok := item["role"].(string); ok && r != "" {
@@ -290,6 +290,42 @@ func TestConvertResponseAPIToChatCompletionRequest(t *testing.T) {
 	}
 }
 
+func TestConvertResponseAPIToChatCompletionRequestFunctionCallItems(t *testing.T) {
+	responseReq := &ResponseAPIRequest{
+		Model: "claude-sonnet-4",
+		Input: ResponseAPIInput{
+			"Weather in Paris and Rome?",
+			map[string]any{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": `{"city":"Paris"}`},
+			map[string]any{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": `{"city":"Rome"}`},
+			map[string]any{"type": "function_call_output", "call_id": "call_1", "output": "sunny"},
+			map[string]any{"type": "function_call_output", "call_id": "call_2", "output": map[string]any{"sky": "cloudy"}},
+		},
+	}
+
+	chatReq, err := ConvertResponseAPIToChatCompletionRequest(responseReq)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chatReq.Messages) != 4 {
+		t.Fatalf("expected user, assistant and two tool messages, got %d", len(chatReq.Messages))
+	}
+
+	assistant := chatReq.Messages[1]
+	if assistant.Role != "assistant" || len(assistant.ToolCalls) != 2 {
+		t.Fatalf("expected one assistant message with both calls, got %#v", assistant)
+	}
+	if assistant.ToolCalls[1].Id != "call_2" || assistant.ToolCalls[1].Function.Arguments != `{"city":"Rome"}` {
+		t.Fatalf("tool call not converted correctly: %#v", assistant.ToolCalls[1])
+	}
+
+	if chatReq.Messages[2].Role != "tool" || chatReq.Messages[2].ToolCallId != "call_1" || chatReq.Messages[2].StringContent() != "sunny" {
+		t.Fatalf("unexpected tool message: %#v", chatReq.Messages[2])
+	}
+	if chatReq.Messages[3].StringContent() != `{"sky":"cloudy"}` {
+		t.Fatalf("expected structured output to be JSON encoded, got %q", chatReq.Messages[3].StringContent())
+	}
+}
+
 func TestConvertResponseAPIToChatCompletionRequestDropsUnsupportedTools(t *testing.T) {
 	stream := true
 	responseReq := &ResponseAPIRequest{
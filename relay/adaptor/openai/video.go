@@ -0,0 +1,183 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	imgutil "github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var _ adaptor.VideoAdaptor = new(Adaptor)
+
+// soraVideo is the video object of the OpenAI video API.
+//
+// https://platform.openai.com/docs/api-reference/videos/object
+type soraVideo struct {
+	Id       string `json:"id"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+	Seconds  string `json:"seconds"`
+	Error    *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (v *soraVideo) toStatus() *model.VideoJobStatus {
+	status := &model.VideoJobStatus{
+		UpstreamId: v.Id,
+		Status:     v.Status,
+		Progress:   v.Progress,
+	}
+	status.Seconds, _ = strconv.Atoi(v.Seconds)
+	switch v.Status {
+	case model.VideoStatusQueued, model.VideoStatusInProgress, model.VideoStatusCompleted:
+	default:
+		status.Status = model.VideoStatusFailed
+	}
+	if v.Error != nil {
+		status.Error = v.Error.Message
+	}
+	return status
+}
+
+// CreateVideo implements adaptor.VideoAdaptor for OpenAI Sora and Sora-compatible upstreams.
+func (a *Adaptor) CreateVideo(ctx context.Context, meta *meta.Meta, request *model.VideoRequest) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	if meta.ChannelType == channeltype.Azure {
+		return nil, ErrorWrapper(errors.New("video generation is not supported for Azure channels"), "video_not_supported", http.StatusBadRequest)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	fields := [][2]string{{"model", request.Model}, {"prompt", request.Prompt}}
+	if request.Seconds > 0 {
+		fields = append(fields, [2]string{"seconds", strconv.Itoa(int(request.Seconds))})
+	}
+	if request.Size != "" {
+		fields = append(fields, [2]string{"size", request.Size})
+	}
+	for _, field := range fields {
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return nil, ErrorWrapper(err, "build_video_request_failed", http.StatusInternalServerError)
+		}
+	}
+	if request.InputReference != "" {
+		if err := writeVideoInputReference(writer, request.InputReference); err != nil {
+			return nil, ErrorWrapper(err, "invalid_input_reference", http.StatusBadRequest)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, ErrorWrapper(err, "build_video_request_failed", http.StatusInternalServerError)
+	}
+
+	video := &soraVideo{}
+	if bizErr := doVideoRequest(ctx, meta, http.MethodPost, "/v1/videos", body, writer.FormDataContentType(), video); bizErr != nil {
+		return nil, bizErr
+	}
+	return video.toStatus(), nil
+}
+
+// GetVideo implements adaptor.VideoAdaptor.
+func (a *Adaptor) GetVideo(ctx context.Context, meta *meta.Meta, upstreamId string) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	video := &soraVideo{}
+	if bizErr := doVideoRequest(ctx, meta, http.MethodGet, "/v1/videos/"+upstreamId, nil, "", video); bizErr != nil {
+		return nil, bizErr
+	}
+	return video.toStatus(), nil
+}
+
+// GetVideoContent implements adaptor.VideoAdaptor.
+func (a *Adaptor) GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamId string) (io.ReadCloser, string, *model.ErrorWithStatusCode) {
+	resp, bizErr := sendVideoRequest(ctx, meta, http.MethodGet, "/v1/videos/"+upstreamId+"/content", nil, "")
+	if bizErr != nil {
+		return nil, "", bizErr
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	return resp.Body, contentType, nil
+}
+
+// writeVideoInputReference attaches the first frame, given as a data URL or an image URL,
+// as the input_reference file part.
+func writeVideoInputReference(writer *multipart.Writer, reference string) error {
+	mimeType, data, err := imgutil.GetImageFromUrl(reference)
+	if err != nil {
+		return errors.Wrap(err, "load input_reference")
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return errors.Wrap(err, "decode input_reference")
+	}
+	if mimeType == "" {
+		mimeType = "image/png"
+	}
+	extension := strings.TrimPrefix(mimeType, "image/")
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="input_reference"; filename="reference.%s"`, extension))
+	header.Set("Content-Type", mimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return errors.Wrap(err, "create input_reference part")
+	}
+	if _, err = part.Write(raw); err != nil {
+		return errors.Wrap(err, "write input_reference part")
+	}
+	return nil
+}
+
+// sendVideoRequest calls the video API of the channel and returns the successful response.
+func sendVideoRequest(ctx context.Context, meta *meta.Meta, method, path string, body io.Reader, contentType string) (*http.Response, *model.ErrorWithStatusCode) {
+	url := strings.TrimSuffix(meta.BaseURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, ErrorWrapper(err, "build_video_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		payload, _ := io.ReadAll(resp.Body)
+		return nil, ErrorWrapper(errors.Errorf("upstream video API returned status %d: %s", resp.StatusCode, payload),
+			"upstream_video_error", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// doVideoRequest calls the video API of the channel and decodes the JSON response into out.
+func doVideoRequest(ctx context.Context, meta *meta.Meta, method, path string, body io.Reader, contentType string, out any) *model.ErrorWithStatusCode {
+	resp, bizErr := sendVideoRequest(ctx, meta, method, path, body, contentType)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusBadGateway)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package openai_compatible
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// RerankRequest is the rerank payload sent to OpenAI-compatible providers. Jina,
+// SiliconFlow and Baidu take the normalized schema as is; Voyage names top_n "top_k".
+type RerankRequest struct {
+	Model           string `json:"model"`
+	Query           string `json:"query"`
+	Documents       []any  `json:"documents"`
+	TopN            *int   `json:"top_n,omitempty"`
+	TopK            *int   `json:"top_k,omitempty"`
+	ReturnDocuments *bool  `json:"return_documents,omitempty"`
+}
+
+// ConvertRerankRequest builds the upstream rerank payload for the provider behind baseURL.
+func ConvertRerankRequest(request *model.RerankRequest, baseURL string) *RerankRequest {
+	payload := &RerankRequest{
+		Model:           request.Model,
+		Query:           request.Query,
+		Documents:       request.Documents,
+		TopN:            request.TopN,
+		ReturnDocuments: request.ReturnDocuments,
+	}
+	if strings.Contains(baseURL, "voyageai.com") {
+		// Voyage only accepts plain string documents
+		texts := request.DocumentTexts()
+		payload.Documents = make([]any, len(texts))
+		for i, text := range texts {
+			payload.Documents[i] = text
+		}
+		payload.TopK, payload.TopN = request.TopN, nil
+	}
+	return payload
+}
+
+// rerankResponse covers the rerank responses of Cohere, Jina, SiliconFlow, Voyage and Baidu.
+type rerankResponse struct {
+	Id      string               `json:"id"`
+	Model   string               `json:"model"`
+	Results []rerankResultRecord `json:"results"`
+	// Data holds the results in Voyage responses
+	Data []rerankResultRecord `json:"data"`
+	Meta *struct {
+		BilledUnits *struct {
+			SearchUnits float64 `json:"search_units"`
+			InputTokens int     `json:"input_tokens"`
+		} `json:"billed_units"`
+		Tokens *struct {
+			InputTokens int `json:"input_tokens"`
+		} `json:"tokens"`
+	} `json:"meta"`
+	Usage *struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+type rerankResultRecord struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       json.RawMessage `json:"document"`
+}
+
+// ParseRerankResponse decodes a rerank response in any of the supported provider formats.
+func ParseRerankResponse(body []byte) (*model.RerankResponse, error) {
+	var upstream rerankResponse
+	if err := json.Unmarshal(body, &upstream); err != nil {
+		return nil, errors.Wrap(err, "unmarshal rerank response")
+	}
+
+	records := upstream.Results
+	if len(records) == 0 {
+		records = upstream.Data
+	}
+	response := &model.RerankResponse{
+		Id:      upstream.Id,
+		Model:   upstream.Model,
+		Results: make([]model.RerankResult, 0, len(records)),
+	}
+	for _, record := range records {
+		result := model.RerankResult{Index: record.Index, RelevanceScore: record.RelevanceScore}
+		if text := rerankDocumentText(record.Document); text != "" {
+			result.Document = &model.RerankDocument{Text: text}
+		}
+		response.Results = append(response.Results, result)
+	}
+
+	promptTokens := 0
+	switch {
+	case upstream.Usage != nil:
+		promptTokens = max(upstream.Usage.PromptTokens, upstream.Usage.TotalTokens)
+	case upstream.Meta != nil && upstream.Meta.Tokens != nil:
+		promptTokens = upstream.Meta.Tokens.InputTokens
+	case upstream.Meta != nil && upstream.Meta.BilledUnits != nil:
+		promptTokens = upstream.Meta.BilledUnits.InputTokens
+	}
+	if promptTokens > 0 {
+		response.Usage = &model.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	if upstream.Meta != nil && upstream.Meta.BilledUnits != nil && upstream.Meta.BilledUnits.SearchUnits > 0 {
+		response.Meta = &model.RerankMeta{BilledUnits: &model.RerankBilledUnits{
+			SearchUnits: int(upstream.Meta.BilledUnits.SearchUnits),
+		}}
+	}
+	return response, nil
+}
+
+// rerankDocumentText reads an echoed document, which providers return either as a string
+// or as an object with a text field.
+func rerankDocumentText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var document struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &document); err == nil {
+		return document.Text
+	}
+	return ""
+}
+
+// RerankHandler reads a successful rerank response from resp.
+func RerankHandler(resp *http.Response) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	response, err := ParseRerankResponse(body)
+	if err != nil {
+		return nil, ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return response, nil
+}
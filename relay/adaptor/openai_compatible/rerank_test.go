@@ -0,0 +1,77 @@
+package openai_compatible
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestParseRerankResponse_Cohere(t *testing.T) {
+	response, err := ParseRerankResponse([]byte(`{
+		"id": "r-1",
+		"results": [{"index": 1, "relevance_score": 0.8}, {"index": 0, "relevance_score": 0.2}],
+		"meta": {"billed_units": {"search_units": 1}}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, "r-1", response.Id)
+	require.Len(t, response.Results, 2)
+	require.Equal(t, 1, response.SearchUnits())
+	require.Nil(t, response.Usage)
+}
+
+func TestParseRerankResponse_Jina(t *testing.T) {
+	response, err := ParseRerankResponse([]byte(`{
+		"model": "jina-reranker-v2-base-multilingual",
+		"results": [{"index": 0, "relevance_score": 0.7, "document": {"text": "doc"}}],
+		"usage": {"total_tokens": 42}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, "doc", response.Results[0].Document.Text)
+	require.Equal(t, 42, response.Usage.PromptTokens)
+	require.Zero(t, response.SearchUnits())
+}
+
+func TestParseRerankResponse_Voyage(t *testing.T) {
+	response, err := ParseRerankResponse([]byte(`{
+		"object": "list",
+		"data": [{"index": 2, "relevance_score": 0.6, "document": "doc"}],
+		"usage": {"total_tokens": 17}
+	}`))
+	require.NoError(t, err)
+	require.Len(t, response.Results, 1)
+	require.Equal(t, 2, response.Results[0].Index)
+	require.Equal(t, "doc", response.Results[0].Document.Text)
+	require.Equal(t, 17, response.Usage.PromptTokens)
+}
+
+func TestParseRerankResponse_SiliconFlow(t *testing.T) {
+	response, err := ParseRerankResponse([]byte(`{
+		"id": "sf-1",
+		"results": [{"index": 0, "relevance_score": 0.9}],
+		"meta": {"tokens": {"input_tokens": 30, "output_tokens": 0}}
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, 30, response.Usage.PromptTokens)
+}
+
+func TestConvertRerankRequest_Voyage(t *testing.T) {
+	topN := 3
+	request := &model.RerankRequest{
+		Model:     "rerank-2",
+		Query:     "q",
+		Documents: []any{map[string]any{"text": "a"}, "b"},
+		TopN:      &topN,
+	}
+
+	payload := ConvertRerankRequest(request, "https://api.voyageai.com")
+	require.Equal(t, []any{"a", "b"}, payload.Documents)
+	require.Nil(t, payload.TopN)
+	require.Equal(t, 3, *payload.TopK)
+
+	payload = ConvertRerankRequest(request, "https://api.jina.ai")
+	require.Equal(t, request.Documents, payload.Documents)
+	require.Equal(t, 3, *payload.TopN)
+	require.Nil(t, payload.TopK)
+}
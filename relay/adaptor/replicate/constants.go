@@ -66,9 +66,13 @@ var ModelRatios = map[string]adaptor.ModelConfig{
 	"mistralai/mistral-7b-v0.1":                 {Ratio: 0.05 * ratio.MilliTokensUsd, CompletionRatio: 5.0},  // $0.05/$0.25 per 1M tokens
 
 	// -------------------------------------
-	// Video Models (TODO: implement the adaptor)
+	// Video Models
+	// Policy: Video models are billed per generated second, so set Ratio=0 and use VideoPriceUsdPerSecond.
 	// -------------------------------------
-	// "minimax/video-01": {Ratio: 1.0 * ratio.MilliTokensUsd, CompletionRatio: 1.0},
+	"google/veo-3":       {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.75},  // $0.75 per second
+	"google/veo-3-fast":  {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.40},  // $0.40 per second
+	"kwaivgi/kling-v2.1": {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.05},  // $0.05 per second
+	"minimax/hailuo-02":  {Ratio: 0, CompletionRatio: 1.0, VideoPriceUsdPerSecond: 0.045}, // $0.045 per second
 }
 
 // ModelList derived from ModelRatios for backward compatibility
@@ -0,0 +1,182 @@
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var _ adaptor.VideoAdaptor = new(Adaptor)
+
+// VideoRequest is the prediction request of Replicate video models.
+//
+// https://replicate.com/google/veo-3/api/schema
+type VideoRequest struct {
+	Input VideoInput `json:"input"`
+}
+
+// VideoInput is the common subset of the inputs of Replicate video models.
+type VideoInput struct {
+	Prompt      string `json:"prompt"`
+	Duration    int    `json:"duration,omitempty"`
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	Image       string `json:"image,omitempty"`
+}
+
+// VideoResponse is a prediction of a Replicate video model.
+type VideoResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  any    `json:"error"`
+	// Output could be `string` or `[]string`
+	Output any `json:"output"`
+}
+
+// GetOutput returns the output URLs of the prediction.
+func (r *VideoResponse) GetOutput() ([]string, error) {
+	return (&ImageResponse{Output: r.Output}).GetOutput()
+}
+
+// videoStatus maps a Replicate prediction status to a video job status.
+func videoStatus(status string) string {
+	switch status {
+	case "starting":
+		return model.VideoStatusQueued
+	case "processing":
+		return model.VideoStatusInProgress
+	case "succeeded":
+		return model.VideoStatusCompleted
+	default: // failed, canceled
+		return model.VideoStatusFailed
+	}
+}
+
+func (r *VideoResponse) toStatus() *model.VideoJobStatus {
+	status := &model.VideoJobStatus{UpstreamId: r.ID, Status: videoStatus(r.Status)}
+	switch status.Status {
+	case model.VideoStatusCompleted:
+		status.Progress = 100
+		if outputs, err := r.GetOutput(); err != nil || len(outputs) == 0 {
+			status.Status = model.VideoStatusFailed
+			status.Error = "prediction returned no video"
+		}
+	case model.VideoStatusFailed:
+		status.Error = "prediction " + r.Status
+		if r.Error != nil {
+			status.Error = fmt.Sprint(r.Error)
+		}
+	}
+	return status
+}
+
+// CreateVideo creates a prediction of a Replicate video model.
+func (a *Adaptor) CreateVideo(ctx context.Context, meta *meta.Meta, request *model.VideoRequest) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	if _, ok := ModelRatios[meta.ActualModelName]; !ok {
+		return nil, openai.ErrorWrapper(errors.Errorf("model %s not supported", meta.ActualModelName), "model_not_supported", http.StatusBadRequest)
+	}
+
+	body, err := json.Marshal(VideoRequest{Input: VideoInput{
+		Prompt:      request.Prompt,
+		Duration:    int(request.Seconds),
+		AspectRatio: request.AspectRatio(),
+		Image:       request.InputReference,
+	}})
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+
+	prediction := &VideoResponse{}
+	requestURL := fmt.Sprintf("https://api.replicate.com/v1/models/%s/predictions", meta.ActualModelName)
+	if bizErr := doVideoRequest(ctx, meta, http.MethodPost, requestURL, bytes.NewReader(body), prediction); bizErr != nil {
+		return nil, bizErr
+	}
+	status := prediction.toStatus()
+	status.Seconds = int(request.Seconds)
+	return status, nil
+}
+
+// GetVideo polls the prediction.
+func (a *Adaptor) GetVideo(ctx context.Context, meta *meta.Meta, upstreamId string) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	prediction, bizErr := getVideoPrediction(ctx, meta, upstreamId)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+	return prediction.toStatus(), nil
+}
+
+// GetVideoContent downloads the first output of a succeeded prediction.
+func (a *Adaptor) GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamId string) (io.ReadCloser, string, *model.ErrorWithStatusCode) {
+	prediction, bizErr := getVideoPrediction(ctx, meta, upstreamId)
+	if bizErr != nil {
+		return nil, "", bizErr
+	}
+	outputs, err := prediction.GetOutput()
+	if err != nil || len(outputs) == 0 {
+		return nil, "", openai.ErrorWrapper(errors.New("video is not available"), "video_not_ready", http.StatusNotFound)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, outputs[0], nil)
+	if err != nil {
+		return nil, "", openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, "", openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", openai.ErrorWrapper(errors.Errorf("download video returned status %d", resp.StatusCode),
+			"download_video_failed", http.StatusBadGateway)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "video/mp4"
+	}
+	return resp.Body, contentType, nil
+}
+
+func getVideoPrediction(ctx context.Context, meta *meta.Meta, predictionId string) (*VideoResponse, *model.ErrorWithStatusCode) {
+	prediction := &VideoResponse{}
+	requestURL := "https://api.replicate.com/v1/predictions/" + predictionId
+	if bizErr := doVideoRequest(ctx, meta, http.MethodGet, requestURL, nil, prediction); bizErr != nil {
+		return nil, bizErr
+	}
+	return prediction, nil
+}
+
+func doVideoRequest(ctx context.Context, meta *meta.Meta, method, requestURL string, body io.Reader, out any) *model.ErrorWithStatusCode {
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Authorization", "Bearer "+meta.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		payload, _ := io.ReadAll(resp.Body)
+		return openai.ErrorWrapper(errors.Errorf("replicate returned status %d: %s", resp.StatusCode, payload),
+			"replicate_api_error", resp.StatusCode)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusBadGateway)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package replicate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+func TestVideoResponseToStatus(t *testing.T) {
+	require.Equal(t, model.VideoStatusQueued, (&VideoResponse{Status: "starting"}).toStatus().Status)
+	require.Equal(t, model.VideoStatusInProgress, (&VideoResponse{Status: "processing"}).toStatus().Status)
+
+	completed := (&VideoResponse{Status: "succeeded", Output: "https://replicate.delivery/out.mp4"}).toStatus()
+	require.Equal(t, model.VideoStatusCompleted, completed.Status)
+	require.Equal(t, 100, completed.Progress)
+
+	// a succeeded prediction without output cannot be downloaded, so it must not be billed
+	empty := (&VideoResponse{Status: "succeeded"}).toStatus()
+	require.Equal(t, model.VideoStatusFailed, empty.Status)
+
+	failed := (&VideoResponse{Status: "failed", Error: "NSFW content detected"}).toStatus()
+	require.Equal(t, model.VideoStatusFailed, failed.Status)
+	require.Equal(t, "NSFW content detected", failed.Error)
+
+	canceled := (&VideoResponse{Status: "canceled"}).toStatus()
+	require.Equal(t, model.VideoStatusFailed, canceled.Status)
+	require.Equal(t, "prediction canceled", canceled.Error)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/imagen"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/openai"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/qwen"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/ranking"
 	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/veo"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
 	"github.com/songquanpeng/one-api/relay/meta"
@@ -30,6 +31,7 @@ import (
 )
 
 var _ adaptor.Adaptor = new(Adaptor)
+var _ adaptor.RerankAdaptor = new(Adaptor)
 
 const channelName = "vertexai"
 
@@ -78,6 +80,22 @@ func (a *Adaptor) ConvertRequest(c *gin.Context, relayMode int, request *model.G
 	return adaptor.ConvertRequest(c, relayMode, request)
 }
 
+// ConvertRerankRequest implements adaptor.RerankAdaptor with the Vertex AI Search ranking API.
+func (a *Adaptor) ConvertRerankRequest(c *gin.Context, request *model.RerankRequest) (any, error) {
+	if request == nil {
+		return nil, errors.New("request is nil")
+	}
+	if !ranking.IsRankingModel(request.Model) {
+		return nil, errors.Errorf("model %s does not support rerank", request.Model)
+	}
+	return ranking.ConvertRequest(request), nil
+}
+
+// DoRerankResponse implements adaptor.RerankAdaptor.
+func (a *Adaptor) DoRerankResponse(c *gin.Context, resp *http.Response, meta *meta.Meta) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	return ranking.Handler(resp, meta.ActualModelName)
+}
+
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, request *model.ClaudeRequest) (any, error) {
 	if request == nil {
 		return nil, errors.New("request is nil")
@@ -226,6 +244,7 @@ func (a *Adaptor) GetModelList() []string {
 	models = append(models, adaptor.GetModelListFromPricing(deepseek.ModelRatios)...)
 	models = append(models, adaptor.GetModelListFromPricing(openai.ModelRatios)...)
 	models = append(models, adaptor.GetModelListFromPricing(qwen.ModelRatios)...)
+	models = append(models, ranking.ModelList...)
 
 	// Add VertexAI-specific models
 	models = append(models, "text-embedding-004", "aqa")
@@ -264,6 +283,9 @@ func (a *Adaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
 	// Import Qwen models from qwen subadaptor
 	maps.Copy(pricing, qwen.ModelRatios)
 
+	// Import ranking models served by the Vertex AI Search ranking API
+	maps.Copy(pricing, ranking.ModelRatios)
+
 	// Add VertexAI-specific models that don't belong to subadaptors
 	// Using global ratio.MilliTokensUsd = 0.5 for consistent quota-based pricing
 
@@ -327,6 +349,9 @@ func (a *Adaptor) GetRequestURL(meta *meta.Meta) (string, error) {
 	if meta.Config.VertexAIProjectID == "" {
 		return "", errors.Errorf("VertexAI project ID is required but not configured for channel")
 	}
+	if meta.Mode == relaymode.Rerank {
+		return ranking.GetRequestURL(meta.Config.VertexAIProjectID), nil
+	}
 
 	endpointType := getModelEndpointType(meta.ActualModelName)
 
@@ -404,6 +429,32 @@ func (a *Adaptor) buildClaudeURL(meta *meta.Meta) (string, error) {
 		baseHost, meta.Config.VertexAIProjectID, location, meta.ActualModelName), nil
 }
 
+// GetClaudeCountTokensURL returns the Anthropic count-tokens endpoint published on Vertex AI.
+//
+//   - https://cloud.google.com/vertex-ai/generative-ai/docs/partner-models/claude/count-tokens
+func (a *Adaptor) GetClaudeCountTokensURL(meta *meta.Meta) (string, error) {
+	if meta.Config.VertexAIProjectID == "" {
+		return "", errors.Errorf("VertexAI project ID is required but not configured for channel")
+	}
+	baseHost, location := a.getDefaultHostAndLocation(meta)
+
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/anthropic/models/count-tokens:rawPredict",
+		baseHost, meta.Config.VertexAIProjectID, location), nil
+}
+
+// GetGeminiCountTokensURL returns the countTokens endpoint of a Gemini model on Vertex AI.
+//
+//   - https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/count-tokens
+func (a *Adaptor) GetGeminiCountTokensURL(meta *meta.Meta) (string, error) {
+	if meta.Config.VertexAIProjectID == "" {
+		return "", errors.Errorf("VertexAI project ID is required but not configured for channel")
+	}
+	baseHost, location := a.getDefaultHostAndLocation(meta)
+
+	return fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:countTokens",
+		baseHost, meta.Config.VertexAIProjectID, location, meta.ActualModelName), nil
+}
+
 // buildGeminiURL builds URL for Gemini and other text models
 func (a *Adaptor) buildGeminiURL(meta *meta.Meta) (string, error) {
 	// Gemini (and other text models) use generateContent / streamGenerateContent
@@ -695,3 +695,29 @@ func TestGetQwenEndpointConfig(t *testing.T) {
 		}
 	})
 }
+
+func TestClaudeCountTokensURL(t *testing.T) {
+	Convey("GetClaudeCountTokensURL", t, func() {
+		adaptor := &Adaptor{}
+
+		Convey("uses the anthropic publisher count-tokens endpoint in the channel region", func() {
+			meta := &meta.Meta{
+				ActualModelName: "claude-sonnet-4@20250514",
+				Config: model.ChannelConfig{
+					VertexAIProjectID: "test-project",
+					Region:            "europe-west1",
+				},
+			}
+
+			url, err := adaptor.GetClaudeCountTokensURL(meta)
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "https://europe-west1-aiplatform.googleapis.com/v1/projects/test-project/locations/europe-west1/publishers/anthropic/models/count-tokens:rawPredict")
+		})
+
+		Convey("requires a project id", func() {
+			url, err := adaptor.GetClaudeCountTokensURL(&meta.Meta{ActualModelName: "claude-sonnet-4@20250514"})
+			So(err, ShouldNotBeNil)
+			So(url, ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,121 @@
+// Package ranking serves /v1/rerank on Vertex AI channels through the Vertex AI Search
+// ranking API.
+//
+//   - https://cloud.google.com/generative-ai-app-builder/docs/ranking
+package ranking
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+// ModelRatios contains the supported ranking models and their pricing.
+// Each query over up to 100 records is billed as one search unit.
+// Based on https://cloud.google.com/generative-ai-app-builder/pricing
+var ModelRatios = map[string]adaptor.ModelConfig{
+	"semantic-ranker-default@latest": {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+	"semantic-ranker-fast@latest":    {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+	"semantic-ranker-default-004":    {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+	"semantic-ranker-fast-004":       {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+	"semantic-ranker-default-003":    {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+	"semantic-ranker-512@latest":     {SearchUnitPriceUsd: 0.001}, // $1 per 1K queries
+}
+
+// ModelList is derived from ModelRatios.
+var ModelList = adaptor.GetModelListFromPricing(ModelRatios)
+
+// IsRankingModel reports whether the model is served by the ranking API.
+func IsRankingModel(model string) bool {
+	return strings.HasPrefix(model, "semantic-ranker-")
+}
+
+// GetRequestURL returns the rank endpoint of the default ranking config of a project.
+func GetRequestURL(projectID string) string {
+	return fmt.Sprintf("https://discoveryengine.googleapis.com/v1/projects/%s/locations/global/rankingConfigs/default_ranking_config:rank",
+		projectID)
+}
+
+// RankRequest is the request body of the rank method.
+type RankRequest struct {
+	Model                         string   `json:"model"`
+	Query                         string   `json:"query"`
+	Records                       []Record `json:"records"`
+	TopN                          int      `json:"topN,omitempty"`
+	IgnoreRecordDetailsInResponse bool     `json:"ignoreRecordDetailsInResponse,omitempty"`
+}
+
+// Record is a ranked record. Its id carries the index of the document in the request.
+type Record struct {
+	Id      string  `json:"id"`
+	Content string  `json:"content,omitempty"`
+	Score   float64 `json:"score,omitempty"`
+}
+
+// RankResponse is the response body of the rank method.
+type RankResponse struct {
+	Records []Record `json:"records"`
+}
+
+// ConvertRequest converts a normalized rerank request into a rank request.
+func ConvertRequest(request *model.RerankRequest) *RankRequest {
+	texts := request.DocumentTexts()
+	rankRequest := &RankRequest{
+		Model:                         request.Model,
+		Query:                         request.Query,
+		Records:                       make([]Record, len(texts)),
+		IgnoreRecordDetailsInResponse: request.ReturnDocuments == nil || !*request.ReturnDocuments,
+	}
+	for i, text := range texts {
+		rankRequest.Records[i] = Record{Id: strconv.Itoa(i), Content: text}
+	}
+	if request.TopN != nil {
+		rankRequest.TopN = *request.TopN
+	}
+	return rankRequest
+}
+
+// ConvertResponse converts a rank response into the normalized rerank response.
+// The ranking API reports no usage, so the relay derives the search units itself.
+func ConvertResponse(response *RankResponse, modelName string) *model.RerankResponse {
+	out := &model.RerankResponse{
+		Model:   modelName,
+		Results: make([]model.RerankResult, 0, len(response.Records)),
+	}
+	for _, record := range response.Records {
+		index, err := strconv.Atoi(record.Id)
+		if err != nil {
+			continue
+		}
+		result := model.RerankResult{Index: index, RelevanceScore: record.Score}
+		if record.Content != "" {
+			result.Document = &model.RerankDocument{Text: record.Content}
+		}
+		out.Results = append(out.Results, result)
+	}
+	return out
+}
+
+// Handler reads a successful rank response.
+func Handler(resp *http.Response, modelName string) (*model.RerankResponse, *model.ErrorWithStatusCode) {
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	var rankResponse RankResponse
+	if err := json.Unmarshal(body, &rankResponse); err != nil {
+		return nil, openai.ErrorWrapper(errors.Wrap(err, "unmarshal rank response"), "unmarshal_response_body_failed", http.StatusInternalServerError)
+	}
+	return ConvertResponse(&rankResponse, modelName), nil
+}
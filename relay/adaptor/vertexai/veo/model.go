@@ -46,11 +46,28 @@ type PollVideoTaskResponse struct {
 	Name     string                    `json:"name"`
 	Done     bool                      `json:"done"`
 	Response PollVideoTaskResponseData `json:"response"`
+	// Error is set when the operation finished unsuccessfully.
+	Error *PollVideoTaskError `json:"error,omitempty"`
+}
+
+type PollVideoTaskError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
 type PollVideoTaskResponseData struct {
 	Type             string            `json:"@type"`
 	GeneratedSamples []GeneratedSample `json:"generatedSamples"`
+	// Videos is returned by fetchPredictOperation, either inline or as a Cloud Storage URI
+	// when StorageUri was set on the request.
+	Videos                []GeneratedVideo `json:"videos"`
+	RaiMediaFilteredCount int              `json:"raiMediaFilteredCount"`
+}
+
+type GeneratedVideo struct {
+	GcsUri             string `json:"gcsUri"`
+	BytesBase64Encoded string `json:"bytesBase64Encoded"`
+	MimeType           string `json:"mimeType"`
 }
 
 type GeneratedSample struct {
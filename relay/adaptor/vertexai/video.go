@@ -0,0 +1,205 @@
+package vertexai
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common/client"
+	imgutil "github.com/songquanpeng/one-api/common/image"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai/veo"
+	"github.com/songquanpeng/one-api/relay/meta"
+	"github.com/songquanpeng/one-api/relay/model"
+)
+
+var _ adaptor.VideoAdaptor = new(Adaptor)
+
+// defaultVeoVideoSeconds is the clip length Veo generates when no duration is requested.
+const defaultVeoVideoSeconds = 8
+
+// CreateVideo starts a Veo predictLongRunning operation and returns its operation name as
+// the upstream id.
+//
+//   - https://cloud.google.com/vertex-ai/generative-ai/docs/model-reference/veo-video-generation
+func (a *Adaptor) CreateVideo(ctx context.Context, meta *meta.Meta, request *model.VideoRequest) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	if meta.Config.VertexAIProjectID == "" {
+		return nil, openai.ErrorWrapper(errors.New("VertexAI project ID is required but not configured for channel"),
+			"invalid_channel_config", http.StatusInternalServerError)
+	}
+
+	duration := int(request.Seconds)
+	if duration <= 0 {
+		duration = defaultVeoVideoSeconds
+	}
+	veoRequest := &veo.CreateVideoRequest{
+		Instances: []veo.CreateVideoInstance{{Prompt: request.Prompt}},
+		Parameters: veo.CreateVideoParameters{
+			SampleCount:     1,
+			DurationSeconds: &duration,
+		},
+	}
+	if aspectRatio := request.AspectRatio(); aspectRatio != "" {
+		veoRequest.Parameters.AspectRatio = &aspectRatio
+	}
+	if request.InputReference != "" {
+		mimeType, data, err := imgutil.GetImageFromUrl(request.InputReference)
+		if err != nil {
+			return nil, openai.ErrorWrapper(err, "invalid_input_reference", http.StatusBadRequest)
+		}
+		veoRequest.Instances[0].Image = &veo.CreateVideoInstanceImage{BytesBase64Encoded: data}
+		if mimeType != "" {
+			veoRequest.Instances[0].Image.MimeType = &mimeType
+		}
+	}
+
+	baseHost, location := a.getDefaultHostAndLocation(meta)
+	requestURL := fmt.Sprintf("https://%s/v1/projects/%s/locations/%s/publishers/google/models/%s:predictLongRunning",
+		baseHost, meta.Config.VertexAIProjectID, location, meta.ActualModelName)
+
+	task := &veo.CreateVideoTaskResponse{}
+	if bizErr := a.doVideoRequest(ctx, meta, requestURL, veoRequest, task); bizErr != nil {
+		return nil, bizErr
+	}
+	if task.Name == "" {
+		return nil, openai.ErrorWrapper(errors.New("Veo returned no operation name"), "invalid_upstream_response", http.StatusBadGateway)
+	}
+	return &model.VideoJobStatus{
+		UpstreamId: task.Name,
+		Status:     model.VideoStatusQueued,
+		Seconds:    duration,
+	}, nil
+}
+
+// GetVideo polls the Veo operation with fetchPredictOperation.
+func (a *Adaptor) GetVideo(ctx context.Context, meta *meta.Meta, upstreamId string) (*model.VideoJobStatus, *model.ErrorWithStatusCode) {
+	operation, bizErr := a.fetchVideoOperation(ctx, meta, upstreamId)
+	if bizErr != nil {
+		return nil, bizErr
+	}
+
+	status := &model.VideoJobStatus{UpstreamId: upstreamId, Status: model.VideoStatusInProgress}
+	switch {
+	case !operation.Done:
+	case operation.Error != nil:
+		status.Status = model.VideoStatusFailed
+		status.Error = operation.Error.Message
+	case len(operation.Response.Videos) == 0:
+		status.Status = model.VideoStatusFailed
+		status.Error = "no video was generated"
+		if operation.Response.RaiMediaFilteredCount > 0 {
+			status.Error = "the generated video was blocked by safety filters"
+		}
+	default:
+		status.Status = model.VideoStatusCompleted
+		status.Progress = 100
+	}
+	return status, nil
+}
+
+// GetVideoContent returns the first video of a finished Veo operation, decoding inline bytes
+// or downloading it from Cloud Storage.
+func (a *Adaptor) GetVideoContent(ctx context.Context, meta *meta.Meta, upstreamId string) (io.ReadCloser, string, *model.ErrorWithStatusCode) {
+	operation, bizErr := a.fetchVideoOperation(ctx, meta, upstreamId)
+	if bizErr != nil {
+		return nil, "", bizErr
+	}
+	if !operation.Done || len(operation.Response.Videos) == 0 {
+		return nil, "", openai.ErrorWrapper(errors.New("video is not available"), "video_not_ready", http.StatusNotFound)
+	}
+
+	video := operation.Response.Videos[0]
+	mimeType := video.MimeType
+	if mimeType == "" {
+		mimeType = "video/mp4"
+	}
+	if video.BytesBase64Encoded != "" {
+		raw, err := base64.StdEncoding.DecodeString(video.BytesBase64Encoded)
+		if err != nil {
+			return nil, "", openai.ErrorWrapper(err, "decode_video_failed", http.StatusBadGateway)
+		}
+		return io.NopCloser(bytes.NewReader(raw)), mimeType, nil
+	}
+
+	bucket, object, ok := strings.Cut(strings.TrimPrefix(video.GcsUri, "gs://"), "/")
+	if !ok || !strings.HasPrefix(video.GcsUri, "gs://") {
+		return nil, "", openai.ErrorWrapper(errors.Errorf("unsupported video uri %q", video.GcsUri), "invalid_upstream_response", http.StatusBadGateway)
+	}
+	downloadURL := fmt.Sprintf("https://storage.googleapis.com/storage/v1/b/%s/o/%s?alt=media", bucket, url.PathEscape(object))
+	resp, bizErr := a.sendVideoRequest(ctx, meta, http.MethodGet, downloadURL, nil)
+	if bizErr != nil {
+		return nil, "", bizErr
+	}
+	return resp.Body, mimeType, nil
+}
+
+// fetchVideoOperation returns the current state of a Veo operation. The operation name has
+// the form projects/{p}/locations/{l}/publishers/google/models/{m}/operations/{id}.
+func (a *Adaptor) fetchVideoOperation(ctx context.Context, meta *meta.Meta, operationName string) (*veo.PollVideoTaskResponse, *model.ErrorWithStatusCode) {
+	modelPath, _, ok := strings.Cut(operationName, "/operations/")
+	if !ok {
+		return nil, openai.ErrorWrapper(errors.Errorf("invalid Veo operation name %q", operationName), "invalid_upstream_id", http.StatusInternalServerError)
+	}
+	baseHost, _ := a.getDefaultHostAndLocation(meta)
+	requestURL := fmt.Sprintf("https://%s/v1/%s:fetchPredictOperation", baseHost, modelPath)
+
+	operation := &veo.PollVideoTaskResponse{}
+	if bizErr := a.doVideoRequest(ctx, meta, requestURL, veo.PollVideoTaskRequest{OperationName: operationName}, operation); bizErr != nil {
+		return nil, bizErr
+	}
+	return operation, nil
+}
+
+// doVideoRequest POSTs payload as JSON and decodes the response into out.
+func (a *Adaptor) doVideoRequest(ctx context.Context, meta *meta.Meta, requestURL string, payload, out any) *model.ErrorWithStatusCode {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	resp, bizErr := a.sendVideoRequest(ctx, meta, http.MethodPost, requestURL, bytes.NewReader(body))
+	if bizErr != nil {
+		return bizErr
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return openai.ErrorWrapper(err, "unmarshal_response_body_failed", http.StatusBadGateway)
+	}
+	return nil
+}
+
+// sendVideoRequest sends an authorized request and returns the successful response.
+func (a *Adaptor) sendVideoRequest(ctx context.Context, meta *meta.Meta, method, requestURL string, body io.Reader) (*http.Response, *model.ErrorWithStatusCode) {
+	token, err := getToken(ctx, meta.ChannelId, meta.Config.VertexAIADC)
+	if err != nil {
+		return nil, openai.ErrorWrapper(errors.Wrap(err, "get Vertex AI token"), "get_token_failed", http.StatusInternalServerError)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusBadGateway)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		payload, _ := io.ReadAll(resp.Body)
+		return nil, openai.ErrorWrapper(errors.Errorf("Vertex AI returned status %d: %s", resp.StatusCode, payload),
+			"veo_api_error", resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+// Package affinity keeps requests that share an upstream prompt cache on the same channel.
+//
+// Anthropic and OpenAI only reuse a cached prompt prefix when the follow-up request reaches
+// the same upstream key (and region), so picking a random channel per request throws most
+// cache hits away. A request is bound to the channel that last served the same session,
+// prompt_cache_key, cacheable prefix or end user until the binding idles out.
+package affinity
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// HeaderSessionId lets clients pin a conversation to one channel explicitly.
+const HeaderSessionId = "X-Session-Id"
+
+// Sources an affinity key can be derived from, strongest signal first.
+const (
+	SourceSession        = "session"
+	SourcePromptCacheKey = "prompt_cache_key"
+	SourcePrefix         = "prefix"
+	SourceUser           = "user"
+)
+
+// keyPrefix namespaces the bindings in Redis.
+const keyPrefix = "prompt_affinity:"
+
+// Supports reports whether requests of the relay mode benefit from prompt caching.
+func Supports(relayMode int) bool {
+	switch relayMode {
+	case relaymode.ChatCompletions, relaymode.Completions, relaymode.ResponseAPI, relaymode.ClaudeMessages:
+		return true
+	default:
+		return false
+	}
+}
+
+// cacheableRequest holds the fields of chat, Claude Messages and Response API requests that
+// identify a cacheable conversation.
+type cacheableRequest struct {
+	System         json.RawMessage   `json:"system"`
+	Instructions   json.RawMessage   `json:"instructions"`
+	Tools          json.RawMessage   `json:"tools"`
+	Messages       []json.RawMessage `json:"messages"`
+	PromptCacheKey string            `json:"prompt_cache_key"`
+	User           string            `json:"user"`
+	Metadata       json.RawMessage   `json:"metadata"`
+}
+
+type requestMessage struct {
+	Role string `json:"role"`
+}
+
+// Key derives the affinity key of a request, scoped to the user, group and model so that
+// bindings never leak across tenants or to channels that do not serve the model. It returns
+// an empty key when the request carries nothing worth pinning.
+func Key(header http.Header, body []byte, userId int, group string, model string) (key string, source string) {
+	value, source := keySource(header, body)
+	if value == "" {
+		return "", ""
+	}
+	h := sha256.New()
+	for _, part := range []string{strconv.Itoa(userId), group, model, source, value} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return keyPrefix + hex.EncodeToString(h.Sum(nil)), source
+}
+
+func keySource(header http.Header, body []byte) (string, string) {
+	if session := strings.TrimSpace(header.Get(HeaderSessionId)); session != "" {
+		return session, SourceSession
+	}
+
+	var req cacheableRequest
+	if len(body) == 0 || json.Unmarshal(body, &req) != nil {
+		return "", ""
+	}
+	if key := strings.TrimSpace(req.PromptCacheKey); key != "" {
+		return key, SourcePromptCacheKey
+	}
+	if prefix := cacheablePrefix(&req); prefix != "" {
+		return prefix, SourcePrefix
+	}
+	if user := strings.TrimSpace(req.User); user != "" {
+		return user, SourceUser
+	}
+	// Claude Messages identifies the end user in metadata.user_id
+	var metadata struct {
+		UserId string `json:"user_id"`
+	}
+	if len(req.Metadata) > 0 && json.Unmarshal(req.Metadata, &metadata) == nil {
+		if user := strings.TrimSpace(metadata.UserId); user != "" {
+			return user, SourceUser
+		}
+	}
+	return "", ""
+}
+
+// cacheablePrefix returns the part of the request upstream prompt caches key on: the system
+// prompt, instructions and tools, the leading system/developer messages, and every message
+// up to the last one carrying a cache_control breakpoint. It returns an empty string when
+// the request has none of these.
+func cacheablePrefix(req *cacheableRequest) string {
+	var prefix bytes.Buffer
+	for _, part := range []json.RawMessage{req.System, req.Instructions, req.Tools} {
+		if part = bytes.TrimSpace(part); len(part) > 0 && !bytes.Equal(part, []byte("null")) {
+			prefix.Write(part)
+			prefix.WriteByte(0)
+		}
+	}
+
+	lastBreakpoint := -1
+	for i, raw := range req.Messages {
+		if bytes.Contains(raw, []byte(`"cache_control"`)) {
+			lastBreakpoint = i
+		}
+	}
+	for i, raw := range req.Messages {
+		if i > lastBreakpoint {
+			var msg requestMessage
+			if json.Unmarshal(raw, &msg) != nil || (msg.Role != "system" && msg.Role != "developer") {
+				break
+			}
+		}
+		prefix.Write(raw)
+		prefix.WriteByte(0)
+	}
+	return prefix.String()
+}
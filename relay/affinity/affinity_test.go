@@ -0,0 +1,83 @@
+package affinity
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySources(t *testing.T) {
+	t.Parallel()
+
+	claude := []byte(`{"model":"claude-sonnet-4","system":[{"type":"text","text":"You are a lawyer.","cache_control":{"type":"ephemeral"}}],` +
+		`"messages":[{"role":"user","content":"first question"}],"metadata":{"user_id":"u-1"}}`)
+	followUp := []byte(`{"model":"claude-sonnet-4","system":[{"type":"text","text":"You are a lawyer.","cache_control":{"type":"ephemeral"}}],` +
+		`"messages":[{"role":"user","content":"first question"},{"role":"assistant","content":"answer"},{"role":"user","content":"next"}],"metadata":{"user_id":"u-1"}}`)
+
+	key, source := Key(http.Header{}, claude, 1, "default", "claude-sonnet-4")
+	require.Equal(t, SourcePrefix, source)
+	followKey, _ := Key(http.Header{}, followUp, 1, "default", "claude-sonnet-4")
+	require.Equal(t, key, followKey, "the conversation tail must not change the prefix key")
+
+	otherUser, _ := Key(http.Header{}, claude, 2, "default", "claude-sonnet-4")
+	require.NotEqual(t, key, otherUser)
+
+	header := http.Header{}
+	header.Set(HeaderSessionId, "conv-42")
+	_, source = Key(header, claude, 1, "default", "claude-sonnet-4")
+	require.Equal(t, SourceSession, source)
+
+	_, source = Key(http.Header{}, []byte(`{"prompt_cache_key":"tenant-a","messages":[{"role":"system","content":"hi"}]}`), 1, "default", "gpt-4o")
+	require.Equal(t, SourcePromptCacheKey, source)
+
+	_, source = Key(http.Header{}, []byte(`{"messages":[{"role":"user","content":"hi"}],"user":"end-user"}`), 1, "default", "gpt-4o")
+	require.Equal(t, SourceUser, source)
+
+	key, source = Key(http.Header{}, []byte(`{"messages":[{"role":"user","content":"hi"}]}`), 1, "default", "gpt-4o")
+	require.Empty(t, key)
+	require.Empty(t, source)
+}
+
+func TestCacheablePrefixStopsAtLastBreakpoint(t *testing.T) {
+	t.Parallel()
+
+	base := `{"messages":[{"role":"system","content":"rules"},` +
+		`{"role":"user","content":[{"type":"text","text":"long document","cache_control":{"type":"ephemeral"}}]},`
+	a, _ := Key(http.Header{}, []byte(base+`{"role":"user","content":"question a"}]}`), 1, "default", "claude-sonnet-4")
+	b, _ := Key(http.Header{}, []byte(base+`{"role":"user","content":"question b"}]}`), 1, "default", "claude-sonnet-4")
+	require.Equal(t, a, b)
+
+	c, _ := Key(http.Header{}, []byte(`{"messages":[{"role":"system","content":"rules"},`+
+		`{"role":"user","content":[{"type":"text","text":"another document","cache_control":{"type":"ephemeral"}}]}]}`), 1, "default", "claude-sonnet-4")
+	require.NotEqual(t, a, c)
+}
+
+func TestMemoryBindings(t *testing.T) {
+	t.Parallel()
+
+	m := &memoryBindings{entries: map[string]memoryBinding{}}
+	now := time.Now()
+	m.set("a", 7, 70, time.Minute, 2, now)
+	channelId, keyId := m.get("a", now)
+	require.Equal(t, 7, channelId)
+	require.Equal(t, 70, keyId, "the pooled key is bound along with the channel")
+	channelId, _ = m.get("a", now.Add(2*time.Minute))
+	require.Zero(t, channelId)
+
+	m.set("a", 7, 0, time.Minute, 2, now)
+	m.remove("a", 8) // bound to another channel: kept
+	channelId, _ = m.get("a", now)
+	require.Equal(t, 7, channelId)
+	m.remove("a", 7)
+	channelId, _ = m.get("a", now)
+	require.Zero(t, channelId)
+
+	m.set("a", 1, 0, time.Minute, 2, now)
+	m.set("b", 2, 0, time.Minute, 2, now)
+	m.set("c", 3, 0, time.Minute, 2, now)
+	require.Len(t, m.entries, 2)
+	channelId, _ = m.get("c", now)
+	require.Equal(t, 3, channelId)
+}
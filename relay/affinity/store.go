@@ -0,0 +1,118 @@
+package affinity
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+)
+
+// Lookup returns the channel the key is bound to, or 0 when it is unbound or expired, and
+// the pooled key of the channel that served it, 0 for single-key channels.
+func Lookup(ctx context.Context, key string) (channelId int, keyId int) {
+	if !common.IsRedisEnabled() {
+		return localBindings.get(key, time.Now())
+	}
+	raw, err := common.RedisGet(ctx, key)
+	if err != nil {
+		return 0, 0
+	}
+	channel, pooledKey, _ := strings.Cut(raw, ":")
+	channelId, _ = strconv.Atoi(channel)
+	keyId, _ = strconv.Atoi(pooledKey)
+	return channelId, keyId
+}
+
+// Bind routes the key to the channel, and to the channel's pooled key keyId, for the next
+// PromptCacheAffinityTTL seconds. Upstream prompt caches are scoped per api key, so a
+// multi-key channel has to keep serving the conversation with the same key.
+func Bind(ctx context.Context, key string, channelId int, keyId int) error {
+	ttl := time.Duration(config.PromptCacheAffinityTTLSec) * time.Second
+	if !common.IsRedisEnabled() {
+		localBindings.set(key, channelId, keyId, ttl, config.PromptCacheAffinityMemoryMaxEntries, time.Now())
+		return nil
+	}
+	value := strconv.Itoa(channelId) + ":" + strconv.Itoa(keyId)
+	if err := common.RedisSet(ctx, key, value, ttl); err != nil {
+		return errors.Wrap(err, "bind prompt cache affinity")
+	}
+	return nil
+}
+
+// Forget drops the binding if it still points at the channel, so a failing channel stops
+// attracting the conversation while a binding renewed by another request survives.
+func Forget(ctx context.Context, key string, channelId int) error {
+	if !common.IsRedisEnabled() {
+		localBindings.remove(key, channelId)
+		return nil
+	}
+	if bound, _ := Lookup(ctx, key); bound != channelId {
+		return nil
+	}
+	if err := common.RedisDel(ctx, key); err != nil {
+		return errors.Wrap(err, "forget prompt cache affinity")
+	}
+	return nil
+}
+
+// memoryBindings keeps bindings in process when Redis is not available.
+type memoryBindings struct {
+	mu      sync.Mutex
+	entries map[string]memoryBinding
+}
+
+type memoryBinding struct {
+	channelId int
+	keyId     int
+	expiresAt time.Time
+}
+
+var localBindings = &memoryBindings{entries: map[string]memoryBinding{}}
+
+func (m *memoryBindings) get(key string, now time.Time) (channelId int, keyId int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	binding, ok := m.entries[key]
+	if !ok {
+		return 0, 0
+	}
+	if now.After(binding.expiresAt) {
+		delete(m.entries, key)
+		return 0, 0
+	}
+	return binding.channelId, binding.keyId
+}
+
+func (m *memoryBindings) set(key string, channelId int, keyId int, ttl time.Duration, maxEntries int, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[key]; !exists && maxEntries > 0 && len(m.entries) >= maxEntries {
+		for k, binding := range m.entries {
+			if now.After(binding.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+		// still full: evict an arbitrary binding
+		for k := range m.entries {
+			if len(m.entries) < maxEntries {
+				break
+			}
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryBinding{channelId: channelId, keyId: keyId, expiresAt: now.Add(ttl)}
+}
+
+func (m *memoryBindings) remove(key string, channelId int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if binding, ok := m.entries[key]; ok && binding.channelId == channelId {
+		delete(m.entries, key)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/common/metrics"
 	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/hedge"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
 )
 
 // PostConsumeQuotaWithLog is the unified billing entry that consumes quota, updates caches,
@@ -41,6 +43,17 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 		return
 	}
 
+	// Only the winner of a hedged request is charged to the user
+	if attempt := hedge.AttemptFromContext(ctx); attempt != nil && attempt.Hedged() {
+		if attempt.Lost(ctx) {
+			recordLostHedgeAttempt(ctx, tokenId, quotaDelta, totalQuota, logEntry)
+			return
+		}
+		logEntry.Metadata = model.AppendHedgeMetadata(logEntry.Metadata, "won", 0)
+	}
+
+	logEntry.Metadata = model.AppendPricingRuleMetadata(logEntry.Metadata, pricingrule.FromContext(ctx))
+
 	// Consume remaining quota
 	if err := model.PostConsumeTokenQuota(ctx, tokenId, quotaDelta); err != nil {
 		logger.Logger.Error("CRITICAL: upstream request was sent but billing failed - unbilled request detected",
@@ -54,6 +67,11 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 		metrics.GlobalRecorder.RecordBillingError("database_error", "post_consume_token_quota_with_log", logEntry.UserId, logEntry.ChannelId, logEntry.ModelName)
 		billingSuccess = false
 	}
+	if err := model.RecordTokenMinuteUsage(ctx, tokenId, int64(logEntry.PromptTokens+logEntry.CompletionTokens)); err != nil {
+		logger.Logger.Warn("failed to record token per-minute usage",
+			zap.Error(err),
+			zap.Int("tokenId", tokenId))
+	}
 	if err := model.CacheUpdateUserQuota(ctx, logEntry.UserId); err != nil {
 		logger.Logger.Warn("user quota cache update failed - billing completed successfully",
 			zap.Error(err),
@@ -68,6 +86,7 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 
 	// Force quota onto log entry for consistency
 	logEntry.Quota = int(totalQuota)
+	logEntry.TokenId = tokenId
 	model.RecordConsumeLog(ctx, logEntry)
 
 	// Update aggregates only when there is actual consumption.
@@ -89,6 +108,32 @@ func PostConsumeQuotaWithLog(ctx context.Context, tokenId int, quotaDelta int64,
 	metrics.GlobalRecorder.RecordBillingOperation(billingStartTime, "post_consume_with_log", billingSuccess, logEntry.UserId, logEntry.ChannelId, logEntry.ModelName, float64(totalQuota))
 }
 
+// recordLostHedgeAttempt gives back what a hedged attempt that lost the race pre-consumed
+// from the token, and records its upstream cost in a hedge log and the channel's used quota
+// instead of the user's.
+func recordLostHedgeAttempt(ctx context.Context, tokenId int, quotaDelta int64, totalQuota int64, logEntry *model.Log) {
+	// the attempt has been charged totalQuota-quotaDelta so far
+	if refund := quotaDelta - totalQuota; refund != 0 {
+		if err := model.PostConsumeTokenQuota(ctx, tokenId, refund); err != nil {
+			logger.Logger.Error("failed to refund lost hedged attempt",
+				zap.Error(err),
+				zap.Int("tokenId", tokenId),
+				zap.Int64("refund", refund))
+		}
+		if err := model.CacheUpdateUserQuota(ctx, logEntry.UserId); err != nil {
+			logger.Logger.Warn("user quota cache update failed after refunding lost hedged attempt",
+				zap.Error(err),
+				zap.Int("userId", logEntry.UserId))
+		}
+	}
+
+	logEntry.Quota = int(totalQuota)
+	model.RecordHedgeLog(ctx, logEntry, "lost")
+	if totalQuota > 0 {
+		model.UpdateChannelUsedQuota(logEntry.ChannelId, totalQuota)
+	}
+}
+
 func ReturnPreConsumedQuota(ctx context.Context, preConsumedQuota int64, tokenId int) {
 	if preConsumedQuota == 0 {
 		return
@@ -82,6 +82,9 @@ func (m *MockMetricsRecorder) UpdateChannelMetrics(channelId int, channelName, c
 }
 func (m *MockMetricsRecorder) UpdateChannelRequestsInFlight(channelId int, channelName, channelType string, delta float64) {
 }
+func (m *MockMetricsRecorder) GetChannelRequestsInFlight(channelId int, channelName, channelType string) float64 {
+	return 0
+}
 func (m *MockMetricsRecorder) RecordUserMetrics(userId, username, group string, quotaUsed float64, promptTokens, completionTokens int, balance float64) {
 }
 func (m *MockMetricsRecorder) RecordDBQuery(startTime time.Time, operation, table string, success bool) {
@@ -96,6 +99,12 @@ func (m *MockMetricsRecorder) UpdateActiveTokens(userId, tokenName string, count
 func (m *MockMetricsRecorder) RecordError(errorType, component string)                              {}
 func (m *MockMetricsRecorder) RecordModelUsage(modelName, channelType string, latency time.Duration) {
 }
+func (m *MockMetricsRecorder) RecordResponseCache(relayMode, result string) {
+}
+func (m *MockMetricsRecorder) RecordPromptCacheAffinity(source, result string, promptTokens, cachedPromptTokens int) {
+}
+func (m *MockMetricsRecorder) RecordCircuitBreakerTransition(channelId int, model, from, to string) {
+}
 func (m *MockMetricsRecorder) UpdateBillingStats(totalBillingOperations, successfulBillingOperations, failedBillingOperations int64) {
 }
 func (m *MockMetricsRecorder) InitSystemMetrics(version, buildTime, goVersion string, startTime time.Time) {
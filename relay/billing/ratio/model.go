@@ -43,6 +43,17 @@ var AudioRatio = map[string]float64{
 	"gpt-4o-mini-audio-preview-2024-12-17": 10 / 0.15,
 	"gpt-4o-transcribe":                    6 / 2.5,
 	"gpt-4o-mini-transcribe":               3 / 1.25,
+	// realtime: audio input price / text input price
+	"gpt-realtime":                            32.0 / 4,
+	"gpt-realtime-2025-08-28":                 32.0 / 4,
+	"gpt-realtime-mini":                       10 / 0.6,
+	"gpt-realtime-mini-2025-10-06":            10 / 0.6,
+	"gpt-4o-realtime-preview":                 40.0 / 5,
+	"gpt-4o-realtime-preview-2025-06-03":      40.0 / 5,
+	"gpt-4o-realtime-preview-2024-12-17":      40.0 / 5,
+	"gpt-4o-realtime-preview-2024-10-01":      100.0 / 5,
+	"gpt-4o-mini-realtime-preview":            10 / 0.6,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 10 / 0.6,
 }
 
 // GetAudioPromptRatio returns the audio prompt ratio for the given model.
@@ -65,6 +76,17 @@ var AudioCompletionRatio = map[string]float64{
 	"gpt-4o-audio-preview-2024-10-01":      2,
 	"gpt-4o-mini-audio-preview":            2,
 	"gpt-4o-mini-audio-preview-2024-12-17": 2,
+	// realtime: audio output price / audio input price
+	"gpt-realtime":                            2,
+	"gpt-realtime-2025-08-28":                 2,
+	"gpt-realtime-mini":                       2,
+	"gpt-realtime-mini-2025-10-06":            2,
+	"gpt-4o-realtime-preview":                 2,
+	"gpt-4o-realtime-preview-2025-06-03":      2,
+	"gpt-4o-realtime-preview-2024-12-17":      2,
+	"gpt-4o-realtime-preview-2024-10-01":      2,
+	"gpt-4o-mini-realtime-preview":            2,
+	"gpt-4o-mini-realtime-preview-2024-12-17": 2,
 }
 
 // GetAudioCompletionRatio returns the completion ratio for audio models.
@@ -1,6 +1,10 @@
 package channeltype
 
-import "github.com/songquanpeng/one-api/relay/apitype"
+import (
+	"slices"
+
+	"github.com/songquanpeng/one-api/relay/apitype"
+)
 
 func ToAPIType(channelType int) int {
 	apiType := apitype.OpenAI
@@ -176,3 +180,17 @@ func IdToName(channelType int) string {
 		return "unknown"
 	}
 }
+
+// BatchChannelTypes lists the channel types whose upstream exposes an OpenAI, Azure
+// or Anthropic style Files/Batch API that the batch relay can proxy to.
+var BatchChannelTypes = []int{
+	OpenAI,
+	OpenAICompatible,
+	Azure,
+	Anthropic,
+}
+
+// SupportsBatch reports whether channels of channelType can serve the Files/Batch relay.
+func SupportsBatch(channelType int) bool {
+	return slices.Contains(BatchChannelTypes, channelType)
+}
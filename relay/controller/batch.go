@@ -0,0 +1,721 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/quota"
+)
+
+const (
+	// defaultAzureBatchAPIVersion is used when an Azure channel has no api version configured.
+	// Files and Batch APIs are GA since this version.
+	defaultAzureBatchAPIVersion = "2024-10-21"
+	anthropicAPIVersion         = "2023-06-01"
+)
+
+// batchUpstream describes how to reach the Files and Batch APIs of one channel.
+type batchUpstream struct {
+	channelType int
+	baseURL     string
+	apiKey      string
+	apiVersion  string
+}
+
+func newBatchUpstream(channelType int, baseURL string, apiKey string, apiVersion string) *batchUpstream {
+	if channelType == channeltype.Azure && apiVersion == "" {
+		apiVersion = defaultAzureBatchAPIVersion
+	}
+	return &batchUpstream{
+		channelType: channelType,
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		apiKey:      apiKey,
+		apiVersion:  apiVersion,
+	}
+}
+
+// batchUpstreamFromChannel builds the upstream for background work without a request context.
+// On a multi-key channel it reuses the pooled key keyId that created the batch, because the
+// batch may only be visible to that key; a new key is selected only when keyId is unknown.
+func batchUpstreamFromChannel(channel *model.Channel, keyId int) (*batchUpstream, error) {
+	key := channel.Key
+	if channel.IsMultiKey() {
+		selected, err := batchChannelKey(channel, keyId)
+		if err != nil {
+			return nil, errors.Wrap(err, "select channel key")
+		}
+		key = selected.Key
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "load channel config")
+	}
+	apiVersion := cfg.APIVersion
+	if apiVersion == "" && channel.Other != nil && channel.Type == channeltype.Azure {
+		apiVersion = *channel.Other
+	}
+	return newBatchUpstream(channel.Type, channel.GetBaseURL(), key, apiVersion), nil
+}
+
+func batchChannelKey(channel *model.Channel, keyId int) (*model.ChannelKey, error) {
+	if keyId == 0 {
+		return model.SelectChannelKey(channel)
+	}
+	key, err := model.GetChannelKeyById(keyId)
+	if err != nil {
+		return nil, errors.Wrap(err, "load batch channel key")
+	}
+	if key.ChannelId != channel.Id {
+		return nil, errors.Errorf("key %d does not belong to channel %d", keyId, channel.Id)
+	}
+	return key, nil
+}
+
+func (u *batchUpstream) isAnthropic() bool {
+	return u.channelType == channeltype.Anthropic
+}
+
+// url maps an OpenAI style path (e.g. "/batches/batch_x") to the provider specific URL.
+func (u *batchUpstream) url(path string) string {
+	switch u.channelType {
+	case channeltype.Azure:
+		return fmt.Sprintf("%s/openai%s?api-version=%s", u.baseURL, path, u.apiVersion)
+	case channeltype.Anthropic:
+		return u.baseURL + "/v1/messages" + path
+	default:
+		return u.baseURL + "/v1" + path
+	}
+}
+
+func (u *batchUpstream) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.url(path), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "build upstream request")
+	}
+	switch u.channelType {
+	case channeltype.Azure:
+		req.Header.Set("api-key", u.apiKey)
+	case channeltype.Anthropic:
+		req.Header.Set("x-api-key", u.apiKey)
+		req.Header.Set("anthropic-version", anthropicAPIVersion)
+	default:
+		req.Header.Set("Authorization", "Bearer "+u.apiKey)
+	}
+	return req, nil
+}
+
+func (u *batchUpstream) do(req *http.Request) (*http.Response, error) {
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "perform upstream request")
+	}
+	return resp, nil
+}
+
+func batchUpstreamFromContext(c *gin.Context) *batchUpstream {
+	meta := metalib.GetByContext(c)
+	return newBatchUpstream(meta.ChannelType, meta.BaseURL, meta.APIKey, meta.Config.APIVersion)
+}
+
+// relayBatchPassthrough forwards the request to path on the pinned channel and, on success,
+// returns the upstream body so callers can inspect it before it is written to the client.
+func relayBatchPassthrough(c *gin.Context, up *batchUpstream, method string, path string, body io.Reader, contentType string) ([]byte, *http.Response, *relaymodel.ErrorWithStatusCode) {
+	req, err := up.newRequest(gmw.Ctx(c), method, path, body)
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "build_request_failed", http.StatusInternalServerError)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := up.do(req)
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, RelayErrorHandlerWithContext(c, resp)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	return respBody, resp, nil
+}
+
+func writeBatchResponse(c *gin.Context, resp *http.Response, body []byte) {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	c.Data(resp.StatusCode, contentType, body)
+}
+
+// RelayFileUploadHelper handles POST /v1/files and pins the new file to the selected channel.
+func RelayFileUploadHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	up := batchUpstreamFromContext(c)
+	if up.isAnthropic() {
+		return openai.ErrorWrapper(errors.New("file uploads are not supported for Anthropic channels, submit batch requests inline"), "unsupported_channel", http.StatusBadRequest)
+	}
+
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	respBody, resp, bizErr := relayBatchPassthrough(c, up, http.MethodPost, "/files", bytes.NewReader(requestBody), c.Request.Header.Get("Content-Type"))
+	if bizErr != nil {
+		return bizErr
+	}
+
+	var file struct {
+		Id       string `json:"id"`
+		Bytes    int64  `json:"bytes"`
+		Filename string `json:"filename"`
+		Purpose  string `json:"purpose"`
+	}
+	if err = json.Unmarshal(respBody, &file); err != nil {
+		return openai.ErrorWrapper(errors.Wrap(err, "parse upstream file object"), "invalid_upstream_response", http.StatusBadGateway)
+	}
+	if file.Id == "" {
+		return openai.ErrorWrapper(errors.New("upstream file object has no id"), "invalid_upstream_response", http.StatusBadGateway)
+	}
+
+	if err = model.CreateUpstreamFile(ctx, &model.UpstreamFile{
+		FileId:       file.Id,
+		UserId:       c.GetInt(ctxkey.Id),
+		TokenId:      c.GetInt(ctxkey.TokenId),
+		ChannelId:    c.GetInt(ctxkey.ChannelId),
+		ChannelKeyId: c.GetInt(ctxkey.ChannelKeyId),
+		Purpose:      file.Purpose,
+		Filename:     file.Filename,
+		Bytes:        file.Bytes,
+	}); err != nil {
+		return openai.ErrorWrapper(err, "save_file_failed", http.StatusInternalServerError)
+	}
+
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// RelayFileRetrieveHelper handles GET /v1/files/:id.
+func RelayFileRetrieveHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	respBody, resp, bizErr := relayBatchPassthrough(c, batchUpstreamFromContext(c), http.MethodGet, "/files/"+c.Param("id"), nil, "")
+	if bizErr != nil {
+		return bizErr
+	}
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// RelayFileContentHelper handles GET /v1/files/:id/content.
+func RelayFileContentHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	respBody, resp, bizErr := relayBatchPassthrough(c, batchUpstreamFromContext(c), http.MethodGet, "/files/"+c.Param("id")+"/content", nil, "")
+	if bizErr != nil {
+		return bizErr
+	}
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// RelayFileDeleteHelper handles DELETE /v1/files/:id and drops the pin once the upstream deleted it.
+func RelayFileDeleteHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	fileId := c.Param("id")
+	respBody, resp, bizErr := relayBatchPassthrough(c, batchUpstreamFromContext(c), http.MethodDelete, "/files/"+fileId, nil, "")
+	if bizErr != nil {
+		return bizErr
+	}
+
+	if file, err := model.GetUpstreamFileByUser(ctx, c.GetInt(ctxkey.Id), fileId); err == nil {
+		if err = model.DeleteUpstreamFile(ctx, file.Id); err != nil {
+			gmw.GetLogger(c).Warn("failed to delete upstream file pin", zap.String("file_id", fileId), zap.Error(err))
+		}
+	}
+
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// batchObject is the subset of the OpenAI/Azure and Anthropic batch objects the relay needs.
+type batchObject struct {
+	Id               string `json:"id"`
+	Status           string `json:"status"`
+	ProcessingStatus string `json:"processing_status"`
+	OutputFileId     string `json:"output_file_id"`
+	InputFileId      string `json:"input_file_id"`
+	Endpoint         string `json:"endpoint"`
+}
+
+// status normalizes the OpenAI "status" and Anthropic "processing_status" fields.
+func (b *batchObject) status() string {
+	if b.Status != "" {
+		return b.Status
+	}
+	return b.ProcessingStatus
+}
+
+// isTerminalBatchStatus reports whether the upstream will not produce further output.
+func isTerminalBatchStatus(status string) bool {
+	switch status {
+	case "completed", "failed", "expired", "cancelled", "ended":
+		return true
+	default:
+		return false
+	}
+}
+
+// RelayBatchCreateHelper handles POST /v1/batches. It holds BatchPreConsumeQuota through a
+// pending TokenTransaction that is reconciled once the batch output is complete.
+func RelayBatchCreateHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	lg := gmw.GetLogger(c)
+	meta := metalib.GetByContext(c)
+	up := batchUpstreamFromContext(c)
+	// file based batches are pinned to a batch capable channel by their input file, inline
+	// Anthropic batches are routed by model and may land on any channel type
+	if !channeltype.SupportsBatch(up.channelType) {
+		return openai.ErrorWrapper(errors.Errorf("channel type %s does not support batches", channeltype.IdToName(up.channelType)), "unsupported_channel", http.StatusBadRequest)
+	}
+
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+
+	preQuota := max(config.BatchPreConsumeQuota, 0)
+	if err = model.PreConsumeTokenQuota(ctx, meta.TokenId, preQuota); err != nil {
+		return openai.ErrorWrapper(err, "insufficient_quota", http.StatusForbidden)
+	}
+	refund := func() {
+		if preQuota == 0 {
+			return
+		}
+		if err := model.PostConsumeTokenQuota(ctx, meta.TokenId, -preQuota); err != nil {
+			lg.Error("failed to refund batch pre-consumed quota", zap.Error(err))
+		}
+	}
+
+	respBody, resp, bizErr := relayBatchPassthrough(c, up, http.MethodPost, "/batches", bytes.NewReader(requestBody), "application/json")
+	if bizErr != nil {
+		refund()
+		return bizErr
+	}
+
+	batch := &batchObject{}
+	if err = json.Unmarshal(respBody, batch); err != nil || batch.Id == "" {
+		// the upstream accepted the job; keep the hold so it is still settled by the poller
+		lg.Error("failed to parse upstream batch object", zap.ByteString("body", respBody), zap.Error(err))
+		writeBatchResponse(c, resp, respBody)
+		return nil
+	}
+
+	requestId := c.GetString(helper.RequestIdKey)
+	traceId := ""
+	if tid, tidErr := gmw.TraceID(c); tidErr == nil {
+		traceId = tid.String()
+	}
+
+	logEntry := &model.Log{
+		UserId:    meta.UserId,
+		ModelName: batch.Endpoint,
+		TokenId:   meta.TokenId,
+		TokenName: meta.TokenName,
+		Quota:     int(preQuota),
+		ChannelId: meta.ChannelId,
+		Content:   fmt.Sprintf("Batch %s pre-consumed %d quota, pending settlement", batch.Id, preQuota),
+		RequestId: requestId,
+		TraceId:   traceId,
+	}
+	model.RecordConsumeLog(ctx, logEntry)
+
+	txn := &model.TokenTransaction{
+		TransactionID: "batch:" + batch.Id,
+		TokenId:       meta.TokenId,
+		UserId:        meta.UserId,
+		Status:        model.TokenTransactionStatusPending,
+		PreQuota:      preQuota,
+		Reason:        "batch " + batch.Id,
+		RequestId:     requestId,
+		TraceId:       traceId,
+		ExpiresAt:     helper.GetTimestamp() + int64(config.BatchHoldTimeoutSec),
+	}
+	if logEntry.Id > 0 {
+		txn.LogId = &logEntry.Id
+	}
+	if err = model.CreateTokenTransaction(ctx, txn); err != nil {
+		lg.Error("failed to create batch token transaction", zap.String("batch_id", batch.Id), zap.Error(err))
+	}
+
+	job := &model.BatchJob{
+		BatchId:       batch.Id,
+		UserId:        meta.UserId,
+		TokenId:       meta.TokenId,
+		TokenName:     meta.TokenName,
+		Group:         meta.Group,
+		GroupRatio:    meta.ChannelRatio,
+		ChannelId:     meta.ChannelId,
+		ChannelType:   meta.ChannelType,
+		ChannelKeyId:  c.GetInt(ctxkey.ChannelKeyId),
+		Endpoint:      batch.Endpoint,
+		InputFileId:   batch.InputFileId,
+		OutputFileId:  batch.OutputFileId,
+		Status:        batch.status(),
+		TransactionId: txn.Id,
+		LogId:         logEntry.Id,
+		PreQuota:      preQuota,
+		RequestId:     requestId,
+	}
+	if err = model.CreateBatchJob(ctx, job); err != nil {
+		lg.Error("failed to record batch job", zap.String("batch_id", batch.Id), zap.Error(err))
+	}
+
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// RelayBatchRetrieveHelper handles GET /v1/batches/:id and settles the job once it is terminal.
+func RelayBatchRetrieveHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	batchId := c.Param("id")
+	respBody, resp, bizErr := relayBatchPassthrough(c, batchUpstreamFromContext(c), http.MethodGet, "/batches/"+batchId, nil, "")
+	if bizErr != nil {
+		return bizErr
+	}
+
+	if job, err := model.GetBatchJobByUser(ctx, c.GetInt(ctxkey.Id), batchId); err == nil && !job.Settled {
+		batch := &batchObject{}
+		if err = json.Unmarshal(respBody, batch); err == nil {
+			if err = settleBatchJob(ctx, job, batch); err != nil {
+				gmw.GetLogger(c).Error("failed to settle batch job", zap.String("batch_id", batchId), zap.Error(err))
+			}
+		}
+	}
+
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// RelayBatchCancelHelper handles POST /v1/batches/:id/cancel.
+func RelayBatchCancelHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	batchId := c.Param("id")
+	respBody, resp, bizErr := relayBatchPassthrough(c, batchUpstreamFromContext(c), http.MethodPost, "/batches/"+batchId+"/cancel", nil, "")
+	if bizErr != nil {
+		return bizErr
+	}
+
+	if job, err := model.GetBatchJobByUser(ctx, c.GetInt(ctxkey.Id), batchId); err == nil {
+		batch := &batchObject{}
+		if err = json.Unmarshal(respBody, batch); err == nil && batch.status() != "" {
+			_ = model.UpdateBatchJob(ctx, job.Id, map[string]any{"status": batch.status()})
+		}
+	}
+
+	writeBatchResponse(c, resp, respBody)
+	return nil
+}
+
+// SettleBatchJob polls the upstream state of job and, once the batch is terminal,
+// charges the real usage found in its output and confirms the pending TokenTransaction.
+func SettleBatchJob(ctx context.Context, job *model.BatchJob) error {
+	return settleBatchJob(ctx, job, nil)
+}
+
+// settleBatchJob is SettleBatchJob with an already fetched batch object; a nil batch is fetched upstream.
+func settleBatchJob(ctx context.Context, job *model.BatchJob, batch *batchObject) error {
+	if job.Settled {
+		return nil
+	}
+
+	channel, err := model.GetChannelById(job.ChannelId, true)
+	if err != nil {
+		return errors.Wrap(err, "load batch channel")
+	}
+	up, err := batchUpstreamFromChannel(channel, job.ChannelKeyId)
+	if err != nil {
+		return errors.Wrap(err, "build batch upstream")
+	}
+
+	if batch == nil {
+		batch, err = fetchBatchObject(ctx, up, job.BatchId)
+		if err != nil {
+			return errors.Wrapf(err, "fetch batch %s", job.BatchId)
+		}
+	}
+
+	status := batch.status()
+	if !isTerminalBatchStatus(status) {
+		if status != job.Status {
+			return model.UpdateBatchJob(ctx, job.Id, map[string]any{"status": status})
+		}
+		return nil
+	}
+
+	usages := map[string]*relaymodel.Usage{}
+	outputPath := ""
+	switch {
+	case up.isAnthropic():
+		outputPath = "/batches/" + job.BatchId + "/results"
+	case batch.OutputFileId != "":
+		outputPath = "/files/" + batch.OutputFileId + "/content"
+	}
+	if outputPath != "" {
+		req, err := up.newRequest(ctx, http.MethodGet, outputPath, nil)
+		if err != nil {
+			return errors.Wrap(err, "build batch output request")
+		}
+		resp, err := up.do(req)
+		if err != nil {
+			return errors.Wrap(err, "download batch output")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return errors.Errorf("download batch output: upstream status %d", resp.StatusCode)
+		}
+		if usages, err = parseBatchOutputUsage(resp.Body); err != nil {
+			return errors.Wrap(err, "parse batch output")
+		}
+	}
+
+	finalQuota, promptTokens, completionTokens := computeBatchQuota(usages, channel, job.GroupRatio)
+	return confirmBatchJob(ctx, job, batch, status, finalQuota, promptTokens, completionTokens, usages)
+}
+
+func fetchBatchObject(ctx context.Context, up *batchUpstream, batchId string) (*batchObject, error) {
+	req, err := up.newRequest(ctx, http.MethodGet, "/batches/"+batchId, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := up.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("upstream status %d", resp.StatusCode)
+	}
+	batch := &batchObject{}
+	if err = json.NewDecoder(resp.Body).Decode(batch); err != nil {
+		return nil, errors.Wrap(err, "decode batch object")
+	}
+	return batch, nil
+}
+
+func confirmBatchJob(ctx context.Context, job *model.BatchJob, batch *batchObject, status string,
+	finalQuota int64, promptTokens int, completionTokens int, usages map[string]*relaymodel.Usage) error {
+	// the poller runs on every node and retrieve requests settle inline, so only the caller
+	// that flips settled may charge the batch
+	claimed, err := model.ClaimBatchJobSettlement(ctx, job.Id, map[string]any{
+		"status":         status,
+		"output_file_id": batch.OutputFileId,
+		"final_quota":    finalQuota,
+	})
+	if err != nil || !claimed {
+		return err
+	}
+
+	delta := finalQuota - job.PreQuota
+	if delta != 0 {
+		if err := model.PostConsumeTokenQuota(ctx, job.TokenId, delta); err != nil {
+			// hand the job back so the charge is retried instead of being lost
+			if releaseErr := model.ReleaseBatchJobSettlement(ctx, job.Id); releaseErr != nil {
+				gmw.GetLogger(ctx).Error("failed to release batch settlement",
+					zap.String("batch_id", job.BatchId), zap.Error(releaseErr))
+			}
+			return errors.Wrapf(err, "reconcile quota for batch %s", job.BatchId)
+		}
+	}
+	job.Settled, job.Status, job.FinalQuota = true, status, finalQuota
+
+	// the quota is already charged here, so a failed confirm must not release the claim;
+	// the pending hold only records the charge and auto-confirms once it expires
+	if job.TransactionId != 0 {
+		if err := model.UpdateTokenTransaction(ctx, job.TransactionId, map[string]any{
+			"status":         model.TokenTransactionStatusConfirmed,
+			"final_quota":    finalQuota,
+			"confirmed_at":   helper.GetTimestamp(),
+			"auto_confirmed": false,
+			"expires_at":     int64(0),
+		}); err != nil {
+			return errors.Wrapf(err, "confirm token transaction for batch %s", job.BatchId)
+		}
+	}
+
+	if finalQuota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(job.UserId, finalQuota)
+		model.UpdateChannelUsedQuota(job.ChannelId, finalQuota)
+	}
+
+	if job.LogId > 0 {
+		modelNames := make([]string, 0, len(usages))
+		for name := range usages {
+			modelNames = append(modelNames, name)
+		}
+		updates := map[string]any{
+			"quota":             int(finalQuota),
+			"prompt_tokens":     promptTokens,
+			"completion_tokens": completionTokens,
+			"content": fmt.Sprintf("Batch %s %s, settled %d quota (pre-consumed %d)",
+				job.BatchId, status, finalQuota, job.PreQuota),
+		}
+		if len(modelNames) > 0 {
+			updates["model_name"] = strings.Join(modelNames, ",")
+		}
+		if err := model.UpdateConsumeLogByID(ctx, job.LogId, updates); err != nil {
+			gmw.GetLogger(ctx).Warn("failed to update batch consume log", zap.String("batch_id", job.BatchId), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// batchOutputUsage accepts the usage shapes found in batch outputs: chat/embeddings
+// (prompt/completion tokens), Response API (input/output tokens) and Anthropic messages.
+type batchOutputUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	InputTokens         int `json:"input_tokens"`
+	OutputTokens        int `json:"output_tokens"`
+	PromptTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+	InputTokensDetails *struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+}
+
+type batchOutputBody struct {
+	Model string            `json:"model"`
+	Usage *batchOutputUsage `json:"usage"`
+}
+
+// batchOutputLine covers both the OpenAI output file line and the Anthropic results line.
+type batchOutputLine struct {
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       batchOutputBody `json:"body"`
+	} `json:"response"`
+	Result *struct {
+		Type    string          `json:"type"`
+		Message batchOutputBody `json:"message"`
+	} `json:"result"`
+}
+
+// parseBatchOutputUsage aggregates token usage per model from a JSONL batch output.
+// Failed requests carry no usage and are skipped.
+func parseBatchOutputUsage(r io.Reader) (map[string]*relaymodel.Usage, error) {
+	usages := map[string]*relaymodel.Usage{}
+	reader := bufio.NewReader(r)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var out batchOutputLine
+			if err := json.Unmarshal(line, &out); err != nil {
+				return nil, errors.Wrap(err, "unmarshal batch output line")
+			}
+
+			var body *batchOutputBody
+			switch {
+			case out.Response != nil && out.Response.StatusCode == http.StatusOK:
+				body = &out.Response.Body
+			case out.Result != nil && out.Result.Type == "succeeded":
+				body = &out.Result.Message
+			}
+			if body != nil && body.Usage != nil {
+				addBatchUsage(usages, body.Model, body.Usage)
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, errors.Wrap(readErr, "read batch output")
+		}
+	}
+	return usages, nil
+}
+
+func addBatchUsage(usages map[string]*relaymodel.Usage, modelName string, u *batchOutputUsage) {
+	usage, ok := usages[modelName]
+	if !ok {
+		usage = &relaymodel.Usage{PromptTokensDetails: &relaymodel.UsagePromptTokensDetails{}}
+		usages[modelName] = usage
+	}
+
+	prompt := u.PromptTokens + u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens
+	completion := u.CompletionTokens + u.OutputTokens
+	cached := u.CacheReadInputTokens
+	if u.PromptTokensDetails != nil {
+		cached += u.PromptTokensDetails.CachedTokens
+	}
+	if u.InputTokensDetails != nil {
+		cached += u.InputTokensDetails.CachedTokens
+	}
+
+	usage.PromptTokens += prompt
+	usage.CompletionTokens += completion
+	usage.TotalTokens += prompt + completion
+	usage.PromptTokensDetails.CachedTokens += cached
+	usage.CacheWrite5mTokens += u.CacheCreationInputTokens
+}
+
+// computeBatchQuota prices the aggregated usage with the same pricing layers as synchronous
+// requests and applies BatchDiscountRatio.
+func computeBatchQuota(usages map[string]*relaymodel.Usage, channel *model.Channel, groupRatio float64) (int64, int, int) {
+	pricingAdaptor := relay.GetAdaptor(channel.Type)
+	channelModelRatio := channel.GetModelRatioFromConfigs()
+	channelCompletionRatio := channel.GetCompletionRatioFromConfigs()
+
+	var (
+		total            float64
+		promptTokens     int
+		completionTokens int
+	)
+	for modelName, usage := range usages {
+		modelRatio := pricing.GetModelRatioWithThreeLayers(modelName, channelModelRatio, pricingAdaptor)
+		result := quota.Compute(quota.ComputeInput{
+			Usage:                  usage,
+			ModelName:              modelName,
+			ModelRatio:             modelRatio,
+			GroupRatio:             groupRatio,
+			ChannelCompletionRatio: channelCompletionRatio,
+			PricingAdaptor:         pricingAdaptor,
+		})
+		total += float64(result.TotalQuota)
+		promptTokens += result.PromptTokens
+		completionTokens += result.CompletionTokens
+	}
+
+	return int64(math.Ceil(total * config.BatchDiscountRatio)), promptTokens, completionTokens
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/channeltype"
+)
+
+func TestParseBatchOutputUsageOpenAI(t *testing.T) {
+	t.Parallel()
+
+	output := strings.Join([]string{
+		`{"id":"r1","custom_id":"a","response":{"status_code":200,"body":{"model":"gpt-4o-mini","usage":{"prompt_tokens":10,"completion_tokens":5,"prompt_tokens_details":{"cached_tokens":4}}}}}`,
+		`{"id":"r2","custom_id":"b","response":{"status_code":200,"body":{"model":"gpt-4o-mini","usage":{"prompt_tokens":20,"completion_tokens":7}}}}`,
+		`{"id":"r3","custom_id":"c","response":{"status_code":500,"body":{"error":{"message":"boom"}}}}`,
+		``,
+		`{"id":"r4","custom_id":"d","response":{"status_code":200,"body":{"model":"gpt-4.1","usage":{"input_tokens":8,"output_tokens":3,"input_tokens_details":{"cached_tokens":2}}}}}`,
+	}, "\n")
+
+	usages, err := parseBatchOutputUsage(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, usages, 2)
+
+	mini := usages["gpt-4o-mini"]
+	require.Equal(t, 30, mini.PromptTokens)
+	require.Equal(t, 12, mini.CompletionTokens)
+	require.Equal(t, 42, mini.TotalTokens)
+	require.Equal(t, 4, mini.PromptTokensDetails.CachedTokens)
+
+	responses := usages["gpt-4.1"]
+	require.Equal(t, 8, responses.PromptTokens)
+	require.Equal(t, 3, responses.CompletionTokens)
+	require.Equal(t, 2, responses.PromptTokensDetails.CachedTokens)
+}
+
+func TestParseBatchOutputUsageAnthropic(t *testing.T) {
+	t.Parallel()
+
+	output := `{"custom_id":"a","result":{"type":"succeeded","message":{"model":"claude-sonnet-4-5","usage":{"input_tokens":10,"output_tokens":6,"cache_read_input_tokens":30,"cache_creation_input_tokens":5}}}}
+{"custom_id":"b","result":{"type":"errored","error":{"type":"invalid_request_error"}}}
+{"custom_id":"c","result":{"type":"expired"}}`
+
+	usages, err := parseBatchOutputUsage(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, usages, 1)
+
+	usage := usages["claude-sonnet-4-5"]
+	require.Equal(t, 45, usage.PromptTokens)
+	require.Equal(t, 6, usage.CompletionTokens)
+	require.Equal(t, 30, usage.PromptTokensDetails.CachedTokens)
+	require.Equal(t, 5, usage.CacheWrite5mTokens)
+}
+
+func TestParseBatchOutputUsageInvalidLine(t *testing.T) {
+	t.Parallel()
+
+	_, err := parseBatchOutputUsage(strings.NewReader("not json\n"))
+	require.Error(t, err)
+}
+
+func TestBatchUpstreamURL(t *testing.T) {
+	t.Parallel()
+
+	openai := newBatchUpstream(channeltype.OpenAI, "https://api.openai.com/", "sk", "")
+	require.Equal(t, "https://api.openai.com/v1/batches/batch_1", openai.url("/batches/batch_1"))
+
+	azure := newBatchUpstream(channeltype.Azure, "https://res.openai.azure.com", "k", "")
+	require.Equal(t, "https://res.openai.azure.com/openai/files?api-version="+defaultAzureBatchAPIVersion, azure.url("/files"))
+
+	anthropic := newBatchUpstream(channeltype.Anthropic, "https://api.anthropic.com", "k", "")
+	require.True(t, anthropic.isAnthropic())
+	require.Equal(t, "https://api.anthropic.com/v1/messages/batches/msgbatch_1/results", anthropic.url("/batches/msgbatch_1/results"))
+}
+
+func TestIsTerminalBatchStatus(t *testing.T) {
+	t.Parallel()
+
+	for _, status := range []string{"completed", "failed", "expired", "cancelled", "ended"} {
+		require.True(t, isTerminalBatchStatus(status), status)
+	}
+	for _, status := range []string{"validating", "in_progress", "finalizing", "cancelling", "canceling"} {
+		require.False(t, isTerminalBatchStatus(status), status)
+	}
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/aws"
+	awsclaude "github.com/songquanpeng/one-api/relay/adaptor/aws/claude"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// ClaudeCountTokensResponse is the response body of /v1/messages/count_tokens.
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
+// RelayClaudeCountTokensHelper handles POST /v1/messages/count_tokens.
+//
+// Anthropic channels, and Vertex AI / AWS Bedrock channels serving Claude models, answer natively.
+// Every other channel is answered locally with the same estimate used to pre-consume quota for
+// Claude Messages requests. Counting tokens never charges quota.
+func RelayClaudeCountTokensHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	meta := metalib.GetByContext(c)
+
+	request, err := getAndValidateClaudeCountTokensRequest(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+
+	meta.OriginModelName = request.Model
+	request.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	if !supportsNativeClaudeCountTokens(meta) {
+		inputTokens := getClaudeMessagesPromptTokens(gmw.Ctx(c), request)
+		lg.Debug("estimated claude count_tokens locally",
+			zap.Int("channel_type", meta.ChannelType),
+			zap.Int("input_tokens", inputTokens))
+		c.JSON(http.StatusOK, ClaudeCountTokensResponse{InputTokens: inputTokens})
+		return nil
+	}
+
+	rawBody, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_original_body_failed", http.StatusInternalServerError)
+	}
+	body, err := rewriteClaudeRequestBody(rawBody, request)
+	if err != nil {
+		return openai.ErrorWrapper(err, "rewrite_claude_body_failed", http.StatusInternalServerError)
+	}
+
+	if meta.ChannelType == channeltype.AwsClaude {
+		awsAdaptor := &aws.Adaptor{}
+		awsAdaptor.Init(meta)
+		inputTokens, err := awsclaude.CountTokens(c, awsAdaptor.AwsClient, meta.ActualModelName, body)
+		if err != nil {
+			return openai.ErrorWrapper(err, "count_tokens_failed", http.StatusInternalServerError)
+		}
+		c.JSON(http.StatusOK, ClaudeCountTokensResponse{InputTokens: inputTokens})
+		return nil
+	}
+
+	return relayClaudeCountTokensHTTP(c, meta, body)
+}
+
+// supportsNativeClaudeCountTokens reports whether the selected channel exposes Anthropic's
+// count_tokens endpoint for the requested model.
+func supportsNativeClaudeCountTokens(meta *metalib.Meta) bool {
+	switch meta.ChannelType {
+	case channeltype.Anthropic:
+		return true
+	case channeltype.VertextAI, channeltype.AwsClaude:
+		return strings.Contains(strings.ToLower(meta.ActualModelName), "claude")
+	default:
+		return false
+	}
+}
+
+// claudeCountTokensURL returns the native count_tokens URL of an HTTP based Claude provider.
+func claudeCountTokensURL(meta *metalib.Meta) (string, error) {
+	switch meta.ChannelType {
+	case channeltype.Anthropic:
+		return meta.BaseURL + "/v1/messages/count_tokens", nil
+	case channeltype.VertextAI:
+		return (&vertexai.Adaptor{}).GetClaudeCountTokensURL(meta)
+	default:
+		return "", errors.Errorf("channel type %d has no native count_tokens endpoint", meta.ChannelType)
+	}
+}
+
+// relayClaudeCountTokensHTTP forwards the request to Anthropic or Vertex AI and copies the
+// upstream answer back to the client.
+func relayClaudeCountTokensHTTP(c *gin.Context, meta *metalib.Meta, body []byte) *relaymodel.ErrorWithStatusCode {
+	url, err := claudeCountTokensURL(meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+
+	req, err := http.NewRequestWithContext(gmw.Ctx(c), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		return openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorInstance.Init(meta)
+	if err = adaptorInstance.SetupRequestHeader(c, req, meta); err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, "application/json", respBody)
+	return nil
+}
+
+// getAndValidateClaudeCountTokensRequest parses a count_tokens request. Unlike a Messages
+// request it carries no max_tokens.
+func getAndValidateClaudeCountTokensRequest(c *gin.Context) (*ClaudeMessagesRequest, error) {
+	request := &ClaudeMessagesRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return nil, errors.Wrap(err, "unmarshal Claude count_tokens request")
+	}
+	if request.Model == "" {
+		return nil, errors.New("model is required")
+	}
+	if len(request.Messages) == 0 {
+		return nil, errors.New("messages array cannot be empty")
+	}
+	for i, message := range request.Messages {
+		if message.Role != "user" && message.Role != "assistant" {
+			return nil, errors.Errorf("message[%d].role must be 'user' or 'assistant'", i)
+		}
+	}
+
+	return request, nil
+}
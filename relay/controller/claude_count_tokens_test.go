@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+)
+
+const claudeCountTokensPayload = `{"model":"claude-sonnet-4-5","system":"You are terse.","messages":[{"role":"user","content":"Hello, how many tokens is this?"}]}`
+
+func setupClaudeCountTokensContext(t *testing.T, channelType int, baseURL string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(claudeCountTokensPayload))
+	req.Header.Set("Authorization", "Bearer upstream-key")
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+
+	gmw.SetLogger(c, logger.Logger)
+
+	c.Set(ctxkey.Channel, channelType)
+	c.Set(ctxkey.ChannelId, 42)
+	c.Set(ctxkey.BaseURL, baseURL)
+	c.Set(ctxkey.RequestModel, "claude-sonnet-4-5")
+	c.Set(ctxkey.ModelMapping, map[string]string{})
+	c.Set(ctxkey.ChannelRatio, 1.0)
+
+	return c, recorder
+}
+
+func TestSupportsNativeClaudeCountTokens(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.Anthropic, ActualModelName: "claude-sonnet-4-5"}))
+	require.True(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.VertextAI, ActualModelName: "claude-sonnet-4@20250514"}))
+	require.True(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.AwsClaude, ActualModelName: "claude-sonnet-4-5"}))
+	require.False(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.VertextAI, ActualModelName: "gemini-2.5-pro"}))
+	require.False(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.AwsClaude, ActualModelName: "amazon.nova-pro-v1:0"}))
+	require.False(t, supportsNativeClaudeCountTokens(&metalib.Meta{ChannelType: channeltype.OpenAI, ActualModelName: "claude-sonnet-4-5"}))
+}
+
+func TestRelayClaudeCountTokensHelper_LocalEstimate(t *testing.T) {
+	c, recorder := setupClaudeCountTokensContext(t, channeltype.OpenAI, "")
+
+	bizErr := RelayClaudeCountTokensHelper(c)
+	require.Nil(t, bizErr)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var resp ClaudeCountTokensResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	require.Positive(t, resp.InputTokens)
+}
+
+func TestRelayClaudeCountTokensHelper_AnthropicPassThrough(t *testing.T) {
+	if client.HTTPClient == nil {
+		client.HTTPClient = &http.Client{}
+	}
+
+	var captured map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/messages/count_tokens", r.URL.Path)
+		require.Equal(t, "upstream-key", r.Header.Get("x-api-key"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &captured))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"input_tokens":17}`)
+	}))
+	defer upstream.Close()
+
+	c, recorder := setupClaudeCountTokensContext(t, channeltype.Anthropic, upstream.URL)
+
+	bizErr := RelayClaudeCountTokensHelper(c)
+	require.Nil(t, bizErr)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"input_tokens":17}`, recorder.Body.String())
+	require.Equal(t, "claude-sonnet-4-5", captured["model"])
+}
+
+func TestGetAndValidateClaudeCountTokensRequest(t *testing.T) {
+	c, _ := setupClaudeCountTokensContext(t, channeltype.OpenAI, "")
+	request, err := getAndValidateClaudeCountTokensRequest(c)
+	require.NoError(t, err)
+	require.Equal(t, "claude-sonnet-4-5", request.Model)
+	require.Zero(t, request.MaxTokens)
+
+	recorder := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages/count_tokens", strings.NewReader(`{"model":"claude-sonnet-4-5","messages":[]}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	_, err = getAndValidateClaudeCountTokensRequest(c)
+	require.Error(t, err)
+}
@@ -44,6 +44,13 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "invalid_claude_messages_request", http.StatusBadRequest)
 	}
 
+	// run input guardrails before the body is parsed, so redactions reach the upstream
+	guard, guardErr := applyGuardrails(c, meta)
+	if guardErr != nil {
+		return guardErr
+	}
+	defer guard.finish()
+
 	// get & validate Claude Messages API request
 	claudeRequest, err := getAndValidateClaudeMessagesRequest(c)
 	if err != nil {
@@ -67,7 +74,7 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
 
 	// get model ratio using three-layer pricing system
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, claudeRequest.Model)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(claudeRequest.Model, channelModelRatio, pricingAdaptor)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 
@@ -406,6 +413,8 @@ func RelayClaudeMessagesHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		// Fall through to billing with available usage
 	}
 
+	guard.collect(meta)
+
 	// post-consume quota
 	quotaId := c.GetInt(ctxkey.Id)
 	requestId := c.GetString(ctxkey.RequestId)
@@ -873,14 +882,14 @@ func preConsumeClaudeMessagesQuota(c *gin.Context, request *ClaudeMessagesReques
 	// Check user quota first
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetQuotaPool(ctx, meta.UserId, meta.OrganizationId)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-baseQuota < 0 {
 		return baseQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(ctx, meta.UserId, baseQuota)
+	err = model.CacheDecreaseQuotaPool(ctx, meta.UserId, meta.OrganizationId, baseQuota)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -914,7 +923,7 @@ func postConsumeClaudeMessagesQuotaWithTraceID(ctx context.Context, requestId st
 	}
 
 	// Use three-layer pricing system for completion ratio
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(ctx, meta.ChannelType, request.Model)
 	completionRatio := pricing.GetCompletionRatioWithThreeLayers(request.Model, channelCompletionRatio, pricingAdaptor)
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
@@ -948,6 +957,9 @@ func postConsumeClaudeMessagesQuotaWithTraceID(ctx context.Context, requestId st
 	cacheWrite5mTokens := usage.CacheWrite5mTokens
 	cacheWrite1hTokens := usage.CacheWrite1hTokens
 	metadata := model.AppendCacheWriteTokensMetadata(nil, cacheWrite5mTokens, cacheWrite1hTokens)
+	metadata = model.AppendGuardrailMetadata(metadata, meta.GuardrailViolations)
+	metadata = model.AppendModelFallbackMetadata(metadata, meta.FallbackFromModel)
+	metadata = appendPromptCacheAffinity(metadata, meta, promptTokens, cachedPromptTokens)
 
 	// Use centralized detailed billing function with explicit trace ID
 	quotaDelta := quota - preConsumedQuota
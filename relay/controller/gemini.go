@@ -0,0 +1,398 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayGeminiHelper handles native Gemini API generateContent and streamGenerateContent
+// requests.
+//
+// Gemini channels, and Vertex AI channels serving Gemini models, receive the request
+// verbatim. Every other channel serves it as a chat completion whose response is converted
+// back into the Gemini format.
+func RelayGeminiHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	meta := metalib.GetByContext(c)
+	_, action, _ := relaymode.ParseGeminiModelAction(c.Request.URL.Path)
+	if action != relaymode.GeminiActionGenerateContent && action != relaymode.GeminiActionStreamGenerateContent {
+		return openai.ErrorWrapper(errors.Errorf("unsupported model action %q", action), "invalid_request_error", http.StatusNotFound)
+	}
+	stream := action == relaymode.GeminiActionStreamGenerateContent
+	sse := c.Query("alt") == "sse"
+
+	// retries start over from the native body, not the chat request of a previous attempt
+	if raw, ok := c.Get(ctxkey.GeminiRequestBody); ok {
+		body := raw.([]byte)
+		c.Set(ctxkey.KeyRequestBody, body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// run input guardrails before the body is parsed, so redactions reach the upstream
+	guard, guardErr := applyGuardrails(c, meta)
+	if guardErr != nil {
+		return guardErr
+	}
+	defer guard.finish()
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	c.Set(ctxkey.GeminiRequestBody, body)
+
+	request, err := gemini.ParseGenerateContentRequest(body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+	textRequest, err := gemini.ConvertGenerateContentRequest(request, c.GetString(ctxkey.RequestModel), stream)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	if !supportsNativeGemini(meta) {
+		// the chat relay runs the guardrails again; the input stage is cached for it
+		guard.finish()
+		return relayGeminiThroughChat(c, meta, textRequest, stream, sse)
+	}
+	return relayGeminiNative(c, meta, body, textRequest, guard, sse)
+}
+
+// supportsNativeGemini reports whether the selected channel speaks the Gemini API for the
+// requested model.
+func supportsNativeGemini(meta *metalib.Meta) bool {
+	switch meta.APIType {
+	case apitype.Gemini:
+		return true
+	case apitype.VertexAI:
+		return strings.Contains(strings.ToLower(meta.ActualModelName), "gemini")
+	default:
+		return false
+	}
+}
+
+// relayGeminiNative forwards the native request to a Gemini or Vertex AI channel, copies
+// the response back verbatim and bills the usage metadata it reports.
+func relayGeminiNative(c *gin.Context, meta *metalib.Meta, body []byte, textRequest *relaymodel.GeneralOpenAIRequest, guard *guardrailRun, sse bool) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+	if err := logClientRequestPayload(c, "gemini_generate_content"); err != nil {
+		return openai.ErrorWrapper(err, "invalid_gemini_request", http.StatusBadRequest)
+	}
+
+	meta.IsStream = textRequest.Stream
+	meta.OriginModelName = textRequest.Model
+	textRequest.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, textRequest.Model)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(textRequest.Model, channelModelRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	ratio := modelRatio * groupRatio
+
+	promptTokens := getPromptTokens(ctx, textRequest, relaymode.ChatCompletions)
+	meta.PromptTokens = promptTokens
+	preConsumedQuota, bizErr := preConsumeQuota(c, textRequest, promptTokens, ratio, meta)
+	if bizErr != nil {
+		lg.Warn("preConsumeQuota failed",
+			zap.Int("status_code", bizErr.StatusCode),
+			zap.Error(bizErr.RawError))
+		return bizErr
+	}
+
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorInstance.Init(meta)
+
+	resp, err := adaptorInstance.DoRequest(c, meta, bytes.NewReader(body))
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		graceful.GoCritical(ctx, "returnPreConsumedQuota", func(cctx context.Context) {
+			billing.ReturnPreConsumedQuota(cctx, preConsumedQuota, meta.TokenId)
+		})
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+
+	var usage *relaymodel.Usage
+	var respErr *relaymodel.ErrorWithStatusCode
+	var text string
+	if meta.IsStream {
+		respErr, usage, text = gemini.NativeStreamHandler(c, resp, sse)
+	} else {
+		respErr, usage, text = gemini.NativeHandler(c, resp)
+	}
+	if respErr != nil {
+		lg.Error("gemini native response handler failed",
+			zap.Int("status_code", respErr.StatusCode),
+			zap.Error(respErr.RawError))
+		// bill what reached the client; refund when nothing did
+		if usage == nil && text == "" {
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+			return respErr
+		}
+	}
+	if usage == nil {
+		completionTokens := openai.CountTokenText(text, meta.ActualModelName)
+		usage = &relaymodel.Usage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		}
+	}
+	guard.collect(meta)
+
+	// Refund pre-consumed quota immediately before final billing reconciliation
+	billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+
+	userId := strconv.Itoa(meta.UserId)
+	username := c.GetString(ctxkey.Username)
+	if username == "" {
+		username = "unknown"
+	}
+	group := meta.Group
+	if group == "" {
+		group = "default"
+	}
+	metrics.GlobalRecorder.RecordRelayRequest(
+		meta.StartTime,
+		meta.ChannelId,
+		channeltype.IdToName(meta.ChannelType),
+		meta.ActualModelName,
+		userId,
+		true,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		0,
+	)
+	metrics.GlobalRecorder.RecordUserMetrics(
+		userId,
+		username,
+		group,
+		0,
+		usage.PromptTokens,
+		usage.CompletionTokens,
+		float64(c.GetInt64(ctxkey.UserQuota)),
+	)
+	metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
+
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+	graceful.GoCritical(gmw.BackgroundCtx(c), "postBilling", func(ctx context.Context) {
+		billingTimeout := time.Duration(config.BillingTimeoutSec) * time.Second
+		ctx, cancel := context.WithTimeout(gmw.BackgroundCtx(c), billingTimeout)
+		defer cancel()
+
+		done := make(chan bool, 1)
+		var quota int64
+
+		go func() {
+			quota = postConsumeQuota(ctx, usage, meta, textRequest, ratio, preConsumedQuota, 0, modelRatio, groupRatio, false, channelCompletionRatio)
+			if requestId != "" {
+				if err := model.UpdateUserRequestCostQuotaByRequestID(quotaId, requestId, quota); err != nil {
+					lg.Error("update user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+				}
+			}
+			done <- true
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				estimatedQuota := float64(usage.PromptTokens+usage.CompletionTokens) * ratio
+				elapsedTime := time.Since(meta.StartTime)
+				lg.Error("CRITICAL BILLING TIMEOUT",
+					zap.String("model", textRequest.Model),
+					zap.String("requestId", requestId),
+					zap.Int("userId", meta.UserId),
+					zap.Int64("estimatedQuota", int64(estimatedQuota)),
+					zap.Duration("elapsedTime", elapsedTime))
+				metrics.GlobalRecorder.RecordBillingTimeout(meta.UserId, meta.ChannelId, textRequest.Model, estimatedQuota, elapsedTime)
+			}
+		}
+	})
+
+	return nil
+}
+
+// relayGeminiThroughChat serves the request as a chat completion and converts the
+// response written by the chat relay into the Gemini format.
+func relayGeminiThroughChat(c *gin.Context, meta *metalib.Meta, textRequest *relaymodel.GeneralOpenAIRequest, stream bool, sse bool) *relaymodel.ErrorWithStatusCode {
+	body, err := json.Marshal(textRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+	}
+	c.Set(ctxkey.KeyRequestBody, body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	meta.Mode = relaymode.ChatCompletions
+	metalib.Set2Context(c, meta)
+
+	writer := newGeminiResponseWriter(c.Writer, textRequest.Model, stream, sse)
+	c.Writer = writer
+	bizErr := RelayTextHelper(c)
+	c.Writer = writer.ResponseWriter
+	if err := writer.finish(); err != nil && bizErr == nil {
+		gmw.GetLogger(c).Warn("write gemini response failed", zap.Error(err))
+	}
+	return bizErr
+}
+
+// geminiResponseWriter converts the OpenAI chat completion written through it, streamed or
+// not, into the native Gemini response format.
+type geminiResponseWriter struct {
+	gin.ResponseWriter
+	modelName string
+	stream    bool
+	encoder   *gemini.StreamEncoder
+	converter *gemini.StreamConverter
+	pending   []byte
+	written   bool
+}
+
+func newGeminiResponseWriter(w gin.ResponseWriter, modelName string, stream bool, sse bool) *geminiResponseWriter {
+	return &geminiResponseWriter{
+		ResponseWriter: w,
+		modelName:      modelName,
+		stream:         stream,
+		encoder:        gemini.NewStreamEncoder(w, sse),
+		converter:      gemini.NewStreamConverter(modelName),
+	}
+}
+
+// Write buffers non-stream bodies until finish and converts stream chunks line by line.
+func (w *geminiResponseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	w.Header().Del("Content-Length")
+	w.pending = append(w.pending, data...)
+	if !w.stream {
+		return len(data), nil
+	}
+
+	w.Header().Set("Content-Type", w.encoder.ContentType())
+	if idx := bytes.LastIndexByte(w.pending, '\n'); idx >= 0 {
+		if err := w.writeLines(w.pending[:idx+1]); err != nil {
+			return 0, err
+		}
+		w.pending = append(w.pending[:0], w.pending[idx+1:]...)
+	}
+	return len(data), nil
+}
+
+func (w *geminiResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush only reaches the client for streams; non-stream bodies are written by finish.
+func (w *geminiResponseWriter) Flush() {
+	if w.stream {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *geminiResponseWriter) writeLines(chunk []byte) error {
+	for line := range bytes.SplitSeq(chunk, []byte("\n")) {
+		payload, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !ok {
+			continue
+		}
+		payload = bytes.TrimSpace(payload)
+		if len(payload) == 0 || bytes.Equal(payload, []byte("[DONE]")) {
+			continue
+		}
+		var response openai.ChatCompletionsStreamResponse
+		if err := json.Unmarshal(payload, &response); err != nil {
+			continue
+		}
+		if err := w.writeChunk(w.converter.Convert(&response)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *geminiResponseWriter) writeChunk(response *gemini.ChatResponse) error {
+	if response == nil {
+		return nil
+	}
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return errors.Wrap(err, "marshal gemini stream chunk")
+	}
+	return w.encoder.Write(payload)
+}
+
+// finish writes out whatever is still buffered. It does nothing when the chat relay
+// wrote no response, leaving the error to the caller.
+func (w *geminiResponseWriter) finish() error {
+	if !w.written {
+		return nil
+	}
+	w.written = false
+
+	if w.stream {
+		if len(w.pending) > 0 {
+			if err := w.writeLines(w.pending); err != nil {
+				return err
+			}
+			w.pending = nil
+		}
+		if err := w.writeChunk(w.converter.Flush()); err != nil {
+			return err
+		}
+		if err := w.encoder.Close(); err != nil {
+			return errors.Wrap(err, "close gemini stream")
+		}
+		w.ResponseWriter.Flush()
+		return nil
+	}
+
+	body := w.pending
+	w.pending = nil
+	var response openai.TextResponse
+	if err := json.Unmarshal(body, &response); err == nil && len(response.Choices) > 0 {
+		converted, err := json.Marshal(gemini.ResponseFromOpenAI(&response, w.modelName))
+		if err != nil {
+			return errors.Wrap(err, "marshal gemini response")
+		}
+		body = converted
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, err := w.ResponseWriter.Write(body)
+	return err
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/gemini"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/adaptor/vertexai"
+	"github.com/songquanpeng/one-api/relay/apitype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// RelayGeminiCountTokensHelper handles POST /v1beta/models/{model}:countTokens.
+//
+// Gemini channels, and Vertex AI channels serving Gemini models, answer natively. Every
+// other channel is answered locally with the same estimate used to pre-consume quota for
+// generateContent requests. Counting tokens never charges quota.
+func RelayGeminiCountTokensHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	meta := metalib.GetByContext(c)
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	request, err := gemini.ParseCountTokensRequest(body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_count_tokens_request", http.StatusBadRequest)
+	}
+
+	meta.OriginModelName = c.GetString(ctxkey.RequestModel)
+	metalib.Set2Context(c, meta)
+
+	if !supportsNativeGemini(meta) {
+		textRequest, err := gemini.ConvertGenerateContentRequest(request, meta.ActualModelName, false)
+		if err != nil {
+			return openai.ErrorWrapper(err, "invalid_count_tokens_request", http.StatusBadRequest)
+		}
+		totalTokens := getPromptTokens(gmw.Ctx(c), textRequest, relaymode.ChatCompletions)
+		lg.Debug("estimated gemini countTokens locally",
+			zap.Int("channel_type", meta.ChannelType),
+			zap.Int("total_tokens", totalTokens))
+		c.JSON(http.StatusOK, gemini.CountTokensResponse{TotalTokens: totalTokens})
+		return nil
+	}
+
+	if meta.APIType == apitype.VertexAI {
+		// Vertex AI takes the request fields inline and rejects the generateContentRequest wrapper
+		if body, err = json.Marshal(request); err != nil {
+			return openai.ErrorWrapper(err, "marshal_request_failed", http.StatusInternalServerError)
+		}
+	}
+	return relayGeminiCountTokensHTTP(c, meta, body)
+}
+
+// geminiCountTokensURL returns the native countTokens URL of the selected channel.
+func geminiCountTokensURL(meta *metalib.Meta) (string, error) {
+	switch meta.APIType {
+	case apitype.Gemini:
+		return (&gemini.Adaptor{}).GetCountTokensURL(meta), nil
+	case apitype.VertexAI:
+		return (&vertexai.Adaptor{}).GetGeminiCountTokensURL(meta)
+	default:
+		return "", errors.Errorf("api type %d has no native countTokens endpoint", meta.APIType)
+	}
+}
+
+// relayGeminiCountTokensHTTP forwards the request to Gemini or Vertex AI and copies the
+// upstream answer back to the client.
+func relayGeminiCountTokensHTTP(c *gin.Context, meta *metalib.Meta, body []byte) *relaymodel.ErrorWithStatusCode {
+	url, err := geminiCountTokensURL(meta)
+	if err != nil {
+		return openai.ErrorWrapper(err, "get_request_url_failed", http.StatusInternalServerError)
+	}
+
+	req, err := http.NewRequestWithContext(gmw.Ctx(c), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return openai.ErrorWrapper(err, "new_request_failed", http.StatusInternalServerError)
+	}
+
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		return openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorInstance.Init(meta)
+	if err = adaptorInstance.SetupRequestHeader(c, req, meta); err != nil {
+		return openai.ErrorWrapper(err, "setup_request_header_failed", http.StatusInternalServerError)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return openai.ErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, "application/json", respBody)
+	return nil
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/guardrail"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// moderationTimeout bounds the call to a moderation channel made before relaying.
+const moderationTimeout = 15 * time.Second
+
+// guardrailRun carries the guardrails of a single relay attempt.
+type guardrailRun struct {
+	c        *gin.Context
+	original gin.ResponseWriter
+	writer   *guardrail.ResponseWriter
+	input    []guardrail.Violation
+}
+
+// applyGuardrails runs the input stage of the request's guardrail pipeline and, when the
+// pipeline has output rules, routes the response through a redacting writer.
+// It returns a nil run when no rule applies. Callers must defer finish so the writer is
+// unwound before a retry.
+func applyGuardrails(c *gin.Context, meta *metalib.Meta) (*guardrailRun, *relaymodel.ErrorWithStatusCode) {
+	meta.GuardrailViolations = nil
+	pipeline, err := guardrail.ForRequest(meta.Group, c.GetString(ctxkey.TokenGuardrails))
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_guardrail_config", http.StatusInternalServerError)
+	}
+	if pipeline.Empty() {
+		return nil, nil
+	}
+
+	run := &guardrailRun{c: c}
+	if cached, ok := c.Get(ctxkey.GuardrailInputViolations); ok {
+		// retries and requests checked before the response cache relay the body that was
+		// already checked and redacted
+		run.input, _ = cached.([]guardrail.Violation)
+	} else if pipeline.HasStage(guardrail.StageInput) {
+		violations, bizErr := checkRequestGuardrails(c, meta, pipeline)
+		if bizErr != nil {
+			return nil, bizErr
+		}
+		run.input = violations
+		c.Set(ctxkey.GuardrailInputViolations, violations)
+	}
+
+	if pipeline.HasStage(guardrail.StageOutput) {
+		run.original = c.Writer
+		run.writer = guardrail.NewResponseWriter(c.Writer, pipeline)
+		c.Writer = run.writer
+	}
+	return run, nil
+}
+
+// checkInputGuardrails runs the input stage on its own, ahead of the response cache lookup.
+// The violations are kept on the context, so applyGuardrails does not check the body again.
+func checkInputGuardrails(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	if _, ok := c.Get(ctxkey.GuardrailInputViolations); ok {
+		return nil
+	}
+	meta := metalib.GetByContext(c)
+	pipeline, err := guardrail.ForRequest(meta.Group, c.GetString(ctxkey.TokenGuardrails))
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_guardrail_config", http.StatusInternalServerError)
+	}
+	if !pipeline.HasStage(guardrail.StageInput) {
+		return nil
+	}
+	violations, bizErr := checkRequestGuardrails(c, meta, pipeline)
+	if bizErr != nil {
+		return bizErr
+	}
+	c.Set(ctxkey.GuardrailInputViolations, violations)
+	return nil
+}
+
+// collect flushes the output stage and stores the violations of this attempt on meta,
+// so the consume log records them.
+func (r *guardrailRun) collect(meta *metalib.Meta) {
+	if r == nil {
+		return
+	}
+
+	violations := guardrail.MergeViolations(nil, r.input)
+	if r.writer != nil {
+		violations = guardrail.MergeViolations(violations, r.writer.Drain())
+	}
+	meta.GuardrailViolations = violations
+}
+
+// finish writes out anything still buffered and restores the original response writer.
+func (r *guardrailRun) finish() {
+	if r == nil || r.writer == nil {
+		return
+	}
+	r.writer.Drain()
+	r.c.Writer = r.original
+}
+
+// checkRequestGuardrails applies the input rules to the cached request body, rewriting it
+// when text was redacted, and consults the moderation channels. Blocked requests are
+// recorded in the system log and rejected with content_policy_violation.
+func checkRequestGuardrails(c *gin.Context, meta *metalib.Meta, pipeline *guardrail.Pipeline) ([]guardrail.Violation, *relaymodel.ErrorWithStatusCode) {
+	lg := gmw.GetLogger(c)
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "read_request_body_failed", http.StatusBadRequest)
+	}
+	result, err := pipeline.ApplyRequest(body)
+	if err != nil {
+		return nil, openai.ErrorWrapper(err, "invalid_request_error", http.StatusBadRequest)
+	}
+
+	violations := result.Violations
+	blocked := result.Blocked
+	if !blocked && strings.TrimSpace(result.Text) != "" {
+		for _, rule := range pipeline.ModerationRules() {
+			categories, err := moderateText(c, rule, result.Text)
+			if err != nil {
+				lg.Warn("guardrail moderation failed",
+					zap.String("rule", rule.Name),
+					zap.Int("channel_id", rule.ChannelId),
+					zap.Bool("fail_closed", rule.FailClosed),
+					zap.Error(err))
+				if !rule.FailClosed {
+					continue
+				}
+				categories = []string{"moderation unavailable"}
+			} else if categories == nil {
+				continue
+			}
+
+			violations = append(violations, guardrail.Violation{
+				Rule:   rule.Name,
+				Type:   rule.Type,
+				Stage:  guardrail.StageInput,
+				Action: guardrail.ActionBlock,
+				Detail: strings.Join(categories, ","),
+			})
+			blocked = true
+			break
+		}
+	}
+
+	if blocked {
+		summary := guardrail.Summary(violations)
+		model.RecordGuardrailLog(gmw.Ctx(c), &model.Log{
+			UserId:    meta.UserId,
+			TokenName: meta.TokenName,
+			ModelName: c.GetString(ctxkey.RequestModel),
+			ChannelId: meta.ChannelId,
+			Content:   "request blocked by guardrails: " + summary,
+			RequestId: c.GetString(ctxkey.RequestId),
+			TraceId:   tracing.GetTraceID(c),
+			Metadata:  model.AppendGuardrailMetadata(nil, violations),
+		})
+		return nil, openai.ErrorWrapper(
+			errors.Errorf("request blocked by content guardrails: %s", summary),
+			"content_policy_violation", http.StatusBadRequest)
+	}
+
+	if len(violations) > 0 {
+		lg.Info("guardrails redacted request content", zap.String("violations", guardrail.Summary(violations)))
+	}
+	if !bytes.Equal(result.Body, body) {
+		c.Set(ctxkey.KeyRequestBody, result.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(result.Body))
+		c.Request.ContentLength = int64(len(result.Body))
+	}
+	return violations, nil
+}
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderateText sends text to the /v1/moderations endpoint of the rule's channel and
+// returns the flagged categories, or nil when the text was not flagged. The URL and auth
+// headers come from the channel's adaptor, and pooled channels use a key picked by the
+// multi-key selector.
+func moderateText(c *gin.Context, rule guardrail.Rule, text string) ([]string, error) {
+	channel, err := model.GetChannelById(rule.ChannelId, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "get moderation channel %d", rule.ChannelId)
+	}
+	if channel.Status != model.ChannelStatusEnabled {
+		return nil, errors.Errorf("moderation channel %d is disabled", rule.ChannelId)
+	}
+
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" && channel.Type >= 0 && channel.Type < len(channeltype.ChannelBaseURLs) {
+		baseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+	if baseURL == "" {
+		return nil, errors.Errorf("moderation channel %d has no base url", rule.ChannelId)
+	}
+	key := channel.Key
+	if channel.IsMultiKey() {
+		pooled, err := model.SelectChannelKey(channel)
+		if err != nil {
+			return nil, errors.Wrapf(err, "select key of moderation channel %d", rule.ChannelId)
+		}
+		key = pooled.Key
+	}
+	cfg, _ := channel.LoadConfig()
+
+	apiType := channeltype.ToAPIType(channel.Type)
+	moderationAdaptor := relay.GetAdaptor(apiType)
+	if moderationAdaptor == nil {
+		return nil, errors.Errorf("moderation channel %d has no adaptor for api type %d", rule.ChannelId, apiType)
+	}
+	moderationMeta := &metalib.Meta{
+		Mode:            relaymode.Moderations,
+		ChannelType:     channel.Type,
+		ChannelId:       channel.Id,
+		BaseURL:         strings.TrimSuffix(baseURL, "/"),
+		APIKey:          key,
+		APIType:         apiType,
+		Config:          cfg,
+		OriginModelName: rule.Model,
+		ActualModelName: rule.Model,
+		RequestURLPath:  "/v1/moderations",
+	}
+	moderationAdaptor.Init(moderationMeta)
+	requestURL, err := moderationAdaptor.GetRequestURL(moderationMeta)
+	if err != nil {
+		return nil, errors.Wrap(err, "get moderation request url")
+	}
+
+	payload, err := json.Marshal(map[string]any{"model": rule.Model, "input": text})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal moderation request")
+	}
+	ctx, cancel := context.WithTimeout(gmw.Ctx(c), moderationTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "build moderation request")
+	}
+	if err := moderationAdaptor.SetupRequestHeader(c, req, moderationMeta); err != nil {
+		return nil, errors.Wrap(err, "setup moderation request header")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "call moderation channel")
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, "read moderation response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("moderation channel returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var parsed moderationResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, errors.Wrap(err, "unmarshal moderation response")
+	}
+
+	var categories []string
+	flagged := false
+	for _, result := range parsed.Results {
+		if !result.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range result.Categories {
+			if hit {
+				categories = append(categories, category)
+			}
+		}
+	}
+	if !flagged {
+		return nil, nil
+	}
+	if len(categories) == 0 {
+		categories = []string{"flagged"}
+	}
+	slices.Sort(categories)
+	return slices.Compact(categories), nil
+}
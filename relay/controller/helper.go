@@ -13,9 +13,11 @@ import (
 	"github.com/songquanpeng/one-api/common"
 	"github.com/songquanpeng/one-api/common/config"
 	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/metrics"
 	"github.com/songquanpeng/one-api/common/tracing"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
 	"github.com/songquanpeng/one-api/relay/adaptor/openai"
 	"github.com/songquanpeng/one-api/relay/billing"
 	"github.com/songquanpeng/one-api/relay/billing/ratio"
@@ -24,6 +26,8 @@ import (
 	"github.com/songquanpeng/one-api/relay/controller/validator"
 	"github.com/songquanpeng/one-api/relay/meta"
 	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
 	quotautil "github.com/songquanpeng/one-api/relay/quota"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
@@ -63,10 +67,7 @@ func getAndValidateTextRequest(c *gin.Context, relayMode int) (*relaymodel.Gener
 func maybeHandleRealtime(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	m := meta.GetByContext(c)
 	if m.Mode == relaymode.Realtime && m.ChannelType == channeltype.OpenAI {
-		if bizErr, _ := openai.RealtimeHandler(c, m); bizErr != nil {
-			return bizErr
-		}
-		return nil
+		return RelayRealtimeHelper(c)
 	}
 	return nil
 }
@@ -122,20 +123,25 @@ func getPreConsumedQuota(textRequest *relaymodel.GeneralOpenAIRequest, promptTok
 }
 
 func preConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIRequest, promptTokens int, ratio float64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
+	return preConsumeFixedQuota(c, getPreConsumedQuota(textRequest, promptTokens, ratio), meta)
+}
+
+// preConsumeFixedQuota checks the user quota against an already computed estimate and
+// reserves it on the token, unless the user and token hold far more quota than needed.
+func preConsumeFixedQuota(c *gin.Context, preConsumedQuota int64, meta *meta.Meta) (int64, *relaymodel.ErrorWithStatusCode) {
 	ctx := gmw.Ctx(c)
 	lg := gmw.GetLogger(c)
-	preConsumedQuota := getPreConsumedQuota(textRequest, promptTokens, ratio)
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetQuotaPool(ctx, meta.UserId, meta.OrganizationId)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
 	if userQuota-preConsumedQuota < 0 {
 		return preConsumedQuota, openai.ErrorWrapper(errors.New("user quota is not enough"), "insufficient_user_quota", http.StatusForbidden)
 	}
-	err = model.CacheDecreaseUserQuota(ctx, meta.UserId, preConsumedQuota)
+	err = model.CacheDecreaseQuotaPool(ctx, meta.UserId, meta.OrganizationId, preConsumedQuota)
 	if err != nil {
 		return preConsumedQuota, openai.ErrorWrapper(err, "decrease_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -155,6 +161,42 @@ func preConsumeQuota(c *gin.Context, textRequest *relaymodel.GeneralOpenAIReques
 	return preConsumedQuota, nil
 }
 
+// appendPromptCacheAffinity records how prompt-cache affinity routed the request in the
+// consume log metadata and the affinity metrics, so cached prompt tokens can be compared
+// between requests that stayed on their bound channel and those that did not.
+func appendPromptCacheAffinity(metadata model.LogMetadata, meta *meta.Meta, promptTokens, cachedPromptTokens int) model.LogMetadata {
+	if meta.PromptCacheAffinitySource == "" {
+		return metadata
+	}
+	hit := meta.PromptCacheAffinityChannelId != 0 && meta.PromptCacheAffinityChannelId == meta.ChannelId
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	metrics.GlobalRecorder.RecordPromptCacheAffinity(meta.PromptCacheAffinitySource, result, promptTokens, cachedPromptTokens)
+	return model.AppendPromptCacheAffinityMetadata(metadata, meta.PromptCacheAffinitySource, hit)
+}
+
+// getPricingAdaptor returns the adaptor that prices modelName for channels of channelType,
+// with the model pricing of the request's pricing rule applied when it sets one.
+func getPricingAdaptor(ctx context.Context, channelType int, modelName string) adaptor.Adaptor {
+	base := relay.GetAdaptor(channelType)
+	rule := pricingrule.FromContext(ctx)
+	if rule == nil || rule.Pricing == nil {
+		return base
+	}
+
+	var channelModelRatio, channelCompletionRatio map[string]float64
+	if ginCtx, ok := gmw.GetGinCtxFromStdCtx(ctx); ok {
+		value, _ := ginCtx.Get(ctxkey.ChannelModel)
+		if channel, ok := value.(*model.Channel); ok {
+			channelModelRatio = channel.GetModelRatioFromConfigs()
+			channelCompletionRatio = channel.GetCompletionRatioFromConfigs()
+		}
+	}
+	return pricing.ApplyPricingRule(base, modelName, channelModelRatio, channelCompletionRatio, rule.Pricing)
+}
+
 func postConsumeQuota(ctx context.Context,
 	usage *relaymodel.Usage,
 	meta *meta.Meta,
@@ -171,7 +213,7 @@ func postConsumeQuota(ctx context.Context,
 		return
 	}
 
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(ctx, meta.ChannelType, textRequest.Model)
 	computeResult := quotautil.Compute(quotautil.ComputeInput{
 		Usage:                  usage,
 		ModelName:              textRequest.Model,
@@ -194,6 +236,10 @@ func postConsumeQuota(ctx context.Context,
 		requestId = ginCtx.GetString(ctxkey.RequestId)
 	}
 	traceId := tracing.GetTraceIDFromContext(ctx)
+	metadata := model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens)
+	metadata = model.AppendGuardrailMetadata(metadata, meta.GuardrailViolations)
+	metadata = model.AppendModelFallbackMetadata(metadata, meta.FallbackFromModel)
+	metadata = appendPromptCacheAffinity(metadata, meta, computeResult.PromptTokens, computeResult.CachedPromptTokens)
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
 			Ctx:                    ctx,
@@ -217,7 +263,7 @@ func postConsumeQuota(ctx context.Context,
 			CachedCompletionTokens: 0,
 			CacheWrite5mTokens:     usage.CacheWrite5mTokens,
 			CacheWrite1hTokens:     usage.CacheWrite1hTokens,
-			Metadata:               model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens),
+			Metadata:               metadata,
 			RequestId:              requestId,
 			TraceId:                traceId,
 		})
@@ -250,7 +296,7 @@ func postConsumeQuotaWithTraceID(ctx context.Context, traceId string,
 		return
 	}
 
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(ctx, meta.ChannelType, textRequest.Model)
 	computeResult := quotautil.Compute(quotautil.ComputeInput{
 		Usage:                  usage,
 		ModelName:              textRequest.Model,
@@ -271,6 +317,10 @@ func postConsumeQuotaWithTraceID(ctx context.Context, traceId string,
 	if ginCtx, ok := gmw.GetGinCtxFromStdCtx(ctx); ok {
 		requestId = ginCtx.GetString(ctxkey.RequestId)
 	}
+	metadata := model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens)
+	metadata = model.AppendGuardrailMetadata(metadata, meta.GuardrailViolations)
+	metadata = model.AppendModelFallbackMetadata(metadata, meta.FallbackFromModel)
+	metadata = appendPromptCacheAffinity(metadata, meta, computeResult.PromptTokens, computeResult.CachedPromptTokens)
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
 			Ctx:                    ctx,
@@ -294,7 +344,7 @@ func postConsumeQuotaWithTraceID(ctx context.Context, traceId string,
 			CachedCompletionTokens: 0,
 			CacheWrite5mTokens:     usage.CacheWrite5mTokens,
 			CacheWrite1hTokens:     usage.CacheWrite1hTokens,
-			Metadata:               model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens),
+			Metadata:               metadata,
 			RequestId:              requestId,
 			TraceId:                traceId,
 		})
@@ -319,7 +319,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 
 	// Resolve model ratio using unified three-layer pricing (channel overrides → adapter defaults → global fallback)
 	// IMPORTANT: Use APIType here (adaptor family), not ChannelType. ChannelType IDs do not map to adaptor switch.
-	pricingAdaptor := relay.GetAdaptor(meta.APIType)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.APIType, imageModel)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(imageModel, channelModelRatio, pricingAdaptor)
 	// groupRatio := billingratio.GetGroupRatio(meta.Group)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
@@ -344,7 +344,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 	}
 
 	ratio := modelRatio * groupRatio
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetQuotaPool(ctx, meta.UserId, meta.OrganizationId)
 
 	var usedQuota int64
 	var preConsumedQuota int64
@@ -452,6 +452,7 @@ func RelayImageHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 				PromptTokens:     promptTokens,
 				CompletionTokens: completionTokens,
 				ModelName:        imageRequest.Model,
+				TokenId:          meta.TokenId,
 				TokenName:        tokenName,
 				Quota:            int(usedQuota),
 				Content:          logContent,
@@ -60,6 +60,7 @@ func RelayProxyHelper(c *gin.Context, relayMode int) *relaymodel.ErrorWithStatus
 			PromptTokens:     usage.PromptTokens,
 			CompletionTokens: usage.CompletionTokens,
 			ModelName:        "proxy",
+			TokenId:          meta.TokenId,
 			TokenName:        meta.TokenName,
 			Quota:            0,
 			Content:          "proxy request, no quota consumption",
@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	quotautil "github.com/songquanpeng/one-api/relay/quota"
+	"github.com/songquanpeng/one-api/relay/streaming"
+)
+
+// RelayRealtimeHelper proxies an OpenAI Realtime WebSocket session and bills it like a
+// streaming chat completion: quota is pre-consumed before the upgrade, every response.done
+// event is charged through the streaming quota tracker, and the session is closed once the
+// user runs out of quota. A consume log with the text/audio split is written on close.
+//
+// A non-nil error means the WebSocket was never established and a JSON error can be returned.
+func RelayRealtimeHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+	meta := metalib.GetByContext(c)
+	if meta.ChannelType != channeltype.OpenAI {
+		return openai.ErrorWrapper(errors.Errorf("channel type %d does not support realtime", meta.ChannelType),
+			"realtime_not_supported", http.StatusBadRequest)
+	}
+	meta.IsStream = true
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, meta.ActualModelName)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(meta.ActualModelName, channelModelRatio, pricingAdaptor)
+	completionRatio := pricing.GetCompletionRatioWithThreeLayers(meta.ActualModelName, channelCompletionRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	ratio := modelRatio * groupRatio
+
+	request := &relaymodel.GeneralOpenAIRequest{Model: meta.ActualModelName}
+	preConsumedQuota, bizErr := preConsumeQuota(c, request, 0, ratio, meta)
+	if bizErr != nil {
+		lg.Warn("preConsumeQuota failed",
+			zap.Error(bizErr.RawError),
+			zap.Int("status_code", bizErr.StatusCode),
+			zap.String("err_msg", bizErr.Message))
+		return bizErr
+	}
+
+	tracker := streaming.NewQuotaTracker(streaming.QuotaTrackerParams{
+		UserID:                 meta.UserId,
+		OrganizationID:         meta.OrganizationId,
+		TokenID:                meta.TokenId,
+		ChannelID:              meta.ChannelId,
+		ModelName:              meta.ActualModelName,
+		ModelRatio:             modelRatio,
+		GroupRatio:             groupRatio,
+		PreConsumedQuota:       preConsumedQuota,
+		ChannelCompletionRatio: channelCompletionRatio,
+		PricingAdaptor:         pricingAdaptor,
+		FlushInterval:          time.Duration(config.StreamingBillingIntervalSec) * time.Second,
+		Ctx:                    ctx,
+	})
+	streaming.StoreTracker(c, tracker)
+
+	bizErr, usage := openai.RealtimeHandler(c, meta, completionRatio)
+	if bizErr != nil {
+		graceful.GoCritical(ctx, "returnPreConsumedQuota", func(cctx context.Context) {
+			billing.ReturnPreConsumedQuota(cctx, preConsumedQuota, meta.TokenId)
+		})
+		return bizErr
+	}
+
+	// Quota exhaustion already closed the session; the turn that crossed the limit was
+	// served by upstream, so the full usage is still billed below.
+	_, charged, trackerErr := tracker.Finalize(nil)
+	if trackerErr != nil {
+		lg.Warn("realtime session ended with billing error", zap.Error(trackerErr))
+	}
+
+	requestId := c.GetString(ctxkey.RequestId)
+	traceId := tracing.GetTraceID(c)
+	graceful.GoCritical(gmw.BackgroundCtx(c), "postRealtimeBilling", func(bctx context.Context) {
+		bctx, cancel := context.WithTimeout(bctx, time.Duration(config.BillingTimeoutSec)*time.Second)
+		defer cancel()
+		postConsumeRealtimeQuota(bctx, meta, usage, preConsumedQuota, charged,
+			modelRatio, groupRatio, channelCompletionRatio, requestId, traceId)
+	})
+
+	return nil
+}
+
+// postConsumeRealtimeQuota settles the difference between the session cost and what was
+// already charged, and records the consume log.
+func postConsumeRealtimeQuota(ctx context.Context, meta *metalib.Meta,
+	usage *relaymodel.Usage, preConsumedQuota, charged int64,
+	modelRatio, groupRatio float64, channelCompletionRatio map[string]float64,
+	requestId, traceId string) {
+	if usage == nil {
+		usage = &relaymodel.Usage{}
+	}
+
+	computeResult := quotautil.Compute(quotautil.ComputeInput{
+		Usage:                  usage,
+		ModelName:              meta.ActualModelName,
+		ModelRatio:             modelRatio,
+		GroupRatio:             groupRatio,
+		ChannelCompletionRatio: channelCompletionRatio,
+		PricingAdaptor:         getPricingAdaptor(ctx, meta.ChannelType, meta.ActualModelName),
+	})
+	quota := computeResult.TotalQuota
+	if computeResult.PromptTokens+computeResult.CompletionTokens == 0 {
+		quota = 0
+	}
+
+	var inputText, inputAudio, outputText, outputAudio int
+	if usage.PromptTokensDetails != nil {
+		inputText = usage.PromptTokensDetails.TextTokens
+		inputAudio = usage.PromptTokensDetails.AudioTokens
+	}
+	if usage.CompletionTokensDetails != nil {
+		outputText = usage.CompletionTokensDetails.TextTokens
+		outputAudio = usage.CompletionTokensDetails.AudioTokens
+	}
+
+	billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
+		Ctx:                ctx,
+		TokenId:            meta.TokenId,
+		QuotaDelta:         quota - preConsumedQuota - charged,
+		TotalQuota:         quota,
+		UserId:             meta.UserId,
+		ChannelId:          meta.ChannelId,
+		PromptTokens:       computeResult.PromptTokens,
+		CompletionTokens:   computeResult.CompletionTokens,
+		ModelRatio:         computeResult.UsedModelRatio,
+		GroupRatio:         groupRatio,
+		ModelName:          meta.ActualModelName,
+		TokenName:          meta.TokenName,
+		IsStream:           true,
+		StartTime:          meta.StartTime,
+		CompletionRatio:    computeResult.UsedCompletionRatio,
+		CachedPromptTokens: computeResult.CachedPromptTokens,
+		Metadata:           model.AppendModalityTokensMetadata(nil, inputText, inputAudio, outputText, outputAudio),
+		RequestId:          requestId,
+		TraceId:            traceId,
+	})
+
+	if requestId != "" {
+		if err := model.UpdateUserRequestCostQuotaByRequestID(meta.UserId, requestId, quota); err != nil {
+			gmw.GetLogger(ctx).Warn("update realtime request cost failed",
+				zap.Error(err), zap.String("request_id", requestId))
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/billing"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	quotautil "github.com/songquanpeng/one-api/relay/quota"
+)
+
+// rerankDocumentsPerSearchUnit is the number of documents billed as one search unit when
+// the upstream does not report billed units itself.
+const rerankDocumentsPerSearchUnit = 100
+
+// RelayRerankHelper handles /v1/rerank requests.
+//
+// The normalized Cohere/Jina-style request is converted by the channel adaptor when it
+// implements adaptor.RerankAdaptor; other adaptors are relayed by RelayTextHelper. Models
+// priced per search unit or per document in their ModelConfig are billed by those units;
+// all other models are billed by prompt tokens.
+func RelayRerankHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+	meta := metalib.GetByContext(c)
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	rerankAdaptor, ok := adaptorInstance.(adaptor.RerankAdaptor)
+	if !ok {
+		// adaptors without a rerank implementation, such as Baidu v2 /v2/rerankers, keep
+		// going through the text relay as they did before rerank had its own helper
+		return RelayTextHelper(c)
+	}
+	if err := logClientRequestPayload(c, "rerank"); err != nil {
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	rerankRequest := &relaymodel.RerankRequest{}
+	if err := common.UnmarshalBodyReusable(c, rerankRequest); err != nil {
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	if err := rerankRequest.Validate(); err != nil {
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+
+	meta.OriginModelName = rerankRequest.Model
+	rerankRequest.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	adaptorInstance.Init(meta)
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(rerankRequest.Model, channelModelRatio, adaptorInstance)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	searchUnitPriceUsd, documentPriceUsd := getRerankPrice(rerankRequest.Model, adaptorInstance)
+	unitPriced := searchUnitPriceUsd > 0 || documentPriceUsd > 0
+
+	documents := len(rerankRequest.Documents)
+	promptTokens := countRerankTokens(rerankRequest)
+	meta.PromptTokens = promptTokens
+
+	var estimatedQuota int64
+	if unitPriced {
+		estimatedQuota = rerankUnitQuota(estimateRerankSearchUnits(documents), documents, searchUnitPriceUsd, documentPriceUsd, groupRatio)
+	} else {
+		estimatedQuota = int64(float64(config.PreConsumedQuota+int64(promptTokens)) * modelRatio * groupRatio)
+	}
+	preConsumedQuota, bizErr := preConsumeFixedQuota(c, estimatedQuota, meta)
+	if bizErr != nil {
+		lg.Warn("preConsumeQuota failed",
+			zap.Int("status_code", bizErr.StatusCode),
+			zap.Error(bizErr.RawError))
+		return bizErr
+	}
+
+	convertedRequest, err := rerankAdaptor.ConvertRerankRequest(c, rerankRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "invalid_rerank_request", http.StatusBadRequest)
+	}
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "marshal_rerank_request_failed", http.StatusInternalServerError)
+	}
+
+	resp, err := adaptorInstance.DoRequest(c, meta, bytes.NewReader(jsonData))
+	if err != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	// adaptors calling an SDK, such as AWS Bedrock, return no response here
+	if resp != nil && resp.StatusCode != http.StatusOK {
+		graceful.GoCritical(ctx, "returnPreConsumedQuota", func(cctx context.Context) {
+			billing.ReturnPreConsumedQuota(cctx, preConsumedQuota, meta.TokenId)
+		})
+		return RelayErrorHandlerWithContext(c, resp)
+	}
+
+	rerankResponse, respErr := rerankAdaptor.DoRerankResponse(c, resp, meta)
+	if respErr != nil {
+		billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+		return respErr
+	}
+	rerankResponse.ApplyRequest(rerankRequest)
+
+	searchUnits := rerankResponse.SearchUnits()
+	if searchUnits <= 0 {
+		searchUnits = estimateRerankSearchUnits(documents)
+	}
+	usage := rerankResponse.Usage
+	if usage == nil || usage.PromptTokens <= 0 {
+		usage = &relaymodel.Usage{PromptTokens: promptTokens, TotalTokens: promptTokens}
+	}
+	rerankResponse.Usage = usage
+	if unitPriced {
+		rerankResponse.Meta = &relaymodel.RerankMeta{BilledUnits: &relaymodel.RerankBilledUnits{SearchUnits: searchUnits}}
+	}
+	c.JSON(http.StatusOK, rerankResponse)
+
+	var quota int64
+	var usedModelRatio float64
+	if unitPriced {
+		quota = rerankUnitQuota(searchUnits, documents, searchUnitPriceUsd, documentPriceUsd, groupRatio)
+	} else {
+		computeResult := quotautil.Compute(quotautil.ComputeInput{
+			Usage:                  usage,
+			ModelName:              rerankRequest.Model,
+			ModelRatio:             modelRatio,
+			GroupRatio:             groupRatio,
+			ChannelCompletionRatio: channelCompletionRatio,
+			PricingAdaptor:         adaptorInstance,
+		})
+		quota = computeResult.TotalQuota
+		usedModelRatio = computeResult.UsedModelRatio
+	}
+
+	userId := strconv.Itoa(meta.UserId)
+	username := c.GetString(ctxkey.Username)
+	if username == "" {
+		username = "unknown"
+	}
+	group := meta.Group
+	if group == "" {
+		group = "default"
+	}
+	metrics.GlobalRecorder.RecordRelayRequest(
+		meta.StartTime,
+		meta.ChannelId,
+		channeltype.IdToName(meta.ChannelType),
+		meta.ActualModelName,
+		userId,
+		true,
+		usage.PromptTokens,
+		0,
+		float64(quota),
+	)
+	metrics.GlobalRecorder.RecordUserMetrics(
+		userId,
+		username,
+		group,
+		float64(quota),
+		usage.PromptTokens,
+		0,
+		float64(c.GetInt64(ctxkey.UserQuota)),
+	)
+	metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
+
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+	traceId := tracing.GetTraceID(c)
+	graceful.GoCritical(gmw.BackgroundCtx(c), "postBilling", func(ctx context.Context) {
+		billingTimeout := time.Duration(config.BillingTimeoutSec) * time.Second
+		ctx, cancel := context.WithTimeout(ctx, billingTimeout)
+		defer cancel()
+
+		done := make(chan bool, 1)
+		go func() {
+			billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
+				Ctx:          ctx,
+				TokenId:      meta.TokenId,
+				QuotaDelta:   quota - preConsumedQuota,
+				TotalQuota:   quota,
+				UserId:       meta.UserId,
+				ChannelId:    meta.ChannelId,
+				PromptTokens: usage.PromptTokens,
+				ModelRatio:   usedModelRatio,
+				GroupRatio:   groupRatio,
+				ModelName:    rerankRequest.Model,
+				TokenName:    meta.TokenName,
+				StartTime:    meta.StartTime,
+				Metadata:     model.AppendRerankMetadata(nil, documents, searchUnits),
+				RequestId:    requestId,
+				TraceId:      traceId,
+			})
+			if requestId != "" {
+				if err := model.UpdateUserRequestCostQuotaByRequestID(quotaId, requestId, quota); err != nil {
+					lg.Error("update user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+				}
+			}
+			done <- true
+		}()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				elapsedTime := time.Since(meta.StartTime)
+				lg.Error("CRITICAL BILLING TIMEOUT",
+					zap.String("model", rerankRequest.Model),
+					zap.String("requestId", requestId),
+					zap.Int("userId", meta.UserId),
+					zap.Int64("estimatedQuota", quota),
+					zap.Duration("elapsedTime", elapsedTime))
+				metrics.GlobalRecorder.RecordBillingTimeout(meta.UserId, meta.ChannelId, rerankRequest.Model, float64(quota), elapsedTime)
+			}
+		}
+	})
+
+	return nil
+}
+
+// getRerankPrice returns the per-search-unit and per-document USD prices of a rerank model,
+// preferring the adaptor's pricing over the global pricing table.
+func getRerankPrice(modelName string, pricingAdaptor adaptor.Adaptor) (searchUnitPriceUsd, documentPriceUsd float64) {
+	if pricingAdaptor != nil {
+		if pm, ok := pricingAdaptor.GetDefaultModelPricing()[modelName]; ok {
+			searchUnitPriceUsd, documentPriceUsd = pm.SearchUnitPriceUsd, pm.DocumentPriceUsd
+		}
+	}
+	if searchUnitPriceUsd == 0 && documentPriceUsd == 0 {
+		if pm, ok := pricing.GetGlobalModelPricing()[modelName]; ok {
+			searchUnitPriceUsd, documentPriceUsd = pm.SearchUnitPriceUsd, pm.DocumentPriceUsd
+		}
+	}
+	return searchUnitPriceUsd, documentPriceUsd
+}
+
+// estimateRerankSearchUnits counts the search units of a request the way Cohere bills them:
+// one unit for every started block of 100 documents.
+func estimateRerankSearchUnits(documents int) int {
+	return max(1, (documents+rerankDocumentsPerSearchUnit-1)/rerankDocumentsPerSearchUnit)
+}
+
+// rerankUnitQuota converts the search units and documents of a request into quota.
+func rerankUnitQuota(searchUnits, documents int, searchUnitPriceUsd, documentPriceUsd, groupRatio float64) int64 {
+	usd := float64(searchUnits)*searchUnitPriceUsd + float64(documents)*documentPriceUsd
+	return int64(math.Ceil(usd * billingratio.QuotaPerUsd * groupRatio))
+}
+
+// countRerankTokens estimates the prompt tokens of a rerank request from its query and documents.
+func countRerankTokens(request *relaymodel.RerankRequest) int {
+	tokens := openai.CountTokenText(request.Query, request.Model)
+	for _, text := range request.DocumentTexts() {
+		tokens += openai.CountTokenText(text, request.Model)
+	}
+	return tokens
+}
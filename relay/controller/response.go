@@ -47,6 +47,13 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "invalid_response_api_request", http.StatusBadRequest)
 	}
 
+	// run input guardrails before the body is parsed, so redactions reach the upstream
+	guard, guardErr := applyGuardrails(c, meta)
+	if guardErr != nil {
+		return guardErr
+	}
+	defer guard.finish()
+
 	// get & validate Response API request
 	responseAPIRequest, err := getAndValidateResponseAPIRequest(c)
 	if err != nil {
@@ -64,9 +71,28 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	// 	lg.Debug("get response api request", zap.ByteString("body", reqBody.([]byte)))
 	// }
 
+	// previous_response_id may name a response stored by the ChatCompletion fallback,
+	// whose history only this gateway knows
+	c.Set(ctxkey.ResponseAPIInputItems, responseAPIRequest.Input)
+	expanded, err := expandStoredResponseHistory(c, responseAPIRequest)
+	if err != nil {
+		return openai.ErrorWrapper(err, "load_previous_response_failed", http.StatusInternalServerError)
+	}
+
 	// Route channels without native Response API support through the ChatCompletion fallback
 	if !supportsNativeResponseAPI(meta) {
-		return relayResponseAPIThroughChat(c, meta, responseAPIRequest)
+		if !expanded && responseAPIRequest.PreviousResponseId != nil && *responseAPIRequest.PreviousResponseId != "" {
+			return openai.ErrorWrapper(errors.Errorf("previous response %s not found", *responseAPIRequest.PreviousResponseId),
+				"previous_response_not_found", http.StatusNotFound)
+		}
+		if hasMCPTools(responseAPIRequest) {
+			return relayResponseAPIWithMCP(c, meta, responseAPIRequest, guard)
+		}
+		return relayResponseAPIThroughChat(c, meta, responseAPIRequest, guard)
+	}
+	if expanded {
+		// the upstream does not know the stored response, send the rebuilt history instead
+		responseAPIRequest.PreviousResponseId = nil
 	}
 
 	// Map model name for pass-through: record origin and apply mapped model
@@ -80,7 +106,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
 
 	// get model ratio using three-layer pricing system
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, responseAPIRequest.Model)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(responseAPIRequest.Model, channelModelRatio, pricingAdaptor)
 	completionRatio := pricing.GetCompletionRatioWithThreeLayers(responseAPIRequest.Model, channelCompletionRatio, pricingAdaptor)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
@@ -177,6 +203,7 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	} else {
 		logUpstreamResponseFromBytes(lg, resp, nil, "response_api")
 	}
+	guard.collect(meta)
 	if respErr != nil {
 		// If usage is available even though writing to client failed (e.g., client cancelled),
 		// proceed to billing to ensure forwarded requests are charged; do not refund pre-consumed quota.
@@ -247,31 +274,15 @@ func RelayResponseAPIHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	return nil
 }
 
-func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPIRequest *openai.ResponseAPIRequest) *relaymodel.ErrorWithStatusCode {
+func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPIRequest *openai.ResponseAPIRequest, guard *guardrailRun) *relaymodel.ErrorWithStatusCode {
 	lg := gmw.GetLogger(c)
 	ctx := gmw.Ctx(c)
 
-	chatRequest, err := openai.ConvertResponseAPIToChatCompletionRequest(responseAPIRequest)
+	chatRequest, err := convertResponseAPIToFallbackChat(c, meta, responseAPIRequest)
 	if err != nil {
 		return openai.ErrorWrapper(err, "convert_response_api_request_failed", http.StatusBadRequest)
 	}
-
-	meta.Mode = relaymode.ChatCompletions
 	meta.IsStream = chatRequest.Stream
-	sanitizeChatCompletionRequest(chatRequest)
-	meta.OriginModelName = chatRequest.Model
-	chatRequest.Model = metalib.GetMappedModelName(meta.OriginModelName, meta.ModelMapping)
-	meta.ActualModelName = chatRequest.Model
-	if isDeepSeekModel(meta.ActualModelName) || isDeepSeekModel(meta.OriginModelName) {
-		meta.APIType = apitype.DeepSeek
-	}
-	applyThinkingQueryToChatRequest(c, chatRequest, meta)
-	meta.RequestURLPath = "/v1/chat/completions"
-	meta.ResponseAPIFallback = true
-	if c.Request != nil && c.Request.URL != nil {
-		c.Request.URL.Path = "/v1/chat/completions"
-		c.Request.URL.RawPath = "/v1/chat/completions"
-	}
 	metalib.Set2Context(c, meta)
 
 	origWriter := c.Writer
@@ -301,7 +312,7 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 	}
 
 	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, chatRequest.Model)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(chatRequest.Model, channelModelRatio, pricingAdaptor)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
 	ratio := modelRatio * groupRatio
@@ -449,6 +460,7 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 		metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
 	}
 
+	guard.collect(meta)
 	quotaId := c.GetInt(ctxkey.Id)
 	requestId := c.GetString(ctxkey.RequestId)
 
@@ -492,15 +504,61 @@ func relayResponseAPIThroughChat(c *gin.Context, meta *metalib.Meta, responseAPI
 	return nil
 }
 
+// convertResponseAPIToFallbackChat converts a Response API request into the ChatCompletion
+// request sent by the fallback, and switches meta and the request path to ChatCompletions.
+func convertResponseAPIToFallbackChat(c *gin.Context, meta *metalib.Meta, responseAPIRequest *openai.ResponseAPIRequest) (*relaymodel.GeneralOpenAIRequest, error) {
+	chatRequest, err := openai.ConvertResponseAPIToChatCompletionRequest(responseAPIRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "convert response api request")
+	}
+
+	meta.Mode = relaymode.ChatCompletions
+	sanitizeChatCompletionRequest(chatRequest)
+	meta.OriginModelName = chatRequest.Model
+	chatRequest.Model = metalib.GetMappedModelName(meta.OriginModelName, meta.ModelMapping)
+	meta.ActualModelName = chatRequest.Model
+	if isDeepSeekModel(meta.ActualModelName) || isDeepSeekModel(meta.OriginModelName) {
+		meta.APIType = apitype.DeepSeek
+	}
+	applyThinkingQueryToChatRequest(c, chatRequest, meta)
+	meta.RequestURLPath = "/v1/chat/completions"
+	meta.ResponseAPIFallback = true
+	if c.Request != nil && c.Request.URL != nil {
+		c.Request.URL.Path = "/v1/chat/completions"
+		c.Request.URL.RawPath = "/v1/chat/completions"
+	}
+	return chatRequest, nil
+}
+
 func renderChatResponseAsResponseAPI(c *gin.Context, status int, textResp *openai_compatible.SlimTextResponse, originalReq *openai.ResponseAPIRequest, meta *metalib.Meta) error {
 	c.Set(ctxkey.ResponseRewriteApplied, true)
+	response := buildFallbackResponse(c, textResp, originalReq, meta)
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(status)
+	if _, err = c.Writer.Write(data); err != nil {
+		return err
+	}
+	if status == http.StatusOK {
+		storeFallbackResponse(c, meta, originalReq, response)
+	}
+	return nil
+}
+
+// buildFallbackResponse builds the Response API response for a ChatCompletion response.
+func buildFallbackResponse(c *gin.Context, textResp *openai_compatible.SlimTextResponse, originalReq *openai.ResponseAPIRequest, meta *metalib.Meta) *openai.ResponseAPIResponse {
 	responseID := generateResponseAPIID(c, textResp)
 	statusText, incomplete := deriveResponseStatus(textResp.Choices)
 	usage := (&openai.ResponseAPIUsage{}).FromModelUsage(&textResp.Usage)
 	output := buildResponseOutput(textResp.Choices)
 	toolCalls := buildRequiredActionToolCalls(textResp.Choices)
 
-	response := openai.ResponseAPIResponse{
+	response := &openai.ResponseAPIResponse{
 		Id:                 responseID,
 		Object:             "response",
 		CreatedAt:          time.Now().Unix(),
@@ -536,16 +594,7 @@ func renderChatResponseAsResponseAPI(c *gin.Context, status int, textResp *opena
 	if incomplete != nil {
 		response.IncompleteDetails = incomplete
 	}
-
-	data, err := json.Marshal(response)
-	if err != nil {
-		return err
-	}
-
-	c.Writer.Header().Set("Content-Type", "application/json")
-	c.Writer.WriteHeader(status)
-	_, err = c.Writer.Write(data)
-	return err
+	return response
 }
 
 type responseCaptureWriter struct {
@@ -667,17 +716,7 @@ func buildResponseOutput(choices []openai_compatible.TextResponseChoice) []opena
 		}
 
 		for _, tool := range msg.ToolCalls {
-			arguments := ""
-			if tool.Function != nil && tool.Function.Arguments != nil {
-				switch v := tool.Function.Arguments.(type) {
-				case string:
-					arguments = v
-				default:
-					if b, err := json.Marshal(v); err == nil {
-						arguments = string(b)
-					}
-				}
-			}
+			arguments := toolCallArguments(tool)
 			output = append(output, openai.OutputItem{
 				Type:   "function_call",
 				Status: "completed",
@@ -706,17 +745,7 @@ func buildRequiredActionToolCalls(choices []openai_compatible.TextResponseChoice
 			if callID == "" {
 				continue
 			}
-			arguments := ""
-			if tool.Function.Arguments != nil {
-				switch v := tool.Function.Arguments.(type) {
-				case string:
-					arguments = v
-				default:
-					if b, err := json.Marshal(v); err == nil {
-						arguments = string(b)
-					}
-				}
-			}
+			arguments := toolCallArguments(tool)
 			toolCalls = append(toolCalls, openai.ResponseAPIToolCall{
 				Id:   callID,
 				Type: "function",
@@ -730,6 +759,22 @@ func buildRequiredActionToolCalls(choices []openai_compatible.TextResponseChoice
 	return toolCalls
 }
 
+// toolCallArguments returns the arguments of a chat tool call as a JSON string.
+func toolCallArguments(tool relaymodel.Tool) string {
+	if tool.Function == nil || tool.Function.Arguments == nil {
+		return ""
+	}
+	switch v := tool.Function.Arguments.(type) {
+	case string:
+		return v
+	default:
+		if b, err := json.Marshal(v); err == nil {
+			return string(b)
+		}
+		return ""
+	}
+}
+
 func ensureResponseAPICallID(originalID string) string {
 	trimmed := strings.TrimSpace(originalID)
 	if trimmed == "" {
@@ -1022,7 +1067,7 @@ func preConsumeResponseAPIQuota(
 
 	tokenQuota := c.GetInt64(ctxkey.TokenQuota)
 	tokenQuotaUnlimited := c.GetBool(ctxkey.TokenQuotaUnlimited)
-	userQuota, err := model.CacheGetUserQuota(ctx, meta.UserId)
+	userQuota, err := model.CacheGetQuotaPool(ctx, meta.UserId, meta.OrganizationId)
 	if err != nil {
 		return baseQuota, openai.ErrorWrapper(err, "get_user_quota_failed", http.StatusInternalServerError)
 	}
@@ -1083,7 +1128,7 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 		return
 	}
 
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(ctx, meta.ChannelType, responseAPIRequest.Model)
 	computeResult := quotautil.Compute(quotautil.ComputeInput{
 		Usage:                  usage,
 		ModelName:              responseAPIRequest.Model,
@@ -1119,6 +1164,10 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 		requestId = ginCtx.GetString(ctxkey.RequestId)
 	}
 	traceId := tracing.GetTraceIDFromContext(ctx)
+	metadata := model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens)
+	metadata = model.AppendGuardrailMetadata(metadata, meta.GuardrailViolations)
+	metadata = model.AppendModelFallbackMetadata(metadata, meta.FallbackFromModel)
+	metadata = appendPromptCacheAffinity(metadata, meta, promptTokens, cachedPrompt)
 	if meta.TokenId > 0 && meta.UserId > 0 && meta.ChannelId > 0 {
 		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
 			Ctx:                    ctx,
@@ -1142,7 +1191,7 @@ func postConsumeResponseAPIQuota(ctx context.Context,
 			CachedCompletionTokens: 0,
 			CacheWrite5mTokens:     usage.CacheWrite5mTokens,
 			CacheWrite1hTokens:     usage.CacheWrite1hTokens,
-			Metadata:               model.AppendCacheWriteTokensMetadata(nil, usage.CacheWrite5mTokens, usage.CacheWrite1hTokens),
+			Metadata:               metadata,
 			RequestId:              requestId,
 			TraceId:                traceId,
 		})
@@ -1234,6 +1283,19 @@ func normalizeResponseAPIRawBody(rawBody []byte, request *openai.ResponseAPIRequ
 		}
 	}
 
+	// a cleared previous_response_id means its history was rebuilt into request.Input
+	if request.PreviousResponseId == nil {
+		if _, ok := root["previous_response_id"]; ok {
+			inputBytes, err := json.Marshal(request.Input)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshal rebuilt response input")
+			}
+			delete(root, "previous_response_id")
+			root["input"] = inputBytes
+			changed = true
+		}
+	}
+
 	if request.Text == nil {
 		if _, ok := root["text"]; ok {
 			delete(root, "text")
@@ -1296,6 +1358,14 @@ func applyResponseAPIStreamParams(c *gin.Context, meta *metalib.Meta) error {
 func RelayResponseAPIGetHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	meta := metalib.GetByContext(c)
 
+	stored, bizErr := getStoredResponse(c)
+	if bizErr != nil {
+		return bizErr
+	}
+	if stored != nil {
+		return serveStoredResponse(c, stored)
+	}
+
 	if meta.ChannelType != channeltype.OpenAI {
 		return openai.ErrorWrapper(errors.New("Response API is only supported for OpenAI channels"), "unsupported_channel", http.StatusBadRequest)
 	}
@@ -1334,6 +1404,37 @@ func RelayResponseAPIDeleteHelper(c *gin.Context) *relaymodel.ErrorWithStatusCod
 	meta.IsStream = false
 	metalib.Set2Context(c, meta)
 
+	stored, bizErr := getStoredResponse(c)
+	if bizErr != nil {
+		return bizErr
+	}
+	if stored != nil {
+		return deleteStoredResponse(c, stored)
+	}
+
+	return relayResponseAPIPassThrough(c, meta)
+}
+
+// RelayResponseAPIInputItemsHelper handles GET /v1/responses/:response_id/input_items requests
+func RelayResponseAPIInputItemsHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	meta := metalib.GetByContext(c)
+	meta.IsStream = false
+	metalib.Set2Context(c, meta)
+
+	stored, bizErr := getStoredResponse(c)
+	if bizErr != nil {
+		return bizErr
+	}
+	if stored != nil {
+		return serveStoredInputItems(c, stored)
+	}
+
+	return relayResponseAPIPassThrough(c, meta)
+}
+
+// relayResponseAPIPassThrough forwards a Response API management request to an OpenAI
+// channel and copies the upstream response verbatim.
+func relayResponseAPIPassThrough(c *gin.Context, meta *metalib.Meta) *relaymodel.ErrorWithStatusCode {
 	if meta.ChannelType != channeltype.OpenAI {
 		return openai.ErrorWrapper(errors.New("Response API is only supported for OpenAI channels"), "unsupported_channel", http.StatusBadRequest)
 	}
@@ -100,7 +100,7 @@ func init() {
 			panic(err)
 		}
 
-		if err := db.AutoMigrate(&model.Trace{}); err != nil {
+		if err := db.AutoMigrate(&model.Trace{}, &model.StoredResponse{}); err != nil {
 			panic(err)
 		}
 
@@ -0,0 +1,463 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/tracing"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/billing"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	quotautil "github.com/songquanpeng/one-api/relay/quota"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// ResponseCacheHeader tells clients whether the reply was replayed from the response cache.
+const ResponseCacheHeader = "X-Response-Cache"
+
+// responseCacheIgnoredFields do not influence the generated reply and are dropped before
+// hashing, so requests differing only in these fields share a cache entry.
+var responseCacheIgnoredFields = []string{
+	"user", "metadata", "stream_options", "store", "safety_identifier", "prompt_cache_key",
+}
+
+// responseCacheEntry is a successful upstream reply that can be replayed byte for byte.
+type responseCacheEntry struct {
+	ContentType      string `json:"content_type"`
+	Body             []byte `json:"body"`
+	ModelName        string `json:"model_name"`
+	ChannelId        int    `json:"channel_id"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	CreatedAt        int64  `json:"created_at"`
+}
+
+// ResponseCache tracks a cacheable request whose reply was not cached yet. The upstream
+// reply is captured while it is written to the client and stored by Store.
+type ResponseCache struct {
+	key    string
+	mode   string
+	stream bool
+	writer *responseCacheCaptureWriter
+}
+
+// LookupResponseCache serves the request from the response cache when possible.
+//
+// Only chat completions, Claude Messages and Response API requests with temperature=0 that
+// are not stored upstream are cacheable, keyed per user on the normalized request body.
+// Clients can bypass the cache with a "Cache-Control: no-cache" header. It returns
+// served=true when the cached reply was written; otherwise a non-nil ResponseCache means the
+// reply should be stored on success.
+//
+// The input guardrails run first, so a cached reply is never served for a request they now
+// block, and the key covers the redacted body. A blocked request is returned as bizErr.
+func LookupResponseCache(c *gin.Context, relayMode int) (rc *ResponseCache, served bool, bizErr *relaymodel.ErrorWithStatusCode) {
+	if !config.ResponseCacheEnabled {
+		return nil, false, nil
+	}
+	mode := responseCacheModeName(relayMode)
+	if mode == "" {
+		return nil, false, nil
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-cache") || strings.Contains(cacheControl, "no-store") {
+		return nil, false, nil
+	}
+	if bizErr = checkInputGuardrails(c); bizErr != nil {
+		return nil, false, bizErr
+	}
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return nil, false, nil
+	}
+	key, stream, ok := responseCacheKey(c.GetInt(ctxkey.Id), c.GetInt(ctxkey.TokenId), relayMode, body)
+	if !ok {
+		return nil, false, nil
+	}
+
+	ctx := gmw.Ctx(c)
+	if entry := getResponseCacheEntry(ctx, key); entry != nil {
+		if serveCachedResponse(c, entry, stream) {
+			metrics.GlobalRecorder.RecordResponseCache(mode, "hit")
+			return nil, true, nil
+		}
+	}
+	metrics.GlobalRecorder.RecordResponseCache(mode, "miss")
+
+	writer := &responseCacheCaptureWriter{ResponseWriter: c.Writer, limit: config.ResponseCacheMaxBodyBytes}
+	c.Writer = writer
+	return &ResponseCache{key: key, mode: mode, stream: stream, writer: writer}, false, nil
+}
+
+// Reset drops the reply captured so far, e.g. before retrying on another channel.
+func (rc *ResponseCache) Reset() {
+	if rc == nil {
+		return
+	}
+	rc.writer.buffer.Reset()
+	rc.writer.overflow = false
+}
+
+// Store saves the captured reply once the request succeeded.
+func (rc *ResponseCache) Store(c *gin.Context) {
+	if rc == nil || rc.writer.overflow || rc.writer.buffer.Len() == 0 || rc.writer.Status() != http.StatusOK {
+		return
+	}
+
+	meta := metalib.GetByContext(c)
+	body := bytes.Clone(rc.writer.buffer.Bytes())
+	promptTokens, completionTokens := extractResponseCacheUsage(body, rc.stream)
+	entry := &responseCacheEntry{
+		ContentType:      rc.writer.Header().Get("Content-Type"),
+		Body:             body,
+		ModelName:        meta.ActualModelName,
+		ChannelId:        meta.ChannelId,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		CreatedAt:        time.Now().Unix(),
+	}
+	if err := setResponseCacheEntry(gmw.Ctx(c), rc.key, entry); err != nil {
+		gmw.GetLogger(c).Warn("store response cache entry failed", zap.Error(err))
+		return
+	}
+	metrics.GlobalRecorder.RecordResponseCache(rc.mode, "store")
+}
+
+func responseCacheModeName(relayMode int) string {
+	switch relayMode {
+	case relaymode.ChatCompletions:
+		return "chat_completions"
+	case relaymode.ClaudeMessages:
+		return "claude_messages"
+	case relaymode.ResponseAPI:
+		return "response_api"
+	default:
+		return ""
+	}
+}
+
+// responseCacheKey normalizes the request body and derives the cache key. Requests that
+// are not deterministic (temperature missing or non-zero, n > 1, background jobs) are not
+// cacheable. Keys are scoped per token, since output guardrails are configured per token
+// and a cached reply must not skip the redaction another token requires.
+func responseCacheKey(userId int, tokenId int, relayMode int, body []byte) (key string, stream bool, ok bool) {
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return "", false, false
+	}
+	temperature, hasTemperature := payload["temperature"].(float64)
+	if !hasTemperature || temperature != 0 {
+		return "", false, false
+	}
+	if n, hasN := payload["n"].(float64); hasN && n > 1 {
+		return "", false, false
+	}
+	if background, _ := payload["background"].(bool); background {
+		return "", false, false
+	}
+	// stored replies must reach the upstream to be retrievable later, and the Response API
+	// stores them unless told otherwise
+	store, hasStore := payload["store"].(bool)
+	if store || (relayMode == relaymode.ResponseAPI && !hasStore) {
+		return "", false, false
+	}
+
+	for _, field := range responseCacheIgnoredFields {
+		delete(payload, field)
+	}
+	stream, _ = payload["stream"].(bool)
+
+	// encoding/json sorts map keys, so the encoding is canonical
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", false, false
+	}
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d:%d:%d:", userId, tokenId, relayMode)
+	hash.Write(normalized)
+	return "response_cache:" + hex.EncodeToString(hash.Sum(nil)), stream, true
+}
+
+// serveCachedResponse replays entry to the client and bills it at ResponseCacheQuotaRatio
+// of the regular price. It returns false without writing anything when the hit cannot be
+// charged, in which case the request goes upstream as usual.
+func serveCachedResponse(c *gin.Context, entry *responseCacheEntry, stream bool) bool {
+	meta := metalib.GetByContext(c)
+	lg := gmw.GetLogger(c)
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, entry.ModelName)
+	modelRatio := pricing.GetModelRatioWithThreeLayers(entry.ModelName, channelModelRatio, pricingAdaptor)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	computeResult := quotautil.Compute(quotautil.ComputeInput{
+		Usage: &relaymodel.Usage{
+			PromptTokens:     entry.PromptTokens,
+			CompletionTokens: entry.CompletionTokens,
+			TotalTokens:      entry.PromptTokens + entry.CompletionTokens,
+		},
+		ModelName:              entry.ModelName,
+		ModelRatio:             modelRatio,
+		GroupRatio:             groupRatio,
+		ChannelCompletionRatio: channelCompletionRatio,
+		PricingAdaptor:         pricingAdaptor,
+	})
+	quotaRatio := max(config.ResponseCacheQuotaRatio, 0)
+	quota := int64(math.Ceil(float64(computeResult.TotalQuota) * quotaRatio))
+	if quota > 0 {
+		remaining, err := model.CacheGetQuotaPool(gmw.Ctx(c), meta.UserId, meta.OrganizationId)
+		if err != nil || remaining < quota {
+			return false
+		}
+		if !c.GetBool(ctxkey.TokenQuotaUnlimited) && c.GetInt64(ctxkey.TokenQuota) < quota {
+			return false
+		}
+	}
+
+	contentType := entry.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+		if stream {
+			contentType = "text/event-stream"
+		}
+	}
+	c.Header("Content-Type", contentType)
+	c.Header(ResponseCacheHeader, "hit")
+	if stream {
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.Status(http.StatusOK)
+	if _, err := c.Writer.Write(entry.Body); err != nil {
+		lg.Warn("write cached response failed", zap.Error(err))
+	}
+
+	channelId := entry.ChannelId
+	if channelId <= 0 {
+		channelId = meta.ChannelId
+	}
+	ageSeconds := max(time.Now().Unix()-entry.CreatedAt, 0)
+	requestId := c.GetString(ctxkey.RequestId)
+	traceId := tracing.GetTraceID(c)
+	graceful.GoCritical(gmw.BackgroundCtx(c), "postResponseCacheBilling", func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(config.BillingTimeoutSec)*time.Second)
+		defer cancel()
+		billing.PostConsumeQuotaDetailed(billing.QuotaConsumeDetail{
+			Ctx:              ctx,
+			TokenId:          meta.TokenId,
+			QuotaDelta:       quota,
+			TotalQuota:       quota,
+			UserId:           meta.UserId,
+			ChannelId:        channelId,
+			PromptTokens:     computeResult.PromptTokens,
+			CompletionTokens: computeResult.CompletionTokens,
+			ModelRatio:       computeResult.UsedModelRatio,
+			GroupRatio:       groupRatio,
+			ModelName:        entry.ModelName,
+			TokenName:        meta.TokenName,
+			IsStream:         stream,
+			StartTime:        meta.StartTime,
+			CompletionRatio:  computeResult.UsedCompletionRatio,
+			Metadata:         model.AppendCacheHitMetadata(nil, ageSeconds, quotaRatio),
+			RequestId:        requestId,
+			TraceId:          traceId,
+		})
+	})
+
+	lg.Debug("served response from cache",
+		zap.String("model", entry.ModelName),
+		zap.Int64("age_seconds", ageSeconds),
+		zap.Int64("quota", quota))
+	return true
+}
+
+// responseCaptureUsage is the subset of OpenAI, Claude and Response API usage objects
+// needed to price a cached reply.
+type responseCaptureUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	InputTokens      int `json:"input_tokens"`
+	OutputTokens     int `json:"output_tokens"`
+}
+
+type responseCapturePayload struct {
+	Usage   *responseCaptureUsage `json:"usage"`
+	Message *struct {
+		Usage *responseCaptureUsage `json:"usage"`
+	} `json:"message"`
+	Response *struct {
+		Usage *responseCaptureUsage `json:"usage"`
+	} `json:"response"`
+}
+
+// extractResponseCacheUsage reads token usage from a JSON reply or from the events of an
+// SSE stream. Streams report usage piecemeal (Claude sends input and output tokens in
+// different events), so the largest value seen for each side wins.
+func extractResponseCacheUsage(body []byte, stream bool) (promptTokens, completionTokens int) {
+	collect := func(data []byte) {
+		var payload responseCapturePayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return
+		}
+		usages := []*responseCaptureUsage{payload.Usage}
+		if payload.Message != nil {
+			usages = append(usages, payload.Message.Usage)
+		}
+		if payload.Response != nil {
+			usages = append(usages, payload.Response.Usage)
+		}
+		for _, usage := range usages {
+			if usage == nil {
+				continue
+			}
+			promptTokens = max(promptTokens, usage.PromptTokens, usage.InputTokens)
+			completionTokens = max(completionTokens, usage.CompletionTokens, usage.OutputTokens)
+		}
+	}
+
+	if !stream {
+		collect(body)
+		return promptTokens, completionTokens
+	}
+	for line := range bytes.SplitSeq(body, []byte("\n")) {
+		data, found := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+		if !found {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+			continue
+		}
+		collect(data)
+	}
+	return promptTokens, completionTokens
+}
+
+// responseCacheCaptureWriter copies the reply into a buffer while it is written to the client.
+// Replies larger than limit are not cached.
+type responseCacheCaptureWriter struct {
+	gin.ResponseWriter
+	buffer   bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCacheCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCacheCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseCacheCaptureWriter) capture(data []byte) {
+	if w.overflow || len(data) == 0 {
+		return
+	}
+	if w.limit > 0 && w.buffer.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buffer.Reset()
+		return
+	}
+	_, _ = w.buffer.Write(data)
+}
+
+// memoryResponseCache keeps cache entries in process when Redis is not available.
+type memoryResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryResponseCacheItem
+}
+
+type memoryResponseCacheItem struct {
+	entry     *responseCacheEntry
+	expiresAt time.Time
+}
+
+var localResponseCache = &memoryResponseCache{entries: map[string]memoryResponseCacheItem{}}
+
+func (m *memoryResponseCache) get(key string, now time.Time) *responseCacheEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if now.After(item.expiresAt) {
+		delete(m.entries, key)
+		return nil
+	}
+	return item.entry
+}
+
+func (m *memoryResponseCache) set(key string, entry *responseCacheEntry, ttl time.Duration, maxEntries int, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[key]; !exists && maxEntries > 0 && len(m.entries) >= maxEntries {
+		for k, item := range m.entries {
+			if now.After(item.expiresAt) {
+				delete(m.entries, k)
+			}
+		}
+		// still full: evict an arbitrary entry
+		for k := range m.entries {
+			if len(m.entries) < maxEntries {
+				break
+			}
+			delete(m.entries, k)
+		}
+	}
+	m.entries[key] = memoryResponseCacheItem{entry: entry, expiresAt: now.Add(ttl)}
+}
+
+func getResponseCacheEntry(ctx context.Context, key string) *responseCacheEntry {
+	if !common.IsRedisEnabled() {
+		return localResponseCache.get(key, time.Now())
+	}
+	raw, err := common.RedisGet(ctx, key)
+	if err != nil {
+		return nil
+	}
+	entry := new(responseCacheEntry)
+	if err = json.Unmarshal([]byte(raw), entry); err != nil {
+		return nil
+	}
+	return entry
+}
+
+func setResponseCacheEntry(ctx context.Context, key string, entry *responseCacheEntry) error {
+	ttl := time.Duration(config.ResponseCacheTTLSec) * time.Second
+	if !common.IsRedisEnabled() {
+		localResponseCache.set(key, entry, ttl, config.ResponseCacheMemoryMaxEntries, time.Now())
+		return nil
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return errors.Wrap(err, "marshal response cache entry")
+	}
+	if err = common.RedisSet(ctx, key, string(raw), ttl); err != nil {
+		return errors.Wrap(err, "set response cache entry")
+	}
+	return nil
+}
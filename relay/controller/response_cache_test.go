@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+func TestResponseCacheKeyNormalization(t *testing.T) {
+	t.Parallel()
+
+	a, stream, ok := responseCacheKey(1, 1, relaymode.ChatCompletions,
+		[]byte(`{"model":"gpt-4o","temperature":0,"user":"ci-1","messages":[{"role":"user","content":"hi"}]}`))
+	require.True(t, ok)
+	require.False(t, stream)
+
+	// field order and ignored fields do not change the key
+	b, _, ok := responseCacheKey(1, 1, relaymode.ChatCompletions,
+		[]byte(`{"messages":[{"role":"user","content":"hi"}],"temperature":0.0,"model":"gpt-4o","user":"ci-2"}`))
+	require.True(t, ok)
+	require.Equal(t, a, b)
+
+	// keys are scoped per user, per token and per relay mode
+	other, _, _ := responseCacheKey(1, 2, relaymode.ChatCompletions,
+		[]byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NotEqual(t, a, other)
+	other, _, _ = responseCacheKey(2, 1, relaymode.ChatCompletions,
+		[]byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NotEqual(t, a, other)
+	other, _, ok = responseCacheKey(1, 1, relaymode.ResponseAPI,
+		[]byte(`{"model":"gpt-4o","temperature":0,"store":false,"messages":[{"role":"user","content":"hi"}]}`))
+	require.True(t, ok)
+	require.NotEqual(t, a, other)
+
+	streamKey, stream, ok := responseCacheKey(1, 1, relaymode.ChatCompletions,
+		[]byte(`{"model":"gpt-4o","temperature":0,"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	require.True(t, ok)
+	require.True(t, stream)
+	require.NotEqual(t, a, streamKey)
+}
+
+func TestResponseCacheKeyRequiresDeterministicRequest(t *testing.T) {
+	t.Parallel()
+
+	for _, body := range []string{
+		`{"model":"gpt-4o","messages":[]}`,
+		`{"model":"gpt-4o","temperature":0.7,"messages":[]}`,
+		`{"model":"gpt-4o","temperature":0,"n":2,"messages":[]}`,
+		`{"model":"gpt-4o","temperature":0,"background":true,"input":"hi"}`,
+		`{"model":"gpt-4o","temperature":0,"store":true,"messages":[]}`,
+		`not json`,
+	} {
+		_, _, ok := responseCacheKey(1, 1, relaymode.ChatCompletions, []byte(body))
+		require.False(t, ok, body)
+	}
+
+	// the Response API stores replies unless store is false
+	_, _, ok := responseCacheKey(1, 1, relaymode.ResponseAPI, []byte(`{"model":"gpt-4o","temperature":0,"input":"hi"}`))
+	require.False(t, ok)
+}
+
+func TestExtractResponseCacheUsage(t *testing.T) {
+	t.Parallel()
+
+	prompt, completion := extractResponseCacheUsage(
+		[]byte(`{"id":"x","usage":{"prompt_tokens":12,"completion_tokens":5,"total_tokens":17}}`), false)
+	require.Equal(t, 12, prompt)
+	require.Equal(t, 5, completion)
+
+	claudeStream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"usage":{"input_tokens":30,"output_tokens":1}}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","usage":{"output_tokens":42}}` + "\n\n"
+	prompt, completion = extractResponseCacheUsage([]byte(claudeStream), true)
+	require.Equal(t, 30, prompt)
+	require.Equal(t, 42, completion)
+
+	responseStream := `data: {"type":"response.completed","response":{"usage":{"input_tokens":8,"output_tokens":3}}}` + "\n\n" +
+		"data: [DONE]\n\n"
+	prompt, completion = extractResponseCacheUsage([]byte(responseStream), true)
+	require.Equal(t, 8, prompt)
+	require.Equal(t, 3, completion)
+}
+
+func TestMemoryResponseCache(t *testing.T) {
+	t.Parallel()
+
+	cache := &memoryResponseCache{entries: map[string]memoryResponseCacheItem{}}
+	now := time.Now()
+
+	cache.set("a", &responseCacheEntry{ModelName: "a"}, time.Minute, 2, now)
+	cache.set("b", &responseCacheEntry{ModelName: "b"}, time.Second, 2, now)
+	require.NotNil(t, cache.get("a", now))
+
+	// expired entries are evicted first when the cache is full
+	later := now.Add(2 * time.Second)
+	cache.set("c", &responseCacheEntry{ModelName: "c"}, time.Minute, 2, later)
+	require.Nil(t, cache.get("b", later))
+	require.NotNil(t, cache.get("a", later))
+	require.NotNil(t, cache.get("c", later))
+	require.Nil(t, cache.get("a", now.Add(2*time.Minute)))
+}
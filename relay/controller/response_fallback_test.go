@@ -740,7 +740,7 @@ func ensureResponseFallbackFixtures(t *testing.T) {
 	t.Helper()
 	ensureResponseFallbackDB(t)
 
-	if err := model.DB.AutoMigrate(&model.User{}, &model.Token{}, &model.Channel{}, &model.UserRequestCost{}, &model.Log{}, &model.Trace{}); err != nil {
+	if err := model.DB.AutoMigrate(&model.User{}, &model.Token{}, &model.Channel{}, &model.UserRequestCost{}, &model.Log{}, &model.Trace{}, &model.StoredResponse{}); err != nil {
 		t.Fatalf("failed to migrate tables: %v", err)
 	}
 
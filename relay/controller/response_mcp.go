@@ -0,0 +1,678 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/graceful"
+	"github.com/songquanpeng/one-api/common/metrics"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/common/render"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai_compatible"
+	"github.com/songquanpeng/one-api/relay/billing"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/mcp"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+const (
+	// mcpFunctionSeparator joins server label and tool name in the function names offered
+	// to the model, e.g. deepwiki__ask_question.
+	mcpFunctionSeparator = "__"
+	// maxFunctionNameLength is the longest function name accepted by OpenAI-compatible upstreams.
+	maxFunctionNameLength = 64
+	// mcpDeclinedOutput is handed to the model for calls the user did not approve.
+	mcpDeclinedOutput = "The user declined to run this tool."
+)
+
+// mcpServer is a remote MCP server declared by a request and connected by the gateway.
+type mcpServer struct {
+	tool   openai.ResponseAPITool
+	client *mcp.Client
+}
+
+// mcpFunction resolves a function offered to the model to the MCP tool it stands for.
+type mcpFunction struct {
+	server *mcpServer
+	name   string
+}
+
+// mcpToolset holds the MCP servers of one Response API request.
+type mcpToolset struct {
+	servers   map[string]*mcpServer
+	functions map[string]mcpFunction
+	// tools are the function tools offered to the model
+	tools []relaymodel.Tool
+	// listItems are the mcp_list_tools output items, one per server
+	listItems []openai.OutputItem
+}
+
+// mcpCallRequest is an MCP tool call requested by the model.
+type mcpCallRequest struct {
+	// id is the tool call id, or the approval request id for approved calls
+	id          string
+	serverLabel string
+	name        string
+	arguments   string
+}
+
+// mcpRound is one billed model round-trip of the MCP tool loop.
+type mcpRound struct {
+	chatRequest *relaymodel.GeneralOpenAIRequest
+	usage       *relaymodel.Usage
+}
+
+func isMCPTool(tool openai.ResponseAPITool) bool {
+	return strings.EqualFold(strings.TrimSpace(tool.Type), "mcp")
+}
+
+// hasMCPTools reports whether the request declares remote MCP servers.
+func hasMCPTools(request *openai.ResponseAPIRequest) bool {
+	return slices.ContainsFunc(request.Tools, isMCPTool)
+}
+
+// relayResponseAPIWithMCP serves a Response API request with MCP tools on a channel without
+// native Response API support. Upstreams behind the ChatCompletion fallback cannot reach MCP
+// servers, so the gateway lists the tools, offers them as function tools and runs the calls
+// itself, asking the model again until it answers without calling an MCP tool. Every model
+// round-trip is billed separately.
+func relayResponseAPIWithMCP(c *gin.Context, meta *metalib.Meta, responseAPIRequest *openai.ResponseAPIRequest, guard *guardrailRun) *relaymodel.ErrorWithStatusCode {
+	lg := gmw.GetLogger(c)
+	ctx := gmw.Ctx(c)
+	stream := responseAPIRequest.Stream != nil && *responseAPIRequest.Stream
+
+	toolset, err := connectMCPTools(ctx, client.UserContentRequestHTTPClient, responseAPIRequest.Tools)
+	if err != nil {
+		return openai.ErrorWrapper(err, "mcp_server_error", http.StatusFailedDependency)
+	}
+	defer toolset.Close()
+
+	conversation := *responseAPIRequest
+	conversation.Stream = nil
+	conversation.Tools = slices.DeleteFunc(slices.Clone(responseAPIRequest.Tools), isMCPTool)
+	input, approved := toolset.resolveInput(responseAPIRequest.Input)
+	conversation.Input = input
+
+	mcpOutputs := slices.Clone(toolset.listItems)
+	for _, call := range approved {
+		item := toolset.call(ctx, call)
+		approvalId := call.id
+		item.ApprovalRequestId = &approvalId
+		mcpOutputs = append(mcpOutputs, item)
+		conversation.Input = append(conversation.Input, call.functionCallItem(), call.functionCallOutputItem(mcpCallOutput(item)))
+	}
+
+	channelModelRatio, channelCompletionRatio := getChannelRatios(c)
+	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
+	var (
+		modelRatio, ratio float64
+		preConsumedQuota  int64
+		rounds            []mcpRound
+		final             *openai_compatible.SlimTextResponse
+		limitReached      bool
+	)
+	settle := func() {
+		if len(rounds) == 0 {
+			billing.ReturnPreConsumedQuota(ctx, preConsumedQuota, meta.TokenId)
+			return
+		}
+		billMCPRounds(c, meta, rounds, ratio, preConsumedQuota, modelRatio, groupRatio, channelCompletionRatio, guard)
+	}
+
+	for round := 0; final == nil; round++ {
+		chatRequest, err := convertResponseAPIToFallbackChat(c, meta, &conversation)
+		if err != nil {
+			settle()
+			return openai.ErrorWrapper(err, "convert_response_api_request_failed", http.StatusBadRequest)
+		}
+		chatRequest.Stream = false
+		chatRequest.StreamOptions = nil
+		chatRequest.Tools = append(chatRequest.Tools, toolset.tools...)
+		meta.IsStream = false
+		metalib.Set2Context(c, meta)
+
+		if round == 0 {
+			modelRatio = pricing.GetModelRatioWithThreeLayers(chatRequest.Model, channelModelRatio,
+				getPricingAdaptor(ctx, meta.ChannelType, chatRequest.Model))
+			ratio = modelRatio * groupRatio
+			promptTokens := getPromptTokens(ctx, chatRequest, meta.Mode)
+			meta.PromptTokens = promptTokens
+			var bizErr *relaymodel.ErrorWithStatusCode
+			if preConsumedQuota, bizErr = preConsumeQuota(c, chatRequest, promptTokens, ratio, meta); bizErr != nil {
+				lg.Warn("preConsumeQuota failed",
+					zap.Error(bizErr.RawError),
+					zap.String("err_msg", bizErr.Message),
+					zap.Int("status_code", bizErr.StatusCode))
+				return bizErr
+			}
+			if requestId := c.GetString(ctxkey.RequestId); requestId != "" {
+				estimated := getPreConsumedQuota(chatRequest, promptTokens, ratio)
+				if err := model.UpdateUserRequestCostQuotaByRequestID(c.GetInt(ctxkey.Id), requestId, estimated); err != nil {
+					lg.Warn("record provisional user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+				}
+			}
+		}
+
+		textResp, usage, bizErr := doMCPRound(c, meta, chatRequest)
+		if usage != nil {
+			rounds = append(rounds, mcpRound{chatRequest: chatRequest, usage: usage})
+		}
+		if bizErr != nil {
+			settle()
+			return bizErr
+		}
+
+		calls, clientCalls := toolset.takeMCPCalls(textResp)
+		if len(calls) == 0 {
+			final = textResp
+			break
+		}
+		if round+1 >= config.MCPMaxToolRounds {
+			final, limitReached = textResp, true
+			break
+		}
+
+		// keep the assistant turn, then answer each call or ask for its approval
+		conversation.Input = append(conversation.Input, responseOutputToInputItems(buildResponseOutput(textResp.Choices))...)
+		var pendingApproval bool
+		for _, call := range calls {
+			if toolset.requiresApproval(call) {
+				pendingApproval = true
+				mcpOutputs = append(mcpOutputs, openai.OutputItem{
+					Type:        "mcp_approval_request",
+					Id:          "mcpr_" + random.GetRandomString(24),
+					ServerLabel: call.serverLabel,
+					Name:        call.name,
+					Arguments:   call.arguments,
+				})
+				continue
+			}
+			item := toolset.call(ctx, call)
+			mcpOutputs = append(mcpOutputs, item)
+			conversation.Input = append(conversation.Input, call.functionCallItem(), call.functionCallOutputItem(mcpCallOutput(item)))
+		}
+		if pendingApproval || clientCalls {
+			// the client has to act before the model can continue
+			final = textResp
+			break
+		}
+		mcpOutputs = append(mcpOutputs, buildResponseOutput(textResp.Choices)...)
+	}
+
+	final.Usage = sumMCPRoundUsage(rounds)
+	response := buildFallbackResponse(c, final, responseAPIRequest, meta)
+	response.Output = append(mcpOutputs, response.Output...)
+	if limitReached {
+		response.Status = "incomplete"
+		response.IncompleteDetails = &openai.IncompleteDetails{Reason: "max_tool_calls"}
+	}
+	for i := range response.Output {
+		if response.Output[i].Type == "message" && response.Output[i].Id == "" {
+			response.Output[i].Id = "msg_" + random.GetRandomString(16)
+		}
+	}
+
+	meta.IsStream = stream
+	c.Set(ctxkey.ResponseRewriteApplied, true)
+	if stream {
+		writeResponseAPIEventStream(c, response)
+	} else {
+		c.JSON(http.StatusOK, response)
+	}
+	storeFallbackResponse(c, meta, responseAPIRequest, response)
+	settle()
+	return nil
+}
+
+// doMCPRound sends one non-streaming ChatCompletion request and returns the parsed response.
+// The usage is returned whenever the upstream reported it, so failed rounds are still billed.
+func doMCPRound(c *gin.Context, meta *metalib.Meta, chatRequest *relaymodel.GeneralOpenAIRequest) (*openai_compatible.SlimTextResponse, *relaymodel.Usage, *relaymodel.ErrorWithStatusCode) {
+	adaptor := relay.GetAdaptor(meta.APIType)
+	if adaptor == nil {
+		return nil, nil, openai.ErrorWrapper(errors.New("invalid api type"), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptor.Init(meta)
+
+	convertedRequest, err := adaptor.ConvertRequest(c, relaymode.ChatCompletions, chatRequest)
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "convert_request_failed", http.StatusInternalServerError)
+	}
+	c.Set(ctxkey.ConvertedRequest, convertedRequest)
+	jsonData, err := json.Marshal(convertedRequest)
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "marshal_converted_request_failed", http.StatusInternalServerError)
+	}
+
+	resp, err := adaptor.DoRequest(c, meta, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, nil, openai.ErrorWrapper(err, "do_request_failed", http.StatusInternalServerError)
+	}
+	if isErrorHappened(meta, resp) {
+		return nil, nil, RelayErrorHandlerWithContext(c, resp)
+	}
+
+	// capture the ChatCompletion response instead of writing it to the client
+	origWriter := c.Writer
+	capture := newResponseCaptureWriter(origWriter)
+	c.Writer = capture
+	defer func() {
+		c.Writer = origWriter
+	}()
+	var textResp *openai_compatible.SlimTextResponse
+	c.Set(ctxkey.ResponseRewriteHandler, func(_ *gin.Context, _ int, captured *openai_compatible.SlimTextResponse) error {
+		textResp = captured
+		return nil
+	})
+	defer c.Set(ctxkey.ResponseRewriteHandler, nil)
+
+	usage, respErr := adaptor.DoResponse(c, resp, meta)
+	if respErr != nil {
+		return nil, usage, respErr
+	}
+	if textResp == nil {
+		var slim openai_compatible.SlimTextResponse
+		if err := json.Unmarshal(capture.BodyBytes(), &slim); err != nil || len(slim.Choices) == 0 {
+			return nil, usage, openai.ErrorWrapper(errors.New("upstream returned no chat completion choices"),
+				"invalid_upstream_response", http.StatusBadGateway)
+		}
+		textResp = &slim
+	}
+	if usage == nil {
+		usage = &textResp.Usage
+	}
+	return textResp, usage, nil
+}
+
+// billMCPRounds records metrics and bills every model round-trip of the MCP tool loop with
+// its own consume log. The pre-consumed quota is settled against the first round.
+func billMCPRounds(c *gin.Context, meta *metalib.Meta, rounds []mcpRound, ratio float64, preConsumedQuota int64,
+	modelRatio, groupRatio float64, channelCompletionRatio map[string]float64, guard *guardrailRun) {
+	lg := gmw.GetLogger(c)
+	total := sumMCPRoundUsage(rounds)
+	userId := strconv.Itoa(meta.UserId)
+	metrics.GlobalRecorder.RecordRelayRequest(
+		meta.StartTime,
+		meta.ChannelId,
+		channeltype.IdToName(meta.ChannelType),
+		meta.ActualModelName,
+		userId,
+		true,
+		total.PromptTokens,
+		total.CompletionTokens,
+		0,
+	)
+	metrics.GlobalRecorder.RecordModelUsage(meta.ActualModelName, channeltype.IdToName(meta.ChannelType), time.Since(meta.StartTime))
+
+	guard.collect(meta)
+	quotaId := c.GetInt(ctxkey.Id)
+	requestId := c.GetString(ctxkey.RequestId)
+	graceful.GoCritical(gmw.BackgroundCtx(c), "postBilling", func(ctx context.Context) {
+		ctx, cancel := context.WithTimeout(ctx, time.Duration(config.BillingTimeoutSec)*time.Second)
+		defer cancel()
+
+		var quota int64
+		for i, round := range rounds {
+			var preConsumed int64
+			if i == 0 {
+				preConsumed = preConsumedQuota
+			}
+			quota += postConsumeQuota(ctx, round.usage, meta, round.chatRequest, ratio, preConsumed, 0, modelRatio, groupRatio, false, channelCompletionRatio)
+		}
+		if requestId != "" {
+			if err := model.UpdateUserRequestCostQuotaByRequestID(quotaId, requestId, quota); err != nil {
+				lg.Error("update user request cost failed", zap.Error(err), zap.String("request_id", requestId))
+			}
+		}
+	})
+}
+
+// sumMCPRoundUsage adds up the token usage of all rounds for the returned response.
+func sumMCPRoundUsage(rounds []mcpRound) relaymodel.Usage {
+	var total relaymodel.Usage
+	for _, round := range rounds {
+		total.PromptTokens += round.usage.PromptTokens
+		total.CompletionTokens += round.usage.CompletionTokens
+		total.TotalTokens += round.usage.TotalTokens
+	}
+	return total
+}
+
+// connectMCPTools connects every MCP server declared in tools and lists the tools it offers.
+func connectMCPTools(ctx context.Context, httpClient *http.Client, tools []openai.ResponseAPITool) (*mcpToolset, error) {
+	toolset := &mcpToolset{
+		servers:   make(map[string]*mcpServer),
+		functions: make(map[string]mcpFunction),
+	}
+	for _, tool := range tools {
+		if !isMCPTool(tool) {
+			continue
+		}
+		declared := relaymodel.Tool{Type: "mcp", ServerLabel: tool.ServerLabel, ServerUrl: tool.ServerUrl}
+		if err := declared.ValidateMCP(); err != nil {
+			toolset.Close()
+			return nil, errors.Wrapf(err, "invalid mcp tool %q", tool.ServerLabel)
+		}
+		if _, ok := toolset.servers[tool.ServerLabel]; ok {
+			toolset.Close()
+			return nil, errors.Errorf("duplicate mcp server_label %q", tool.ServerLabel)
+		}
+		if err := toolset.connect(ctx, httpClient, tool); err != nil {
+			toolset.Close()
+			return nil, err
+		}
+	}
+	return toolset, nil
+}
+
+func (s *mcpToolset) connect(ctx context.Context, httpClient *http.Client, tool openai.ResponseAPITool) error {
+	mcpClient, err := mcp.Connect(ctx, httpClient, tool.ServerUrl, tool.Headers)
+	if err != nil {
+		return errors.Wrapf(err, "connect mcp server %q", tool.ServerLabel)
+	}
+	server := &mcpServer{tool: tool, client: mcpClient}
+	s.servers[tool.ServerLabel] = server
+
+	listed, err := mcpClient.ListTools(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "list tools of mcp server %q", tool.ServerLabel)
+	}
+	item := openai.OutputItem{
+		Type:        "mcp_list_tools",
+		Id:          "mcpl_" + random.GetRandomString(24),
+		ServerLabel: tool.ServerLabel,
+		Tools:       []relaymodel.Tool{},
+	}
+	for _, listedTool := range listed {
+		if len(tool.AllowedTools) > 0 && !slices.Contains(tool.AllowedTools, listedTool.Name) {
+			continue
+		}
+		var parameters any = listedTool.InputSchema
+		if listedTool.InputSchema == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		item.Tools = append(item.Tools, relaymodel.Tool{
+			Type:     "function",
+			Function: &relaymodel.Function{Name: listedTool.Name, Description: listedTool.Description, Parameters: parameters},
+		})
+
+		functionName := mcpFunctionName(tool.ServerLabel, listedTool.Name)
+		if _, taken := s.functions[functionName]; taken {
+			continue
+		}
+		s.functions[functionName] = mcpFunction{server: server, name: listedTool.Name}
+		s.tools = append(s.tools, relaymodel.Tool{
+			Type:     "function",
+			Function: &relaymodel.Function{Name: functionName, Description: listedTool.Description, Parameters: parameters},
+		})
+	}
+	s.listItems = append(s.listItems, item)
+	return nil
+}
+
+// Close ends the sessions with all MCP servers.
+func (s *mcpToolset) Close() {
+	for _, server := range s.servers {
+		server.client.Close()
+	}
+}
+
+// mcpFunctionName returns the function name offered to the model for an MCP tool, restricted
+// to the characters and length upstreams accept for function names.
+func mcpFunctionName(serverLabel, toolName string) string {
+	name := []byte(serverLabel + mcpFunctionSeparator + toolName)
+	for i, b := range name {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '_', b == '-':
+		default:
+			name[i] = '_'
+		}
+	}
+	if len(name) > maxFunctionNameLength {
+		name = name[:maxFunctionNameLength]
+	}
+	return string(name)
+}
+
+// requiresApproval applies the require_approval setting of the call's server. As on OpenAI,
+// calls need approval unless the setting is "never" or names the tool under never.tool_names.
+func (s *mcpToolset) requiresApproval(call mcpCallRequest) bool {
+	server, ok := s.servers[call.serverLabel]
+	if !ok {
+		return true
+	}
+	switch setting := server.tool.RequireApproval.(type) {
+	case string:
+		return !strings.EqualFold(setting, "never")
+	case map[string]any:
+		never, _ := setting["never"].(map[string]any)
+		names, _ := never["tool_names"].([]any)
+		return !slices.ContainsFunc(names, func(name any) bool { return name == call.name })
+	default:
+		return true
+	}
+}
+
+// resolveInput replaces the MCP items of the input, which ChatCompletion upstreams cannot
+// read, with function call items, and returns the approved calls that still have to run.
+// Approval requests without a response are dropped; the model may request the call again.
+func (s *mcpToolset) resolveInput(input openai.ResponseAPIInput) (openai.ResponseAPIInput, []mcpCallRequest) {
+	approvals := make(map[string]bool)
+	for _, item := range input {
+		if itemMap, ok := item.(map[string]any); ok && itemMap["type"] == "mcp_approval_response" {
+			requestId, _ := itemMap["approval_request_id"].(string)
+			approve, _ := itemMap["approve"].(bool)
+			approvals[requestId] = approve
+		}
+	}
+
+	resolved := make(openai.ResponseAPIInput, 0, len(input))
+	var approved []mcpCallRequest
+	for _, item := range input {
+		itemMap, ok := item.(map[string]any)
+		if !ok {
+			resolved = append(resolved, item)
+			continue
+		}
+		switch itemType, _ := itemMap["type"].(string); itemType {
+		case "mcp_list_tools", "mcp_approval_response":
+		case "mcp_call":
+			call := mcpCallFromItem(itemMap)
+			output, _ := itemMap["output"].(string)
+			if errMsg, _ := itemMap["error"].(string); errMsg != "" {
+				output = mcpErrorOutput(errMsg)
+			}
+			resolved = append(resolved, call.functionCallItem(), call.functionCallOutputItem(output))
+		case "mcp_approval_request":
+			call := mcpCallFromItem(itemMap)
+			approve, answered := approvals[call.id]
+			switch {
+			case !answered:
+			case approve:
+				approved = append(approved, call)
+			default:
+				resolved = append(resolved, call.functionCallItem(), call.functionCallOutputItem(mcpDeclinedOutput))
+			}
+		default:
+			resolved = append(resolved, item)
+		}
+	}
+	return resolved, approved
+}
+
+// takeMCPCalls removes the calls of MCP functions from the choices and returns them, along
+// with whether calls of client-defined functions remain.
+func (s *mcpToolset) takeMCPCalls(textResp *openai_compatible.SlimTextResponse) ([]mcpCallRequest, bool) {
+	var calls []mcpCallRequest
+	var clientCalls bool
+	for i := range textResp.Choices {
+		msg := &textResp.Choices[i].Message
+		var kept []relaymodel.Tool
+		for _, tool := range msg.ToolCalls {
+			fn, ok := mcpFunction{}, false
+			if tool.Function != nil {
+				fn, ok = s.functions[tool.Function.Name]
+			}
+			if !ok {
+				kept = append(kept, tool)
+				continue
+			}
+			callId := tool.Id
+			if callId == "" {
+				callId = "call_" + random.GetRandomString(24)
+			}
+			calls = append(calls, mcpCallRequest{
+				id:          callId,
+				serverLabel: fn.server.tool.ServerLabel,
+				name:        fn.name,
+				arguments:   toolCallArguments(tool),
+			})
+		}
+		msg.ToolCalls = kept
+		clientCalls = clientCalls || len(kept) > 0
+	}
+	return calls, clientCalls
+}
+
+// call runs an MCP tool call and returns its mcp_call output item. Failures are reported in
+// the item rather than failing the request, so the model can react to them.
+func (s *mcpToolset) call(ctx context.Context, call mcpCallRequest) openai.OutputItem {
+	item := openai.OutputItem{
+		Type:        "mcp_call",
+		Id:          "mcp_" + random.GetRandomString(24),
+		ServerLabel: call.serverLabel,
+		Name:        call.name,
+		Arguments:   call.arguments,
+	}
+	fail := func(msg string) openai.OutputItem {
+		item.Error = &msg
+		return item
+	}
+
+	server, ok := s.servers[call.serverLabel]
+	if !ok {
+		return fail("mcp server " + strconv.Quote(call.serverLabel) + " is not declared in tools")
+	}
+	arguments := json.RawMessage(call.arguments)
+	if strings.TrimSpace(call.arguments) == "" {
+		arguments = json.RawMessage("{}")
+	}
+	if !json.Valid(arguments) {
+		return fail("tool arguments are not valid JSON")
+	}
+	result, err := server.client.CallTool(ctx, call.name, arguments)
+	if err != nil {
+		return fail(err.Error())
+	}
+	if result.IsError {
+		return fail(result.Text())
+	}
+	item.Output = result.Text()
+	return item
+}
+
+func mcpCallFromItem(item map[string]any) mcpCallRequest {
+	call := mcpCallRequest{}
+	call.id, _ = item["id"].(string)
+	call.serverLabel, _ = item["server_label"].(string)
+	call.name, _ = item["name"].(string)
+	call.arguments, _ = item["arguments"].(string)
+	return call
+}
+
+func (call mcpCallRequest) functionCallItem() map[string]any {
+	return map[string]any{
+		"type":      "function_call",
+		"call_id":   call.id,
+		"name":      mcpFunctionName(call.serverLabel, call.name),
+		"arguments": call.arguments,
+	}
+}
+
+func (call mcpCallRequest) functionCallOutputItem(output string) map[string]any {
+	return map[string]any{
+		"type":    "function_call_output",
+		"call_id": call.id,
+		"output":  output,
+	}
+}
+
+// mcpCallOutput returns the tool result handed back to the model for an mcp_call item.
+func mcpCallOutput(item openai.OutputItem) string {
+	if item.Error != nil {
+		return mcpErrorOutput(*item.Error)
+	}
+	return item.Output
+}
+
+func mcpErrorOutput(msg string) string {
+	return "Error: " + msg
+}
+
+// writeResponseAPIEventStream replays a finished response as Response API stream events.
+func writeResponseAPIEventStream(c *gin.Context, response *openai.ResponseAPIResponse) {
+	lg := gmw.GetLogger(c)
+	common.SetEventStreamHeaders(c)
+	sequence := 0
+	emit := func(event openai.ResponseAPIStreamEvent) {
+		event.SequenceNumber = sequence
+		sequence++
+		payload, err := json.Marshal(event)
+		if err != nil {
+			lg.Warn("failed to marshal response stream event", zap.String("event_type", event.Type), zap.Error(err))
+			return
+		}
+		if _, err := c.Writer.Write([]byte("event: " + event.Type + "\ndata: " + string(payload) + "\n\n")); err != nil {
+			lg.Warn("failed to write response stream event", zap.String("event_type", event.Type), zap.Error(err))
+		}
+		c.Writer.Flush()
+	}
+
+	created := *response
+	created.Status = "in_progress"
+	created.Output = nil
+	created.Usage = nil
+	emit(openai.ResponseAPIStreamEvent{Type: "response.created", Response: &created})
+
+	for i := range response.Output {
+		item := &response.Output[i]
+		emit(openai.ResponseAPIStreamEvent{Type: "response.output_item.added", OutputIndex: i, Item: item})
+		if item.Type == "message" {
+			for j := range item.Content {
+				part := &item.Content[j]
+				emit(openai.ResponseAPIStreamEvent{Type: "response.content_part.added", ItemId: item.Id, OutputIndex: i, ContentIndex: j,
+					Part: &openai.OutputContent{Type: part.Type}})
+				emit(openai.ResponseAPIStreamEvent{Type: "response.output_text.delta", ItemId: item.Id, OutputIndex: i, ContentIndex: j,
+					Delta: rawMessageFromString(part.Text)})
+				emit(openai.ResponseAPIStreamEvent{Type: "response.output_text.done", ItemId: item.Id, OutputIndex: i, ContentIndex: j,
+					Text: part.Text})
+				emit(openai.ResponseAPIStreamEvent{Type: "response.content_part.done", ItemId: item.Id, OutputIndex: i, ContentIndex: j,
+					Part: part})
+			}
+		}
+		emit(openai.ResponseAPIStreamEvent{Type: "response.output_item.done", OutputIndex: i, Item: item})
+	}
+
+	emit(openai.ResponseAPIStreamEvent{Type: "response.completed", Response: response})
+	render.Done(c)
+}
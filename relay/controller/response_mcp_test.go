@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/client"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+// newTestMCPServer starts a streamable HTTP MCP server offering a search tool.
+func newTestMCPServer(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Id     *int64          `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			return
+		}
+		if req.Id == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		var result any
+		switch req.Method {
+		case "initialize":
+			result = map[string]any{"protocolVersion": "2025-03-26"}
+		case "tools/list":
+			result = map[string]any{"tools": []any{
+				map[string]any{"name": "search", "description": "Search the docs", "inputSchema": map[string]any{"type": "object"}},
+				map[string]any{"name": "delete_page"},
+			}}
+		case "tools/call":
+			calls = append(calls, string(req.Params))
+			result = map[string]any{"content": []any{map[string]any{"type": "text", "text": "found 3 pages"}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": *req.Id, "result": result})
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestMCPFunctionName(t *testing.T) {
+	require.Equal(t, "deepwiki__ask_question", mcpFunctionName("deepwiki", "ask_question"))
+	require.Equal(t, "my_server__tool_v1", mcpFunctionName("my server", "tool.v1"))
+	require.Len(t, mcpFunctionName(strings.Repeat("a", 40), strings.Repeat("b", 40)), maxFunctionNameLength)
+}
+
+func TestMCPToolsetRequiresApproval(t *testing.T) {
+	toolset := &mcpToolset{servers: map[string]*mcpServer{}}
+	cases := []struct {
+		setting any
+		tool    string
+		want    bool
+	}{
+		{nil, "search", true},
+		{"always", "search", true},
+		{"never", "search", false},
+		{map[string]any{"never": map[string]any{"tool_names": []any{"search"}}}, "search", false},
+		{map[string]any{"never": map[string]any{"tool_names": []any{"search"}}}, "delete_page", true},
+		{map[string]any{"always": map[string]any{"tool_names": []any{"delete_page"}}}, "search", true},
+	}
+	for i, tc := range cases {
+		toolset.servers["docs"] = &mcpServer{tool: openai.ResponseAPITool{Type: "mcp", ServerLabel: "docs", RequireApproval: tc.setting}}
+		require.Equal(t, tc.want, toolset.requiresApproval(mcpCallRequest{serverLabel: "docs", name: tc.tool}), "case %d", i)
+	}
+	require.True(t, toolset.requiresApproval(mcpCallRequest{serverLabel: "unknown", name: "search"}))
+}
+
+func TestMCPToolsetResolveInput(t *testing.T) {
+	toolset := &mcpToolset{}
+	input := openai.ResponseAPIInput{
+		"find the docs",
+		map[string]any{"type": "mcp_list_tools", "id": "mcpl_1", "server_label": "docs"},
+		map[string]any{"type": "mcp_call", "id": "mcp_1", "server_label": "docs", "name": "search", "arguments": `{}`, "output": "found"},
+		map[string]any{"type": "mcp_approval_request", "id": "mcpr_1", "server_label": "docs", "name": "delete_page", "arguments": `{"page":1}`},
+		map[string]any{"type": "mcp_approval_request", "id": "mcpr_2", "server_label": "docs", "name": "delete_page", "arguments": `{"page":2}`},
+		map[string]any{"type": "mcp_approval_request", "id": "mcpr_3", "server_label": "docs", "name": "delete_page", "arguments": `{"page":3}`},
+		map[string]any{"type": "mcp_approval_response", "approval_request_id": "mcpr_1", "approve": true},
+		map[string]any{"type": "mcp_approval_response", "approval_request_id": "mcpr_2", "approve": false},
+	}
+
+	resolved, approved := toolset.resolveInput(input)
+	require.Len(t, approved, 1)
+	require.Equal(t, "mcpr_1", approved[0].id)
+	require.Equal(t, `{"page":1}`, approved[0].arguments)
+
+	require.Len(t, resolved, 5)
+	require.Equal(t, "find the docs", resolved[0])
+	require.Equal(t, "docs__search", resolved[1].(map[string]any)["name"])
+	require.Equal(t, "found", resolved[2].(map[string]any)["output"])
+	require.Equal(t, "mcpr_2", resolved[3].(map[string]any)["call_id"])
+	require.Equal(t, mcpDeclinedOutput, resolved[4].(map[string]any)["output"])
+}
+
+func TestRelayResponseAPIHelper_MCPToolLoop(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ensureResponseFallbackFixtures(t)
+
+	prevRedis := common.IsRedisEnabled()
+	common.SetRedisEnabled(false)
+	t.Cleanup(func() { common.SetRedisEnabled(prevRedis) })
+	prevLogConsume := config.IsLogConsumeEnabled()
+	config.SetLogConsumeEnabled(false)
+	t.Cleanup(func() { config.SetLogConsumeEnabled(prevLogConsume) })
+
+	mcpServer, mcpCalls := newTestMCPServer(t)
+
+	var upstreamBodies []relaymodel.GeneralOpenAIRequest
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body relaymodel.GeneralOpenAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		upstreamBodies = append(upstreamBodies, body)
+		w.Header().Set("Content-Type", "application/json")
+		if len(upstreamBodies) == 1 {
+			_, _ = w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-4o-mini","choices":[{"index":0,
+				"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"docs__search","arguments":"{\"query\":\"mcp\"}"}}]},
+				"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id":"chatcmpl-2","object":"chat.completion","model":"gpt-4o-mini","choices":[{"index":0,
+			"message":{"role":"assistant","content":"There are 3 pages."},"finish_reason":"stop"}],
+			"usage":{"prompt_tokens":20,"completion_tokens":6,"total_tokens":26}}`))
+	}))
+	defer upstream.Close()
+
+	prevClient := client.HTTPClient
+	client.HTTPClient = upstream.Client()
+	t.Cleanup(func() { client.HTTPClient = prevClient })
+	prevUserContentClient := client.UserContentRequestHTTPClient
+	client.UserContentRequestHTTPClient = mcpServer.Client()
+	t.Cleanup(func() { client.UserContentRequestHTTPClient = prevUserContentClient })
+
+	payload := fmt.Sprintf(`{"model":"gpt-4o-mini","store":false,"input":"How many pages mention MCP?",
+		"tools":[{"type":"mcp","server_label":"docs","server_url":%q,"require_approval":{"never":{"tool_names":["search"]}}}]}`, mcpServer.URL)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewBufferString(payload))
+	c.Request.Header.Set("Content-Type", "application/json")
+	gmw.SetLogger(c, logger.Logger)
+	c.Set(ctxkey.Channel, channeltype.Azure)
+	c.Set(ctxkey.ChannelId, fallbackChannelID)
+	c.Set(ctxkey.TokenId, fallbackTokenID)
+	c.Set(ctxkey.TokenName, "fallback-token")
+	c.Set(ctxkey.Id, fallbackUserID)
+	c.Set(ctxkey.Group, "default")
+	c.Set(ctxkey.ModelMapping, map[string]string{})
+	c.Set(ctxkey.ChannelRatio, 1.0)
+	c.Set(ctxkey.RequestModel, "gpt-4o-mini")
+	c.Set(ctxkey.BaseURL, upstream.URL)
+	c.Set(ctxkey.ContentType, "application/json")
+	c.Set(ctxkey.TokenQuotaUnlimited, true)
+	c.Set(ctxkey.UserQuota, int64(1_000_000))
+	c.Set(ctxkey.ChannelModel, &model.Channel{Id: fallbackChannelID, Type: channeltype.Azure})
+	c.Set(ctxkey.Config, model.ChannelConfig{APIVersion: "2024-02-15-preview"})
+
+	require.Nil(t, RelayResponseAPIHelper(c))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	// the model saw the MCP tools as functions, and the tool result in the second round
+	require.Len(t, upstreamBodies, 2)
+	require.Len(t, upstreamBodies[0].Tools, 2)
+	require.Equal(t, "docs__search", upstreamBodies[0].Tools[0].Function.Name)
+	lastMessage := upstreamBodies[1].Messages[len(upstreamBodies[1].Messages)-1]
+	require.Equal(t, "tool", lastMessage.Role)
+	require.Equal(t, "call_1", lastMessage.ToolCallId)
+	require.Equal(t, "found 3 pages", lastMessage.StringContent())
+	require.Len(t, *mcpCalls, 1)
+	require.JSONEq(t, `{"name":"search","arguments":{"query":"mcp"}}`, (*mcpCalls)[0])
+
+	var response openai.ResponseAPIResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "completed", response.Status)
+	require.Len(t, response.Output, 3)
+	require.Equal(t, "mcp_list_tools", response.Output[0].Type)
+	require.Len(t, response.Output[0].Tools, 2)
+	require.Equal(t, "mcp_call", response.Output[1].Type)
+	require.Equal(t, "search", response.Output[1].Name)
+	require.Equal(t, "found 3 pages", response.Output[1].Output)
+	require.Equal(t, "message", response.Output[2].Type)
+	require.Equal(t, "There are 3 pages.", response.Output[2].Content[0].Text)
+	require.Nil(t, response.RequiredAction)
+	require.Equal(t, 41, response.Usage.TotalTokens)
+}
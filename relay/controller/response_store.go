@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+)
+
+const (
+	// maxStoredResponseChain bounds how far previous_response_id history is followed.
+	maxStoredResponseChain = 100
+	// defaultInputItemsLimit and maxInputItemsLimit follow the OpenAI list endpoints.
+	defaultInputItemsLimit = 20
+	maxInputItemsLimit     = 100
+)
+
+// responseStoreEnabled reports whether a response should be persisted.
+// The Response API stores responses unless store is explicitly false.
+func responseStoreEnabled(request *openai.ResponseAPIRequest) bool {
+	return request.Store == nil || *request.Store
+}
+
+// expandStoredResponseHistory prepends the conversation of a locally stored
+// previous_response_id to the request input. It returns false when the id was not
+// stored for the calling token, e.g. when it was issued natively by OpenAI.
+func expandStoredResponseHistory(c *gin.Context, request *openai.ResponseAPIRequest) (bool, error) {
+	if request.PreviousResponseId == nil || *request.PreviousResponseId == "" {
+		return false, nil
+	}
+
+	ctx := gmw.Ctx(c)
+	tokenId := c.GetInt(ctxkey.TokenId)
+	var chain []*model.StoredResponse
+	for id := *request.PreviousResponseId; id != "" && len(chain) < maxStoredResponseChain; {
+		stored, err := model.GetStoredResponseByToken(ctx, tokenId, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// the chain ends at a deleted or foreign response
+				break
+			}
+			return false, errors.Wrap(err, "load previous response")
+		}
+		chain = append(chain, stored)
+		id = stored.PreviousResponseId
+	}
+	if len(chain) == 0 {
+		return false, nil
+	}
+
+	var history openai.ResponseAPIInput
+	for i := len(chain) - 1; i >= 0; i-- {
+		items, err := storedResponseHistory(chain[i])
+		if err != nil {
+			return false, errors.Wrapf(err, "rebuild history of response %s", chain[i].ResponseId)
+		}
+		history = append(history, items...)
+	}
+	request.Input = append(history, request.Input...)
+	return true, nil
+}
+
+// storedResponseHistory returns the input items and the output of a stored response as
+// input items of a follow-up request.
+func storedResponseHistory(stored *model.StoredResponse) ([]any, error) {
+	var items []any
+	if stored.InputItems != "" {
+		if err := json.Unmarshal([]byte(stored.InputItems), &items); err != nil {
+			return nil, errors.Wrap(err, "unmarshal stored input items")
+		}
+	}
+	for i, item := range items {
+		// item ids are local to this gateway and must not reach the upstream
+		if itemMap, ok := item.(map[string]any); ok {
+			delete(itemMap, "id")
+			items[i] = itemMap
+		}
+	}
+
+	var response openai.ResponseAPIResponse
+	if err := json.Unmarshal([]byte(stored.Response), &response); err != nil {
+		return nil, errors.Wrap(err, "unmarshal stored response")
+	}
+	return append(items, responseOutputToInputItems(response.Output)...), nil
+}
+
+// responseOutputToInputItems converts the assistant messages, function calls and MCP calls
+// of a response into input items. Reasoning summaries are not replayed.
+func responseOutputToInputItems(outputs []openai.OutputItem) []any {
+	var items []any
+	for _, output := range outputs {
+		switch output.Type {
+		case "message":
+			content := make([]any, 0, len(output.Content))
+			for _, part := range output.Content {
+				if part.Type == "output_text" && part.Text != "" {
+					content = append(content, map[string]any{"type": "output_text", "text": part.Text})
+				}
+			}
+			if len(content) == 0 {
+				continue
+			}
+			items = append(items, map[string]any{
+				"type":    "message",
+				"role":    "assistant",
+				"content": content,
+			})
+		case "function_call":
+			items = append(items, map[string]any{
+				"type":      "function_call",
+				"call_id":   output.CallId,
+				"name":      output.Name,
+				"arguments": output.Arguments,
+			})
+		case "mcp_call", "mcp_approval_request":
+			// kept with their ids, so approvals can answer them in a follow-up request
+			item := map[string]any{
+				"type":         output.Type,
+				"id":           output.Id,
+				"server_label": output.ServerLabel,
+				"name":         output.Name,
+				"arguments":    output.Arguments,
+			}
+			if output.Type == "mcp_call" {
+				item["output"] = output.Output
+				if output.Error != nil {
+					item["error"] = *output.Error
+				}
+			}
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// normalizeStoredInputItems converts the request input into input item objects with
+// ids, the shape returned by the input_items endpoint.
+func normalizeStoredInputItems(responseId string, input openai.ResponseAPIInput) []any {
+	items := make([]any, 0, len(input))
+	for i, item := range input {
+		var itemMap map[string]any
+		switch v := item.(type) {
+		case string:
+			itemMap = map[string]any{
+				"type":    "message",
+				"role":    "user",
+				"content": []any{map[string]any{"type": "input_text", "text": v}},
+			}
+		case map[string]any:
+			itemMap = maps.Clone(v)
+			if _, ok := itemMap["type"]; !ok {
+				itemMap["type"] = "message"
+			}
+		default:
+			continue
+		}
+		if _, ok := itemMap["id"]; !ok {
+			itemMap["id"] = fmt.Sprintf("%s_item_%d", responseId, i)
+		}
+		items = append(items, itemMap)
+	}
+	return items
+}
+
+// storeFallbackResponse persists a response rendered by the ChatCompletion fallback so
+// that later requests can continue, retrieve or delete it. Failures are logged only,
+// because the response was already sent to the client.
+func storeFallbackResponse(c *gin.Context, meta *metalib.Meta, request *openai.ResponseAPIRequest, response *openai.ResponseAPIResponse) {
+	if !responseStoreEnabled(request) || response == nil {
+		return
+	}
+	lg := gmw.GetLogger(c)
+
+	input := request.Input
+	if v, ok := c.Get(ctxkey.ResponseAPIInputItems); ok {
+		if items, ok := v.(openai.ResponseAPIInput); ok {
+			input = items
+		}
+	}
+	inputItems, err := json.Marshal(normalizeStoredInputItems(response.Id, input))
+	if err != nil {
+		lg.Warn("failed to marshal stored response input", zap.String("response_id", response.Id), zap.Error(err))
+		return
+	}
+	responseBody, err := json.Marshal(response)
+	if err != nil {
+		lg.Warn("failed to marshal stored response", zap.String("response_id", response.Id), zap.Error(err))
+		return
+	}
+
+	stored := &model.StoredResponse{
+		ResponseId: response.Id,
+		UserId:     meta.UserId,
+		TokenId:    meta.TokenId,
+		ChannelId:  meta.ChannelId,
+		Model:      response.Model,
+		InputItems: string(inputItems),
+		Response:   string(responseBody),
+	}
+	if request.PreviousResponseId != nil {
+		stored.PreviousResponseId = *request.PreviousResponseId
+	}
+	if err = model.CreateStoredResponse(gmw.Ctx(c), stored); err != nil {
+		lg.Warn("failed to store response", zap.String("response_id", response.Id), zap.Error(err))
+	}
+}
+
+// getStoredResponse returns the stored response named by the response_id path parameter,
+// or nil when the calling token has none.
+func getStoredResponse(c *gin.Context) (*model.StoredResponse, *relaymodel.ErrorWithStatusCode) {
+	stored, err := model.GetStoredResponseByToken(gmw.Ctx(c), c.GetInt(ctxkey.TokenId), c.Param("response_id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, openai.ErrorWrapper(err, "get_stored_response_failed", http.StatusInternalServerError)
+	}
+	return stored, nil
+}
+
+// serveStoredResponse writes a stored response for GET /v1/responses/:response_id.
+func serveStoredResponse(c *gin.Context, stored *model.StoredResponse) *relaymodel.ErrorWithStatusCode {
+	c.Writer.Header().Set("Content-Type", "application/json")
+	c.Writer.WriteHeader(http.StatusOK)
+	if _, err := c.Writer.Write([]byte(stored.Response)); err != nil {
+		return openai.ErrorWrapper(err, "write_response_body_failed", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// deleteStoredResponse handles DELETE /v1/responses/:response_id for a stored response.
+func deleteStoredResponse(c *gin.Context, stored *model.StoredResponse) *relaymodel.ErrorWithStatusCode {
+	deleted, err := model.DeleteStoredResponseByToken(gmw.Ctx(c), stored.TokenId, stored.ResponseId)
+	if err != nil {
+		return openai.ErrorWrapper(err, "delete_stored_response_failed", http.StatusInternalServerError)
+	}
+	if !deleted {
+		return openai.ErrorWrapper(errors.Errorf("response %s not found", stored.ResponseId), "response_not_found", http.StatusNotFound)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      stored.ResponseId,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+	return nil
+}
+
+// serveStoredInputItems handles GET /v1/responses/:response_id/input_items for a stored
+// response, supporting the limit, order and after query parameters.
+func serveStoredInputItems(c *gin.Context, stored *model.StoredResponse) *relaymodel.ErrorWithStatusCode {
+	var items []any
+	if stored.InputItems != "" {
+		if err := json.Unmarshal([]byte(stored.InputItems), &items); err != nil {
+			return openai.ErrorWrapper(err, "unmarshal_stored_input_items_failed", http.StatusInternalServerError)
+		}
+	}
+
+	limit := defaultInputItemsLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxInputItemsLimit {
+			return openai.ErrorWrapper(errors.Errorf("limit must be between 1 and %d", maxInputItemsLimit), "invalid_query_parameter", http.StatusBadRequest)
+		}
+		limit = parsed
+	}
+	page, hasMore, err := paginateInputItems(items, c.DefaultQuery("order", "desc"), c.Query("after"), limit)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_query_parameter", http.StatusBadRequest)
+	}
+
+	list := gin.H{
+		"object":   "list",
+		"data":     page,
+		"first_id": nil,
+		"last_id":  nil,
+		"has_more": hasMore,
+	}
+	if len(page) > 0 {
+		list["first_id"] = inputItemId(page[0])
+		list["last_id"] = inputItemId(page[len(page)-1])
+	}
+	c.JSON(http.StatusOK, list)
+	return nil
+}
+
+// paginateInputItems orders items and returns up to limit items following the item with id after.
+func paginateInputItems(items []any, order, after string, limit int) ([]any, bool, error) {
+	ordered := make([]any, 0, len(items))
+	switch order {
+	case "asc":
+		ordered = append(ordered, items...)
+	case "desc":
+		for i := len(items) - 1; i >= 0; i-- {
+			ordered = append(ordered, items[i])
+		}
+	default:
+		return nil, false, errors.Errorf("order must be asc or desc, got %q", order)
+	}
+
+	if after != "" {
+		start := -1
+		for i, item := range ordered {
+			if inputItemId(item) == after {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, false, errors.Errorf("input item %s not found", after)
+		}
+		ordered = ordered[start:]
+	}
+
+	if len(ordered) > limit {
+		return ordered[:limit], true, nil
+	}
+	return ordered, false, nil
+}
+
+func inputItemId(item any) string {
+	if itemMap, ok := item.(map[string]any); ok {
+		id, _ := itemMap["id"].(string)
+		return id
+	}
+	return ""
+}
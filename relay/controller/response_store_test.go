@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+)
+
+func createStoredResponseFixture(t *testing.T, tokenId int, responseId, previousId string, input []any, output []openai.OutputItem) {
+	t.Helper()
+	inputItems, err := json.Marshal(normalizeStoredInputItems(responseId, input))
+	require.NoError(t, err)
+	response, err := json.Marshal(openai.ResponseAPIResponse{Id: responseId, Object: "response", Status: "completed", Output: output})
+	require.NoError(t, err)
+
+	require.NoError(t, model.DB.Where("response_id = ?", responseId).Delete(&model.StoredResponse{}).Error)
+	require.NoError(t, model.CreateStoredResponse(t.Context(), &model.StoredResponse{
+		ResponseId:         responseId,
+		TokenId:            tokenId,
+		PreviousResponseId: previousId,
+		InputItems:         string(inputItems),
+		Response:           string(response),
+	}))
+}
+
+func newStoredResponseContext(t *testing.T, method, target string, tokenId int, responseId string) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(method, target, nil)
+	c.Params = gin.Params{{Key: "response_id", Value: responseId}}
+	gmw.SetLogger(c, logger.Logger)
+	c.Set(ctxkey.TokenId, tokenId)
+	return c, recorder
+}
+
+func TestExpandStoredResponseHistory(t *testing.T) {
+	createStoredResponseFixture(t, 11, "resp-store-1", "", []any{"What is 2+2?"},
+		[]openai.OutputItem{{Type: "message", Role: "assistant", Content: []openai.OutputContent{{Type: "output_text", Text: "4"}}}})
+	createStoredResponseFixture(t, 11, "resp-store-2", "resp-store-1", []any{"Look up the weather"},
+		[]openai.OutputItem{
+			{Type: "reasoning", Summary: []openai.OutputContent{{Type: "summary_text", Text: "need a tool"}}},
+			{Type: "function_call", CallId: "call_1", Name: "get_weather", Arguments: `{"city":"Paris"}`},
+		})
+
+	previous := "resp-store-2"
+	request := &openai.ResponseAPIRequest{
+		PreviousResponseId: &previous,
+		Input: openai.ResponseAPIInput{map[string]any{
+			"type": "function_call_output", "call_id": "call_1", "output": "sunny",
+		}},
+	}
+	c, _ := newStoredResponseContext(t, http.MethodPost, "/v1/responses", 11, "")
+
+	expanded, err := expandStoredResponseHistory(c, request)
+	require.NoError(t, err)
+	require.True(t, expanded)
+	require.Len(t, request.Input, 5)
+
+	first := request.Input[0].(map[string]any)
+	require.Equal(t, "user", first["role"])
+	require.NotContains(t, first, "id")
+	require.Equal(t, "assistant", request.Input[1].(map[string]any)["role"])
+	require.Equal(t, "function_call", request.Input[3].(map[string]any)["type"])
+	require.Equal(t, "function_call_output", request.Input[4].(map[string]any)["type"])
+
+	chatRequest, err := openai.ConvertResponseAPIToChatCompletionRequest(request)
+	require.NoError(t, err)
+	require.Len(t, chatRequest.Messages, 5)
+	require.Equal(t, "assistant", chatRequest.Messages[3].Role)
+	require.Len(t, chatRequest.Messages[3].ToolCalls, 1)
+	require.Equal(t, "tool", chatRequest.Messages[4].Role)
+	require.Equal(t, "call_1", chatRequest.Messages[4].ToolCallId)
+
+	// responses stored by another token are invisible
+	c, _ = newStoredResponseContext(t, http.MethodPost, "/v1/responses", 12, "")
+	request.Input = nil
+	expanded, err = expandStoredResponseHistory(c, request)
+	require.NoError(t, err)
+	require.False(t, expanded)
+}
+
+func TestStoredResponseEndpoints(t *testing.T) {
+	createStoredResponseFixture(t, 21, "resp-store-endpoints", "", []any{"first", "second", "third"},
+		[]openai.OutputItem{{Type: "message", Role: "assistant", Content: []openai.OutputContent{{Type: "output_text", Text: "ok"}}}})
+
+	c, recorder := newStoredResponseContext(t, http.MethodGet, "/v1/responses/resp-store-endpoints", 21, "resp-store-endpoints")
+	require.Nil(t, RelayResponseAPIGetHelper(c))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var response openai.ResponseAPIResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, "resp-store-endpoints", response.Id)
+
+	c, recorder = newStoredResponseContext(t, http.MethodGet, "/v1/responses/resp-store-endpoints/input_items?limit=2&order=asc", 21, "resp-store-endpoints")
+	require.Nil(t, RelayResponseAPIInputItemsHelper(c))
+	var list struct {
+		Data    []map[string]any `json:"data"`
+		FirstId string           `json:"first_id"`
+		LastId  string           `json:"last_id"`
+		HasMore bool             `json:"has_more"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Data, 2)
+	require.True(t, list.HasMore)
+	require.Equal(t, "resp-store-endpoints_item_0", list.FirstId)
+
+	c, recorder = newStoredResponseContext(t, http.MethodGet, "/v1/responses/resp-store-endpoints/input_items?order=asc&after="+list.LastId, 21, "resp-store-endpoints")
+	require.Nil(t, RelayResponseAPIInputItemsHelper(c))
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	require.Len(t, list.Data, 1)
+	require.False(t, list.HasMore)
+	require.Equal(t, "resp-store-endpoints_item_2", list.FirstId)
+
+	c, recorder = newStoredResponseContext(t, http.MethodDelete, "/v1/responses/resp-store-endpoints", 21, "resp-store-endpoints")
+	require.Nil(t, RelayResponseAPIDeleteHelper(c))
+	require.JSONEq(t, `{"id":"resp-store-endpoints","object":"response.deleted","deleted":true}`, recorder.Body.String())
+
+	_, err := model.GetStoredResponseByToken(t.Context(), 21, "resp-store-endpoints")
+	require.Error(t, err)
+}
+
+func TestNormalizeResponseAPIRawBody_ReplacesExpandedHistory(t *testing.T) {
+	request := &openai.ResponseAPIRequest{
+		Model: "gpt-4o",
+		Input: openai.ResponseAPIInput{"earlier question", "follow-up"},
+	}
+	raw := []byte(`{"model":"gpt-4o","previous_response_id":"resp-abc","input":"follow-up"}`)
+
+	patched, err := normalizeResponseAPIRawBody(raw, request)
+	require.NoError(t, err)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(patched, &body))
+	require.NotContains(t, body, "previous_response_id")
+	require.Equal(t, []any{"earlier question", "follow-up"}, body["input"])
+}
@@ -259,6 +259,7 @@ func (h *chatToResponseStreamBridge) HandleDone(c *gin.Context) (bool, bool) {
 	})
 
 	render.Done(c)
+	storeFallbackResponse(c, h.meta, h.original, response)
 
 	return true, true
 }
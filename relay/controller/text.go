@@ -42,6 +42,13 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 		return openai.ErrorWrapper(err, "invalid_text_request", http.StatusBadRequest)
 	}
 
+	// run input guardrails before the body is parsed, so redactions reach the upstream
+	guard, guardErr := applyGuardrails(c, meta)
+	if guardErr != nil {
+		return guardErr
+	}
+	defer guard.finish()
+
 	// BUG: should not override meta.BaseURL and meta.ChannelId outside of metalib.GetByContext
 	// meta.BaseURL = c.GetString(ctxkey.BaseURL)
 	// meta.ChannelId = c.GetInt(ctxkey.ChannelId)
@@ -74,7 +81,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	}
 
 	// get model ratio using three-layer pricing system
-	pricingAdaptor := relay.GetAdaptor(meta.ChannelType)
+	pricingAdaptor := getPricingAdaptor(gmw.Ctx(c), meta.ChannelType, textRequest.Model)
 	modelRatio := pricing.GetModelRatioWithThreeLayers(textRequest.Model, channelModelRatio, pricingAdaptor)
 	// groupRatio := billingratio.GetGroupRatio(meta.Group)
 	groupRatio := c.GetFloat64(ctxkey.ChannelRatio)
@@ -96,6 +103,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	if textRequest.Stream {
 		tracker = streaming.NewQuotaTracker(streaming.QuotaTrackerParams{
 			UserID:                 meta.UserId,
+			OrganizationID:         meta.OrganizationId,
 			TokenID:                meta.TokenId,
 			ChannelID:              meta.ChannelId,
 			ModelName:              textRequest.Model,
@@ -185,6 +193,7 @@ func RelayTextHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
 	} else {
 		logUpstreamResponseFromBytes(lg, resp, nil, "chat_completions")
 	}
+	guard.collect(meta)
 	if respErr != nil {
 		// If usage is available even though writing to client failed (e.g., client cancelled),
 		// proceed to billing to ensure forwarded requests are charged; do not refund pre-consumed quota.
@@ -0,0 +1,510 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+	"github.com/gin-gonic/gin"
+
+	"github.com/songquanpeng/one-api/common"
+	"github.com/songquanpeng/one-api/common/config"
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/helper"
+	"github.com/songquanpeng/one-api/common/random"
+	"github.com/songquanpeng/one-api/model"
+	"github.com/songquanpeng/one-api/relay"
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/adaptor/openai"
+	billingratio "github.com/songquanpeng/one-api/relay/billing/ratio"
+	"github.com/songquanpeng/one-api/relay/channeltype"
+	metalib "github.com/songquanpeng/one-api/relay/meta"
+	relaymodel "github.com/songquanpeng/one-api/relay/model"
+	"github.com/songquanpeng/one-api/relay/pricing"
+	"github.com/songquanpeng/one-api/relay/relaymode"
+)
+
+// defaultVideoSeconds is the clip length assumed for pricing when the request leaves the
+// duration to the upstream default.
+const defaultVideoSeconds = 8
+
+// RelayVideoCreateHelper handles POST /v1/videos. It starts the upstream job, holds the
+// estimated cost through a pending TokenTransaction and returns the queued video object.
+// The hold is settled per generated second once the job finishes, or refunded if it fails.
+func RelayVideoCreateHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	lg := gmw.GetLogger(c)
+	meta := metalib.GetByContext(c)
+
+	videoRequest, err := parseVideoRequest(c)
+	if err != nil {
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+	if err = videoRequest.Validate(); err != nil {
+		return openai.ErrorWrapper(err, "invalid_video_request", http.StatusBadRequest)
+	}
+
+	meta.OriginModelName = videoRequest.Model
+	videoRequest.Model = meta.ActualModelName
+	metalib.Set2Context(c, meta)
+
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		return openai.ErrorWrapper(errors.Errorf("invalid api type: %d", meta.APIType), "invalid_api_type", http.StatusBadRequest)
+	}
+	adaptorInstance.Init(meta)
+	videoAdaptor, ok := adaptorInstance.(adaptor.VideoAdaptor)
+	if !ok {
+		return openai.ErrorWrapper(
+			errors.Errorf("channel type %s does not support video generation", channeltype.IdToName(meta.ChannelType)),
+			"video_not_supported", http.StatusBadRequest)
+	}
+
+	channelModelRatio, _ := getChannelRatios(c)
+	quotaPerSecond := videoQuotaPerSecond(videoRequest.Model, channelModelRatio, adaptorInstance, meta.ChannelRatio)
+	estimatedSeconds := int(videoRequest.Seconds)
+	if estimatedSeconds <= 0 {
+		estimatedSeconds = defaultVideoSeconds
+	}
+	preQuota := videoQuota(quotaPerSecond, estimatedSeconds)
+	if err = model.PreConsumeTokenQuota(ctx, meta.TokenId, preQuota); err != nil {
+		return openai.ErrorWrapper(err, "insufficient_quota", http.StatusForbidden)
+	}
+
+	status, bizErr := videoAdaptor.CreateVideo(ctx, meta, videoRequest)
+	if bizErr != nil {
+		if err := model.PostConsumeTokenQuota(ctx, meta.TokenId, -preQuota); err != nil {
+			lg.Error("failed to refund video pre-consumed quota", zap.Error(err))
+		}
+		return bizErr
+	}
+
+	videoId := "video_" + random.GetUUID()
+	requestId := c.GetString(helper.RequestIdKey)
+	traceId := ""
+	if tid, tidErr := gmw.TraceID(c); tidErr == nil {
+		traceId = tid.String()
+	}
+
+	logEntry := &model.Log{
+		UserId:    meta.UserId,
+		ModelName: meta.OriginModelName,
+		TokenId:   meta.TokenId,
+		TokenName: meta.TokenName,
+		Quota:     int(preQuota),
+		ChannelId: meta.ChannelId,
+		Content:   fmt.Sprintf("Video %s pre-consumed %d quota for %ds, pending settlement", videoId, preQuota, estimatedSeconds),
+		RequestId: requestId,
+		TraceId:   traceId,
+	}
+	model.RecordConsumeLog(ctx, logEntry)
+
+	txn := &model.TokenTransaction{
+		TransactionID: "video:" + videoId,
+		TokenId:       meta.TokenId,
+		UserId:        meta.UserId,
+		Status:        model.TokenTransactionStatusPending,
+		PreQuota:      preQuota,
+		Reason:        "video " + videoId,
+		RequestId:     requestId,
+		TraceId:       traceId,
+		ExpiresAt:     helper.GetTimestamp() + int64(config.VideoHoldTimeoutSec),
+	}
+	if logEntry.Id > 0 {
+		txn.LogId = &logEntry.Id
+	}
+	if err = model.CreateTokenTransaction(ctx, txn); err != nil {
+		lg.Error("failed to create video token transaction", zap.String("video_id", videoId), zap.Error(err))
+	}
+
+	job := &model.VideoJob{
+		VideoId:        videoId,
+		UpstreamId:     status.UpstreamId,
+		UserId:         meta.UserId,
+		TokenId:        meta.TokenId,
+		TokenName:      meta.TokenName,
+		Group:          meta.Group,
+		GroupRatio:     meta.ChannelRatio,
+		ChannelId:      meta.ChannelId,
+		ChannelType:    meta.ChannelType,
+		ChannelKeyId:   c.GetInt(ctxkey.ChannelKeyId),
+		OriginModel:    meta.OriginModelName,
+		ModelName:      meta.ActualModelName,
+		Size:           videoRequest.Size,
+		Seconds:        int(videoRequest.Seconds),
+		QuotaPerSecond: quotaPerSecond,
+		Status:         relaymodel.VideoStatusQueued,
+		TransactionId:  txn.Id,
+		LogId:          logEntry.Id,
+		PreQuota:       preQuota,
+		RequestId:      requestId,
+	}
+	if err = model.CreateVideoJob(ctx, job); err != nil {
+		// without the job record the client cannot poll, so undo the hold instead of leaking it
+		lg.Error("failed to record video job", zap.String("video_id", videoId), zap.Error(err))
+		cancelVideoHold(ctx, job, "failed to record video job")
+		return openai.ErrorWrapper(err, "save_video_failed", http.StatusInternalServerError)
+	}
+	if status.Terminal() {
+		if err = applyVideoStatus(ctx, job, status); err != nil {
+			lg.Error("failed to settle video job", zap.String("video_id", videoId), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, videoObject(job))
+	return nil
+}
+
+// RelayVideoRetrieveHelper handles GET /v1/videos/:id. Unfinished jobs are polled upstream
+// and settled as soon as they reach a terminal state.
+func RelayVideoRetrieveHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	job, err := model.GetVideoJobByUser(ctx, c.GetInt(ctxkey.Id), c.Param("id"))
+	if err != nil {
+		return openai.ErrorWrapper(errors.Errorf("No such video: %s", c.Param("id")), "video_not_found", http.StatusNotFound)
+	}
+
+	if !job.Settled {
+		if err = SettleVideoJob(ctx, job); err != nil {
+			// report the last known state rather than failing the poll
+			gmw.GetLogger(c).Warn("failed to refresh video job", zap.String("video_id", job.VideoId), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, videoObject(job))
+	return nil
+}
+
+// RelayVideoContentHelper handles GET /v1/videos/:id/content and streams the generated clip.
+func RelayVideoContentHelper(c *gin.Context) *relaymodel.ErrorWithStatusCode {
+	ctx := gmw.Ctx(c)
+	job, err := model.GetVideoJobByUser(ctx, c.GetInt(ctxkey.Id), c.Param("id"))
+	if err != nil {
+		return openai.ErrorWrapper(errors.Errorf("No such video: %s", c.Param("id")), "video_not_found", http.StatusNotFound)
+	}
+	if job.Status != relaymodel.VideoStatusCompleted {
+		return openai.ErrorWrapper(errors.Errorf("video %s is %s", job.VideoId, job.Status), "video_not_ready", http.StatusBadRequest)
+	}
+
+	meta, videoAdaptor, err := videoJobAdaptor(job)
+	if err != nil {
+		return openai.ErrorWrapper(err, "video_channel_unavailable", http.StatusServiceUnavailable)
+	}
+	body, contentType, bizErr := videoAdaptor.GetVideoContent(ctx, meta, job.UpstreamId)
+	if bizErr != nil {
+		return bizErr
+	}
+	defer body.Close()
+
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if _, err = io.Copy(c.Writer, body); err != nil {
+		gmw.GetLogger(c).Warn("failed to stream video content", zap.String("video_id", job.VideoId), zap.Error(err))
+	}
+	return nil
+}
+
+// SettleVideoJob polls the upstream state of job and, once the job is terminal, charges the
+// generated seconds or refunds the hold. Jobs unfinished after VideoHoldTimeoutSec are
+// treated as failed.
+func SettleVideoJob(ctx context.Context, job *model.VideoJob) error {
+	if job.Settled {
+		return nil
+	}
+
+	meta, videoAdaptor, err := videoJobAdaptor(job)
+	if err != nil {
+		return errors.Wrapf(err, "build adaptor for video %s", job.VideoId)
+	}
+	status, bizErr := videoAdaptor.GetVideo(ctx, meta, job.UpstreamId)
+	if bizErr != nil {
+		return errors.Errorf("poll video %s: %s", job.VideoId, bizErr.Message)
+	}
+	if !status.Terminal() && helper.GetTimestamp()-job.CreatedAt > int64(config.VideoHoldTimeoutSec) {
+		status.Status = relaymodel.VideoStatusFailed
+		status.Error = "video generation timed out"
+	}
+	return applyVideoStatus(ctx, job, status)
+}
+
+// applyVideoStatus records status on job and settles its quota hold once status is terminal.
+func applyVideoStatus(ctx context.Context, job *model.VideoJob, status *relaymodel.VideoJobStatus) error {
+	now := helper.GetTimestamp()
+	switch status.Status {
+	case relaymodel.VideoStatusCompleted:
+		billedSeconds := status.Seconds
+		if billedSeconds <= 0 {
+			billedSeconds = job.Seconds
+		}
+		if billedSeconds <= 0 {
+			billedSeconds = defaultVideoSeconds
+		}
+		finalQuota := videoQuota(job.QuotaPerSecond, billedSeconds)
+		claimed, err := model.ClaimVideoJobSettlement(ctx, job.Id, map[string]any{
+			"status":         status.Status,
+			"progress":       100,
+			"billed_seconds": billedSeconds,
+			"final_quota":    finalQuota,
+			"completed_at":   now,
+		})
+		if err != nil || !claimed {
+			return err
+		}
+		job.Settled, job.Status, job.Progress = true, status.Status, 100
+		job.BilledSeconds, job.FinalQuota, job.CompletedAt = billedSeconds, finalQuota, now
+		return confirmVideoHold(ctx, job)
+	case relaymodel.VideoStatusFailed:
+		claimed, err := model.ClaimVideoJobSettlement(ctx, job.Id, map[string]any{
+			"status":       status.Status,
+			"error":        status.Error,
+			"final_quota":  int64(0),
+			"completed_at": now,
+		})
+		if err != nil || !claimed {
+			return err
+		}
+		job.Settled, job.Status, job.Error, job.FinalQuota, job.CompletedAt = true, status.Status, status.Error, 0, now
+		cancelVideoHold(ctx, job, status.Error)
+		return nil
+	default:
+		if status.Status == job.Status && status.Progress == job.Progress {
+			return nil
+		}
+		job.Status, job.Progress = status.Status, status.Progress
+		return model.UpdateVideoJob(ctx, job.Id, map[string]any{
+			"status":   status.Status,
+			"progress": status.Progress,
+		})
+	}
+}
+
+// confirmVideoHold charges the final quota of a completed job against its hold.
+func confirmVideoHold(ctx context.Context, job *model.VideoJob) error {
+	if delta := job.FinalQuota - job.PreQuota; delta != 0 {
+		if err := model.PostConsumeTokenQuota(ctx, job.TokenId, delta); err != nil {
+			return errors.Wrapf(err, "reconcile quota for video %s", job.VideoId)
+		}
+	}
+
+	if job.TransactionId != 0 {
+		if err := model.UpdateTokenTransaction(ctx, job.TransactionId, map[string]any{
+			"status":         model.TokenTransactionStatusConfirmed,
+			"final_quota":    job.FinalQuota,
+			"confirmed_at":   helper.GetTimestamp(),
+			"auto_confirmed": false,
+			"expires_at":     int64(0),
+		}); err != nil {
+			return errors.Wrapf(err, "confirm token transaction for video %s", job.VideoId)
+		}
+	}
+
+	if job.FinalQuota > 0 {
+		model.UpdateUserUsedQuotaAndRequestCount(job.UserId, job.FinalQuota)
+		model.UpdateChannelUsedQuota(job.ChannelId, job.FinalQuota)
+	}
+
+	if job.LogId > 0 {
+		if err := model.UpdateConsumeLogByID(ctx, job.LogId, map[string]any{
+			"quota": int(job.FinalQuota),
+			"content": fmt.Sprintf("Video %s completed, settled %d quota for %ds (pre-consumed %d)",
+				job.VideoId, job.FinalQuota, job.BilledSeconds, job.PreQuota),
+		}); err != nil {
+			gmw.GetLogger(ctx).Warn("failed to update video consume log", zap.String("video_id", job.VideoId), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// cancelVideoHold refunds the quota held by a job that produced no video.
+func cancelVideoHold(ctx context.Context, job *model.VideoJob, reason string) {
+	lg := gmw.GetLogger(ctx)
+	if job.PreQuota > 0 {
+		if err := model.PostConsumeTokenQuota(ctx, job.TokenId, -job.PreQuota); err != nil {
+			lg.Error("failed to refund video pre-consumed quota", zap.String("video_id", job.VideoId), zap.Error(err))
+		}
+	}
+
+	if job.TransactionId != 0 {
+		if err := model.UpdateTokenTransaction(ctx, job.TransactionId, map[string]any{
+			"status":      model.TokenTransactionStatusCanceled,
+			"final_quota": int64(0),
+			"canceled_at": helper.GetTimestamp(),
+			"expires_at":  int64(0),
+			"reason":      reason,
+		}); err != nil {
+			lg.Error("failed to cancel video token transaction", zap.String("video_id", job.VideoId), zap.Error(err))
+		}
+	}
+
+	if job.LogId > 0 {
+		if err := model.UpdateConsumeLogByID(ctx, job.LogId, map[string]any{
+			"quota":   0,
+			"content": fmt.Sprintf("Video %s failed, refunded %d quota: %s", job.VideoId, job.PreQuota, reason),
+		}); err != nil {
+			lg.Warn("failed to update video consume log", zap.String("video_id", job.VideoId), zap.Error(err))
+		}
+	}
+}
+
+// videoJobAdaptor rebuilds the relay meta of job from its channel and pinned key, so jobs can
+// be polled without the request that created them.
+func videoJobAdaptor(job *model.VideoJob) (*metalib.Meta, adaptor.VideoAdaptor, error) {
+	channel, err := model.GetChannelById(job.ChannelId, true)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load video channel")
+	}
+	cfg, err := channel.LoadConfig()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load channel config")
+	}
+
+	apiKey := channel.Key
+	if channel.IsMultiKey() {
+		key, err := model.GetChannelKeyById(job.ChannelKeyId)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "load pinned channel key")
+		}
+		apiKey = key.Key
+	}
+
+	meta := &metalib.Meta{
+		Mode:            relaymode.Videos,
+		ChannelType:     channel.Type,
+		ChannelId:       channel.Id,
+		TokenId:         job.TokenId,
+		TokenName:       job.TokenName,
+		UserId:          job.UserId,
+		Group:           job.Group,
+		BaseURL:         channel.GetBaseURL(),
+		APIKey:          apiKey,
+		APIType:         channeltype.ToAPIType(channel.Type),
+		Config:          cfg,
+		OriginModelName: job.OriginModel,
+		ActualModelName: job.ModelName,
+		ChannelRatio:    job.GroupRatio,
+	}
+	if meta.BaseURL == "" {
+		meta.BaseURL = channeltype.ChannelBaseURLs[channel.Type]
+	}
+
+	adaptorInstance := relay.GetAdaptor(meta.APIType)
+	if adaptorInstance == nil {
+		return nil, nil, errors.Errorf("invalid api type: %d", meta.APIType)
+	}
+	adaptorInstance.Init(meta)
+	videoAdaptor, ok := adaptorInstance.(adaptor.VideoAdaptor)
+	if !ok {
+		return nil, nil, errors.Errorf("channel type %s does not support video generation", channeltype.IdToName(channel.Type))
+	}
+	return meta, videoAdaptor, nil
+}
+
+// parseVideoRequest reads a JSON or multipart video request. A multipart input_reference
+// file is inlined as a data URL.
+func parseVideoRequest(c *gin.Context) (*relaymodel.VideoRequest, error) {
+	request := &relaymodel.VideoRequest{}
+	if err := common.UnmarshalBodyReusable(c, request); err != nil {
+		return nil, errors.Wrap(err, "parse video request")
+	}
+	if !strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/form-data") {
+		return request, nil
+	}
+
+	if reference := c.PostForm("input_reference"); reference != "" {
+		request.InputReference = reference
+		return request, nil
+	}
+	fileHeader, err := c.FormFile("input_reference")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return request, nil
+		}
+		return nil, errors.Wrap(err, "read input_reference")
+	}
+	if request.InputReference, err = fileToDataURL(fileHeader); err != nil {
+		return nil, errors.Wrap(err, "read input_reference")
+	}
+	return request, nil
+}
+
+func fileToDataURL(fileHeader *multipart.FileHeader) (string, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return "", errors.Wrap(err, "open file")
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", errors.Wrap(err, "read file")
+	}
+	mimeType := fileHeader.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// videoQuotaPerSecond prices one generated second of modelName including the group ratio.
+// Models without a per-second price fall back to their model ratio at ratio.TokensPerSec
+// tokens per second, matching the legacy Veo chat path.
+func videoQuotaPerSecond(modelName string, channelModelRatio map[string]float64, pricingAdaptor adaptor.Adaptor, groupRatio float64) float64 {
+	if priceUsd := getVideoPrice(modelName, pricingAdaptor); priceUsd > 0 {
+		return priceUsd * billingratio.QuotaPerUsd * groupRatio
+	}
+	modelRatio := pricing.GetModelRatioWithThreeLayers(modelName, channelModelRatio, pricingAdaptor)
+	return modelRatio * billingratio.TokensPerSec * groupRatio
+}
+
+// getVideoPrice returns the USD per generated second of a video model, preferring the
+// adaptor's pricing over the global pricing table.
+func getVideoPrice(modelName string, pricingAdaptor adaptor.Adaptor) float64 {
+	if pricingAdaptor != nil {
+		if pm, ok := pricingAdaptor.GetDefaultModelPricing()[modelName]; ok && pm.VideoPriceUsdPerSecond > 0 {
+			return pm.VideoPriceUsdPerSecond
+		}
+	}
+	if pm, ok := pricing.GetGlobalModelPricing()[modelName]; ok {
+		return pm.VideoPriceUsdPerSecond
+	}
+	return 0
+}
+
+func videoQuota(quotaPerSecond float64, seconds int) int64 {
+	return int64(math.Ceil(quotaPerSecond * float64(seconds)))
+}
+
+// videoObject renders job as an OpenAI video object.
+func videoObject(job *model.VideoJob) *relaymodel.Video {
+	video := &relaymodel.Video{
+		Id:        job.VideoId,
+		Object:    "video",
+		Model:     job.OriginModel,
+		Status:    job.Status,
+		Progress:  job.Progress,
+		CreatedAt: job.CreatedAt,
+		Size:      job.Size,
+	}
+	switch {
+	case job.BilledSeconds > 0:
+		video.Seconds = strconv.Itoa(job.BilledSeconds)
+	case job.Seconds > 0:
+		video.Seconds = strconv.Itoa(job.Seconds)
+	}
+	if job.CompletedAt > 0 {
+		completedAt := job.CompletedAt
+		video.CompletedAt = &completedAt
+	}
+	if job.Status == relaymodel.VideoStatusFailed {
+		video.Error = &relaymodel.VideoError{Code: "video_generation_failed", Message: job.Error}
+	}
+	return video
+}
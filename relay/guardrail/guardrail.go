@@ -0,0 +1,552 @@
+// Package guardrail implements the content guardrails applied around the chat completions,
+// Claude Messages and Response API relays: keyword and regex deny-lists, PII redaction and
+// moderation through an existing /v1/moderations-capable channel.
+//
+// Rules are configured per user group through the GuardrailPolicy option and per token
+// through Token.Guardrails; token rules are appended to the rules of the token's group.
+package guardrail
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+)
+
+const (
+	// RuleTypeKeyword matches a case-insensitive list of literal keywords.
+	RuleTypeKeyword = "keyword"
+	// RuleTypeRegex matches a list of regular expressions.
+	RuleTypeRegex = "regex"
+	// RuleTypePII detects emails, phone numbers and payment card numbers.
+	RuleTypePII = "pii"
+	// RuleTypeModeration sends the request text to a moderation channel.
+	RuleTypeModeration = "moderation"
+)
+
+const (
+	// ActionBlock rejects the request when the rule matches.
+	ActionBlock = "block"
+	// ActionRedact replaces the matched text and lets the request through.
+	ActionRedact = "redact"
+)
+
+const (
+	// StageInput applies the rule to the client request.
+	StageInput = "input"
+	// StageOutput applies the rule to the upstream response.
+	StageOutput = "output"
+	// StageBoth applies the rule to requests and responses.
+	StageBoth = "both"
+)
+
+const (
+	PIIEmail = "email"
+	PIIPhone = "phone"
+	PIICard  = "card"
+)
+
+// DefaultModerationModel is used by moderation rules that do not name a model.
+const DefaultModerationModel = "omni-moderation-latest"
+
+const defaultReplacement = "[REDACTED]"
+
+// Rule is a single guardrail as stored in the GuardrailPolicy option or on a token.
+type Rule struct {
+	// Name identifies the rule in logs; it defaults to the rule type.
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+	// Patterns holds keywords, regular expressions or PII kinds depending on Type.
+	// An empty PII list enables every kind.
+	Patterns []string `json:"patterns,omitempty"`
+	// Action is block or redact. Keyword, regex and moderation rules block by default,
+	// PII rules redact by default. Moderation rules can only block.
+	Action string `json:"action,omitempty"`
+	// Stage is input, output or both (default). Moderation rules only run on input.
+	Stage string `json:"stage,omitempty"`
+	// Replacement overrides the text written in place of redacted matches.
+	Replacement string `json:"replacement,omitempty"`
+	// ChannelId selects the channel whose /v1/moderations endpoint is called.
+	ChannelId int `json:"channel_id,omitempty"`
+	// Model is the moderation model, DefaultModerationModel when empty.
+	Model string `json:"model,omitempty"`
+	// FailClosed blocks the request when the moderation channel cannot be reached.
+	FailClosed bool `json:"fail_closed,omitempty"`
+}
+
+// Violation records a rule that matched while processing a request or response.
+// Matched content is never recorded.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Type    string `json:"type"`
+	Stage   string `json:"stage"`
+	Action  string `json:"action"`
+	Matches int    `json:"matches,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// normalize fills in defaults and validates the rule.
+func (r *Rule) normalize() error {
+	r.Type = strings.ToLower(strings.TrimSpace(r.Type))
+	r.Action = strings.ToLower(strings.TrimSpace(r.Action))
+	r.Stage = strings.ToLower(strings.TrimSpace(r.Stage))
+	if r.Name == "" {
+		r.Name = r.Type
+	}
+	if r.Stage == "" {
+		r.Stage = StageBoth
+	}
+	switch r.Stage {
+	case StageInput, StageOutput, StageBoth:
+	default:
+		return errors.Errorf("rule %q: unknown stage %q", r.Name, r.Stage)
+	}
+
+	switch r.Type {
+	case RuleTypeKeyword, RuleTypeRegex:
+		if len(r.Patterns) == 0 {
+			return errors.Errorf("rule %q: patterns are required", r.Name)
+		}
+		if r.Action == "" {
+			r.Action = ActionBlock
+		}
+	case RuleTypePII:
+		for _, kind := range r.Patterns {
+			if _, ok := piiMatchers[kind]; !ok {
+				return errors.Errorf("rule %q: unknown pii kind %q", r.Name, kind)
+			}
+		}
+		if r.Action == "" {
+			r.Action = ActionRedact
+		}
+	case RuleTypeModeration:
+		if r.ChannelId <= 0 {
+			return errors.Errorf("rule %q: channel_id is required", r.Name)
+		}
+		if r.Stage == StageOutput {
+			return errors.Errorf("rule %q: moderation rules only run on input", r.Name)
+		}
+		r.Stage = StageInput
+		if r.Action == "" {
+			r.Action = ActionBlock
+		}
+		if r.Action != ActionBlock {
+			return errors.Errorf("rule %q: moderation rules can only block", r.Name)
+		}
+		if r.Model == "" {
+			r.Model = DefaultModerationModel
+		}
+	default:
+		return errors.Errorf("rule %q: unknown type %q", r.Name, r.Type)
+	}
+
+	switch r.Action {
+	case ActionBlock, ActionRedact:
+	default:
+		return errors.Errorf("rule %q: unknown action %q", r.Name, r.Action)
+	}
+	return nil
+}
+
+// appliesTo reports whether the rule runs at the given stage.
+func (r *Rule) appliesTo(stage string) bool {
+	return r.Stage == StageBoth || r.Stage == stage
+}
+
+type matcher struct {
+	re          *regexp.Regexp
+	valid       func(string) bool
+	replacement string
+}
+
+// piiMatchers are applied in a fixed order so card numbers are consumed before the
+// looser phone pattern can match part of them.
+var piiMatchers = map[string]matcher{
+	PIIEmail: {
+		re:          regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		replacement: "[REDACTED_EMAIL]",
+	},
+	PIICard: {
+		re:          regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`),
+		valid:       luhnValid,
+		replacement: "[REDACTED_CARD]",
+	},
+	PIIPhone: {
+		re:          regexp.MustCompile(`(?:\+\d{1,3}[\s.\-]?)?(?:\(\d{2,4}\)|\d{2,4})[\s.\-]\d{3,4}[\s.\-]\d{3,4}\b|\+\d{10,14}\b`),
+		replacement: "[REDACTED_PHONE]",
+	},
+}
+
+var piiOrder = []string{PIIEmail, PIICard, PIIPhone}
+
+// luhnValid reports whether the digits in s form a 13-19 digit number passing the Luhn check.
+func luhnValid(s string) bool {
+	digits := make([]int, 0, len(s))
+	for _, r := range s {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+
+	sum := 0
+	for i := range digits {
+		d := digits[len(digits)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+type compiledRule struct {
+	Rule
+	matchers []matcher
+}
+
+func compileRule(rule Rule) (compiledRule, error) {
+	if err := rule.normalize(); err != nil {
+		return compiledRule{}, err
+	}
+
+	compiled := compiledRule{Rule: rule}
+	replacement := rule.Replacement
+	if replacement == "" {
+		replacement = defaultReplacement
+	}
+	switch rule.Type {
+	case RuleTypeKeyword:
+		quoted := make([]string, 0, len(rule.Patterns))
+		for _, keyword := range rule.Patterns {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				quoted = append(quoted, regexp.QuoteMeta(keyword))
+			}
+		}
+		if len(quoted) == 0 {
+			return compiledRule{}, errors.Errorf("rule %q: patterns are required", rule.Name)
+		}
+		compiled.matchers = []matcher{{
+			re:          regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`),
+			replacement: replacement,
+		}}
+	case RuleTypeRegex:
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return compiledRule{}, errors.Wrapf(err, "rule %q: invalid pattern %q", rule.Name, pattern)
+			}
+			compiled.matchers = append(compiled.matchers, matcher{re: re, replacement: replacement})
+		}
+	case RuleTypePII:
+		kinds := map[string]bool{}
+		for _, kind := range rule.Patterns {
+			kinds[kind] = true
+		}
+		for _, kind := range piiOrder {
+			if len(kinds) > 0 && !kinds[kind] {
+				continue
+			}
+			m := piiMatchers[kind]
+			if rule.Replacement != "" {
+				m.replacement = rule.Replacement
+			}
+			compiled.matchers = append(compiled.matchers, m)
+		}
+	}
+	return compiled, nil
+}
+
+// apply counts the matches of the rule in text and returns the text with matches replaced.
+func (r *compiledRule) apply(text string) (string, int) {
+	count := 0
+	for _, m := range r.matchers {
+		text = m.re.ReplaceAllStringFunc(text, func(match string) string {
+			if m.valid != nil && !m.valid(match) {
+				return match
+			}
+			count++
+			return m.replacement
+		})
+	}
+	return text, count
+}
+
+// mayMatch is a cheap pre-check on raw bytes used to skip decoding content that
+// cannot trigger the rule.
+func (r *compiledRule) mayMatch(data []byte) bool {
+	for _, m := range r.matchers {
+		if m.re.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pipeline is a compiled, ordered list of guardrail rules.
+type Pipeline struct {
+	rules []compiledRule
+}
+
+// Compile validates the rules and builds a pipeline from them.
+func Compile(rules []Rule) (*Pipeline, error) {
+	p := &Pipeline{}
+	for _, rule := range rules {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		p.rules = append(p.rules, compiled)
+	}
+	return p, nil
+}
+
+// Empty reports whether the pipeline has no rules.
+func (p *Pipeline) Empty() bool {
+	return p == nil || len(p.rules) == 0
+}
+
+// HasStage reports whether any rule runs at the given stage.
+func (p *Pipeline) HasStage(stage string) bool {
+	if p == nil {
+		return false
+	}
+	for i := range p.rules {
+		if p.rules[i].appliesTo(stage) {
+			return true
+		}
+	}
+	return false
+}
+
+// ModerationRules returns the moderation rules of the pipeline.
+func (p *Pipeline) ModerationRules() []Rule {
+	if p == nil {
+		return nil
+	}
+	var rules []Rule
+	for i := range p.rules {
+		if p.rules[i].Type == RuleTypeModeration {
+			rules = append(rules, p.rules[i].Rule)
+		}
+	}
+	return rules
+}
+
+// CheckText applies the local (non-moderation) rules of the stage to text. Output content
+// has already been partially delivered, so blocking rules redact it instead.
+func (p *Pipeline) CheckText(stage, text string) (string, []Violation, bool) {
+	if p == nil {
+		return text, nil, false
+	}
+
+	var violations []Violation
+	blocked := false
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if rule.Type == RuleTypeModeration || !rule.appliesTo(stage) {
+			continue
+		}
+
+		redacted, count := rule.apply(text)
+		if count == 0 {
+			continue
+		}
+		action := rule.Action
+		if stage == StageOutput {
+			action = ActionRedact
+		}
+		violations = append(violations, Violation{
+			Rule:    rule.Name,
+			Type:    rule.Type,
+			Stage:   stage,
+			Action:  action,
+			Matches: count,
+		})
+		if action == ActionBlock {
+			blocked = true
+			continue
+		}
+		text = redacted
+	}
+	return text, violations, blocked
+}
+
+func (p *Pipeline) mayMatch(stage string, data []byte) bool {
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if rule.Type != RuleTypeModeration && rule.appliesTo(stage) && rule.mayMatch(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestResult is the outcome of running the input stage over a request body.
+type RequestResult struct {
+	// Body is the request body with redactions applied; it is the original slice when
+	// nothing was redacted.
+	Body []byte
+	// Text is the user-supplied text of the request, joined for moderation.
+	Text       string
+	Violations []Violation
+	Blocked    bool
+}
+
+// ApplyRequest runs the input-stage rules over the text fields of a JSON request body.
+func (p *Pipeline) ApplyRequest(body []byte) (*RequestResult, error) {
+	result := &RequestResult{Body: body}
+	if p.Empty() {
+		return result, nil
+	}
+
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode request body")
+	}
+
+	var texts []string
+	changed := false
+	doc = walkText(doc, false, func(text string) string {
+		redacted, violations, blocked := p.CheckText(StageInput, text)
+		texts = append(texts, text)
+		result.Violations = MergeViolations(result.Violations, violations)
+		result.Blocked = result.Blocked || blocked
+		if redacted != text {
+			changed = true
+		}
+		return redacted
+	})
+	result.Text = strings.Join(texts, "\n")
+
+	if changed && !result.Blocked {
+		if result.Body, err = encodeJSON(doc); err != nil {
+			return nil, errors.Wrap(err, "encode request body")
+		}
+	}
+	return result, nil
+}
+
+// applyOutputJSON redacts the text fields of a JSON response payload. The original
+// payload is returned when nothing matched or it is not valid JSON.
+func (p *Pipeline) applyOutputJSON(data []byte) ([]byte, []Violation) {
+	if !p.mayMatch(StageOutput, data) {
+		return data, nil
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return data, nil
+	}
+
+	var all []Violation
+	doc = walkText(doc, false, func(text string) string {
+		redacted, violations, _ := p.CheckText(StageOutput, text)
+		all = MergeViolations(all, violations)
+		return redacted
+	})
+	if len(all) == 0 {
+		return data, nil
+	}
+	encoded, err := encodeJSON(doc)
+	if err != nil {
+		return data, nil
+	}
+	return encoded, all
+}
+
+// textFields are the JSON keys whose string values carry user or model text across the
+// OpenAI, Claude and Response API schemas. Nested values inherit the flag, so arrays of
+// content parts under "content" are covered while ids, roles and urls are not.
+var textFields = map[string]bool{
+	"content":      true,
+	"text":         true,
+	"input":        true,
+	"prompt":       true,
+	"system":       true,
+	"instructions": true,
+	"arguments":    true,
+	"refusal":      true,
+	"delta":        true,
+	"partial_json": true,
+}
+
+func walkText(v any, inText bool, fn func(string) string) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, child := range value {
+			value[key] = walkText(child, textFields[key], fn)
+		}
+		return value
+	case []any:
+		for i, child := range value {
+			value[i] = walkText(child, inText, fn)
+		}
+		return value
+	case string:
+		if inText && value != "" {
+			return fn(value)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+func decodeJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return doc, nil
+}
+
+func encodeJSON(doc any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// MergeViolations folds src into dst, combining entries of the same rule, stage and action.
+func MergeViolations(dst []Violation, src []Violation) []Violation {
+	for _, v := range src {
+		merged := false
+		for i := range dst {
+			if dst[i].Rule == v.Rule && dst[i].Stage == v.Stage && dst[i].Action == v.Action {
+				dst[i].Matches += v.Matches
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+// Summary renders violations as a short human readable string for log content.
+func Summary(violations []Violation) string {
+	parts := make([]string, 0, len(violations))
+	for _, v := range violations {
+		part := fmt.Sprintf("%s(%s/%s)", v.Rule, v.Stage, v.Action)
+		if v.Detail != "" {
+			part += ": " + v.Detail
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
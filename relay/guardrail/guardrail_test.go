@@ -0,0 +1,143 @@
+package guardrail
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTextRedactsPII(t *testing.T) {
+	t.Parallel()
+
+	p, err := Compile([]Rule{{Type: RuleTypePII}})
+	require.NoError(t, err)
+
+	text, violations, blocked := p.CheckText(StageInput,
+		"mail bob@example.com, card 4111 1111 1111 1111, call +1 415-555-0100, order 1234567890123")
+	require.False(t, blocked)
+	require.Equal(t,
+		"mail [REDACTED_EMAIL], card [REDACTED_CARD], call [REDACTED_PHONE], order 1234567890123", text)
+	require.Len(t, violations, 1)
+	require.Equal(t, 3, violations[0].Matches)
+	require.Equal(t, ActionRedact, violations[0].Action)
+}
+
+func TestCheckTextKeywordAndRegex(t *testing.T) {
+	t.Parallel()
+
+	p, err := Compile([]Rule{
+		{Name: "secrets", Type: RuleTypeRegex, Patterns: []string{`sk-[A-Za-z0-9]{8,}`}, Action: ActionRedact},
+		{Name: "banned", Type: RuleTypeKeyword, Patterns: []string{"Project X"}},
+	})
+	require.NoError(t, err)
+
+	text, violations, blocked := p.CheckText(StageInput, "key sk-abcdefgh123")
+	require.False(t, blocked)
+	require.Equal(t, "key [REDACTED]", text)
+	require.Len(t, violations, 1)
+
+	_, violations, blocked = p.CheckText(StageInput, "tell me about project x")
+	require.True(t, blocked)
+	require.Equal(t, "banned", violations[0].Rule)
+
+	// output has already started streaming, so blocking rules redact instead
+	text, violations, blocked = p.CheckText(StageOutput, "Project X is secret")
+	require.False(t, blocked)
+	require.Equal(t, "[REDACTED] is secret", text)
+	require.Equal(t, ActionRedact, violations[0].Action)
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	t.Parallel()
+
+	for _, rule := range []Rule{
+		{Type: "unknown"},
+		{Type: RuleTypeKeyword},
+		{Type: RuleTypeRegex, Patterns: []string{"("}},
+		{Type: RuleTypePII, Patterns: []string{"ssn"}},
+		{Type: RuleTypeModeration},
+		{Type: RuleTypeModeration, ChannelId: 1, Action: ActionRedact},
+		{Type: RuleTypePII, Stage: "sometimes"},
+	} {
+		_, err := Compile([]Rule{rule})
+		require.Error(t, err, rule.Type)
+	}
+
+	_, err := ParsePolicy(`{"default":[{"type":"moderation","channel_id":3}]}`)
+	require.NoError(t, err)
+}
+
+func TestApplyRequestRewritesTextFieldsOnly(t *testing.T) {
+	t.Parallel()
+
+	p, err := Compile([]Rule{{Type: RuleTypePII, Patterns: []string{PIIEmail}}})
+	require.NoError(t, err)
+
+	body := []byte(`{"model":"gpt-4o","user":"ops@example.com","max_tokens":4096,` +
+		`"messages":[{"role":"user","content":[{"type":"text","text":"reach me at a@b.io"}]}]}`)
+	result, err := p.ApplyRequest(body)
+	require.NoError(t, err)
+	require.False(t, result.Blocked)
+	require.JSONEq(t, `{"model":"gpt-4o","user":"ops@example.com","max_tokens":4096,`+
+		`"messages":[{"role":"user","content":[{"type":"text","text":"reach me at [REDACTED_EMAIL]"}]}]}`,
+		string(result.Body))
+	require.Equal(t, "reach me at a@b.io", result.Text)
+
+	clean := []byte(`{"messages":[{"role":"user","content":"hi"}]}`)
+	result, err = p.ApplyRequest(clean)
+	require.NoError(t, err)
+	require.Equal(t, clean, result.Body)
+}
+
+func TestResponseWriterRedactsStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p, err := Compile([]Rule{{Type: RuleTypePII, Stage: StageOutput}})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Header("Content-Type", "text/event-stream")
+	w := NewResponseWriter(c.Writer, p)
+
+	_, err = w.WriteString(`data: {"choices":[{"delta":{"content":"write to x@y.com"}}],"created":1712345678}` + "\n\n")
+	require.NoError(t, err)
+	// a partial line is held back until its end arrives
+	_, err = w.WriteString(`data: {"choices":[{"delta":{"content":"ok"}}]}`)
+	require.NoError(t, err)
+	require.NotContains(t, recorder.Body.String(), `"ok"`)
+	_, err = w.WriteString("\n\ndata: [DONE]\n\n")
+	require.NoError(t, err)
+
+	violations := w.Drain()
+	require.Len(t, violations, 1)
+	out := recorder.Body.String()
+	require.Contains(t, out, `[REDACTED_EMAIL]`)
+	require.Contains(t, out, `"created":1712345678`)
+	require.Contains(t, out, `"ok"`)
+	require.Contains(t, out, "data: [DONE]\n\n")
+}
+
+func TestResponseWriterRedactsJSONBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	p, err := Compile([]Rule{{Type: RuleTypeKeyword, Patterns: []string{"internal"}, Stage: StageOutput}})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Header("Content-Type", "application/json")
+	c.Header("Content-Length", "64")
+	w := NewResponseWriter(c.Writer, p)
+
+	_, err = w.Write([]byte(`{"id":"internal-1","content":[{"type":"text","text":"Internal only"}]}`))
+	require.NoError(t, err)
+	require.Empty(t, recorder.Body.String())
+
+	violations := w.Drain()
+	require.Len(t, violations, 1)
+	require.JSONEq(t, `{"id":"internal-1","content":[{"type":"text","text":"[REDACTED] only"}]}`, recorder.Body.String())
+	require.Empty(t, recorder.Header().Get("Content-Length"))
+}
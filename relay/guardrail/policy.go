@@ -0,0 +1,114 @@
+package guardrail
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// maxCachedPipelines bounds the compiled pipeline cache; it is simply reset when full.
+const maxCachedPipelines = 1024
+
+var policyLock sync.RWMutex
+
+// GroupPolicy maps a user group to the guardrail rules applied to its requests.
+var GroupPolicy = map[string][]Rule{}
+
+var pipelineCache = map[string]*Pipeline{}
+
+// Policy2JSONString serializes the group policy for the option table.
+func Policy2JSONString() string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	jsonBytes, err := json.Marshal(GroupPolicy)
+	if err != nil {
+		logger.Logger.Error("error marshalling guardrail policy", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// ParsePolicy parses a group policy and validates every rule in it.
+func ParsePolicy(jsonStr string) (map[string][]Rule, error) {
+	policy := map[string][]Rule{}
+	if strings.TrimSpace(jsonStr) != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &policy); err != nil {
+			return nil, errors.Wrap(err, "unmarshal guardrail policy")
+		}
+	}
+	for group, rules := range policy {
+		if _, err := Compile(rules); err != nil {
+			return nil, errors.Wrapf(err, "group %q", group)
+		}
+	}
+	return policy, nil
+}
+
+// UpdatePolicyByJSONString replaces the group policy after validating every rule.
+func UpdatePolicyByJSONString(jsonStr string) error {
+	policy, err := ParsePolicy(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	GroupPolicy = policy
+	pipelineCache = map[string]*Pipeline{}
+	return nil
+}
+
+// ParseRules parses and validates the guardrail rules stored on a token.
+func ParseRules(jsonStr string) ([]Rule, error) {
+	if strings.TrimSpace(jsonStr) == "" {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, errors.Wrap(err, "unmarshal guardrail rules")
+	}
+	if _, err := Compile(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// ForRequest returns the pipeline for a group combined with the token's own rules.
+// It returns nil when no rule applies.
+func ForRequest(group string, tokenRules string) (*Pipeline, error) {
+	key := group + "\x00" + tokenRules
+	policyLock.RLock()
+	cached, ok := pipelineCache[key]
+	rules := GroupPolicy[group]
+	policyLock.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	extra, err := ParseRules(tokenRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "token guardrails")
+	}
+	combined := make([]Rule, 0, len(rules)+len(extra))
+	combined = append(combined, rules...)
+	combined = append(combined, extra...)
+
+	var pipeline *Pipeline
+	if len(combined) > 0 {
+		if pipeline, err = Compile(combined); err != nil {
+			return nil, err
+		}
+	}
+
+	policyLock.Lock()
+	if len(pipelineCache) >= maxCachedPipelines {
+		pipelineCache = map[string]*Pipeline{}
+	}
+	pipelineCache[key] = pipeline
+	policyLock.Unlock()
+	return pipeline, nil
+}
@@ -0,0 +1,108 @@
+package guardrail
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponseWriter applies the output-stage rules of a pipeline to everything written
+// through it. Server-sent events are checked line by line as they stream; any other
+// body is buffered and checked as a whole when Drain is called.
+//
+// Each event is checked on its own, so a match whose text is split across the deltas of
+// several events, such as an email address streamed token by token, is not redacted.
+// Rules that must hold for streamed replies are better enforced at the input stage.
+type ResponseWriter struct {
+	gin.ResponseWriter
+	pipeline   *Pipeline
+	pending    []byte
+	violations []Violation
+}
+
+// NewResponseWriter wraps w with the output-stage rules of p.
+func NewResponseWriter(w gin.ResponseWriter, p *Pipeline) *ResponseWriter {
+	return &ResponseWriter{ResponseWriter: w, pipeline: p}
+}
+
+func (w *ResponseWriter) isStream() bool {
+	return strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+// Write buffers data until a complete event line (or, for non-stream bodies, the whole
+// body) is available. Redaction changes the body length, so Content-Length is dropped.
+func (w *ResponseWriter) Write(data []byte) (int, error) {
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeaderNow()
+	w.pending = append(w.pending, data...)
+	if !w.isStream() {
+		return len(data), nil
+	}
+
+	if idx := bytes.LastIndexByte(w.pending, '\n'); idx >= 0 {
+		if err := w.writeLines(w.pending[:idx+1]); err != nil {
+			return 0, err
+		}
+		w.pending = append(w.pending[:0], w.pending[idx+1:]...)
+	}
+	return len(data), nil
+}
+
+func (w *ResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush writes out any pending partial event before flushing the underlying writer.
+func (w *ResponseWriter) Flush() {
+	if w.isStream() && len(w.pending) > 0 {
+		_ = w.writeLines(w.pending)
+		w.pending = w.pending[:0]
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Drain processes and writes whatever is still buffered and returns the output
+// violations found so far. It is safe to call more than once.
+func (w *ResponseWriter) Drain() []Violation {
+	if len(w.pending) > 0 {
+		if w.isStream() {
+			_ = w.writeLines(w.pending)
+		} else {
+			body, violations := w.pipeline.applyOutputJSON(w.pending)
+			w.violations = MergeViolations(w.violations, violations)
+			_, _ = w.ResponseWriter.Write(body)
+		}
+		w.pending = w.pending[:0]
+	}
+	return w.violations
+}
+
+// writeLines redacts the JSON payload of every "data:" line in chunk.
+func (w *ResponseWriter) writeLines(chunk []byte) error {
+	if !w.pipeline.mayMatch(StageOutput, chunk) {
+		_, err := w.ResponseWriter.Write(chunk)
+		return err
+	}
+
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(chunk, []byte("\n")) {
+		payload, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			out.Write(line)
+			continue
+		}
+		trimmed := bytes.TrimSpace(payload)
+		redacted, violations := w.pipeline.applyOutputJSON(trimmed)
+		if len(violations) == 0 {
+			out.Write(line)
+			continue
+		}
+		w.violations = MergeViolations(w.violations, violations)
+		out.WriteString("data: ")
+		out.Write(redacted)
+		out.Write(payload[len(bytes.TrimRight(payload, " \r\n")):])
+	}
+	_, err := w.ResponseWriter.Write(out.Bytes())
+	return err
+}
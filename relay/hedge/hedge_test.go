@@ -0,0 +1,81 @@
+package hedge
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+func TestParsePoliciesValidates(t *testing.T) {
+	_, err := ParsePolicies(`[{"percentile":0,"max_delay_ms":1000}]`)
+	require.Error(t, err)
+	_, err = ParsePolicies(`[{"percentile":95}]`)
+	require.Error(t, err)
+	_, err = ParsePolicies(`[{"percentile":95,"min_delay_ms":2000,"max_delay_ms":1000}]`)
+	require.Error(t, err)
+
+	require.NoError(t, UpdatePoliciesByJSONString(`[{"groups":["fast"],"models":["gpt-4.1-*"],"percentile":95,"max_delay_ms":1000}]`))
+	t.Cleanup(func() { require.NoError(t, UpdatePoliciesByJSONString("")) })
+	require.NotNil(t, Match("fast", "gpt-4.1-mini"))
+	require.Nil(t, Match("default", "gpt-4.1-mini"))
+	require.Nil(t, Match("fast", "gpt-4o"))
+}
+
+func TestDelay(t *testing.T) {
+	p := &Policy{Percentile: 90, MinSamples: 10, MinDelayMs: 50, MaxDelayMs: 900}
+
+	// too few samples: wait the longest
+	Observe("g", "delay-model", 100*time.Millisecond)
+	require.Equal(t, 900*time.Millisecond, Delay(p, "g", "delay-model"))
+
+	for i := 2; i <= 10; i++ {
+		Observe("g", "delay-model", time.Duration(i)*100*time.Millisecond)
+	}
+	// p90 of 100ms..1000ms is 900ms
+	require.Equal(t, 900*time.Millisecond, Delay(p, "g", "delay-model"))
+	p.Percentile = 50
+	require.Equal(t, 500*time.Millisecond, Delay(p, "g", "delay-model"))
+	p.MaxDelayMs = 300
+	require.Equal(t, 300*time.Millisecond, Delay(p, "g", "delay-model"))
+
+	for range latencyWindowSize {
+		Observe("g", "delay-model", time.Millisecond)
+	}
+	require.Equal(t, 50*time.Millisecond, Delay(p, "g", "delay-model"))
+}
+
+func TestRace(t *testing.T) {
+	race := NewRace()
+	first := race.Attempt(0)
+	require.False(t, first.Hedged())
+	second := race.Attempt(1)
+	require.True(t, first.Hedged())
+
+	expired, cancel := context.WithCancel(t.Context())
+	cancel()
+	require.False(t, second.Lost(expired), "undecided race bills the attempt")
+
+	race.Decide(1)
+	race.Decide(0)
+	require.True(t, first.Lost(t.Context()))
+	require.False(t, second.Lost(t.Context()))
+
+	noWinner := NewRace()
+	noWinner.Decide(-1)
+	require.False(t, noWinner.Attempt(0).Lost(t.Context()))
+}
+
+func TestAttemptFromContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(nil)
+	require.Nil(t, AttemptFromContext(c))
+
+	attempt := NewRace().Attempt(1)
+	c.Set(ctxkey.HedgeAttempt, attempt)
+	require.Same(t, attempt, AttemptFromContext(c))
+}
@@ -0,0 +1,62 @@
+package hedge
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyWindowSize is how many recent latencies are kept per group and model.
+const latencyWindowSize = 256
+
+// latencyWindow is a ring buffer of recent request latencies.
+type latencyWindow struct {
+	samples [latencyWindowSize]time.Duration
+	next    int
+	count   int
+}
+
+var (
+	latencyLock sync.Mutex
+	latencies   = make(map[string]*latencyWindow)
+)
+
+func latencyKey(group, model string) string {
+	return group + "\x00" + model
+}
+
+// Observe records the latency of a successful request of group for model.
+func Observe(group, model string, latency time.Duration) {
+	latencyLock.Lock()
+	defer latencyLock.Unlock()
+	key := latencyKey(group, model)
+	window := latencies[key]
+	if window == nil {
+		window = &latencyWindow{}
+		latencies[key] = window
+	}
+	window.samples[window.next] = latency
+	window.next = (window.next + 1) % latencyWindowSize
+	window.count = min(window.count+1, latencyWindowSize)
+}
+
+// Delay returns how long a request of group for model waits for its first channel before it
+// is hedged: the policy's percentile of the recent latencies, within the policy's bounds.
+func Delay(p *Policy, group, model string) time.Duration {
+	latencyLock.Lock()
+	window := latencies[latencyKey(group, model)]
+	var samples []time.Duration
+	if window != nil && window.count >= max(p.MinSamples, 1) {
+		samples = slices.Clone(window.samples[:window.count])
+	}
+	latencyLock.Unlock()
+
+	if len(samples) == 0 {
+		return p.MaxDelay()
+	}
+	slices.Sort(samples)
+	idx := int(math.Ceil(p.Percentile/100*float64(len(samples)))) - 1
+	delay := samples[max(idx, 0)]
+	return min(max(delay, p.MinDelay()), p.MaxDelay())
+}
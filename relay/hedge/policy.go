@@ -0,0 +1,152 @@
+// Package hedge implements hedged requests: a non-streaming request that has not been answered
+// within a latency percentile of its group and model is sent to a second channel as well, the
+// first successful answer wins and the other attempt is cancelled.
+//
+// Policies are stored as a JSON array in the HedgePolicy option; the first one matching the
+// request's group and model applies.
+//
+//	[{
+//	  "groups": ["realtime"],
+//	  "models": ["gpt-4.1-mini", "claude-haiku-*"],
+//	  "percentile": 95,
+//	  "min_samples": 50,
+//	  "min_delay_ms": 300,
+//	  "max_delay_ms": 4000
+//	}]
+package hedge
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Policy is a hedging policy.
+//
+// Fields:
+//   - Groups, Models: requests the policy applies to; empty matches all. A model pattern
+//     ending in "*" matches by prefix.
+//   - Percentile: the latency percentile of recent successful requests after which the
+//     request is hedged, e.g. 95.
+//   - MinSamples: latencies observed before the percentile is trusted; until then the
+//     request is hedged after MaxDelayMs.
+//   - MinDelayMs, MaxDelayMs: bounds of the hedging delay.
+type Policy struct {
+	Groups     []string `json:"groups,omitempty"`
+	Models     []string `json:"models,omitempty"`
+	Percentile float64  `json:"percentile"`
+	MinSamples int      `json:"min_samples,omitempty"`
+	MinDelayMs int      `json:"min_delay_ms,omitempty"`
+	MaxDelayMs int      `json:"max_delay_ms"`
+}
+
+var (
+	policyLock sync.RWMutex
+	policies   []Policy
+)
+
+// Validate checks that the policy is usable.
+func (p *Policy) Validate() error {
+	if p.Percentile <= 0 || p.Percentile > 100 {
+		return errors.New("percentile must be in (0, 100]")
+	}
+	if p.MinSamples < 0 {
+		return errors.New("min_samples must not be negative")
+	}
+	if p.MaxDelayMs <= 0 {
+		return errors.New("max_delay_ms must be positive")
+	}
+	if p.MinDelayMs < 0 || p.MinDelayMs > p.MaxDelayMs {
+		return errors.New("min_delay_ms must be between 0 and max_delay_ms")
+	}
+	return nil
+}
+
+// Matches reports whether the policy applies to requests of group for model.
+func (p *Policy) Matches(group, model string) bool {
+	if len(p.Groups) > 0 && !slices.Contains(p.Groups, group) {
+		return false
+	}
+	if len(p.Models) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Models, func(pattern string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(model, prefix)
+		}
+		return pattern == model
+	})
+}
+
+// MinDelay returns the lower bound of the hedging delay.
+func (p *Policy) MinDelay() time.Duration {
+	return time.Duration(p.MinDelayMs) * time.Millisecond
+}
+
+// MaxDelay returns the upper bound of the hedging delay.
+func (p *Policy) MaxDelay() time.Duration {
+	return time.Duration(p.MaxDelayMs) * time.Millisecond
+}
+
+// Match returns the first policy applying to requests of group for model, or nil.
+func Match(group, model string) *Policy {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	for i := range policies {
+		if policies[i].Matches(group, model) {
+			policy := policies[i]
+			return &policy
+		}
+	}
+	return nil
+}
+
+// Policies2JSONString serializes the policies for the option table.
+func Policies2JSONString() string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	if policies == nil {
+		return "[]"
+	}
+	jsonBytes, err := json.Marshal(policies)
+	if err != nil {
+		logger.Logger.Error("error marshalling hedge policies", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// ParsePolicies parses a JSON array of policies and validates each of them.
+func ParsePolicies(jsonStr string) ([]Policy, error) {
+	var parsed []Policy
+	if strings.TrimSpace(jsonStr) != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &parsed); err != nil {
+			return nil, errors.Wrap(err, "unmarshal hedge policies")
+		}
+	}
+	for i := range parsed {
+		if err := parsed[i].Validate(); err != nil {
+			return nil, errors.Wrapf(err, "hedge policy %d", i)
+		}
+	}
+	return parsed, nil
+}
+
+// UpdatePoliciesByJSONString replaces the policies after validating them.
+func UpdatePoliciesByJSONString(jsonStr string) error {
+	parsed, err := ParsePolicies(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	policies = parsed
+	return nil
+}
@@ -0,0 +1,82 @@
+package hedge
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	gmw "github.com/Laisky/gin-middlewares/v6"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+)
+
+// Race coordinates the attempts of a hedged request. The relay decides the winner once an
+// attempt succeeded, or that there is none once all of them failed; billing of an attempt
+// waits for that decision so only the winner is charged to the user.
+type Race struct {
+	once    sync.Once
+	decided chan struct{}
+	winner  int
+	hedged  atomic.Bool
+}
+
+// NewRace returns an undecided race.
+func NewRace() *Race {
+	return &Race{decided: make(chan struct{}), winner: -1}
+}
+
+// Decide records the winning attempt, -1 for none. Only the first decision counts.
+func (r *Race) Decide(winner int) {
+	r.once.Do(func() {
+		r.winner = winner
+		close(r.decided)
+	})
+}
+
+// Attempt returns the handle of the index-th attempt; any attempt after the first marks the
+// request as hedged.
+func (r *Race) Attempt(index int) *Attempt {
+	if index > 0 {
+		r.hedged.Store(true)
+	}
+	return &Attempt{race: r, index: index}
+}
+
+// Attempt is one of the requests of a race, stored in its gin context under ctxkey.HedgeAttempt.
+type Attempt struct {
+	race  *Race
+	index int
+}
+
+// Index returns the position of the attempt in the race, 0 for the first channel.
+func (a *Attempt) Index() int {
+	return a.index
+}
+
+// Hedged reports whether the request was sent to more than one channel.
+func (a *Attempt) Hedged() bool {
+	return a.race.hedged.Load()
+}
+
+// Lost waits for the race to be decided and reports whether another attempt won. Without a
+// winner every attempt is billed as usual, as is an attempt whose ctx ends before the decision.
+func (a *Attempt) Lost(ctx context.Context) bool {
+	select {
+	case <-a.race.decided:
+		return a.race.winner >= 0 && a.race.winner != a.index
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// AttemptFromContext returns the hedge attempt a billing context belongs to, nil when the
+// request was not hedged.
+func AttemptFromContext(ctx context.Context) *Attempt {
+	ginCtx, ok := gmw.GetGinCtxFromStdCtx(ctx)
+	if !ok {
+		return nil
+	}
+	value, _ := ginCtx.Get(ctxkey.HedgeAttempt)
+	attempt, _ := value.(*Attempt)
+	return attempt
+}
@@ -0,0 +1,402 @@
+// Package mcp implements a minimal Model Context Protocol client, used by the gateway to
+// list and call the tools of remote MCP servers on behalf of upstreams that cannot reach
+// MCP servers themselves.
+//
+// Both remote transports are supported:
+//   - Streamable HTTP (protocol 2025-03-26): JSON-RPC messages are POSTed to the server URL
+//     and answered with JSON or an SSE stream.
+//   - HTTP+SSE (protocol 2024-11-05): an SSE stream announces the endpoint to POST to and
+//     carries the responses. It is used when the server rejects a streamable HTTP initialize.
+//
+// https://modelcontextprotocol.io/specification/2025-03-26/basic/transports
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+
+	"github.com/songquanpeng/one-api/common"
+)
+
+const (
+	// ProtocolVersion is the MCP revision requested during initialization.
+	ProtocolVersion = "2025-03-26"
+
+	sessionIdHeader       = "Mcp-Session-Id"
+	protocolVersionHeader = "Mcp-Protocol-Version"
+	// maxListToolsPages bounds tools/list pagination against misbehaving servers.
+	maxListToolsPages = 20
+)
+
+// Tool is a tool advertised by an MCP server.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"inputSchema,omitempty"`
+}
+
+// Content is a content block of a tool result.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+// CallToolResult is the result of tools/call.
+type CallToolResult struct {
+	Content           []json.RawMessage `json:"content"`
+	StructuredContent any               `json:"structuredContent,omitempty"`
+	IsError           bool              `json:"isError,omitempty"`
+}
+
+// Text flattens the result into the text handed back to the model. Text blocks are
+// joined by newlines; other blocks are kept as JSON.
+func (r *CallToolResult) Text() string {
+	parts := make([]string, 0, len(r.Content))
+	for _, raw := range r.Content {
+		var content Content
+		if err := json.Unmarshal(raw, &content); err == nil && content.Type == "text" {
+			parts = append(parts, content.Text)
+			continue
+		}
+		parts = append(parts, string(raw))
+	}
+	if len(parts) == 0 && r.StructuredContent != nil {
+		if encoded, err := json.Marshal(r.StructuredContent); err == nil {
+			parts = append(parts, string(encoded))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Id      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	Id     *int64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// Client is a session with one MCP server. It is not safe for concurrent use.
+type Client struct {
+	serverURL  string
+	headers    map[string]string
+	httpClient *http.Client
+
+	nextId          int64
+	sessionId       string
+	protocolVersion string
+
+	// HTTP+SSE transport state, nil for streamable HTTP
+	sseBody   io.ReadCloser
+	sseReader *bufio.Reader
+	endpoint  string
+}
+
+// Connect opens a session with the MCP server at serverURL. headers are sent with every
+// request, e.g. to authenticate against the server.
+func Connect(ctx context.Context, httpClient *http.Client, serverURL string, headers map[string]string) (*Client, error) {
+	client := &Client{serverURL: serverURL, headers: headers, httpClient: httpClient}
+	err := client.initialize(ctx)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code >= 400 && statusErr.code < 500 {
+		// the server predates streamable HTTP, retry with the HTTP+SSE transport
+		if err = client.openSSE(ctx); err == nil {
+			err = client.initialize(ctx)
+		}
+	}
+	if err != nil {
+		client.Close()
+		return nil, errors.Wrapf(err, "connect to MCP server %s", serverURL)
+	}
+	return client, nil
+}
+
+func (c *Client) initialize(ctx context.Context) error {
+	var result struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	err := c.call(ctx, "initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "one-api", "version": common.Version},
+	}, &result)
+	if err != nil {
+		return err
+	}
+	c.protocolVersion = result.ProtocolVersion
+	return c.notify(ctx, "notifications/initialized")
+}
+
+// ListTools returns all tools of the server.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	cursor := ""
+	for range maxListToolsPages {
+		params := map[string]any{}
+		if cursor != "" {
+			params["cursor"] = cursor
+		}
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := c.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, errors.Wrap(err, "list MCP tools")
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+	return tools, nil
+}
+
+// CallTool calls a tool with arguments, a JSON object.
+func (c *Client) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	if len(bytes.TrimSpace(arguments)) == 0 {
+		arguments = json.RawMessage("{}")
+	}
+	result := &CallToolResult{}
+	if err := c.call(ctx, "tools/call", map[string]any{"name": name, "arguments": arguments}, result); err != nil {
+		return nil, errors.Wrapf(err, "call MCP tool %s", name)
+	}
+	return result, nil
+}
+
+// Close ends the session.
+func (c *Client) Close() {
+	if c.sseBody != nil {
+		_ = c.sseBody.Close()
+		c.sseBody = nil
+		return
+	}
+	if c.sessionId == "" {
+		return
+	}
+	// terminating the session is a courtesy, servers expire idle sessions anyway
+	req, err := http.NewRequest(http.MethodDelete, c.serverURL, nil)
+	if err != nil {
+		return
+	}
+	c.setHeaders(req)
+	if resp, err := c.httpClient.Do(req); err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("MCP server returned status %d: %s", e.code, e.body)
+}
+
+func (c *Client) call(ctx context.Context, method string, params, out any) error {
+	c.nextId++
+	id := c.nextId
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Id: &id, Method: method, Params: params})
+	if err != nil {
+		return errors.Wrapf(err, "marshal %s request", method)
+	}
+
+	var response *rpcResponse
+	if c.sseReader != nil {
+		if err = c.post(ctx, c.endpoint, body, nil); err != nil {
+			return err
+		}
+		response, err = readResponse(c.sseReader, id)
+	} else {
+		err = c.post(ctx, c.serverURL, body, func(resp *http.Response) error {
+			if sessionId := resp.Header.Get(sessionIdHeader); sessionId != "" {
+				c.sessionId = sessionId
+			}
+			if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				var readErr error
+				response, readErr = readResponse(bufio.NewReader(resp.Body), id)
+				return readErr
+			}
+			response = &rpcResponse{}
+			if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+				return errors.Wrap(err, "decode response")
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "MCP %s", method)
+	}
+	if response == nil {
+		return errors.Errorf("MCP %s: server sent no response", method)
+	}
+	if response.Error != nil {
+		return errors.Errorf("MCP %s failed: %s (code %d)", method, response.Error.Message, response.Error.Code)
+	}
+	if out != nil {
+		if err = json.Unmarshal(response.Result, out); err != nil {
+			return errors.Wrapf(err, "unmarshal %s result", method)
+		}
+	}
+	return nil
+}
+
+func (c *Client) notify(ctx context.Context, method string) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", Method: method})
+	if err != nil {
+		return errors.Wrapf(err, "marshal %s notification", method)
+	}
+	target := c.serverURL
+	if c.sseReader != nil {
+		target = c.endpoint
+	}
+	return c.post(ctx, target, body, nil)
+}
+
+// post sends a JSON-RPC message and passes a successful response to handle.
+func (c *Client) post(ctx context.Context, target string, body []byte, handle func(*http.Response) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+	c.setHeaders(req)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "do request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		payload, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &statusError{code: resp.StatusCode, body: string(payload)}
+	}
+	if handle == nil || resp.StatusCode == http.StatusAccepted {
+		return nil
+	}
+	return handle(resp)
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	for key, value := range c.headers {
+		req.Header.Set(key, value)
+	}
+	if c.sessionId != "" {
+		req.Header.Set(sessionIdHeader, c.sessionId)
+	}
+	if c.protocolVersion != "" {
+		req.Header.Set(protocolVersionHeader, c.protocolVersion)
+	}
+}
+
+// openSSE opens the HTTP+SSE stream and waits for the endpoint event.
+func (c *Client) openSSE(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.serverURL, nil)
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+	c.setHeaders(req)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "open SSE stream")
+	}
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return &statusError{code: resp.StatusCode, body: string(payload)}
+	}
+	c.sseBody = resp.Body
+	c.sseReader = bufio.NewReader(resp.Body)
+
+	for {
+		event, data, err := readEvent(c.sseReader)
+		if err != nil {
+			return errors.Wrap(err, "wait for SSE endpoint")
+		}
+		if event != "endpoint" {
+			continue
+		}
+		endpoint, err := url.Parse(strings.TrimSpace(data))
+		if err != nil {
+			return errors.Wrap(err, "parse SSE endpoint")
+		}
+		base, err := url.Parse(c.serverURL)
+		if err != nil {
+			return errors.Wrap(err, "parse server url")
+		}
+		c.endpoint = base.ResolveReference(endpoint).String()
+		return nil
+	}
+}
+
+// readResponse reads SSE events until the JSON-RPC response with id arrives, skipping
+// server requests and notifications.
+func readResponse(reader *bufio.Reader, id int64) (*rpcResponse, error) {
+	for {
+		event, data, err := readEvent(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "read SSE response")
+		}
+		if event != "" && event != "message" {
+			continue
+		}
+		response := &rpcResponse{}
+		if err := json.Unmarshal([]byte(data), response); err != nil {
+			continue
+		}
+		if response.Id != nil && *response.Id == id {
+			return response, nil
+		}
+	}
+}
+
+// readEvent reads one server-sent event.
+func readEvent(reader *bufio.Reader) (event, data string, err error) {
+	var dataLines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (line == "" || err != io.EOF) {
+			return "", "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			if event != "" || len(dataLines) > 0 {
+				return event, strings.Join(dataLines, "\n"), nil
+			}
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			dataLines = append(dataLines, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+		if err == io.EOF {
+			if len(dataLines) > 0 {
+				return event, strings.Join(dataLines, "\n"), nil
+			}
+			return "", "", io.EOF
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRPCRequest struct {
+	Id     *int64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+// testRPCResult answers the methods used by the client like a server with one echo tool.
+func testRPCResult(t *testing.T, req testRPCRequest) any {
+	switch req.Method {
+	case "initialize":
+		return map[string]any{"protocolVersion": ProtocolVersion, "capabilities": map[string]any{"tools": map[string]any{}}}
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(req.Params, &params)
+		if params.Cursor == "" {
+			return map[string]any{
+				"tools":      []any{map[string]any{"name": "echo", "description": "Echo text", "inputSchema": map[string]any{"type": "object"}}},
+				"nextCursor": "page-2",
+			}
+		}
+		return map[string]any{"tools": []any{map[string]any{"name": "fail"}}}
+	case "tools/call":
+		var params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		require.NoError(t, json.Unmarshal(req.Params, &params))
+		if params.Name == "fail" {
+			return map[string]any{"content": []any{map[string]any{"type": "text", "text": "boom"}}, "isError": true}
+		}
+		return map[string]any{"content": []any{map[string]any{"type": "text", "text": fmt.Sprintf("echo: %v", params.Arguments["text"])}}}
+	}
+	return nil
+}
+
+func testRPCResponse(t *testing.T, req testRPCRequest) []byte {
+	payload, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": *req.Id, "result": testRPCResult(t, req)})
+	require.NoError(t, err)
+	return payload
+}
+
+func exerciseClient(t *testing.T, serverURL string) {
+	t.Helper()
+	client, err := Connect(t.Context(), http.DefaultClient, serverURL, map[string]string{"Authorization": "Bearer secret"})
+	require.NoError(t, err)
+	defer client.Close()
+
+	tools, err := client.ListTools(t.Context())
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	require.Equal(t, "echo", tools[0].Name)
+	require.Equal(t, "object", tools[0].InputSchema["type"])
+
+	result, err := client.CallTool(t.Context(), "echo", json.RawMessage(`{"text":"hi"}`))
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.Equal(t, "echo: hi", result.Text())
+
+	result, err = client.CallTool(t.Context(), "fail", nil)
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+	require.Equal(t, "boom", result.Text())
+}
+
+func TestClient_StreamableHTTP(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sse=%v", sse), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodDelete {
+					return
+				}
+				if r.Header.Get("Authorization") != "Bearer secret" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				var req testRPCRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if req.Method == "initialize" {
+					w.Header().Set(sessionIdHeader, "session-1")
+				} else if r.Header.Get(sessionIdHeader) != "session-1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				if req.Id == nil {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				payload := testRPCResponse(t, req)
+				if sse {
+					w.Header().Set("Content-Type", "text/event-stream")
+					// a notification precedes the response on the same stream
+					_, _ = fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+					_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", payload)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(payload)
+			}))
+			defer server.Close()
+
+			exerciseClient(t, server.URL+"/mcp")
+		})
+	}
+}
+
+func TestClient_LegacySSE(t *testing.T) {
+	messages := make(chan []byte, 8)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "event: endpoint\ndata: /messages?session=1\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case msg := <-messages:
+				_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", msg)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+	mux.HandleFunc("/messages", func(w http.ResponseWriter, r *http.Request) {
+		var req testRPCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if req.Id != nil {
+			messages <- testRPCResponse(t, req)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	exerciseClient(t, server.URL+"/sse")
+}
+
+func TestClient_ConnectError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := Connect(t.Context(), http.DefaultClient, server.URL, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status 500")
+}
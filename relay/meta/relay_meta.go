@@ -11,18 +11,21 @@ import (
 	"github.com/songquanpeng/one-api/common/logger"
 	"github.com/songquanpeng/one-api/model"
 	"github.com/songquanpeng/one-api/relay/channeltype"
+	"github.com/songquanpeng/one-api/relay/guardrail"
 	"github.com/songquanpeng/one-api/relay/relaymode"
 )
 
 type Meta struct {
-	Mode         int
-	ChannelType  int
-	ChannelId    int
-	TokenId      int
-	TokenName    string
-	UserId       int
-	Group        string
-	ModelMapping map[string]string
+	Mode        int
+	ChannelType int
+	ChannelId   int
+	TokenId     int
+	TokenName   string
+	UserId      int
+	// OrganizationId is set when the token draws from an organization quota pool
+	OrganizationId int
+	Group          string
+	ModelMapping   map[string]string
 	// BaseURL is the proxy url set in the channel config
 	BaseURL  string
 	APIKey   string
@@ -39,6 +42,17 @@ type Meta struct {
 	ChannelRatio        float64
 	ForcedSystemPrompt  string
 	StartTime           time.Time
+	// GuardrailViolations collects the guardrail rules matched by the request and its
+	// response, recorded in the consume log metadata
+	GuardrailViolations []guardrail.Violation
+	// PromptCacheAffinitySource names what the prompt-cache affinity key was derived from,
+	// empty when affinity did not apply to the request
+	PromptCacheAffinitySource string
+	// PromptCacheAffinityChannelId is the channel the affinity key was bound to on arrival
+	PromptCacheAffinityChannelId int
+	// FallbackFromModel is the model the client requested when a retry policy switched the
+	// request to a fallback model, empty otherwise
+	FallbackFromModel string
 }
 
 // GetMappedModelName returns the mapped model name and a bool indicating if the model name is mapped
@@ -99,6 +113,7 @@ func GetByContext(c *gin.Context) *Meta {
 		TokenId:            c.GetInt(ctxkey.TokenId),
 		TokenName:          c.GetString(ctxkey.TokenName),
 		UserId:             c.GetInt(ctxkey.Id),
+		OrganizationId:     c.GetInt(ctxkey.OrganizationId),
 		Group:              c.GetString(ctxkey.Group),
 		ModelMapping:       c.GetStringMapString(ctxkey.ModelMapping),
 		OriginModelName:    c.GetString(ctxkey.RequestModel),
@@ -109,6 +124,10 @@ func GetByContext(c *gin.Context) *Meta {
 		ChannelRatio:       c.GetFloat64(ctxkey.ChannelRatio), // add by Laisky
 		ForcedSystemPrompt: c.GetString(ctxkey.SystemPrompt),
 		StartTime:          time.Now(),
+
+		PromptCacheAffinitySource:    c.GetString(ctxkey.PromptCacheAffinitySource),
+		PromptCacheAffinityChannelId: c.GetInt(ctxkey.PromptCacheAffinityChannelId),
+		FallbackFromModel:            c.GetString(ctxkey.FallbackFromModel),
 	}
 	cfg, ok := c.Get(ctxkey.Config)
 	if ok {
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"sort"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// RerankRequest is the normalized request accepted at /v1/rerank. It follows the Cohere v2
+// and Jina schema; each adaptor translates it into the format of its upstream.
+type RerankRequest struct {
+	Model string `json:"model"`
+	Query string `json:"query"`
+	// Documents holds plain strings or objects carrying a "text" field.
+	Documents []any `json:"documents"`
+	// TopN limits the number of results; all documents are ranked when omitted.
+	TopN *int `json:"top_n,omitempty"`
+	// ReturnDocuments echoes each ranked document back in its result.
+	ReturnDocuments *bool `json:"return_documents,omitempty"`
+	// MaxTokensPerDoc truncates long documents upstream; only Cohere honours it.
+	MaxTokensPerDoc *int `json:"max_tokens_per_doc,omitempty"`
+}
+
+// Validate reports whether the request can be sent upstream.
+func (r *RerankRequest) Validate() error {
+	if r.Model == "" {
+		return errors.New("model is required")
+	}
+	if r.Query == "" {
+		return errors.New("query is required")
+	}
+	if len(r.Documents) == 0 {
+		return errors.New("documents must not be empty")
+	}
+	if r.TopN != nil && *r.TopN <= 0 {
+		return errors.New("top_n must be positive")
+	}
+	return nil
+}
+
+// DocumentTexts returns the text of every document, in request order. Documents that are
+// neither strings nor objects with a text field yield an empty string.
+func (r *RerankRequest) DocumentTexts() []string {
+	texts := make([]string, len(r.Documents))
+	for i, document := range r.Documents {
+		switch v := document.(type) {
+		case string:
+			texts[i] = v
+		case map[string]any:
+			texts[i], _ = v["text"].(string)
+		}
+	}
+	return texts
+}
+
+// RerankResponse is the normalized /v1/rerank response.
+type RerankResponse struct {
+	Id      string         `json:"id,omitempty"`
+	Model   string         `json:"model,omitempty"`
+	Results []RerankResult `json:"results"`
+	Meta    *RerankMeta    `json:"meta,omitempty"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
+
+// RerankResult is the relevance of one document to the query.
+type RerankResult struct {
+	// Index is the position of the document in the request.
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       *RerankDocument `json:"document,omitempty"`
+}
+
+// RerankDocument is a document echoed back in a rerank result.
+type RerankDocument struct {
+	Text string `json:"text"`
+}
+
+// RerankMeta carries the billed units reported by Cohere-style upstreams.
+type RerankMeta struct {
+	BilledUnits *RerankBilledUnits `json:"billed_units,omitempty"`
+}
+
+// RerankBilledUnits counts the billable units of a rerank request.
+type RerankBilledUnits struct {
+	SearchUnits int `json:"search_units,omitempty"`
+}
+
+// SearchUnits returns the search units reported by the upstream, or zero.
+func (r *RerankResponse) SearchUnits() int {
+	if r.Meta == nil || r.Meta.BilledUnits == nil {
+		return 0
+	}
+	return r.Meta.BilledUnits.SearchUnits
+}
+
+// ApplyRequest fills in or strips the echoed documents as the request asked, drops
+// results pointing outside the request, orders results by relevance and enforces top_n,
+// since not every upstream honours these options.
+func (r *RerankResponse) ApplyRequest(request *RerankRequest) {
+	texts := request.DocumentTexts()
+	returnDocuments := request.ReturnDocuments != nil && *request.ReturnDocuments
+
+	results := r.Results[:0]
+	for _, result := range r.Results {
+		if result.Index < 0 || result.Index >= len(texts) {
+			continue
+		}
+		switch {
+		case !returnDocuments:
+			result.Document = nil
+		case result.Document == nil || result.Document.Text == "":
+			result.Document = &RerankDocument{Text: texts[result.Index]}
+		}
+		results = append(results, result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RelevanceScore > results[j].RelevanceScore
+	})
+	if request.TopN != nil && len(results) > *request.TopN {
+		results = results[:*request.TopN]
+	}
+	r.Results = results
+	if r.Model == "" {
+		r.Model = request.Model
+	}
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRerankRequest_Validate(t *testing.T) {
+	zero := 0
+	require.NoError(t, (&RerankRequest{Model: "m", Query: "q", Documents: []any{"a"}}).Validate())
+	require.Error(t, (&RerankRequest{Model: "m", Query: "q"}).Validate())
+	require.Error(t, (&RerankRequest{Model: "m", Documents: []any{"a"}}).Validate())
+	require.Error(t, (&RerankRequest{Model: "m", Query: "q", Documents: []any{"a"}, TopN: &zero}).Validate())
+}
+
+func TestRerankRequest_DocumentTexts(t *testing.T) {
+	request := &RerankRequest{Documents: []any{"plain", map[string]any{"text": "object"}, 42}}
+	require.Equal(t, []string{"plain", "object", ""}, request.DocumentTexts())
+}
+
+// TestRerankResponse_ApplyRequest verifies that results are sorted, truncated to top_n and
+// get their documents filled in even when the upstream ignored those options.
+func TestRerankResponse_ApplyRequest(t *testing.T) {
+	topN := 2
+	returnDocuments := true
+	request := &RerankRequest{
+		Model:           "rerank-v3.5",
+		Query:           "q",
+		Documents:       []any{"a", "b", "c"},
+		TopN:            &topN,
+		ReturnDocuments: &returnDocuments,
+	}
+	response := &RerankResponse{Results: []RerankResult{
+		{Index: 0, RelevanceScore: 0.1},
+		{Index: 2, RelevanceScore: 0.9},
+		{Index: 7, RelevanceScore: 0.99},
+		{Index: 1, RelevanceScore: 0.5},
+	}}
+
+	response.ApplyRequest(request)
+	require.Equal(t, "rerank-v3.5", response.Model)
+	require.Len(t, response.Results, 2)
+	require.Equal(t, 2, response.Results[0].Index)
+	require.Equal(t, "c", response.Results[0].Document.Text)
+	require.Equal(t, 1, response.Results[1].Index)
+
+	returnDocuments = false
+	response.ApplyRequest(request)
+	require.Nil(t, response.Results[0].Document)
+}
@@ -0,0 +1,134 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Laisky/errors/v2"
+)
+
+// Video job states, following the OpenAI video API.
+const (
+	VideoStatusQueued     = "queued"
+	VideoStatusInProgress = "in_progress"
+	VideoStatusCompleted  = "completed"
+	VideoStatusFailed     = "failed"
+)
+
+// VideoSeconds is a clip duration. The OpenAI video API sends it as a string, so both
+// strings and numbers are accepted.
+type VideoSeconds int
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *VideoSeconds) UnmarshalJSON(data []byte) error {
+	raw := strings.Trim(string(data), `"`)
+	if raw == "" || raw == "null" {
+		*s = 0
+		return nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil {
+		return errors.Wrapf(err, "invalid seconds %s", raw)
+	}
+	*s = VideoSeconds(seconds)
+	return nil
+}
+
+// VideoRequest is the normalized POST /v1/videos request, sent either as JSON or as
+// multipart form data. Each adaptor translates it into the format of its upstream.
+type VideoRequest struct {
+	Model  string `json:"model" form:"model"`
+	Prompt string `json:"prompt" form:"prompt"`
+	// Seconds is the requested clip length; the upstream default applies when zero.
+	Seconds VideoSeconds `json:"seconds,omitempty" form:"seconds"`
+	// Size is the resolution as WIDTHxHEIGHT, e.g. 1280x720.
+	Size string `json:"size,omitempty" form:"size"`
+	// InputReference is an optional first frame, either a data URL or an http(s) URL.
+	// Multipart requests upload it as a file, which the relay turns into a data URL.
+	InputReference string `json:"input_reference,omitempty" form:"-"`
+}
+
+// Validate reports whether the request can be sent upstream.
+func (r *VideoRequest) Validate() error {
+	if r.Model == "" {
+		return errors.New("model is required")
+	}
+	if strings.TrimSpace(r.Prompt) == "" {
+		return errors.New("prompt is required")
+	}
+	if r.Seconds < 0 {
+		return errors.New("seconds must not be negative")
+	}
+	if r.Size != "" {
+		if _, _, ok := r.Dimensions(); !ok {
+			return errors.Errorf("invalid size %s, expected WIDTHxHEIGHT", r.Size)
+		}
+	}
+	return nil
+}
+
+// Dimensions parses Size into its width and height.
+func (r *VideoRequest) Dimensions() (width, height int, ok bool) {
+	w, h, found := strings.Cut(r.Size, "x")
+	if !found {
+		return 0, 0, false
+	}
+	width, errW := strconv.Atoi(w)
+	height, errH := strconv.Atoi(h)
+	if errW != nil || errH != nil || width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+	return width, height, true
+}
+
+// AspectRatio returns the aspect ratio of Size as used by Veo and Replicate models,
+// "16:9" for landscape and "9:16" for portrait, or "" when no size was requested.
+func (r *VideoRequest) AspectRatio() string {
+	width, height, ok := r.Dimensions()
+	switch {
+	case !ok:
+		return ""
+	case width >= height:
+		return "16:9"
+	default:
+		return "9:16"
+	}
+}
+
+// VideoJobStatus is the upstream state of a video job as reported by an adaptor.
+type VideoJobStatus struct {
+	// UpstreamId identifies the job on the upstream, e.g. a Veo operation name.
+	UpstreamId string
+	// Status is one of the VideoStatus* constants.
+	Status   string
+	Progress int
+	// Seconds is the length of the generated clip when the upstream reports it.
+	Seconds int
+	// Error describes why a failed job failed.
+	Error string
+}
+
+// Terminal reports whether the job will not change anymore.
+func (s *VideoJobStatus) Terminal() bool {
+	return s.Status == VideoStatusCompleted || s.Status == VideoStatusFailed
+}
+
+// Video is the video object returned by the /v1/videos endpoints.
+type Video struct {
+	Id          string      `json:"id"`
+	Object      string      `json:"object"`
+	Model       string      `json:"model"`
+	Status      string      `json:"status"`
+	Progress    int         `json:"progress"`
+	CreatedAt   int64       `json:"created_at"`
+	CompletedAt *int64      `json:"completed_at,omitempty"`
+	Seconds     string      `json:"seconds,omitempty"`
+	Size        string      `json:"size,omitempty"`
+	Error       *VideoError `json:"error,omitempty"`
+}
+
+// VideoError describes why a video job failed.
+type VideoError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
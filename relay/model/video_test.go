@@ -0,0 +1,42 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoSecondsUnmarshal(t *testing.T) {
+	for _, body := range []string{`{"seconds":"8"}`, `{"seconds":8}`} {
+		var request VideoRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &request), body)
+		require.Equal(t, VideoSeconds(8), request.Seconds, body)
+	}
+
+	var request VideoRequest
+	require.NoError(t, json.Unmarshal([]byte(`{"seconds":null}`), &request))
+	require.Zero(t, request.Seconds)
+	require.Error(t, json.Unmarshal([]byte(`{"seconds":"eight"}`), &request))
+}
+
+func TestVideoRequestValidate(t *testing.T) {
+	valid := VideoRequest{Model: "sora-2", Prompt: "a cat", Size: "1280x720"}
+	require.NoError(t, valid.Validate())
+
+	cases := map[string]VideoRequest{
+		"missing model":    {Prompt: "a cat"},
+		"missing prompt":   {Model: "sora-2", Prompt: "  "},
+		"negative seconds": {Model: "sora-2", Prompt: "a cat", Seconds: -1},
+		"invalid size":     {Model: "sora-2", Prompt: "a cat", Size: "720p"},
+	}
+	for name, request := range cases {
+		require.Error(t, request.Validate(), name)
+	}
+}
+
+func TestVideoRequestAspectRatio(t *testing.T) {
+	require.Equal(t, "16:9", (&VideoRequest{Size: "1280x720"}).AspectRatio())
+	require.Equal(t, "9:16", (&VideoRequest{Size: "720x1280"}).AspectRatio())
+	require.Empty(t, (&VideoRequest{}).AspectRatio())
+}
@@ -264,7 +264,13 @@ func IsGlobalPricingInitialized() bool {
 // 2. Adapter default pricing (second priority)
 // 3. Global pricing fallback (third priority)
 // 4. Final default (lowest priority)
+//
+// A pricing rule applied with ApplyPricingRule takes precedence over all of them.
 func GetModelRatioWithThreeLayers(modelName string, channelOverrides map[string]float64, adaptor adaptor.Adaptor) float64 {
+	if config, ok := ruleConfig(adaptor, modelName); ok {
+		return config.Ratio
+	}
+
 	// Layer 1: User custom ratio (channel-specific overrides)
 	if channelOverrides != nil {
 		if override, exists := channelOverrides[modelName]; exists {
@@ -297,6 +303,10 @@ func GetModelRatioWithThreeLayers(modelName string, channelOverrides map[string]
 
 // GetCompletionRatioWithThreeLayers implements the three-layer completion ratio fallback
 func GetCompletionRatioWithThreeLayers(modelName string, channelOverrides map[string]float64, adaptor adaptor.Adaptor) float64 {
+	if config, ok := ruleConfig(adaptor, modelName); ok {
+		return config.CompletionRatio
+	}
+
 	// Layer 1: User custom ratio (channel-specific overrides)
 	if channelOverrides != nil {
 		if override, exists := channelOverrides[modelName]; exists {
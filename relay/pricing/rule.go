@@ -0,0 +1,112 @@
+package pricing
+
+import (
+	"maps"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
+)
+
+// ruleAdaptor prices one model with the pricing of a matched pricing rule and defers to the
+// wrapped adaptor for everything else.
+type ruleAdaptor struct {
+	adaptor.Adaptor
+	modelName string
+	config    adaptor.ModelConfig
+}
+
+// ApplyPricingRule returns the adaptor to price modelName with once the overrides of a
+// pricing rule apply: the pricing the model would otherwise get, from the channel overrides,
+// the adaptor or the global pricing, with the fields set in overrides replaced. The result
+// takes precedence over channel overrides in the three-layer lookups.
+func ApplyPricingRule(base adaptor.Adaptor, modelName string, channelModelRatio, channelCompletionRatio map[string]float64, overrides *pricingrule.Pricing) adaptor.Adaptor {
+	if overrides == nil {
+		return base
+	}
+
+	var config adaptor.ModelConfig
+	if base != nil {
+		if cfg, ok := base.GetDefaultModelPricing()[modelName]; ok {
+			config = cfg
+		}
+	}
+	if config.Ratio == 0 && len(config.Tiers) == 0 {
+		if cfg, ok := GetGlobalModelPricing()[modelName]; ok {
+			config = cfg
+		}
+	}
+	config.Ratio = GetModelRatioWithThreeLayers(modelName, channelModelRatio, base)
+	config.CompletionRatio = GetCompletionRatioWithThreeLayers(modelName, channelCompletionRatio, base)
+
+	if overrides.Ratio != nil {
+		config.Ratio = *overrides.Ratio
+	}
+	if overrides.CompletionRatio != nil {
+		config.CompletionRatio = *overrides.CompletionRatio
+	}
+	if overrides.CachedInputRatio != nil {
+		config.CachedInputRatio = *overrides.CachedInputRatio
+	}
+	if overrides.CacheWrite5mRatio != nil {
+		config.CacheWrite5mRatio = *overrides.CacheWrite5mRatio
+	}
+	if overrides.CacheWrite1hRatio != nil {
+		config.CacheWrite1hRatio = *overrides.CacheWrite1hRatio
+	}
+	if overrides.Tiers != nil {
+		config.Tiers = make([]adaptor.ModelRatioTier, 0, len(overrides.Tiers))
+		for _, tier := range overrides.Tiers {
+			config.Tiers = append(config.Tiers, adaptor.ModelRatioTier{
+				Ratio:               tier.Ratio,
+				CompletionRatio:     tier.CompletionRatio,
+				CachedInputRatio:    tier.CachedInputRatio,
+				CacheWrite5mRatio:   tier.CacheWrite5mRatio,
+				CacheWrite1hRatio:   tier.CacheWrite1hRatio,
+				InputTokenThreshold: tier.InputTokenThreshold,
+			})
+		}
+	}
+
+	return &ruleAdaptor{Adaptor: base, modelName: modelName, config: config}
+}
+
+// ruleConfig returns the pricing the rule set for modelName, if any.
+func ruleConfig(a adaptor.Adaptor, modelName string) (adaptor.ModelConfig, bool) {
+	ruled, ok := a.(*ruleAdaptor)
+	if !ok || ruled.modelName != modelName {
+		return adaptor.ModelConfig{}, false
+	}
+	return ruled.config, true
+}
+
+func (a *ruleAdaptor) GetDefaultModelPricing() map[string]adaptor.ModelConfig {
+	pricing := make(map[string]adaptor.ModelConfig)
+	if a.Adaptor != nil {
+		pricing = maps.Clone(a.Adaptor.GetDefaultModelPricing())
+		if pricing == nil {
+			pricing = make(map[string]adaptor.ModelConfig)
+		}
+	}
+	pricing[a.modelName] = a.config
+	return pricing
+}
+
+func (a *ruleAdaptor) GetModelRatio(modelName string) float64 {
+	if modelName == a.modelName {
+		return a.config.Ratio
+	}
+	if a.Adaptor == nil {
+		return (&adaptor.DefaultPricingMethods{}).GetModelRatio(modelName)
+	}
+	return a.Adaptor.GetModelRatio(modelName)
+}
+
+func (a *ruleAdaptor) GetCompletionRatio(modelName string) float64 {
+	if modelName == a.modelName {
+		return a.config.CompletionRatio
+	}
+	if a.Adaptor == nil {
+		return (&adaptor.DefaultPricingMethods{}).GetCompletionRatio(modelName)
+	}
+	return a.Adaptor.GetCompletionRatio(modelName)
+}
@@ -0,0 +1,57 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/songquanpeng/one-api/relay/adaptor"
+	"github.com/songquanpeng/one-api/relay/pricingrule"
+)
+
+func TestApplyPricingRule(t *testing.T) {
+	a := &localMockAdaptor{pricing: map[string]adaptor.ModelConfig{
+		"m":     {Ratio: 2.0, CompletionRatio: 4.0, CachedInputRatio: 0.5},
+		"other": {Ratio: 3.0, CompletionRatio: 1.0},
+	}}
+	ratio := 1.0
+	cached := 0.25
+	ruled := ApplyPricingRule(a, "m", nil, nil, &pricingrule.Pricing{
+		Ratio:            &ratio,
+		CachedInputRatio: &cached,
+		Tiers:            []pricingrule.Tier{{InputTokenThreshold: 1000, Ratio: 1.5}},
+	})
+
+	// the rule beats channel overrides, unset fields are inherited
+	if got := GetModelRatioWithThreeLayers("m", map[string]float64{"m": 9.0}, ruled); got != 1.0 {
+		t.Fatalf("model ratio: got %v, want 1.0", got)
+	}
+	if got := GetCompletionRatioWithThreeLayers("m", nil, ruled); got != 4.0 {
+		t.Fatalf("completion ratio: got %v, want 4.0", got)
+	}
+	eff := ResolveEffectivePricing("m", 100, ruled)
+	if eff.InputRatio != 1.0 || eff.CachedInputRatio != 0.25 {
+		t.Fatalf("base pricing: got %+v", eff)
+	}
+	eff = ResolveEffectivePricing("m", 2000, ruled)
+	if eff.InputRatio != 1.5 || eff.AppliedTierThreshold != 1000 {
+		t.Fatalf("tier pricing: got %+v", eff)
+	}
+
+	// other models keep their pricing
+	if got := GetModelRatioWithThreeLayers("other", nil, ruled); got != 3.0 {
+		t.Fatalf("other model ratio: got %v, want 3.0", got)
+	}
+
+	// the channel override is the base the rule applies on
+	completion := 2.0
+	ruled = ApplyPricingRule(a, "m", map[string]float64{"m": 5.0}, nil, &pricingrule.Pricing{CompletionRatio: &completion})
+	if got := GetModelRatioWithThreeLayers("m", nil, ruled); got != 5.0 {
+		t.Fatalf("channel override ratio: got %v, want 5.0", got)
+	}
+	if got := GetCompletionRatioWithThreeLayers("m", nil, ruled); got != 2.0 {
+		t.Fatalf("overridden completion ratio: got %v, want 2.0", got)
+	}
+
+	if ApplyPricingRule(a, "m", nil, nil, nil) != adaptor.Adaptor(a) {
+		t.Fatal("a rule without pricing should keep the adaptor")
+	}
+}
@@ -0,0 +1,312 @@
+// Package pricingrule holds the pricing rules that refine the flat GroupRatio for a group,
+// a model and a time window: off-peak discounts, dated promotions, or a team's own price for
+// a model.
+//
+// Rules are stored as a JSON array in the GroupPricingRules option. Resolution is
+// deterministic: the first rule, in order, whose groups, models and time window match the
+// request applies, and nothing is combined across rules. The rule is resolved once, when the
+// request's channel is selected, and is recorded in the consume log.
+//
+//	[{
+//	  "name": "research-gpt-4o",
+//	  "groups": ["research"],
+//	  "models": ["gpt-4o*"],
+//	  "pricing": {"ratio": 1.25, "cached_input_ratio": 0.3125}
+//	}, {
+//	  "name": "night-discount",
+//	  "models": ["claude-*"],
+//	  "timezone": "America/New_York",
+//	  "daily_start": "22:00",
+//	  "daily_end": "06:00",
+//	  "group_ratio": 0.5
+//	}, {
+//	  "name": "launch-promo",
+//	  "groups": ["default"],
+//	  "models": ["gemini-2.5-pro"],
+//	  "start_at": 1767225600,
+//	  "end_at": 1769904000,
+//	  "group_ratio": 0.8
+//	}]
+package pricingrule
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	gmw "github.com/Laisky/gin-middlewares/v6"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/ctxkey"
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// Tier overrides the pricing from InputTokenThreshold input tokens on, like the tiers of the
+// adaptor pricing tables; zero fields inherit from the base pricing.
+type Tier struct {
+	InputTokenThreshold int     `json:"input_token_threshold"`
+	Ratio               float64 `json:"ratio"`
+	CompletionRatio     float64 `json:"completion_ratio,omitempty"`
+	CachedInputRatio    float64 `json:"cached_input_ratio,omitempty"`
+	CacheWrite5mRatio   float64 `json:"cache_write_5m_ratio,omitempty"`
+	CacheWrite1hRatio   float64 `json:"cache_write_1h_ratio,omitempty"`
+}
+
+// Pricing overrides fields of the model pricing the request would otherwise be billed with,
+// whether it comes from the channel, the adaptor or the global pricing. Nil fields are kept;
+// Tiers, when set, replace the tiers of the model. It is a local mirror of the pricing fields
+// of adaptor.ModelConfig, which cannot be imported from the option table.
+type Pricing struct {
+	Ratio             *float64 `json:"ratio,omitempty"`
+	CompletionRatio   *float64 `json:"completion_ratio,omitempty"`
+	CachedInputRatio  *float64 `json:"cached_input_ratio,omitempty"`
+	CacheWrite5mRatio *float64 `json:"cache_write_5m_ratio,omitempty"`
+	CacheWrite1hRatio *float64 `json:"cache_write_1h_ratio,omitempty"`
+	Tiers             []Tier   `json:"tiers,omitempty"`
+}
+
+// Rule is a pricing rule.
+//
+// Fields:
+//   - Name: identifies the rule in the consume log.
+//   - Groups, Models: requests the rule applies to; empty matches all. Model patterns are
+//     globs where "*" matches any sequence of characters.
+//   - StartAt, EndAt: unix seconds bounding the rule, e.g. a promotion; zero is unbounded.
+//   - Weekdays: days the rule applies on, 0 being Sunday; empty matches every day.
+//   - DailyStart, DailyEnd: "HH:MM" window of the day the rule applies in, which may wrap
+//     past midnight; both empty matches the whole day.
+//   - Timezone: IANA zone the weekdays and daily window are read in, UTC by default.
+//   - GroupRatio: replaces the group ratio of the request.
+//   - Pricing: overrides the model pricing of the request.
+type Rule struct {
+	Name       string   `json:"name"`
+	Groups     []string `json:"groups,omitempty"`
+	Models     []string `json:"models,omitempty"`
+	StartAt    int64    `json:"start_at,omitempty"`
+	EndAt      int64    `json:"end_at,omitempty"`
+	Weekdays   []int    `json:"weekdays,omitempty"`
+	DailyStart string   `json:"daily_start,omitempty"`
+	DailyEnd   string   `json:"daily_end,omitempty"`
+	Timezone   string   `json:"timezone,omitempty"`
+	GroupRatio *float64 `json:"group_ratio,omitempty"`
+	Pricing    *Pricing `json:"pricing,omitempty"`
+
+	location         *time.Location
+	dailyStartMinute int
+	dailyEndMinute   int
+}
+
+var (
+	ruleLock sync.RWMutex
+	rules    []Rule
+)
+
+// Validate checks that the rule is usable and prepares its time window.
+func (r *Rule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("name is required")
+	}
+	if r.GroupRatio == nil && r.Pricing == nil {
+		return errors.New("group_ratio or pricing is required")
+	}
+	if r.GroupRatio != nil && *r.GroupRatio < 0 {
+		return errors.New("group_ratio must not be negative")
+	}
+	if r.Pricing != nil {
+		if err := r.Pricing.validate(); err != nil {
+			return errors.Wrap(err, "pricing")
+		}
+	}
+	if r.StartAt < 0 || r.EndAt < 0 || (r.EndAt != 0 && r.EndAt <= r.StartAt) {
+		return errors.New("end_at must be after start_at")
+	}
+	for _, weekday := range r.Weekdays {
+		if weekday < 0 || weekday > 6 {
+			return errors.Errorf("invalid weekday %d, must be 0 (Sunday) to 6", weekday)
+		}
+	}
+
+	r.location = time.UTC
+	if r.Timezone != "" {
+		location, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			return errors.Wrapf(err, "invalid timezone %q", r.Timezone)
+		}
+		r.location = location
+	}
+
+	if (r.DailyStart == "") != (r.DailyEnd == "") {
+		return errors.New("daily_start and daily_end must be set together")
+	}
+	if r.DailyStart != "" {
+		var err error
+		if r.dailyStartMinute, err = parseClock(r.DailyStart); err != nil {
+			return errors.Wrap(err, "daily_start")
+		}
+		if r.dailyEndMinute, err = parseClock(r.DailyEnd); err != nil {
+			return errors.Wrap(err, "daily_end")
+		}
+		if r.dailyStartMinute == r.dailyEndMinute {
+			return errors.New("daily_start and daily_end must differ")
+		}
+	}
+	return nil
+}
+
+func (p *Pricing) validate() error {
+	for _, ratio := range []*float64{p.Ratio, p.CompletionRatio} {
+		if ratio != nil && *ratio < 0 {
+			return errors.New("ratio and completion_ratio must not be negative")
+		}
+	}
+	for i := range p.Tiers {
+		if p.Tiers[i].InputTokenThreshold <= 0 {
+			return errors.Errorf("tier %d: input_token_threshold must be positive", i)
+		}
+		if i > 0 && p.Tiers[i].InputTokenThreshold <= p.Tiers[i-1].InputTokenThreshold {
+			return errors.New("tiers must be sorted by ascending input_token_threshold")
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(clock string) (int, error) {
+	parsed, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, errors.Errorf("invalid time of day %q, expected HH:MM", clock)
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+// Matches reports whether the rule applies to requests of group for model at now.
+func (r *Rule) Matches(group, model string, now time.Time) bool {
+	if len(r.Groups) > 0 && !slices.Contains(r.Groups, group) {
+		return false
+	}
+	if len(r.Models) > 0 && !slices.ContainsFunc(r.Models, func(pattern string) bool {
+		return matchGlob(pattern, model)
+	}) {
+		return false
+	}
+	return r.activeAt(now)
+}
+
+// activeAt reports whether now falls in the time window of the rule.
+func (r *Rule) activeAt(now time.Time) bool {
+	if r.StartAt != 0 && now.Unix() < r.StartAt {
+		return false
+	}
+	if r.EndAt != 0 && now.Unix() >= r.EndAt {
+		return false
+	}
+	location := r.location
+	if location == nil {
+		location = time.UTC
+	}
+	local := now.In(location)
+	if len(r.Weekdays) > 0 && !slices.Contains(r.Weekdays, int(local.Weekday())) {
+		return false
+	}
+	if r.DailyStart == "" {
+		return true
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if r.dailyStartMinute < r.dailyEndMinute {
+		return minute >= r.dailyStartMinute && minute < r.dailyEndMinute
+	}
+	// the window wraps past midnight
+	return minute >= r.dailyStartMinute || minute < r.dailyEndMinute
+}
+
+// matchGlob matches model against pattern, where "*" matches any sequence of characters,
+// slashes included.
+func matchGlob(pattern, model string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == model
+	}
+	if !strings.HasPrefix(model, parts[0]) {
+		return false
+	}
+	rest := model[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		index := strings.Index(rest, part)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(part):]
+	}
+	return strings.HasSuffix(rest, parts[len(parts)-1])
+}
+
+// Match returns the first rule applying to requests of group for model at now, or nil.
+func Match(group, model string, now time.Time) *Rule {
+	ruleLock.RLock()
+	defer ruleLock.RUnlock()
+	for i := range rules {
+		if rules[i].Matches(group, model, now) {
+			rule := rules[i]
+			return &rule
+		}
+	}
+	return nil
+}
+
+// FromContext returns the rule matched for the request, or nil.
+func FromContext(ctx context.Context) *Rule {
+	ginCtx, ok := gmw.GetGinCtxFromStdCtx(ctx)
+	if !ok {
+		return nil
+	}
+	value, _ := ginCtx.Get(ctxkey.PricingRule)
+	rule, _ := value.(*Rule)
+	return rule
+}
+
+// Rules2JSONString serializes the rules for the option table.
+func Rules2JSONString() string {
+	ruleLock.RLock()
+	defer ruleLock.RUnlock()
+	if rules == nil {
+		return "[]"
+	}
+	jsonBytes, err := json.Marshal(rules)
+	if err != nil {
+		logger.Logger.Error("error marshalling group pricing rules", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// ParseRules parses a JSON array of rules and validates each of them.
+func ParseRules(jsonStr string) ([]Rule, error) {
+	var parsed []Rule
+	if strings.TrimSpace(jsonStr) != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &parsed); err != nil {
+			return nil, errors.Wrap(err, "unmarshal group pricing rules")
+		}
+	}
+	for i := range parsed {
+		if err := parsed[i].Validate(); err != nil {
+			return nil, errors.Wrapf(err, "group pricing rule %d", i)
+		}
+	}
+	return parsed, nil
+}
+
+// UpdateRulesByJSONString replaces the rules after validating them.
+func UpdateRulesByJSONString(jsonStr string) error {
+	parsed, err := ParseRules(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	ruleLock.Lock()
+	defer ruleLock.Unlock()
+	rules = parsed
+	return nil
+}
@@ -0,0 +1,75 @@
+package pricingrule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRulesValidates(t *testing.T) {
+	for _, invalid := range []string{
+		`[{"group_ratio":0.5}]`,
+		`[{"name":"empty"}]`,
+		`[{"name":"negative","group_ratio":-1}]`,
+		`[{"name":"tz","timezone":"Mars/Olympus","group_ratio":0.5}]`,
+		`[{"name":"half","daily_start":"22:00","group_ratio":0.5}]`,
+		`[{"name":"clock","daily_start":"25:00","daily_end":"06:00","group_ratio":0.5}]`,
+		`[{"name":"dates","start_at":200,"end_at":100,"group_ratio":0.5}]`,
+		`[{"name":"weekday","weekdays":[7],"group_ratio":0.5}]`,
+		`[{"name":"tiers","pricing":{"tiers":[{"input_token_threshold":2000},{"input_token_threshold":1000}]}}]`,
+	} {
+		_, err := ParseRules(invalid)
+		require.Error(t, err, invalid)
+	}
+
+	parsed, err := ParseRules(`[{"name":"night","models":["claude-*"],"timezone":"Asia/Tokyo","daily_start":"22:00","daily_end":"06:00","group_ratio":0.5}]`)
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	require.Equal(t, 22*60, parsed[0].dailyStartMinute)
+
+	parsed, err = ParseRules("")
+	require.NoError(t, err)
+	require.Empty(t, parsed)
+}
+
+func TestMatchFirstRuleWins(t *testing.T) {
+	require.NoError(t, UpdateRulesByJSONString(`[
+		{"name":"research","groups":["research"],"models":["gpt-4o*"],"pricing":{"ratio":1.25}},
+		{"name":"night","models":["gpt-4o*","claude-*"],"daily_start":"22:00","daily_end":"06:00","group_ratio":0.5},
+		{"name":"promo","groups":["default"],"models":["gemini-2.5-pro"],"start_at":1767225600,"end_at":1769904000,"group_ratio":0.8}
+	]`))
+	t.Cleanup(func() { require.NoError(t, UpdateRulesByJSONString("")) })
+
+	day := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 1, 5, 23, 30, 0, 0, time.UTC)
+
+	require.Equal(t, "research", Match("research", "gpt-4o-mini", night).Name)
+	require.Equal(t, "night", Match("default", "gpt-4o-mini", night).Name)
+	require.Equal(t, "night", Match("default", "claude-sonnet-4", night.Add(4*time.Hour)).Name)
+	require.Nil(t, Match("default", "claude-sonnet-4", day))
+	require.Equal(t, "promo", Match("default", "gemini-2.5-pro", day).Name)
+	require.Nil(t, Match("default", "gemini-2.5-pro", time.Unix(1769904000, 0)))
+	require.Nil(t, Match("vip", "gemini-2.5-pro", day))
+}
+
+func TestRuleTimeWindow(t *testing.T) {
+	rule := Rule{Name: "weekend", Timezone: "America/New_York", Weekdays: []int{0, 6},
+		DailyStart: "09:00", DailyEnd: "17:00", GroupRatio: new(float64)}
+	require.NoError(t, rule.Validate())
+
+	// Saturday 10:00 in New York is 15:00 UTC
+	require.True(t, rule.Matches("default", "any", time.Date(2026, 1, 3, 15, 0, 0, 0, time.UTC)))
+	// Saturday 08:00 in New York
+	require.False(t, rule.Matches("default", "any", time.Date(2026, 1, 3, 13, 0, 0, 0, time.UTC)))
+	// Friday 10:00 in New York
+	require.False(t, rule.Matches("default", "any", time.Date(2026, 1, 2, 15, 0, 0, 0, time.UTC)))
+}
+
+func TestMatchGlob(t *testing.T) {
+	require.True(t, matchGlob("gpt-4o*", "gpt-4o-mini"))
+	require.True(t, matchGlob("*", "anything"))
+	require.True(t, matchGlob("*/llama-*-instruct", "meta/llama-3.1-instruct"))
+	require.False(t, matchGlob("gpt-4o", "gpt-4o-mini"))
+	require.False(t, matchGlob("claude-*-4", "claude-sonnet-4-5"))
+}
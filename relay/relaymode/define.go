@@ -21,4 +21,8 @@ const (
 	ClaudeMessages
 	// Realtime is for OpenAI Realtime API websocket sessions
 	Realtime
+	// GeminiGenerateContent is for native Gemini API generateContent / streamGenerateContent requests
+	GeminiGenerateContent
+	// Videos is for OpenAI-style /v1/videos asynchronous video generation jobs
+	Videos
 )
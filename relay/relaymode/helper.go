@@ -12,6 +12,8 @@ func GetByPath(path string) int {
 		return ResponseAPI
 	case strings.HasPrefix(path, "/v1/messages"):
 		return ClaudeMessages
+	case strings.HasPrefix(path, GeminiModelsPathPrefix):
+		return GeminiGenerateContent
 	case strings.HasPrefix(path, "/v1/chat/completions"):
 		return ChatCompletions
 	case strings.HasPrefix(path, "/v1/completions"):
@@ -37,7 +39,33 @@ func GetByPath(path string) int {
 		return AudioTranslation
 	case strings.HasPrefix(path, "/v1/images/edits"):
 		return ImagesEdits
+	case strings.HasPrefix(path, "/v1/videos"):
+		return Videos
 	default:
 		return Unknown
 	}
 }
+
+// GeminiModelsPathPrefix is the path prefix of the native Gemini API model actions.
+const GeminiModelsPathPrefix = "/v1beta/models/"
+
+// Native Gemini API model actions, the part after the colon in /v1beta/models/{model}:{action}.
+const (
+	GeminiActionGenerateContent       = "generateContent"
+	GeminiActionStreamGenerateContent = "streamGenerateContent"
+	GeminiActionCountTokens           = "countTokens"
+)
+
+// ParseGeminiModelAction splits a native Gemini API path such as
+// /v1beta/models/gemini-2.5-pro:streamGenerateContent into the model and the action.
+func ParseGeminiModelAction(path string) (model string, action string, ok bool) {
+	rest, found := strings.CutPrefix(path, GeminiModelsPathPrefix)
+	if !found {
+		return "", "", false
+	}
+	idx := strings.LastIndexByte(rest, ':')
+	if idx <= 0 || idx == len(rest)-1 {
+		return "", "", false
+	}
+	return rest[:idx], rest[idx+1:], true
+}
@@ -10,3 +10,24 @@ func TestGetByPathRealtime(t *testing.T) {
 		t.Fatalf("expected Realtime with query, got %d", got)
 	}
 }
+
+func TestGeminiModelAction(t *testing.T) {
+	if got := GetByPath("/v1beta/models/gemini-2.5-pro:streamGenerateContent"); got != GeminiGenerateContent {
+		t.Fatalf("expected GeminiGenerateContent, got %d", got)
+	}
+	model, action, ok := ParseGeminiModelAction("/v1beta/models/gemini-2.5-pro:streamGenerateContent")
+	if !ok || model != "gemini-2.5-pro" || action != GeminiActionStreamGenerateContent {
+		t.Fatalf("unexpected parse result: %q %q %v", model, action, ok)
+	}
+	if _, _, ok := ParseGeminiModelAction("/v1beta/models/gemini-2.5-pro"); ok {
+		t.Fatal("expected a path without action to be rejected")
+	}
+}
+
+func TestGetByPathVideos(t *testing.T) {
+	for _, path := range []string{"/v1/videos", "/v1/videos/video_123", "/v1/videos/video_123/content"} {
+		if got := GetByPath(path); got != Videos {
+			t.Fatalf("expected Videos for %s, got %d", path, got)
+		}
+	}
+}
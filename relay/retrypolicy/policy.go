@@ -0,0 +1,218 @@
+// Package retrypolicy holds the declarative retry and fallback policies applied by the relay
+// when a request fails upstream.
+//
+// Policies are stored as a JSON array in the RetryPolicy option. The first policy whose
+// groups and models match the request applies; requests matching no policy keep the built-in
+// behaviour driven by RetryTimes.
+//
+//	[{
+//	  "groups": ["default"],
+//	  "models": ["claude-sonnet-*"],
+//	  "max_attempts": 5,
+//	  "attempts_per_model": 2,
+//	  "retry_on_status": [429, 500, 502, 503, 504],
+//	  "retry_on_error_types": ["overloaded_error"],
+//	  "backoff": {"initial_ms": 200, "max_ms": 2000, "multiplier": 2, "jitter": 0.2},
+//	  "deadline_ms": 60000,
+//	  "fallback_models": ["gpt-4.1", "gemini-2.5-pro"]
+//	}]
+package retrypolicy
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Laisky/errors/v2"
+	"github.com/Laisky/zap"
+
+	"github.com/songquanpeng/one-api/common/logger"
+)
+
+// maxAttemptsLimit bounds max_attempts so a policy cannot hold a request for ever.
+const maxAttemptsLimit = 20
+
+// Backoff configures the delay before each retry: InitialMs grows by Multiplier per retry up
+// to MaxMs, and is then spread by ±Jitter (a fraction of the delay).
+type Backoff struct {
+	InitialMs  int     `json:"initial_ms,omitempty"`
+	MaxMs      int     `json:"max_ms,omitempty"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	Jitter     float64 `json:"jitter,omitempty"`
+}
+
+// Policy is a retry and fallback policy.
+//
+// Fields:
+//   - Groups, Models: requests the policy applies to; empty matches all. A model pattern
+//     ending in "*" matches by prefix.
+//   - MaxAttempts: attempts in total, including the first one and fallback models.
+//   - AttemptsPerModel: attempts per model before moving to the next fallback model; 0 moves
+//     on only once the model has no untried channel left.
+//   - RetryOnStatus, RetryOnErrorTypes: failures that are retried, matched against the status
+//     code and the error type or code. When both are empty the built-in classification applies.
+//   - DeadlineMs: no retry starts once this much time has passed since the request arrived.
+//   - FallbackModels: models tried in order once the requested model is exhausted.
+type Policy struct {
+	Groups            []string `json:"groups,omitempty"`
+	Models            []string `json:"models,omitempty"`
+	MaxAttempts       int      `json:"max_attempts"`
+	AttemptsPerModel  int      `json:"attempts_per_model,omitempty"`
+	RetryOnStatus     []int    `json:"retry_on_status,omitempty"`
+	RetryOnErrorTypes []string `json:"retry_on_error_types,omitempty"`
+	Backoff           Backoff  `json:"backoff"`
+	DeadlineMs        int      `json:"deadline_ms,omitempty"`
+	FallbackModels    []string `json:"fallback_models,omitempty"`
+}
+
+var (
+	policyLock sync.RWMutex
+	policies   []Policy
+)
+
+// Validate checks that the policy is usable.
+func (p *Policy) Validate() error {
+	if p.MaxAttempts < 1 || p.MaxAttempts > maxAttemptsLimit {
+		return errors.Errorf("max_attempts must be between 1 and %d", maxAttemptsLimit)
+	}
+	if p.AttemptsPerModel < 0 {
+		return errors.New("attempts_per_model must not be negative")
+	}
+	for _, status := range p.RetryOnStatus {
+		if status < 400 || status > 599 {
+			return errors.Errorf("retry_on_status %d is not an HTTP error status", status)
+		}
+	}
+	if p.Backoff.InitialMs < 0 || p.Backoff.MaxMs < 0 || p.Backoff.Multiplier < 0 {
+		return errors.New("backoff values must not be negative")
+	}
+	if p.Backoff.Jitter < 0 || p.Backoff.Jitter > 1 {
+		return errors.New("backoff jitter must be between 0 and 1")
+	}
+	if p.DeadlineMs < 0 {
+		return errors.New("deadline_ms must not be negative")
+	}
+	for _, model := range p.FallbackModels {
+		if strings.TrimSpace(model) == "" {
+			return errors.New("fallback_models must not contain empty names")
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the policy applies to requests of group for model.
+func (p *Policy) Matches(group, model string) bool {
+	if len(p.Groups) > 0 && !slices.Contains(p.Groups, group) {
+		return false
+	}
+	if len(p.Models) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(p.Models, func(pattern string) bool {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			return strings.HasPrefix(model, prefix)
+		}
+		return pattern == model
+	})
+}
+
+// HasRetryConditions reports whether the policy decides itself which failures are retried.
+func (p *Policy) HasRetryConditions() bool {
+	return len(p.RetryOnStatus) > 0 || len(p.RetryOnErrorTypes) > 0
+}
+
+// Retryable reports whether a failure with statusCode and the given error type and code is
+// retried by the policy.
+func (p *Policy) Retryable(statusCode int, errorType string, errorCode any) bool {
+	if slices.Contains(p.RetryOnStatus, statusCode) {
+		return true
+	}
+	code, _ := errorCode.(string)
+	return slices.ContainsFunc(p.RetryOnErrorTypes, func(t string) bool {
+		return t != "" && (t == errorType || t == code)
+	})
+}
+
+// Deadline returns the overall time budget of a request, 0 when unbounded.
+func (p *Policy) Deadline() time.Duration {
+	return time.Duration(p.DeadlineMs) * time.Millisecond
+}
+
+// Delay returns the backoff before the retry-th retry, starting at 1.
+func (b Backoff) Delay(retry int) time.Duration {
+	if b.InitialMs <= 0 || retry < 1 {
+		return 0
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(b.InitialMs) * math.Pow(multiplier, float64(retry-1))
+	if b.MaxMs > 0 && delay > float64(b.MaxMs) {
+		delay = float64(b.MaxMs)
+	}
+	if b.Jitter > 0 {
+		delay *= 1 + b.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay * float64(time.Millisecond))
+}
+
+// Match returns the first policy applying to requests of group for model, or nil.
+func Match(group, model string) *Policy {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	for i := range policies {
+		if policies[i].Matches(group, model) {
+			policy := policies[i]
+			return &policy
+		}
+	}
+	return nil
+}
+
+// Policies2JSONString serializes the policies for the option table.
+func Policies2JSONString() string {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	if policies == nil {
+		return "[]"
+	}
+	jsonBytes, err := json.Marshal(policies)
+	if err != nil {
+		logger.Logger.Error("error marshalling retry policies", zap.Error(err))
+	}
+	return string(jsonBytes)
+}
+
+// ParsePolicies parses a JSON array of policies and validates each of them.
+func ParsePolicies(jsonStr string) ([]Policy, error) {
+	var parsed []Policy
+	if strings.TrimSpace(jsonStr) != "" {
+		if err := json.Unmarshal([]byte(jsonStr), &parsed); err != nil {
+			return nil, errors.Wrap(err, "unmarshal retry policies")
+		}
+	}
+	for i := range parsed {
+		if err := parsed[i].Validate(); err != nil {
+			return nil, errors.Wrapf(err, "retry policy %d", i)
+		}
+	}
+	return parsed, nil
+}
+
+// UpdatePoliciesByJSONString replaces the policies after validating them.
+func UpdatePoliciesByJSONString(jsonStr string) error {
+	parsed, err := ParsePolicies(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	policies = parsed
+	return nil
+}
@@ -0,0 +1,68 @@
+package retrypolicy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePoliciesValidates(t *testing.T) {
+	_, err := ParsePolicies(`[{"max_attempts":0}]`)
+	require.Error(t, err)
+	_, err = ParsePolicies(`[{"max_attempts":3,"retry_on_status":[200]}]`)
+	require.Error(t, err)
+	_, err = ParsePolicies(`[{"max_attempts":3,"backoff":{"jitter":2}}]`)
+	require.Error(t, err)
+
+	parsed, err := ParsePolicies(`[{"models":["claude-*"],"max_attempts":3,"fallback_models":["gpt-4.1"]}]`)
+	require.NoError(t, err)
+	require.Len(t, parsed, 1)
+	require.Equal(t, []string{"gpt-4.1"}, parsed[0].FallbackModels)
+
+	parsed, err = ParsePolicies("")
+	require.NoError(t, err)
+	require.Empty(t, parsed)
+}
+
+func TestMatchFirstPolicyWins(t *testing.T) {
+	require.NoError(t, UpdatePoliciesByJSONString(`[
+		{"groups":["vip"],"models":["claude-sonnet-*"],"max_attempts":5},
+		{"models":["claude-sonnet-4"],"max_attempts":2},
+		{"max_attempts":3}
+	]`))
+	t.Cleanup(func() { require.NoError(t, UpdatePoliciesByJSONString("")) })
+
+	require.Equal(t, 5, Match("vip", "claude-sonnet-4-5").MaxAttempts)
+	require.Equal(t, 2, Match("default", "claude-sonnet-4").MaxAttempts)
+	require.Equal(t, 3, Match("default", "gpt-4o").MaxAttempts)
+
+	require.NoError(t, UpdatePoliciesByJSONString(`[{"groups":["vip"],"max_attempts":5}]`))
+	require.Nil(t, Match("default", "gpt-4o"))
+	require.JSONEq(t, `[{"groups":["vip"],"max_attempts":5,"backoff":{}}]`, Policies2JSONString())
+}
+
+func TestRetryable(t *testing.T) {
+	p := &Policy{MaxAttempts: 3, RetryOnStatus: []int{429, 503}, RetryOnErrorTypes: []string{"overloaded_error", "server_busy"}}
+	require.True(t, p.HasRetryConditions())
+	require.True(t, p.Retryable(429, "", nil))
+	require.False(t, p.Retryable(500, "api_error", nil))
+	require.True(t, p.Retryable(500, "overloaded_error", nil))
+	require.True(t, p.Retryable(400, "", "server_busy"))
+	require.False(t, (&Policy{MaxAttempts: 1}).HasRetryConditions())
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{InitialMs: 100, MaxMs: 300, Multiplier: 2}
+	require.Equal(t, 100*time.Millisecond, b.Delay(1))
+	require.Equal(t, 200*time.Millisecond, b.Delay(2))
+	require.Equal(t, 300*time.Millisecond, b.Delay(3))
+	require.Zero(t, Backoff{}.Delay(1))
+
+	b.Jitter = 0.5
+	for range 50 {
+		delay := b.Delay(1)
+		require.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		require.LessOrEqual(t, delay, 150*time.Millisecond)
+	}
+}
@@ -23,6 +23,7 @@ var ErrQuotaExceeded = errors.New("streaming quota exceeded")
 // initialize a streaming quota tracker.
 type QuotaTrackerParams struct {
 	UserID                 int
+	OrganizationID         int // charge the organization pool instead of the user when set
 	TokenID                int
 	ChannelID              int
 	ModelName              string
@@ -124,6 +125,27 @@ func (t *QuotaTracker) UpdateFinalUsage(usage *relaymodel.Usage) {
 	t.mu.Unlock()
 }
 
+// AddUsage accumulates the authoritative usage of one finished turn of a long-lived
+// session (e.g. a Realtime response.done event) and charges the new total immediately.
+func (t *QuotaTracker) AddUsage(usage *relaymodel.Usage) error {
+	if usage == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	if t.finalUsage == nil {
+		t.finalUsage = &relaymodel.Usage{}
+	}
+	MergeUsage(t.finalUsage, usage)
+	t.completionSum = t.finalUsage.CompletionTokens
+	err := t.flushLocked(true)
+	t.mu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "flush streaming quota after usage update")
+	}
+	return nil
+}
+
 // Finalize flushes any remaining quota and returns the usage snapshot alongside
 // the amount already charged during streaming.
 func (t *QuotaTracker) Finalize(finalUsage *relaymodel.Usage) (*relaymodel.Usage, int64, error) {
@@ -205,7 +227,7 @@ func (t *QuotaTracker) flushLocked(force bool) error {
 		return err
 	}
 
-	if err := model.CacheDecreaseUserQuota(ctx, t.params.UserID, delta); err != nil {
+	if err := model.CacheDecreaseQuotaPool(ctx, t.params.UserID, t.params.OrganizationID, delta); err != nil {
 		t.params.Logger.Warn("streaming quota tracker failed to update user cache",
 			zap.Int("user_id", t.params.UserID),
 			zap.Error(err))
@@ -234,9 +256,9 @@ func (t *QuotaTracker) ensureQuotaLocked(delta int64) error {
 	if delta <= 0 {
 		return nil
 	}
-	remaining, err := model.GetUserQuota(t.params.UserID)
+	remaining, err := model.GetQuotaPool(t.params.UserID, t.params.OrganizationID)
 	if err != nil {
-		return errors.Wrap(err, "get user quota during streaming flush")
+		return errors.Wrap(err, "get quota pool during streaming flush")
 	}
 	if remaining < delta {
 		return ErrQuotaExceeded
@@ -257,3 +279,31 @@ func (t *QuotaTracker) currentUsageLocked() *relaymodel.Usage {
 		TotalTokens:      total,
 	}
 }
+
+// MergeUsage adds the token counts of src onto dst.
+func MergeUsage(dst, src *relaymodel.Usage) {
+	dst.PromptTokens += src.PromptTokens
+	dst.CompletionTokens += src.CompletionTokens
+	dst.TotalTokens += src.TotalTokens
+	dst.ToolsCost += src.ToolsCost
+	dst.CacheWrite5mTokens += src.CacheWrite5mTokens
+	dst.CacheWrite1hTokens += src.CacheWrite1hTokens
+
+	if src.PromptTokensDetails != nil {
+		if dst.PromptTokensDetails == nil {
+			dst.PromptTokensDetails = &relaymodel.UsagePromptTokensDetails{}
+		}
+		dst.PromptTokensDetails.CachedTokens += src.PromptTokensDetails.CachedTokens
+		dst.PromptTokensDetails.AudioTokens += src.PromptTokensDetails.AudioTokens
+		dst.PromptTokensDetails.TextTokens += src.PromptTokensDetails.TextTokens
+		dst.PromptTokensDetails.ImageTokens += src.PromptTokensDetails.ImageTokens
+	}
+	if src.CompletionTokensDetails != nil {
+		if dst.CompletionTokensDetails == nil {
+			dst.CompletionTokensDetails = &relaymodel.UsageCompletionTokensDetails{}
+		}
+		dst.CompletionTokensDetails.ReasoningTokens += src.CompletionTokensDetails.ReasoningTokens
+		dst.CompletionTokensDetails.AudioTokens += src.CompletionTokensDetails.AudioTokens
+		dst.CompletionTokensDetails.TextTokens += src.CompletionTokensDetails.TextTokens
+	}
+}
@@ -35,6 +35,7 @@ func SetApiRouter(router *gin.Engine) {
 		apiRouter.GET("/oauth/wechat/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), auth.WeChatBind)
 		apiRouter.GET("/oauth/email/bind", middleware.CriticalRateLimit(), middleware.UserAuth(), controller.EmailBind)
 		apiRouter.POST("/topup", middleware.AdminAuth(), controller.AdminTopUp)
+		apiRouter.POST("/payment/webhook/:provider", controller.PaymentWebhook)
 
 		userRoute := apiRouter.Group("/user")
 		{
@@ -53,6 +54,10 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.GET("/token", controller.GenerateAccessToken)
 				selfRoute.GET("/aff", controller.GetAffCode)
 				selfRoute.POST("/topup", controller.TopUp)
+				selfRoute.POST("/topup/checkout", middleware.CriticalRateLimit(), controller.CreateTopUpCheckout)
+				selfRoute.GET("/topup/orders", controller.GetSelfTopUpOrders)
+				selfRoute.GET("/credit_grants", controller.GetSelfCreditGrants)
+				selfRoute.GET("/statement", controller.GetSelfStatement)
 				selfRoute.GET("/available_models", controller.GetUserAvailableModels)
 				selfRoute.GET("/totp/status", controller.GetTotpStatus)
 				selfRoute.GET("/totp/setup", controller.SetupTotp)
@@ -66,6 +71,8 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/", controller.GetAllUsers)
 				adminRoute.GET("/search", controller.SearchUsers)
 				adminRoute.GET("/:id", controller.GetUser)
+				adminRoute.GET("/:id/credit_grants", controller.GetUserCreditGrants)
+				adminRoute.GET("/:id/statement", controller.GetUserStatement)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
 				adminRoute.PUT("/", controller.UpdateUser)
@@ -93,10 +100,14 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/update_balance/:id", controller.UpdateChannelBalance)
 			channelRoute.GET("/pricing/:id", controller.GetChannelPricing)
 			channelRoute.GET("/default-pricing", controller.GetChannelDefaultPricing)
+			channelRoute.GET("/keys/:id", controller.GetChannelKeys)
+			channelRoute.GET("/circuit-breakers", controller.GetCircuitBreakers)
 			channelRoute.POST("/", controller.AddChannel)
 			channelRoute.PUT("/", controller.UpdateChannel)
 			channelRoute.PUT("/pricing/:id", controller.UpdateChannelPricing)
+			channelRoute.PUT("/keys/:id", controller.UpdateChannelKey)
 			channelRoute.DELETE("/disabled", controller.DeleteDisabledChannel)
+			channelRoute.DELETE("/circuit-breakers/:id", controller.ResetCircuitBreakers)
 			channelRoute.DELETE("/:id", controller.DeleteChannel)
 		}
 		debugRoute := apiRouter.Group("/debug")
@@ -119,12 +130,30 @@ func SetApiRouter(router *gin.Engine) {
 			tokenRoute.POST("/", controller.AddToken)
 			tokenRoute.PUT("/", controller.UpdateToken)
 			tokenRoute.DELETE("/:id", controller.DeleteToken)
-			apiRouter.POST("/token/consume", middleware.TokenAuth(), controller.ConsumeToken)
+			apiRouter.POST("/token/consume", middleware.TokenAuth(), middleware.TokenRateLimit(), controller.ConsumeToken)
 		}
 		costRoute := apiRouter.Group("/cost")
 		{
 			costRoute.GET("/request/:request_id", controller.GetRequestCost)
 		}
+		organizationRoute := apiRouter.Group("/organization")
+		{
+			organizationRoute.GET("/", middleware.AdminAuth(), controller.GetAllOrganizations)
+			organizationRoute.POST("/", middleware.AdminAuth(), controller.AddOrganization)
+			organizationRoute.PUT("/", middleware.AdminAuth(), controller.UpdateOrganization)
+			organizationRoute.DELETE("/:id", middleware.AdminAuth(), controller.DeleteOrganization)
+
+			organizationRoute.GET("/self", middleware.UserAuth(), controller.GetSelfOrganizations)
+			organizationRoute.GET("/:id", middleware.UserAuth(), controller.GetOrganization)
+			organizationRoute.GET("/:id/members", middleware.UserAuth(), controller.GetOrganizationMembers)
+			organizationRoute.POST("/:id/members", middleware.UserAuth(), controller.AddOrganizationMember)
+			organizationRoute.PUT("/:id/members", middleware.UserAuth(), controller.UpdateOrganizationMember)
+			organizationRoute.DELETE("/:id/members/:user_id", middleware.UserAuth(), controller.RemoveOrganizationMember)
+			organizationRoute.POST("/:id/transfer", middleware.UserAuth(), controller.TransferOrganizationQuota)
+			organizationRoute.GET("/:id/logs", middleware.UserAuth(), controller.GetOrganizationLogs)
+			organizationRoute.GET("/:id/dashboard", middleware.UserAuth(), controller.GetOrganizationDashboard)
+		}
+		apiRouter.GET("/credit_grant/summary", middleware.AdminAuth(), controller.GetCreditGrantSummary)
 		redemptionRoute := apiRouter.Group("/redemption")
 		redemptionRoute.Use(middleware.AdminAuth())
 		{
@@ -143,6 +172,14 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
+		logRoute.GET("/export", middleware.AdminAuth(), middleware.DownloadRateLimit(), controller.ExportAllLogs)
+		logRoute.GET("/self/export", middleware.UserAuth(), middleware.DownloadRateLimit(), controller.ExportUserLogs)
+
+		auditRoute := apiRouter.Group("/audit")
+		auditRoute.Use(middleware.RootAuth())
+		{
+			auditRoute.GET("/", controller.GetAuditLogs)
+		}
 
 		// Tracing routes
 		traceRoute := apiRouter.Group("/trace")
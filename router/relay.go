@@ -31,6 +31,7 @@ func SetRelayRouter(router *gin.Engine) {
 		// Track in-flight requests for graceful shutdown/drain
 		func(c *gin.Context) { done := graceful.BeginRequest(); defer done(); c.Next() },
 		middleware.RelayPanicRecover(), middleware.TokenAuth(),
+		middleware.TokenRateLimit(),
 		middleware.Distribute(),
 		middleware.GlobalRelayRateLimit(),
 		middleware.ChannelRateLimit(),
@@ -39,6 +40,59 @@ func SetRelayRouter(router *gin.Engine) {
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(relayMws...)
 
+	// Files and Batch API. Upstream file and batch ids only exist on the channel that issued
+	// them, so PinBatchResource resolves that channel before Distribute runs.
+	batchRouter := router.Group("/v1")
+	batchRouter.Use(
+		func(c *gin.Context) { done := graceful.BeginRequest(); defer done(); c.Next() },
+		middleware.RelayPanicRecover(), middleware.TokenAuth(),
+		middleware.TokenRateLimit(),
+		middleware.PinBatchResource(),
+		middleware.Distribute(),
+		middleware.GlobalRelayRateLimit(),
+		middleware.ChannelRateLimit(),
+	)
+	{
+		batchRouter.POST("/files", controller.RelayFileUpload)
+		batchRouter.GET("/files/:id", controller.RelayFileRetrieve)
+		batchRouter.GET("/files/:id/content", controller.RelayFileContent)
+		batchRouter.DELETE("/files/:id", controller.RelayFileDelete)
+		batchRouter.POST("/batches", controller.RelayBatchCreate)
+		batchRouter.GET("/batches/:id", controller.RelayBatchRetrieve)
+		batchRouter.POST("/batches/:id/cancel", controller.RelayBatchCancel)
+	}
+	// listings span every channel and are served from local records
+	batchListRouter := router.Group("/v1")
+	batchListRouter.Use(middleware.TokenAuth())
+	{
+		batchListRouter.GET("/files", controller.ListFiles)
+		batchListRouter.GET("/batches", controller.ListBatches)
+	}
+
+	// Video generation jobs. Polls are pinned to the channel that started the job.
+	videoRouter := router.Group("/v1")
+	videoRouter.Use(
+		func(c *gin.Context) { done := graceful.BeginRequest(); defer done(); c.Next() },
+		middleware.RelayPanicRecover(), middleware.TokenAuth(),
+		middleware.TokenRateLimit(),
+		middleware.PinVideoJob(),
+		middleware.Distribute(),
+		middleware.GlobalRelayRateLimit(),
+		middleware.ChannelRateLimit(),
+	)
+	{
+		videoRouter.POST("/videos", controller.RelayVideoCreate)
+		videoRouter.GET("/videos/:id", controller.RelayVideoRetrieve)
+		videoRouter.GET("/videos/:id/content", controller.RelayVideoContent)
+	}
+
+	// Native Gemini API, for clients built on the Google GenAI SDKs
+	relayV1BetaRouter := router.Group("/v1beta")
+	relayV1BetaRouter.Use(relayMws...)
+	{
+		relayV1BetaRouter.POST("/models/:modelAction", controller.RelayGemini)
+	}
+
 	// Legacy compatibility is maintained via middleware rewrite to /v1/messages.
 
 	{
@@ -49,8 +103,10 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/responses", controller.Relay)
 		relayV1Router.GET("/responses/:response_id", controller.RelayResponseGet)
 		relayV1Router.DELETE("/responses/:response_id", controller.RelayResponseDelete)
+		relayV1Router.GET("/responses/:response_id/input_items", controller.RelayResponseInputItems)
 		relayV1Router.POST("/responses/:response_id/cancel", controller.RelayResponseCancel)
 		relayV1Router.POST("/messages", controller.Relay)
+		relayV1Router.POST("/messages/count_tokens", controller.RelayClaudeCountTokens)
 		relayV1Router.POST("/edits", controller.Relay)
 		relayV1Router.POST("/images/generations", controller.Relay)
 		relayV1Router.POST("/images/edits", controller.Relay)
@@ -61,11 +117,6 @@ func SetRelayRouter(router *gin.Engine) {
 		relayV1Router.POST("/audio/transcriptions", controller.Relay)
 		relayV1Router.POST("/audio/translations", controller.Relay)
 		relayV1Router.POST("/audio/speech", controller.Relay)
-		relayV1Router.GET("/files", controller.RelayNotImplemented)
-		relayV1Router.POST("/files", controller.RelayNotImplemented)
-		relayV1Router.DELETE("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id", controller.RelayNotImplemented)
-		relayV1Router.GET("/files/:id/content", controller.RelayNotImplemented)
 		relayV1Router.POST("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs", controller.RelayNotImplemented)
 		relayV1Router.GET("/fine_tuning/jobs/:id", controller.RelayNotImplemented)